@@ -0,0 +1,176 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Capabilities of Keyfactor Command that kfutil gates on the detected version.
+const (
+	capStoreTypeEntryParameters = "store-type-entry-parameters"
+	capAddJobFields             = "add-job-fields"
+	capRequiredCustomAlias      = "required-custom-alias"
+)
+
+// commandCapability is a feature of Keyfactor Command that only exists from MinVersion on.
+type commandCapability struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MinVersion  string `json:"min_version"`
+	Supported   bool   `json:"supported"`
+}
+
+var commandCapabilities = []commandCapability{
+	{Name: capStoreTypeEntryParameters, Description: "Entry parameters in store type definitions", MinVersion: "9.0"},
+	{Name: capAddJobFields, Description: "Entry parameters on certificate store add jobs", MinVersion: "9.0"},
+	{Name: capRequiredCustomAlias, Description: "Store types that require a custom alias", MinVersion: "10.0"},
+}
+
+var (
+	detectedVersion     string
+	detectedVersionErr  error
+	detectedVersionOnce sync.Once
+)
+
+// commandVersion returns the version of Keyfactor Command, as reported by its license endpoint. The version is
+// detected once per run.
+func commandVersion() (string, error) {
+	detectedVersionOnce.Do(func() {
+		sdkClient := initGenClient()
+		license, _, err := sdkClient.LicenseApi.LicenseGetCurrentLicense(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Execute()
+		if err != nil {
+			detectedVersionErr = err
+			return
+		}
+		if license.KeyfactorVersion == nil || *license.KeyfactorVersion == "" {
+			detectedVersionErr = fmt.Errorf("the API did not report a version")
+			return
+		}
+		detectedVersion = *license.KeyfactorVersion
+		log.Printf("[DEBUG] detected Keyfactor Command version %s", detectedVersion)
+	})
+	return detectedVersion, detectedVersionErr
+}
+
+func findCapability(name string) (commandCapability, bool) {
+	for _, c := range commandCapabilities {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return commandCapability{}, false
+}
+
+// requireCapability returns an error if the detected Keyfactor Command version does not support the capability. If the
+// version cannot be detected the request is allowed and left to the API to reject.
+func requireCapability(name string) error {
+	capability, ok := findCapability(name)
+	if !ok {
+		return fmt.Errorf("unknown capability '%s'", name)
+	}
+	version, err := commandVersion()
+	if err != nil {
+		log.Printf("[WARN] unable to detect Keyfactor Command version, not checking %s: %s", name, err)
+		return nil
+	}
+	if compareVersions(version, capability.MinVersion) < 0 {
+		return fmt.Errorf("%s requires Keyfactor Command >= %s, detected %s", capability.Description, capability.MinVersion, version)
+	}
+	return nil
+}
+
+// requireStoreTypeCapabilities checks that the detected Keyfactor Command version supports the fields used by a store
+// type definition.
+func requireStoreTypeCapabilities(storeType *api.CertificateStoreType) error {
+	if storeType.EntryParameters != nil && len(*storeType.EntryParameters) > 0 {
+		if err := requireCapability(capStoreTypeEntryParameters); err != nil {
+			return err
+		}
+	}
+	if strings.EqualFold(storeType.CustomAliasAllowed, "Required") {
+		if err := requireCapability(capRequiredCustomAlias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type apiInfo struct {
+	Hostname     string              `json:"hostname"`
+	Version      string              `json:"version,omitempty"`
+	APIVersion   string              `json:"api_version"`
+	Error        string              `json:"error,omitempty"`
+	Capabilities []commandCapability `json:"capabilities"`
+}
+
+var apiInfoCmd = &cobra.Command{
+	Use:   "api-info",
+	Short: "Show the detected Keyfactor Command version and the capabilities kfutil can use.",
+	Long: `Detects the version of Keyfactor Command and lists the version dependent features kfutil uses, and whether the
+instance supports them. Commands that use a feature the instance does not support fail with a "requires Keyfactor
+Command >= X" error before calling the API.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		info := apiInfo{
+			Hostname:   os.Getenv("KEYFACTOR_HOSTNAME"),
+			APIVersion: xKeyfactorApiVersion,
+		}
+		version, err := commandVersion()
+		if err != nil {
+			info.Error = err.Error()
+		}
+		info.Version = version
+		for _, c := range commandCapabilities {
+			c.Supported = err == nil && compareVersions(version, c.MinVersion) >= 0
+			info.Capabilities = append(info.Capabilities, c)
+		}
+
+		if jsonOut {
+			output, _ := json.Marshal(info)
+			fmt.Printf("%s\n", output)
+		} else {
+			fmt.Printf("Keyfactor Command: %s\n", info.Hostname)
+			if info.Error != "" {
+				fmt.Printf("  Version:     unknown (%s)\n", info.Error)
+			} else {
+				fmt.Printf("  Version:     %s\n", info.Version)
+			}
+			fmt.Printf("  API version: %s\n", info.APIVersion)
+			fmt.Println("  Capabilities:")
+			for _, c := range info.Capabilities {
+				supported := "no"
+				if c.Supported {
+					supported = "yes"
+				}
+				fmt.Printf("    %-28s %-4s %s (>= %s)\n", c.Name, supported, c.Description, c.MinVersion)
+			}
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	var jsonOut bool
+	RootCmd.AddCommand(apiInfoCmd)
+	apiInfoCmd.Flags().BoolVar(&jsonOut, "json", false, "Output as JSON.")
+}
@@ -0,0 +1,123 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// exitCodeDeadline is the exit code of a command stopped by --command-deadline, as returned by timeout(1).
+const exitCodeDeadline = 124
+
+// Default API call timeouts by kind of operation, used unless --api-timeout is set.
+const (
+	defaultAPITimeout          = 30 * time.Second
+	defaultAPIWriteTimeout     = time.Minute
+	defaultAPIListTimeout      = 2 * time.Minute
+	defaultAPIInventoryTimeout = 5 * time.Minute
+)
+
+// commandDeadline is the context of --command-deadline, nil if no deadline was set.
+var (
+	commandDeadline       context.Context
+	cancelCommandDeadline context.CancelFunc = func() {}
+)
+
+// apiOperationTimeout returns the default timeout of an API request. Inventory and list calls of large stores and
+// collections take much longer than single object lookups.
+func apiOperationTimeout(req *http.Request) time.Duration {
+	path := strings.ToLower(req.URL.Path)
+	switch {
+	case strings.Contains(path, "/inventory"):
+		return defaultAPIInventoryTimeout
+	case req.Method != http.MethodGet:
+		return defaultAPIWriteTimeout
+	case strings.HasSuffix(path, "/certificates") || strings.HasSuffix(path, "/certificatestores") || req.URL.Query().Get("pq.pageReturned") != "":
+		return defaultAPIListTimeout
+	default:
+		return defaultAPITimeout
+	}
+}
+
+// apiTimeoutTransport is an http.RoundTripper that limits each API request to its timeout and to the command
+// deadline.
+type apiTimeoutTransport struct {
+	base     http.RoundTripper
+	override time.Duration
+}
+
+// cancelOnClose cancels the context of a request when its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+func (t *apiTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.override
+	if timeout <= 0 {
+		timeout = apiOperationTimeout(req)
+	}
+	deadline := time.Now().Add(timeout)
+	if commandDeadline != nil {
+		if cmdDeadline, ok := commandDeadline.Deadline(); ok && cmdDeadline.Before(deadline) {
+			deadline = cmdDeadline
+		}
+	}
+	ctx, cancel := context.WithDeadline(req.Context(), deadline)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s %s timed out after %s, see --api-timeout: %w", req.Method, req.URL.Path, timeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// startAPITimeouts installs the API call timeouts and applies --command-deadline to the context of cmd.
+func startAPITimeouts(cmd *cobra.Command) error {
+	apiTimeout, _ := cmd.Flags().GetDuration("api-timeout")
+	deadline, _ := cmd.Flags().GetDuration("command-deadline")
+	if apiTimeout < 0 || deadline < 0 {
+		return fmt.Errorf("--api-timeout and --command-deadline must not be negative")
+	}
+	if deadline > 0 {
+		commandDeadline, cancelCommandDeadline = context.WithTimeout(commandContext(cmd), deadline)
+		cmd.SetContext(commandDeadline)
+		log.Printf("[INFO] command deadline %s", deadline)
+	}
+	http.DefaultTransport = &apiTimeoutTransport{base: http.DefaultTransport, override: apiTimeout}
+	return nil
+}
+
+// legacyHTTPClient returns the http.Client of the legacy client. It has no overall timeout, unlike the client's
+// default of 10s, and uses http.DefaultTransport, so its calls are limited by apiTimeoutTransport like those of the
+// SDK, e.g. 5m for inventory calls.
+func legacyHTTPClient() *http.Client {
+	return &http.Client{}
+}
+
+// deadlineExceeded reports whether the command was stopped by --command-deadline.
+func deadlineExceeded() bool {
+	return commandDeadline != nil && commandDeadline.Err() == context.DeadlineExceeded
+}
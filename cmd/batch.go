@@ -0,0 +1,238 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"kfutil/pkg/rot"
+)
+
+const (
+	defaultBatchConcurrency = 5
+	batchMaxRetries         = 3
+	// batchSlowFactor is how much slower than the fastest observed average latency a call must be before concurrency
+	// is reduced.
+	batchSlowFactor = 2.0
+)
+
+type batchOptions struct {
+	MaxRPS      float64
+	Concurrency int
+	// MaxStoresPerRequest is the number of stores a job may add a certificate to or remove it from, see
+	// addStoresPerRequestFlag. 0 uses the default of the command.
+	MaxStoresPerRequest int
+}
+
+// batchStats summarises a batch run.
+type batchStats struct {
+	Total            int
+	Succeeded        int
+	Failed           int
+	Throttled        int
+	Cancelled        int
+	FinalConcurrency int
+	Duration         time.Duration
+}
+
+// batchRunner runs API calls concurrently while staying under --max-rps. Concurrency starts at --concurrency, is halved
+// whenever the API responds with 429 Too Many Requests or latency degrades, and grows back while calls succeed quickly.
+type batchRunner struct {
+	opts batchOptions
+	// ctx stops the runner from starting new calls once it is cancelled.
+	ctx context.Context
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	active   int
+	nextSlot time.Time
+	latency  time.Duration // moving average
+	baseline time.Duration // fastest moving average seen
+	streak   int
+	stats    batchStats
+}
+
+// addBatchFlags adds the --concurrency and --max-rps flags used by newBatchRunnerFromFlags.
+func addBatchFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("concurrency", defaultBatchConcurrency, "Maximum number of concurrent API calls. Reduced automatically when the API is throttling.")
+	cmd.Flags().Float64("max-rps", 0, "Maximum number of API calls per second, 0 for no limit.")
+}
+
+// addStoresPerRequestFlag adds the --max-stores-per-request flag to commands that add or remove certificates in
+// batches.
+func addStoresPerRequestFlag(cmd *cobra.Command) {
+	cmd.Flags().Int("max-stores-per-request", rot.DefaultMaxStoresPerRequest,
+		"Maximum number of stores a certificate is added to or removed from in one API request. 1 sends a request per store.")
+}
+
+func newBatchRunnerFromFlags(cmd *cobra.Command) *batchRunner {
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	maxRPS, _ := cmd.Flags().GetFloat64("max-rps")
+	maxStores, _ := cmd.Flags().GetInt("max-stores-per-request")
+	b := newBatchRunner(batchOptions{MaxRPS: maxRPS, Concurrency: concurrency, MaxStoresPerRequest: maxStores})
+	b.ctx = commandContext(cmd)
+	return b
+}
+
+func newBatchRunner(opts batchOptions) *batchRunner {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	b := &batchRunner{opts: opts, ctx: context.Background(), limit: opts.Concurrency}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// isRateLimitError reports whether err is the API throttling requests.
+func isRateLimitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "429") || strings.Contains(strings.ToLower(msg), "too many requests")
+}
+
+func (b *batchRunner) acquire() {
+	b.mu.Lock()
+	for b.active >= b.limit {
+		b.cond.Wait()
+	}
+	b.active++
+	var wait time.Duration
+	if b.opts.MaxRPS > 0 {
+		now := time.Now()
+		if b.nextSlot.Before(now) {
+			b.nextSlot = now
+		}
+		wait = b.nextSlot.Sub(now)
+		b.nextSlot = b.nextSlot.Add(time.Duration(float64(time.Second) / b.opts.MaxRPS))
+	}
+	b.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// release records the outcome of a call and adapts the concurrency limit.
+func (b *batchRunner) release(elapsed time.Duration, throttled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active--
+	defer b.cond.Broadcast()
+
+	if throttled {
+		b.stats.Throttled++
+		b.streak = 0
+		if b.limit > 1 {
+			b.limit /= 2
+			log.Printf("[INFO] API throttling, reducing concurrency to %d", b.limit)
+		}
+		return
+	}
+	if b.latency == 0 {
+		b.latency = elapsed
+	} else {
+		b.latency = (b.latency*4 + elapsed) / 5
+	}
+	if b.baseline == 0 || b.latency < b.baseline {
+		b.baseline = b.latency
+	}
+	if float64(b.latency) > float64(b.baseline)*batchSlowFactor {
+		if b.limit > 1 {
+			b.limit--
+			log.Printf("[INFO] API latency %s, reducing concurrency to %d", b.latency, b.limit)
+		}
+		b.streak = 0
+		return
+	}
+	b.streak++
+	if b.streak >= b.limit && b.limit < b.opts.Concurrency {
+		b.limit++
+		b.streak = 0
+	}
+}
+
+// run calls job for 0..n-1 and returns the error of each job. Jobs that are throttled are retried with backoff. Jobs
+// not started when the runner's context is cancelled return the context error.
+func (b *batchRunner) run(n int, job func(i int) error) []error {
+	start := time.Now()
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for attempt := 0; ; attempt++ {
+				b.acquire()
+				if err := b.ctx.Err(); err != nil {
+					b.mu.Lock()
+					b.active--
+					b.cond.Broadcast()
+					b.mu.Unlock()
+					errs[i] = err
+					return
+				}
+				callStart := time.Now()
+				err := job(i)
+				throttled := isRateLimitError(err)
+				b.release(time.Since(callStart), throttled)
+				if !throttled || attempt >= batchMaxRetries {
+					errs[i] = err
+					return
+				}
+				select {
+				case <-time.After(time.Duration(1<<attempt) * time.Second):
+				case <-b.ctx.Done():
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Total += n
+	for _, err := range errs {
+		if isCancelled(err) {
+			b.stats.Cancelled++
+		} else if err != nil {
+			b.stats.Failed++
+		} else {
+			b.stats.Succeeded++
+		}
+	}
+	b.stats.Duration += time.Since(start)
+	b.stats.FinalConcurrency = b.limit
+	return errs
+}
+
+// snapshot returns the statistics of all runs so far.
+func (b *batchRunner) snapshot() batchStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// printStats prints the throughput statistics of all runs.
+func (b *batchRunner) printStats() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats
+	if s.Total == 0 {
+		return
+	}
+	rate := float64(s.Total) / s.Duration.Seconds()
+	printInfo("\n%d API operation(s) in %s (%.1f/s): %d succeeded, %d failed, %d throttled, final concurrency %d.\n",
+		s.Total, s.Duration.Round(time.Millisecond), rate, s.Succeeded, s.Failed, s.Throttled, s.FinalConcurrency)
+	if s.Cancelled > 0 {
+		printWarning("%d API operation(s) were not started because kfutil was interrupted.\n", s.Cancelled)
+	}
+}
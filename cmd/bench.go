@@ -0,0 +1,241 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// benchMaxErrorRate stops a benchmark from raising the concurrency further once this share of calls fails.
+	benchMaxErrorRate = 0.05
+	// benchThroughputShare is the share of the best throughput the recommended concurrency has to reach.
+	benchThroughputShare = 0.9
+	// benchRPSHeadroom is the share of the measured throughput recommended as --max-rps.
+	benchRPSHeadroom = 0.8
+)
+
+// benchLevel is the result of benchmarking one concurrency level.
+type benchLevel struct {
+	Concurrency   int     `json:"concurrency"`
+	Calls         int     `json:"calls"`
+	Errors        int     `json:"errors"`
+	Throttled     int     `json:"throttled"`
+	Seconds       float64 `json:"seconds"`
+	CallsPerSec   float64 `json:"calls_per_second"`
+	P50Millis     float64 `json:"p50_ms"`
+	P95Millis     float64 `json:"p95_ms"`
+	MaxMillis     float64 `json:"max_ms"`
+	errorRateHigh bool
+}
+
+// benchResult is the output of kfutil bench.
+type benchResult struct {
+	Hostname               string       `json:"hostname"`
+	Levels                 []benchLevel `json:"levels"`
+	RecommendedConcurrency int          `json:"recommended_concurrency"`
+	RecommendedMaxRPS      float64      `json:"recommended_max_rps"`
+}
+
+// parseConcurrencyLevels parses a --concurrency value: a single level, a comma separated list, or a range such as
+// 1..32 that is doubled from its start up to its end.
+func parseConcurrencyLevels(s string) ([]int, error) {
+	invalid := fmt.Errorf("invalid concurrency '%s', expected e.g. 8, 1,4,16 or 1..32", s)
+	if from, to, isRange := strings.Cut(s, ".."); isRange {
+		start, sErr := strconv.Atoi(strings.TrimSpace(from))
+		end, eErr := strconv.Atoi(strings.TrimSpace(to))
+		if sErr != nil || eErr != nil || start < 1 || end < start {
+			return nil, invalid
+		}
+		var levels []int
+		for c := start; c < end; c *= 2 {
+			levels = append(levels, c)
+		}
+		return append(levels, end), nil
+	}
+	var levels []int
+	for _, part := range strings.Split(s, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || c < 1 {
+			return nil, invalid
+		}
+		levels = append(levels, c)
+	}
+	sort.Ints(levels)
+	return levels, nil
+}
+
+// percentile returns the p-th percentile of sorted durations in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return float64(sorted[i].Microseconds()) / 1000
+}
+
+// runBenchLevel looks up calls stores with concurrency workers and measures the throughput and latency.
+func runBenchLevel(kfClient *api.Client, storeIDs []string, calls int, concurrency int) benchLevel {
+	level := benchLevel{Concurrency: concurrency, Calls: calls}
+	latencies := make([]time.Duration, 0, calls)
+	var mu sync.Mutex
+	next := make(chan string)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range next {
+				callStart := time.Now()
+				_, err := kfClient.GetCertificateStoreByID(id)
+				elapsed := time.Since(callStart)
+				mu.Lock()
+				latencies = append(latencies, elapsed)
+				if err != nil {
+					level.Errors++
+					if isRateLimitError(err) {
+						level.Throttled++
+					}
+					log.Printf("[WARN] bench lookup of store %s: %s", id, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < calls; i++ {
+		next <- storeIDs[i%len(storeIDs)]
+	}
+	close(next)
+	wg.Wait()
+	level.Seconds = time.Since(start).Seconds()
+	if level.Seconds > 0 {
+		level.CallsPerSec = float64(calls) / level.Seconds
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	level.P50Millis = percentile(latencies, 0.5)
+	level.P95Millis = percentile(latencies, 0.95)
+	level.MaxMillis = percentile(latencies, 1)
+	level.errorRateHigh = level.Throttled > 0 || float64(level.Errors) > benchMaxErrorRate*float64(calls)
+	return level
+}
+
+// recommendBenchSettings returns the lowest concurrency that reaches most of the best error free throughput, and a
+// --max-rps with headroom below the throughput measured at it.
+func recommendBenchSettings(levels []benchLevel) (int, float64) {
+	best := 0.0
+	for _, l := range levels {
+		if !l.errorRateHigh && l.CallsPerSec > best {
+			best = l.CallsPerSec
+		}
+	}
+	for _, l := range levels {
+		if !l.errorRateHigh && l.CallsPerSec >= benchThroughputShare*best && best > 0 {
+			return l.Concurrency, math.Floor(l.CallsPerSec * benchRPSHeadroom)
+		}
+	}
+	return 1, 0
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure API throughput and latency to size bulk operations.",
+	Long: `Looks up certificate stores at increasing concurrency to measure the throughput and latency of the Keyfactor
+API, then recommends --concurrency and --max-rps settings for 'stores rot' and other bulk commands in this
+environment. Only read-only calls are made. The benchmark stops raising the concurrency when the API starts
+throttling or more than 5% of the calls fail.`,
+	Example: `kfutil bench
+kfutil bench --stores 500 --concurrency 1..32`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		calls, _ := cmd.Flags().GetInt("stores")
+		concurrencyFlag, _ := cmd.Flags().GetString("concurrency")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		if calls < 1 {
+			fmt.Println("[ERROR] --stores must be at least 1")
+			log.Fatalf("[ERROR] invalid --stores: %d", calls)
+		}
+		levels, lErr := parseConcurrencyLevels(concurrencyFlag)
+		if lErr != nil {
+			fmt.Printf("[ERROR] %s\n", lErr)
+			log.Fatalf("[ERROR] %s", lErr)
+		}
+
+		kfClient, _ := initClient()
+		params := make(map[string]interface{})
+		storeList, sErr := kfClient.ListCertificateStores(&params)
+		if sErr != nil {
+			fmt.Printf("[ERROR] listing certificate stores: %s\n", sErr)
+			log.Fatalf("[ERROR] listing certificate stores: %s", sErr)
+		}
+		var storeIDs []string
+		for _, store := range *storeList {
+			storeIDs = append(storeIDs, store.Id)
+			if len(storeIDs) == calls {
+				break
+			}
+		}
+		if len(storeIDs) == 0 {
+			fmt.Println("[ERROR] no certificate stores to benchmark with")
+			log.Fatalf("[ERROR] no certificate stores found")
+		}
+
+		result := benchResult{Hostname: os.Getenv("KEYFACTOR_HOSTNAME")}
+		for _, concurrency := range levels {
+			if commandContext(cmd).Err() != nil {
+				break
+			}
+			printInfo("Looking up %d stores with concurrency %d...\n", calls, concurrency)
+			level := runBenchLevel(kfClient, storeIDs, calls, concurrency)
+			result.Levels = append(result.Levels, level)
+			if level.errorRateHigh {
+				printWarning("%d of %d calls failed (%d throttled) at concurrency %d, not going higher.\n",
+					level.Errors, level.Calls, level.Throttled, concurrency)
+				break
+			}
+		}
+		result.RecommendedConcurrency, result.RecommendedMaxRPS = recommendBenchSettings(result.Levels)
+
+		if jsonOut {
+			output, _ := json.MarshalIndent(result, "", "  ")
+			fmt.Fprintf(dataStdout, "%s\n", output)
+			return
+		}
+		fmt.Printf("%-12s %8s %8s %10s %10s %10s %10s\n", "CONCURRENCY", "CALLS", "ERRORS", "CALLS/S", "P50 MS", "P95 MS", "MAX MS")
+		for _, l := range result.Levels {
+			fmt.Printf("%-12d %8d %8d %10.1f %10.0f %10.0f %10.0f\n", l.Concurrency, l.Calls, l.Errors, l.CallsPerSec, l.P50Millis, l.P95Millis, l.MaxMillis)
+		}
+		if result.RecommendedMaxRPS == 0 {
+			printWarning("No concurrency level completed without errors, keep the defaults and check the API health.\n")
+			return
+		}
+		fmt.Printf("\nRecommended: --concurrency %d --max-rps %.0f\n", result.RecommendedConcurrency, result.RecommendedMaxRPS)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().Int("stores", 100, "Number of store lookups per concurrency level.")
+	benchCmd.Flags().String("concurrency", "1..32", "Concurrency levels to measure: a level, a comma separated list, or a range such as 1..32 that is doubled.")
+	benchCmd.Flags().Bool("json", false, "Output the results as JSON.")
+}
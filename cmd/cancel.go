@@ -0,0 +1,113 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// exitCodeInterrupted is the exit code of a command cancelled with Ctrl-C or SIGTERM, as returned by shells for
+// SIGINT.
+const exitCodeInterrupted = 130
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM. Commands finish the API call in progress,
+// flush what they have written and exit with exitCodeInterrupted. A second signal exits immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			// Restore the default handlers so a second signal terminates the process.
+			signal.Stop(sigs)
+			log.Printf("[INFO] received %s, cancelling", sig)
+			printWarning("\nInterrupted, finishing the calls in progress. Press Ctrl-C again to exit immediately.\n")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// commandContext returns the context of a command, cancelled when kfutil is interrupted.
+func commandContext(cmd *cobra.Command) context.Context {
+	if cmd != nil && cmd.Context() != nil {
+		return cmd.Context()
+	}
+	return context.Background()
+}
+
+// isCancelled reports whether err is the result of the command being interrupted.
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// exitIfInterrupted exits with exitCodeInterrupted if ctx was cancelled, or exitCodeDeadline if --command-deadline
+// was reached. what describes the work that was cut short.
+func exitIfInterrupted(ctx context.Context, what string) {
+	if ctx.Err() == nil {
+		return
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmt.Printf("[ERROR] command deadline exceeded, %s\n", what)
+		log.Printf("[ERROR] command deadline exceeded, %s", what)
+		recordResultFailure("command deadline exceeded, %s", what)
+		finishResult(exitCodeDeadline)
+		os.Exit(exitCodeDeadline)
+	}
+	fmt.Printf("[ERROR] interrupted, %s\n", what)
+	log.Printf("[ERROR] interrupted, %s", what)
+	recordResultFailure("interrupted, %s", what)
+	finishResult(exitCodeInterrupted)
+	os.Exit(exitCodeInterrupted)
+}
+
+// rotCheckpointPath returns the path of the checkpoint reconcileRoots writes when it is interrupted.
+func rotCheckpointPath(reportFile string) string {
+	if reportFile == stdioPath || reportFile == "" {
+		reportFile = reconcileDefaultFileName
+	}
+	return fmt.Sprintf("%s_checkpoint.csv", strings.TrimSuffix(reportFile, filepath.Ext(reportFile)))
+}
+
+// writeROTCheckpoint writes the actions that were not applied as an audit report, so the reconcile can be resumed
+// with `stores rot reconcile --import-csv --input-file <checkpoint>`. None of the actions were deployed, so the
+// Deployed column is always false.
+func writeROTCheckpoint(path string, actions []ROTAction) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(AuditHeader)
+	for _, a := range actions {
+		w.Write([]string{a.Thumbprint, strconv.Itoa(a.CertID), "", "", a.StoreID, a.StoreType, "", a.StorePath,
+			strconv.FormatBool(a.AddCert), strconv.FormatBool(a.RemoveCert), "false", GetCurrentTime(), "false", a.Alias})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
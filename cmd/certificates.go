@@ -15,16 +15,14 @@ import (
 
 // certificatesCmd represents the certificates command
 var certificatesCmd = &cobra.Command{
-	Use:   "certificates",
-	Short: "Keyfactor Command certificate APIs and utilities.",
-	Long:  `A collections of APIs and utilities for interacting with Keyfactor certificates.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("certificates called")
-	},
+	Use:     "certificates",
+	Aliases: []string{"certs"},
+	Short:   "Keyfactor Command certificate APIs and utilities.",
+	Long:    `A collections of APIs and utilities for interacting with Keyfactor certificates.`,
 }
 
 func init() {
-	//RootCmd.AddCommand(certificatesCmd)
+	RootCmd.AddCommand(certificatesCmd)
 
 	// Here you will define your flags and configuration settings.
 
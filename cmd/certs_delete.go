@@ -0,0 +1,176 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	certDeletePageSize  = 500
+	certDeleteBatchSize = 100
+)
+
+// queryCertificatesToDelete returns every certificate matching query, including expired and revoked certificates, as
+// those are usually what is being cleaned up. collectionID 0 queries all certificates.
+func queryCertificatesToDelete(ctx context.Context, sdkClient *keyfactor.APIClient, query string, collectionID int) ([]keyfactor.ModelsCertificateRetrievalResponse, error) {
+	var all []keyfactor.ModelsCertificateRetrievalResponse
+	for page := int32(1); ; page++ {
+		req := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqQueryString(query).PqIncludeExpired(true).PqIncludeRevoked(true).IncludeLocations(true).
+			PqSortField("Id").PqSortAscending(0).PqPageReturned(page).PqReturnLimit(certDeletePageSize)
+		if collectionID > 0 {
+			req = req.CollectionId(int32(collectionID))
+		}
+		certs, _, err := req.Execute()
+		if err != nil {
+			return nil, fmt.Errorf("querying certificates, page %d: %s", page, err)
+		}
+		all = append(all, certs...)
+		if len(certs) < certDeletePageSize {
+			return all, nil
+		}
+	}
+}
+
+// certDeletePhrase is the phrase that confirms the deletion of count certificates.
+func certDeletePhrase(count int) string {
+	return fmt.Sprintf("delete %d certificates", count)
+}
+
+// confirmCertDelete reads a line from in and reports whether it is the confirmation phrase of count certificates.
+func confirmCertDelete(in io.Reader, count int) bool {
+	printWarning("Type '%s' to delete them permanently: ", certDeletePhrase(count))
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.TrimSpace(line) == certDeletePhrase(count)
+}
+
+// printCertDeletePreview prints up to limit of the certificates to delete.
+func printCertDeletePreview(certs []keyfactor.ModelsCertificateRetrievalResponse, limit int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCN\tTHUMBPRINT\tNOT AFTER\tLOCATIONS")
+	for i, c := range certs {
+		if i == limit {
+			break
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", c.GetId(), c.GetIssuedCN(), c.GetThumbprint(), certExportTime(c.NotAfter), len(c.Locations))
+	}
+	w.Flush()
+	if len(certs) > limit {
+		fmt.Printf("... and %d more\n", len(certs)-limit)
+	}
+}
+
+var certsDeleteCmd = &cobra.Command{
+	Use:   "delete --query <query>",
+	Short: "Delete the certificates matching a query from Keyfactor Command.",
+	Long: `Deletes the certificate records matching a Keyfactor certificate query, e.g. stale certificates of a retired
+collection. Expired and revoked certificates are included. Certificates are deleted from Keyfactor Command only, not
+from the certificate stores they are in.
+
+The matching certificates are always listed first. To delete them, --confirm-count must be the number of matching
+certificates and the phrase 'delete <count> certificates' must be typed, or piped on stdin. Only the certificates that
+were listed are deleted, certificates that start matching the query in the meantime are not. Use --dry-run to only
+list them.`,
+	Example: `kfutil certs delete --query 'NotAfter -lt "2020-01-01"' --collection Old --dry-run
+kfutil certs delete --query 'NotAfter -lt "2020-01-01"' --collection Old --confirm-count 1250
+echo "delete 1250 certificates" | kfutil certs delete --query 'NotAfter -lt "2020-01-01"' --collection Old --confirm-count 1250`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		query, _ := cmd.Flags().GetString("query")
+		collection, _ := cmd.Flags().GetString("collection")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		confirmCount, _ := cmd.Flags().GetInt("confirm-count")
+		previewLimit, _ := cmd.Flags().GetInt("preview")
+
+		if strings.TrimSpace(query) == "" {
+			fmt.Println("[ERROR] --query is required, deleting all certificates is not supported")
+			log.Fatalf("[ERROR] empty query")
+		}
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		collectionID := 0
+		if collection != "" {
+			var err error
+			if collectionID, err = resolveCollectionID(ctx, sdkClient, collection); err != nil {
+				fmt.Printf("[ERROR] %s\n", err)
+				log.Fatalf("[ERROR] %s", err)
+			}
+		}
+		certs, qErr := queryCertificatesToDelete(ctx, sdkClient, query, collectionID)
+		if qErr != nil {
+			exitIfInterrupted(ctx, "nothing was deleted")
+			fmt.Printf("[ERROR] %s\n", qErr)
+			log.Fatalf("[ERROR] %s", qErr)
+		}
+		if len(certs) == 0 {
+			printInfo("No certificates match the query, nothing to delete.\n")
+			return
+		}
+		printCertDeletePreview(certs, previewLimit)
+		printWarning("%d certificate(s) match the query.\n", len(certs))
+		if dryRun {
+			printInfo("Dry run, nothing was deleted.\n")
+			return
+		}
+		if confirmCount != len(certs) {
+			fmt.Printf("[ERROR] %d certificate(s) match the query, rerun with --confirm-count %d to delete them\n", len(certs), len(certs))
+			log.Fatalf("[ERROR] --confirm-count %d does not match %d certificate(s)", confirmCount, len(certs))
+		}
+		if !confirmCertDelete(os.Stdin, len(certs)) {
+			fmt.Println("[ERROR] confirmation phrase did not match, nothing was deleted")
+			log.Fatalf("[ERROR] not confirmed")
+		}
+
+		deleted := 0
+		for start := 0; start < len(certs); start += certDeleteBatchSize {
+			end := start + certDeleteBatchSize
+			if end > len(certs) {
+				end = len(certs)
+			}
+			ids := make([]int32, 0, end-start)
+			for _, c := range certs[start:end] {
+				ids = append(ids, c.GetId())
+			}
+			req := sdkClient.CertificateApi.CertificateDeleteCertificates(ctx).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).Ids(ids)
+			if collectionID > 0 {
+				req = req.CollectionId(int32(collectionID))
+			}
+			if _, err := req.Execute(); err != nil {
+				exitIfInterrupted(ctx, fmt.Sprintf("%d of %d certificate(s) were deleted", deleted, len(certs)))
+				fmt.Printf("[ERROR] deleting certificates %d to %d: %s, %d of %d certificate(s) were deleted\n", ids[0], ids[len(ids)-1], err, deleted, len(certs))
+				log.Fatalf("[ERROR] deleting certificates: %s", err)
+			}
+			deleted += len(ids)
+			log.Printf("[INFO] deleted %d of %d certificate(s)", deleted, len(certs))
+		}
+		recordResultCount("deleted", deleted)
+		printRemoved("Deleted %d certificate(s).\n", deleted)
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsDeleteCmd)
+	certsDeleteCmd.Flags().String("query", "", "Keyfactor certificate query selecting the certificates to delete, e.g. 'NotAfter -lt \"2020-01-01\"'.")
+	certsDeleteCmd.Flags().String("collection", "", "Name or ID of a collection to limit the query to.")
+	certsDeleteCmd.Flags().Bool("dry-run", false, "Only list the certificates that would be deleted.")
+	certsDeleteCmd.Flags().Int("confirm-count", 0, "Number of certificates expected to match the query, required to delete them.")
+	certsDeleteCmd.Flags().Int("preview", 20, "Number of matching certificates to list before deleting.")
+	certsDeleteCmd.MarkFlagRequired("query")
+}
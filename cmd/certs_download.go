@@ -0,0 +1,211 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+	"go.mozilla.org/pkcs7"
+)
+
+// Certificate download formats.
+const (
+	certFormatPEM      = "pem"
+	certFormatDER      = "der"
+	certFormatP7B      = "p7b"
+	certFormatJKSEntry = "jks-entry"
+)
+
+// certFormatExtensions are the file extensions of the download formats.
+var certFormatExtensions = map[string]string{
+	certFormatPEM:      ".pem",
+	certFormatDER:      ".cer",
+	certFormatP7B:      ".p7b",
+	certFormatJKSEntry: ".jks",
+}
+
+// encodeCerts returns certs in a download format. der holds a single certificate.
+func encodeCerts(certs []*x509.Certificate, format string, jksPassword string) ([]byte, error) {
+	switch format {
+	case certFormatPEM:
+		var buf bytes.Buffer
+		for _, c := range certs {
+			pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+		}
+		return buf.Bytes(), nil
+	case certFormatDER:
+		if len(certs) != 1 {
+			return nil, fmt.Errorf("der holds a single certificate, use pem or p7b for %d certificates", len(certs))
+		}
+		return certs[0].Raw, nil
+	case certFormatP7B:
+		var der []byte
+		for _, c := range certs {
+			der = append(der, c.Raw...)
+		}
+		return pkcs7.DegenerateCertificate(der)
+	case certFormatJKSEntry:
+		return encodeJKS(jksTrustedCertEntries(certs), jksPassword, time.Now())
+	}
+	return nil, fmt.Errorf("invalid format '%s', must be one of pem, der, p7b or jks-entry", format)
+}
+
+// downloadCollectionCerts returns the certificates of a collection, with their chains if includeChain is set.
+// Certificates in more than one chain are returned once.
+func downloadCollectionCerts(ctx context.Context, sdkClient *keyfactor.APIClient, collection string, includeChain bool) ([]*x509.Certificate, error) {
+	id, err := resolveCollectionID(ctx, sdkClient, collection)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := queryCollectionCertificates(ctx, sdkClient, id, defaultCollectionPaging)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	seen := make(map[string]bool)
+	add := func(c *x509.Certificate) {
+		if tp := certThumbprint(c); !seen[tp] {
+			seen[tp] = true
+			certs = append(certs, c)
+		}
+	}
+	for _, l := range listed {
+		if !includeChain && l.GetContentBytes() != "" {
+			if der, dErr := base64.StdEncoding.DecodeString(l.GetContentBytes()); dErr == nil {
+				if c, pErr := x509.ParseCertificate(der); pErr == nil {
+					add(c)
+					continue
+				}
+			}
+		}
+		chain, dErr := downloadCertChain(ctx, sdkClient, l.GetId(), "", includeChain)
+		if dErr != nil {
+			return nil, fmt.Errorf("downloading certificate %d: %s", l.GetId(), dErr)
+		}
+		for _, c := range chain {
+			add(c)
+		}
+	}
+	return certs, nil
+}
+
+var certsDownloadCmd = &cobra.Command{
+	Use:   "download (--id <id> | --thumbprint <thumbprint> | --collection <name|id>)",
+	Short: "Download certificates in PEM, DER, PKCS#7 or Java keystore format.",
+	Long: `Downloads a certificate, optionally with its chain, or all certificates of a collection, and writes them in the
+format provisioning scripts need:
+
+  pem        PEM certificates, the certificate first
+  der        a DER certificate, without the chain
+  p7b        a PKCS#7 bundle
+  jks-entry  a Java keystore with a trusted certificate entry per certificate, aliased by CN
+
+Without --out the file is named after the thumbprint, ID or collection. Use --out - for stdout.`,
+	Example: `kfutil certs download --id 42 --format pem --include-chain --out server-chain.pem
+kfutil certs download --collection TrustedRoots --format p7b --out roots.p7b
+kfutil certs download --thumbprint 1A2B... --format jks-entry --store-password changeit --out truststore.jks`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		certID, _ := cmd.Flags().GetInt32("id")
+		thumbprint, _ := cmd.Flags().GetString("thumbprint")
+		collection, _ := cmd.Flags().GetString("collection")
+		format, _ := cmd.Flags().GetString("format")
+		includeChain, _ := cmd.Flags().GetBool("include-chain")
+		outpath, _ := cmd.Flags().GetString("out")
+		password, _ := cmd.Flags().GetString("store-password")
+		if password != jksDefaultPassword {
+			registerSecret(password)
+		}
+
+		format = strings.ToLower(format)
+		if _, ok := certFormatExtensions[format]; !ok {
+			fmt.Printf("[ERROR] invalid --format '%s', must be one of pem, der, p7b or jks-entry\n", format)
+			log.Fatalf("[ERROR] invalid --format: %s", format)
+		}
+		given := 0
+		for _, set := range []bool{certID != 0, thumbprint != "", collection != ""} {
+			if set {
+				given++
+			}
+		}
+		if given != 1 {
+			fmt.Println("[ERROR] exactly one of --id, --thumbprint or --collection is required")
+			log.Fatalf("[ERROR] no certificate given")
+		}
+
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		var certs []*x509.Certificate
+		var err error
+		name := collection
+		if collection != "" {
+			certs, err = downloadCollectionCerts(ctx, sdkClient, collection, includeChain)
+		} else {
+			certs, err = downloadCertChain(ctx, sdkClient, certID, thumbprint, includeChain)
+			if err == nil {
+				name = certThumbprint(certs[0])
+			}
+		}
+		if err != nil {
+			exitIfInterrupted(ctx, "nothing was written")
+			fmt.Printf("[ERROR] downloading certificates: %s\n", err)
+			log.Fatalf("[ERROR] downloading certificates: %s", err)
+		}
+		if len(certs) == 0 {
+			fmt.Println("[ERROR] no certificates to download")
+			log.Fatalf("[ERROR] no certificates to download")
+		}
+		if !includeChain && collection == "" {
+			certs = certs[:1]
+		}
+
+		data, err := encodeCerts(certs, format, password)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err)
+			log.Fatalf("[ERROR] %s", err)
+		}
+		if outpath == "" {
+			outpath = name + certFormatExtensions[format]
+		}
+		if outpath == stdioPath {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = writeOutputFile(outpath, data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, err)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, err)
+		}
+		if outpath != stdioPath {
+			printInfo("Wrote %d certificate(s) to %s\n", len(certs), outputName(outpath))
+		}
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsDownloadCmd)
+	certsDownloadCmd.Flags().Int32("id", 0, "Keyfactor ID of the certificate to download.")
+	certsDownloadCmd.Flags().String("thumbprint", "", "Thumbprint of the certificate to download.")
+	certsDownloadCmd.Flags().String("collection", "", "Name or ID of a collection to download all certificates of, e.g. into a p7b bundle.")
+	certsDownloadCmd.Flags().String("format", certFormatPEM, "Format to write, one of pem, der, p7b or jks-entry.")
+	certsDownloadCmd.Flags().Bool("include-chain", false, "Also download the chain of the certificates.")
+	certsDownloadCmd.Flags().String("out", "", "File to write to, '-' for stdout. Defaults to <thumbprint or collection>.<format extension>. Accepts s3://, az:// and gs:// URLs.")
+	certsDownloadCmd.Flags().String("store-password", jksDefaultPassword, "Password protecting the integrity of a jks-entry keystore.")
+	certsDownloadCmd.MarkFlagsMutuallyExclusive("id", "thumbprint", "collection")
+}
@@ -0,0 +1,280 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+// Values of --check-duplicates.
+const (
+	duplicateCheckOff   = "off"
+	duplicateCheckWarn  = "warn"
+	duplicateCheckAbort = "abort"
+)
+
+// How an existing certificate name matches a requested name.
+const (
+	duplicateMatchExact     = "exact"
+	duplicateMatchCoveredBy = "covered by wildcard"
+	duplicateMatchCovers    = "covered by requested wildcard"
+)
+
+const duplicateQueryLimit = 500
+
+// certDuplicate is an active certificate holding a name that is requested again.
+type certDuplicate struct {
+	CertID     int32  `json:"cert_id"`
+	Thumbprint string `json:"thumbprint"`
+	CN         string `json:"cn"`
+	NotAfter   string `json:"not_after"`
+	Requested  string `json:"requested"`
+	Existing   string `json:"existing"`
+	Match      string `json:"match"`
+}
+
+// dnsNameMatch returns how existing matches requested, or an empty string if it does not. A wildcard covers the names
+// one label below it, e.g. *.example.com covers app.example.com but not example.com or a.b.example.com.
+func dnsNameMatch(requested string, existing string) string {
+	requested, existing = strings.ToLower(strings.TrimSuffix(requested, ".")), strings.ToLower(strings.TrimSuffix(existing, "."))
+	covers := func(wildcard, name string) bool {
+		if !strings.HasPrefix(wildcard, "*.") || strings.HasPrefix(name, "*.") {
+			return false
+		}
+		label, rest, found := strings.Cut(name, ".")
+		return found && label != "" && rest == wildcard[2:]
+	}
+	switch {
+	case requested == existing:
+		return duplicateMatchExact
+	case covers(existing, requested):
+		return duplicateMatchCoveredBy
+	case covers(requested, existing):
+		return duplicateMatchCovers
+	}
+	return ""
+}
+
+// duplicateQuery returns the certificate query that finds the candidates for name: certificates with a CN or SAN
+// under its parent domain, which includes wildcards covering it. The candidates are matched exactly by dnsNameMatch.
+func duplicateQuery(name string) string {
+	search := strings.TrimPrefix(strings.ToLower(name), "*.")
+	if _, parent, found := strings.Cut(search, "."); found && strings.Contains(parent, ".") {
+		search = parent
+	}
+	search = strings.ReplaceAll(search, `"`, "")
+	return fmt.Sprintf(`CN -contains "%s" OR SAN -contains "%s"`, search, search)
+}
+
+// certNames returns the CN and the SAN values of c, without duplicates.
+func certNames(c *keyfactor.ModelsCertificateRetrievalResponse) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, n := range append([]string{c.GetIssuedCN()}, sanValues(c)...) {
+		key := strings.ToLower(n)
+		if n == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, n)
+	}
+	return names
+}
+
+// sanValues returns the subject alternative name values of c.
+func sanValues(c *keyfactor.ModelsCertificateRetrievalResponse) []string {
+	var values []string
+	for _, san := range c.SubjectAltNameElements {
+		values = append(values, san.GetValue())
+	}
+	return values
+}
+
+// findDuplicateCertificates returns the active certificates, neither expired nor revoked, that hold one of names
+// exactly, by a wildcard covering it, or that a requested wildcard would cover.
+func findDuplicateCertificates(ctx context.Context, sdkClient *keyfactor.APIClient, names []string) ([]certDuplicate, error) {
+	var duplicates []certDuplicate
+	seen := make(map[string]bool)
+	queried := make(map[string]bool)
+	now := time.Now()
+	for _, name := range names {
+		query := duplicateQuery(name)
+		if queried[query] {
+			continue
+		}
+		queried[query] = true
+		certs, _, err := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqQueryString(query).PqIncludeExpired(false).PqIncludeRevoked(false).Verbose(1).
+			PqReturnLimit(duplicateQueryLimit).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("searching certificates for %s: %s", name, err)
+		}
+		if len(certs) == duplicateQueryLimit {
+			log.Printf("[WARN] duplicate search for %s returned %d certificates, later matches were not checked", name, duplicateQueryLimit)
+		}
+		for i := range certs {
+			c := &certs[i]
+			if c.NotAfter != nil && c.NotAfter.Before(now) {
+				continue
+			}
+			for _, requested := range names {
+				for _, existing := range certNames(c) {
+					match := dnsNameMatch(requested, existing)
+					key := fmt.Sprintf("%d|%s|%s", c.GetId(), strings.ToLower(requested), strings.ToLower(existing))
+					if match == "" || seen[key] {
+						continue
+					}
+					seen[key] = true
+					duplicates = append(duplicates, certDuplicate{CertID: c.GetId(), Thumbprint: c.GetThumbprint(), CN: c.GetIssuedCN(),
+						NotAfter: certExportTime(c.NotAfter), Requested: requested, Existing: existing, Match: match})
+				}
+			}
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Requested != duplicates[j].Requested {
+			return duplicates[i].Requested < duplicates[j].Requested
+		}
+		return duplicates[i].CertID < duplicates[j].CertID
+	})
+	return duplicates, nil
+}
+
+// printCertDuplicates prints the duplicates as a table.
+func printCertDuplicates(duplicates []certDuplicate) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REQUESTED\tEXISTING\tMATCH\tCERT ID\tCN\tNOT AFTER")
+	for _, d := range duplicates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", d.Requested, d.Existing, d.Match, d.CertID, d.CN, d.NotAfter)
+	}
+	w.Flush()
+}
+
+// addDuplicateCheckFlag adds --check-duplicates to an enrollment command, see checkDuplicatesFromFlags.
+func addDuplicateCheckFlag(cmd *cobra.Command, defaultMode string) {
+	cmd.Flags().String("check-duplicates", defaultMode,
+		"Search for active certificates with the same CN or SANs before enrolling, including wildcards covering them: off, warn or abort.")
+}
+
+// checkDuplicatesFromFlags runs the duplicate check selected by --check-duplicates for the names of an enrollment. It
+// returns an error if duplicates were found in abort mode, or if the search failed in abort mode. In warn mode the
+// duplicates, or the failed search, are only reported.
+func checkDuplicatesFromFlags(ctx context.Context, cmd *cobra.Command, sdkClient *keyfactor.APIClient, names []string) error {
+	mode, _ := cmd.Flags().GetString("check-duplicates")
+	switch mode {
+	case duplicateCheckOff, "":
+		return nil
+	case duplicateCheckWarn, duplicateCheckAbort:
+	default:
+		return fmt.Errorf("invalid --check-duplicates '%s', must be one of off, warn or abort", mode)
+	}
+	duplicates, err := findDuplicateCertificates(ctx, sdkClient, names)
+	if err != nil {
+		if mode == duplicateCheckAbort {
+			return err
+		}
+		printWarning("Checking for duplicate certificates failed: %s\n", err)
+		return nil
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	printCertDuplicates(duplicates)
+	if mode == duplicateCheckAbort {
+		return fmt.Errorf("%d active certificate(s) already hold %s", countDuplicateCerts(duplicates), strings.Join(names, ", "))
+	}
+	printWarning("%d active certificate(s) already hold %s.\n", countDuplicateCerts(duplicates), strings.Join(names, ", "))
+	return nil
+}
+
+// countDuplicateCerts returns the number of distinct certificates among duplicates.
+func countDuplicateCerts(duplicates []certDuplicate) int {
+	ids := make(map[int32]bool)
+	for _, d := range duplicates {
+		ids[d.CertID] = true
+	}
+	return len(ids)
+}
+
+var certsCheckDuplicatesCmd = &cobra.Command{
+	Use:   "check-duplicates --cn <name> [--san <name>]",
+	Short: "Find active certificates that already hold a CN or SANs.",
+	Long: `Searches Keyfactor Command for active certificates, neither expired nor revoked, whose CN or SANs match the
+given names, before a new certificate is enrolled for them. Wildcards are taken into account: a certificate for
+*.example.com holds app.example.com, and a requested *.example.com matches existing certificates for app.example.com.
+Exits with status 1 if a duplicate is found, unless --warn-only is set.`,
+	Example: `kfutil certs check-duplicates --cn app.example.com --san www.app.example.com
+kfutil certs check-duplicates --cn '*.example.com' --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		cn, _ := cmd.Flags().GetString("cn")
+		sans, _ := cmd.Flags().GetStringSlice("san")
+		warnOnly, _ := cmd.Flags().GetBool("warn-only")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+
+		var names []string
+		for _, n := range append([]string{cn}, sans...) {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Println("[ERROR] one of --cn or --san is required")
+			log.Fatalf("[ERROR] no names given")
+		}
+		ctx := commandContext(cmd)
+		duplicates, err := findDuplicateCertificates(ctx, initGenClient(), names)
+		if err != nil {
+			exitIfInterrupted(ctx, "the search did not finish")
+			fmt.Printf("[ERROR] %s\n", err)
+			log.Fatalf("[ERROR] %s", err)
+		}
+		recordResultCount("duplicates", countDuplicateCerts(duplicates))
+		if jsonOut {
+			if duplicates == nil {
+				duplicates = []certDuplicate{}
+			}
+			output, _ := json.MarshalIndent(duplicates, "", "  ")
+			fmt.Println(string(output))
+		} else if len(duplicates) > 0 {
+			printCertDuplicates(duplicates)
+		}
+		if len(duplicates) == 0 {
+			if !jsonOut {
+				printInfo("No active certificate holds %s.\n", strings.Join(names, ", "))
+			}
+			return
+		}
+		printWarning("%d active certificate(s) already hold %s.\n", countDuplicateCerts(duplicates), strings.Join(names, ", "))
+		if !warnOnly {
+			finishResult(1)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsCheckDuplicatesCmd)
+	certsCheckDuplicatesCmd.Flags().String("cn", "", "Common name of the certificate to enroll.")
+	certsCheckDuplicatesCmd.Flags().StringSlice("san", nil, "DNS SAN of the certificate to enroll. Comma separated or repeated.")
+	certsCheckDuplicatesCmd.Flags().Bool("warn-only", false, "Exit with status 0 when duplicates are found.")
+	certsCheckDuplicatesCmd.Flags().Bool("json", false, "Print the duplicates as JSON.")
+}
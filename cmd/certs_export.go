@@ -0,0 +1,305 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	certExportFormatCSV     = "csv"
+	certExportFormatJSON    = "json"
+	certExportFormatParquet = "parquet"
+	certExportPageSize      = 1000
+)
+
+// certExportRecord is a certificate returned by the certificate query API.
+type certExportRecord = keyfactor.ModelsCertificateRetrievalResponse
+
+// certExportFields are the columns `certificates export-all` can write, by --fields name.
+var certExportFields = map[string]func(c *certExportRecord) string{
+	"id":         func(c *certExportRecord) string { return strconv.Itoa(int(c.GetId())) },
+	"thumbprint": func(c *certExportRecord) string { return c.GetThumbprint() },
+	"serial":     func(c *certExportRecord) string { return c.GetSerialNumber() },
+	"cn":         func(c *certExportRecord) string { return c.GetIssuedCN() },
+	"dn":         func(c *certExportRecord) string { return c.GetIssuedDN() },
+	"issuer":     func(c *certExportRecord) string { return c.GetIssuerDN() },
+	"notbefore":  func(c *certExportRecord) string { return certExportTime(c.NotBefore) },
+	"notafter":   func(c *certExportRecord) string { return certExportTime(c.NotAfter) },
+	"keytype":    func(c *certExportRecord) string { return c.GetKeyTypeString() },
+	"keysize":    func(c *certExportRecord) string { return strconv.Itoa(int(c.GetKeySizeInBits())) },
+	"algorithm":  func(c *certExportRecord) string { return c.GetSigningAlgorithm() },
+	"template":   func(c *certExportRecord) string { return c.GetTemplateName() },
+	"ca":         func(c *certExportRecord) string { return c.GetCertificateAuthorityName() },
+	"state":      func(c *certExportRecord) string { return c.GetCertStateString() },
+	"privatekey": func(c *certExportRecord) string { return strconv.FormatBool(c.GetHasPrivateKey()) },
+	"sans": func(c *certExportRecord) string {
+		var sans []string
+		for _, san := range c.SubjectAltNameElements {
+			sans = append(sans, san.GetValue())
+		}
+		return strings.Join(sans, ";")
+	},
+	"locations": func(c *certExportRecord) string {
+		var locations []string
+		for _, l := range c.Locations {
+			locations = append(locations, fmt.Sprintf("%s:%s", l.GetStoreMachine(), l.GetStorePath()))
+		}
+		return strings.Join(locations, ";")
+	},
+	"locationcount": func(c *certExportRecord) string { return strconv.Itoa(len(c.Locations)) },
+	"metadata": func(c *certExportRecord) string {
+		if c.Metadata == nil || len(*c.Metadata) == 0 {
+			return ""
+		}
+		data, _ := json.Marshal(*c.Metadata)
+		return string(data)
+	},
+}
+
+func certExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// certExportFieldNames returns the sorted names of certExportFields for help and error messages.
+func certExportFieldNames() []string {
+	names := make([]string, 0, len(certExportFields))
+	for name := range certExportFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// certExportWriter writes exported certificates as CSV rows, JSON lines or a Parquet file with a row group per page.
+type certExportWriter struct {
+	fields  []string
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	parquet *parquetWriter
+	// rows are the rows of the current page for Parquet.
+	rows [][]string
+}
+
+func newCertExportWriter(w io.Writer, format string, fields []string) (*certExportWriter, error) {
+	cw := &certExportWriter{fields: fields, buf: bufio.NewWriter(w)}
+	if format == certExportFormatCSV {
+		cw.csv = csv.NewWriter(cw.buf)
+		if err := cw.csv.Write(fields); err != nil {
+			return nil, err
+		}
+	}
+	if format == certExportFormatParquet {
+		var err error
+		if cw.parquet, err = newParquetWriter(cw.buf, fields); err != nil {
+			return nil, err
+		}
+	}
+	return cw, nil
+}
+
+func (w *certExportWriter) write(c *certExportRecord) error {
+	if w.csv != nil || w.parquet != nil {
+		row := make([]string, len(w.fields))
+		for i, f := range w.fields {
+			row[i] = certExportFields[f](c)
+		}
+		if w.parquet != nil {
+			w.rows = append(w.rows, row)
+			return nil
+		}
+		return w.csv.Write(row)
+	}
+	obj := make(map[string]string, len(w.fields))
+	for _, f := range w.fields {
+		obj[f] = certExportFields[f](c)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(append(data, '\n'))
+	return err
+}
+
+// flush writes the buffered rows, so a page is on disk before the next one is requested.
+func (w *certExportWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if w.parquet != nil {
+		if err := w.parquet.writeRowGroup(w.rows); err != nil {
+			return err
+		}
+		w.rows = nil
+	}
+	return w.buf.Flush()
+}
+
+// close flushes the buffered rows and, for Parquet, writes the file metadata. It does not close the output.
+func (w *certExportWriter) close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.parquet != nil {
+		if err := w.parquet.close(); err != nil {
+			return err
+		}
+	}
+	return w.buf.Flush()
+}
+
+var certsExportAllCmd = &cobra.Command{
+	Use:   "export-all",
+	Short: "Export all certificates and their locations for reporting tools.",
+	Long: `Exports every certificate matching --query, or all certificates, as CSV, JSON lines or Parquet for data
+warehouses and BI dashboards. Certificates are requested --page-size at a time and written as each page arrives, so
+the export can cover hundreds of thousands of certificates without holding them in memory.
+
+Fields: ` + strings.Join(certExportFieldNames(), ", ") + `
+Multi-valued fields (sans, locations) are separated by ';'. Locations are written as <client-machine>:<store-path>.
+
+Parquet files have a row group per page and every field as an uncompressed string (UTF8) column.`,
+	Example: `kfutil certificates export-all --fields thumbprint,cn,issuer,notafter,locations --format csv --outpath certs.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		fields, _ := cmd.Flags().GetStringSlice("fields")
+		format, _ := cmd.Flags().GetString("format")
+		outpath, _ := cmd.Flags().GetString("outpath")
+		query, _ := cmd.Flags().GetString("query")
+		collectionID, _ := cmd.Flags().GetInt("collection-id")
+		pageSize, _ := cmd.Flags().GetInt("page-size")
+		includeExpired, _ := cmd.Flags().GetBool("include-expired")
+		includeRevoked, _ := cmd.Flags().GetBool("include-revoked")
+		ctx := commandContext(cmd)
+
+		format = strings.ToLower(format)
+		if format != certExportFormatCSV && format != certExportFormatJSON && format != certExportFormatParquet {
+			fmt.Printf("[ERROR] invalid format '%s', must be one of %s, %s or %s\n", format, certExportFormatCSV,
+				certExportFormatJSON, certExportFormatParquet)
+			log.Fatalf("[ERROR] invalid format: %s", format)
+		}
+		includeLocations := false
+		for i, f := range fields {
+			fields[i] = strings.ToLower(strings.TrimSpace(f))
+			if _, ok := certExportFields[fields[i]]; !ok {
+				fmt.Printf("[ERROR] unknown field '%s', must be one of %s\n", f, strings.Join(certExportFieldNames(), ", "))
+				log.Fatalf("[ERROR] unknown field: %s", f)
+			}
+			if fields[i] == "locations" || fields[i] == "locationcount" {
+				includeLocations = true
+			}
+		}
+		if pageSize <= 0 {
+			pageSize = certExportPageSize
+		}
+		if outpath == "" {
+			outpath = "certificates." + format
+		}
+
+		sdkClient := initGenClient()
+		out, oErr := createOutput(outpath)
+		if oErr != nil {
+			fmt.Printf("[ERROR] creating %s: %s\n", outpath, oErr)
+			log.Fatalf("[ERROR] creating %s: %s", outpath, oErr)
+		}
+		w, wErr := newCertExportWriter(out, format, fields)
+		if wErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, wErr)
+		}
+
+		total := 0
+		for page := int32(1); ctx.Err() == nil; page++ {
+			req := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				IncludeLocations(includeLocations).IncludeMetadata(true).IncludeHasPrivateKey(true).Verbose(1).
+				PqIncludeExpired(includeExpired).PqIncludeRevoked(includeRevoked).
+				PqSortField("Id").PqSortAscending(0).PqPageReturned(page).PqReturnLimit(int32(pageSize))
+			if query != "" {
+				req = req.PqQueryString(query)
+			}
+			if collectionID > 0 {
+				req = req.CollectionId(int32(collectionID))
+			}
+			certs, _, err := req.Execute()
+			if err != nil {
+				if isCancelled(err) {
+					break
+				}
+				w.close()
+				out.Close()
+				fmt.Printf("[ERROR] listing certificates, page %d: %s\n", page, err)
+				log.Fatalf("[ERROR] listing certificates, page %d: %s", page, err)
+			}
+			for i := range certs {
+				if err := w.write(&certs[i]); err != nil {
+					fmt.Printf("[ERROR] writing %s: %s\n", outpath, err)
+					log.Fatalf("[ERROR] writing %s: %s", outpath, err)
+				}
+			}
+			if err := w.flush(); err != nil {
+				fmt.Printf("[ERROR] writing %s: %s\n", outpath, err)
+				log.Fatalf("[ERROR] writing %s: %s", outpath, err)
+			}
+			total += len(certs)
+			log.Printf("[DEBUG] exported page %d, %d certificate(s) so far", page, total)
+			if len(certs) < pageSize {
+				break
+			}
+		}
+		// The Parquet metadata is written after an interruption as well, so the certificates written so far can be read.
+		if cErr := w.close(); cErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, cErr)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, cErr)
+		}
+		if cErr := out.Close(); cErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, cErr)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, cErr)
+		}
+		exitIfInterrupted(ctx, fmt.Sprintf("%d certificate(s) were written to %s before the export stopped", total, outputName(outpath)))
+		printInfo("Exported %d certificate(s) to %s\n", total, outputName(outpath))
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsExportAllCmd)
+	certsExportAllCmd.Flags().StringSlice("fields", []string{"thumbprint", "cn", "issuer", "notafter", "locations"},
+		"Comma separated fields to export, see the command help for the list.")
+	certsExportAllCmd.Flags().String("format", certExportFormatCSV, "Output format, one of csv, json (one JSON object per line) or parquet.")
+	certsExportAllCmd.Flags().String("outpath", "", "Path to write the export to, '-' for stdout. Defaults to certificates.<format>. Accepts s3://, az:// and gs:// URLs.")
+	certsExportAllCmd.Flags().String("query", "", "Keyfactor certificate query to filter the export, e.g. 'IssuerDN -contains \"Internal\"'.")
+	certsExportAllCmd.Flags().Int("collection-id", 0, "Only export certificates of this collection.")
+	certsExportAllCmd.Flags().Int("page-size", certExportPageSize, "Number of certificates to request per page.")
+	certsExportAllCmd.Flags().Bool("include-expired", false, "Include expired certificates.")
+	certsExportAllCmd.Flags().Bool("include-revoked", false, "Include revoked certificates.")
+	certsExportAllCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{
+			certExportFormatCSV + "\tComma separated values with a header row",
+			certExportFormatJSON + "\tOne JSON object per line",
+			certExportFormatParquet + "\tApache Parquet with a string column per field",
+		}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
@@ -0,0 +1,83 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+var certsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List certificates.",
+	Long: `List certificates matching a Keyfactor query, --limit at a time. Use --offset to list the following
+certificates or --all to list every match page by page. The number of certificates listed is printed to stderr.`,
+	Example: `kfutil certs list --query 'IssuedCN -contains "example.com"' --limit 20
+kfutil certs list --collection "Web Servers" --all`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		query, _ := cmd.Flags().GetString("query")
+		collection, _ := cmd.Flags().GetString("collection")
+		includeExpired, _ := cmd.Flags().GetBool("include-expired")
+		includeRevoked, _ := cmd.Flags().GetBool("include-revoked")
+		paging, pErr := listPagingFromFlags(cmd)
+		if pErr != nil {
+			fmt.Printf("[ERROR] %s\n", pErr)
+			log.Fatalf("[ERROR] %s", pErr)
+		}
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		collectionID := ownerCollectionID(ctx, sdkClient, collection)
+
+		var certs []keyfactor.ModelsCertificateRetrievalResponse
+		from, to, more, err := fetchPages(paging, func(page int32, size int32) (int, error) {
+			req := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				PqIncludeExpired(includeExpired).PqIncludeRevoked(includeRevoked).
+				PqSortField("Id").PqSortAscending(0).PqPageReturned(page).PqReturnLimit(size)
+			if query != "" {
+				req = req.PqQueryString(query)
+			}
+			if collectionID > 0 {
+				req = req.CollectionId(int32(collectionID))
+			}
+			certsPage, _, qErr := req.Execute()
+			certs = append(certs, certsPage...)
+			return len(certsPage), qErr
+		})
+		if err != nil {
+			exitIfInterrupted(ctx, "no certificates were listed")
+			fmt.Printf("Error, unable to list certificates. %s\n", err)
+			log.Fatalf("[ERROR] listing certificates: %s", err)
+		}
+		certs = certs[from:to]
+		if certs == nil {
+			certs = []keyfactor.ModelsCertificateRetrievalResponse{}
+		}
+		output, jErr := json.Marshal(certs)
+		if jErr != nil {
+			fmt.Printf("Error invalid API response from Keyfactor. %s\n", jErr)
+			log.Fatalf("[ERROR]: %s", jErr)
+		}
+		fmt.Printf("%s", output)
+		printListCount("certificate(s)", paging, len(certs), more)
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsListCmd)
+	certsListCmd.Flags().String("query", "", "Keyfactor certificate query, e.g. 'IssuedCN -contains \"example.com\"'. Defaults to all certificates.")
+	certsListCmd.Flags().String("collection", "", "Only list certificates of this collection, by name or ID.")
+	certsListCmd.Flags().Bool("include-expired", false, "Also list expired certificates.")
+	certsListCmd.Flags().Bool("include-revoked", false, "Also list revoked certificates.")
+	addListPagingFlags(certsListCmd, "certificates")
+}
@@ -0,0 +1,223 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	sha1ThumbprintLength   = 40
+	sha256ThumbprintLength = 64
+	// maxSerialLength is the length in hex digits of the longest serial number allowed by RFC 5280, 20 octets.
+	maxSerialLength = 40
+)
+
+// normalizeHeader is CertHeader with a serial number column.
+var normalizeHeader = append(append([]string{}, CertHeader...), "SerialNumber")
+
+// normalizeHex strips the separators commonly found in copied thumbprints and serial numbers and upper cases the
+// result. It returns an error if what remains is not hexadecimal.
+func normalizeHex(value string) (string, error) {
+	v := strings.TrimSpace(value)
+	if strings.HasPrefix(strings.ToLower(v), "0x") {
+		v = v[2:]
+	}
+	v = strings.ToUpper(strings.NewReplacer(":", "", " ", "", "-", "", "\u200e", "", "\u200f", "").Replace(v))
+	for _, c := range v {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return v, fmt.Errorf("'%s' is not hexadecimal", value)
+		}
+	}
+	return v, nil
+}
+
+// normalizeThumbprint returns the normalized form of a SHA-1 or SHA-256 thumbprint.
+func normalizeThumbprint(value string) (string, error) {
+	v, err := normalizeHex(value)
+	if err != nil {
+		return v, fmt.Errorf("invalid thumbprint: %s", err)
+	}
+	if len(v) != sha1ThumbprintLength && len(v) != sha256ThumbprintLength {
+		return v, fmt.Errorf("invalid thumbprint '%s': %d hex digits, expected %d (SHA-1) or %d (SHA-256)",
+			value, len(v), sha1ThumbprintLength, sha256ThumbprintLength)
+	}
+	return v, nil
+}
+
+// normalizeSerial returns the normalized form of a certificate serial number.
+func normalizeSerial(value string) (string, error) {
+	v, err := normalizeHex(value)
+	if err != nil {
+		return v, fmt.Errorf("invalid serial number: %s", err)
+	}
+	if len(v) == 0 || len(v) > maxSerialLength {
+		return v, fmt.Errorf("invalid serial number '%s': %d hex digits, expected 1 to %d", value, len(v), maxSerialLength)
+	}
+	return v, nil
+}
+
+// normalizeResult is the outcome of normalizing a certs file.
+type normalizeResult struct {
+	Rows       [][]string
+	HasSerials bool
+	Malformed  []tabularRowError
+	Duplicates []tabularRowError
+}
+
+// normalizeCertsTable validates and normalizes the rows of a certs file. Malformed rows and later duplicates of a
+// thumbprint, serial number or certificate ID are reported and left out of the result.
+func normalizeCertsTable(table *tabularFile) *normalizeResult {
+	result := &normalizeResult{Malformed: append([]tabularRowError{}, table.Errors...)}
+	seen := make(map[string]int)
+	for _, row := range table.Rows {
+		values := row.Values(normalizeHeader)
+		thumbprint, certID, serial := values[0], strings.TrimSpace(values[3]), values[6]
+		if strings.TrimSpace(thumbprint) == "" && certID == "" && strings.TrimSpace(serial) == "" {
+			result.Malformed = append(result.Malformed, tabularRowError{Line: row.Line, Err: fmt.Errorf("missing value for Thumbprint, CertID or SerialNumber")})
+			continue
+		}
+		var err error
+		if strings.TrimSpace(thumbprint) != "" {
+			if values[0], err = normalizeThumbprint(thumbprint); err != nil {
+				result.Malformed = append(result.Malformed, tabularRowError{Line: row.Line, Err: err})
+				continue
+			}
+		}
+		if strings.TrimSpace(serial) != "" {
+			if values[6], err = normalizeSerial(serial); err != nil {
+				result.Malformed = append(result.Malformed, tabularRowError{Line: row.Line, Err: err})
+				continue
+			}
+			result.HasSerials = true
+		}
+		values[3] = certID
+
+		var keys []string
+		switch {
+		case values[0] != "":
+			keys = append(keys, "thumbprint "+values[0])
+		case certID != "":
+			keys = append(keys, "certificate ID "+certID)
+		}
+		if values[6] != "" {
+			keys = append(keys, "serial number "+values[6])
+		}
+		duplicate := false
+		for _, key := range keys {
+			if first, ok := seen[key]; ok {
+				result.Duplicates = append(result.Duplicates, tabularRowError{Line: row.Line, Err: fmt.Errorf("duplicate %s, first seen on line %d", key, first)})
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = row.Line
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result
+}
+
+// normalizedOutputPath returns the default output path of `certs normalize`, e.g. roots_normalized.csv for roots.csv.
+func normalizedOutputPath(input string) string {
+	if input == "-" {
+		return "-"
+	}
+	ext := filepath.Ext(input)
+	if strings.EqualFold(ext, ".xlsx") {
+		ext = ".csv"
+	}
+	return strings.TrimSuffix(input, filepath.Ext(input)) + "_normalized" + ext
+}
+
+var certsNormalizeCmd = &cobra.Command{
+	Use:   "normalize",
+	Short: "Validate and normalize the thumbprints and serial numbers of a certs file.",
+	Long: `Validates and normalizes a certs file, such as the --add-certs and --remove-certs inputs of 'stores rot',
+before it is used. Colons, spaces and dashes are stripped from thumbprints and serial numbers and they are upper cased.
+Thumbprints must be 40 (SHA-1) or 64 (SHA-256) hex digits and serial numbers 1 to 40 hex digits. Malformed rows and
+rows duplicating the thumbprint, serial number or certificate ID of an earlier row are reported and left out of the
+cleaned file. No API calls are made.`,
+	Example: `kfutil certs normalize --file roots.csv --outpath roots_clean.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		inputPath, _ := cmd.Flags().GetString("file")
+		outpath, _ := cmd.Flags().GetString("outpath")
+		strict, _ := cmd.Flags().GetBool("strict")
+		if outpath == "" {
+			outpath = normalizedOutputPath(inputPath)
+		}
+		if outpath == inputPath && inputPath != "-" {
+			fmt.Println("[ERROR] --outpath must not be the input file")
+			log.Fatalf("[ERROR] --outpath is the input file: %s", outpath)
+		}
+
+		table, err := readTabularFile(inputPath, normalizeHeader, nil)
+		if err != nil {
+			fmt.Printf("[ERROR] reading %s: %s\n", inputPath, err)
+			log.Fatalf("[ERROR] reading %s: %s", inputPath, err)
+		}
+		result := normalizeCertsTable(table)
+
+		header := CertHeader
+		if result.HasSerials {
+			header = normalizeHeader
+		}
+		out, oErr := createOutput(outpath)
+		if oErr != nil {
+			fmt.Printf("[ERROR] creating %s: %s\n", outpath, oErr)
+			log.Fatalf("[ERROR] creating %s: %s", outpath, oErr)
+		}
+		w := csv.NewWriter(out)
+		w.Write(header)
+		for _, row := range result.Rows {
+			w.Write(row[:len(header)])
+		}
+		w.Flush()
+		if wErr := w.Error(); wErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, wErr)
+		}
+		if cErr := out.Close(); cErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, cErr)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, cErr)
+		}
+
+		for _, e := range result.Malformed {
+			printWarning("%s malformed %s\n", inputPath, e)
+		}
+		for _, e := range result.Duplicates {
+			printWarning("%s %s\n", inputPath, e)
+		}
+		printInfo("Wrote %d row(s) to %s, dropped %d malformed and %d duplicate row(s).\n",
+			len(result.Rows), outputName(outpath), len(result.Malformed), len(result.Duplicates))
+		if strict && len(result.Malformed)+len(result.Duplicates) > 0 {
+			fmt.Println("[ERROR] the input file has malformed or duplicate rows")
+			log.Fatalf("[ERROR] %d malformed and %d duplicate rows in %s", len(result.Malformed), len(result.Duplicates), inputPath)
+		}
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsNormalizeCmd)
+	certsNormalizeCmd.Flags().StringP("file", "f", "", "Certs file to normalize, in the format of the 'stores rot' --add-certs file, or '-' for stdin.")
+	certsNormalizeCmd.Flags().StringP("outpath", "o", "",
+		"Path to write the cleaned CSV file to, '-' for stdout. Defaults to <file>_normalized.csv.")
+	certsNormalizeCmd.Flags().Bool("strict", false, "Exit with an error if any row is malformed or a duplicate, after writing the cleaned file.")
+	certsNormalizeCmd.MarkFlagRequired("file")
+}
@@ -0,0 +1,336 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultOwnerField   = "Owner"
+	certOwnerPageSize   = 500
+	certOwnerBatchSize  = 100
+	ownerReportNoStores = "(no stores)"
+)
+
+// queryCertificatesWithMetadata returns every certificate matching query with its metadata and locations. An empty
+// query matches all certificates, collectionID 0 queries all collections.
+func queryCertificatesWithMetadata(ctx context.Context, sdkClient *keyfactor.APIClient, query string, collectionID int, includeExpired bool) ([]keyfactor.ModelsCertificateRetrievalResponse, error) {
+	var all []keyfactor.ModelsCertificateRetrievalResponse
+	for page := int32(1); ; page++ {
+		req := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			IncludeLocations(true).IncludeMetadata(true).PqIncludeExpired(includeExpired).
+			PqSortField("Id").PqSortAscending(0).PqPageReturned(page).PqReturnLimit(certOwnerPageSize)
+		if query != "" {
+			req = req.PqQueryString(query)
+		}
+		if collectionID > 0 {
+			req = req.CollectionId(int32(collectionID))
+		}
+		certs, _, err := req.Execute()
+		if err != nil {
+			return nil, fmt.Errorf("querying certificates, page %d: %s", page, err)
+		}
+		all = append(all, certs...)
+		if len(certs) < certOwnerPageSize {
+			return all, nil
+		}
+	}
+}
+
+// certOwner returns the value of the owner metadata field of c, empty if it is not set.
+func certOwner(c *keyfactor.ModelsCertificateRetrievalResponse, field string) string {
+	if c.Metadata == nil {
+		return ""
+	}
+	return strings.TrimSpace((*c.Metadata)[field])
+}
+
+// ownerCoverage is the number of certificates with and without an owner of a group.
+type ownerCoverage struct {
+	Group          string  `json:"group"`
+	Total          int     `json:"total"`
+	WithoutOwner   int     `json:"without_owner"`
+	PercentWithout float64 `json:"percent_without_owner"`
+}
+
+// ownerReport is the ownership coverage of the certificates matching a query.
+type ownerReport struct {
+	Field       string          `json:"field"`
+	Overall     ownerCoverage   `json:"overall"`
+	ByStoreType []ownerCoverage `json:"by_store_type"`
+	ByIssuer    []ownerCoverage `json:"by_issuer"`
+}
+
+// buildOwnerReport counts the certificates without an owner, overall and by store type and issuer. A certificate in
+// stores of several types is counted once for each type, certificates that are in no store are grouped together.
+func buildOwnerReport(certs []keyfactor.ModelsCertificateRetrievalResponse, field string, typeNames map[int]string) ownerReport {
+	overall := ownerCoverage{Group: "all"}
+	byType := make(map[string]*ownerCoverage)
+	byIssuer := make(map[string]*ownerCoverage)
+	count := func(groups map[string]*ownerCoverage, name string, missing bool) {
+		g, ok := groups[name]
+		if !ok {
+			g = &ownerCoverage{Group: name}
+			groups[name] = g
+		}
+		g.Total++
+		if missing {
+			g.WithoutOwner++
+		}
+	}
+	for i := range certs {
+		c := &certs[i]
+		missing := certOwner(c, field) == ""
+		overall.Total++
+		if missing {
+			overall.WithoutOwner++
+		}
+		count(byIssuer, c.GetIssuerDN(), missing)
+
+		types := make(map[string]bool)
+		for _, loc := range c.Locations {
+			id := int(loc.GetStoreType())
+			name, ok := typeNames[id]
+			if !ok {
+				name = strconv.Itoa(id)
+			}
+			types[name] = true
+		}
+		if len(types) == 0 {
+			types[ownerReportNoStores] = true
+		}
+		for name := range types {
+			count(byType, name, missing)
+		}
+	}
+	overall.PercentWithout = coveragePercent(overall)
+	return ownerReport{
+		Field:       field,
+		Overall:     overall,
+		ByStoreType: sortedCoverage(byType),
+		ByIssuer:    sortedCoverage(byIssuer),
+	}
+}
+
+// coveragePercent returns the percentage of the certificates of g without an owner.
+func coveragePercent(g ownerCoverage) float64 {
+	if g.Total == 0 {
+		return 0
+	}
+	return float64(g.WithoutOwner) * 100 / float64(g.Total)
+}
+
+// sortedCoverage returns the groups with the most certificates without an owner first.
+func sortedCoverage(groups map[string]*ownerCoverage) []ownerCoverage {
+	sorted := make([]ownerCoverage, 0, len(groups))
+	for _, g := range groups {
+		g.PercentWithout = coveragePercent(*g)
+		sorted = append(sorted, *g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].WithoutOwner != sorted[j].WithoutOwner {
+			return sorted[i].WithoutOwner > sorted[j].WithoutOwner
+		}
+		return sorted[i].Group < sorted[j].Group
+	})
+	return sorted
+}
+
+// printOwnerCoverage prints the coverage of groups as a table with title as the group column.
+func printOwnerCoverage(title string, groups []ownerCoverage) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCERTIFICATES\tWITHOUT OWNER\t%%\n", title)
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\n", g.Group, g.Total, g.WithoutOwner, g.PercentWithout)
+	}
+	w.Flush()
+}
+
+// ownerCollectionID resolves the --collection flag, 0 if it is not set.
+func ownerCollectionID(ctx context.Context, sdkClient *keyfactor.APIClient, collection string) int {
+	if collection == "" {
+		return 0
+	}
+	id, err := resolveCollectionID(ctx, sdkClient, collection)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	return id
+}
+
+var certsSetOwnerCmd = &cobra.Command{
+	Use:   "set-owner --query <query> --owner <owner>",
+	Short: "Set the owner metadata of the certificates matching a query.",
+	Long: `Sets the owner metadata field of the certificates matching a Keyfactor certificate query. The owner is stored
+in the certificate metadata field given by --field, which must exist in Keyfactor Command. Certificates that already
+have an owner are left as they are unless --overwrite is set. Only the certificates that matched the query when it
+ran are updated. Use --dry-run to only count them.`,
+	Example: `kfutil certs set-owner --query 'IssuerDN -contains "Payments CA"' --owner team-payments --dry-run
+kfutil certs set-owner --query 'CN -endswith ".shop.example.com"' --owner team-shop --overwrite`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		query, _ := cmd.Flags().GetString("query")
+		owner, _ := cmd.Flags().GetString("owner")
+		field, _ := cmd.Flags().GetString("field")
+		collection, _ := cmd.Flags().GetString("collection")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if strings.TrimSpace(query) == "" {
+			fmt.Println("[ERROR] --query is required, setting the owner of all certificates is not supported")
+			log.Fatalf("[ERROR] empty query")
+		}
+		if strings.TrimSpace(owner) == "" || strings.TrimSpace(field) == "" {
+			fmt.Println("[ERROR] --owner and --field must not be empty")
+			log.Fatalf("[ERROR] empty owner or field")
+		}
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		collectionID := ownerCollectionID(ctx, sdkClient, collection)
+		certs, qErr := queryCertificatesWithMetadata(ctx, sdkClient, query, collectionID, true)
+		if qErr != nil {
+			exitIfInterrupted(ctx, "no owner was set")
+			fmt.Printf("[ERROR] %s\n", qErr)
+			log.Fatalf("[ERROR] %s", qErr)
+		}
+
+		var ids []int32
+		unchanged := 0
+		for i := range certs {
+			current := certOwner(&certs[i], field)
+			if current == owner || (current != "" && !overwrite) {
+				unchanged++
+				continue
+			}
+			ids = append(ids, certs[i].GetId())
+		}
+		printInfo("%d certificate(s) match the query, %d to update, %d unchanged.\n", len(certs), len(ids), unchanged)
+		if dryRun || len(ids) == 0 {
+			if dryRun {
+				printInfo("Dry run, no owner was set.\n")
+			}
+			recordResultCount("unchanged", unchanged)
+			return
+		}
+
+		update := keyfactor.NewModelsMetadataSingleUpdateRequest()
+		update.SetMetadataName(field)
+		update.SetValue(owner)
+		update.SetOverwriteExisting(overwrite)
+		updated := 0
+		for start := 0; start < len(ids); start += certOwnerBatchSize {
+			end := start + certOwnerBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			body := keyfactor.NewModelsMetadataAllUpdateRequest([]keyfactor.ModelsMetadataSingleUpdateRequest{*update})
+			body.SetCertificateIds(ids[start:end])
+			req := sdkClient.CertificateApi.CertificateUpdateAllMetadata(ctx).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				MetadataUpdate(*body)
+			if collectionID > 0 {
+				req = req.CollectionId(int32(collectionID))
+			}
+			if _, err := req.Execute(); err != nil {
+				exitIfInterrupted(ctx, fmt.Sprintf("the owner of %d of %d certificate(s) was set", updated, len(ids)))
+				fmt.Printf("[ERROR] setting %s of certificates %d to %d: %s, %d of %d certificate(s) were updated\n", field, ids[start], ids[end-1], err, updated, len(ids))
+				log.Fatalf("[ERROR] setting %s: %s", field, err)
+			}
+			updated += end - start
+			log.Printf("[INFO] set the owner of %d of %d certificate(s)", updated, len(ids))
+		}
+		recordResultCount("updated", updated)
+		recordResultCount("unchanged", unchanged)
+		printAdded("Set %s to '%s' on %d certificate(s).\n", field, owner, updated)
+	},
+}
+
+var certsOwnerReportCmd = &cobra.Command{
+	Use:   "owner-report",
+	Short: "Report the certificates without an owner by store type and issuer.",
+	Long: `Reports the ownership coverage of the certificates matching a query, all certificates by default: the number
+and percentage of certificates without a value in the owner metadata field, overall and broken down by store type and
+issuer. A certificate in stores of several types is counted once for each type.`,
+	Example: `kfutil certs owner-report
+kfutil certs owner-report --query 'IssuerDN -contains "Internal"' --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		query, _ := cmd.Flags().GetString("query")
+		field, _ := cmd.Flags().GetString("field")
+		collection, _ := cmd.Flags().GetString("collection")
+		includeExpired, _ := cmd.Flags().GetBool("include-expired")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		kfClient, _ := initClient()
+		collectionID := ownerCollectionID(ctx, sdkClient, collection)
+		certs, qErr := queryCertificatesWithMetadata(ctx, sdkClient, query, collectionID, includeExpired)
+		if qErr != nil {
+			exitIfInterrupted(ctx, "no report was made")
+			fmt.Printf("[ERROR] %s\n", qErr)
+			log.Fatalf("[ERROR] %s", qErr)
+		}
+		typeNames := make(map[int]string)
+		types, tErr := kfClient.ListCertificateStoreTypes()
+		if tErr != nil {
+			printWarning("Listing certificate store types failed, store types are shown by ID: %s\n", tErr)
+		} else {
+			for _, st := range *types {
+				typeNames[st.StoreType] = st.ShortName
+			}
+		}
+
+		report := buildOwnerReport(certs, field, typeNames)
+		recordResultCount("certificates", report.Overall.Total)
+		recordResultCount("without_owner", report.Overall.WithoutOwner)
+		if jsonOut {
+			output, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(output))
+			return
+		}
+		fmt.Printf("%d of %d certificate(s) have no %s (%.1f%%).\n\n", report.Overall.WithoutOwner, report.Overall.Total,
+			field, report.Overall.PercentWithout)
+		printOwnerCoverage("STORE TYPE", report.ByStoreType)
+		fmt.Println()
+		printOwnerCoverage("ISSUER", report.ByIssuer)
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsSetOwnerCmd)
+	certsSetOwnerCmd.Flags().String("query", "", "Keyfactor certificate query selecting the certificates, e.g. 'IssuerDN -contains \"Payments CA\"'.")
+	certsSetOwnerCmd.Flags().String("owner", "", "Owner to set, e.g. a team name.")
+	certsSetOwnerCmd.Flags().String("field", defaultOwnerField, "Certificate metadata field holding the owner.")
+	certsSetOwnerCmd.Flags().String("collection", "", "Name or ID of a collection to limit the query to.")
+	certsSetOwnerCmd.Flags().Bool("overwrite", false, "Replace the owner of certificates that already have one.")
+	certsSetOwnerCmd.Flags().Bool("dry-run", false, "Only count the certificates that would be updated.")
+	certsSetOwnerCmd.MarkFlagRequired("query")
+	certsSetOwnerCmd.MarkFlagRequired("owner")
+
+	certificatesCmd.AddCommand(certsOwnerReportCmd)
+	certsOwnerReportCmd.Flags().String("query", "", "Keyfactor certificate query to limit the report to, all certificates by default.")
+	certsOwnerReportCmd.Flags().String("field", defaultOwnerField, "Certificate metadata field holding the owner.")
+	certsOwnerReportCmd.Flags().String("collection", "", "Name or ID of a collection to limit the report to.")
+	certsOwnerReportCmd.Flags().Bool("include-expired", false, "Include expired certificates.")
+	certsOwnerReportCmd.Flags().Bool("json", false, "Print the report as JSON.")
+}
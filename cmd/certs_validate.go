@@ -0,0 +1,373 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+	"go.mozilla.org/pkcs7"
+)
+
+// chainExtKeyUsages maps the --eku values to extended key usages.
+var chainExtKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// chainLink is a certificate of a validated chain and the problems found with it. Position 0 is the certificate being
+// validated.
+type chainLink struct {
+	Position   int      `json:"position"`
+	Subject    string   `json:"subject"`
+	Issuer     string   `json:"issuer"`
+	Thumbprint string   `json:"thumbprint"`
+	NotAfter   string   `json:"not_after"`
+	Anchor     bool     `json:"trust_anchor"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+// chainValidation is the result of validating a certificate chain against a set of trust anchors.
+type chainValidation struct {
+	Valid bool         `json:"valid"`
+	Links []*chainLink `json:"links"`
+	// Error explains why the chain does not end in a trust anchor, if it doesn't.
+	Error string `json:"error,omitempty"`
+}
+
+// downloadCertChain downloads a certificate by ID or thumbprint, with its chain if includeChain is set. The certificate
+// is the first of the returned certificates.
+func downloadCertChain(ctx context.Context, sdkClient *keyfactor.APIClient, certID int32, thumbprint string, includeChain bool) ([]*x509.Certificate, error) {
+	rq := keyfactor.ModelsCertificateDownloadRequest{IncludeChain: &includeChain}
+	if certID != 0 {
+		rq.CertID = &certID
+	} else {
+		rq.Thumbprint = &thumbprint
+	}
+	resp, _, err := sdkClient.CertificateApi.CertificateDownloadCertificateAsync(ctx).Rq(rq).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).Execute()
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseDownloadedCerts(resp.GetContent())
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("the download contains no certificates")
+	}
+	// PKCS#7 does not order its certificates, put the requested one, the one that issued none of the others, first.
+	for i, c := range certs {
+		if (thumbprint != "" && strings.EqualFold(certThumbprint(c), thumbprint)) || (thumbprint == "" && !issuesAny(c, certs)) {
+			certs[0], certs[i] = certs[i], certs[0]
+			break
+		}
+	}
+	return certs, nil
+}
+
+// issuesAny reports whether c is the issuer of any other certificate of certs.
+func issuesAny(c *x509.Certificate, certs []*x509.Certificate) bool {
+	for _, other := range certs {
+		if !other.Equal(c) && bytes.Equal(other.RawIssuer, c.RawSubject) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDownloadedCerts parses the base64 content of a certificate download, a PKCS#7 bundle, PEM or DER.
+func parseDownloadedCerts(content string) ([]*x509.Certificate, error) {
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("decoding certificate download: %s", err)
+	}
+	if p7, pErr := pkcs7.Parse(data); pErr == nil {
+		return p7.Certificates, nil
+	}
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		return parsePEMCerts(data)
+	}
+	return x509.ParseCertificates(data)
+}
+
+// parsePEMCerts returns the certificates of a PEM bundle.
+func parsePEMCerts(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// storeTrustAnchors downloads the certificates in the inventory of a certificate store.
+func storeTrustAnchors(ctx context.Context, sdkClient *keyfactor.APIClient, storeID string) ([]*x509.Certificate, error) {
+	kfClient, _ := initClient()
+	inventory, err := kfClient.GetCertStoreInventory(storeID)
+	if err != nil {
+		return nil, fmt.Errorf("getting inventory of store %s: %s", storeID, err)
+	}
+	var anchors []*x509.Certificate
+	for _, inv := range *inventory {
+		for _, c := range inv.Certificates {
+			certs, dErr := downloadCertChain(ctx, sdkClient, int32(c.Id), c.Thumbprint, false)
+			if dErr != nil {
+				printWarning("Unable to download certificate %s of store %s, it is not used as a trust anchor: %s\n", c.Thumbprint, storeID, dErr)
+				continue
+			}
+			anchors = append(anchors, certs[0])
+		}
+	}
+	return anchors, nil
+}
+
+// validateCertChain builds the chain of leaf from intermediates to a certificate of anchors and checks every link:
+// validity period at now, the issuer's signature, that issuers are CAs allowed to sign certificates at that path length,
+// and that every certificate allows eku.
+func validateCertChain(leaf *x509.Certificate, intermediates []*x509.Certificate, anchors []*x509.Certificate, eku x509.ExtKeyUsage, now time.Time) *chainValidation {
+	result := &chainValidation{}
+	isAnchor := func(c *x509.Certificate) bool {
+		for _, a := range anchors {
+			if a.Equal(c) {
+				return true
+			}
+		}
+		return false
+	}
+	findIssuer := func(c *x509.Certificate, pool []*x509.Certificate) *x509.Certificate {
+		for _, candidate := range pool {
+			if !candidate.Equal(c) && bytes.Equal(candidate.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(candidate) == nil {
+				return candidate
+			}
+		}
+		// Fall back to a name match so the signature failure is reported on the link.
+		for _, candidate := range pool {
+			if bytes.Equal(candidate.RawSubject, c.RawIssuer) && !candidate.Equal(c) {
+				return candidate
+			}
+		}
+		return nil
+	}
+
+	current := leaf
+	for position := 0; position < 16; position++ {
+		link := &chainLink{
+			Position:   position,
+			Subject:    current.Subject.String(),
+			Issuer:     current.Issuer.String(),
+			Thumbprint: certThumbprint(current),
+			NotAfter:   current.NotAfter.UTC().Format(time.RFC3339),
+			Anchor:     isAnchor(current),
+		}
+		result.Links = append(result.Links, link)
+		if now.Before(current.NotBefore) {
+			link.Problems = append(link.Problems, fmt.Sprintf("not valid before %s", current.NotBefore.UTC().Format(time.RFC3339)))
+		}
+		if now.After(current.NotAfter) {
+			link.Problems = append(link.Problems, fmt.Sprintf("expired on %s", current.NotAfter.UTC().Format(time.RFC3339)))
+		}
+		if eku != x509.ExtKeyUsageAny && len(current.ExtKeyUsage) > 0 && !hasExtKeyUsage(current, eku) {
+			link.Problems = append(link.Problems, fmt.Sprintf("extended key usage does not allow %s", extKeyUsageName(eku)))
+		}
+		if position > 0 {
+			if !current.BasicConstraintsValid || !current.IsCA {
+				link.Problems = append(link.Problems, "not a CA (basic constraints)")
+			} else if current.MaxPathLen >= 0 && (current.MaxPathLen > 0 || current.MaxPathLenZero) && position-1 > current.MaxPathLen {
+				link.Problems = append(link.Problems, fmt.Sprintf("path length constraint %d exceeded", current.MaxPathLen))
+			}
+			if current.KeyUsage != 0 && current.KeyUsage&x509.KeyUsageCertSign == 0 {
+				link.Problems = append(link.Problems, "key usage does not allow signing certificates")
+			}
+		}
+		if link.Anchor {
+			break
+		}
+		issuer := findIssuer(current, append(append([]*x509.Certificate{}, anchors...), intermediates...))
+		if issuer == nil {
+			if bytes.Equal(current.RawSubject, current.RawIssuer) {
+				result.Error = fmt.Sprintf("chain ends in root %s, which is not a trust anchor", current.Subject)
+			} else {
+				result.Error = fmt.Sprintf("issuer %s of link %d not found in the chain or the trust anchors", current.Issuer, position)
+			}
+			break
+		}
+		if sErr := current.CheckSignatureFrom(issuer); sErr != nil {
+			link.Problems = append(link.Problems, fmt.Sprintf("signature does not verify with issuer's key: %s", sErr))
+		}
+		current = issuer
+	}
+	last := result.Links[len(result.Links)-1]
+	if result.Error == "" && !last.Anchor {
+		result.Error = "chain is too long"
+	}
+	result.Valid = result.Error == ""
+	for _, link := range result.Links {
+		if len(link.Problems) > 0 {
+			result.Valid = false
+		}
+	}
+	return result
+}
+
+func hasExtKeyUsage(c *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	for _, u := range c.ExtKeyUsage {
+		if u == eku || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+func extKeyUsageName(eku x509.ExtKeyUsage) string {
+	for name, u := range chainExtKeyUsages {
+		if u == eku {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", eku)
+}
+
+func printChainValidation(v *chainValidation) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSUBJECT\tTHUMBPRINT\tNOT AFTER\tRESULT")
+	for _, link := range v.Links {
+		result := "ok"
+		if len(link.Problems) > 0 {
+			result = strings.Join(link.Problems, "; ")
+		}
+		if link.Anchor {
+			result += " (trust anchor)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", link.Position, link.Subject, link.Thumbprint, link.NotAfter, result)
+	}
+	w.Flush()
+	fmt.Println()
+	switch {
+	case v.Error != "":
+		printWarning("Chain is not valid: %s\n", v.Error)
+	case !v.Valid:
+		printWarning("Chain is not valid, see the links above.\n")
+	default:
+		printInfo("Chain is valid.\n")
+	}
+}
+
+var certsValidateCmd = &cobra.Command{
+	Use:   "validate --thumbprint <thumbprint> (--against-store <store id> | --against-bundle <file>)",
+	Short: "Download a certificate and its chain and validate it against a set of trust anchors.",
+	Long: `Downloads a certificate and its chain from Keyfactor and validates the chain against the certificates of a
+certificate store, or of a PEM bundle, as trust anchors. Every link is checked for its validity period, its issuer's
+signature, CA basic constraints and key usage, and the extended key usage given with --eku, and the failing links are
+reported. --against-bundle also accepts system and mozilla for the OS and Mozilla trust bundles.
+
+Exits with a non-zero status if the chain is not valid.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		thumbprint, _ := cmd.Flags().GetString("thumbprint")
+		certID, _ := cmd.Flags().GetInt32("id")
+		storeID, _ := cmd.Flags().GetString("against-store")
+		bundle, _ := cmd.Flags().GetString("against-bundle")
+		ekuName, _ := cmd.Flags().GetString("eku")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		if thumbprint == "" && certID == 0 {
+			fmt.Println("[ERROR] --thumbprint or --id is required")
+			log.Fatalf("[ERROR] no certificate given")
+		}
+		if (storeID == "") == (bundle == "") {
+			fmt.Println("[ERROR] exactly one of --against-store or --against-bundle is required")
+			log.Fatalf("[ERROR] no trust anchors given")
+		}
+		eku, ok := chainExtKeyUsages[ekuName]
+		if !ok {
+			fmt.Printf("[ERROR] invalid --eku '%s'\n", ekuName)
+			log.Fatalf("[ERROR] invalid --eku: %s", ekuName)
+		}
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		certs, err := downloadCertChain(ctx, sdkClient, certID, thumbprint, true)
+		if err != nil {
+			fmt.Printf("[ERROR] downloading certificate: %s\n", err)
+			log.Fatalf("[ERROR] downloading certificate: %s", err)
+		}
+
+		var anchors []*x509.Certificate
+		if storeID != "" {
+			anchors, err = storeTrustAnchors(ctx, sdkClient, storeID)
+		} else {
+			var data []byte
+			if bundle == importBundleSourceSystem || bundle == importBundleSourceMozilla {
+				data, err = readTrustBundle(bundle)
+			} else {
+				data, err = readInput(bundle)
+			}
+			if err == nil {
+				anchors, err = parsePEMCerts(data)
+			}
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] reading trust anchors: %s\n", err)
+			log.Fatalf("[ERROR] reading trust anchors: %s", err)
+		}
+		if len(anchors) == 0 {
+			fmt.Println("[ERROR] no trust anchors found")
+			log.Fatalf("[ERROR] no trust anchors found")
+		}
+		log.Printf("[DEBUG] validating %s against %d trust anchor(s)", certThumbprint(certs[0]), len(anchors))
+
+		validation := validateCertChain(certs[0], certs[1:], anchors, eku, time.Now())
+		if jsonOut {
+			out, _ := json.MarshalIndent(validation, "", "  ")
+			fmt.Println(string(out))
+		} else {
+			printChainValidation(validation)
+		}
+		if !validation.Valid {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	certificatesCmd.AddCommand(certsValidateCmd)
+	certsValidateCmd.Flags().String("thumbprint", "", "Thumbprint of the certificate to validate.")
+	certsValidateCmd.Flags().Int32("id", 0, "Keyfactor ID of the certificate to validate, instead of --thumbprint.")
+	certsValidateCmd.Flags().String("against-store", "", "ID of a certificate store whose certificates are the trust anchors.")
+	certsValidateCmd.Flags().String("against-bundle", "", "PEM bundle of trust anchors, or system or mozilla.")
+	certsValidateCmd.Flags().String("eku", "any", "Extended key usage every certificate of the chain must allow, e.g. serverAuth or clientAuth.")
+	certsValidateCmd.Flags().Bool("json", false, "Print the validation as JSON.")
+	certsValidateCmd.MarkFlagsMutuallyExclusive("against-store", "against-bundle")
+}
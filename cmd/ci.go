@@ -0,0 +1,145 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const ciGitHub = "github"
+
+// ciMode is the --ci flag. It is validated when the flag is parsed.
+type ciMode string
+
+func (m *ciMode) String() string { return string(*m) }
+
+func (m *ciMode) Set(value string) error {
+	switch value {
+	case "", ciGitHub:
+		*m = ciMode(value)
+		return nil
+	}
+	return fmt.Errorf("must be %s", ciGitHub)
+}
+
+func (m *ciMode) Type() string { return "string" }
+
+// rotCIMode is the --ci flag of the rot audit and reconcile commands.
+var rotCIMode ciMode
+
+func addCIFlag(cmd *cobra.Command) {
+	cmd.Flags().Var(&rotCIMode, "ci",
+		"Emit output for a CI system. github writes GitHub Actions annotations for drift, lookup failures and failed actions, and "+
+			"a Markdown job summary.")
+}
+
+// ciEscapeData escapes the message of a GitHub Actions workflow command.
+func ciEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// ciEscapeProperty escapes a property value of a GitHub Actions workflow command.
+func ciEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// ciAnnotate prints a GitHub Actions annotation of level error, warning or notice. file is the input the annotation
+// is about, shown on the pull request if it is part of it.
+func ciAnnotate(level string, file string, title string, message string) {
+	if rotCIMode != ciGitHub {
+		return
+	}
+	var props []string
+	if file != "" {
+		props = append(props, "file="+ciEscapeProperty(file))
+	}
+	if title != "" {
+		props = append(props, "title="+ciEscapeProperty(title))
+	}
+	cmdLine := "::" + level
+	if len(props) > 0 {
+		cmdLine += " " + strings.Join(props, ",")
+	}
+	fmt.Printf("%s::%s\n", cmdLine, ciEscapeData(message))
+}
+
+// ciSourceFile returns the input the rot annotations of cmd refer to: the manifest, or the add certs file.
+func ciSourceFile(cmd *cobra.Command) string {
+	for _, flag := range []string{"manifest", "add-certs"} {
+		if f := cmd.Flags().Lookup(flag); f != nil && f.Value.String() != "" && f.Value.String() != stdioPath {
+			return f.Value.String()
+		}
+	}
+	return ""
+}
+
+// sortedROTActions returns the add and remove actions sorted by store and thumbprint.
+func sortedROTActions(actions map[string][]ROTAction) []ROTAction {
+	var list []ROTAction
+	for _, certActions := range actions {
+		for _, a := range certActions {
+			if a.AddCert || a.RemoveCert {
+				list = append(list, a)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].StoreID != list[j].StoreID {
+			return list[i].StoreID < list[j].StoreID
+		}
+		return list[i].Thumbprint < list[j].Thumbprint
+	})
+	return list
+}
+
+// reportCIRun emits the CI output of a rot audit or reconcile run: annotations for the drift found by an audit, lookup
+// failures and failed actions, and the job summary.
+func reportCIRun(cmd *cobra.Command, s rotRunSummary, actions map[string][]ROTAction, failures []rotActionFailure) {
+	if rotCIMode != ciGitHub {
+		return
+	}
+	source := ciSourceFile(cmd)
+	list := sortedROTActions(actions)
+	if s.Command == "audit" {
+		for _, a := range list {
+			if a.AddCert {
+				ciAnnotate("warning", source, "Root of trust drift", fmt.Sprintf("Certificate %s is missing from store %s (%s)", a.Thumbprint, a.StoreID, a.StorePath))
+			} else {
+				ciAnnotate("warning", source, "Root of trust drift", fmt.Sprintf("Certificate %s must be removed from store %s (%s)", a.Thumbprint, a.StoreID, a.StorePath))
+			}
+		}
+	}
+	for _, storeID := range s.LookupFailures {
+		ciAnnotate("error", source, "Store lookup failed", fmt.Sprintf("Store %s could not be looked up", storeID))
+	}
+	for _, f := range failures {
+		ciAnnotate("error", "", "Reconcile failed", f.String())
+	}
+
+	summaryPath := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryPath == "" {
+		log.Printf("[DEBUG] GITHUB_STEP_SUMMARY is not set, not writing a job summary")
+		return
+	}
+	f, err := os.OpenFile(summaryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.WriteString(rotMarkdownSummary(s, list, failures))
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}
+	if err != nil {
+		printWarning("Unable to write the job summary to %s: %s\n", summaryPath, err)
+		log.Printf("[ERROR] writing job summary: %s", err)
+	}
+}
@@ -0,0 +1,282 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Output paths starting with one of these schemes are uploaded to cloud storage instead of written to disk:
+//
+//	s3://<bucket>/<key>        AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, optional AWS_SESSION_TOKEN, AWS_REGION and
+//	                           AWS_ENDPOINT_URL for S3 compatible stores
+//	az://<container>/<blob>    AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_SAS_TOKEN
+//	gs://<bucket>/<object>     GOOGLE_OAUTH_ACCESS_TOKEN or CLOUDSDK_AUTH_ACCESS_TOKEN, e.g. from `gcloud auth print-access-token`
+const (
+	cloudSchemeS3    = "s3"
+	cloudSchemeAzure = "az"
+	cloudSchemeGCS   = "gs"
+
+	cloudUploadTimeout = 60 * time.Second
+)
+
+// isCloudURL returns true if path is an s3://, az:// or gs:// URL.
+func isCloudURL(path string) bool {
+	for _, scheme := range []string{cloudSchemeS3, cloudSchemeAzure, cloudSchemeGCS} {
+		if strings.HasPrefix(strings.ToLower(path), scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// joinOutputPath joins elem to a directory that is either a local path or a cloud URL.
+func joinOutputPath(dir string, elem ...string) string {
+	if isCloudURL(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + path.Join(elem...)
+	}
+	return path.Join(append([]string{dir}, elem...)...)
+}
+
+// cloudWriter buffers an output and uploads it when closed.
+type cloudWriter struct {
+	url    string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *cloudWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *cloudWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return uploadToCloud(w.url, w.buf.Bytes())
+}
+
+// writeOutputFile writes data to a local file or uploads it to a cloud URL.
+func writeOutputFile(path string, data []byte, perm os.FileMode) error {
+	recordResultArtifact(path)
+	if isCloudURL(path) {
+		return uploadToCloud(path, data)
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// cloudContentType returns the content type of an output from its extension.
+func cloudContentType(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".csv":
+		return "text/csv"
+	case ".json":
+		return "application/json"
+	case ".xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ".pem", ".crt":
+		return "application/x-pem-file"
+	}
+	return "application/octet-stream"
+}
+
+// uploadToCloud uploads data to an s3://, az:// or gs:// URL.
+func uploadToCloud(rawURL string, data []byte) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid output URL '%s': %s", rawURL, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return fmt.Errorf("invalid output URL '%s', expected %s://<bucket>/<key>", rawURL, u.Scheme)
+	}
+	var req *http.Request
+	switch strings.ToLower(u.Scheme) {
+	case cloudSchemeS3:
+		req, err = newS3PutRequest(u.Host, key, data, time.Now().UTC())
+	case cloudSchemeAzure:
+		req, err = newAzureBlobPutRequest(u.Host, key, data)
+	case cloudSchemeGCS:
+		req, err = newGCSUploadRequest(u.Host, key, data)
+	default:
+		err = fmt.Errorf("unsupported output URL scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] uploading %d bytes to %s", len(data), rawURL)
+	client := &http.Client{Timeout: cloudUploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading to %s: %s", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("uploading to %s: %s: %s", rawURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	log.Printf("[INFO] uploaded %s", rawURL)
+	return nil
+}
+
+// awsURIEncode encodes s as required by AWS Signature Version 4, keeping '/' if encodeSlash is false.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newS3PutRequest builds a PutObject request signed with AWS Signature Version 4.
+func newS3PutRequest(bucket string, key string, data []byte, now time.Time) (*http.Request, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to upload to s3://")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// Virtual hosted style for AWS, path style for S3 compatible endpoints such as MinIO.
+	endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	uri := "/" + awsURIEncode(key, false)
+	if custom := os.Getenv("AWS_ENDPOINT_URL"); custom != "" {
+		endpoint = strings.TrimSuffix(custom, "/")
+		uri = "/" + awsURIEncode(bucket, true) + uri
+	}
+	req, err := http.NewRequest(http.MethodPut, endpoint+uri, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// Send the path exactly as signed.
+	req.URL.RawPath = uri
+
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(data)
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		headers["x-amz-security-token"] = token
+	}
+	canonicalRequest, signedHeaders := awsCanonicalRequest(http.MethodPut, uri, "", headers, payloadHash)
+	scope, signature := awsSignature(secretKey, amzDate, region, "s3", canonicalRequest)
+
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", cloudContentType(key))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+	return req, nil
+}
+
+// awsCanonicalRequest returns the Signature Version 4 canonical request of a request with the given lowercase headers,
+// and its signed headers. uri and query must already be encoded.
+func awsCanonicalRequest(method string, uri string, query string, headers map[string]string, payloadHash string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	return strings.Join([]string{method, uri, query, canonicalHeaders.String(), signedHeaders, payloadHash}, "\n"), signedHeaders
+}
+
+// awsSignature signs canonicalRequest with Signature Version 4 and returns the credential scope and the signature.
+func awsSignature(secretKey string, amzDate string, region string, service string, canonicalRequest string) (string, string) {
+	date := amzDate[:8]
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+secretKey), date), region), service), "aws4_request")
+	return scope, hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+// newAzureBlobPutRequest builds a Put Blob request authorized with a SAS token.
+func newAzureBlobPutRequest(container string, blob string, data []byte) (*http.Request, error) {
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if account == "" || sas == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_SAS_TOKEN are required to upload to az://")
+	}
+	target := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s?%s", account, url.PathEscape(container),
+		awsURIEncode(blob, false), sas)
+	req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", "2021-08-06")
+	req.Header.Set("Content-Type", cloudContentType(blob))
+	return req, nil
+}
+
+// newGCSUploadRequest builds a simple media upload request authorized with an OAuth access token.
+func newGCSUploadRequest(bucket string, object string, data []byte) (*http.Request, error) {
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		token = os.Getenv("CLOUDSDK_AUTH_ACCESS_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN or CLOUDSDK_AUTH_ACCESS_TOKEN is required to upload to gs://")
+	}
+	target := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		url.PathEscape(bucket), url.QueryEscape(object))
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", cloudContentType(object))
+	return req, nil
+}
@@ -0,0 +1,165 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const completionProfileMarker = "# kfutil shell completion"
+
+// detectShell returns the shell of the current user based on $SHELL, falling back to powershell on Windows.
+func detectShell() string {
+	if shell := filepath.Base(os.Getenv("SHELL")); shell != "." && shell != "" {
+		return strings.TrimSuffix(shell, ".exe")
+	}
+	if runtime.GOOS == "windows" || os.Getenv("PSModulePath") != "" {
+		return "powershell"
+	}
+	return ""
+}
+
+// completionScript generates the completion script for shell.
+func completionScript(shell string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch shell {
+	case "bash":
+		err = RootCmd.GenBashCompletionV2(&buf, true)
+	case "zsh":
+		err = RootCmd.GenZshCompletion(&buf)
+	case "fish":
+		err = RootCmd.GenFishCompletion(&buf, true)
+	case "powershell", "pwsh":
+		err = RootCmd.GenPowerShellCompletionWithDesc(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported shell '%s', must be one of bash, zsh, fish or powershell", shell)
+	}
+	return buf.Bytes(), err
+}
+
+// completionPaths returns the path the completion script is written to and the shell profile that loads it. Fish
+// loads completions from its completions directory, so no profile is returned.
+func completionPaths(shell string, home string) (string, string) {
+	switch shell {
+	case "bash":
+		return filepath.Join(home, ".keyfactor", "completion.bash"), filepath.Join(home, ".bashrc")
+	case "zsh":
+		return filepath.Join(home, ".keyfactor", "completion.zsh"), filepath.Join(home, ".zshrc")
+	case "fish":
+		return filepath.Join(home, ".config", "fish", "completions", "kfutil.fish"), ""
+	default:
+		profile := filepath.Join(home, ".config", "powershell", "Microsoft.PowerShell_profile.ps1")
+		if runtime.GOOS == "windows" {
+			profile = filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1")
+		}
+		return filepath.Join(home, ".keyfactor", "completion.ps1"), profile
+	}
+}
+
+// addProfileSource appends a line sourcing script to profile unless the profile already loads kfutil completion.
+func addProfileSource(shell string, profile string, script string) (bool, error) {
+	existing, err := os.ReadFile(profile)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if bytes.Contains(existing, []byte(completionProfileMarker)) {
+		return false, nil
+	}
+	line := fmt.Sprintf("[ -f \"%s\" ] && source \"%s\"", script, script)
+	if shell == "powershell" || shell == "pwsh" {
+		line = fmt.Sprintf("if (Test-Path \"%s\") { . \"%s\" }", script, script)
+	}
+	if mErr := os.MkdirAll(filepath.Dir(profile), 0755); mErr != nil {
+		return false, mErr
+	}
+	f, err := os.OpenFile(profile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "\n%s\n%s\n", completionProfileMarker, line)
+	return err == nil, err
+}
+
+var completionInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the autocompletion script into the user's shell profile.",
+	Long: `Detects the current shell (bash, zsh, fish or powershell) from $SHELL, or uses --shell, writes the completion
+script and configures the shell profile to load it. Re-running the command updates the script and leaves the profile
+unchanged. Start a new shell for the completion to take effect.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		shell, _ := cmd.Flags().GetString("shell")
+		if shell == "" {
+			shell = detectShell()
+		}
+		if shell == "" {
+			fmt.Println("Unable to detect the current shell, use --shell to specify one of bash, zsh, fish or powershell.")
+			log.Fatalf("[ERROR] unable to detect shell")
+		}
+		script, sErr := completionScript(shell)
+		if sErr != nil {
+			fmt.Printf("Error generating completion script: %s\n", sErr)
+			log.Fatalf("[ERROR] generating completion script: %s", sErr)
+		}
+		userHomeDir, hErr := os.UserHomeDir()
+		if hErr != nil {
+			fmt.Printf("Error getting user home directory: %s\n", hErr)
+			log.Fatalf("[ERROR] getting user home directory: %s", hErr)
+		}
+		scriptPath, profile := completionPaths(shell, userHomeDir)
+		if mErr := os.MkdirAll(filepath.Dir(scriptPath), 0755); mErr != nil {
+			fmt.Printf("Error creating directory for %s: %s\n", scriptPath, mErr)
+			log.Fatalf("[ERROR] creating completion directory: %s", mErr)
+		}
+		if wErr := os.WriteFile(scriptPath, script, 0644); wErr != nil {
+			fmt.Printf("Error writing completion script %s: %s\n", scriptPath, wErr)
+			log.Fatalf("[ERROR] writing completion script: %s", wErr)
+		}
+		fmt.Printf("Installed %s completion script to %s\n", shell, scriptPath)
+		if profile == "" {
+			return
+		}
+		added, pErr := addProfileSource(shell, profile, scriptPath)
+		if pErr != nil {
+			fmt.Printf("Error updating shell profile %s: %s\n", profile, pErr)
+			log.Fatalf("[ERROR] updating shell profile: %s", pErr)
+		}
+		if added {
+			fmt.Printf("Added completion to %s, start a new shell to use it.\n", profile)
+		} else {
+			fmt.Printf("%s already loads kfutil completion.\n", profile)
+		}
+	},
+}
+
+// addCompletionInstallCmd adds the install command to cobra's default completion command.
+func addCompletionInstallCmd() {
+	RootCmd.InitDefaultCompletionCmd()
+	for _, c := range RootCmd.Commands() {
+		if c.Name() == "completion" {
+			c.AddCommand(completionInstallCmd)
+			return
+		}
+	}
+}
+
+func init() {
+	var shell string
+	completionInstallCmd.Flags().StringVar(&shell, "shell", "", "Shell to install completion for, one of bash, zsh, fish or powershell. Detected from $SHELL if not set.")
+}
@@ -0,0 +1,239 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ConfigSchemaVersion is the current version of the config file schema. Config files without a `config_version` are
+// treated as version 1.
+const ConfigSchemaVersion = 1
+
+type configField struct {
+	Description string
+	Validate    func(value string) error
+}
+
+func validateOneOf(options ...string) func(string) error {
+	return func(value string) error {
+		for _, o := range options {
+			if value == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+	}
+}
+
+func validateBoolString(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("must be true or false")
+	}
+	return nil
+}
+
+func validatePositiveInt(value string) error {
+	if i, err := strconv.Atoi(value); err != nil || i < 1 {
+		return fmt.Errorf("must be a positive integer")
+	}
+	return nil
+}
+
+// configSchema defines every key allowed in the kfutil config file.
+var configSchema = map[string]configField{
+	"config_version": {"Version of the config file schema.", func(value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 {
+			return fmt.Errorf("must be a positive integer")
+		}
+		if v > ConfigSchemaVersion {
+			return fmt.Errorf("version %d is newer than the supported version %d, upgrade kfutil", v, ConfigSchemaVersion)
+		}
+		return nil
+	}},
+	"host": {"Keyfactor Command hostname or URL.", func(value string) error {
+		if value == "" {
+			return fmt.Errorf("must not be empty")
+		}
+		if strings.Contains(value, "://") {
+			if _, err := url.Parse(value); err != nil {
+				return fmt.Errorf("invalid URL: %s", err)
+			}
+		}
+		return nil
+	}},
+	"username":        {"Keyfactor Command username.", nil},
+	"password":        {"Keyfactor Command password.", nil},
+	"domain":          {"Active Directory domain of the user.", nil},
+	"api_path":        {"Path of the Keyfactor API, defaults to KeyfactorAPI.", nil},
+	"auth_method":     {"Authentication method.", validateOneOf("basic")},
+	"tls_ca_bundle":   {"Path to a PEM bundle of CAs trusted for the Keyfactor API.", validateFileExists},
+	"tls_skip_verify": {"Skip TLS certificate verification of the Keyfactor API.", validateBoolString},
+	"output_format":   {"Default output format.", validateOneOf("json", "csv", "table")},
+	"read_only":       {"Never write to Keyfactor, same as --read-only. Can not be overridden from the command line.", validateBoolString},
+	"concurrency":     {"Default number of concurrent API operations for bulk commands.", validatePositiveInt},
+	"notify_url": {"Webhook URL rot commands post run summaries to.", func(value string) error {
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("must be an absolute URL")
+		}
+		return nil
+	}},
+	"notify_format": {"Payload format of notify_url.", validateOneOf(notifyFormatAuto, notifyFormatWebhook, notifyFormatSlack, notifyFormatTeams)},
+	configFlagsKey:  {"Flag values by flag name, e.g. {\"concurrency\": \"8\"}. Environment variables and the command line take precedence.", nil},
+}
+
+// validateConfigFlags validates the flags section of the config file, an object of flag names to flag values.
+func validateConfigFlags(value interface{}) []error {
+	flags, ok := value.(map[string]interface{})
+	if !ok {
+		return []error{fmt.Errorf("key '%s' must be an object of flag names to values", configFlagsKey)}
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		switch flags[name].(type) {
+		case string, bool, float64:
+		default:
+			errs = append(errs, fmt.Errorf("key '%s.%s' must be a string, boolean or number", configFlagsKey, name))
+		}
+	}
+	return errs
+}
+
+func validateFileExists(value string) error {
+	if _, err := os.Stat(value); err != nil {
+		return fmt.Errorf("file not found: %s", value)
+	}
+	return nil
+}
+
+// validateConfigData validates raw config file contents against the config schema and returns every problem found.
+func validateConfigData(data []byte) []error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return []error{fmt.Errorf("invalid JSON: %s", err)}
+	}
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		field, known := configSchema[key]
+		if !known {
+			errs = append(errs, fmt.Errorf("unknown key '%s'", key))
+			continue
+		}
+		if key == configFlagsKey {
+			errs = append(errs, validateConfigFlags(raw[key])...)
+			continue
+		}
+		if _, isBool := raw[key].(bool); isBool && key == "read_only" {
+			// read_only is also read as a JSON boolean, see configReadOnly
+			continue
+		}
+		value, isString := raw[key].(string)
+		if !isString {
+			errs = append(errs, fmt.Errorf("key '%s' must be a string", key))
+			continue
+		}
+		if field.Validate != nil {
+			if err := field.Validate(value); err != nil {
+				errs = append(errs, fmt.Errorf("key '%s': %s", key, err))
+			}
+		}
+	}
+	if _, ok := raw["host"]; !ok {
+		errs = append(errs, fmt.Errorf("missing required key 'host'"))
+	}
+	return errs
+}
+
+func defaultConfigPath() string {
+	userHomeDir, hErr := os.UserHomeDir()
+	if hErr != nil {
+		fmt.Println("Error getting user home directory: ", hErr)
+	}
+	return fmt.Sprintf("%s/.keyfactor/%s", userHomeDir, DefaultConfigFileName)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "kfutil configuration file utilities.",
+	Long:  `A collection of utilities for managing the kfutil configuration file.`,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the kfutil configuration file.",
+	Long: fmt.Sprintf(`Validates a kfutil configuration file against the config schema (version %d) and reports unknown keys,
+invalid values and missing required keys. Exits with a non-zero status code if the file is invalid.`, ConfigSchemaVersion),
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		configFile, _ := cmd.Flags().GetString("config")
+		if configFile == "" {
+			configFile = defaultConfigPath()
+		}
+		data, rErr := os.ReadFile(configFile)
+		if rErr != nil {
+			fmt.Printf("Error reading config file: %s\n", rErr)
+			log.Fatalf("[ERROR] reading config file: %s", rErr)
+		}
+		errs := validateConfigData(data)
+		if len(errs) == 0 {
+			fmt.Printf("Config file %s is valid.\n", configFile)
+			return
+		}
+		fmt.Printf("Config file %s is invalid:\n", configFile)
+		for _, e := range errs {
+			fmt.Printf("  - %s\n", e)
+		}
+		os.Exit(1)
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the keys supported in the kfutil configuration file.",
+	Long:  `Print the keys supported in the kfutil configuration file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keys := make([]string, 0, len(configSchema))
+		for k := range configSchema {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Printf("Config schema version %d:\n", ConfigSchemaVersion)
+		for _, k := range keys {
+			fmt.Printf("  %-16s %s\n", k, configSchema[k].Description)
+		}
+	},
+}
+
+func init() {
+	var configFile string
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configValidateCmd.Flags().StringVarP(&configFile, "config", "c", "", fmt.Sprintf("Config file to validate (default is $HOME/.keyfactor/%s)", DefaultConfigFileName))
+}
@@ -7,14 +7,25 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
 	"github.com/spf13/cobra"
 )
 
+// containerListPageSize is the default number of containers requested per page.
+const containerListPageSize = 100
+
 // containersCmd represents the containers command
 var containersCmd = &cobra.Command{
 	Use:   "containers",
@@ -34,11 +45,44 @@ var containersCreateCmd = &cobra.Command{
 var containersGetCmd = &cobra.Command{
 	Use:   "get",
 	Short: "Get certificate store container by ID or name.",
-	Long:  `Get certificate store container by ID or name.`,
+	Long: `Get certificate store container by ID or name. Names are matched case-insensitively: an exact match is used
+if there is one, otherwise containers whose name starts with --name, otherwise containers whose name contains it. If
+several containers match, the matching containers are listed to choose from when run in a terminal, and listed as an
+error otherwise.`,
+	Example: `kfutil containers get --id 12
+kfutil containers get --name prod-k8s`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetOutput(io.Discard)
-		id := cmd.Flag("id").Value.String()
+		id, _ := cmd.Flags().GetString("id")
+		name, _ := cmd.Flags().GetString("name")
+		noPrompt, _ := cmd.Flags().GetBool("no-prompt")
+
+		if id == "" && name == "" {
+			fmt.Println("[ERROR] one of --id or --name is required")
+			log.Fatalf("[ERROR] no container given")
+		}
+		if _, err := strconv.Atoi(id); id != "" && err != nil {
+			// --id used to take a name as well.
+			name, id = id, ""
+		}
 		kfClient, _ := initClient()
+		if name != "" {
+			ctx := commandContext(cmd)
+			containers, cErr := listStoreContainers(ctx, initGenClient(), containerListPageSize)
+			if cErr != nil {
+				exitIfInterrupted(ctx, "no container was looked up")
+				fmt.Printf("Error, unable to list store containers. %s\n", cErr)
+				log.Fatalf("Error: %s", cErr)
+			}
+			matches := matchStoreContainers(containers, name)
+			prompt := !noPrompt && isTerminal(os.Stdin) && isTerminal(os.Stdout)
+			container, mErr := chooseStoreContainer(matches, name, prompt)
+			if mErr != nil {
+				fmt.Printf("[ERROR] %s\n", mErr)
+				log.Fatalf("[ERROR] %s", mErr)
+			}
+			id = strconv.Itoa(int(container.GetId()))
+		}
 		agents, aErr := kfClient.GetStoreContainer(id)
 		if aErr != nil {
 			fmt.Printf("Error, unable to get container %s. %s\n", id, aErr)
@@ -53,6 +97,49 @@ var containersGetCmd = &cobra.Command{
 	},
 }
 
+// matchStoreContainers returns the containers matching name case-insensitively: the exact matches if there are any,
+// otherwise the containers whose name starts with name, otherwise those whose name contains it.
+func matchStoreContainers(containers []keyfactor.ModelsCertificateStoreContainerListResponse, name string) []keyfactor.ModelsCertificateStoreContainerListResponse {
+	needle := strings.ToLower(strings.TrimSpace(name))
+	tiers := []func(string) bool{
+		func(n string) bool { return n == needle },
+		func(n string) bool { return strings.HasPrefix(n, needle) },
+		func(n string) bool { return strings.Contains(n, needle) },
+	}
+	for _, matches := range tiers {
+		found := filterStoreContainers(containers, func(c keyfactor.ModelsCertificateStoreContainerListResponse) bool {
+			return matches(strings.ToLower(c.GetName()))
+		})
+		if len(found) > 0 {
+			return found
+		}
+	}
+	return nil
+}
+
+// chooseStoreContainer returns the only match, or lets the user choose one of several matches if prompt is set.
+func chooseStoreContainer(matches []keyfactor.ModelsCertificateStoreContainerListResponse, name string, prompt bool) (keyfactor.ModelsCertificateStoreContainerListResponse, error) {
+	switch {
+	case len(matches) == 0:
+		return keyfactor.ModelsCertificateStoreContainerListResponse{}, fmt.Errorf("no container matches '%s'", name)
+	case len(matches) == 1:
+		return matches[0], nil
+	}
+	options := make([]string, len(matches))
+	for i, c := range matches {
+		options[i] = fmt.Sprintf("%s (ID %d, %d store(s))", c.GetName(), c.GetId(), c.GetStoreCount())
+	}
+	if !prompt {
+		return keyfactor.ModelsCertificateStoreContainerListResponse{}, fmt.Errorf("%d containers match '%s', use --id or a more specific --name:\n  %s",
+			len(matches), name, strings.Join(options, "\n  "))
+	}
+	var choice int
+	if err := survey.AskOne(&survey.Select{Message: fmt.Sprintf("%d containers match '%s':", len(matches), name), Options: options}, &choice); err != nil {
+		return keyfactor.ModelsCertificateStoreContainerListResponse{}, err
+	}
+	return matches[choice], nil
+}
+
 var containersUpdateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update certificate store container by ID or name.",
@@ -74,32 +161,196 @@ var containersDeleteCmd = &cobra.Command{
 var containersListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List certificate store containers.",
-	Long:  `List certificate store containers.`,
+	Long: `List certificate store containers. Containers are listed page by page, so instances with many containers are
+listed in full before --store-type and --name-contains filter them. --limit and --offset select the part of the
+filtered list that is printed, --all prints all of it. Use --summary to count the containers and their stores by store
+type instead.`,
+	Example: `kfutil containers list --store-type K8SSecret --name-contains prod
+kfutil containers list --all --name-contains prod
+kfutil containers list --summary`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetOutput(io.Discard)
-		kfClient, _ := initClient()
-		agents, aErr := kfClient.GetStoreContainers()
-		if aErr != nil {
-			fmt.Printf("Error, unable to list store containers. %s\n", aErr)
-			log.Fatalf("Error: %s", aErr)
+		storeType, _ := cmd.Flags().GetString("store-type")
+		nameContains, _ := cmd.Flags().GetString("name-contains")
+		pageSize, _ := cmd.Flags().GetInt("page-size")
+		summary, _ := cmd.Flags().GetBool("summary")
+		paging, pErr := listPagingFromFlags(cmd)
+		if pErr != nil {
+			fmt.Printf("[ERROR] %s\n", pErr)
+			log.Fatalf("[ERROR] %s", pErr)
 		}
-		output, jErr := json.Marshal(agents)
+
+		if pageSize <= 0 {
+			pageSize = containerListPageSize
+		}
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		containers, cErr := listStoreContainers(ctx, sdkClient, pageSize)
+		if cErr != nil {
+			exitIfInterrupted(ctx, "no containers were listed")
+			fmt.Printf("Error, unable to list store containers. %s\n", cErr)
+			log.Fatalf("Error: %s", cErr)
+		}
+		var typeNames map[int32]string
+		if storeType != "" || summary {
+			var tErr error
+			if typeNames, tErr = containerStoreTypeNames(ctx, sdkClient); tErr != nil {
+				fmt.Printf("Error, unable to list store types. %s\n", tErr)
+				log.Fatalf("Error: %s", tErr)
+			}
+		}
+		if storeType != "" {
+			typeID, ok := containerStoreTypeID(storeType, typeNames)
+			if !ok {
+				fmt.Printf("[ERROR] unknown store type '%s'\n", storeType)
+				log.Fatalf("[ERROR] unknown store type: %s", storeType)
+			}
+			containers = filterStoreContainers(containers, func(c keyfactor.ModelsCertificateStoreContainerListResponse) bool {
+				return c.GetCertStoreType() == typeID
+			})
+		}
+		if nameContains != "" {
+			needle := strings.ToLower(nameContains)
+			containers = filterStoreContainers(containers, func(c keyfactor.ModelsCertificateStoreContainerListResponse) bool {
+				return strings.Contains(strings.ToLower(c.GetName()), needle)
+			})
+		}
+
+		if summary {
+			printContainerSummary(containers, typeNames)
+			return
+		}
+		from, to, more := paging.window(len(containers))
+		containers = containers[from:to]
+		if containers == nil {
+			containers = []keyfactor.ModelsCertificateStoreContainerListResponse{}
+		}
+		output, jErr := json.Marshal(containers)
 		if jErr != nil {
 			fmt.Printf("Error invalid API response from Keyfactor. %s\n", jErr)
 			log.Fatalf("[ERROR]: %s", jErr)
 		}
 		fmt.Printf("%s", output)
+		printListCount("container(s)", paging, len(containers), more)
 	},
 }
 
+// listStoreContainers returns all certificate store containers, requested pageSize at a time.
+func listStoreContainers(ctx context.Context, sdkClient *keyfactor.APIClient, pageSize int) ([]keyfactor.ModelsCertificateStoreContainerListResponse, error) {
+	var all []keyfactor.ModelsCertificateStoreContainerListResponse
+	for page := int32(1); ; page++ {
+		containers, _, err := sdkClient.CertificateStoreContainerApi.CertificateStoreContainerGetAllCertificateStoreContainers(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqSortField("Id").PqSortAscending(0).PqPageReturned(page).PqReturnLimit(int32(pageSize)).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %s", page, err)
+		}
+		all = append(all, containers...)
+		if len(containers) < pageSize {
+			return all, nil
+		}
+	}
+}
+
+// containerStoreTypeNames returns the short names of the store types by ID.
+func containerStoreTypeNames(ctx context.Context, sdkClient *keyfactor.APIClient) (map[int32]string, error) {
+	types, _, err := sdkClient.CertificateStoreTypeApi.CertificateStoreTypeGetTypes(ctx).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int32]string, len(types))
+	for _, t := range types {
+		names[t.GetStoreType()] = t.GetShortName()
+	}
+	return names, nil
+}
+
+// containerStoreTypeID returns the ID of a store type given by short name, case-insensitive, or by ID.
+func containerStoreTypeID(storeType string, typeNames map[int32]string) (int32, bool) {
+	if id, err := strconv.Atoi(storeType); err == nil {
+		_, ok := typeNames[int32(id)]
+		return int32(id), ok
+	}
+	for id, name := range typeNames {
+		if strings.EqualFold(name, storeType) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// filterStoreContainers returns the containers keep returns true for.
+func filterStoreContainers(containers []keyfactor.ModelsCertificateStoreContainerListResponse, keep func(keyfactor.ModelsCertificateStoreContainerListResponse) bool) []keyfactor.ModelsCertificateStoreContainerListResponse {
+	var kept []keyfactor.ModelsCertificateStoreContainerListResponse
+	for _, c := range containers {
+		if keep(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// printContainerSummary prints the number of containers and of their stores by store type.
+func printContainerSummary(containers []keyfactor.ModelsCertificateStoreContainerListResponse, typeNames map[int32]string) {
+	type typeCount struct {
+		name       string
+		containers int
+		stores     int
+	}
+	counts := make(map[int32]*typeCount)
+	for _, c := range containers {
+		id := c.GetCertStoreType()
+		tc, ok := counts[id]
+		if !ok {
+			name, known := typeNames[id]
+			if !known {
+				name = strconv.Itoa(int(id))
+			}
+			tc = &typeCount{name: name}
+			counts[id] = tc
+		}
+		tc.containers++
+		tc.stores += int(c.GetStoreCount())
+	}
+	sorted := make([]*typeCount, 0, len(counts))
+	for _, tc := range counts {
+		sorted = append(sorted, tc)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].containers != sorted[j].containers {
+			return sorted[i].containers > sorted[j].containers
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STORE TYPE\tCONTAINERS\tSTORES")
+	totalStores := 0
+	for _, tc := range sorted {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", tc.name, tc.containers, tc.stores)
+		totalStores += tc.stores
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\n", len(containers), totalStores)
+	w.Flush()
+}
+
 func init() {
 	RootCmd.AddCommand(containersCmd)
 	// LIST containers command
 	containersCmd.AddCommand(containersListCmd)
+	containersListCmd.Flags().String("store-type", "", "Only list containers of this store type, by short name or ID.")
+	containersListCmd.Flags().String("name-contains", "", "Only list containers whose name contains this text, case-insensitive.")
+	containersListCmd.Flags().Int("page-size", containerListPageSize, "Number of containers to request per page.")
+	addListPagingFlags(containersListCmd, "containers")
+	containersListCmd.Flags().Bool("summary", false, "Print the number of containers and stores by store type instead of the list.")
 	// GET containers command
 	containersCmd.AddCommand(containersGetCmd)
-	containersGetCmd.Flags().StringP("id", "i", "", "ID or name of the cert store container.")
-	containersGetCmd.MarkFlagRequired("id")
+	containersGetCmd.Flags().StringP("id", "i", "", "ID of the cert store container.")
+	containersGetCmd.Flags().StringP("name", "n", "", "Name of the cert store container, matched case-insensitively by prefix.")
+	containersGetCmd.Flags().Bool("no-prompt", false, "Fail instead of asking which container to use when several match.")
+	containersGetCmd.MarkFlagsMutuallyExclusive("id", "name")
 	// CREATE containers command
 	//containersCmd.AddCommand(containersCreateCmd)
 	// UPDATE containers command
@@ -0,0 +1,313 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const daemonServiceName = "kfutil"
+
+// daemonJobs are the jobs the daemon can schedule, with the kfutil command each runs.
+var daemonJobs = map[string][]string{
+	"rot-audit":       {"stores", "rot", "audit"},
+	"rot-reconcile":   {"stores", "rot", "reconcile"},
+	"stores-snapshot": {"stores", "snapshot"},
+}
+
+// daemonJobConfig is the job file of `kfutil daemon --config`.
+type daemonJobConfig struct {
+	// Job and Schedule are used when --job and --schedule are not given.
+	Job      string `yaml:"job,omitempty"`
+	Schedule string `yaml:"schedule,omitempty"`
+	// ReportDir is the working directory of the job, where reports without an absolute --outpath are written.
+	ReportDir string `yaml:"report-dir,omitempty"`
+	// Flags are the flags of the job command, e.g. stores: stores.csv. Lists are passed as repeated flags.
+	Flags map[string]interface{} `yaml:"flags,omitempty"`
+}
+
+func readDaemonJobConfig(path string) (*daemonJobConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg daemonJobConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid job file %s: %s", path, err)
+	}
+	if cfg.ReportDir != "" && !filepath.IsAbs(cfg.ReportDir) {
+		// Relative to the job file, so the daemon does not depend on the directory it is started from.
+		cfg.ReportDir = filepath.Join(filepath.Dir(path), cfg.ReportDir)
+	}
+	return &cfg, nil
+}
+
+// daemonJobArgs returns the kfutil arguments that run a job with its flags, in a stable order.
+func daemonJobArgs(job string, flags map[string]interface{}) ([]string, error) {
+	command, ok := daemonJobs[job]
+	if !ok {
+		return nil, fmt.Errorf("unknown job '%s', must be one of %s", job, strings.Join(daemonJobNames(), ", "))
+	}
+	args := append([]string{}, command...)
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch v := flags[name].(type) {
+		case nil:
+			args = append(args, "--"+name)
+		case []interface{}:
+			for _, item := range v {
+				args = append(args, fmt.Sprintf("--%s=%v", name, item))
+			}
+		case map[string]interface{}:
+			return nil, fmt.Errorf("flag '%s' must be a value or a list", name)
+		default:
+			args = append(args, fmt.Sprintf("--%s=%v", name, v))
+		}
+	}
+	return args, nil
+}
+
+func daemonJobNames() []string {
+	names := make([]string, 0, len(daemonJobs))
+	for name := range daemonJobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// kfutilDaemon runs a job on a schedule. Every run is a separate kfutil process, so a failed run does not stop the
+// daemon. Runs do not overlap: the daemon waits for a run to finish before scheduling the next one, so the runs that
+// fell due meanwhile are skipped and reported.
+type kfutilDaemon struct {
+	job      string
+	args     []string
+	dir      string
+	schedule *cronSchedule
+}
+
+// runOnce runs the job and returns its exit code.
+func (d *kfutilDaemon) runOnce(ctx context.Context) int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("[ERROR] locating the kfutil executable: %s\n", err)
+		log.Printf("[ERROR] locating the kfutil executable: %s", err)
+		return 1
+	}
+	args := d.args
+	if readOnly {
+		args = append([]string{"--read-only"}, args...)
+	}
+	run := exec.CommandContext(ctx, exe, args...)
+	run.Dir = d.dir
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	start := time.Now()
+	printInfo("%s Starting %s: kfutil %s\n", start.Format(time.RFC3339), d.job, strings.Join(d.args, " "))
+	err = run.Run()
+	code := 0
+	if err != nil {
+		code = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+	}
+	elapsed := time.Since(start).Round(time.Second)
+	if code != 0 {
+		printWarning("%s %s failed with exit code %d after %s\n", time.Now().Format(time.RFC3339), d.job, code, elapsed)
+		log.Printf("[ERROR] %s failed: %v", d.job, err)
+	} else {
+		printInfo("%s %s finished after %s\n", time.Now().Format(time.RFC3339), d.job, elapsed)
+	}
+	return code
+}
+
+// run runs the job on its schedule until ctx is cancelled.
+func (d *kfutilDaemon) run(ctx context.Context) {
+	for {
+		next := d.schedule.next(time.Now())
+		if next.IsZero() {
+			fmt.Println("[ERROR] the schedule never runs")
+			log.Printf("[ERROR] the schedule never runs")
+			return
+		}
+		printInfo("Next %s run at %s\n", d.job, next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			printInfo("Daemon stopped.\n")
+			return
+		case <-timer.C:
+		}
+		d.runOnce(ctx)
+		if skipped := d.missedRuns(next, time.Now()); skipped > 0 {
+			printWarning("Skipped %d %s run(s) that were due while the previous run was still running\n", skipped, d.job)
+			log.Printf("[WARN] skipped %d runs of %s due during the previous run", skipped, d.job)
+		}
+	}
+}
+
+// missedRuns returns the number of runs of the schedule after start and before now, i.e. the runs that fell due while
+// the run started at start was running.
+func (d *kfutilDaemon) missedRuns(start time.Time, now time.Time) int {
+	missed := 0
+	for t := d.schedule.next(start); !t.IsZero() && t.Before(now); t = d.schedule.next(t) {
+		missed++
+	}
+	return missed
+}
+
+// systemdUnit returns a systemd unit that runs the daemon with the same job, schedule and job file.
+func systemdUnit(exe string, job string, schedule string, configPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=kfutil scheduled %[2]s
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%[1]s daemon --job %[2]s --schedule "%[3]s" --config %[4]s
+# Keyfactor credentials, e.g. KEYFACTOR_HOSTNAME, KEYFACTOR_USERNAME and KEYFACTOR_PASSWORD.
+EnvironmentFile=-/etc/kfutil/kfutil.env
+Restart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=multi-user.target
+`, exe, job, schedule, configPath)
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run a kfutil job, such as a root of trust audit, on a cron schedule.",
+	Long: `Runs a job on a cron schedule until stopped, so kfutil can be installed as a service instead of relying on an
+external scheduler. Jobs:
+
+  rot-audit        kfutil stores rot audit
+  rot-reconcile    kfutil stores rot reconcile
+  stores-snapshot  kfutil stores snapshot
+
+The job file gives the flags of the job command, and optionally the job, the schedule and the directory reports are
+written to. Publish reports with the flags of the command, e.g. an s3:// --outpath, --notify-url or --summary-md:
+
+  job: rot-audit
+  schedule: "0 2 * * *"
+  report-dir: /var/lib/kfutil/reports
+  flags:
+    stores: /etc/kfutil/stores.csv
+    add-certs: /etc/kfutil/roots.csv
+    notify-url: https://hooks.example.com/kfutil
+
+Schedules have five fields, minute hour day-of-month month day-of-week, in local time, e.g. "0 2 * * *" or
+"*/30 8-18 * * 1-5", or are one of @hourly, @daily, @weekly or @monthly. Every run is a separate kfutil process and a
+failed run does not stop the daemon. Runs do not overlap: runs that fall due while the previous run is still running are
+skipped, with a warning.
+
+On Linux, --print-systemd-unit prints a unit file to install the daemon as a systemd service. On Windows, create a
+service with 'sc.exe create kfutil binPath= "C:\kfutil\kfutil.exe daemon --config C:\kfutil\job.yaml"', kfutil detects
+that it is run by the service manager.`,
+	Example: `kfutil daemon --schedule "0 2 * * *" --job rot-audit --config job.yaml
+kfutil daemon --config job.yaml --once
+kfutil daemon --schedule @daily --job rot-audit --config /etc/kfutil/job.yaml --print-systemd-unit > /etc/systemd/system/kfutil.service`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		configPath, _ := cmd.Flags().GetString("config")
+		job, _ := cmd.Flags().GetString("job")
+		schedule, _ := cmd.Flags().GetString("schedule")
+		once, _ := cmd.Flags().GetBool("once")
+		printUnit, _ := cmd.Flags().GetBool("print-systemd-unit")
+
+		cfg, cErr := readDaemonJobConfig(configPath)
+		if cErr != nil {
+			fmt.Printf("[ERROR] reading job file: %s\n", cErr)
+			log.Fatalf("[ERROR] reading job file: %s", cErr)
+		}
+		if job == "" {
+			job = cfg.Job
+		}
+		if schedule == "" {
+			schedule = cfg.Schedule
+		}
+		if job == "" {
+			fmt.Printf("[ERROR] no job given, use --job or job in the job file, one of %s\n", strings.Join(daemonJobNames(), ", "))
+			log.Fatalf("[ERROR] no job given")
+		}
+		jobArgs, aErr := daemonJobArgs(job, cfg.Flags)
+		if aErr != nil {
+			fmt.Printf("[ERROR] %s\n", aErr)
+			log.Fatalf("[ERROR] %s", aErr)
+		}
+		var sched *cronSchedule
+		if !once {
+			if schedule == "" {
+				fmt.Println("[ERROR] no schedule given, use --schedule or schedule in the job file")
+				log.Fatalf("[ERROR] no schedule given")
+			}
+			var sErr error
+			if sched, sErr = parseCronSchedule(schedule); sErr != nil {
+				fmt.Printf("[ERROR] %s\n", sErr)
+				log.Fatalf("[ERROR] %s", sErr)
+			}
+		}
+		if printUnit {
+			exe, _ := os.Executable()
+			absConfig, _ := filepath.Abs(configPath)
+			fmt.Print(systemdUnit(exe, job, schedule, absConfig))
+			return
+		}
+		d := &kfutilDaemon{job: job, args: jobArgs, dir: cfg.ReportDir, schedule: sched}
+		if d.dir != "" {
+			if mErr := os.MkdirAll(d.dir, 0755); mErr != nil {
+				fmt.Printf("[ERROR] creating report directory %s: %s\n", d.dir, mErr)
+				log.Fatalf("[ERROR] creating report directory: %s", mErr)
+			}
+		}
+		if once {
+			os.Exit(d.runOnce(commandContext(cmd)))
+		}
+		isService, svcErr := runAsWindowsService(daemonServiceName, d.run)
+		if svcErr != nil {
+			fmt.Printf("[ERROR] running as a Windows service: %s\n", svcErr)
+			log.Fatalf("[ERROR] running as a Windows service: %s", svcErr)
+		}
+		if !isService {
+			d.run(commandContext(cmd))
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().String("config", "", "Job file with the flags of the job, and optionally its job, schedule and report-dir.")
+	daemonCmd.Flags().String("job", "", fmt.Sprintf("Job to run, one of %s. Overrides job in the job file.", strings.Join(daemonJobNames(), ", ")))
+	daemonCmd.Flags().String("schedule", "", `Cron schedule of the job, e.g. "0 2 * * *" or @daily. Overrides schedule in the job file.`)
+	daemonCmd.Flags().Bool("once", false, "Run the job once now and exit with its exit code, e.g. to test the job file.")
+	daemonCmd.Flags().Bool("print-systemd-unit", false, "Print a systemd unit that runs the daemon with these flags and exit.")
+	daemonCmd.MarkFlagRequired("config")
+}
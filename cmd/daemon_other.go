@@ -0,0 +1,17 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+//go:build !windows
+
+package cmd
+
+import "context"
+
+// runAsWindowsService reports false, services other than Windows services run the daemon in the foreground.
+func runAsWindowsService(name string, run func(ctx context.Context)) (bool, error) {
+	return false, nil
+}
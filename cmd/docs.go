@@ -0,0 +1,58 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+	"kfutil/pkg/version"
+)
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate kfutil documentation.",
+	Long:  `Generate kfutil documentation from the command definitions.`,
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man",
+	Short: "Generate man pages for every kfutil command.",
+	Long:  `Generate section 1 man pages for every kfutil command, e.g. for packaging.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		outDir, _ := cmd.Flags().GetString("out")
+		if mErr := os.MkdirAll(outDir, 0755); mErr != nil {
+			fmt.Printf("Error creating directory %s: %s\n", outDir, mErr)
+			log.Fatalf("[ERROR] creating man page directory: %s", mErr)
+		}
+		header := &doc.GenManHeader{
+			Title:   "KFUTIL",
+			Section: "1",
+			Source:  fmt.Sprintf("kfutil %s", version.VERSION),
+			Manual:  "kfutil Manual",
+		}
+		RootCmd.DisableAutoGenTag = true
+		if gErr := doc.GenManTree(RootCmd, header, outDir); gErr != nil {
+			fmt.Printf("Error generating man pages: %s\n", gErr)
+			log.Fatalf("[ERROR] generating man pages: %s", gErr)
+		}
+		fmt.Printf("Man pages written to %s\n", outDir)
+	},
+}
+
+func init() {
+	var outDir string
+	RootCmd.AddCommand(docsCmd)
+	docsCmd.AddCommand(docsManCmd)
+	docsManCmd.Flags().StringVarP(&outDir, "out", "o", "./man/", "Directory to write the man pages to.")
+}
@@ -0,0 +1,198 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Dry run modes. Client dry runs only validate the input offline, server dry runs also validate it against the
+// Keyfactor instance, e.g. that referenced orchestrators and containers exist. Keyfactor Command has no validation-only
+// endpoints for these operations, so server dry runs perform the lookups a create or update request depends on.
+const (
+	dryRunNone   = ""
+	dryRunClient = "client"
+	dryRunServer = "server"
+)
+
+type dryRunPlanItem struct {
+	Action   string
+	Target   string
+	Problems []string
+}
+
+// addDryRunFlag adds a `--dry-run[=client|server]` flag. `--dry-run` on its own is a client dry run.
+func addDryRunFlag(cmd *cobra.Command, shorthand string, usage string) {
+	cmd.Flags().StringP("dry-run", shorthand, dryRunNone, usage+" One of client or server, --dry-run alone is client.")
+	cmd.Flags().Lookup("dry-run").NoOptDefVal = dryRunClient
+}
+
+// getDryRunMode returns the dry run mode of a command that uses addDryRunFlag.
+func getDryRunMode(cmd *cobra.Command) (string, error) {
+	mode, _ := cmd.Flags().GetString("dry-run")
+	switch strings.ToLower(mode) {
+	case dryRunNone, "false":
+		return dryRunNone, nil
+	case dryRunClient, "true":
+		return dryRunClient, nil
+	case dryRunServer:
+		return dryRunServer, nil
+	}
+	return "", fmt.Errorf("invalid --dry-run mode '%s', must be one of client or server", mode)
+}
+
+// printDryRunPlan prints a plan style report of the dry run and returns the number of invalid items.
+func printDryRunPlan(mode string, items []dryRunPlanItem) int {
+	invalid := 0
+	fmt.Printf("Dry run (%s) plan:\n", mode)
+	for _, item := range items {
+		if len(item.Problems) == 0 {
+			fmt.Printf("  + %s %s\n", item.Action, item.Target)
+			continue
+		}
+		invalid++
+		fmt.Printf("  ! %s %s\n", item.Action, item.Target)
+		for _, p := range item.Problems {
+			fmt.Printf("      - %s\n", p)
+		}
+	}
+	fmt.Printf("\n%d valid, %d invalid.\n", len(items)-invalid, invalid)
+	return invalid
+}
+
+// storeCreateValidator validates create store requests, caching the server side lookups across requests.
+type storeCreateValidator struct {
+	kfClient   *api.Client
+	mode       string
+	storeType  *api.CertificateStoreType
+	agents     map[string]api.Agent
+	containers map[int]error
+	existing   map[string]string
+}
+
+func newStoreCreateValidator(kfClient *api.Client, mode string, storeTypeId int) (*storeCreateValidator, error) {
+	v := &storeCreateValidator{kfClient: kfClient, mode: mode, containers: make(map[int]error)}
+	storeType, err := kfClient.GetCertificateStoreType(storeTypeId)
+	if err != nil {
+		return nil, err
+	}
+	v.storeType = storeType
+	if mode != dryRunServer {
+		return v, nil
+	}
+	agents, aErr := kfClient.GetAgentList()
+	if aErr != nil {
+		return nil, aErr
+	}
+	v.agents = make(map[string]api.Agent, len(agents))
+	for _, a := range agents {
+		v.agents[strings.ToLower(a.AgentId)] = a
+	}
+	stores, sErr := kfClient.ListCertificateStores(&map[string]interface{}{"Category": storeTypeId})
+	if sErr != nil {
+		return nil, sErr
+	}
+	v.existing = make(map[string]string)
+	if stores != nil {
+		for _, s := range *stores {
+			v.existing[strings.ToLower(s.ClientMachine+"|"+s.StorePath)] = s.Id
+		}
+	}
+	return v, nil
+}
+
+// validate returns the problems with a create store request.
+func (v *storeCreateValidator) validate(args *api.CreateStoreFctArgs) []string {
+	var problems []string
+	if args.ClientMachine == "" {
+		problems = append(problems, "ClientMachine is required")
+	}
+	if args.StorePath == "" {
+		problems = append(problems, "StorePath is required")
+	}
+	for _, field := range storeTypeSchema(v.storeType) {
+		if field.Kind != fieldKindProperty {
+			continue
+		}
+		value := ""
+		if raw, ok := args.Properties[field.Name]; ok && raw != nil {
+			value = fmt.Sprintf("%v", raw)
+			if _, isSecret := raw.(map[string]interface{}); isSecret {
+				// Secret values are only checked for presence.
+				field = storeTypeField{Kind: field.Kind, Name: field.Name, Required: field.Required}
+			}
+		}
+		if problem := field.validateValue(value); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if v.mode != dryRunServer {
+		return problems
+	}
+	if args.AgentId != "" {
+		agent, ok := v.agents[strings.ToLower(args.AgentId)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("orchestrator '%s' does not exist", args.AgentId))
+		case agent.Status != agentStatusApproved:
+			problems = append(problems, fmt.Sprintf("orchestrator '%s' (%s) is not approved", args.AgentId, agent.ClientMachine))
+		}
+	}
+	if args.ContainerId != nil {
+		cErr, checked := v.containers[*args.ContainerId]
+		if !checked {
+			_, cErr = v.kfClient.GetStoreContainer(*args.ContainerId)
+			v.containers[*args.ContainerId] = cErr
+		}
+		if cErr != nil {
+			problems = append(problems, fmt.Sprintf("container %d does not exist", *args.ContainerId))
+		}
+	}
+	if id, ok := v.existing[strings.ToLower(args.ClientMachine+"|"+args.StorePath)]; ok {
+		problems = append(problems, fmt.Sprintf("certificate store already exists with ID %s", id))
+	}
+	return problems
+}
+
+func storeTarget(args *api.CreateStoreFctArgs) string {
+	return fmt.Sprintf("store %s:%s (type %s)", args.ClientMachine, args.StorePath, strconv.Itoa(args.CertStoreType))
+}
+
+// validateStoreTypeCreate returns the problems with a create store type request.
+func validateStoreTypeCreate(kfClient *api.Client, mode string, storeType *api.CertificateStoreType) []string {
+	var problems []string
+	if storeType.Name == "" {
+		problems = append(problems, "Name is required")
+	}
+	if storeType.ShortName == "" {
+		problems = append(problems, "ShortName is required")
+	}
+	if storeType.Capability == "" {
+		problems = append(problems, "Capability is required")
+	}
+	if storeType.Properties != nil {
+		names := make(map[string]bool)
+		for _, prop := range *storeType.Properties {
+			if names[prop.Name] {
+				problems = append(problems, fmt.Sprintf("property '%s' is defined more than once", prop.Name))
+			}
+			names[prop.Name] = true
+		}
+	}
+	if mode != dryRunServer || storeType.ShortName == "" {
+		return problems
+	}
+	if err := requireStoreTypeCapabilities(storeType); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
@@ -0,0 +1,438 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+	"kfutil/pkg/rot"
+)
+
+// Status of a row of `enroll bulk`.
+const (
+	enrollStatusEnrolled = "enrolled"
+	enrollStatusPartial  = "enrolled, not added to all stores"
+	enrollStatusPending  = "pending"
+	enrollStatusFailed   = "failed"
+)
+
+// EnrollManifestColumns are the columns of an `enroll bulk` manifest. CN, Template and CA are required.
+var EnrollManifestColumns = []string{"CN", "SANs", "Subject", "Template", "CA", "Metadata", "Stores", "Password"}
+
+// EnrollResultsHeader is the header of the results CSV of `enroll bulk`.
+var EnrollResultsHeader = []string{"Line", "CN", "Status", "CertID", "Thumbprint", "SerialNumber", "Directory", "Error"}
+
+var enrollUnsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// enrollRequest is a parsed row of an `enroll bulk` manifest.
+type enrollRequest struct {
+	Line     int
+	CN       string
+	SANs     []string
+	Subject  string
+	Template string
+	CA       string
+	Metadata map[string]string
+	Stores   []string
+	Password string
+}
+
+// enrollResult is the outcome of an enrollRequest, a row of the results CSV.
+type enrollResult struct {
+	Line         int
+	CN           string
+	Status       string
+	CertID       int
+	Thumbprint   string
+	SerialNumber string
+	Directory    string
+	Error        string
+}
+
+func (r enrollResult) row() []string {
+	certID := ""
+	if r.CertID != 0 {
+		certID = strconv.Itoa(r.CertID)
+	}
+	return []string{strconv.Itoa(r.Line), r.CN, r.Status, certID, r.Thumbprint, r.SerialNumber, r.Directory, r.Error}
+}
+
+// splitList splits a manifest cell listing several values, separated by ';' or '|'.
+func splitList(cell string) []string {
+	var values []string
+	for _, v := range strings.FieldsFunc(cell, func(r rune) bool { return r == ';' || r == '|' }) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseEnrollRow parses a manifest row. Metadata is given as Name=Value pairs separated by ';' or '|'.
+func parseEnrollRow(row tabularRow) (enrollRequest, error) {
+	req := enrollRequest{
+		Line:     row.Line,
+		CN:       strings.TrimSpace(row.Get("CN")),
+		SANs:     splitList(row.Get("SANs")),
+		Subject:  strings.TrimSpace(row.Get("Subject")),
+		Template: strings.TrimSpace(row.Get("Template")),
+		CA:       strings.TrimSpace(row.Get("CA")),
+		Stores:   splitList(row.Get("Stores")),
+		Password: row.Get("Password"),
+	}
+	metadata, err := parseNameValues("metadata", splitList(row.Get("Metadata")))
+	if err != nil {
+		return req, fmt.Errorf("invalid Metadata: %s", strings.TrimPrefix(err.Error(), "invalid --metadata "))
+	}
+	req.Metadata = metadata
+	if _, err := parseSubjectParts(req.Subject); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// subject returns the subject of the request: CN followed by the parts of the Subject column, e.g. O=Example.
+func (r enrollRequest) subject() string {
+	subject := "CN=" + strings.ReplaceAll(r.CN, ",", `\,`)
+	if r.Subject != "" {
+		subject += "," + r.Subject
+	}
+	return subject
+}
+
+// names returns the CN and DNS SANs of the request, the names checked for duplicates.
+func (r enrollRequest) names() []string {
+	names := []string{r.CN}
+	for _, san := range r.SANs {
+		if net.ParseIP(san) == nil && !strings.Contains(san, "://") && !strings.EqualFold(san, r.CN) {
+			names = append(names, san)
+		}
+	}
+	return names
+}
+
+// sans sorts the SANs of the request into IP addresses, URIs and DNS names.
+func (r enrollRequest) sans() *api.SANs {
+	sans := &api.SANs{}
+	for _, san := range r.SANs {
+		ip := net.ParseIP(san)
+		switch {
+		case ip != nil && ip.To4() != nil:
+			sans.IP4 = append(sans.IP4, san)
+		case ip != nil:
+			sans.IP6 = append(sans.IP6, san)
+		case strings.Contains(san, "://"):
+			sans.URI = append(sans.URI, san)
+		default:
+			sans.DNS = append(sans.DNS, san)
+		}
+	}
+	return sans
+}
+
+// dirName returns the name of the artifact directory of the request, unique by manifest line.
+func (r enrollRequest) dirName() string {
+	name := strings.Trim(enrollUnsafePathChars.ReplaceAllString(strings.ReplaceAll(r.CN, "*", "wildcard"), "_"), "_.")
+	if name == "" {
+		name = "cert"
+	}
+	return fmt.Sprintf("%04d_%s", r.Line, name)
+}
+
+// generatePFXPassword returns a random password for a PFX.
+func generatePFXPassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// enrollmentChecker validates requests against their template, loading the requirements of each template once.
+type enrollmentChecker struct {
+	ctx       context.Context
+	sdkClient *keyfactor.APIClient
+
+	mu           sync.Mutex
+	requirements map[string]*enrollmentRequirements
+	errs         map[string]error
+}
+
+func newEnrollmentChecker(ctx context.Context, sdkClient *keyfactor.APIClient) *enrollmentChecker {
+	return &enrollmentChecker{ctx: ctx, sdkClient: sdkClient,
+		requirements: make(map[string]*enrollmentRequirements), errs: make(map[string]error)}
+}
+
+// check returns an error listing the values of req that its template does not accept.
+func (c *enrollmentChecker) check(req enrollRequest) error {
+	c.mu.Lock()
+	key := strings.ToLower(req.Template)
+	requirements, loaded := c.requirements[key]
+	err := c.errs[key]
+	if !loaded && err == nil {
+		requirements, err = loadEnrollmentRequirements(c.ctx, c.sdkClient, 0, req.Template)
+		c.requirements[key], c.errs[key] = requirements, err
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	subject, _ := parseSubjectParts(req.subject())
+	return enrollmentProblemsError(requirements.Template,
+		requirements.validate(enrollmentValues{Subject: subject, Fields: map[string]string{}, Metadata: req.Metadata}))
+}
+
+// enrollPFX enrolls req and writes the PFX and its password to dir. The certificate is then added to the stores of
+// the request; failing to add it is reported in the result but does not fail the enrollment.
+func enrollPFX(ctx context.Context, kfClient *api.Client, req enrollRequest, dir string) (enrollResult, error) {
+	result := enrollResult{Line: req.Line, CN: req.CN, Status: enrollStatusFailed}
+	password := req.Password
+	if password == "" {
+		var err error
+		if password, err = generatePFXPassword(); err != nil {
+			return result, fmt.Errorf("generating password: %s", err)
+		}
+	}
+	registerSecret(password)
+	metadata := make(map[string]interface{}, len(req.Metadata))
+	for name, value := range req.Metadata {
+		metadata[name] = value
+	}
+	resp, err := kfClient.EnrollPFX(&api.EnrollPFXFctArgs{
+		CustomFriendlyName:   req.CN,
+		Password:             password,
+		SubjectString:        req.subject(),
+		IncludeChain:         true,
+		CertificateAuthority: req.CA,
+		Template:             req.Template,
+		SANs:                 req.sans(),
+		Metadata:             metadata,
+		CertFormat:           "PFX",
+	})
+	if err != nil {
+		return result, err
+	}
+	info := resp.CertificateInformation
+	result.CertID, result.Thumbprint, result.SerialNumber = info.KeyfactorID, info.Thumbprint, info.SerialNumber
+	if info.PKCS12Blob == "" {
+		result.Status = enrollStatusPending
+		result.Error = strings.TrimSpace(info.RequestDisposition + " " + info.DispositionMessage)
+		return result, nil
+	}
+	pfx, err := base64.StdEncoding.DecodeString(info.PKCS12Blob)
+	if err != nil {
+		return result, fmt.Errorf("decoding PFX of certificate %d: %s", info.KeyfactorID, err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return result, err
+	}
+	pfxPath := filepath.Join(dir, "certificate.pfx")
+	if err := os.WriteFile(pfxPath, pfx, 0600); err != nil {
+		return result, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "password.txt"), []byte(password+"\n"), 0600); err != nil {
+		return result, err
+	}
+	recordResultArtifact(pfxPath)
+	result.Directory = dir
+	result.Status = enrollStatusEnrolled
+
+	if len(req.Stores) > 0 {
+		entries := make([]api.CertificateStore, len(req.Stores))
+		for i, id := range req.Stores {
+			entries[i] = api.CertificateStore{CertificateStoreId: id}
+		}
+		if sErr := rot.AddToStores(ctx, kfClient, info.KeyfactorID, entries); sErr != nil {
+			result.Status = enrollStatusPartial
+			result.Error = fmt.Sprintf("adding to stores %s: %s", strings.Join(req.Stores, ", "), sErr)
+		}
+	}
+	return result, nil
+}
+
+var enrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Enroll certificates.",
+	Long:  `Enroll certificates through Keyfactor Command.`,
+}
+
+var enrollBulkCmd = &cobra.Command{
+	Use:   "bulk --file <manifest>",
+	Short: "Enroll PFX certificates for every row of a manifest.",
+	Long: `Enrolls a PFX certificate for each row of a CSV, JSON or .xlsx manifest with the columns:
+
+  CN        Common name, required.
+  SANs      Subject alternative names separated by ';' or '|'. IP addresses and URIs are recognized, other values
+            are DNS names.
+  Subject   Other subject parts, e.g. O=Example,C=US.
+  Template  Short name of the certificate template, required.
+  CA        Certificate authority, e.g. ca.example.com\Example Issuing CA, required.
+  Metadata  Metadata as Name=Value pairs separated by ';' or '|'.
+  Stores    IDs of certificate stores to add the certificate to, separated by ';' or '|'.
+  Password  Password of the PFX. A random password is generated if empty.
+
+Before enrolling, every row is checked against the requirements of its template and, unless --check-duplicates is
+off, for active certificates already holding its names. Rows that fail the checks are not enrolled. The PFX and its
+password of each certificate are written to a directory per row under --outdir, named after the manifest line and
+CN, and a results CSV lists the certificate ID or the error of every row. Exits with status 1 if a row failed.`,
+	Example: `kfutil enroll bulk --file enroll.csv
+kfutil enroll bulk --file enroll.csv --outdir certs --concurrency 3 --check-duplicates abort
+kfutil enroll bulk --file enroll.csv --dry-run=server`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		file, _ := cmd.Flags().GetString("file")
+		outdir, _ := cmd.Flags().GetString("outdir")
+		resultsPath, _ := cmd.Flags().GetString("results")
+		dryRun, dErr := getDryRunMode(cmd)
+		if dErr != nil {
+			fmt.Printf("[ERROR] %s\n", dErr)
+			log.Fatalf("[ERROR] %s", dErr)
+		}
+
+		manifest, err := readTabularFile(file, EnrollManifestColumns, []string{"CN", "Template", "CA"})
+		if err != nil {
+			fmt.Printf("[ERROR] reading %s: %s\n", file, err)
+			log.Fatalf("[ERROR] reading manifest: %s", err)
+		}
+		manifest.reportErrors()
+		if len(manifest.Rows) == 0 {
+			fmt.Printf("[ERROR] %s has no rows to enroll\n", file)
+			log.Fatalf("[ERROR] empty manifest")
+		}
+
+		var requests []enrollRequest
+		var results []enrollResult
+		for _, row := range manifest.Rows {
+			req, pErr := parseEnrollRow(row)
+			if pErr != nil {
+				results = append(results, enrollResult{Line: req.Line, CN: req.CN, Status: enrollStatusFailed, Error: pErr.Error()})
+				continue
+			}
+			requests = append(requests, req)
+		}
+
+		ctx := commandContext(cmd)
+		if dryRun != dryRunClient {
+			sdkClient := initGenClient()
+			checker := newEnrollmentChecker(ctx, sdkClient)
+			var accepted []enrollRequest
+			for _, req := range requests {
+				cErr := checker.check(req)
+				if cErr == nil {
+					cErr = checkDuplicatesFromFlags(ctx, cmd, sdkClient, req.names())
+				}
+				if cErr != nil {
+					exitIfInterrupted(ctx, "no certificates were enrolled")
+					results = append(results, enrollResult{Line: req.Line, CN: req.CN, Status: enrollStatusFailed, Error: cErr.Error()})
+					continue
+				}
+				accepted = append(accepted, req)
+			}
+			requests = accepted
+		}
+
+		if dryRun != dryRunNone {
+			var items []dryRunPlanItem
+			for _, req := range requests {
+				items = append(items, dryRunPlanItem{Action: "enroll", Target: fmt.Sprintf("%s (line %d)", req.CN, req.Line)})
+			}
+			for _, r := range results {
+				items = append(items, dryRunPlanItem{Action: "enroll", Target: fmt.Sprintf("%s (line %d)", r.CN, r.Line), Problems: []string{r.Error}})
+			}
+			if printDryRunPlan(dryRun, items) > 0 || len(manifest.Errors) > 0 {
+				finishResult(1)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if outdir == "" {
+			outdir = filepath.Join("enroll", time.Now().UTC().Format("2006-01-02T150405Z"))
+		}
+		if mErr := os.MkdirAll(outdir, 0700); mErr != nil {
+			fmt.Printf("[ERROR] creating %s: %s\n", outdir, mErr)
+			log.Fatalf("[ERROR] creating output directory: %s", mErr)
+		}
+		if resultsPath == "" {
+			resultsPath = filepath.Join(outdir, "results.csv")
+		}
+
+		kfClient, _ := initClient()
+		runner := newBatchRunnerFromFlags(cmd)
+		enrolled := make([]enrollResult, len(requests))
+		errs := runner.run(len(requests), func(i int) error {
+			result, eErr := enrollPFX(ctx, kfClient, requests[i], filepath.Join(outdir, requests[i].dirName()))
+			enrolled[i] = result
+			return eErr
+		})
+		for i, eErr := range errs {
+			if eErr != nil {
+				enrolled[i].Line, enrolled[i].CN, enrolled[i].Status = requests[i].Line, requests[i].CN, enrollStatusFailed
+				enrolled[i].Error = eErr.Error()
+			}
+		}
+		results = append(results, enrolled...)
+		sort.Slice(results, func(i, j int) bool { return results[i].Line < results[j].Line })
+
+		counts := make(map[string]int)
+		rows := [][]string{EnrollResultsHeader}
+		for _, r := range results {
+			counts[r.Status]++
+			rows = append(rows, r.row())
+			switch r.Status {
+			case enrollStatusFailed:
+				fmt.Printf("[ERROR] line %d %s: %s\n", r.Line, r.CN, r.Error)
+			case enrollStatusPartial, enrollStatusPending:
+				printWarning("Line %d %s %s: %s\n", r.Line, r.CN, r.Status, r.Error)
+			}
+		}
+		if wErr := writeOutputFile(resultsPath, csvBytes(rows), 0644); wErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", resultsPath, wErr)
+			log.Fatalf("[ERROR] writing results: %s", wErr)
+		}
+		runner.printStats()
+		recordResultCount("enrolled", counts[enrollStatusEnrolled]+counts[enrollStatusPartial])
+		recordResultCount("pending", counts[enrollStatusPending])
+		recordResultCount("failed", counts[enrollStatusFailed]+len(manifest.Errors))
+		printInfo("%d enrolled, %d pending, %d failed. Results written to %s\n",
+			counts[enrollStatusEnrolled]+counts[enrollStatusPartial], counts[enrollStatusPending], counts[enrollStatusFailed], resultsPath)
+		exitIfInterrupted(ctx, "not every row was enrolled")
+		if counts[enrollStatusFailed] > 0 || len(manifest.Errors) > 0 {
+			finishResult(1)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(enrollCmd)
+	enrollCmd.AddCommand(enrollBulkCmd)
+	enrollBulkCmd.Flags().StringP("file", "f", "", "Manifest of the certificates to enroll, a CSV, JSON or .xlsx file or '-' for stdin.")
+	enrollBulkCmd.Flags().String("outdir", "", "Directory to write the PFX files and results to. Defaults to enroll/<timestamp>.")
+	enrollBulkCmd.Flags().String("results", "", "Path of the results CSV. Defaults to results.csv in --outdir.")
+	addBatchFlags(enrollBulkCmd)
+	addDuplicateCheckFlag(enrollBulkCmd, duplicateCheckWarn)
+	addDryRunFlag(enrollBulkCmd, "", "Check the manifest without enrolling. A server dry run also checks the rows against their templates and for duplicates.")
+	enrollBulkCmd.MarkFlagRequired("file")
+}
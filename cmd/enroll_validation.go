@@ -0,0 +1,409 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+// Metadata field data types and enrollment settings of Keyfactor Command.
+const (
+	metadataTypeString         = 1
+	metadataTypeInteger        = 2
+	metadataTypeDate           = 3
+	metadataTypeBoolean        = 4
+	metadataTypeMultipleChoice = 5
+	metadataTypeBigText        = 6
+	metadataTypeEmail          = 7
+
+	metadataEnrollmentRequired = 1
+	metadataEnrollmentHidden   = 2
+
+	enrollmentFieldTypeMultipleChoice = 2
+)
+
+// Kinds of enrollment values.
+const (
+	enrollKindSubject  = "subject"
+	enrollKindField    = "enrollment field"
+	enrollKindMetadata = "metadata"
+)
+
+// enrollmentValues are the values supplied for an enrollment: subject parts such as CN or O, the template's
+// enrollment fields and certificate metadata, each by name.
+type enrollmentValues struct {
+	Subject  map[string]string
+	Fields   map[string]string
+	Metadata map[string]string
+}
+
+// enrollmentProblem is a value of an enrollment that the template does not accept.
+type enrollmentProblem struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Problem string `json:"problem"`
+}
+
+func (p enrollmentProblem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Name, p.Problem)
+}
+
+// enrollmentMetadataRule is the validation of a metadata field, with the template's overrides applied.
+type enrollmentMetadataRule struct {
+	Name       string
+	DataType   int32
+	Required   bool
+	Hidden     bool
+	Default    string
+	Options    []string
+	Validation string
+	Message    string
+}
+
+// enrollmentRequirements are the values a template requires and the rules they must meet.
+type enrollmentRequirements struct {
+	Template string
+	Fields   []keyfactor.ModelsTemplateRetrievalResponseTemplateEnrollmentFieldModel
+	Metadata []enrollmentMetadataRule
+	Subject  []keyfactor.ModelsTemplateRetrievalResponseTemplateRegexModel
+}
+
+// loadEnrollmentRequirements looks up the enrollment fields, metadata rules and subject regexes of a template. The
+// template can override the validation, message, default and required setting of a metadata field.
+func loadEnrollmentRequirements(ctx context.Context, sdkClient *keyfactor.APIClient, templateID int32, templateName string) (*enrollmentRequirements, error) {
+	template, err := getTemplate(sdkClient, templateID, templateName)
+	if err != nil {
+		return nil, fmt.Errorf("getting template: %s", err)
+	}
+	fields, _, err := sdkClient.MetadataFieldApi.MetadataFieldGetAllMetadataFields(ctx).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("listing metadata fields: %s", err)
+	}
+	overrides := make(map[int32]keyfactor.ModelsTemplateRetrievalResponseTemplateMetadataFieldModel)
+	for _, o := range template.MetadataFields {
+		overrides[o.GetMetadataId()] = o
+	}
+	req := &enrollmentRequirements{Template: template.GetTemplateName(), Fields: template.EnrollmentFields, Subject: template.TemplateRegexes}
+	if req.Template == "" {
+		req.Template = template.GetCommonName()
+	}
+	for _, f := range fields {
+		rule := enrollmentMetadataRule{
+			Name:       f.GetName(),
+			DataType:   f.GetDataType(),
+			Default:    f.GetDefaultValue(),
+			Options:    splitOptions(f.GetOptions()),
+			Validation: f.GetValidation(),
+			Message:    f.GetMessage(),
+		}
+		enrollment := f.GetEnrollment()
+		if o, ok := overrides[f.GetId()]; ok {
+			enrollment = o.GetEnrollment()
+			if o.GetValidation() != "" {
+				rule.Validation, rule.Message = o.GetValidation(), o.GetMessage()
+			}
+			if o.GetDefaultValue() != "" {
+				rule.Default = o.GetDefaultValue()
+			}
+		}
+		rule.Required = enrollment == metadataEnrollmentRequired
+		rule.Hidden = enrollment == metadataEnrollmentHidden
+		req.Metadata = append(req.Metadata, rule)
+	}
+	return req, nil
+}
+
+// lookupFold returns the value of name in values, matching the name case-insensitively.
+func lookupFold(values map[string]string, name string) (string, bool) {
+	if v, ok := values[name]; ok {
+		return v, true
+	}
+	for k, v := range values {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// containsFold reports whether options contains value, case-insensitively.
+func containsFold(options []string, value string) bool {
+	for _, o := range options {
+		if strings.EqualFold(o, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMetadataValue returns what is wrong with value for rule, or an empty string if it is valid.
+func checkMetadataValue(rule enrollmentMetadataRule, value string) string {
+	switch rule.DataType {
+	case metadataTypeInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Sprintf("'%s' is not an integer", value)
+		}
+	case metadataTypeDate:
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				return fmt.Sprintf("'%s' is not a date, expected e.g. 2024-01-31", value)
+			}
+		}
+	case metadataTypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Sprintf("'%s' is not true or false", value)
+		}
+	case metadataTypeMultipleChoice:
+		if len(rule.Options) > 0 && !containsFold(rule.Options, value) {
+			return fmt.Sprintf("'%s' is not one of %s", value, strings.Join(rule.Options, ", "))
+		}
+	case metadataTypeEmail:
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Sprintf("'%s' is not an email address", value)
+		}
+	}
+	if rule.Validation != "" && rule.DataType != metadataTypeMultipleChoice {
+		re, err := regexp.Compile(rule.Validation)
+		if err != nil {
+			log.Printf("[WARN] metadata field %s has an invalid validation regex '%s': %s", rule.Name, rule.Validation, err)
+			return ""
+		}
+		if !re.MatchString(value) {
+			if rule.Message != "" {
+				return fmt.Sprintf("'%s' is not valid: %s", value, rule.Message)
+			}
+			return fmt.Sprintf("'%s' does not match %s", value, rule.Validation)
+		}
+	}
+	return ""
+}
+
+// validate returns the problems of values for the template: missing required values, values of unknown fields and
+// values that do not meet a field's type, allowed values or regex. Required metadata with a default is not missing.
+func (r *enrollmentRequirements) validate(values enrollmentValues) []enrollmentProblem {
+	var problems []enrollmentProblem
+	add := func(kind, name, format string, a ...interface{}) {
+		problems = append(problems, enrollmentProblem{Kind: kind, Name: name, Problem: fmt.Sprintf(format, a...)})
+	}
+
+	known := make(map[string]bool)
+	for _, f := range r.Fields {
+		name := f.GetName()
+		known[strings.ToLower(name)] = true
+		value, ok := lookupFold(values.Fields, name)
+		switch {
+		case !ok || value == "":
+			if len(f.Options) > 0 {
+				add(enrollKindField, name, "required, one of %s", strings.Join(f.Options, ", "))
+			} else {
+				add(enrollKindField, name, "required")
+			}
+		case f.GetDataType() == enrollmentFieldTypeMultipleChoice && len(f.Options) > 0 && !containsFold(f.Options, value):
+			add(enrollKindField, name, "'%s' is not one of %s", value, strings.Join(f.Options, ", "))
+		}
+	}
+	for name := range values.Fields {
+		if !known[strings.ToLower(name)] {
+			add(enrollKindField, name, "not an enrollment field of template %s", r.Template)
+		}
+	}
+
+	known = make(map[string]bool)
+	for _, rule := range r.Metadata {
+		known[strings.ToLower(rule.Name)] = true
+		value, ok := lookupFold(values.Metadata, rule.Name)
+		switch {
+		case ok && value != "" && rule.Hidden:
+			add(enrollKindMetadata, rule.Name, "hidden on enrollment with template %s and can not be set", r.Template)
+		case ok && value != "":
+			if problem := checkMetadataValue(rule, value); problem != "" {
+				add(enrollKindMetadata, rule.Name, "%s", problem)
+			}
+		case rule.Required && rule.Default == "":
+			if len(rule.Options) > 0 {
+				add(enrollKindMetadata, rule.Name, "required, one of %s", strings.Join(rule.Options, ", "))
+			} else {
+				add(enrollKindMetadata, rule.Name, "required")
+			}
+		}
+	}
+	for name := range values.Metadata {
+		if !known[strings.ToLower(name)] {
+			add(enrollKindMetadata, name, "no such metadata field")
+		}
+	}
+
+	for _, re := range r.Subject {
+		part := re.GetSubjectPart()
+		value, ok := lookupFold(values.Subject, part)
+		if !ok || re.GetRegex() == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(re.GetRegex())
+		if err != nil {
+			log.Printf("[WARN] template %s has an invalid %s regex '%s': %s", r.Template, part, re.GetRegex(), err)
+			continue
+		}
+		if !compiled.MatchString(value) {
+			if re.GetError() != "" {
+				add(enrollKindSubject, part, "'%s' is not valid: %s", value, re.GetError())
+			} else {
+				add(enrollKindSubject, part, "'%s' does not match %s", value, re.GetRegex())
+			}
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Kind < problems[j].Kind })
+	return problems
+}
+
+// enrollmentProblemsError returns an error listing problems, nil if there are none.
+func enrollmentProblemsError(template string, problems []enrollmentProblem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = "  " + p.String()
+	}
+	return fmt.Errorf("%d value(s) not accepted by template %s:\n%s", len(problems), template, strings.Join(lines, "\n"))
+}
+
+// parseSubjectParts parses a subject such as 'CN=app.example.com,O=Example' into its parts. Commas within a value
+// are escaped as '\,'.
+func parseSubjectParts(subject string) (map[string]string, error) {
+	parts := make(map[string]string)
+	if strings.TrimSpace(subject) == "" {
+		return parts, nil
+	}
+	var rdns []string
+	var current strings.Builder
+	for i := 0; i < len(subject); i++ {
+		switch {
+		case subject[i] == '\\' && i+1 < len(subject) && subject[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case subject[i] == ',':
+			rdns = append(rdns, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(subject[i])
+		}
+	}
+	rdns = append(rdns, current.String())
+	for _, rdn := range rdns {
+		name, value, found := strings.Cut(rdn, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid subject part '%s', expected e.g. CN=app.example.com", strings.TrimSpace(rdn))
+		}
+		parts[strings.ToUpper(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return parts, nil
+}
+
+// parseNameValues parses flags of the form Name=Value.
+func parseNameValues(flag string, values []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(values))
+	for _, v := range values {
+		name, value, found := strings.Cut(v, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --%s '%s', expected Name=Value", flag, v)
+		}
+		parsed[strings.TrimSpace(name)] = value
+	}
+	return parsed, nil
+}
+
+var templatesCheckEnrollmentCmd = &cobra.Command{
+	Use:   "check-enrollment",
+	Short: "Check enrollment values against the requirements of a template.",
+	Long: `Checks the subject, enrollment fields and metadata of an enrollment against a certificate template before it
+is submitted: required enrollment fields and metadata that are missing, values that are not among the allowed
+choices, metadata of the wrong type (integer, date, boolean or email) or not matching its validation regex, and
+subject parts not matching the template's regexes. Exits with status 1 and lists every problem if the values are not
+accepted.`,
+	Example: `kfutil templates check-enrollment --name WebServer --subject 'CN=app.example.com,O=Example' \
+  --field "Server Type=Apache" --metadata Owner=team-web --metadata Environment=prod`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		id, _ := cmd.Flags().GetInt32("id")
+		name, _ := cmd.Flags().GetString("name")
+		subject, _ := cmd.Flags().GetString("subject")
+		fieldFlags, _ := cmd.Flags().GetStringArray("field")
+		metadataFlags, _ := cmd.Flags().GetStringArray("metadata")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+
+		var values enrollmentValues
+		var err error
+		if values.Subject, err = parseSubjectParts(subject); err == nil {
+			if values.Fields, err = parseNameValues("field", fieldFlags); err == nil {
+				values.Metadata, err = parseNameValues("metadata", metadataFlags)
+			}
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err)
+			log.Fatalf("[ERROR] %s", err)
+		}
+		ctx := commandContext(cmd)
+		requirements, rErr := loadEnrollmentRequirements(ctx, initGenClient(), id, name)
+		if rErr != nil {
+			fmt.Printf("[ERROR] %s\n", rErr)
+			log.Fatalf("[ERROR] %s", rErr)
+		}
+		problems := requirements.validate(values)
+		recordResultCount("problems", len(problems))
+		if jsonOut {
+			if problems == nil {
+				problems = []enrollmentProblem{}
+			}
+			output, _ := json.MarshalIndent(problems, "", "  ")
+			fmt.Println(string(output))
+		} else if len(problems) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KIND\tNAME\tPROBLEM")
+			for _, p := range problems {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", p.Kind, p.Name, p.Problem)
+			}
+			w.Flush()
+		}
+		if len(problems) > 0 {
+			printWarning("%d value(s) not accepted by template %s.\n", len(problems), requirements.Template)
+			finishResult(1)
+			os.Exit(1)
+		}
+		if !jsonOut {
+			printInfo("The values meet the requirements of template %s.\n", requirements.Template)
+		}
+	},
+}
+
+func init() {
+	templatesCmd.AddCommand(templatesCheckEnrollmentCmd)
+	templatesCheckEnrollmentCmd.Flags().Int32P("id", "i", 0, "ID of the certificate template.")
+	templatesCheckEnrollmentCmd.Flags().StringP("name", "n", "", "Template name or common name of the certificate template.")
+	templatesCheckEnrollmentCmd.Flags().String("subject", "", "Subject of the enrollment, e.g. 'CN=app.example.com,O=Example'.")
+	templatesCheckEnrollmentCmd.Flags().StringArray("field", []string{}, "Enrollment field value in the form Name=Value. May be repeated.")
+	templatesCheckEnrollmentCmd.Flags().StringArray("metadata", []string{}, "Metadata value in the form Name=Value. May be repeated.")
+	templatesCheckEnrollmentCmd.Flags().Bool("json", false, "Print the problems as JSON.")
+	templatesCheckEnrollmentCmd.MarkFlagsMutuallyExclusive("id", "name")
+}
@@ -0,0 +1,119 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const flagEnvPrefix = "KFUTIL_"
+
+// flagEnvName returns the environment variable that can be used to set a flag, e.g. `--dry-run` is `KFUTIL_DRY_RUN`.
+func flagEnvName(name string) string {
+	return flagEnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// configFlagsKey is the config file section of flag values, e.g. "flags": {"concurrency": "8", "dry-run": "client"}.
+const configFlagsKey = "flags"
+
+// configFlagValues returns the flag values of the flags section of the config file, by flag name. A missing or
+// unreadable config file has none, the commands that need it report it.
+func configFlagValues() map[string]string {
+	data, err := os.ReadFile(defaultConfigPath())
+	if err != nil {
+		return nil
+	}
+	var config struct {
+		Flags map[string]interface{} `json:"flags"`
+	}
+	if json.Unmarshal(data, &config) != nil {
+		return nil
+	}
+	values := make(map[string]string, len(config.Flags))
+	for name, value := range config.Flags {
+		values[name] = fmt.Sprint(value)
+	}
+	return values
+}
+
+// applyFlagOverrides sets every flag that was not given on the command line from its KFUTIL_<FLAG> environment
+// variable or, if that is not set either, from the flags section of the config file. The precedence is command line,
+// then environment, then config file, then the flag's default. Config file values for flags the command does not have
+// are ignored, so one file can hold the flags of several commands.
+func applyFlagOverrides(cmd *cobra.Command) error {
+	var errs []string
+	configValues := configFlagValues()
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		source := flagEnvName(f.Name)
+		value, ok := os.LookupEnv(source)
+		if !ok {
+			source = fmt.Sprintf("%s.%s in %s", configFlagsKey, f.Name, defaultConfigPath())
+			value, ok = configValues[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if err := cmd.Flags().Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid value '%s' for %s: %s", value, source, err))
+			return
+		}
+		log.Printf("[DEBUG] flag --%s set from %s", f.Name, source)
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// rootPersistentPreRun runs before every command.
+func rootPersistentPreRun(cmd *cobra.Command, args []string) {
+	registerEnvSecrets()
+	if err := applyFlagOverrides(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] applying environment variable and config file flag values: %s", err)
+	}
+	reserveStdoutForOutput(cmd)
+	if err := configureOutput(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := startResult(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := enforceReadOnly(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := loadSchemaMap(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := startRecordReplay(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := startHTTPDebug(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	if err := startAPITimeouts(cmd); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	startTracing(cmd, args)
+}
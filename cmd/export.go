@@ -8,7 +8,6 @@ import (
 	"github.com/Keyfactor/keyfactor-go-client/api"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
 	"strconv"
 )
 
@@ -76,7 +75,7 @@ func exportToJSON(out outJson, exportPath string) {
 		fmt.Printf("Error processing JSON object. %s\n", jErr)
 		log.Fatalf("[ERROR]: %s", jErr)
 	}
-	wErr := os.WriteFile(exportPath, mOut, 0666)
+	wErr := writeOutputFile(exportPath, mOut, 0666)
 	if wErr != nil {
 		fmt.Printf("Error writing files to %s: %s\n", exportPath, wErr)
 		log.Fatalf("[ERROR]: %s", wErr)
@@ -389,7 +388,7 @@ func getRoles() []api.CreateSecurityRoleArg {
 func init() {
 	RootCmd.AddCommand(exportCmd)
 
-	exportCmd.Flags().StringVarP(&exportPath, "file", "f", "", "path to JSON output file with exported data")
+	exportCmd.Flags().StringVarP(&exportPath, "file", "f", "", "path to JSON output file with exported data, or an s3://, az:// or gs:// URL to upload it to")
 	exportCmd.MarkFlagRequired("file")
 
 	exportCmd.Flags().BoolVarP(&fAll, "all", "a", false, "export all exportable data to JSON file")
@@ -0,0 +1,177 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// ansibleGroupPrefix is the prefix of the inventory group of each store type.
+const ansibleGroupPrefix = "keyfactor_"
+
+var ansibleInvalidGroupChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// ansibleStore is a certificate store in the keyfactor_stores host var.
+type ansibleStore struct {
+	ID          string   `yaml:"id"`
+	Type        string   `yaml:"type"`
+	Path        string   `yaml:"path"`
+	Container   string   `yaml:"container,omitempty"`
+	Thumbprints []string `yaml:"thumbprints"`
+}
+
+// ansibleGroupName returns the inventory group of a store type, e.g. keyfactor_rfpem for RFPEM.
+func ansibleGroupName(storeType string) string {
+	return ansibleGroupPrefix + ansibleInvalidGroupChars.ReplaceAllString(strings.ToLower(storeType), "_")
+}
+
+// ansibleInventory builds a YAML inventory with a host per client machine and a group per store type. The stores of
+// each host are listed in its keyfactor_stores var.
+func ansibleInventory(stores map[string][]ansibleStore) ([]byte, error) {
+	hosts := make(map[string]interface{})
+	groups := make(map[string]interface{})
+	for machine, machineStores := range stores {
+		sort.Slice(machineStores, func(i, j int) bool {
+			if machineStores[i].Type != machineStores[j].Type {
+				return machineStores[i].Type < machineStores[j].Type
+			}
+			return machineStores[i].Path < machineStores[j].Path
+		})
+		hosts[machine] = map[string]interface{}{"keyfactor_stores": machineStores}
+		for _, s := range machineStores {
+			group := ansibleGroupName(s.Type)
+			if _, ok := groups[group]; !ok {
+				groups[group] = map[string]interface{}{"hosts": make(map[string]interface{})}
+			}
+			groups[group].(map[string]interface{})["hosts"].(map[string]interface{})[machine] = nil
+		}
+	}
+	all := map[string]interface{}{"hosts": hosts}
+	if len(groups) > 0 {
+		all["children"] = groups
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]interface{}{"all": all}); err != nil {
+		return nil, err
+	}
+	enc.Close()
+	return b.Bytes(), nil
+}
+
+var exportAnsibleCmd = &cobra.Command{
+	Use:   "ansible",
+	Short: "Export certificate stores as an Ansible inventory.",
+	Long: `Exports certificate stores and their inventories as an Ansible YAML inventory. Every client machine is a host
+with a keyfactor_stores var listing the path, type and deployed certificate thumbprints of each of its stores. Hosts are
+grouped by store type in groups named keyfactor_<store-type>, e.g. keyfactor_rfpem.`,
+	Example: `kfutil export ansible --store-type RFPEM --out inventory.yml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		storeTypes, _ := cmd.Flags().GetStringSlice("store-type")
+		clients, _ := cmd.Flags().GetStringSlice("client")
+		outpath, _ := cmd.Flags().GetString("out")
+		ctx := commandContext(cmd)
+
+		kfClient, _ := initClient()
+		params := make(map[string]interface{})
+		storesResp, lErr := kfClient.ListCertificateStores(&params)
+		if lErr != nil {
+			fmt.Printf("[ERROR] listing certificate stores: %s\n", lErr)
+			log.Fatalf("[ERROR] listing certificate stores: %s", lErr)
+		}
+
+		wantTypes := make(map[string]bool)
+		for _, st := range storeTypes {
+			wantTypes[strings.ToLower(st)] = true
+		}
+		wantClients := make(map[string]bool)
+		for _, c := range clients {
+			wantClients[strings.ToLower(c)] = true
+		}
+		typeNames := make(map[int]string)
+		stores := make(map[string][]ansibleStore)
+		count := 0
+		for _, s := range *storesResp {
+			if ctx.Err() != nil {
+				break
+			}
+			if len(wantClients) > 0 && !wantClients[strings.ToLower(s.ClientMachine)] {
+				continue
+			}
+			typeName, ok := typeNames[s.CertStoreType]
+			if !ok {
+				st, stErr := kfClient.GetCertificateStoreTypeById(s.CertStoreType)
+				if stErr != nil {
+					fmt.Printf("[ERROR] getting store type %d: %s\n", s.CertStoreType, stErr)
+					log.Fatalf("[ERROR] getting store type %d: %s", s.CertStoreType, stErr)
+				}
+				typeName = st.ShortName
+				typeNames[s.CertStoreType] = typeName
+			}
+			if len(wantTypes) > 0 && !wantTypes[strings.ToLower(typeName)] {
+				continue
+			}
+			var thumbprints []string
+			inventory, iErr := kfClient.GetCertStoreInventory(s.Id)
+			if iErr != nil {
+				printWarning("Unable to get inventory of store %s (%s %s): %s\n", s.Id, s.ClientMachine, s.StorePath, iErr)
+			} else if inventory != nil {
+				thumbprints = inventoryThumbprints(*inventory)
+			}
+			if thumbprints == nil {
+				thumbprints = []string{}
+			}
+			stores[s.ClientMachine] = append(stores[s.ClientMachine], ansibleStore{
+				ID:          s.Id,
+				Type:        typeName,
+				Path:        s.StorePath,
+				Container:   s.ContainerName,
+				Thumbprints: thumbprints,
+			})
+			count++
+		}
+		exitIfInterrupted(ctx, "no inventory was written")
+
+		data, yErr := ansibleInventory(stores)
+		if yErr != nil {
+			fmt.Printf("[ERROR] rendering inventory: %s\n", yErr)
+			log.Fatalf("[ERROR] rendering inventory: %s", yErr)
+		}
+		out, oErr := createOutput(outpath)
+		if oErr != nil {
+			fmt.Printf("[ERROR] writing inventory to %s: %s\n", outpath, oErr)
+			log.Fatalf("[ERROR] writing inventory: %s", oErr)
+		}
+		_, wErr := out.Write(data)
+		if cErr := out.Close(); wErr == nil {
+			wErr = cErr
+		}
+		if wErr != nil {
+			fmt.Printf("[ERROR] writing inventory to %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing inventory: %s", wErr)
+		}
+		printInfo("Exported %d store(s) on %d host(s) to %s\n", count, len(stores), outputName(outpath))
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportAnsibleCmd)
+	exportAnsibleCmd.Flags().StringSlice("store-type", []string{}, "Only export stores of these store types, e.g. RFPEM. May be repeated.")
+	exportAnsibleCmd.Flags().StringSlice("client", []string{}, "Only export stores on these client machines. May be repeated.")
+	exportAnsibleCmd.Flags().String("out", "inventory.yml", "Path to write the inventory to, '-' for stdout. Accepts s3://, az:// and gs:// URLs.")
+}
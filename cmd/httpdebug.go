@@ -0,0 +1,157 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// httpDebugMaxBody is the number of bytes of a request or response body written to the --http-debug file.
+const httpDebugMaxBody = 64 * 1024
+
+// httpDebugSecretHeaders are headers whose values are never written to the --http-debug file.
+var httpDebugSecretHeaders = map[string]bool{"Authorization": true, "Proxy-Authorization": true, "Cookie": true, "Set-Cookie": true}
+
+// apiDebugDumper is an http.RoundTripper that writes every request and response, with secrets redacted, to a file.
+type apiDebugDumper struct {
+	out  io.Writer
+	base http.RoundTripper
+	mu   sync.Mutex
+	seq  int
+}
+
+// redactHeaders returns h as sorted "Name: value" lines with the values of secret headers redacted.
+func redactHeaders(h http.Header) []string {
+	var lines []string
+	for name, values := range h {
+		for _, v := range values {
+			if httpDebugSecretHeaders[http.CanonicalHeaderKey(name)] || fixtureSecretKeyPattern.MatchString(name) {
+				v = redactedValue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", name, v))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// redactURL returns u with the values of secret looking query parameters redacted.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for k := range query {
+		if fixtureSecretKeyPattern.MatchString(k) {
+			query.Set(k, redactedValue)
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	redacted.User = nil
+	return redacted.String()
+}
+
+// redactBody returns a request or response body with secrets redacted. Form bodies, such as OAuth token requests,
+// have secret looking fields redacted, other bodies are redacted like recorded fixtures.
+func redactBody(body []byte, contentType string) []byte {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k := range form {
+				if fixtureSecretKeyPattern.MatchString(k) {
+					form.Set(k, redactedValue)
+				}
+			}
+			return []byte(form.Encode())
+		}
+	}
+	body = redactJSON(body)
+	if len(body) > httpDebugMaxBody {
+		body = append(body[:httpDebugMaxBody:httpDebugMaxBody], []byte(fmt.Sprintf("\n... truncated, %d bytes total", len(body)))...)
+	}
+	return body
+}
+
+func (d *apiDebugDumper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	start := time.Now()
+	resp, err := d.base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	var buf bytes.Buffer
+	d.mu.Lock()
+	d.seq++
+	fmt.Fprintf(&buf, "### %d %s %s %s\n", d.seq, start.UTC().Format(time.RFC3339Nano), req.Method, redactURL(req.URL))
+	d.mu.Unlock()
+	for _, line := range redactHeaders(req.Header) {
+		fmt.Fprintf(&buf, "> %s\n", line)
+	}
+	if len(reqBody) > 0 {
+		fmt.Fprintf(&buf, ">\n%s\n", redactBody(reqBody, req.Header.Get("Content-Type")))
+	}
+	if err != nil {
+		fmt.Fprintf(&buf, "< error after %s: %s\n\n", elapsed.Round(time.Millisecond), err)
+		d.write(buf.Bytes())
+		return resp, err
+	}
+	respBody, rErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	fmt.Fprintf(&buf, "< %s (%s)\n", resp.Status, elapsed.Round(time.Millisecond))
+	for _, line := range redactHeaders(resp.Header) {
+		fmt.Fprintf(&buf, "< %s\n", line)
+	}
+	if len(respBody) > 0 {
+		fmt.Fprintf(&buf, "<\n%s\n", redactBody(respBody, resp.Header.Get("Content-Type")))
+	}
+	buf.WriteString("\n")
+	d.write(buf.Bytes())
+	return resp, rErr
+}
+
+// write appends an interaction to the dump. Interactions are written as they complete so that the dump is complete
+// even if the command exits on an error.
+func (d *apiDebugDumper) write(data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := io.WriteString(d.out, redactSecrets(string(data))); err != nil {
+		log.Printf("[ERROR] writing HTTP debug dump: %s", err)
+	}
+}
+
+// startHTTPDebug installs the dumper of --http-debug. '-' writes to stderr.
+func startHTTPDebug(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("http-debug")
+	if path == "" {
+		return nil
+	}
+	var out io.Writer = os.Stderr
+	if path != stdioPath {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("opening --http-debug file: %s", err)
+		}
+		out = f
+	}
+	http.DefaultTransport = &apiDebugDumper{out: out, base: http.DefaultTransport}
+	log.Printf("[INFO] dumping HTTP requests to %s", path)
+	return nil
+}
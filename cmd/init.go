@@ -0,0 +1,620 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"kfutil/pkg/storetypes"
+)
+
+// Bootstrap plan actions.
+const (
+	bootstrapCreate = "create"
+	bootstrapUpdate = "update"
+	bootstrapKeep   = "keep"
+	bootstrapSkip   = "skip"
+	bootstrapManual = "manual"
+)
+
+// metadataDataTypes maps the data-type names of bootstrap files to Keyfactor metadata field data types.
+var metadataDataTypes = map[string]int32{
+	"string":          1,
+	"integer":         2,
+	"date":            3,
+	"boolean":         4,
+	"multiple-choice": 5,
+	"big-text":        6,
+	"email":           7,
+}
+
+// bootstrapStoreType is a store type of store_types.json by short name, or a store type definition file. In YAML it
+// is either the short name or an object.
+type bootstrapStoreType struct {
+	Name string `yaml:"name,omitempty"`
+	File string `yaml:"file,omitempty"`
+}
+
+func (s *bootstrapStoreType) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s.Name = value.Value
+		return nil
+	}
+	type plain bootstrapStoreType
+	return value.Decode((*plain)(s))
+}
+
+type bootstrapContainer struct {
+	Name string `yaml:"name"`
+}
+
+type bootstrapCollection struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Query       string `yaml:"query"`
+}
+
+type bootstrapMetadataField struct {
+	Name         string `yaml:"name"`
+	Description  string `yaml:"description"`
+	DataType     string `yaml:"data-type"`
+	Hint         string `yaml:"hint,omitempty"`
+	Options      string `yaml:"options,omitempty"`
+	DefaultValue string `yaml:"default,omitempty"`
+}
+
+type bootstrapStore struct {
+	StoreType       string                 `yaml:"store-type"`
+	ClientMachine   string                 `yaml:"client-machine"`
+	StorePath       string                 `yaml:"store-path"`
+	AgentID         string                 `yaml:"agent-id"`
+	Container       string                 `yaml:"container,omitempty"`
+	CreateIfMissing bool                   `yaml:"create-if-missing,omitempty"`
+	Properties      map[string]interface{} `yaml:"properties,omitempty"`
+}
+
+// bootstrapFile is the declarative description of a Keyfactor environment read by `kfutil init`, e.g.
+//
+//	store-types:
+//	  - PEM
+//	  - file: custom_store_type.json
+//	containers:
+//	  - name: Lab
+//	collections:
+//	  - name: Lab Roots
+//	    query: IssuerDN -contains "Lab Root"
+//	metadata-fields:
+//	  - name: Owner
+//	    description: Team that owns the certificate
+//	    data-type: string
+//	stores:
+//	  - store-type: PEM
+//	    client-machine: lab01.example.com
+//	    store-path: /etc/ssl/certs/lab.pem
+//	    agent-id: 4a7e1c2b-...
+//	    container: Lab
+//	    create-if-missing: true
+//	    properties:
+//	      separatePrivateKey: false
+type bootstrapFile struct {
+	StoreTypes     []bootstrapStoreType     `yaml:"store-types"`
+	Containers     []bootstrapContainer     `yaml:"containers"`
+	Collections    []bootstrapCollection    `yaml:"collections"`
+	MetadataFields []bootstrapMetadataField `yaml:"metadata-fields"`
+	Stores         []bootstrapStore         `yaml:"stores"`
+}
+
+// bootstrapStep is one resource of the plan of a bootstrap file.
+type bootstrapStep struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	Detail  string `json:"detail,omitempty"`
+	Problem string `json:"problem,omitempty"`
+	Result  string `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+	apply   func() (string, error)
+}
+
+// bootstrapper plans and applies a bootstrap file.
+type bootstrapper struct {
+	ctx            context.Context
+	kfClient       *api.Client
+	sdkClient      *keyfactor.APIClient
+	path           string
+	updateIfExists bool
+	steps          []*bootstrapStep
+}
+
+func readBootstrapFile(path string) (*bootstrapFile, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	var bf bootstrapFile
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&bf); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+	return &bf, nil
+}
+
+func (b *bootstrapper) add(step *bootstrapStep) {
+	b.steps = append(b.steps, step)
+}
+
+// plan adds the steps of bf in the order they are applied: store types, metadata fields, collections, containers and
+// stores, so the resources stores reference exist when they are created.
+func (b *bootstrapper) plan(bf *bootstrapFile) error {
+	for _, st := range bf.StoreTypes {
+		if err := b.planStoreType(st); err != nil {
+			return err
+		}
+	}
+	if err := b.planMetadataFields(bf.MetadataFields); err != nil {
+		return err
+	}
+	if err := b.planCollections(bf.Collections); err != nil {
+		return err
+	}
+	if err := b.planContainers(bf.Containers); err != nil {
+		return err
+	}
+	return b.planStores(bf.Stores)
+}
+
+func (b *bootstrapper) planStoreType(entry bootstrapStoreType) error {
+	step := &bootstrapStep{Kind: "store-type", Name: entry.Name}
+	b.add(step)
+	var storeType *api.CertificateStoreType
+	var err error
+	if entry.File != "" {
+		step.Name = entry.File
+		storeType, err = readStoreTypeFile(manifestRelativePath(b.path, entry.File))
+	} else {
+		storeType, err = bootstrapStoreTypeDefinition(entry.Name)
+	}
+	if err != nil {
+		step.Action, step.Problem = bootstrapCreate, err.Error()
+		return nil
+	}
+	step.Name = storeType.ShortName
+	existing, err := storetypes.Find(b.ctx, b.kfClient, storeType.ShortName)
+	if err != nil {
+		return err
+	}
+	var diffs []string
+	if existing != nil {
+		diffs = storetypes.Diff(existing, storeType)
+	}
+	switch {
+	case existing == nil:
+		step.Action = bootstrapCreate
+	case len(diffs) == 0:
+		step.Action, step.Detail = bootstrapKeep, fmt.Sprintf("ID %d", existing.StoreType)
+	case b.updateIfExists:
+		step.Action, step.Detail = bootstrapUpdate, fmt.Sprintf("ID %d: %s", existing.StoreType, strings.Join(diffs, ", "))
+	default:
+		step.Action = bootstrapSkip
+		step.Detail = fmt.Sprintf("ID %d differs (%s), use --update-if-exists to update it", existing.StoreType, strings.Join(diffs, ", "))
+	}
+	step.apply = func() (string, error) {
+		resp, outcome, _, err := storetypes.Ensure(b.ctx, b.kfClient, storeType, b.updateIfExists)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s, ID %d", outcome, resp.StoreType), nil
+	}
+	return nil
+}
+
+// bootstrapStoreTypeDefinition returns the create request of a store type of store_types.json.
+func bootstrapStoreTypeDefinition(name string) (*api.CertificateStoreType, error) {
+	config, err := readStoreTypesConfig("")
+	if err != nil {
+		return nil, err
+	}
+	for shortName, def := range config {
+		if !strings.EqualFold(shortName, name) {
+			continue
+		}
+		sConfig, _ := def.(map[string]interface{})
+		return storetypes.FromDefinition(sConfig)
+	}
+	return nil, fmt.Errorf("unknown store type '%s', see `kfutil store-types create --list`", name)
+}
+
+func (b *bootstrapper) planMetadataFields(fields []bootstrapMetadataField) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	existing, err := b.kfClient.GetAllMetadataFields()
+	if err != nil {
+		return fmt.Errorf("listing metadata fields: %s", err)
+	}
+	ids := make(map[string]int)
+	for _, f := range existing {
+		ids[strings.ToLower(f.Name)] = f.Id
+	}
+	for _, field := range fields {
+		field := field
+		step := &bootstrapStep{Kind: "metadata-field", Name: field.Name, Action: bootstrapCreate}
+		b.add(step)
+		if id, ok := ids[strings.ToLower(field.Name)]; ok {
+			step.Action, step.Detail = bootstrapKeep, fmt.Sprintf("ID %d", id)
+			continue
+		}
+		dataType, ok := metadataDataTypes[strings.ToLower(field.DataType)]
+		if !ok {
+			step.Problem = fmt.Sprintf("invalid data-type '%s', must be one of %s", field.DataType, strings.Join(sortedKeys(metadataDataTypes), ", "))
+			continue
+		}
+		step.Detail = field.DataType
+		req := keyfactor.NewKeyfactorApiModelsMetadataFieldMetadataFieldCreateRequest(field.Name, field.Description, dataType)
+		if field.Hint != "" {
+			req.SetHint(field.Hint)
+		}
+		if field.Options != "" {
+			req.SetOptions(field.Options)
+		}
+		if field.DefaultValue != "" {
+			req.SetDefaultValue(field.DefaultValue)
+		}
+		step.apply = func() (string, error) {
+			resp, _, err := b.sdkClient.MetadataFieldApi.MetadataFieldCreateMetadataField(b.ctx).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				MetadataFieldType(*req).Execute()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("created, ID %d", resp.GetId()), nil
+		}
+	}
+	return nil
+}
+
+func (b *bootstrapper) planCollections(collections []bootstrapCollection) error {
+	if len(collections) == 0 {
+		return nil
+	}
+	existing, _, err := b.sdkClient.CertificateCollectionApi.CertificateCollectionGetCollections(b.ctx).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).Execute()
+	if err != nil {
+		return fmt.Errorf("listing collections: %s", err)
+	}
+	ids := make(map[string]int32)
+	for _, c := range existing {
+		ids[strings.ToLower(c.GetName())] = c.GetId()
+	}
+	for _, collection := range collections {
+		step := &bootstrapStep{Kind: "collection", Name: collection.Name, Action: bootstrapCreate}
+		b.add(step)
+		if id, ok := ids[strings.ToLower(collection.Name)]; ok {
+			step.Action, step.Detail = bootstrapKeep, fmt.Sprintf("ID %d", id)
+			continue
+		}
+		if collection.Query == "" {
+			step.Problem = "query is required"
+			continue
+		}
+		step.Detail = collection.Query
+		req := keyfactor.NewKeyfactorApiModelsCertificateCollectionsCertificateCollectionCreateRequest(collection.Name)
+		req.SetQuery(collection.Query)
+		if collection.Description != "" {
+			req.SetDescription(collection.Description)
+		}
+		step.apply = func() (string, error) {
+			resp, _, err := b.sdkClient.CertificateCollectionApi.CertificateCollectionCreateCollection(b.ctx).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				Request(*req).Execute()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("created, ID %d", resp.GetId()), nil
+		}
+	}
+	return nil
+}
+
+// planContainers checks that the containers exist. The Keyfactor API doesn't create containers, missing ones are
+// reported as manual steps.
+func (b *bootstrapper) planContainers(containers []bootstrapContainer) error {
+	if len(containers) == 0 {
+		return nil
+	}
+	ids, err := b.containerIDs()
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		step := &bootstrapStep{Kind: "container", Name: container.Name, Action: bootstrapManual,
+			Detail: "create it in Keyfactor Command, containers can't be created through the API"}
+		if id, ok := ids[strings.ToLower(container.Name)]; ok {
+			step.Action, step.Detail = bootstrapKeep, fmt.Sprintf("ID %d", id)
+		}
+		b.add(step)
+	}
+	return nil
+}
+
+func (b *bootstrapper) containerIDs() (map[string]int, error) {
+	containers, err := b.kfClient.GetStoreContainers()
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %s", err)
+	}
+	ids := make(map[string]int)
+	if containers != nil {
+		for _, c := range *containers {
+			if c.Id != nil {
+				ids[strings.ToLower(c.Name)] = *c.Id
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (b *bootstrapper) planStores(stores []bootstrapStore) error {
+	if len(stores) == 0 {
+		return nil
+	}
+	existing := make(map[string]string)
+	list, err := b.kfClient.ListCertificateStores(nil)
+	if err != nil {
+		return fmt.Errorf("listing certificate stores: %s", err)
+	}
+	for _, s := range *list {
+		existing[strings.ToLower(s.ClientMachine+"|"+s.StorePath)] = s.Id
+	}
+	for _, store := range stores {
+		store := store
+		step := &bootstrapStep{Kind: "store", Name: fmt.Sprintf("%s:%s", store.ClientMachine, store.StorePath), Action: bootstrapCreate,
+			Detail: store.StoreType}
+		b.add(step)
+		if id, ok := existing[strings.ToLower(store.ClientMachine+"|"+store.StorePath)]; ok {
+			step.Action, step.Detail = bootstrapKeep, id
+			continue
+		}
+		var missing []string
+		for field, value := range map[string]string{"store-type": store.StoreType, "client-machine": store.ClientMachine,
+			"store-path": store.StorePath, "agent-id": store.AgentID} {
+			if value == "" {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			step.Problem = fmt.Sprintf("%s required", strings.Join(missing, ", "))
+			continue
+		}
+		step.apply = func() (string, error) { return b.createStore(store) }
+	}
+	return nil
+}
+
+// createStore creates a store. Its store type and container are looked up when it is created, as they may have been
+// created by earlier steps.
+func (b *bootstrapper) createStore(store bootstrapStore) (string, error) {
+	storeType, err := storetypes.Find(b.ctx, b.kfClient, store.StoreType)
+	if err != nil {
+		return "", err
+	}
+	if storeType == nil {
+		return "", fmt.Errorf("store type '%s' does not exist", store.StoreType)
+	}
+	args := &api.CreateStoreFctArgs{
+		ClientMachine:   store.ClientMachine,
+		StorePath:       store.StorePath,
+		CertStoreType:   storeType.StoreType,
+		AgentId:         store.AgentID,
+		CreateIfMissing: &store.CreateIfMissing,
+		Properties:      store.Properties,
+	}
+	if store.Container != "" {
+		ids, err := b.containerIDs()
+		if err != nil {
+			return "", err
+		}
+		id, ok := ids[strings.ToLower(store.Container)]
+		if !ok {
+			return "", fmt.Errorf("container '%s' does not exist", store.Container)
+		}
+		args.ContainerId = &id
+	}
+	resp, err := b.kfClient.CreateStore(args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("created, ID %s", resp.Id), nil
+}
+
+// problems returns the number of steps that can't be applied.
+func (b *bootstrapper) problems() int {
+	count := 0
+	for _, step := range b.steps {
+		if step.Problem != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// apply runs the create and update steps, recording the result of each. It returns the number of failed steps.
+func (b *bootstrapper) apply() int {
+	failed := 0
+	for _, step := range b.steps {
+		if step.apply == nil || (step.Action != bootstrapCreate && step.Action != bootstrapUpdate) {
+			step.Result = step.Action
+			continue
+		}
+		if b.ctx.Err() != nil {
+			step.Result = "not run"
+			continue
+		}
+		result, err := step.apply()
+		if err != nil {
+			log.Printf("[ERROR] %s %s %s: %s", step.Action, step.Kind, step.Name, err)
+			step.Result, step.Error = "failed", err.Error()
+			failed++
+			continue
+		}
+		log.Printf("[INFO] %s %s %s: %s", step.Action, step.Kind, step.Name, result)
+		step.Result = result
+	}
+	return failed
+}
+
+func (b *bootstrapper) printPlan() {
+	symbols := map[string]string{bootstrapCreate: "+", bootstrapUpdate: "~", bootstrapKeep: "=", bootstrapSkip: "-", bootstrapManual: "?"}
+	counts := make(map[string]int)
+	fmt.Println("Plan:")
+	for _, step := range b.steps {
+		counts[step.Action]++
+		symbol := symbols[step.Action]
+		if step.Problem != "" {
+			symbol = "!"
+		}
+		line := fmt.Sprintf("  %s %s %s %s", symbol, step.Action, step.Kind, step.Name)
+		if step.Detail != "" {
+			line += fmt.Sprintf(" (%s)", step.Detail)
+		}
+		fmt.Println(line)
+		if step.Problem != "" {
+			fmt.Printf("      - %s\n", step.Problem)
+		}
+	}
+	fmt.Printf("\n%d to create, %d to update, %d unchanged, %d skipped, %d manual.\n", counts[bootstrapCreate],
+		counts[bootstrapUpdate], counts[bootstrapKeep], counts[bootstrapSkip], counts[bootstrapManual])
+}
+
+func (b *bootstrapper) printResults() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tACTION\tRESULT")
+	for _, step := range b.steps {
+		result := step.Result
+		if step.Error != "" {
+			result = fmt.Sprintf("%s: %s", result, step.Error)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.Kind, step.Name, step.Action, result)
+	}
+	w.Flush()
+}
+
+var bootstrapInitCmd = &cobra.Command{
+	Use:   "init --file <bootstrap file>",
+	Short: "Provision a Keyfactor environment from a bootstrap file.",
+	Long: `Provisions store types, metadata fields, collections and sample certificate stores declared in a YAML
+bootstrap file, and checks that its containers exist. Resources that already exist are left as is, so the bootstrap
+can be re-run. Without --apply the plan is printed and nothing is changed.
+
+Example bootstrap file:
+
+  store-types:
+    - PEM
+    - file: custom_store_type.json
+  containers:
+    - name: Lab
+  collections:
+    - name: Lab Roots
+      query: IssuerDN -contains "Lab Root"
+  metadata-fields:
+    - name: Owner
+      description: Team that owns the certificate
+      data-type: string
+  stores:
+    - store-type: PEM
+      client-machine: lab01.example.com
+      store-path: /etc/ssl/certs/lab.pem
+      agent-id: <orchestrator ID>
+      container: Lab
+      create-if-missing: true`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		path, _ := cmd.Flags().GetString("file")
+		apply, _ := cmd.Flags().GetBool("apply")
+		updateIfExists, _ := cmd.Flags().GetBool("update-if-exists")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		bf, err := readBootstrapFile(path)
+		if err != nil {
+			fmt.Printf("[ERROR] reading bootstrap file %s: %s\n", path, err)
+			log.Fatalf("[ERROR] reading bootstrap file: %s", err)
+		}
+		kfClient, _ := initClient()
+		b := &bootstrapper{ctx: commandContext(cmd), kfClient: kfClient, sdkClient: initGenClient(), path: path,
+			updateIfExists: updateIfExists}
+		if pErr := b.plan(bf); pErr != nil {
+			fmt.Printf("[ERROR] planning bootstrap: %s\n", pErr)
+			log.Fatalf("[ERROR] planning bootstrap: %s", pErr)
+		}
+		failed := 0
+		if !jsonOut {
+			b.printPlan()
+		}
+		if problems := b.problems(); problems > 0 {
+			if jsonOut {
+				printBootstrapJSON(b.steps)
+			}
+			fmt.Printf("[ERROR] %d resource(s) of the bootstrap file are invalid, nothing was changed\n", problems)
+			log.Fatalf("[ERROR] %d invalid bootstrap resource(s)", problems)
+		}
+		if apply {
+			if !jsonOut {
+				fmt.Println()
+			}
+			failed = b.apply()
+			if !jsonOut {
+				b.printResults()
+			}
+		} else if !jsonOut {
+			printInfo("\nRun with --apply to make these changes.\n")
+		}
+		if jsonOut {
+			printBootstrapJSON(b.steps)
+		}
+		exitIfInterrupted(b.ctx, "the bootstrap was only partly applied")
+		if failed > 0 {
+			fmt.Printf("[ERROR] %d resource(s) could not be provisioned\n", failed)
+			log.Printf("[ERROR] %d resource(s) could not be provisioned", failed)
+			os.Exit(1)
+		}
+	},
+}
+
+func printBootstrapJSON(steps []*bootstrapStep) {
+	out, _ := json.MarshalIndent(steps, "", "  ")
+	fmt.Println(string(out))
+}
+
+func sortedKeys(m map[string]int32) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	RootCmd.AddCommand(bootstrapInitCmd)
+	bootstrapInitCmd.Flags().StringP("file", "f", "", "YAML bootstrap file describing the environment.")
+	bootstrapInitCmd.Flags().Bool("apply", false, "Make the planned changes. Without it the plan is only printed.")
+	bootstrapInitCmd.Flags().Bool("update-if-exists", false, "Update store types that exist with a different definition.")
+	bootstrapInitCmd.Flags().Bool("json", false, "Print the plan, and the per-resource results with --apply, as JSON.")
+	bootstrapInitCmd.MarkFlagRequired("file")
+}
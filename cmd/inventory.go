@@ -559,7 +559,7 @@ var inventoryShowCmd = &cobra.Command{
 		for _, cStore := range *stResp {
 			inv, err := kfClient.GetCertStoreInventory(cStore.Id)
 			if err != nil {
-				fmt.Printf("Error, unable to retrieve certificate store inventory from %s: %s\n", cStore, err)
+				fmt.Printf("Error, unable to retrieve certificate store inventory from %s: %s\n", cStore.Id, err)
 				log.Printf("[ERROR]  %s", err)
 			}
 			invData := make(map[string]interface{})
@@ -0,0 +1,198 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic             = 0xFEEDFEED
+	jceksMagic           = 0xCECECECE
+	jksVersion           = 2
+	jksTagPrivateKey     = 1
+	jksTagTrustedCert    = 2
+	jceksTagSecretKey    = 3
+	jksDefaultPassword   = "changeit"
+	jksIntegrityWhitener = "Mighty Aphrodite"
+)
+
+// jksTrustedCert is a trusted certificate entry of a Java keystore.
+type jksTrustedCert struct {
+	Alias string
+	Cert  *x509.Certificate
+}
+
+// jksTrustedCertEntries returns an entry per certificate, aliased by CN as in Java keystore stores. Aliases are made
+// unique with a numeric suffix.
+func jksTrustedCertEntries(certs []*x509.Certificate) []jksTrustedCert {
+	used := make(map[string]bool)
+	entries := make([]jksTrustedCert, 0, len(certs))
+	for _, c := range certs {
+		base := javaAliasFromCN(c.Subject.CommonName, certThumbprint(c))
+		alias := base
+		for i := 2; used[alias]; i++ {
+			alias = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[alias] = true
+		entries = append(entries, jksTrustedCert{Alias: alias, Cert: c})
+	}
+	return entries
+}
+
+// encodeJKS returns a JKS keystore holding the trusted certificate entries, protected by password. JKS stores
+// certificates in the clear, the password only protects the integrity of the keystore.
+func encodeJKS(entries []jksTrustedCert, password string, created time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	writeUTF := func(s string) error {
+		// Java's modified UTF-8 is UTF-8 for the characters of keystore aliases and certificate types.
+		if len(s) > 0xFFFF {
+			return fmt.Errorf("'%s' is too long", s)
+		}
+		binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+		return nil
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(jksMagic))
+	binary.Write(&buf, binary.BigEndian, uint32(jksVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(entries)))
+	for _, e := range entries {
+		binary.Write(&buf, binary.BigEndian, uint32(jksTagTrustedCert))
+		if err := writeUTF(e.Alias); err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, created.UnixMilli())
+		writeUTF("X.509")
+		binary.Write(&buf, binary.BigEndian, uint32(len(e.Cert.Raw)))
+		buf.Write(e.Cert.Raw)
+	}
+
+	digest := sha1.New()
+	for _, r := range utf16.Encode([]rune(password)) {
+		digest.Write([]byte{byte(r >> 8), byte(r)})
+	}
+	digest.Write([]byte(jksIntegrityWhitener))
+	digest.Write(buf.Bytes())
+	buf.Write(digest.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+// isJKSData reports whether data starts like a JKS or JCEKS keystore.
+func isJKSData(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(data)
+	return magic == jksMagic || magic == jceksMagic
+}
+
+// decodeJKS returns the certificates of a JKS or JCEKS keystore with the alias of their entry. The certificate chains
+// of private key entries are returned, their keys are not. Certificates are stored in the clear, so no password is
+// needed and the integrity of the keystore is not verified.
+func decodeJKS(data []byte) ([]jksTrustedCert, error) {
+	r := bytes.NewReader(data)
+	var header struct {
+		Magic, Version, Count uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("reading keystore header: %s", err)
+	}
+	if header.Magic != jksMagic && header.Magic != jceksMagic {
+		return nil, errors.New("not a JKS or JCEKS keystore")
+	}
+	if header.Version != 1 && header.Version != jksVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", header.Version)
+	}
+	readBytes := func(n int) ([]byte, error) {
+		if n > r.Len() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	readUTF := func() (string, error) {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return "", err
+		}
+		b, err := readBytes(int(n))
+		return string(b), err
+	}
+	readCert := func() (*x509.Certificate, error) {
+		if header.Version == jksVersion {
+			if _, err := readUTF(); err != nil {
+				return nil, err
+			}
+		}
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		der, err := readBytes(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParseCertificate(der)
+	}
+
+	var entries []jksTrustedCert
+	for i := uint32(0); i < header.Count; i++ {
+		var tag uint32
+		if err := binary.Read(r, binary.BigEndian, &tag); err != nil {
+			return nil, fmt.Errorf("reading entry %d: %s", i+1, err)
+		}
+		alias, err := readUTF()
+		if err != nil {
+			return nil, fmt.Errorf("reading entry %d: %s", i+1, err)
+		}
+		var created int64
+		if err := binary.Read(r, binary.BigEndian, &created); err != nil {
+			return nil, fmt.Errorf("reading entry %s: %s", alias, err)
+		}
+		switch tag {
+		case jksTagTrustedCert:
+			cert, cErr := readCert()
+			if cErr != nil {
+				return nil, fmt.Errorf("reading certificate %s: %s", alias, cErr)
+			}
+			entries = append(entries, jksTrustedCert{Alias: alias, Cert: cert})
+		case jksTagPrivateKey:
+			var keyLen, chainLen uint32
+			if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+				return nil, fmt.Errorf("reading key %s: %s", alias, err)
+			}
+			if _, err := readBytes(int(keyLen)); err != nil {
+				return nil, fmt.Errorf("reading key %s: %s", alias, err)
+			}
+			if err := binary.Read(r, binary.BigEndian, &chainLen); err != nil {
+				return nil, fmt.Errorf("reading chain of %s: %s", alias, err)
+			}
+			for c := uint32(0); c < chainLen; c++ {
+				cert, cErr := readCert()
+				if cErr != nil {
+					return nil, fmt.Errorf("reading chain of %s: %s", alias, cErr)
+				}
+				entries = append(entries, jksTrustedCert{Alias: alias, Cert: cert})
+			}
+		case jceksTagSecretKey:
+			// Secret keys are serialized Java objects, the entries after one can't be found.
+			return entries, fmt.Errorf("secret key entry %s is not supported, %d entries were not read", alias, header.Count-i)
+		default:
+			return nil, fmt.Errorf("unknown entry type %d of %s", tag, alias)
+		}
+	}
+	return entries, nil
+}
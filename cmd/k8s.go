@@ -0,0 +1,524 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultTrustBundleKey = "ca-bundle.crt"
+	k8sFieldManager       = "kfutil"
+	k8sManagedByLabel     = "app.kubernetes.io/managed-by"
+	// k8sThumbprintsAnnotation lists the thumbprints of the certificates in an exported bundle.
+	k8sThumbprintsAnnotation = "kfutil.keyfactor.com/thumbprints"
+)
+
+// trustBundleCert is a certificate of an exported trust bundle.
+type trustBundleCert struct {
+	Thumbprint string
+	Subject    string
+	Cert       *x509.Certificate
+}
+
+// fetchTrustBundleCerts downloads certificates from Keyfactor by thumbprint, or all certificates of a collection.
+func fetchTrustBundleCerts(ctx context.Context, sdkClient *keyfactor.APIClient, thumbprints []string, collectionID int) ([]trustBundleCert, error) {
+	var responses []keyfactor.ModelsCertificateRetrievalResponse
+	if collectionID > 0 {
+		certs, err := queryCollectionCertificates(ctx, sdkClient, collectionID, defaultCollectionPaging)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, certs...)
+	}
+	for _, tp := range thumbprints {
+		certs, _, err := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqQueryString(fmt.Sprintf(`Thumbprint -eq "%s"`, tp)).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("looking up certificate %s: %s", tp, err)
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("certificate %s not found in Keyfactor", tp)
+		}
+		responses = append(responses, certs[0])
+	}
+
+	seen := make(map[string]bool)
+	var bundle []trustBundleCert
+	for _, r := range responses {
+		der, err := base64.StdEncoding.DecodeString(r.GetContentBytes())
+		if err != nil || len(der) == 0 {
+			return nil, fmt.Errorf("certificate %s has no content", r.GetThumbprint())
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate %s: %s", r.GetThumbprint(), err)
+		}
+		tp := certThumbprint(cert)
+		if seen[tp] {
+			continue
+		}
+		seen[tp] = true
+		bundle = append(bundle, trustBundleCert{Thumbprint: tp, Subject: cert.Subject.String(), Cert: cert})
+	}
+	// A stable order keeps the bundle unchanged between runs with the same roots.
+	sort.Slice(bundle, func(i, j int) bool {
+		if bundle[i].Subject != bundle[j].Subject {
+			return bundle[i].Subject < bundle[j].Subject
+		}
+		return bundle[i].Thumbprint < bundle[j].Thumbprint
+	})
+	return bundle, nil
+}
+
+// trustBundlePEM encodes a bundle as PEM with a comment naming each certificate.
+func trustBundlePEM(bundle []trustBundleCert) string {
+	var b bytes.Buffer
+	for _, c := range bundle {
+		fmt.Fprintf(&b, "# %s\n# SHA1 %s\n", c.Subject, c.Thumbprint)
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+	}
+	return b.String()
+}
+
+// k8sTrustObject builds a ConfigMap or Secret holding the bundle under key.
+func k8sTrustObject(kind string, namespace string, name string, key string, bundle []trustBundleCert) map[string]interface{} {
+	thumbprints := make([]string, 0, len(bundle))
+	for _, c := range bundle {
+		thumbprints = append(thumbprints, c.Thumbprint)
+	}
+	obj := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   namespace,
+			"labels":      map[string]string{k8sManagedByLabel: k8sFieldManager},
+			"annotations": map[string]string{k8sThumbprintsAnnotation: strings.Join(thumbprints, ",")},
+		},
+	}
+	content := trustBundlePEM(bundle)
+	if kind == "Secret" {
+		obj["type"] = "Opaque"
+		obj["data"] = map[string]string{key: base64.StdEncoding.EncodeToString([]byte(content))}
+	} else {
+		obj["data"] = map[string]string{key: content}
+	}
+	return obj
+}
+
+// renderK8sYAML renders an object as a YAML manifest, with PEM data as literal blocks.
+func renderK8sYAML(obj map[string]interface{}) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(obj); err != nil {
+		return nil, err
+	}
+	var literal func(n *yaml.Node)
+	literal = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "\n") {
+			n.Style = yaml.LiteralStyle
+		}
+		for _, c := range n.Content {
+			literal(c)
+		}
+	}
+	literal(&node)
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	enc.Close()
+	return b.Bytes(), nil
+}
+
+// kubeconfig is the subset of a kubeconfig file used to reach a cluster.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string          `yaml:"token"`
+			TokenFile             string          `yaml:"tokenFile"`
+			ClientCertificate     string          `yaml:"client-certificate"`
+			ClientCertificateData string          `yaml:"client-certificate-data"`
+			ClientKey             string          `yaml:"client-key"`
+			ClientKeyData         string          `yaml:"client-key-data"`
+			Exec                  *kubeconfigExec `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// k8sClient calls the Kubernetes API of a kubeconfig context.
+type k8sClient struct {
+	server    string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+// kubeconfigData returns the contents of a kubeconfig *-data field or the file its path field points to.
+func kubeconfigData(data string, path string, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return os.ReadFile(path)
+}
+
+// newK8sClient builds a client for a context of the kubeconfig at path, the current context if contextName is empty.
+// Token, client certificate and exec credential plugin credentials are supported.
+func newK8sClient(path string, contextName string) (*k8sClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading kubeconfig: %s", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig %s: %s", path, err)
+	}
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+	c := &k8sClient{namespace: "default"}
+	var clusterName, userName string
+	for _, ctx := range kc.Contexts {
+		if ctx.Name == contextName {
+			clusterName, userName = ctx.Context.Cluster, ctx.Context.User
+			if ctx.Context.Namespace != "" {
+				c.namespace = ctx.Context.Namespace
+			}
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("context '%s' not found in kubeconfig %s", contextName, path)
+	}
+	dir := filepath.Dir(path)
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	var cluster execCluster
+	for _, cl := range kc.Clusters {
+		if cl.Name != clusterName {
+			continue
+		}
+		c.server = strings.TrimSuffix(cl.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = cl.Cluster.InsecureSkipTLSVerify
+		ca, err := kubeconfigData(cl.Cluster.CertificateAuthorityData, cl.Cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading certificate authority of cluster %s: %s", clusterName, err)
+		}
+		cluster = execCluster{Server: cl.Cluster.Server, CertificateAuthorityData: ca, InsecureSkipTLSVerify: cl.Cluster.InsecureSkipTLSVerify}
+		if len(ca) > 0 {
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(ca)
+			tlsConfig.RootCAs = pool
+		}
+	}
+	if c.server == "" {
+		return nil, fmt.Errorf("cluster '%s' not found in kubeconfig %s", clusterName, path)
+	}
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil {
+			cred, err := runExecCredentialPlugin(u.User.Exec, dir, &cluster)
+			if err != nil {
+				return nil, fmt.Errorf("getting credentials of user %s: %s", userName, err)
+			}
+			c.token = cred.Status.Token
+			if cred.Status.ClientCertificateData != "" && cred.Status.ClientKeyData != "" {
+				pair, err := tls.X509KeyPair([]byte(cred.Status.ClientCertificateData), []byte(cred.Status.ClientKeyData))
+				if err != nil {
+					return nil, fmt.Errorf("loading client certificate of user %s: %s", userName, err)
+				}
+				tlsConfig.Certificates = []tls.Certificate{pair}
+			}
+			continue
+		}
+		c.token = u.User.Token
+		if c.token == "" && u.User.TokenFile != "" {
+			token, err := kubeconfigData("", u.User.TokenFile, dir)
+			if err != nil {
+				return nil, fmt.Errorf("reading token of user %s: %s", userName, err)
+			}
+			c.token = strings.TrimSpace(string(token))
+		}
+		certPEM, err := kubeconfigData(u.User.ClientCertificateData, u.User.ClientCertificate, dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading client certificate of user %s: %s", userName, err)
+		}
+		keyPEM, err := kubeconfigData(u.User.ClientKeyData, u.User.ClientKey, dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading client key of user %s: %s", userName, err)
+		}
+		if len(certPEM) > 0 && len(keyPEM) > 0 {
+			pair, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate of user %s: %s", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+	c.http = &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return c, nil
+}
+
+// k8sObjectPath returns the API path of a ConfigMap, Secret or trust-manager Bundle.
+func k8sObjectPath(obj map[string]interface{}) string {
+	meta := obj["metadata"].(map[string]interface{})
+	name := url.PathEscape(meta["name"].(string))
+	switch obj["kind"] {
+	case trustManagerBundleKind:
+		// Bundles are cluster scoped.
+		return fmt.Sprintf("/apis/%s/bundles/%s", trustManagerAPIVersion, name)
+	case "Secret":
+		return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", url.PathEscape(meta["namespace"].(string)), name)
+	default:
+		return fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", url.PathEscape(meta["namespace"].(string)), name)
+	}
+}
+
+// apply creates or updates an object with server-side apply.
+func (c *k8sClient) apply(obj map[string]interface{}) error {
+	target := fmt.Sprintf("%s%s?fieldManager=%s&force=true", c.server, k8sObjectPath(obj), k8sFieldManager)
+	body, _ := json.Marshal(obj)
+	req, err := http.NewRequest(http.MethodPatch, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/apply-patch+yaml")
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &status) == nil && status.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, status.Message)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// defaultKubeconfigPath returns $KUBECONFIG (its first entry) or ~/.kube/config.
+func defaultKubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".kube", "config")
+}
+
+var k8sCmd = &cobra.Command{
+	Use:   "k8s",
+	Short: "Kubernetes integrations.",
+	Long:  `Utilities to keep Kubernetes clusters in sync with Keyfactor.`,
+}
+
+// addTrustSourceFlags adds the flags read by trustBundleFromFlags.
+func addTrustSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("certs-file", "", "Root of trust certs file listing the roots to export, in the format of 'stores rot generate-template --type certs'.")
+	cmd.Flags().Int("collection-id", 0, "Export all certificates of the Keyfactor collection with this ID.")
+}
+
+// trustBundleFromFlags downloads the certificates selected by --certs-file and --collection-id.
+func trustBundleFromFlags(cmd *cobra.Command) []trustBundleCert {
+	certsFile, _ := cmd.Flags().GetString("certs-file")
+	collectionID, _ := cmd.Flags().GetInt("collection-id")
+	if certsFile == "" && collectionID == 0 {
+		fmt.Println("[ERROR] one of --certs-file or --collection-id is required")
+		log.Fatalf("[ERROR] no trust bundle source given")
+	}
+	var thumbprints []string
+	if certsFile != "" {
+		kfClient, _ := initClient()
+		certs, err := readCertsFile(certsFile, kfClient)
+		if err != nil {
+			fmt.Printf("[ERROR] reading certs file %s: %s\n", certsFile, err)
+			log.Fatalf("[ERROR] reading certs file: %s", err)
+		}
+		for tp := range certs {
+			thumbprints = append(thumbprints, tp)
+		}
+	}
+	bundle, err := fetchTrustBundleCerts(commandContext(cmd), initGenClient(), thumbprints, collectionID)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		log.Fatalf("[ERROR] building trust bundle: %s", err)
+	}
+	if len(bundle) == 0 {
+		fmt.Println("[ERROR] no certificates found for the trust bundle")
+		log.Fatalf("[ERROR] empty trust bundle")
+	}
+	return bundle
+}
+
+// addK8sPublishFlags adds the flags read by publishK8sObject.
+func addK8sPublishFlags(cmd *cobra.Command) {
+	cmd.Flags().String("outpath", stdioPath, "Path to write the manifest to, '-' for stdout. Accepts s3://, az:// and gs:// URLs.")
+	cmd.Flags().Bool("apply", false, "Apply the object to the cluster instead of writing a manifest.")
+	cmd.Flags().String("kubeconfig", "", "Path to the kubeconfig used by --apply. Defaults to $KUBECONFIG or ~/.kube/config.")
+	cmd.Flags().String("context", "", "Kubeconfig context used by --apply. Defaults to the current context.")
+	cmd.MarkFlagsMutuallyExclusive("apply", "outpath")
+}
+
+// k8sClientFromFlags returns the client of --kubeconfig and --context, or nil without --apply.
+func k8sClientFromFlags(cmd *cobra.Command) *k8sClient {
+	if apply, _ := cmd.Flags().GetBool("apply"); !apply {
+		return nil
+	}
+	kubeconfigPath, _ := cmd.Flags().GetString("kubeconfig")
+	kubeContext, _ := cmd.Flags().GetString("context")
+	if kubeconfigPath == "" {
+		kubeconfigPath = defaultKubeconfigPath()
+	}
+	k8s, err := newK8sClient(kubeconfigPath, kubeContext)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	return k8s
+}
+
+// publishK8sObject applies obj with k8s, or writes it as a YAML manifest to --outpath if k8s is nil. desc names the
+// object in status messages.
+func publishK8sObject(cmd *cobra.Command, k8s *k8sClient, obj map[string]interface{}, desc string) {
+	if k8s != nil {
+		if aErr := k8s.apply(obj); aErr != nil {
+			fmt.Printf("[ERROR] applying %s: %s\n", desc, aErr)
+			log.Fatalf("[ERROR] applying %s: %s", desc, aErr)
+		}
+		printInfo("Applied %s to %s.\n", desc, k8s.server)
+		return
+	}
+	outpath, _ := cmd.Flags().GetString("outpath")
+	manifest, err := renderK8sYAML(obj)
+	if err != nil {
+		fmt.Printf("[ERROR] rendering manifest: %s\n", err)
+		log.Fatalf("[ERROR] rendering manifest: %s", err)
+	}
+	out, err := createOutput(outpath)
+	if err != nil {
+		fmt.Printf("[ERROR] writing manifest to %s: %s\n", outpath, err)
+		log.Fatalf("[ERROR] writing manifest: %s", err)
+	}
+	out.Write(manifest)
+	if cErr := out.Close(); cErr != nil {
+		fmt.Printf("[ERROR] writing manifest to %s: %s\n", outpath, cErr)
+		log.Fatalf("[ERROR] writing manifest: %s", cErr)
+	}
+	printInfo("%s written to %s\n", desc, outputName(outpath))
+}
+
+// k8sNamespace returns --namespace, else the namespace of the kubeconfig context, else "default".
+func k8sNamespace(cmd *cobra.Command, k8s *k8sClient) string {
+	namespace, _ := cmd.Flags().GetString("namespace")
+	if namespace == "" && k8s != nil {
+		namespace = k8s.namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	return namespace
+}
+
+var k8sExportTrustCmd = &cobra.Command{
+	Use:   "export-trust",
+	Short: "Export the trusted roots to a Kubernetes ConfigMap or Secret.",
+	Long: `Renders a trust bundle of the roots listed in a root of trust certs file (the --add-certs input of
+'stores rot reconcile') or of all certificates in a Keyfactor collection into a ConfigMap or Secret.
+
+The manifest is written to --outpath (stdout by default) for use with kubectl or GitOps, or applied directly to the
+cluster of the current kubeconfig context with --apply. Applying uses server-side apply, so the object is created or
+updated in place. Only token and client certificate kubeconfig credentials are supported.`,
+	Example: `kfutil k8s export-trust --certs-file roots.csv --namespace cert-manager --configmap ca-bundle --apply`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		configMap, _ := cmd.Flags().GetString("configmap")
+		secret, _ := cmd.Flags().GetString("secret")
+		key, _ := cmd.Flags().GetString("key")
+		kind, name := "ConfigMap", configMap
+		if secret != "" {
+			kind, name = "Secret", secret
+		}
+		if name == "" {
+			fmt.Println("[ERROR] one of --configmap or --secret is required")
+			log.Fatalf("[ERROR] no ConfigMap or Secret name given")
+		}
+
+		bundle := trustBundleFromFlags(cmd)
+		k8s := k8sClientFromFlags(cmd)
+		namespace := k8sNamespace(cmd, k8s)
+		publishK8sObject(cmd, k8s, k8sTrustObject(kind, namespace, name, key, bundle),
+			fmt.Sprintf("%s %s/%s with %d certificate(s)", kind, namespace, name, len(bundle)))
+	},
+}
+
+func init() {
+	addTrustSourceFlags(k8sExportTrustCmd)
+	k8sExportTrustCmd.Flags().String("namespace", "", "Namespace of the ConfigMap or Secret. Defaults to the namespace of the kubeconfig context with --apply, otherwise 'default'.")
+	k8sExportTrustCmd.Flags().String("configmap", "", "Name of the ConfigMap to export the bundle to.")
+	k8sExportTrustCmd.Flags().String("secret", "", "Name of the Secret to export the bundle to.")
+	k8sExportTrustCmd.Flags().String("key", defaultTrustBundleKey, "Data key of the PEM bundle in the ConfigMap or Secret.")
+	addK8sPublishFlags(k8sExportTrustCmd)
+	k8sExportTrustCmd.MarkFlagsMutuallyExclusive("configmap", "secret")
+	k8sCmd.AddCommand(k8sExportTrustCmd)
+	RootCmd.AddCommand(k8sCmd)
+}
@@ -0,0 +1,143 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	trustManagerAPIVersion = "trust.cert-manager.io/v1alpha1"
+	trustManagerBundleKind = "Bundle"
+
+	certManagerFormatBundle   = "bundle"
+	certManagerFormatCASecret = "ca-secret"
+	// certManagerCAKey is the key cert-manager and its issuers read CA certificates from.
+	certManagerCAKey = "ca.crt"
+)
+
+// trustManagerBundle builds a trust-manager Bundle distributing the roots to a ConfigMap or Secret, named like the
+// Bundle, in every namespace matched by namespaceLabels.
+func trustManagerBundle(name string, targetKind string, targetKey string, namespaceLabels map[string]string, includeDefaultCAs bool, bundle []trustBundleCert) map[string]interface{} {
+	thumbprints := make([]string, 0, len(bundle))
+	for _, c := range bundle {
+		thumbprints = append(thumbprints, c.Thumbprint)
+	}
+	sources := []interface{}{map[string]interface{}{"inLine": trustBundlePEM(bundle)}}
+	if includeDefaultCAs {
+		sources = append(sources, map[string]interface{}{"useDefaultCAs": true})
+	}
+	target := map[string]interface{}{
+		targetKind: map[string]string{"key": targetKey},
+	}
+	if len(namespaceLabels) > 0 {
+		target["namespaceSelector"] = map[string]interface{}{"matchLabels": namespaceLabels}
+	}
+	return map[string]interface{}{
+		"apiVersion": trustManagerAPIVersion,
+		"kind":       trustManagerBundleKind,
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"labels":      map[string]string{k8sManagedByLabel: k8sFieldManager},
+			"annotations": map[string]string{k8sThumbprintsAnnotation: strings.Join(thumbprints, ",")},
+		},
+		"spec": map[string]interface{}{
+			"sources": sources,
+			"target":  target,
+		},
+	}
+}
+
+// parseLabelSelector parses key=value pairs separated by commas.
+func parseLabelSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if selector == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(selector, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label selector '%s', expected key=value[,key=value]", selector)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+var k8sExportCertManagerCmd = &cobra.Command{
+	Use:   "export-cert-manager",
+	Short: "Export the trusted roots for cert-manager and trust-manager.",
+	Long: `Exports the roots of a root of trust certs file or a Keyfactor collection for cert-manager:
+
+  bundle     a trust-manager Bundle with the roots inline. trust-manager distributes them to a ConfigMap or Secret
+             named like the Bundle in every namespace matching --namespace-selector.
+  ca-secret  a Secret holding the roots as ca.crt, e.g. for the caBundleSecretRef of a Vault issuer or to trust a
+             private ACME server. The Secret goes to the cert-manager namespace unless --namespace is given.
+
+Roots exported from Keyfactor do not include private keys, so they cannot back a CA ClusterIssuer. The manifest is
+written to --outpath or applied with --apply, see 'k8s export-trust'.`,
+	Example: `kfutil k8s export-cert-manager --collection-id 3 --name keyfactor-roots --namespace-selector trust=keyfactor --apply`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		format, _ := cmd.Flags().GetString("format")
+		name, _ := cmd.Flags().GetString("name")
+		target, _ := cmd.Flags().GetString("target")
+		targetKey, _ := cmd.Flags().GetString("target-key")
+		selector, _ := cmd.Flags().GetString("namespace-selector")
+		includeDefaultCAs, _ := cmd.Flags().GetBool("include-default-cas")
+
+		if format != certManagerFormatBundle && format != certManagerFormatCASecret {
+			fmt.Printf("[ERROR] invalid format '%s', must be one of %s or %s\n", format, certManagerFormatBundle, certManagerFormatCASecret)
+			log.Fatalf("[ERROR] invalid format: %s", format)
+		}
+		if target != "configmap" && target != "secret" {
+			fmt.Printf("[ERROR] invalid target '%s', must be one of configmap or secret\n", target)
+			log.Fatalf("[ERROR] invalid target: %s", target)
+		}
+		labels, lErr := parseLabelSelector(selector)
+		if lErr != nil {
+			fmt.Printf("[ERROR] %s\n", lErr)
+			log.Fatalf("[ERROR] %s", lErr)
+		}
+
+		bundle := trustBundleFromFlags(cmd)
+		k8s := k8sClientFromFlags(cmd)
+		if format == certManagerFormatBundle {
+			targetKind := "configMap"
+			if target == "secret" {
+				targetKind = "secret"
+			}
+			publishK8sObject(cmd, k8s, trustManagerBundle(name, targetKind, targetKey, labels, includeDefaultCAs, bundle),
+				fmt.Sprintf("Bundle %s with %d certificate(s)", name, len(bundle)))
+			return
+		}
+		namespace, _ := cmd.Flags().GetString("namespace")
+		if namespace == "" {
+			namespace = "cert-manager"
+		}
+		publishK8sObject(cmd, k8s, k8sTrustObject("Secret", namespace, name, certManagerCAKey, bundle),
+			fmt.Sprintf("Secret %s/%s with %d certificate(s)", namespace, name, len(bundle)))
+	},
+}
+
+func init() {
+	addTrustSourceFlags(k8sExportCertManagerCmd)
+	k8sExportCertManagerCmd.Flags().String("format", certManagerFormatBundle, "What to export, one of bundle (trust-manager Bundle) or ca-secret.")
+	k8sExportCertManagerCmd.Flags().String("name", "keyfactor-roots", "Name of the Bundle or Secret.")
+	k8sExportCertManagerCmd.Flags().String("namespace", "", "Namespace of the ca-secret Secret. Defaults to cert-manager.")
+	k8sExportCertManagerCmd.Flags().String("target", "configmap", "Kind of object the Bundle is distributed as, one of configmap or secret.")
+	k8sExportCertManagerCmd.Flags().String("target-key", defaultTrustBundleKey, "Data key of the PEM bundle in the objects created by the Bundle.")
+	k8sExportCertManagerCmd.Flags().String("namespace-selector", "", "Only distribute the Bundle to namespaces with these labels, e.g. trust=keyfactor.")
+	k8sExportCertManagerCmd.Flags().Bool("include-default-cas", false, "Add trust-manager's default public CAs to the Bundle.")
+	addK8sPublishFlags(k8sExportCertManagerCmd)
+	k8sCmd.AddCommand(k8sExportCertManagerCmd)
+}
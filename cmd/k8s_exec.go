@@ -0,0 +1,122 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// execCredentialAPIVersions are the versions of the client.authentication.k8s.io exec credential protocol supported
+// for kubeconfig users with an exec credential plugin, such as aws eks get-token, gke-gcloud-auth-plugin or kubelogin.
+var execCredentialAPIVersions = map[string]bool{
+	"client.authentication.k8s.io/v1":      true,
+	"client.authentication.k8s.io/v1beta1": true,
+}
+
+// kubeconfigExec is the exec credential plugin of a kubeconfig user.
+type kubeconfigExec struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+	Env        []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+	InstallHint        string `yaml:"installHint"`
+	ProvideClusterInfo bool   `yaml:"provideClusterInfo"`
+	InteractiveMode    string `yaml:"interactiveMode"`
+}
+
+// execCluster is the cluster passed to a plugin with provideClusterInfo.
+type execCluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify,omitempty"`
+}
+
+// execCredential is the ExecCredential object passed to a plugin in KUBERNETES_EXEC_INFO and returned on its stdout.
+type execCredential struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Cluster     *execCluster `json:"cluster,omitempty"`
+		Interactive bool         `json:"interactive"`
+	} `json:"spec"`
+	Status *struct {
+		Token                 string `json:"token"`
+		ClientCertificateData string `json:"clientCertificateData"`
+		ClientKeyData         string `json:"clientKeyData"`
+	} `json:"status,omitempty"`
+}
+
+// runExecCredentialPlugin runs the exec credential plugin of a kubeconfig user and returns the credential it prints.
+// Relative commands with a path separator are relative to dir, the directory of the kubeconfig. The plugin runs
+// without stdin, so plugins that must prompt for input fail. The credential is used as is for the command, which
+// finishes long before a typical credential expires.
+func runExecCredentialPlugin(plugin *kubeconfigExec, dir string, cluster *execCluster) (*execCredential, error) {
+	if !execCredentialAPIVersions[plugin.APIVersion] {
+		return nil, fmt.Errorf("unsupported exec credential apiVersion '%s', use client.authentication.k8s.io/v1 or v1beta1", plugin.APIVersion)
+	}
+	if plugin.InteractiveMode == "Always" {
+		return nil, fmt.Errorf("exec credential plugin %s requires interactive input, which is not supported", plugin.Command)
+	}
+	command := plugin.Command
+	if strings.ContainsRune(command, filepath.Separator) && !filepath.IsAbs(command) {
+		command = filepath.Join(dir, command)
+	}
+
+	info := execCredential{APIVersion: plugin.APIVersion, Kind: "ExecCredential"}
+	if plugin.ProvideClusterInfo {
+		info.Spec.Cluster = cluster
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(command, plugin.Args...)
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(infoJSON))
+	for _, e := range plugin.Env {
+		cmd.Env = append(cmd.Env, e.Name+"="+e.Value)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// Plugins report errors and progress on stderr.
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if plugin.InstallHint != "" && isExecNotFound(err) {
+			return nil, fmt.Errorf("exec credential plugin %s: %s\n%s", plugin.Command, err, plugin.InstallHint)
+		}
+		return nil, fmt.Errorf("exec credential plugin %s: %s", plugin.Command, err)
+	}
+
+	var cred execCredential
+	if err := json.Unmarshal(stdout.Bytes(), &cred); err != nil {
+		return nil, fmt.Errorf("parsing the output of exec credential plugin %s: %s", plugin.Command, err)
+	}
+	if cred.APIVersion != plugin.APIVersion || cred.Kind != "ExecCredential" {
+		return nil, fmt.Errorf("exec credential plugin %s returned a %s %s, expected an ExecCredential %s", plugin.Command,
+			cred.APIVersion, cred.Kind, plugin.APIVersion)
+	}
+	if cred.Status == nil || (cred.Status.Token == "" && (cred.Status.ClientCertificateData == "" || cred.Status.ClientKeyData == "")) {
+		return nil, fmt.Errorf("exec credential plugin %s returned neither a token nor a client certificate and key", plugin.Command)
+	}
+	registerSecret(cred.Status.Token, cred.Status.ClientKeyData)
+	return &cred, nil
+}
+
+// isExecNotFound reports whether err is the failure to find the command of a plugin.
+func isExecNotFound(err error) bool {
+	var pathErr *os.PathError
+	return errors.Is(err, exec.ErrNotFound) || errors.As(err, &pathErr)
+}
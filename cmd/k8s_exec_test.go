@@ -0,0 +1,142 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeExecKubeconfig writes a kubeconfig whose user runs ./plugin.sh with the given exec apiVersion and script, and
+// returns its path.
+func writeExecKubeconfig(t *testing.T, apiVersion string, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "plugin.sh"), []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: eks
+contexts:
+- name: eks
+  context:
+    cluster: eks
+    user: eks
+    namespace: trust
+clusters:
+- name: eks
+  cluster:
+    server: https://k8s.example.com:6443
+users:
+- name: eks
+  user:
+    exec:
+      apiVersion: %s
+      command: ./plugin.sh
+      args: ["--cluster", "eks"]
+      env:
+      - name: PLUGIN_TOKEN
+        value: exec-token-1234
+      provideClusterInfo: true
+      interactiveMode: Never
+`, apiVersion)
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewK8sClientExecCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	withSecrets(t)
+	const v1 = "client.authentication.k8s.io/v1"
+	// checkInfo fails the plugin unless it got its arguments and the cluster in KUBERNETES_EXEC_INFO.
+	const checkInfo = `[ "$1 $2" = "--cluster eks" ] || { echo "unexpected arguments $*" >&2; exit 1; }
+case "$KUBERNETES_EXEC_INFO" in
+*'"server":"https://k8s.example.com:6443"'*) ;;
+*) echo "no cluster info in $KUBERNETES_EXEC_INFO" >&2; exit 1 ;;
+esac
+`
+	tests := []struct {
+		name       string
+		apiVersion string
+		script     string
+		wantToken  string
+		wantErr    string
+	}{
+		{
+			name:       "token",
+			apiVersion: v1,
+			script:     checkInfo + `printf '{"apiVersion":"%s","kind":"ExecCredential","status":{"token":"%s"}}' "client.authentication.k8s.io/v1" "$PLUGIN_TOKEN"`,
+			wantToken:  "exec-token-1234",
+		},
+		{
+			name:       "v1beta1",
+			apiVersion: "client.authentication.k8s.io/v1beta1",
+			script:     `echo '{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"token":"beta-token"}}'`,
+			wantToken:  "beta-token",
+		},
+		{
+			name:       "unsupported apiVersion",
+			apiVersion: "client.authentication.k8s.io/v1alpha1",
+			script:     "exit 0",
+			wantErr:    "unsupported exec credential apiVersion",
+		},
+		{
+			name:       "plugin fails",
+			apiVersion: v1,
+			script:     "exit 3",
+			wantErr:    "exit status 3",
+		},
+		{
+			name:       "wrong output version",
+			apiVersion: v1,
+			script:     `echo '{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"token":"x"}}'`,
+			wantErr:    "expected an ExecCredential",
+		},
+		{
+			name:       "no credentials",
+			apiVersion: v1,
+			script:     `echo '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{}}'`,
+			wantErr:    "neither a token nor a client certificate",
+		},
+		{
+			name:       "not JSON",
+			apiVersion: v1,
+			script:     "echo token",
+			wantErr:    "parsing the output",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newK8sClient(writeExecKubeconfig(t, tt.apiVersion, tt.script), "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newK8sClient() error = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newK8sClient() error = %v", err)
+			}
+			if c.token != tt.wantToken {
+				t.Errorf("token = %q, want %q", c.token, tt.wantToken)
+			}
+			if c.server != "https://k8s.example.com:6443" || c.namespace != "trust" {
+				t.Errorf("server, namespace = %s, %s, want https://k8s.example.com:6443, trust", c.server, c.namespace)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 )
 
@@ -168,6 +169,7 @@ func authConfigFile(configFile string, noPrompt bool) (map[string]string, error)
 			p = envPassword
 		}
 	}
+	registerSecret(p)
 	epErr := os.Setenv("KEYFACTOR_PASSWORD", p)
 	if epErr != nil {
 		fmt.Println("Error setting password: ", epErr)
@@ -237,11 +239,12 @@ func authConfigFile(configFile string, noPrompt bool) (map[string]string, error)
 	}
 
 	authConfig := api.AuthConfig{
-		Hostname: host,
-		Username: username,
-		Password: p,
-		Domain:   domain,
-		APIPath:  apiPath,
+		Hostname:   host,
+		Username:   username,
+		Password:   p,
+		Domain:     domain,
+		APIPath:    apiPath,
+		HTTPClient: legacyHTTPClient(),
 	}
 	// Since there's no login command in the API, we'll just try to get the list of CAs
 	_, kfcErr := api.NewKeyfactorClient(&authConfig)
@@ -254,6 +257,7 @@ func authConfigFile(configFile string, noPrompt bool) (map[string]string, error)
 	//	log.Fatal("[ERROR] getting CA list: ", authErr)
 	//}
 
+	config["config_version"] = strconv.Itoa(ConfigSchemaVersion)
 	config["host"] = host
 	config["username"] = username
 	config["domain"] = domain
@@ -282,7 +286,7 @@ func getPassword(prompt string) string {
 		panic(e1)
 	}
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, os.Kill)
 	go func() {
 		<-c
@@ -308,7 +312,13 @@ func getPassword(prompt string) string {
 func loadConfigFile(path string, filter func(map[string]interface{}) bool) map[string]string {
 	data := make(map[string]string)
 
-	f, _ := os.ReadFile(path)
+	f, rErr := os.ReadFile(path)
+	if rErr == nil {
+		// Report misconfigurations instead of silently falling back to environment variables.
+		for _, vErr := range validateConfigData(f) {
+			fmt.Fprintf(os.Stderr, "[ERROR] config file %s: %s\n", path, vErr)
+		}
+	}
 
 	jErr := json.Unmarshal(f, &data)
 	if jErr != nil {
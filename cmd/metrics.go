@@ -0,0 +1,53 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const metricsPrefix = "kfutil_rot_audit_"
+
+type promMetric struct {
+	Name  string
+	Help  string
+	Type  string
+	Value float64
+}
+
+// writePrometheusMetrics writes metrics in the Prometheus text exposition format. The file is written to a temporary
+// file and renamed into place so the node_exporter textfile collector never reads a partially written file.
+func writePrometheusMetrics(path string, metrics []promMetric) error {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		name := metricsPrefix + m.Name
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, m.Help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, m.Type)
+		fmt.Fprintf(&buf, "%s %g\n", name, m.Value)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
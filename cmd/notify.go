@@ -0,0 +1,217 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	notifyFormatAuto    = "auto"
+	notifyFormatWebhook = "webhook"
+	notifyFormatSlack   = "slack"
+	notifyFormatTeams   = "teams"
+
+	notifyTimeout = 15 * time.Second
+)
+
+// rotRunSummary is the result of a rot audit or reconcile run sent to --notify-url.
+type rotRunSummary struct {
+	Command        string   `json:"command"`
+	DryRun         bool     `json:"dry_run"`
+	Stores         int      `json:"stores"`
+	AddActions     int      `json:"add_actions"`
+	RemoveActions  int      `json:"remove_actions"`
+	Succeeded      int      `json:"succeeded"`
+	Failed         int      `json:"failed"`
+	LookupFailures []string `json:"lookup_failures,omitempty"`
+	Report         string   `json:"report"`
+	ReportURL      string   `json:"report_url,omitempty"`
+	Ticket         string   `json:"ticket,omitempty"`
+	Timestamp      string   `json:"timestamp"`
+}
+
+// addNotifyFlags adds the flags used by notifyFromFlags.
+func addNotifyFlags(cmd *cobra.Command) {
+	cmd.Flags().String("notify-url", "", "Webhook URL to post a summary of the run to. Defaults to notify_url of the config file.")
+	cmd.Flags().String("notify-format", notifyFormatAuto,
+		"Payload format of --notify-url, one of auto, webhook, slack or teams. auto detects Slack and Teams webhook URLs.")
+	cmd.Flags().String("report-url", "", "Link to the published report artifact to include in the notification, e.g. a CI job artifact URL.")
+}
+
+// countROTActions returns the number of add and remove actions and the number of stores they apply to.
+func countROTActions(actions map[string][]ROTAction) (int, int, int) {
+	adds, removes := 0, 0
+	stores := make(map[string]bool)
+	for _, certActions := range actions {
+		for _, a := range certActions {
+			if a.AddCert {
+				adds++
+			} else if a.RemoveCert {
+				removes++
+			} else {
+				continue
+			}
+			stores[a.StoreID] = true
+		}
+	}
+	return adds, removes, len(stores)
+}
+
+// reconcileSummary builds the summary of a reconcile run from its actions and the statistics of runner.
+func reconcileSummary(actions map[string][]ROTAction, dryRun bool, runner *batchRunner, lookupFailures []string, report string) rotRunSummary {
+	adds, removes, stores := countROTActions(actions)
+	stats := runner.snapshot()
+	return rotRunSummary{
+		Command:        "reconcile",
+		DryRun:         dryRun,
+		Stores:         stores,
+		AddActions:     adds,
+		RemoveActions:  removes,
+		Succeeded:      stats.Succeeded,
+		Failed:         stats.Failed,
+		LookupFailures: lookupFailures,
+		Report:         report,
+		Ticket:         rotChangeTicket,
+	}
+}
+
+// detectNotifyFormat returns the payload format for a webhook URL.
+func detectNotifyFormat(url string) string {
+	lower := strings.ToLower(url)
+	switch {
+	case strings.Contains(lower, "hooks.slack.com"):
+		return notifyFormatSlack
+	case strings.Contains(lower, "webhook.office.com"), strings.Contains(lower, "logic.azure.com"):
+		return notifyFormatTeams
+	}
+	return notifyFormatWebhook
+}
+
+func (s rotRunSummary) title() string {
+	title := fmt.Sprintf("kfutil stores rot %s", s.Command)
+	if s.DryRun {
+		title += " (dry run)"
+	}
+	return title
+}
+
+// lines returns the summary as human readable lines for chat notifications.
+func (s rotRunSummary) lines() []string {
+	lines := []string{
+		fmt.Sprintf("Stores: %d", s.Stores),
+		fmt.Sprintf("Certificates to add: %d", s.AddActions),
+		fmt.Sprintf("Certificates to remove: %d", s.RemoveActions),
+	}
+	if s.Command == "reconcile" && !s.DryRun {
+		lines = append(lines, fmt.Sprintf("Succeeded: %d, failed: %d", s.Succeeded, s.Failed))
+	}
+	if s.Ticket != "" {
+		lines = append(lines, fmt.Sprintf("Change ticket: %s", s.Ticket))
+	}
+	if len(s.LookupFailures) > 0 {
+		lines = append(lines, fmt.Sprintf("Stores not found: %s", strings.Join(s.LookupFailures, ", ")))
+	}
+	if s.ReportURL != "" {
+		lines = append(lines, fmt.Sprintf("Report: %s", s.ReportURL))
+	} else if s.Report != "" {
+		lines = append(lines, fmt.Sprintf("Report: %s", s.Report))
+	}
+	return lines
+}
+
+// notifyPayload renders the summary in the given format.
+func notifyPayload(format string, s rotRunSummary) ([]byte, error) {
+	switch format {
+	case notifyFormatWebhook:
+		return json.Marshal(s)
+	case notifyFormatSlack:
+		text := fmt.Sprintf("*%s*\n%s", s.title(), strings.Join(s.lines(), "\n"))
+		return json.Marshal(map[string]interface{}{"text": text})
+	case notifyFormatTeams:
+		color := "2EB886"
+		if s.Failed > 0 || len(s.LookupFailures) > 0 {
+			color = "D00000"
+		}
+		card := map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "http://schema.org/extensions",
+			"summary":    s.title(),
+			"title":      s.title(),
+			"themeColor": color,
+			"text":       strings.Join(s.lines(), "<br>"),
+		}
+		if s.ReportURL != "" {
+			card["potentialAction"] = []map[string]interface{}{{
+				"@type":   "OpenUri",
+				"name":    "View report",
+				"targets": []map[string]string{{"os": "default", "uri": s.ReportURL}},
+			}}
+		}
+		return json.Marshal(card)
+	}
+	return nil, fmt.Errorf("invalid notify format '%s', must be one of %s, %s, %s or %s", format, notifyFormatAuto, notifyFormatWebhook, notifyFormatSlack, notifyFormatTeams)
+}
+
+// postNotification posts payload to url.
+func postNotification(url string, payload []byte) error {
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// notifyFromFlags posts the summary to --notify-url, or notify_url of the config file, if either is set. A failed
+// notification is reported as a warning and does not fail the run.
+func notifyFromFlags(cmd *cobra.Command, s rotRunSummary) {
+	url, _ := cmd.Flags().GetString("notify-url")
+	format, _ := cmd.Flags().GetString("notify-format")
+	s.ReportURL, _ = cmd.Flags().GetString("report-url")
+	if url == "" || !cmd.Flags().Changed("notify-format") {
+		config := loadConfigFile(defaultConfigPath(), nil)
+		if url == "" {
+			url = config["notify_url"]
+		}
+		if !cmd.Flags().Changed("notify-format") && config["notify_format"] != "" {
+			format = config["notify_format"]
+		}
+	}
+	if url == "" {
+		return
+	}
+	if format == notifyFormatAuto || format == "" {
+		format = detectNotifyFormat(url)
+	}
+	s.Timestamp = GetCurrentTime()
+
+	payload, pErr := notifyPayload(strings.ToLower(format), s)
+	if pErr == nil {
+		pErr = postNotification(url, payload)
+	}
+	if pErr != nil {
+		printWarning("Unable to send notification: %s\n", pErr)
+		log.Printf("[ERROR] sending notification: %s", pErr)
+		return
+	}
+	log.Printf("[INFO] notification sent to %s", url)
+}
@@ -0,0 +1,441 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Minimal OpenPGP support (RFC 4880): verification of v4 detached signatures made with RSA or Ed25519 keys and a
+// SHA-2 hash, which is what gpg --detach-sign produces for the release checksums. Every public key and subkey in the
+// given keys is trusted as is, binding signatures, key expiry and revocations are not checked.
+
+const (
+	openpgpTagSignature = 2
+	openpgpTagPublicKey = 6
+	openpgpTagPublicSub = 14
+
+	openpgpAlgoRSA         = 1
+	openpgpAlgoRSASignOnly = 3
+	openpgpAlgoEdDSA       = 22
+
+	openpgpSigBinary = 0x00
+	openpgpSigText   = 0x01
+
+	openpgpSubpacketCreationTime   = 2
+	openpgpSubpacketExpirationTime = 3
+	openpgpSubpacketIssuer         = 16
+	openpgpSubpacketIssuerFpr      = 33
+)
+
+// openpgpHashes are the supported signature hash algorithms by OpenPGP ID. MD5, SHA-1 and RIPEMD-160 are rejected.
+var openpgpHashes = map[byte]crypto.Hash{
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// openpgpEd25519OID is the curve OID of EdDSA keys on Ed25519, 1.3.6.1.4.1.11591.15.1.
+var openpgpEd25519OID = []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}
+
+type openpgpPacket struct {
+	tag  byte
+	body []byte
+}
+
+// openpgpPublicKey is a v4 public key or subkey. rsa and ed25519 are nil for unsupported algorithms, such as
+// encryption subkeys.
+type openpgpPublicKey struct {
+	keyID   uint64
+	algo    byte
+	rsa     *rsa.PublicKey
+	ed25519 ed25519.PublicKey
+}
+
+// openpgpDearmor returns the binary contents of the ASCII armored blocks of the given type, e.g. "PGP SIGNATURE", or
+// data as is if it is binary OpenPGP data. Text outside the armored blocks is ignored.
+func openpgpDearmor(data []byte, blockType string) ([]byte, error) {
+	begin := []byte("-----BEGIN " + blockType + "-----")
+	if !bytes.Contains(data, begin) {
+		if len(data) > 0 && data[0]&0x80 != 0 {
+			return data, nil
+		}
+		return nil, fmt.Errorf("no %s found", strings.ToLower(blockType))
+	}
+	var decoded []byte
+	for i := bytes.Index(data, begin); i >= 0; i = bytes.Index(data, begin) {
+		rest := data[i+len(begin):]
+		end := bytes.Index(rest, []byte("-----END "+blockType+"-----"))
+		if end < 0 {
+			return nil, fmt.Errorf("%s is not terminated", strings.ToLower(blockType))
+		}
+		block, err := openpgpDecodeArmor(string(rest[:end]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", strings.ToLower(blockType), err)
+		}
+		decoded = append(decoded, block...)
+		data = rest[end:]
+	}
+	return decoded, nil
+}
+
+// openpgpDecodeArmor decodes the armor headers, base64 data and checksum between the BEGIN and END lines.
+func openpgpDecodeArmor(armor string) ([]byte, error) {
+	lines := strings.Split(strings.ReplaceAll(armor, "\r", ""), "\n")[1:]
+	// Armor headers such as "Comment: ..." precede the data, base64 has no ':'.
+	for len(lines) > 0 && strings.Contains(lines[0], ":") {
+		lines = lines[1:]
+	}
+	var encoded, checksum string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "=") {
+			checksum = line[1:]
+			break
+		}
+		encoded += line
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != "" {
+		want, cErr := base64.StdEncoding.DecodeString(checksum)
+		crc := openpgpCRC24(decoded)
+		if cErr != nil || !bytes.Equal(want, []byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}) {
+			return nil, errors.New("armor checksum mismatch")
+		}
+	}
+	return decoded, nil
+}
+
+func openpgpCRC24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// readOpenPGPPackets splits binary OpenPGP data into packets. Partial body lengths, which are only used for
+// streamed data packets, are not supported.
+func readOpenPGPPackets(data []byte) ([]openpgpPacket, error) {
+	var packets []openpgpPacket
+	for len(data) > 0 {
+		header := data[0]
+		if header&0x80 == 0 {
+			return nil, errors.New("invalid OpenPGP packet header")
+		}
+		var tag byte
+		var length, headerLen int
+		if header&0x40 == 0 {
+			// Old format packet header.
+			tag = (header >> 2) & 0x0f
+			switch header & 0x03 {
+			case 0:
+				headerLen = 2
+			case 1:
+				headerLen = 3
+			case 2:
+				headerLen = 5
+			default:
+				headerLen, length = 1, len(data)-1
+			}
+			if len(data) < headerLen {
+				return nil, errors.New("truncated OpenPGP packet header")
+			}
+			for _, b := range data[1:headerLen] {
+				length = length<<8 | int(b)
+			}
+		} else {
+			tag = header & 0x3f
+			if len(data) < 2 {
+				return nil, errors.New("truncated OpenPGP packet header")
+			}
+			switch first := int(data[1]); {
+			case first < 192:
+				headerLen, length = 2, first
+			case first < 224:
+				if len(data) < 3 {
+					return nil, errors.New("truncated OpenPGP packet header")
+				}
+				headerLen, length = 3, (first-192)<<8+int(data[2])+192
+			case first == 255:
+				if len(data) < 6 {
+					return nil, errors.New("truncated OpenPGP packet header")
+				}
+				headerLen, length = 6, int(binary.BigEndian.Uint32(data[2:6]))
+			default:
+				return nil, errors.New("partial OpenPGP packet lengths are not supported")
+			}
+		}
+		if length < 0 || len(data)-headerLen < length {
+			return nil, errors.New("truncated OpenPGP packet")
+		}
+		packets = append(packets, openpgpPacket{tag: tag, body: data[headerLen : headerLen+length]})
+		data = data[headerLen+length:]
+	}
+	return packets, nil
+}
+
+// readOpenPGPMPI returns the value of the multiprecision integer at the start of data and the rest of data.
+func readOpenPGPMPI(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("truncated MPI")
+	}
+	n := (int(binary.BigEndian.Uint16(data)) + 7) / 8
+	if len(data)-2 < n {
+		return nil, nil, errors.New("truncated MPI")
+	}
+	return data[2 : 2+n], data[2+n:], nil
+}
+
+func parseOpenPGPPublicKey(body []byte) (*openpgpPublicKey, error) {
+	if len(body) < 6 || body[0] != 4 {
+		return nil, errors.New("only version 4 public keys are supported")
+	}
+	fingerprint := sha1.New()
+	fingerprint.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+	fingerprint.Write(body)
+	key := &openpgpPublicKey{keyID: binary.BigEndian.Uint64(fingerprint.Sum(nil)[12:]), algo: body[5]}
+	material := body[6:]
+	switch key.algo {
+	case openpgpAlgoRSA, openpgpAlgoRSASignOnly:
+		n, rest, err := readOpenPGPMPI(material)
+		if err != nil {
+			return nil, err
+		}
+		e, _, err := readOpenPGPMPI(rest)
+		if err != nil {
+			return nil, err
+		}
+		if len(e) > 4 {
+			return nil, errors.New("RSA public exponent is too large")
+		}
+		key.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case openpgpAlgoEdDSA:
+		if len(material) < 1 || len(material) < 1+int(material[0]) {
+			return nil, errors.New("truncated EdDSA curve OID")
+		}
+		oid, rest := material[1:1+int(material[0])], material[1+int(material[0]):]
+		if !bytes.Equal(oid, openpgpEd25519OID) {
+			// Other EdDSA curves, e.g. Ed448, are not supported.
+			return key, nil
+		}
+		point, _, err := readOpenPGPMPI(rest)
+		if err != nil {
+			return nil, err
+		}
+		if len(point) != 1+ed25519.PublicKeySize || point[0] != 0x40 {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		key.ed25519 = ed25519.PublicKey(point[1:])
+	}
+	return key, nil
+}
+
+// readOpenPGPPublicKeys returns the v4 public keys and subkeys of an armored or binary key ring. Keys of other
+// versions are skipped.
+func readOpenPGPPublicKeys(data []byte) ([]*openpgpPublicKey, error) {
+	decoded, err := openpgpDearmor(data, "PGP PUBLIC KEY BLOCK")
+	if err != nil {
+		return nil, err
+	}
+	packets, err := readOpenPGPPackets(decoded)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*openpgpPublicKey
+	for _, p := range packets {
+		if p.tag != openpgpTagPublicKey && p.tag != openpgpTagPublicSub || len(p.body) == 0 || p.body[0] != 4 {
+			continue
+		}
+		key, kErr := parseOpenPGPPublicKey(p.body)
+		if kErr != nil {
+			return nil, kErr
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+// verifyOpenPGPSignature checks the armored or binary detached signature of data against the armored or binary
+// public keys. It succeeds if any signature in signature is a valid signature of data by one of the keys.
+func verifyOpenPGPSignature(publicKeys []byte, data []byte, signature []byte) error {
+	keys, err := readOpenPGPPublicKeys(publicKeys)
+	if err != nil {
+		return fmt.Errorf("reading public key: %s", err)
+	}
+	decoded, err := openpgpDearmor(signature, "PGP SIGNATURE")
+	if err != nil {
+		return err
+	}
+	packets, err := readOpenPGPPackets(decoded)
+	if err != nil {
+		return err
+	}
+	err = errors.New("no signature found")
+	for _, p := range packets {
+		if p.tag == openpgpTagSignature {
+			if err = verifyOpenPGPSignaturePacket(keys, data, p.body, time.Now()); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+func verifyOpenPGPSignaturePacket(keys []*openpgpPublicKey, data []byte, body []byte, now time.Time) error {
+	if len(body) < 6 || body[0] != 4 {
+		return errors.New("only version 4 signatures are supported")
+	}
+	sigType, algo := body[1], body[2]
+	hash, ok := openpgpHashes[body[3]]
+	if !ok {
+		return fmt.Errorf("unsupported signature hash algorithm %d", body[3])
+	}
+	hashedLen := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 6+hashedLen+2 {
+		return errors.New("truncated signature")
+	}
+	hashed := body[6 : 6+hashedLen]
+	unhashedLen := int(binary.BigEndian.Uint16(body[6+hashedLen:]))
+	rest := body[6+hashedLen+2:]
+	if len(rest) < unhashedLen+2 {
+		return errors.New("truncated signature")
+	}
+	unhashed := rest[:unhashedLen]
+	prefix, material := rest[unhashedLen:unhashedLen+2], rest[unhashedLen+2:]
+
+	var issuer uint64
+	var created time.Time
+	var lifetime time.Duration
+	for i, subpackets := range [][]byte{hashed, unhashed} {
+		for len(subpackets) > 0 {
+			var length, headerLen int
+			switch first := int(subpackets[0]); {
+			case first < 192:
+				headerLen, length = 1, first
+			case first < 255 && len(subpackets) >= 2:
+				headerLen, length = 2, (first-192)<<8+int(subpackets[1])+192
+			case first == 255 && len(subpackets) >= 5:
+				headerLen, length = 5, int(binary.BigEndian.Uint32(subpackets[1:5]))
+			default:
+				return errors.New("truncated signature subpacket")
+			}
+			if length < 1 || len(subpackets)-headerLen < length {
+				return errors.New("truncated signature subpacket")
+			}
+			subType, subData := subpackets[headerLen]&0x7f, subpackets[headerLen+1:headerLen+length]
+			critical := subpackets[headerLen]&0x80 != 0
+			subpackets = subpackets[headerLen+length:]
+			// Only hashed subpackets are signed, the issuer is a hint to find the key and may be unhashed.
+			switch {
+			case subType == openpgpSubpacketIssuer && len(subData) == 8:
+				issuer = binary.BigEndian.Uint64(subData)
+			case subType == openpgpSubpacketIssuerFpr && len(subData) == 21 && subData[0] == 4:
+				issuer = binary.BigEndian.Uint64(subData[13:])
+			case i == 0 && subType == openpgpSubpacketCreationTime && len(subData) == 4:
+				created = time.Unix(int64(binary.BigEndian.Uint32(subData)), 0)
+			case i == 0 && subType == openpgpSubpacketExpirationTime && len(subData) == 4:
+				lifetime = time.Duration(binary.BigEndian.Uint32(subData)) * time.Second
+			case i == 0 && critical:
+				return fmt.Errorf("unsupported critical signature subpacket %d", subType)
+			}
+		}
+	}
+	if created.IsZero() {
+		return errors.New("signature has no creation time")
+	}
+	if lifetime > 0 && now.After(created.Add(lifetime)) {
+		return fmt.Errorf("signature expired on %s", created.Add(lifetime).UTC().Format(time.RFC3339))
+	}
+	if sigType != openpgpSigBinary && sigType != openpgpSigText {
+		return fmt.Errorf("unsupported signature type 0x%02x", sigType)
+	}
+
+	var key *openpgpPublicKey
+	for _, k := range keys {
+		if k.keyID == issuer {
+			key = k
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("signature is by key %016X, which is not a trusted key", issuer)
+	}
+	if key.algo != algo || (key.rsa == nil && key.ed25519 == nil) {
+		return fmt.Errorf("unsupported signing key algorithm %d of key %016X", key.algo, issuer)
+	}
+
+	h := hash.New()
+	if sigType == openpgpSigText {
+		// Text signatures are over the data with CRLF line endings.
+		data = bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	h.Write(data)
+	h.Write(body[:6+hashedLen])
+	h.Write([]byte{4, 0xff})
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(6+hashedLen)))
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest[:2], prefix) {
+		return errors.New("invalid signature")
+	}
+
+	if key.rsa != nil {
+		s, _, mErr := readOpenPGPMPI(material)
+		if mErr != nil {
+			return mErr
+		}
+		if rsa.VerifyPKCS1v15(key.rsa, hash, digest, openpgpLeftPad(s, (key.rsa.N.BitLen()+7)/8)) != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	r, material, mErr := readOpenPGPMPI(material)
+	if mErr != nil {
+		return mErr
+	}
+	s, _, mErr := readOpenPGPMPI(material)
+	if mErr != nil {
+		return mErr
+	}
+	if len(r) > 32 || len(s) > 32 || !ed25519.Verify(key.ed25519, digest, append(openpgpLeftPad(r, 32), openpgpLeftPad(s, 32)...)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// openpgpLeftPad returns b with leading zeros to size bytes, as MPIs are stored without them.
+func openpgpLeftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,146 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// Test keys and signatures made with GnuPG 2.2, e.g.
+// gpg --quick-gen-key "kfutil test ed25519 <test@example.com>" ed25519 sign never
+// gpg -u test@example.com --digest-algo SHA256 --output ed25519.sig --detach-sign checksums.txt
+const (
+	testOpenPGPChecksums = "abc123  kfutil_1.0.0_linux_amd64.zip\ndef456  kfutil_1.0.0_darwin_arm64.zip\n"
+
+	testOpenPGPEd25519Key = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatGdvBYJKwYBBAHaRw8BAQdA4B982mKARz8RzbwFC3/CwwGRf7crAVchghsv
+49Mso160JmtmdXRpbCB0ZXN0IGVkMjU1MTkgPHRlc3RAZXhhbXBsZS5jb20+iJAE
+ExYIADgWIQSsgVzKWNXMExrZYjD7NfqLlWmIVgUCatGdvAIbAwULCQgHAgYVCgkI
+CwIEFgIDAQIeAQIXgAAKCRD7NfqLlWmIVjbzAP4zTyHpnen5GIpPyPCXUBDOzf/J
+A0BUTJrZVn2WtdwwDgEA2sHAS5tHo/SCrAzrs7ugeeOpf1Z3dnH2ETTfsN3ENwU=
+=Cv+X
+-----END PGP PUBLIC KEY BLOCK-----`
+
+	// A key with a certification-only Ed25519 primary key and an Ed25519 signing subkey.
+	testOpenPGPSubkeyKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatGdvxYJKwYBBAHaRw8BAQdA8Q13oWyxTf8M7uB9eP4+jAOAEFCLctQQJRjG
+DNK2PFi0JGtmdXRpbCB0ZXN0IHN1YmtleSA8c3ViQGV4YW1wbGUuY29tPoiQBBMW
+CAA4FiEENqZi/F87BpYhvcwn6ZCXfNdNSFwFAmrRnb8CGwEFCwkIBwIGFQoJCAsC
+BBYCAwECHgECF4AACgkQ6ZCXfNdNSFyNegEA4xRVWI6fJFokyagPBOnaa72x97LN
+yJJn9TrX+lEiKgcBAM0u1ppwlIuoi1x+P2GIp/tr5dMdUxAmfPtTgcJbl9QBuDME
+atGdvxYJKwYBBAHaRw8BAQdAAYnZCXF8ekIJ0BBXGhV5TL+i1TOsQMzuZckVdBdR
+dECI7wQYFggAIBYhBDamYvxfOwaWIb3MJ+mQl3zXTUhcBQJq0Z2/AhsCAIEJEOmQ
+l3zXTUhcdiAEGRYIAB0WIQS5Tbxb7qBwRIF7Jx3n2zkYwdA4+AUCatGdvwAKCRDn
+2zkYwdA4+FdcAQC4B4ZFQF1DOlkfEC87NKaL0zP12WkwUQV2jyk3mRbE2QD/dsTb
+EB3fm9Gz2zK6Pgye5Ye9TMRxeyT5Hid/OxKKcgiP8wEA6MhWvyAFMursk4BlqEL/
++rF8F8oLdmvGoeYmJ0wzNbEA/jyiHF19lT75WuRLbxweDFyqg9ok0kKzNwQ6V63A
+JH4G
+=4MZl
+-----END PGP PUBLIC KEY BLOCK-----`
+
+	testOpenPGPRSAKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQENBGrRnbwBCADCnAbMrJgYlbADPWzjgU/AvF8oTlpvWp0aLaHFZxo7fUHJzfoC
+dODV3QdWvm7xghqb95aiAumYYEokRFhsxZMdpM3np1Z1xyLgVGp4736MmngwNsBY
+4Q3wuSB/o8fp4GlzKq8JeDdL6POTv8t0rVmrUcJXflM9A/wwmcqNMJgNapdlGU1F
+7zYwLB3J0anlqeqKz2VNpQLbOVpwkaHk21cEs0couFDzPmiua+b01v/14YhzI91I
+MnCnZOWkjWhx8NKBHJlRK9XQYxbNvQBR0Tb9p8v9JMOnG4i+mMNu5x1gsfNdv3yc
+lgEObnlBPc07tXDHj9w7evxG4ye5AzKzzTE7ABEBAAG0IWtmdXRpbCB0ZXN0IHJz
+YSA8cnNhQGV4YW1wbGUuY29tPokBTgQTAQoAOBYhBF3lAGA4aVh+Ulp8KnRA5j6R
+OOWhBQJq0Z28AhsDBQsJCAcCBhUKCQgLAgQWAgMBAh4BAheAAAoJEHRA5j6ROOWh
+3MAIALzz2LoSSrc8QHzND6ZhqlMeFHntantDgnzox6BEdUOSLLHgXZGFCwboxAPu
+/O7KH/+c+5iukDHUUXjmZMcBIJ8NYOgy4VPqknqLLhqtQC4DpDCXDhpfofiTyt+u
+FdgPpE2TZh6JIQSRL4ReZPQeLeK/RCtzTsXatWnM6zEL68e+OzKIv7QXZnbGye8u
+JNscU6vBLZjdDvLi4Swubvp7WHcmDRuyYBXJNgfHDlyw72vWT6U/QbDHKJ549eWw
+hVa4Q5tT0hF9l1fJhvCA5qiKZUdUbGQkzx9Zlf+K1LW0kgyjkvmCmHsOKPWxjBxb
+i7BitudWtpRPAlrZocQnScl+beE=
+=r/V9
+-----END PGP PUBLIC KEY BLOCK-----`
+
+	testOpenPGPEd25519SigSHA512Armored = `-----BEGIN PGP SIGNATURE-----
+
+iIcEABYKAC8WIQSsgVzKWNXMExrZYjD7NfqLlWmIVgUCatGdvBEcdGVzdEBleGFt
+cGxlLmNvbQAKCRD7NfqLlWmIVh3GAP4qOzcJiXxz41BRxRp67uWeX0I/zbZZR2Fu
+efld3UBlQwEAr5a00Q+2aqPHXE6qIfa97TTPkuJ8LuZbMvmNIbCrlAs=
+=Hwv8
+-----END PGP SIGNATURE-----`
+
+	testOpenPGPEd25519Sig     = "iIcEABYIAC8WIQSsgVzKWNXMExrZYjD7NfqLlWmIVgUCatGdvBEcdGVzdEBleGFtcGxlLmNvbQAKCRD7NfqLlWmIVvwKAP9Ro7ldVH3gjfFLJWgwr+wLaFg7MvtGrvirhnTqgXm2ngEAivtz9GKm0a54DIooQ/BBM3PsUxCdbyo2cULBBE6HXQc="
+	testOpenPGPEd25519TextSig = "iIcEARYIAC8WIQSsgVzKWNXMExrZYjD7NfqLlWmIVgUCatGdvBEcdGVzdEBleGFtcGxlLmNvbQAKCRD7NfqLlWmIVpvwAP4138oszvvCnlVepBLYfLGwg4U4RZkK8K6ygzq3FonMhAEA2eYRRJej72Zx9nuA6SOuRyUMAhE1/UMUtnBjoB0LDwc="
+	testOpenPGPSubkeySig      = "iIYEABYIAC4WIQS5Tbxb7qBwRIF7Jx3n2zkYwdA4+AUCatGdvxAcc3ViQGV4YW1wbGUuY29tAAoJEOfbORjB0Dj481kBAIHwcWc7N1ewxkEpJw9ZM31uOUk1skNhNhzb//YF5YyQAP9Q/m+w+QPcE2Eqi5ED5w3N3PF+4kOvt2m9WyCPL3IsCg=="
+	testOpenPGPRSASig         = "iQFEBAABCAAuFiEEXeUAYDhpWH5SWnwqdEDmPpE45aEFAmrRnbwQHHJzYUBleGFtcGxlLmNvbQAKCRB0QOY+kTjloRwYCACDcjEA1QI9UdfkS2QKNfwjVdgF+fu9KjSYBn/H47Nv5aGH559OnBsMQGOc7eIbRILjKxGz4RX5mAH2AtdU/tErgBfcDePHwDIdnya6l+9M+pvbzqEJLIYHZbF4FTEOywKn413iGHpmch5tlP6z5LyYFQy463ZiXJ3sY0HQVb4Cj/20Rz5KfEqCnxTNyo/Dc+hRmlM9pf+7QilYBMFdFrfITNmdg+2EQkKGB8y3VWooB/crDWog+uwDBGoQempsC5PMTXeJt0iQQdb8MaLvzRqXNWKObm1FrqxRfGcFoLJSKjOixSg3DjCkHgm2yduNthnEca9HqY+0ezJXTn/fJ6Qt"
+	testOpenPGPRSASigSHA1     = "iQFEBAABAgAuFiEEXeUAYDhpWH5SWnwqdEDmPpE45aEFAmrRnbwQHHJzYUBleGFtcGxlLmNvbQAKCRB0QOY+kTjloeIXB/4spAcjb3b7T5Z90jkgjYMPE9JW3vAyptEXwOarjfMJ1WOi0geOMnrxYiyyp1giPse7SDyysjMEu+nSFCI6cZrieoA07H7STJliDeP4by244Aw6vHv8FLZ2yye4jbGSDahGS/B14L/d2JT82HVgNl+cJe3z8dZdBcyo5gI9d30eDAOrEZLQgG8Axiwq7uhKnMbSpCKJhCrgdWNMZv00+k4moZT8Vw4kB2ILzPZ3pOhc6odDUJBHpnFkqohJN45ZnJizkeKApTOPKmiuXjwsYY4fX8CKxcPwWkIpl4HwyAAuNirpbwRlD34ZNyWomja2bSgVhWFjFco2y97OtmimkFvQ"
+)
+
+func TestVerifyOpenPGPSignature(t *testing.T) {
+	decode := func(s string) []byte {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tests := []struct {
+		name      string
+		key       string
+		data      string
+		signature []byte
+		wantErr   string
+	}{
+		{"ed25519", testOpenPGPEd25519Key, testOpenPGPChecksums, decode(testOpenPGPEd25519Sig), ""},
+		{"ed25519 armored sha512", testOpenPGPEd25519Key, testOpenPGPChecksums, []byte(testOpenPGPEd25519SigSHA512Armored), ""},
+		{"text signature", testOpenPGPEd25519Key, testOpenPGPChecksums, decode(testOpenPGPEd25519TextSig), ""},
+		{"text signature CRLF", testOpenPGPEd25519Key, strings.ReplaceAll(testOpenPGPChecksums, "\n", "\r\n"), decode(testOpenPGPEd25519TextSig), ""},
+		{"signing subkey", testOpenPGPSubkeyKey, testOpenPGPChecksums, decode(testOpenPGPSubkeySig), ""},
+		{"rsa", testOpenPGPRSAKey, testOpenPGPChecksums, decode(testOpenPGPRSASig), ""},
+		{"key ring", testOpenPGPEd25519Key + "\n" + testOpenPGPRSAKey, testOpenPGPChecksums, decode(testOpenPGPRSASig), ""},
+		{"modified data", testOpenPGPEd25519Key, strings.Replace(testOpenPGPChecksums, "abc123", "abc124", 1), decode(testOpenPGPEd25519Sig), "invalid signature"},
+		{"modified rsa data", testOpenPGPRSAKey, testOpenPGPChecksums + " ", decode(testOpenPGPRSASig), "invalid signature"},
+		{"binary data with text signature", testOpenPGPEd25519Key, strings.ReplaceAll(testOpenPGPChecksums, "\n", " "), decode(testOpenPGPEd25519TextSig), "invalid signature"},
+		{"other key", testOpenPGPRSAKey, testOpenPGPChecksums, decode(testOpenPGPEd25519Sig), "not a trusted key"},
+		{"sha1", testOpenPGPRSAKey, testOpenPGPChecksums, decode(testOpenPGPRSASigSHA1), "unsupported signature hash algorithm 2"},
+		{"no key", "", testOpenPGPChecksums, decode(testOpenPGPEd25519Sig), "no pgp public key block found"},
+		{"corrupt key", strings.Replace(testOpenPGPEd25519Key, "mDME", "mDMF", 1), testOpenPGPChecksums, decode(testOpenPGPEd25519Sig), "checksum mismatch"},
+		{"no signature", testOpenPGPEd25519Key, testOpenPGPChecksums, []byte("not a signature"), "no pgp signature found"},
+		{"truncated signature", testOpenPGPEd25519Key, testOpenPGPChecksums, decode(testOpenPGPEd25519Sig)[:40], "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyOpenPGPSignature([]byte(tt.key), []byte(tt.data), tt.signature)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyOpenPGPSignature() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyOpenPGPSignature() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReleaseSigningKeys(t *testing.T) {
+	if _, err := releaseSigningKeys("missing.asc"); err == nil {
+		t.Errorf("releaseSigningKeys() of a missing file succeeded")
+	}
+	// The embedded key is either an OpenPGP public key or missing, in which case upgrades need --signing-key.
+	keys, err := releaseSigningKeys("")
+	if err != nil {
+		if !strings.Contains(err.Error(), "--signing-key") {
+			t.Errorf("releaseSigningKeys() error = %v, want a hint to use --signing-key", err)
+		}
+		return
+	}
+	if _, err := readOpenPGPPublicKeys(keys); err != nil {
+		t.Errorf("embedded release signing key: %s", err)
+	}
+}
@@ -111,34 +111,6 @@ var resetOrchestratorCmd = &cobra.Command{
 	},
 }
 
-// getLogsOrchestratorCmd represents the get logs orchestrator command
-var getLogsOrchestratorCmd = &cobra.Command{
-	Use:   "logs",
-	Short: "Get orchestrator logs by ID or machine/client name.",
-	Long:  `Get orchestrator logs by ID or machine/client name.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		log.SetOutput(io.Discard)
-		client := cmd.Flag("client").Value.String()
-		kfClient, cErr := initClient()
-		if cErr != nil {
-			fmt.Println("Error, unable to connect to Keyfactor.")
-			log.Fatalf("Error: %s", cErr)
-		}
-		agents, aErr := kfClient.GetAgent(client)
-		if aErr != nil {
-			fmt.Printf("Error, unable to get logs for orchestrator %s. %s\n", client, aErr)
-			log.Fatalf("[ERROR]: %s", aErr)
-		}
-		agent := agents[0]
-		_, aErr = kfClient.FetchAgentLogs(agent.AgentId)
-		if aErr != nil {
-			fmt.Printf("Error, unable to get logs for orchestrator %s. %s\n", client, aErr)
-			log.Fatalf("[ERROR]: %s", aErr)
-		}
-		fmt.Printf("Fetching logs from %s successful.\n", client)
-	},
-}
-
 // listOrchestratorsCmd represents the list orchestrators command
 var listOrchestratorsCmd = &cobra.Command{
 	Use:   "list",
@@ -190,10 +162,6 @@ func init() {
 	orchsCmd.AddCommand(resetOrchestratorCmd)
 	resetOrchestratorCmd.Flags().StringVarP(&client, "client", "c", "", "Reset a specific orchestrator by machine or client name.")
 	resetOrchestratorCmd.MarkFlagRequired("client")
-	// GET orchestrator logs command
-	orchsCmd.AddCommand(getLogsOrchestratorCmd)
-	getLogsOrchestratorCmd.Flags().StringVarP(&client, "client", "c", "", "Get logs for a specific orchestrator by machine or client name.")
-	getLogsOrchestratorCmd.MarkFlagRequired("client")
 	// SET orchestrator auth certificate reenrollment command
 	//orchsCmd.AddCommand(setOrchestratorAuthCertReenrollCmd)
 	// Utility commands
@@ -0,0 +1,196 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Orchestrator job results of the job history.
+var jobResults = map[int32]string{
+	0: "Unknown",
+	1: "Success",
+	2: "Warning",
+	3: "Failure",
+}
+
+func jobResultName(result int32) string {
+	if name, ok := jobResults[result]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", result)
+}
+
+// orchsJobLog is a job history entry of `orchs logs --json`.
+type orchsJobLog struct {
+	JobID          string     `json:"job_id"`
+	JobType        string     `json:"job_type"`
+	Orchestrator   string     `json:"orchestrator"`
+	ClientMachine  string     `json:"client_machine"`
+	StorePath      string     `json:"store_path"`
+	OperationStart *time.Time `json:"operation_start,omitempty"`
+	OperationEnd   *time.Time `json:"operation_end,omitempty"`
+	Result         string     `json:"result"`
+	Message        string     `json:"message"`
+}
+
+// findOrchestrator returns the orchestrator with the ID id, or the machine/client name client.
+func findOrchestrator(kfClient *api.Client, id string, client string) (*api.Agent, error) {
+	if id != "" {
+		agents, err := kfClient.GetAgent(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(agents) == 0 {
+			return nil, fmt.Errorf("orchestrator %s not found", id)
+		}
+		return &agents[0], nil
+	}
+	agents, err := kfClient.GetAgentList()
+	if err != nil {
+		return nil, err
+	}
+	for i := range agents {
+		if strings.EqualFold(agents[i].ClientMachine, client) {
+			return &agents[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no orchestrator with client machine %s", client)
+}
+
+// orchestratorJobHistory returns the jobs an orchestrator started since, newest first. Only failed and warning jobs
+// are returned if failedOnly is set.
+func orchestratorJobHistory(ctx context.Context, sdkClient *keyfactor.APIClient, machine string, since time.Time, failedOnly bool, limit int32) ([]keyfactor.KeyfactorApiModelsCertificateStoresJobHistoryResponse, error) {
+	query := fmt.Sprintf(`AgentMachine -eq "%s" AND OperationStart -ge "%s"`, machine, since.UTC().Format(time.RFC3339))
+	if failedOnly {
+		query += " AND Result -ne 1"
+	}
+	jobs, _, err := sdkClient.OrchestratorJobApi.OrchestratorJobGetJobHistory(ctx).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		PqQueryString(query).PqSortField("OperationStart").PqSortAscending(1).PqReturnLimit(limit).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("getting job history: %s", err)
+	}
+	return jobs, nil
+}
+
+// getLogsOrchestratorCmd represents the get orchestrator logs command
+var getLogsOrchestratorCmd = &cobra.Command{
+	Use:   "logs (--id <agent id> | --client <machine>)",
+	Short: "Get the recent jobs and job messages of an orchestrator.",
+	Long: `Lists the jobs an orchestrator ran since --since, with their result and the message the orchestrator reported,
+to diagnose failed jobs without logging on to the orchestrator host. Use --failed to only list failed jobs and jobs
+with warnings.
+
+The orchestrator's own log files are not available through the API. --fetch asks the orchestrator to upload them to
+Keyfactor Command, where they can be downloaded from the orchestrator management page.`,
+	Example: `kfutil orchs logs --client orch01.example.com --since 1h
+kfutil orchs logs --id 5d3a... --since 24h --failed --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		id, _ := cmd.Flags().GetString("id")
+		client, _ := cmd.Flags().GetString("client")
+		since, _ := cmd.Flags().GetDuration("since")
+		failedOnly, _ := cmd.Flags().GetBool("failed")
+		limit, _ := cmd.Flags().GetInt32("limit")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		fetch, _ := cmd.Flags().GetBool("fetch")
+
+		if id == "" && client == "" {
+			fmt.Println("[ERROR] one of --id or --client is required")
+			log.Fatalf("[ERROR] no orchestrator given")
+		}
+		if since <= 0 {
+			fmt.Println("[ERROR] --since must be a positive duration, e.g. 1h")
+			log.Fatalf("[ERROR] invalid --since: %s", since)
+		}
+		kfClient, cErr := initClient()
+		if cErr != nil {
+			fmt.Println("[ERROR] unable to connect to Keyfactor.")
+			log.Fatalf("[ERROR] %s", cErr)
+		}
+		agent, aErr := findOrchestrator(kfClient, id, client)
+		if aErr != nil {
+			fmt.Printf("[ERROR] unable to get orchestrator: %s\n", aErr)
+			log.Fatalf("[ERROR] %s", aErr)
+		}
+
+		if fetch {
+			if readOnly {
+				printWarning("Read-only mode, not asking %s to upload its log files.\n", agent.ClientMachine)
+			} else if _, fErr := kfClient.FetchAgentLogs(agent.AgentId); fErr != nil {
+				printWarning("Unable to ask %s to upload its log files: %s\n", agent.ClientMachine, fErr)
+			} else {
+				printInfo("Asked %s to upload its log files to Keyfactor Command.\n", agent.ClientMachine)
+			}
+		}
+
+		ctx := commandContext(cmd)
+		start := time.Now().Add(-since)
+		jobs, jErr := orchestratorJobHistory(ctx, initGenClient(), agent.ClientMachine, start, failedOnly, limit)
+		if jErr != nil {
+			exitIfInterrupted(ctx, "no jobs were listed")
+			fmt.Printf("[ERROR] %s\n", jErr)
+			log.Fatalf("[ERROR] %s", jErr)
+		}
+
+		if jsonOut {
+			entries := make([]orchsJobLog, 0, len(jobs))
+			for _, j := range jobs {
+				entries = append(entries, orchsJobLog{
+					JobID:          j.GetJobId(),
+					JobType:        j.GetJobType(),
+					Orchestrator:   j.GetAgentMachine(),
+					ClientMachine:  j.GetClientMachine(),
+					StorePath:      j.GetStorePath(),
+					OperationStart: j.OperationStart,
+					OperationEnd:   j.OperationEnd,
+					Result:         jobResultName(j.GetResult()),
+					Message:        j.GetMessage(),
+				})
+			}
+			output, _ := json.MarshalIndent(entries, "", "  ")
+			fmt.Println(string(output))
+			return
+		}
+		if len(jobs) == 0 {
+			printInfo("No jobs of %s since %s.\n", agent.ClientMachine, tuiTime(&start))
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STARTED\tJOB TYPE\tSTORE PATH\tRESULT\tMESSAGE")
+		for _, j := range jobs {
+			message := strings.Join(strings.Fields(j.GetMessage()), " ")
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", tuiTime(j.OperationStart), j.GetJobType(), j.GetStorePath(), jobResultName(j.GetResult()), message)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	orchsCmd.AddCommand(getLogsOrchestratorCmd)
+	getLogsOrchestratorCmd.Flags().String("id", "", "ID of the orchestrator.")
+	getLogsOrchestratorCmd.Flags().StringP("client", "c", "", "Machine or client name of the orchestrator.")
+	getLogsOrchestratorCmd.Flags().Duration("since", 24*time.Hour, "List jobs started within this duration, e.g. 1h or 30m.")
+	getLogsOrchestratorCmd.Flags().Bool("failed", false, "Only list failed jobs and jobs with warnings.")
+	getLogsOrchestratorCmd.Flags().Int32("limit", 100, "Maximum number of jobs to list.")
+	getLogsOrchestratorCmd.Flags().Bool("json", false, "Print the jobs as JSON.")
+	getLogsOrchestratorCmd.Flags().Bool("fetch", false, "Also ask the orchestrator to upload its log files to Keyfactor Command.")
+	getLogsOrchestratorCmd.MarkFlagsMutuallyExclusive("id", "client")
+}
@@ -0,0 +1,131 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// quietOutput suppresses status messages printed with the print* helpers below. Errors and machine output such as
+// files written to stdout are not affected.
+var quietOutput bool
+
+// isTerminal reports whether f is a character device, i.e. an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// configureOutput applies the --quiet, --no-color and --color flags. Colors are disabled in auto mode when stdout is
+// not a terminal or NO_COLOR is set.
+func configureOutput(cmd *cobra.Command) error {
+	quietOutput, _ = cmd.Flags().GetBool("quiet")
+	mode, _ := cmd.Flags().GetString("color")
+	mode = strings.ToLower(mode)
+	if noColor, _ := cmd.Flags().GetBool("no-color"); noColor {
+		mode = colorNever
+	}
+	enabled := false
+	switch mode {
+	case colorAlways:
+		enabled = true
+	case colorNever:
+	case colorAuto, "":
+		_, noColorEnv := os.LookupEnv("NO_COLOR")
+		enabled = !noColorEnv && isTerminal(os.Stdout)
+	default:
+		return fmt.Errorf("invalid --color value '%s', must be one of %s, %s or %s", mode, colorAuto, colorAlways, colorNever)
+	}
+	if !enabled {
+		colorRed, colorGreen, colorYellow, colorWhite = "", "", "", ""
+	}
+	return nil
+}
+
+func printStatus(color string, format string, a ...interface{}) {
+	if quietOutput {
+		return
+	}
+	msg := redactSecrets(fmt.Sprintf(format, a...))
+	if color != "" {
+		// Reset the color before the trailing newline so it does not bleed into the next line.
+		text := strings.TrimSuffix(msg, "\n")
+		msg = color + text + colorWhite + msg[len(text):]
+	}
+	fmt.Print(msg)
+}
+
+// printInfo prints a status message unless --quiet is set.
+func printInfo(format string, a ...interface{}) {
+	printStatus("", format, a...)
+}
+
+// printAdded prints a status message about something added or created, in green.
+func printAdded(format string, a ...interface{}) {
+	printStatus(colorGreen, format, a...)
+}
+
+// printRemoved prints a status message about something removed, in red.
+func printRemoved(format string, a ...interface{}) {
+	printStatus(colorRed, format, a...)
+}
+
+// printWarning prints a warning, in yellow.
+func printWarning(format string, a ...interface{}) {
+	printStatus(colorYellow, format, a...)
+}
+
+const progressBarWidth = 30
+
+// progressBar draws the progress of a number of steps on a terminal. It draws nothing when stdout is not a terminal or
+// --quiet is set. It is safe for concurrent use.
+type progressBar struct {
+	label string
+	total int
+	mu    sync.Mutex
+	done  int
+}
+
+func newProgressBar(label string, total int) *progressBar {
+	p := &progressBar{label: label, total: total}
+	p.draw()
+	return p
+}
+
+// increment marks a step as done.
+func (p *progressBar) increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.draw()
+}
+
+// finish ends the line of the progress bar.
+func (p *progressBar) finish() {
+	if p.total > 0 && isTerminal(os.Stdout) {
+		printInfo("\n")
+	}
+}
+
+func (p *progressBar) draw() {
+	if p.total == 0 || !isTerminal(os.Stdout) {
+		return
+	}
+	filled := progressBarWidth * p.done / p.total
+	printInfo("\r%s [%s%s] %d/%d", p.label, strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), p.done, p.total)
+}
@@ -0,0 +1,176 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultListLimit = 100
+	// listAllPageSize is the page size of --all, large enough to keep the number of requests down on big instances.
+	listAllPageSize = 500
+)
+
+// listPaging is the window of a list selected with --limit, --offset and --all.
+type listPaging struct {
+	Limit  int
+	Offset int
+	All    bool
+}
+
+// addListPagingFlags adds the --limit, --offset and --all flags read by listPagingFromFlags.
+func addListPagingFlags(cmd *cobra.Command, noun string) {
+	cmd.Flags().Int("limit", defaultListLimit, fmt.Sprintf("Maximum number of %s to list.", noun))
+	cmd.Flags().Int("offset", 0, fmt.Sprintf("Number of %s to skip, e.g. 100 to list the second page of --limit 100.", noun))
+	cmd.Flags().Bool("all", false, fmt.Sprintf("List all %s, requesting them page by page. --limit and --offset are ignored.", noun))
+}
+
+// listPagingFromFlags returns the window selected by --limit, --offset and --all.
+func listPagingFromFlags(cmd *cobra.Command) (listPaging, error) {
+	limit, _ := cmd.Flags().GetInt("limit")
+	offset, _ := cmd.Flags().GetInt("offset")
+	all, _ := cmd.Flags().GetBool("all")
+	if all {
+		return listPaging{All: true}, nil
+	}
+	if limit < 1 {
+		return listPaging{}, fmt.Errorf("invalid --limit %d, must be at least 1, use --all to list everything", limit)
+	}
+	if offset < 0 {
+		return listPaging{}, fmt.Errorf("invalid --offset %d, must not be negative", offset)
+	}
+	return listPaging{Limit: limit, Offset: offset}, nil
+}
+
+// pageSize returns the number of items to request per page.
+func (p listPaging) pageSize() int {
+	if p.All {
+		return listAllPageSize
+	}
+	return p.Limit
+}
+
+// window returns the part of items, a list fetched in full, selected by p and whether more items follow it.
+func (p listPaging) window(n int) (from int, to int, more bool) {
+	if p.All {
+		return 0, n, false
+	}
+	from, to = p.Offset, p.Offset+p.Limit
+	if from > n {
+		from = n
+	}
+	if to > n {
+		to = n
+	}
+	return from, to, to < n
+}
+
+// fetchPages requests the pages of a list that cover the window of p, in order, until a page is not full. fetch
+// requests a 1-based page of size items, appends them to the caller's list and returns their number. fetchPages
+// returns the bounds of the window in the caller's list, and whether the list may continue after it.
+func fetchPages(p listPaging, fetch func(page int32, size int32) (int, error)) (from int, to int, more bool, err error) {
+	size := p.pageSize()
+	page := p.Offset/size + 1
+	from = p.Offset % size
+	fetched := 0
+	for {
+		n, fErr := fetch(int32(page), int32(size))
+		if fErr != nil {
+			return 0, 0, false, fmt.Errorf("page %d: %s", page, fErr)
+		}
+		fetched += n
+		full := n == size
+		if !full || (!p.All && fetched >= from+p.Limit) {
+			if p.All {
+				return 0, fetched, false, nil
+			}
+			to = from + p.Limit
+			if to > fetched {
+				to = fetched
+			}
+			if from > to {
+				from = to
+			}
+			return from, to, fetched > to || full, nil
+		}
+		page++
+	}
+}
+
+// printListCount prints how many items were listed to stderr, so that it does not mix with the listed JSON, and how
+// to list more if the list continues.
+func printListCount(noun string, p listPaging, n int, more bool) {
+	if quietOutput {
+		return
+	}
+	switch {
+	case p.All:
+		fmt.Fprintf(os.Stderr, "%d %s in total.\n", n, noun)
+	case more:
+		fmt.Fprintf(os.Stderr, "Listed %d %s from offset %d. More may be available, use --offset %d or --all.\n",
+			n, noun, p.Offset, p.Offset+n)
+	default:
+		fmt.Fprintf(os.Stderr, "Listed %d %s from offset %d.\n", n, noun, p.Offset)
+	}
+	recordResultCount("listed", n)
+}
+
+// listCertificateStoresPage returns a page of certificate stores. The SDK has no certificate store list and the
+// client's list does not page, so the page is requested directly with the SDK's configuration.
+func listCertificateStoresPage(ctx context.Context, sdkClient *keyfactor.APIClient, query string, page int32, size int32) ([]api.GetCertificateStoreResponse, error) {
+	cfg := sdkClient.GetConfig()
+	params := url.Values{}
+	params.Set("pq.pageReturned", strconv.Itoa(int(page)))
+	params.Set("pq.returnLimit", strconv.Itoa(int(size)))
+	params.Set("pq.sortField", "Id")
+	params.Set("pq.sortAscending", "0")
+	if query != "" {
+		params.Set("pq.queryString", query)
+	}
+	endpoint := url.URL{Scheme: "https", Host: cfg.Host, Path: "/KeyfactorAPI/CertificateStores", RawQuery: params.Encode()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(cfg.BasicAuth.UserName, cfg.BasicAuth.Password)
+	req.Header.Set("x-keyfactor-requested-with", xKeyfactorRequestedWith)
+	req.Header.Set("x-keyfactor-api-version", xKeyfactorApiVersion)
+	req.Header.Set("Accept", "application/json")
+	for name, value := range cfg.DefaultHeader {
+		req.Header.Set(name, value)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s: %s", resp.Status, redactSecrets(string(body)))
+	}
+	var stores []api.GetCertificateStoreResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stores); err != nil {
+		return nil, fmt.Errorf("invalid response: %s", err)
+	}
+	return stores, nil
+}
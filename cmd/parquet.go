@@ -0,0 +1,241 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Minimal Apache Parquet support: required string columns, PLAIN encoded and uncompressed, written one row group at a
+// time so that large exports can be streamed. The file metadata is encoded with the Thrift compact protocol, see
+// parquet.thrift of the Parquet format specification for the structures and field IDs.
+
+const (
+	parquetMagic = "PAR1"
+
+	// Thrift compact protocol types.
+	thriftCompactI32    = 5
+	thriftCompactI64    = 6
+	thriftCompactBinary = 8
+	thriftCompactList   = 9
+	thriftCompactStruct = 12
+
+	// Parquet enum values.
+	parquetTypeByteArray      = 6
+	parquetRepetitionRequired = 0
+	parquetConvertedTypeUTF8  = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetCodecUncompressed  = 0
+	parquetPageTypeData       = 0
+)
+
+// thriftCompactWriter encodes a Thrift struct with the compact protocol. Structs, including the outermost one, are
+// written between beginStruct and endStruct.
+type thriftCompactWriter struct {
+	buf []byte
+	// lastField holds the last field ID written in each open struct, as field IDs are delta encoded.
+	lastField []int16
+}
+
+func (t *thriftCompactWriter) varint(v uint64) {
+	t.buf = binary.AppendUvarint(t.buf, v)
+}
+
+func (t *thriftCompactWriter) field(id int16, fieldType byte) {
+	top := len(t.lastField) - 1
+	if delta := id - t.lastField[top]; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|fieldType)
+	} else {
+		t.buf = append(t.buf, fieldType)
+		t.varint(uint64(uint16((id << 1) ^ (id >> 15))))
+	}
+	t.lastField[top] = id
+}
+
+func (t *thriftCompactWriter) beginStruct() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftCompactWriter) endStruct() {
+	t.buf = append(t.buf, 0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+// structField begins a struct field, to be ended with endStruct.
+func (t *thriftCompactWriter) structField(id int16) {
+	t.field(id, thriftCompactStruct)
+	t.beginStruct()
+}
+
+func (t *thriftCompactWriter) i32(id int16, v int32) {
+	t.field(id, thriftCompactI32)
+	t.i32Value(v)
+}
+
+func (t *thriftCompactWriter) i32Value(v int32) {
+	t.varint(uint64(uint32((v << 1) ^ (v >> 31))))
+}
+
+func (t *thriftCompactWriter) i64(id int16, v int64) {
+	t.field(id, thriftCompactI64)
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftCompactWriter) binary(id int16, v string) {
+	t.field(id, thriftCompactBinary)
+	t.binaryValue(v)
+}
+
+func (t *thriftCompactWriter) binaryValue(v string) {
+	t.varint(uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+// list begins a list field of n elements, which are written with the *Value methods or as structs.
+func (t *thriftCompactWriter) list(id int16, elemType byte, n int) {
+	t.field(id, thriftCompactList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elemType)
+	t.varint(uint64(n))
+}
+
+// parquetColumnChunk is the location of a column of a row group in the file.
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+}
+
+type parquetRowGroup struct {
+	columns []parquetColumnChunk
+	rows    int64
+	size    int64
+}
+
+// parquetWriter writes rows of string columns as a Parquet file. Each call to writeRowGroup writes a row group,
+// close writes the file metadata.
+type parquetWriter struct {
+	w         io.Writer
+	columns   []string
+	offset    int64
+	rows      int64
+	rowGroups []parquetRowGroup
+}
+
+func newParquetWriter(w io.Writer, columns []string) (*parquetWriter, error) {
+	p := &parquetWriter{w: w, columns: columns}
+	return p, p.write([]byte(parquetMagic))
+}
+
+func (p *parquetWriter) write(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// writeRowGroup writes rows, which have a value for each column, as a row group with a single data page per column.
+func (p *parquetWriter) writeRowGroup(rows [][]string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(len(rows))}
+	for c := range p.columns {
+		var data []byte
+		for _, row := range rows {
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(row[c])))
+			data = append(data, row[c]...)
+		}
+		if len(data) > math.MaxInt32 {
+			return fmt.Errorf("column %s of the row group is too large, use a smaller page size", p.columns[c])
+		}
+		var header thriftCompactWriter
+		header.beginStruct()
+		header.i32(1, parquetPageTypeData)
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.structField(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, parquetEncodingPlain)
+		// Required, non nested columns have no levels, the level encodings are required fields nevertheless.
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.endStruct()
+
+		chunk := parquetColumnChunk{offset: p.offset, size: int64(len(header.buf) + len(data))}
+		if err := p.write(header.buf); err != nil {
+			return err
+		}
+		if err := p.write(data); err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+		group.size += chunk.size
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows += group.rows
+	return nil
+}
+
+// close writes the file metadata. It does not close the underlying writer.
+func (p *parquetWriter) close() error {
+	var m thriftCompactWriter
+	m.beginStruct()
+	m.i32(1, 1)
+	m.list(2, thriftCompactStruct, len(p.columns)+1)
+	m.beginStruct()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(p.columns)))
+	m.endStruct()
+	for _, name := range p.columns {
+		m.beginStruct()
+		m.i32(1, parquetTypeByteArray)
+		m.i32(3, parquetRepetitionRequired)
+		m.binary(4, name)
+		m.i32(6, parquetConvertedTypeUTF8)
+		m.endStruct()
+	}
+	m.i64(3, p.rows)
+	m.list(4, thriftCompactStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		m.beginStruct()
+		m.list(1, thriftCompactStruct, len(group.columns))
+		for c, chunk := range group.columns {
+			m.beginStruct()
+			m.i64(2, chunk.offset)
+			m.structField(3)
+			m.i32(1, parquetTypeByteArray)
+			m.list(2, thriftCompactI32, 1)
+			m.i32Value(parquetEncodingPlain)
+			m.list(3, thriftCompactBinary, 1)
+			m.binaryValue(p.columns[c])
+			m.i32(4, parquetCodecUncompressed)
+			m.i64(5, group.rows)
+			m.i64(6, chunk.size)
+			m.i64(7, chunk.size)
+			m.i64(9, chunk.offset)
+			m.endStruct()
+			m.endStruct()
+		}
+		m.i64(2, group.size)
+		m.i64(3, group.rows)
+		m.endStruct()
+	}
+	m.binary(6, "kfutil")
+	m.endStruct()
+
+	if err := p.write(m.buf); err != nil {
+		return err
+	}
+	return p.write(append(binary.LittleEndian.AppendUint32(nil, uint32(len(m.buf))), parquetMagic...))
+}
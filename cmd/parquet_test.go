@@ -0,0 +1,230 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// thriftCompactReader decodes Thrift compact protocol structs into maps of field ID to value: int64 for integers,
+// string for binary, []interface{} for lists and map[int16]interface{} for structs.
+type thriftCompactReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *thriftCompactReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.t.Fatalf("thrift: unexpected end of data at %d", r.pos)
+	}
+	r.pos++
+	return r.buf[r.pos-1]
+}
+
+func (r *thriftCompactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("thrift: invalid varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftCompactReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftCompactReader) value(valueType byte) interface{} {
+	switch valueType {
+	case 4, 5, 6:
+		return r.zigzag()
+	case 8:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.buf[r.pos-n : r.pos])
+	case 9:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	}
+	r.t.Fatalf("thrift: unexpected type %d at %d", valueType, r.pos)
+	return nil
+}
+
+func (r *thriftCompactReader) readStruct() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+func TestThriftCompactWriter(t *testing.T) {
+	var w thriftCompactWriter
+	w.beginStruct()
+	w.i32(1, -3)
+	w.i64(2, 1<<40)
+	// A field ID delta over 15 and a decreasing ID use the long field header.
+	w.binary(20, "twenty")
+	w.structField(3)
+	w.i32(1, 7)
+	w.endStruct()
+	w.list(4, thriftCompactI32, 20)
+	for i := 0; i < 20; i++ {
+		w.i32Value(int32(i - 10))
+	}
+	w.i64(300, -1)
+	w.endStruct()
+
+	r := thriftCompactReader{t: t, buf: w.buf}
+	got := r.readStruct()
+	var list []interface{}
+	for i := 0; i < 20; i++ {
+		list = append(list, int64(i-10))
+	}
+	want := map[int16]interface{}{
+		1:   int64(-3),
+		2:   int64(1 << 40),
+		20:  "twenty",
+		3:   map[int16]interface{}{1: int64(7)},
+		4:   list,
+		300: int64(-1),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+	if r.pos != len(w.buf) {
+		t.Errorf("decoded %d of %d bytes", r.pos, len(w.buf))
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns := []string{"thumbprint", "cn", "locations"}
+	rowGroups := [][][]string{
+		{
+			{"A1B2", "www.example.com", "web01:/etc/ssl;web02:/etc/ssl"},
+			{"C3D4", "", ""},
+			{"E5F6", "Zürich CA", strings.Repeat("x", 300)},
+		},
+		{},
+		{
+			{"0709", "api.example.com", "k8s:trust/api"},
+		},
+	}
+	var buf bytes.Buffer
+	p, err := newParquetWriter(&buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rows := range rowGroups {
+		if err := p.writeRowGroup(rows); err != nil {
+			t.Fatalf("writeRowGroup() error = %v", err)
+		}
+	}
+	if err := p.close(); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatalf("file does not start and end with PAR1")
+	}
+	metaLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metaStart := len(file) - 8 - metaLen
+	r := thriftCompactReader{t: t, buf: file[:len(file)-8], pos: metaStart}
+	meta := r.readStruct()
+	if r.pos != len(file)-8 {
+		t.Fatalf("file metadata is %d bytes, footer length is %d", r.pos-metaStart, metaLen)
+	}
+
+	wantSchema := []interface{}{map[int16]interface{}{4: "schema", 5: int64(3)}}
+	for _, c := range columns {
+		wantSchema = append(wantSchema, map[int16]interface{}{1: int64(6), 3: int64(0), 4: c, 6: int64(0)})
+	}
+	if !reflect.DeepEqual(meta[2], wantSchema) {
+		t.Errorf("schema = %v, want %v", meta[2], wantSchema)
+	}
+	if meta[1] != int64(1) || meta[3] != int64(4) || meta[6] != "kfutil" {
+		t.Errorf("version, num_rows, created_by = %v, %v, %v, want 1, 4, kfutil", meta[1], meta[3], meta[6])
+	}
+
+	// Empty row groups are not written.
+	groups := meta[4].([]interface{})
+	if len(groups) != 2 {
+		t.Fatalf("%d row groups, want 2", len(groups))
+	}
+	wantRows := [][][]string{rowGroups[0], rowGroups[2]}
+	for g, group := range groups {
+		group := group.(map[int16]interface{})
+		if group[3] != int64(len(wantRows[g])) {
+			t.Errorf("row group %d num_rows = %v, want %d", g, group[3], len(wantRows[g]))
+		}
+		var groupSize int64
+		for c, chunk := range group[1].([]interface{}) {
+			chunk := chunk.(map[int16]interface{})
+			cm := chunk[3].(map[int16]interface{})
+			if cm[1] != int64(6) || cm[4] != int64(0) || cm[5] != int64(len(wantRows[g])) {
+				t.Errorf("row group %d column %d type, codec, num_values = %v, %v, %v", g, c, cm[1], cm[4], cm[5])
+			}
+			if !reflect.DeepEqual(cm[3], []interface{}{columns[c]}) {
+				t.Errorf("row group %d column %d path_in_schema = %v, want %s", g, c, cm[3], columns[c])
+			}
+			size := cm[7].(int64)
+			groupSize += size
+
+			// The chunk is a data page header followed by the PLAIN encoded values.
+			page := thriftCompactReader{t: t, buf: file, pos: int(cm[9].(int64))}
+			header := page.readStruct()
+			headerLen := int64(page.pos) - cm[9].(int64)
+			if header[1] != int64(0) || header[2] != header[3] || int64(header[2].(int64))+headerLen != size {
+				t.Errorf("row group %d column %d page header %v does not match the chunk size %d", g, c, header, size)
+			}
+			dataHeader := header[5].(map[int16]interface{})
+			if dataHeader[1] != int64(len(wantRows[g])) || dataHeader[2] != int64(0) {
+				t.Errorf("row group %d column %d data page header = %v", g, c, dataHeader)
+			}
+			data := file[page.pos : page.pos+int(header[2].(int64))]
+			for i, row := range wantRows[g] {
+				n := int(binary.LittleEndian.Uint32(data))
+				if got := string(data[4 : 4+n]); got != row[c] {
+					t.Errorf("row group %d column %d row %d = %q, want %q", g, c, i, got, row[c])
+				}
+				data = data[4+n:]
+			}
+			if len(data) != 0 {
+				t.Errorf("row group %d column %d has %d bytes after the values", g, c, len(data))
+			}
+		}
+		if group[2] != groupSize {
+			t.Errorf("row group %d total_byte_size = %v, want %d", g, group[2], groupSize)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Results of a permission check.
+const (
+	permissionPass    = "pass"
+	permissionFail    = "fail"
+	permissionUnknown = "unknown"
+)
+
+// preflightProbeMachine is a client machine no store has, so the store probe returns no stores.
+const preflightProbeMachine = "kfutil-preflight-probe"
+
+// permissionCheck is a permission a workflow needs. Read permissions are checked by probing an endpoint with a request
+// that returns little or nothing. Permissions that can't be probed without changing anything are checked against the
+// permissions the roles of the identity grant, by secured area and level, e.g. CertificateStoreManagement:Modify.
+type permissionCheck struct {
+	Name  string
+	Probe func(ctx context.Context, kfClient *api.Client, sdkClient *keyfactor.APIClient) error
+	// Areas are the names of the secured area, which differ between Keyfactor Command versions.
+	Areas []string
+	Level string
+}
+
+var (
+	permCertsRead = permissionCheck{Name: "Certificates: Read", Probe: func(ctx context.Context, _ *api.Client, sdkClient *keyfactor.APIClient) error {
+		_, _, err := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqReturnLimit(1).Execute()
+		return err
+	}}
+	permCertsDelete = permissionCheck{Name: "Certificates: Delete", Areas: []string{"Certificates"}, Level: "Delete"}
+	permStoresRead  = permissionCheck{Name: "Certificate stores: Read", Probe: func(_ context.Context, kfClient *api.Client, _ *keyfactor.APIClient) error {
+		params := map[string]interface{}{"ClientMachine": preflightProbeMachine}
+		_, err := kfClient.ListCertificateStores(&params)
+		return err
+	}}
+	permStoresSchedule = permissionCheck{Name: "Certificate stores: Schedule", Areas: []string{"CertificateStoreManagement", "CertificateStores"}, Level: "Schedule"}
+	permStoresModify   = permissionCheck{Name: "Certificate stores: Modify", Areas: []string{"CertificateStoreManagement", "CertificateStores"}, Level: "Modify"}
+	permStoreTypesRead = permissionCheck{Name: "Certificate store types: Read", Probe: func(_ context.Context, kfClient *api.Client, _ *keyfactor.APIClient) error {
+		_, err := kfClient.ListCertificateStoreTypes()
+		return err
+	}}
+	permAgentsRead = permissionCheck{Name: "Orchestrators: Read", Probe: func(ctx context.Context, _ *api.Client, sdkClient *keyfactor.APIClient) error {
+		_, _, err := sdkClient.AgentApi.AgentGetAgents(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqReturnLimit(1).Execute()
+		return err
+	}}
+	permJobsRead = permissionCheck{Name: "Orchestrator jobs: Read", Probe: func(ctx context.Context, _ *api.Client, sdkClient *keyfactor.APIClient) error {
+		_, _, err := sdkClient.OrchestratorJobApi.OrchestratorJobGetJobHistory(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqReturnLimit(1).Execute()
+		return err
+	}}
+	permCollectionsRead = permissionCheck{Name: "Certificate collections: Read", Probe: func(ctx context.Context, _ *api.Client, sdkClient *keyfactor.APIClient) error {
+		_, _, err := sdkClient.CertificateCollectionApi.CertificateCollectionGetCollections(ctx).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqReturnLimit(1).Execute()
+		return err
+	}}
+)
+
+// preflightWorkflows are the permissions each workflow of `preflight --for` needs.
+var preflightWorkflows = map[string][]permissionCheck{
+	"rot-audit":       {permCertsRead, permCollectionsRead, permStoresRead, permStoreTypesRead, permAgentsRead},
+	"rot-reconcile":   {permCertsRead, permCollectionsRead, permStoresRead, permStoreTypesRead, permAgentsRead, permJobsRead, permStoresSchedule, permStoresModify},
+	"certs-delete":    {permCertsRead, permCollectionsRead, permCertsDelete},
+	"stores-create":   {permStoresRead, permStoreTypesRead, permAgentsRead, permStoresModify},
+	"stores-snapshot": {permStoresRead, permStoreTypesRead},
+	"orchs-logs":      {permAgentsRead, permJobsRead},
+}
+
+func preflightWorkflowNames() []string {
+	names := make([]string, 0, len(preflightWorkflows))
+	for name := range preflightWorkflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// permissionResult is a line of the `preflight` checklist.
+type permissionResult struct {
+	Permission string `json:"permission"`
+	Result     string `json:"result"`
+	Method     string `json:"method"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// isPermissionError reports whether err is the API refusing a request of the identity.
+func isPermissionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "401") || strings.Contains(msg, "403") || strings.Contains(msg, "unauthorized") ||
+		strings.Contains(msg, "forbidden")
+}
+
+// normalizePermission lowercases a permission and drops its separators, so that CertificateStoreManagement:Modify
+// and /certificate_stores/modify/ can be compared.
+func normalizePermission(p string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(p))
+}
+
+// grantedPermission returns the roles that grant the permission of check, or nothing if none do.
+func grantedPermission(granted []keyfactor.ModelsSecurityIdentitiesPermissionRolesPairResponse, check permissionCheck) []string {
+	level := normalizePermission(check.Level)
+	for _, g := range granted {
+		p := normalizePermission(g.GetPermission())
+		for _, area := range check.Areas {
+			if strings.HasPrefix(p, normalizePermission(area)) && strings.HasSuffix(p, level) {
+				roles := g.GetGrantedByRoles()
+				if len(roles) == 0 {
+					roles = []string{"unknown role"}
+				}
+				return roles
+			}
+		}
+	}
+	return nil
+}
+
+// findSecurityIdentity returns the security identity of username, matched with or without its domain.
+func findSecurityIdentity(kfClient *api.Client, username string) (*api.GetSecurityIdentityResponse, error) {
+	identities, err := kfClient.GetSecurityIdentities()
+	if err != nil {
+		return nil, err
+	}
+	for i, identity := range identities {
+		accountName := identity.AccountName
+		if idx := strings.LastIndex(accountName, "\\"); idx >= 0 {
+			accountName = accountName[idx+1:]
+		}
+		if strings.EqualFold(accountName, username) || strings.EqualFold(identity.AccountName, username) {
+			return &identities[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// identityPermissions returns the secured area permissions of the authenticated identity.
+func identityPermissions(ctx context.Context, kfClient *api.Client, sdkClient *keyfactor.APIClient) ([]keyfactor.ModelsSecurityIdentitiesPermissionRolesPairResponse, error) {
+	username := os.Getenv("KEYFACTOR_USERNAME")
+	identity, err := findSecurityIdentity(kfClient, username)
+	if err != nil {
+		return nil, fmt.Errorf("reading security identities: %s", err)
+	}
+	if identity == nil {
+		return nil, fmt.Errorf("no security identity for %s", username)
+	}
+	perms, _, pErr := sdkClient.SecurityApi.SecurityIdentityPermissions(ctx, int32(identity.Id)).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).Execute()
+	if pErr != nil {
+		return nil, fmt.Errorf("reading permissions of %s: %s", identity.AccountName, pErr)
+	}
+	return perms.GetSecuredAreaPermissions(), nil
+}
+
+// runPermissionChecks runs the checks of a workflow. The permissions of the identity are only read if a check needs
+// them.
+func runPermissionChecks(ctx context.Context, kfClient *api.Client, sdkClient *keyfactor.APIClient, checks []permissionCheck) []permissionResult {
+	var granted []keyfactor.ModelsSecurityIdentitiesPermissionRolesPairResponse
+	var grantedErr error
+	grantedRead := false
+	results := make([]permissionResult, 0, len(checks))
+	for _, check := range checks {
+		if check.Probe != nil {
+			res := permissionResult{Permission: check.Name, Result: permissionPass, Method: "probe"}
+			if err := check.Probe(ctx, kfClient, sdkClient); err != nil {
+				res.Result = permissionFail
+				res.Detail = err.Error()
+				if !isPermissionError(err) {
+					res.Detail = fmt.Sprintf("probe failed: %s", err)
+				}
+			}
+			results = append(results, res)
+			continue
+		}
+		if !grantedRead {
+			granted, grantedErr = identityPermissions(ctx, kfClient, sdkClient)
+			grantedRead = true
+		}
+		res := permissionResult{Permission: check.Name, Method: "role"}
+		switch roles := grantedPermission(granted, check); {
+		case grantedErr != nil:
+			res.Result = permissionUnknown
+			res.Detail = grantedErr.Error()
+		case len(roles) > 0:
+			res.Result = permissionPass
+			res.Detail = fmt.Sprintf("granted by %s", strings.Join(roles, ", "))
+		default:
+			res.Result = permissionFail
+			res.Detail = "not granted by any role of the identity"
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func printPermissionResults(workflow string, results []permissionResult) {
+	fmt.Printf("Permissions for %s as %s:\n", workflow, os.Getenv("KEYFACTOR_USERNAME"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		mark := colorGreen + "✓" + colorWhite
+		switch r.Result {
+		case permissionFail:
+			mark = colorRed + "✗" + colorWhite
+		case permissionUnknown:
+			mark = colorYellow + "?" + colorWhite
+		}
+		if !isTerminal(os.Stdout) {
+			mark = map[string]string{permissionPass: "PASS", permissionFail: "FAIL", permissionUnknown: "????"}[r.Result]
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", mark, r.Permission, r.Method, r.Detail)
+	}
+	w.Flush()
+}
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight --for <workflow>",
+	Short: "Check that the authenticated identity has the API permissions a workflow needs.",
+	Long: `Checks the API permissions a kfutil workflow needs before a long run starts, and prints a pass/fail checklist.
+
+Read permissions are checked by probing their endpoints with requests that return little or nothing. Permissions
+that can't be probed without changing anything, e.g. scheduling store jobs or deleting certificates, are checked
+against the permissions the security roles of the identity grant. Reading those requires permission to read security
+settings; without it those checks are reported as unknown and do not fail the preflight.
+
+Exits with a non-zero status code if any check fails.`,
+	Example: `kfutil preflight --for rot-reconcile
+kfutil preflight --for certs-delete --json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		workflow, _ := cmd.Flags().GetString("for")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		checks, ok := preflightWorkflows[workflow]
+		if !ok {
+			fmt.Printf("[ERROR] unknown workflow '%s', must be one of %s\n", workflow, strings.Join(preflightWorkflowNames(), ", "))
+			log.Fatalf("[ERROR] unknown workflow: %s", workflow)
+		}
+		kfClient, cErr := initClient()
+		if cErr != nil {
+			fmt.Println("[ERROR] unable to connect to Keyfactor.")
+			log.Fatalf("[ERROR] %s", cErr)
+		}
+		ctx := commandContext(cmd)
+		results := runPermissionChecks(ctx, kfClient, initGenClient(), checks)
+		exitIfInterrupted(ctx, "the preflight did not finish")
+
+		failed := 0
+		for _, r := range results {
+			recordResultCount(r.Result, 1)
+			if r.Result == permissionFail {
+				failed++
+				recordResultFailure("%s: %s", r.Permission, r.Detail)
+			}
+		}
+		if jsonOut {
+			output, _ := json.MarshalIndent(results, "", "  ")
+			fmt.Println(string(output))
+		} else {
+			printPermissionResults(workflow, results)
+		}
+		if failed > 0 {
+			if !jsonOut {
+				fmt.Printf("[ERROR] %d of %d permission check(s) failed\n", failed, len(results))
+			}
+			finishResult(1)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(preflightCmd)
+	preflightCmd.Flags().String("for", "", fmt.Sprintf("Workflow to check, one of %s.", strings.Join(preflightWorkflowNames(), ", ")))
+	preflightCmd.Flags().Bool("json", false, "Print the checklist as JSON.")
+	preflightCmd.MarkFlagRequired("for")
+}
@@ -0,0 +1,106 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// readOnlyWriteCommands are the commands that write to Keyfactor and have no dry run to fall back to. They are refused in
+// read-only mode. Commands with a --dry-run flag are run as a dry run instead.
+var readOnlyWriteCommands = map[string]bool{
+	"import":              true,
+	"orchs approve":       true,
+	"orchs disapprove":    true,
+	"orchs reset":         true,
+	"pam create":          true,
+	"pam delete":          true,
+	"pam types-create":    true,
+	"pam update":          true,
+	"ssl networks create": true,
+	"ssl scan":            true,
+	"store-types update":  true,
+	"workflows approve":   true,
+	"workflows deny":      true,
+}
+
+// readOnly is whether the command runs in read-only mode, set before every command by enforceReadOnly.
+var readOnly bool
+
+// configReadOnly returns whether read_only is set in the config file, as a boolean or a string such as "true". A
+// missing or unreadable config file is not an error here, the commands that need it report it. A read_only value that
+// can not be parsed enables read-only mode, so that a mistyped setting does not allow writes.
+func configReadOnly() bool {
+	data, err := os.ReadFile(defaultConfigPath())
+	if err != nil {
+		return false
+	}
+	var config map[string]interface{}
+	if json.Unmarshal(data, &config) != nil {
+		return false
+	}
+	value, ok := config["read_only"]
+	if !ok || value == nil {
+		return false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		if enabled, pErr := strconv.ParseBool(strings.TrimSpace(v)); pErr == nil {
+			return enabled
+		}
+	}
+	log.Printf("[WARN] invalid read_only value %v in %s, read-only mode enabled", value, defaultConfigPath())
+	printWarning("Invalid read_only value %v in the config file, running in read-only mode\n", value)
+	return true
+}
+
+// enforceReadOnly enables read-only mode if --read-only or read_only of the config file is set. The config file can
+// not be overridden from the command line, so a read-only configuration stays read-only. In read-only mode commands
+// with a --dry-run flag are run as a dry run, `init` only plans, and the other commands that write to Keyfactor are
+// refused.
+func enforceReadOnly(cmd *cobra.Command) error {
+	flagReadOnly, _ := cmd.Flags().GetBool("read-only")
+	readOnly = flagReadOnly || configReadOnly()
+	if !readOnly {
+		return nil
+	}
+	name := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	if readOnlyWriteCommands[name] {
+		return fmt.Errorf("'%s' writes to Keyfactor and is not allowed in read-only mode", name)
+	}
+	if f := cmd.Flags().Lookup("dry-run"); f != nil {
+		if value := f.Value.String(); value != "" && value != "false" {
+			return nil
+		}
+		dryRun := "true"
+		if f.Value.Type() == "string" {
+			dryRun = dryRunClient
+		}
+		if err := cmd.Flags().Set("dry-run", dryRun); err != nil {
+			return err
+		}
+		printWarning("Read-only mode: running '%s' as a dry run\n", name)
+		log.Printf("[INFO] read-only mode, --dry-run set")
+		return nil
+	}
+	if apply, err := cmd.Flags().GetBool("apply"); err == nil && apply {
+		if err := cmd.Flags().Set("apply", "false"); err != nil {
+			return err
+		}
+		printWarning("Read-only mode: '%s' only shows the plan, --apply is ignored\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minSecretLength is the length below which registered secrets are not redacted by value, as short values such as
+// "1" would mask unrelated text. They are still redacted where they are assigned, see secretAssignmentPattern.
+const minSecretLength = 4
+
+// secretAssignmentPattern matches secrets assigned to a secret looking name in text, e.g. password=hunter2,
+// "ServerPassword": "hunter2" or Authorization: Bearer eyJ... The second group is the value.
+var secretAssignmentPattern = regexp.MustCompile(
+	`(?i)((?:password|passwd|secret|token|apikey|api_key|privatekey|credential|authorization)[a-z_]*"?\s*[:=]\s*"?(?:bearer\s+|basic\s+)?)([^"\s,&;}]+)`)
+
+// urlPasswordPattern matches the password of a URL with credentials, e.g. postgres://user:hunter2@db/kf.
+var urlPasswordPattern = regexp.MustCompile(`(://[^/\s:@]*:)[^@\s/]+@`)
+
+// secretValues are the secret values known to the command, such as the API password and PFX passwords, redacted
+// wherever they appear in output.
+var secretValues = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// registerSecret adds values to the secrets that are redacted from logs, status messages, errors, the --http-debug
+// dump and --result-json. Commands register secrets as soon as they read or generate them.
+func registerSecret(values ...string) {
+	secretValues.Lock()
+	defer secretValues.Unlock()
+	for _, v := range values {
+		if len(v) < minSecretLength {
+			continue
+		}
+		known := false
+		for _, s := range secretValues.values {
+			known = known || s == v
+		}
+		if !known {
+			secretValues.values = append(secretValues.values, v)
+		}
+	}
+	// Longest first, so a secret containing another is redacted as a whole.
+	sort.Slice(secretValues.values, func(i, j int) bool { return len(secretValues.values[i]) > len(secretValues.values[j]) })
+}
+
+// redactSecrets returns s with the registered secrets, URL passwords and the values of secret assignments replaced by
+// REDACTED.
+func redactSecrets(s string) string {
+	secretValues.RLock()
+	for _, v := range secretValues.values {
+		s = strings.ReplaceAll(s, v, redactedValue)
+	}
+	secretValues.RUnlock()
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+redactedValue+"@")
+	return secretAssignmentPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := secretAssignmentPattern.FindStringSubmatch(m)
+		if parts[2] == redactedValue {
+			return m
+		}
+		return parts[1] + redactedValue
+	})
+}
+
+// redactError returns err with secrets redacted from its message, see redactSecrets.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := redactSecrets(err.Error()); msg != err.Error() {
+		return fmt.Errorf("%s", msg)
+	}
+	return err
+}
+
+// redactingWriter redacts secrets from everything written to the underlying writer, e.g. the log output.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// registerEnvSecrets registers the secrets of the Keyfactor environment variables.
+func registerEnvSecrets() {
+	for _, name := range []string{"KEYFACTOR_PASSWORD", "KEYFACTOR_API_KEY", "KEYFACTOR_CLIENT_SECRET", "KEYFACTOR_ACCESS_TOKEN"} {
+		registerSecret(os.Getenv(name))
+	}
+}
+
+// recoverRedacted reports a panic with secrets redacted from its value and stack trace, instead of the default
+// output of the runtime, and exits with status 2 like an unrecovered panic. It is deferred by Execute.
+func recoverRedacted() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	msg := redactSecrets(fmt.Sprint(r))
+	fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", msg, redactSecrets(string(debug.Stack())))
+	recordResultFailure("panic: %s", msg)
+	finishResult(2)
+	os.Exit(2)
+}
@@ -0,0 +1,115 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+// withSecrets registers values for the duration of the test.
+func withSecrets(t *testing.T, values ...string) {
+	t.Helper()
+	secretValues.Lock()
+	saved := secretValues.values
+	secretValues.values = nil
+	secretValues.Unlock()
+	t.Cleanup(func() {
+		secretValues.Lock()
+		secretValues.values = saved
+		secretValues.Unlock()
+	})
+	registerSecret(values...)
+}
+
+func TestSecretAssignmentPattern(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantValue string
+	}{
+		{"key value", "password=hunter2", "hunter2"},
+		{"spaced colon", "client_secret : hunter2", "hunter2"},
+		{"JSON", `{"ServerPassword": "hunter2"}`, "hunter2"},
+		{"bearer token", "Authorization: Bearer eyJhbGciOi.e30.sig", "eyJhbGciOi.e30.sig"},
+		{"basic auth", "authorization: Basic dXNlcjpwYXNz", "dXNlcjpwYXNz"},
+		{"query parameter", "api_key=abc123&user=bob", "abc123"},
+		{"no assignment", "the password is required", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if m := secretAssignmentPattern.FindStringSubmatch(tt.text); m != nil {
+				got = m[2]
+			}
+			if got != tt.wantValue {
+				t.Errorf("secretAssignmentPattern value = %q, want %q", got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestURLPasswordPattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		match bool
+	}{
+		{"credentials", "postgres://kf:hunter2@db/kf", true},
+		{"user only", "postgres://kf@db/kf", false},
+		{"port", "https://keyfactor.example.com:8443/KeyfactorAPI", false},
+		{"port and path with at", "https://keyfactor.example.com:8443/users/@me", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := urlPasswordPattern.MatchString(tt.text); got != tt.match {
+				t.Errorf("urlPasswordPattern.MatchString(%q) = %t, want %t", tt.text, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	withSecrets(t, "s3cr3t-value", "s3cr3t", "ab")
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no secrets", "listed 3 stores", "listed 3 stores"},
+		{"registered secret", "login failed for s3cr3t-value", "login failed for REDACTED"},
+		{"longest secret first", "s3cr3t-value and s3cr3t", "REDACTED and REDACTED"},
+		{"short secret kept", "ab", "ab"},
+		{"assignment", "password=hunter2 user=bob", "password=REDACTED user=bob"},
+		{"JSON assignment", `{"StorePassword": "hunter2", "Id": 1}`, `{"StorePassword": "REDACTED", "Id": 1}`},
+		{"registered secret in assignment", "password=s3cr3t-value", "password=REDACTED"},
+		{"bearer token", "Authorization: Bearer eyJhbGciOi.e30.sig", "Authorization: Bearer REDACTED"},
+		{"URL password", "dial postgres://kf:hunter2@db/kf", "dial postgres://kf:REDACTED@db/kf"},
+		{"URL without password", "GET https://keyfactor.example.com:8443/KeyfactorAPI", "GET https://keyfactor.example.com:8443/KeyfactorAPI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactSecrets(tt.text); got != tt.want {
+				t.Errorf("redactSecrets(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	withSecrets(t, "s3cr3t-value")
+	if redactError(nil) != nil {
+		t.Error("redactError(nil) != nil")
+	}
+	plain := errors.New("not found")
+	if got := redactError(plain); got != plain {
+		t.Errorf("redactError() = %v, want the original error", got)
+	}
+	if got := redactError(errors.New("bad password s3cr3t-value")); got.Error() != "bad password REDACTED" {
+		t.Errorf("redactError() = %q, want %q", got, "bad password REDACTED")
+	}
+}
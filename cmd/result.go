@@ -0,0 +1,216 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Result statuses.
+const (
+	resultSuccess = "success"
+	resultFailed  = "failed"
+	// resultIncomplete is the status a --result-json file holds while the command runs. It remains if kfutil exits
+	// before the command finishes, e.g. on an error.
+	resultIncomplete = "incomplete"
+)
+
+// resultFDPrefix selects a file descriptor as the --result-json destination, e.g. fd:3.
+const resultFDPrefix = "fd:"
+
+// commandResult is the --result-json object of a command.
+type commandResult struct {
+	Command    string         `json:"command"`
+	Status     string         `json:"status"`
+	ExitCode   int            `json:"exit_code"`
+	Started    string         `json:"started"`
+	Finished   string         `json:"finished,omitempty"`
+	DurationMS int64          `json:"duration_ms"`
+	Counts     map[string]int `json:"counts"`
+	Artifacts  []string       `json:"artifacts"`
+	Failures   []string       `json:"failures"`
+	Ticket     string         `json:"ticket,omitempty"`
+}
+
+// resultRecorder collects the result of the command for --result-json. It is safe for concurrent use.
+type resultRecorder struct {
+	mu     sync.Mutex
+	dest   string
+	start  time.Time
+	result commandResult
+	done   bool
+}
+
+// cmdResult is the recorder of the running command, nil without --result-json.
+var cmdResult *resultRecorder
+
+// startResult starts recording the result of cmd if --result-json is set. A file destination is written right away
+// with status incomplete, so a run that exits early is not mistaken for a successful one.
+func startResult(cmd *cobra.Command) error {
+	dest, _ := cmd.Flags().GetString("result-json")
+	if dest == "" {
+		return nil
+	}
+	if strings.HasPrefix(dest, resultFDPrefix) {
+		if _, err := strconv.ParseUint(strings.TrimPrefix(dest, resultFDPrefix), 10, 32); err != nil {
+			return fmt.Errorf("invalid --result-json file descriptor '%s', expected e.g. fd:3", dest)
+		}
+	}
+	start := time.Now()
+	cmdResult = &resultRecorder{
+		dest:  dest,
+		start: start,
+		result: commandResult{
+			Command:   cmd.CommandPath(),
+			Status:    resultIncomplete,
+			ExitCode:  -1,
+			Started:   start.UTC().Format(time.RFC3339),
+			Counts:    make(map[string]int),
+			Artifacts: []string{},
+			Failures:  []string{},
+		},
+	}
+	if cmdResult.isFile() {
+		return cmdResult.write()
+	}
+	return nil
+}
+
+// isFile reports whether the result is written to a file that can be rewritten as the command runs.
+func (r *resultRecorder) isFile() bool {
+	return r.dest != stdioPath && !strings.HasPrefix(r.dest, resultFDPrefix) && !isCloudURL(r.dest)
+}
+
+func (r *resultRecorder) write() error {
+	data, err := json.MarshalIndent(r.result, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	switch {
+	case r.dest == stdioPath:
+		_, err = dataStdout.Write(data)
+	case strings.HasPrefix(r.dest, resultFDPrefix):
+		fd, _ := strconv.ParseUint(strings.TrimPrefix(r.dest, resultFDPrefix), 10, 32)
+		f := os.NewFile(uintptr(fd), r.dest)
+		if f == nil {
+			return fmt.Errorf("file descriptor %d is not open", fd)
+		}
+		_, err = f.Write(data)
+	case isCloudURL(r.dest):
+		// Not writeOutputFile, which records its outputs as artifacts of the result.
+		err = uploadToCloud(r.dest, data)
+	default:
+		err = os.WriteFile(r.dest, data, 0644)
+	}
+	return err
+}
+
+// update applies change to the result and rewrites a file destination.
+func (r *resultRecorder) update(change func(res *commandResult)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	change(&r.result)
+	if r.isFile() {
+		if err := r.write(); err != nil {
+			log.Printf("[WARN] writing result %s: %s", r.dest, err)
+		}
+	}
+}
+
+// recordResultArtifact records a file the command wrote. Stdout is not recorded.
+func recordResultArtifact(path string) {
+	if path == stdioPath || path == "" {
+		return
+	}
+	cmdResult.update(func(res *commandResult) {
+		for _, a := range res.Artifacts {
+			if a == path {
+				return
+			}
+		}
+		res.Artifacts = append(res.Artifacts, path)
+	})
+}
+
+// recordResultCount adds n to a count of the result, e.g. the number of certificates deleted.
+func recordResultCount(name string, n int) {
+	traceCount(name, n)
+	cmdResult.update(func(res *commandResult) {
+		res.Counts[name] += n
+	})
+}
+
+// recordResultFailure records a failure that did not stop the command, e.g. a failed reconcile action.
+func recordResultFailure(format string, a ...interface{}) {
+	cmdResult.update(func(res *commandResult) {
+		res.Failures = append(res.Failures, redactSecrets(fmt.Sprintf(format, a...)))
+	})
+}
+
+// recordRunResult records the counts and failures of a root of trust run.
+func recordRunResult(s rotRunSummary, failures []rotActionFailure) {
+	if s.Ticket != "" {
+		cmdResult.update(func(res *commandResult) {
+			res.Ticket = s.Ticket
+		})
+	}
+	recordResultCount("stores", s.Stores)
+	recordResultCount("add_actions", s.AddActions)
+	recordResultCount("remove_actions", s.RemoveActions)
+	recordResultCount("succeeded", s.Succeeded)
+	recordResultCount("failed", s.Failed)
+	recordResultCount("lookup_failures", len(s.LookupFailures))
+	for _, storeID := range s.LookupFailures {
+		recordResultFailure("store %s could not be looked up", storeID)
+	}
+	for _, f := range failures {
+		recordResultFailure("%s", f)
+	}
+}
+
+// finishResult writes the final result with the exit code of the command and exports the traces of --otel-endpoint.
+// It is called once, before kfutil exits.
+func finishResult(exitCode int) {
+	endTracing(exitCode)
+	r := cmdResult
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.result.ExitCode = exitCode
+	r.result.Status = resultSuccess
+	if exitCode != 0 {
+		r.result.Status = resultFailed
+	}
+	r.result.Finished = time.Now().UTC().Format(time.RFC3339)
+	r.result.DurationMS = time.Since(r.start).Milliseconds()
+	if err := r.write(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] writing result %s: %s\n", outputName(r.dest), err)
+		log.Printf("[ERROR] writing result: %s", err)
+	}
+	r.done = true
+}
@@ -18,6 +18,8 @@ import (
 )
 
 var colorRed = "\033[31m"
+var colorGreen = "\033[32m"
+var colorYellow = "\033[33m"
 var colorWhite = "\033[37m"
 
 var xKeyfactorRequestedWith = "APIClient"
@@ -29,7 +31,8 @@ func initClient() (*api.Client, error) {
 	clientAuth.Username = os.Getenv("KEYFACTOR_USERNAME")
 	log.Printf("[DEBUG] Username: %s", clientAuth.Username)
 	clientAuth.Password = os.Getenv("KEYFACTOR_PASSWORD")
-	log.Printf("[DEBUG] Password: %s", clientAuth.Password)
+	registerSecret(clientAuth.Password)
+	log.Printf("[DEBUG] Password: %s", redactSecrets(clientAuth.Password))
 	clientAuth.Domain = os.Getenv("KEYFACTOR_DOMAIN")
 	log.Printf("[DEBUG] Domain: %s", clientAuth.Domain)
 	clientAuth.Hostname = os.Getenv("KEYFACTOR_HOSTNAME")
@@ -40,12 +43,14 @@ func initClient() (*api.Client, error) {
 		clientAuth.Username = os.Getenv("KEYFACTOR_USERNAME")
 		log.Printf("[DEBUG] Username: %s", clientAuth.Username)
 		clientAuth.Password = os.Getenv("KEYFACTOR_PASSWORD")
-		log.Printf("[DEBUG] Password: %s", clientAuth.Password)
+		registerSecret(clientAuth.Password)
+		log.Printf("[DEBUG] Password: %s", redactSecrets(clientAuth.Password))
 		clientAuth.Domain = os.Getenv("KEYFACTOR_DOMAIN")
 		log.Printf("[DEBUG] Domain: %s", clientAuth.Domain)
 		clientAuth.Hostname = os.Getenv("KEYFACTOR_HOSTNAME")
 		log.Printf("[DEBUG] Hostname: %s", clientAuth.Hostname)
 	}
+	clientAuth.HTTPClient = legacyHTTPClient()
 	c, err := api.NewKeyfactorClient(&clientAuth)
 
 	if err != nil {
@@ -62,6 +67,7 @@ func initGenClient() *keyfactor.APIClient {
 		fmt.Printf("Error reading config file: %s\n", authErr)
 		log.Fatalf("[ERROR] reading config file: %s", authErr)
 	}
+	registerSecret(config["password"])
 	configuration := keyfactor.NewConfiguration(config)
 	c := keyfactor.NewAPIClient(configuration)
 	return c
@@ -71,19 +77,47 @@ func initGenClient() *keyfactor.APIClient {
 var RootCmd = &cobra.Command{
 	Use:   "kfutil",
 	Short: "Keyfactor CLI utilities",
-	Long:  `A CLI wrapper around the Keyfactor Platform API.`,
+	Long: `A CLI wrapper around the Keyfactor Platform API.
+
+Every flag can also be set with a KFUTIL_<FLAG> environment variable, e.g. KFUTIL_DRY_RUN=true for --dry-run, or in
+the "flags" section of the config file, e.g. "flags": {"dry-run": "client"}. A flag given on the command line takes
+precedence over its environment variable, which takes precedence over the config file, which takes precedence over the
+flag's default.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun:  rootPersistentPreRun,
+	PersistentPostRun: stopTracing,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := RootCmd.Execute()
+	defer recoverRedacted()
+	RootCmd.SetErr(redactingWriter{os.Stderr})
+	addCompletionInstallCmd()
+	ctx, stop := signalContext()
+	err := RootCmd.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	stop()
+	if deadlineExceeded() {
+		fmt.Println("[ERROR] command deadline exceeded")
+		recordResultFailure("command deadline exceeded")
+		finishResult(exitCodeDeadline)
+		os.Exit(exitCodeDeadline)
+	}
+	cancelCommandDeadline()
+	if interrupted {
+		recordResultFailure("interrupted")
+		finishResult(exitCodeInterrupted)
+		os.Exit(exitCodeInterrupted)
+	}
 	if err != nil {
+		recordResultFailure("%s", err)
+		finishResult(1)
 		os.Exit(1)
 	}
+	finishResult(0)
 }
 
 func init() {
@@ -96,6 +130,18 @@ func init() {
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	RootCmd.PersistentFlags().String("otel-endpoint", "", "OTLP/HTTP collector endpoint to export API call traces to, e.g. http://localhost:4318. Defaults to $OTEL_EXPORTER_OTLP_ENDPOINT.")
+	RootCmd.PersistentFlags().Bool("quiet", false, "Suppress progress and status messages. Errors and machine output are still written.")
+	RootCmd.PersistentFlags().String("color", colorAuto, "When to color status output: auto, always or never. auto disables colors when stdout is not a terminal or NO_COLOR is set.")
+	RootCmd.PersistentFlags().String("record", "", "Directory to record the API interactions of the command to, as sanitized JSON fixtures.")
+	RootCmd.PersistentFlags().String("replay", "", "Directory of fixtures recorded with --record to answer API requests from instead of Keyfactor.")
+	RootCmd.PersistentFlags().Duration("api-timeout", 0, "Timeout of each API call, e.g. 90s. Defaults to 30s for lookups, 1m for changes, 2m for lists and 5m for inventory calls.")
+	RootCmd.PersistentFlags().Duration("command-deadline", 0, "Maximum run time of the command, e.g. 4h. Long running commands stop cleanly when it is reached.")
+	RootCmd.PersistentFlags().String("http-debug", "", "File to append sanitized HTTP requests and responses of the command to, for diagnosing API errors. Use - for stderr.")
+	RootCmd.PersistentFlags().Bool("no-color", false, "Disable colored output, same as --color=never.")
+	RootCmd.PersistentFlags().String("schema-map", "", "YAML file mapping the column names of foreign CSV and spreadsheet inputs to kfutil columns, e.g. 'columns: {Fingerprint: Thumbprint, Host: StoreMachine}'.")
+	RootCmd.PersistentFlags().String("result-json", "", "Write a machine readable result of the command, with counts, duration, written files and failures, to this file when it finishes. Use - for stdout or fd:3 for file descriptor 3.")
+	RootCmd.PersistentFlags().Bool("read-only", false, "Never write to Keyfactor: commands with a dry run run as one, other commands that write are refused. Also enabled by read_only in the config file.")
 }
 
 func boolToPointer(b bool) *bool {
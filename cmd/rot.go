@@ -8,44 +8,39 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
 	"github.com/Keyfactor/keyfactor-go-client/api"
 	"github.com/spf13/cobra"
 	"io"
+	"kfutil/pkg/rot"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type templateType string
-type StoreCSVEntry struct {
-	ID          string          `json:"id"`
-	Type        string          `json:"type"`
-	Machine     string          `json:"address"`
-	Path        string          `json:"path"`
-	Thumbprints map[string]bool `json:"thumbprints,omitempty"`
-	Serials     map[string]bool `json:"serials,omitempty"`
-	Ids         map[int]bool    `json:"ids,omitempty"`
-}
+
+// StoreCSVEntry is a store read from a stores file, see rot.Store.
+type StoreCSVEntry = rot.Store
 type ROTCert struct {
 	ID         int                        `json:"id,omitempty"`
 	ThumbPrint string                     `json:"thumbprint,omitempty"`
 	CN         string                     `json:"cn,omitempty"`
 	Locations  []api.CertificateLocations `json:"locations,omitempty"`
 }
-type ROTAction struct {
-	StoreID    string `json:"store_id,omitempty"`
-	StoreType  string `json:"store_type,omitempty"`
-	StorePath  string `json:"store_path,omitempty"`
-	Thumbprint string `json:"thumbprint,omitempty"`
-	CertID     int    `json:"cert_id,omitempty" mapstructure:"CertID,omitempty"`
-	AddCert    bool   `json:"add,omitempty" mapstructure:"AddCert,omitempty"`
-	RemoveCert bool   `json:"remove,omitempty"  mapstructure:"RemoveCert,omitempty"`
-}
+
+// ROTAction is an add or remove action of a reconcile, see rot.Action.
+type ROTAction = rot.Action
 
 const (
 	tTypeCerts               templateType = "certs"
@@ -53,8 +48,8 @@ const (
 )
 
 var (
-	AuditHeader           = []string{"Thumbprint", "CertID", "SubjectName", "Issuer", "StoreID", "StoreType", "Machine", "Path", "AddCert", "RemoveCert", "Deployed", "AuditDate"}
-	ReconciledAuditHeader = []string{"Thumbprint", "CertID", "SubjectName", "Issuer", "StoreID", "StoreType", "Machine", "Path", "AddCert", "RemoveCert", "Deployed", "ReconciledDate"}
+	AuditHeader           = []string{"Thumbprint", "CertID", "SubjectName", "Issuer", "StoreID", "StoreType", "Machine", "Path", "AddCert", "RemoveCert", "Deployed", "AuditDate", "Uploaded", "Alias"}
+	ReconciledAuditHeader = []string{"Thumbprint", "CertID", "SubjectName", "Issuer", "StoreID", "StoreType", "Machine", "Path", "AddCert", "RemoveCert", "Deployed", "ReconciledDate", "Alias", "Ticket"}
 	StoreHeader           = []string{"StoreID", "StoreType", "StoreMachine", "StorePath", "ContainerId", "ContainerName", "LastQueriedDate"}
 	CertHeader            = []string{"Thumbprint", "SubjectName", "Issuer", "CertID", "Locations", "LastQueriedDate"}
 )
@@ -88,147 +83,234 @@ func templateTypeCompletion(cmd *cobra.Command, args []string, toComplete string
 	}, cobra.ShellCompDirectiveDefault
 }
 
-func generateAuditReport(addCerts map[string]string, removeCerts map[string]string, stores map[string]StoreCSVEntry, outpath string, kfClient *api.Client) ([][]string, map[string][]ROTAction, error) {
+// rotAuditGroup is a set of stores audited against the same certificates.
+type rotAuditGroup struct {
+	AddCerts    map[string]string
+	RemoveCerts map[string]string
+	Stores      map[string]StoreCSVEntry
+}
+
+// auditGroupAddCerts returns the union of the certificates to add of groups.
+func auditGroupAddCerts(groups []rotAuditGroup) map[string]string {
+	certs := make(map[string]string)
+	for _, group := range groups {
+		for k, v := range group.AddCerts {
+			certs[k] = v
+		}
+	}
+	return certs
+}
+
+// generateAuditReport audits the stores of each group, writes the report and returns its rows, the actions to take and
+// the path the report was written to. Certificates in uploaded are marked in the Uploaded column. See auditReportPath for how outpath and overwrite are handled.
+func generateAuditReport(ctx context.Context, groups []rotAuditGroup, uploaded map[string]bool, outpath string, overwrite bool, kfClient *api.Client) ([][]string, map[string][]ROTAction, string, error) {
 	log.Println("[DEBUG] generateAuditReport called")
 	var (
 		data [][]string
 	)
 
 	data = append(data, AuditHeader)
-	var csvFile *os.File
-	var fErr error
-	if outpath == "" {
-		csvFile, fErr = os.Create(reconcileDefaultFileName)
-		outpath = reconcileDefaultFileName
-	} else {
-		csvFile, fErr = os.Create(outpath)
+	outpath, pErr := auditReportPath(outpath, overwrite)
+	if pErr != nil {
+		return nil, nil, "", pErr
 	}
-
-	if fErr != nil {
-		fmt.Printf("%s", fErr)
-		log.Fatalf("[ERROR] creating audit file: %s", fErr)
+	// An .xlsx workbook is written from data once the report is complete, a CSV report is streamed as it is built.
+	var csvFile io.WriteCloser
+	csvWriter := csv.NewWriter(io.Discard)
+	if !isXlsxPath(outpath) {
+		var fErr error
+		csvFile, fErr = createOutput(outpath)
+		if fErr != nil {
+			fmt.Printf("%s", fErr)
+			log.Fatalf("[ERROR] creating audit file: %s", fErr)
+		}
+		csvWriter = csv.NewWriter(csvFile)
 	}
-	csvWriter := csv.NewWriter(csvFile)
 	cErr := csvWriter.Write(AuditHeader)
 	if cErr != nil {
 		fmt.Printf("%s", cErr)
 		log.Fatalf("[ERROR] writing audit header: %s", cErr)
 	}
-	actions := make(map[string][]ROTAction)
-
-	for _, cert := range addCerts {
-		certLookupReq := api.GetCertificateContextArgs{
-			IncludeMetadata:  boolToPointer(true),
-			IncludeLocations: boolToPointer(true),
-			CollectionId:     nil,
-			Thumbprint:       cert,
-			Id:               0,
+	result := &rot.AuditResult{Actions: make(map[string][]ROTAction), LookupErrors: make(map[string]error)}
+	storeIDs := make(map[string]bool)
+	for _, group := range groups {
+		req := rot.AuditRequest{Stores: group.Stores, CollectionID: rotCollectionID, MatchOn: rotMatchMode()}
+		for id := range group.Stores {
+			storeIDs[id] = true
 		}
-		certLookup, err := kfClient.GetCertificateContext(&certLookupReq)
-		if err != nil {
-			fmt.Printf("[ERROR] looking up certificate %s: %s\n", cert, err)
-			log.Printf("[ERROR] looking up cert: %s\n%v", cert, err)
-			continue
+		for _, cert := range group.AddCerts {
+			req.AddCerts = append(req.AddCerts, cert)
 		}
-		certID := certLookup.Id
-		certIDStr := strconv.Itoa(certID)
-		for _, store := range stores {
-			if _, ok := store.Thumbprints[cert]; ok {
-				// Cert is already in the store do nothing
-				row := []string{cert, certIDStr, certLookup.IssuedDN, certLookup.IssuerDN, store.ID, store.Type, store.Machine, store.Path, "false", "false", "true", GetCurrentTime()}
-				data = append(data, row)
-				wErr := csvWriter.Write(row)
-				if wErr != nil {
-					fmt.Printf("[ERROR] writing audit file row: %s\n", wErr)
-					log.Printf("[ERROR] writing audit row: %s", wErr)
-				}
-			} else {
-				// Cert is not deployed to this store and will need to be added
-				row := []string{cert, certIDStr, certLookup.IssuedDN, certLookup.IssuerDN, store.ID, store.Type, store.Machine, store.Path, "true", "false", "false", GetCurrentTime()}
-				data = append(data, row)
-				wErr := csvWriter.Write(row)
-				if wErr != nil {
-					fmt.Printf("[ERROR] writing audit file row: %s\n", wErr)
-					log.Printf("[ERROR] writing audit row: %s", wErr)
-				}
-				actions[cert] = append(actions[cert], ROTAction{
-					Thumbprint: cert,
-					CertID:     certID,
-					StoreID:    store.ID,
-					StoreType:  store.Type,
-					StorePath:  store.Path,
-					AddCert:    true,
-					RemoveCert: false,
-				})
-			}
+		for _, cert := range group.RemoveCerts {
+			req.RemoveCerts = append(req.RemoveCerts, cert)
+		}
+		groupResult, aErr := rot.Audit(ctx, kfClient, req)
+		if aErr != nil && !isCancelled(aErr) {
+			fmt.Printf("[ERROR] auditing stores: %s\n", aErr)
+			log.Fatalf("[ERROR] auditing stores: %s", aErr)
 		}
+		if groupResult == nil {
+			break
+		}
+		result.Entries = append(result.Entries, groupResult.Entries...)
+		for cert, certActions := range groupResult.Actions {
+			result.Actions[cert] = append(result.Actions[cert], certActions...)
+		}
+		for cert, lErr := range groupResult.LookupErrors {
+			result.LookupErrors[cert] = lErr
+		}
+		if aErr != nil {
+			break
+		}
+	}
+	for cert, lErr := range result.LookupErrors {
+		fmt.Printf("[ERROR] looking up certificate %s: %s\n", cert, lErr)
+		log.Printf("[ERROR] looking up cert: %s\n%v", cert, lErr)
 	}
-	for _, cert := range removeCerts {
-		certLookupReq := api.GetCertificateContextArgs{
-			IncludeMetadata:  boolToPointer(true),
-			IncludeLocations: boolToPointer(true),
-			CollectionId:     nil,
-			Thumbprint:       cert,
-			Id:               0,
+	for _, e := range result.Entries {
+		row := []string{e.Thumbprint, strconv.Itoa(e.CertID), e.SubjectDN, e.IssuerDN, e.Store.ID, e.Store.Type, e.Store.Machine, e.Store.Path,
+			strconv.FormatBool(e.Add), strconv.FormatBool(e.Remove), strconv.FormatBool(e.Deployed), GetCurrentTime(),
+			strconv.FormatBool(uploaded[strings.ToUpper(e.Thumbprint)]), e.Alias}
+		data = append(data, row)
+		if wErr := csvWriter.Write(row); wErr != nil {
+			fmt.Printf("[ERROR] writing audit file row: %s\n", wErr)
+			log.Printf("[ERROR] writing audit row: %s", wErr)
 		}
-		certLookup, err := kfClient.GetCertificateContext(&certLookupReq)
-		if err != nil {
-			log.Printf("[ERROR] looking up cert: %s", err)
+	}
+	actions := result.Actions
+	csvWriter.Flush()
+	if csvFile != nil {
+		if ioErr := csvFile.Close(); ioErr != nil {
+			fmt.Println(ioErr)
+			log.Printf("[ERROR] closing audit file: %s", ioErr)
+		}
+	}
+	if isXlsxPath(outpath) {
+		xErr := writeXlsxFile(outpath, []xlsxSheet{
+			// The audit sheet comes first so the report can be read back by reconcile.
+			{Name: "Audit", Rows: data},
+			{Name: "Summary", Rows: auditSummaryRows(data, len(storeIDs))},
+		})
+		if xErr != nil {
+			fmt.Printf("[ERROR] writing audit file %s: %s\n", outpath, xErr)
+			log.Fatalf("[ERROR] writing audit file: %s", xErr)
+		}
+	}
+	exitIfInterrupted(ctx, fmt.Sprintf("partial audit report written to %s", outputName(outpath)))
+	printInfo("Audit report written to %s\n", outputName(outpath))
+	return data, actions, outpath, nil
+}
+
+// auditSummaryRows summarises the rows of an audit report for the summary sheet of an .xlsx report.
+func auditSummaryRows(data [][]string, storeCount int) [][]string {
+	certs := make(map[string]bool)
+	adds, removes, deployed := 0, 0, 0
+	for _, row := range data[1:] {
+		certs[row[0]] = true
+		if row[8] == "true" {
+			adds++
+		}
+		if row[9] == "true" {
+			removes++
+		}
+		if row[10] == "true" && row[9] != "true" {
+			deployed++
+		}
+	}
+	return [][]string{
+		{"Metric", "Value"},
+		{"Stores audited", strconv.Itoa(storeCount)},
+		{"Certificates audited", strconv.Itoa(len(certs))},
+		{"Certificates to add", strconv.Itoa(adds)},
+		{"Certificates to remove", strconv.Itoa(removes)},
+		{"Certificates already deployed", strconv.Itoa(deployed)},
+		{"Audit date", GetCurrentTime()},
+	}
+}
+
+// timestampedAuditReportPath returns a new audit report path named after t, e.g. rot_audit_20230102T150405Z.csv. A
+// counter is appended if a report of the same second exists.
+func timestampedAuditReportPath(ext string, t time.Time) string {
+	base := fmt.Sprintf("%s_%s", strings.TrimSuffix(reconcileDefaultFileName, filepath.Ext(reconcileDefaultFileName)), t.UTC().Format("20060102T150405Z"))
+	path := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// auditReportPath returns the path to write an audit report to. Without outpath a timestamped report is created so
+// previous reports are kept. An existing local file is only replaced if overwrite is set.
+func auditReportPath(outpath string, overwrite bool) (string, error) {
+	if outpath == "" {
+		return timestampedAuditReportPath(".csv", time.Now()), nil
+	}
+	if outpath == stdioPath || isCloudURL(outpath) || overwrite {
+		return outpath, nil
+	}
+	if _, err := os.Stat(outpath); err == nil {
+		return "", fmt.Errorf("%s already exists, use --overwrite to replace it", outpath)
+	}
+	return outpath, nil
+}
+
+// auditReportNameRegex matches the names of timestamped audit reports and captures the timestamp and counter.
+var auditReportNameRegex = regexp.MustCompile(`^rot_audit_(\d{8}T\d{6}Z)(?:-(\d+))?\.csv$`)
+
+// latestAuditReportPath returns the audit report to read when path is the default report name and does not exist: the
+// newest timestamped report in the current directory. Otherwise path is returned unchanged.
+func latestAuditReportPath(path string) string {
+	if path != reconcileDefaultFileName {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	entries, _ := os.ReadDir(".")
+	latest, latestKey := "", ""
+	for _, e := range entries {
+		m := auditReportNameRegex.FindStringSubmatch(e.Name())
+		if m == nil {
 			continue
 		}
-		certID := certLookup.Id
-		certIDStr := strconv.Itoa(certID)
-		for _, store := range stores {
-			if _, ok := store.Thumbprints[cert]; ok {
-				// Cert is deployed to this store and will need to be removed
-				row := []string{cert, certIDStr, certLookup.IssuedDN, certLookup.IssuerDN, store.ID, store.Type, store.Machine, store.Path, "false", "true", "true", GetCurrentTime()}
-				data = append(data, row)
-				wErr := csvWriter.Write(row)
-				if wErr != nil {
-					fmt.Printf("%s", wErr)
-					log.Printf("[ERROR] writing row to CSV: %s", wErr)
-				}
-				actions[cert] = append(actions[cert], ROTAction{
-					Thumbprint: cert,
-					CertID:     certID,
-					StoreID:    store.ID,
-					StoreType:  store.Type,
-					StorePath:  store.Path,
-					AddCert:    false,
-					RemoveCert: true,
-				})
-			} else {
-				// Cert is not deployed to this store do nothing
-				row := []string{cert, certIDStr, certLookup.IssuedDN, certLookup.IssuerDN, store.ID, store.Type, store.Machine, store.Path, "false", "false", "false", GetCurrentTime()}
-				data = append(data, row)
-				wErr := csvWriter.Write(row)
-				if wErr != nil {
-					fmt.Printf("%s", wErr)
-					log.Printf("[ERROR] writing row to CSV: %s", wErr)
-				}
-			}
+		counter, _ := strconv.Atoi(m[2])
+		if key := fmt.Sprintf("%s-%06d", m[1], counter); key > latestKey {
+			latest, latestKey = e.Name(), key
 		}
 	}
-	csvWriter.Flush()
-	ioErr := csvFile.Close()
-	if ioErr != nil {
-		fmt.Println(ioErr)
-		log.Printf("[ERROR] closing audit file: %s", ioErr)
+	if latest == "" {
+		return path
+	}
+	printInfo("Using the latest audit report %s\n", latest)
+	return latest
+}
+
+// reconciledReportPath returns the path of the report reconcileRoots writes for an audit report.
+func reconciledReportPath(reportFile string) string {
+	if reportFile == stdioPath {
+		reportFile = reconcileDefaultFileName
 	}
-	fmt.Printf("Audit report written to %s\n", outpath)
-	return data, actions, nil
+	return fmt.Sprintf("%s_reconciled.csv", strings.TrimSuffix(reportFile, filepath.Ext(reportFile)))
 }
 
-func reconcileRoots(actions map[string][]ROTAction, kfClient *api.Client, reportFile string, dryRun bool) error {
+func reconcileRoots(actions map[string][]ROTAction, kfClient *api.Client, reportFile string, dryRun bool, runner *batchRunner, entryParams map[string]map[string]string) ([]rotActionFailure, error) {
 	log.Printf("[DEBUG] Reconciling roots")
 	if len(actions) == 0 {
 		log.Printf("[INFO] No actions to take, roots are up-to-date.")
-		return nil
+		return nil, nil
+	}
+	ctx := runner.ctx
+	if rotChangeTicket != "" {
+		log.Printf("[INFO] reconciling under change ticket %s", rotChangeTicket)
 	}
-	rFileName := fmt.Sprintf("%s_reconciled.csv", strings.Split(reportFile, ".csv")[0])
+	rFileName := reconciledReportPath(reportFile)
+	recordResultArtifact(rFileName)
 	csvFile, fErr := os.Create(rFileName)
 	if fErr != nil {
 		fmt.Printf("[ERROR] creating reconciled report file: %s", fErr)
+		log.Fatalf("[ERROR] creating reconciled report file: %s", fErr)
 	}
 	csvWriter := csv.NewWriter(csvFile)
 	cErr := csvWriter.Write(ReconciledAuditHeader)
@@ -236,113 +318,231 @@ func reconcileRoots(actions map[string][]ROTAction, kfClient *api.Client, report
 		fmt.Printf("%s", cErr)
 		log.Fatalf("[ERROR] writing audit header: %s", cErr)
 	}
-	for thumbprint, action := range actions {
-
-		for _, a := range action {
+	var csvMu sync.Mutex
+	writeReconciled := func(a ROTAction) {
+		csvMu.Lock()
+		defer csvMu.Unlock()
+		row := []string{a.Thumbprint, strconv.Itoa(a.CertID), "", "", a.StoreID, a.StoreType, "", a.StorePath,
+			strconv.FormatBool(a.AddCert), strconv.FormatBool(a.RemoveCert), strconv.FormatBool(a.AddCert), GetCurrentTime(), a.Alias, rotChangeTicket}
+		if wErr := csvWriter.Write(row); wErr != nil {
+			log.Printf("[ERROR] writing reconciled report row: %s", wErr)
+		}
+		// Flush every row so an interrupted reconcile leaves a complete report of what was done.
+		csvWriter.Flush()
+	}
+	var flat []ROTAction
+	for _, action := range actions {
+		flat = append(flat, action...)
+	}
+	storeCtx := newROTStoreContext(kfClient)
+	var (
+		sdkClient     *keyfactor.APIClient
+		sdkClientOnce sync.Once
+	)
+	// Actions for the same certificate are sent in one request for up to MaxStoresPerRequest stores. done and
+	// actionErrs are per action so a retried batch only resends what has not been applied.
+	maxStores := runner.opts.MaxStoresPerRequest
+	if maxStores == 0 {
+		maxStores = rot.DefaultMaxStoresPerRequest
+	}
+	batches := rot.BatchActions(flat, maxStores)
+	done := make([]bool, len(flat))
+	actionErrs := make([]error, len(flat))
+	errs := runner.run(len(batches), func(b int) error {
+		var (
+			entries  []api.CertificateStore
+			pending  []int
+			firstErr error
+		)
+		fail := func(i int, err error) {
+			actionErrs[i] = err
+			// Throttling takes precedence so the runner retries the batch.
+			if firstErr == nil || isRateLimitError(err) {
+				firstErr = err
+			}
+		}
+		for _, i := range batches[b] {
+			if done[i] {
+				continue
+			}
+			a := flat[i]
 			if a.AddCert {
-				log.Printf("[INFO] Adding cert %s to store %s(%s)", thumbprint, a.StoreID, a.StorePath)
-				if !dryRun {
-					cStore := api.CertificateStore{
-						CertificateStoreId: a.StoreID,
-						Overwrite:          true,
-					}
-					var stores []api.CertificateStore
-					stores = append(stores, cStore)
-					schedule := &api.InventorySchedule{
-						Immediate: boolToPointer(true),
-					}
-					addReq := api.AddCertificateToStore{
-						CertificateId:     a.CertID,
-						CertificateStores: &stores,
-						InventorySchedule: schedule,
+				log.Printf("[INFO] Adding cert %s to store %s(%s)", a.Thumbprint, a.StoreID, a.StorePath)
+				params, pErr := resolveEntryParams(a, storeCtx.storeType(a), entryParams)
+				if pErr != nil {
+					fmt.Printf("[ERROR] adding cert %s (%d) to store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, pErr)
+					fail(i, pErr)
+					continue
+				}
+				if dryRun {
+					printAdded("DRY RUN: Would have added cert %s to store %s\n", a.Thumbprint, a.StoreID)
+					log.Printf("[INFO] DRY RUN: Would have added cert %s from store %s", a.Thumbprint, a.StoreID)
+					done[i] = true
+					continue
+				}
+				cStore, hErr := storeCtx.handlerFor(a).addEntry(storeCtx, a)
+				if hErr != nil {
+					fmt.Printf("[ERROR] adding cert %s (%d) to store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, hErr)
+					fail(i, hErr)
+					continue
+				}
+				if len(params) > 0 {
+					// Entry parameters can differ per store, so these adds are sent one at a time.
+					if capErr := requireCapability(capAddJobFields); capErr != nil {
+						fmt.Printf("[ERROR] adding cert %s (%d) to store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, capErr)
+						fail(i, capErr)
+						continue
 					}
-					_, err := kfClient.AddCertificateToStores(&addReq)
+					sdkClientOnce.Do(func() { sdkClient = initGenClient() })
+					err := addCertificateWithEntryParams(sdkClient, a.CertID, cStore, params)
 					if err != nil {
-						fmt.Printf("[ERROR] adding cert %s (%d) to store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, err)
+						if !isRateLimitError(err) {
+							fmt.Printf("[ERROR] adding cert %s (%d) to store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, err)
+						}
+						fail(i, err)
 						continue
 					}
-				} else {
-					log.Printf("[INFO] DRY RUN: Would have added cert %s from store %s", thumbprint, a.StoreID)
+					done[i] = true
+					writeReconciled(a)
+					continue
 				}
+				entries = append(entries, cStore)
+				pending = append(pending, i)
 			} else if a.RemoveCert {
-				if !dryRun {
-					log.Printf("[INFO] Removing cert from store %s", a.StoreID)
-					cStore := api.CertificateStore{
-						CertificateStoreId: a.StoreID,
-						Alias:              a.Thumbprint,
-					}
-					var stores []api.CertificateStore
-					stores = append(stores, cStore)
-					schedule := &api.InventorySchedule{
-						Immediate: boolToPointer(true),
-					}
-					removeReq := api.RemoveCertificateFromStore{
-						CertificateId:     a.CertID,
-						CertificateStores: &stores,
-						InventorySchedule: schedule,
-					}
-					_, err := kfClient.RemoveCertificateFromStores(&removeReq)
-					if err != nil {
-						fmt.Printf("[ERROR] removing cert %s (ID: %d) from store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, err)
+				if dryRun {
+					printRemoved("DRY RUN: Would have removed cert %s from store %s\n", a.Thumbprint, a.StoreID)
+					log.Printf("[INFO] DRY RUN: Would have removed cert %s from store %s", a.Thumbprint, a.StoreID)
+					done[i] = true
+					continue
+				}
+				log.Printf("[INFO] Removing cert %s from store %s", rot.RemovalAlias(a), a.StoreID)
+				cStore, hErr := storeCtx.handlerFor(a).removeEntry(storeCtx, a)
+				if hErr != nil {
+					fmt.Printf("[ERROR] removing cert %s (ID: %d) from store %s (%s): %s\n", a.Thumbprint, a.CertID, a.StoreID, a.StorePath, hErr)
+					fail(i, hErr)
+					continue
+				}
+				// Reported in the reconciled report as the alias the certificate was removed by.
+				flat[i].Alias = cStore.Alias
+				entries = append(entries, cStore)
+				pending = append(pending, i)
+			} else {
+				done[i] = true
+			}
+		}
+		if len(pending) == 0 {
+			return firstErr
+		}
+
+		first := flat[pending[0]]
+		var err error
+		if first.AddCert {
+			err = rot.AddToStores(ctx, kfClient, first.CertID, entries)
+		} else {
+			err = rot.RemoveFromStores(ctx, kfClient, first.CertID, entries)
+		}
+		for _, i := range pending {
+			a := flat[i]
+			if err != nil {
+				if !isRateLimitError(err) && !isCancelled(err) {
+					verb, prep := "adding", "to"
+					if a.RemoveCert {
+						verb, prep = "removing", "from"
 					}
-				} else {
-					fmt.Printf("DRY RUN: Would have removed cert %s from store %s\n", thumbprint, a.StoreID)
-					log.Printf("[INFO] DRY RUN: Would have removed cert %s from store %s", thumbprint, a.StoreID)
+					fmt.Printf("[ERROR] %s cert %s (%d) %s store %s (%s): %s\n", verb, a.Thumbprint, a.CertID, prep, a.StoreID, a.StorePath, err)
 				}
+				fail(i, err)
+				continue
 			}
+			actionErrs[i] = nil
+			done[i] = true
+			writeReconciled(a)
 		}
+		return firstErr
+	})
+	csvWriter.Flush()
+	var failures []rotActionFailure
+	for i, a := range flat {
+		if !done[i] && actionErrs[i] != nil && !isCancelled(actionErrs[i]) {
+			failures = append(failures, rotActionFailure{Action: a, Err: actionErrs[i]})
+		}
+	}
+	if ioErr := csvFile.Close(); ioErr != nil {
+		fmt.Printf("[ERROR] closing reconciled report %s: %s\n", rFileName, ioErr)
+		log.Printf("[ERROR] closing reconciled report: %s", ioErr)
+	}
+	if !dryRun {
+		runner.printStats()
+	}
+	if ctx.Err() != nil {
+		var remaining []ROTAction
+		for b, batch := range batches {
+			for _, i := range batch {
+				if !done[i] && (isCancelled(actionErrs[i]) || (actionErrs[i] == nil && isCancelled(errs[b]))) {
+					remaining = append(remaining, flat[i])
+				}
+			}
+		}
+		checkpoint := rotCheckpointPath(reportFile)
+		if len(remaining) > 0 && !dryRun {
+			if cpErr := writeROTCheckpoint(checkpoint, remaining); cpErr != nil {
+				fmt.Printf("[ERROR] writing checkpoint %s: %s\n", checkpoint, cpErr)
+				log.Printf("[ERROR] writing checkpoint: %s", cpErr)
+			} else {
+				printWarning("%d action(s) were not applied. Resume with: kfutil stores rot reconcile --import-csv --input-file %s\n",
+					len(remaining), checkpoint)
+			}
+		}
+		exitIfInterrupted(ctx, fmt.Sprintf("reconcile stopped, completed actions are in %s", rFileName))
 	}
-	return nil
+	return failures, nil
 }
 
+// readCertsFile reads the thumbprints or certificate IDs of a certs file, or of a collection if certsFilePath is
+// collection:<name|id>.
 func readCertsFile(certsFilePath string, kfclient *api.Client) (map[string]string, error) {
+	if isCertsCollection(certsFilePath) {
+		return readCertsCollection(certsFilePath)
+	}
 	// Read in the cert CSV
-	csvFile, _ := os.Open(certsFilePath)
-	reader := csv.NewReader(bufio.NewReader(csvFile))
-	certEntries, _ := reader.ReadAll()
-	var certs = make(map[string]string)
-	for _, entry := range certEntries {
-		switch entry[0] {
-		case "CertID", "thumbprint", "id", "CertId", "Thumbprint":
-			continue // Skip header
-		}
-		certs[entry[0]] = entry[0]
+	certsFile, err := readTabularFile(certsFilePath, certInputColumns, nil)
+	if err != nil {
+		return nil, err
 	}
-	return certs, nil
+	return certsFromTable(certsFile), nil
 }
 
-func isRootStore(st *api.GetCertificateStoreResponse, invs *[]api.CertStoreInventory, minCerts int, maxKeys int, maxLeaf int) bool {
-	leafCount := 0
-	keyCount := 0
-	certCount := 0
-	for _, inv := range *invs {
-		log.Printf("[DEBUG] inv: %v", inv)
-		certCount += len(inv.Certificates)
-
-		for _, cert := range inv.Certificates {
-			if cert.IssuedDN != cert.IssuerDN {
-				leafCount++
-			}
-			if inv.Parameters["PrivateKeyEntry"] == "Yes" {
-				keyCount++
+// certsFromTable returns the thumbprints or certificate IDs of the rows of a certs file. Rows that only have a serial
+// number are looked up by it.
+func certsFromTable(certsFile *tabularFile) map[string]string {
+	certsFile.reportErrors()
+	var certs = make(map[string]string)
+	serials := &serialResolver{}
+	for _, row := range certsFile.Rows {
+		cert := row.Get("Thumbprint")
+		if cert == "" {
+			cert = row.Get("CertID")
+		}
+		if serial := row.Get("SerialNumber"); cert == "" && serial != "" {
+			var sErr error
+			if cert, sErr = serials.thumbprint(serial); sErr != nil {
+				fmt.Printf("[ERROR] %s line %d: %s\n", certsFile.Path, row.Line, sErr)
+				log.Printf("[ERROR] looking up serial %s: %s", serial, sErr)
+				continue
 			}
 		}
+		if cert == "" {
+			fmt.Printf("[ERROR] %s line %d: missing value for Thumbprint, CertID or SerialNumber\n", certsFile.Path, row.Line)
+			continue
+		}
+		certs[cert] = cert
 	}
-	if certCount < minCerts && minCerts >= 0 {
-		log.Printf("[DEBUG] Store %s has %d certs, less than the required count of %d", st.Id, certCount, minCerts)
-		return false
-	}
-	if leafCount > maxLeaf && maxLeaf >= 0 {
-		log.Printf("[DEBUG] Store %s has too many leaf certs", st.Id)
-		return false
-	}
-
-	if keyCount > maxKeys && maxKeys >= 0 {
-		log.Printf("[DEBUG] Store %s has too many keys", st.Id)
-		return false
-	}
+	return certs
+}
 
-	return true
+// rootStoreCriteria returns the criteria of the --min-certs, --max-keys and --max-leaf-certs flags.
+func rootStoreCriteria(minCerts int, maxKeys int, maxLeaves int) rot.RootStoreCriteria {
+	return rot.RootStoreCriteria{MinCerts: minCerts, MaxKeys: maxKeys, MaxLeaves: maxLeaves}
 }
 
 var (
@@ -356,7 +556,7 @@ kfutil stores rot generate-template --type certs
 kfutil stores rot generate-template --type stores
 Once those files are filled out you can use the following command to add the certs to the stores:
 kfutil stores rot audit --certs-file <certs-file> --stores-file <stores-file>
-Will generate a CSV report file 'rot_audit.csv' of what actions will be taken. If those actions are correct you can run
+Will generate a CSV report file 'rot_audit_<timestamp>.csv' of what actions will be taken. If those actions are correct you can run
 the following command to actually perform the actions:
 kfutil stores rot reconcile --certs-file <certs-file> --stores-file <stores-file>
 OR if you want to use the audit report file generated you can run this command:
@@ -383,8 +583,12 @@ kfutil stores rot reconcile --import-csv <audit-file>
 		PreRun:                 nil,
 		PreRunE:                nil,
 		Run: func(cmd *cobra.Command, args []string) {
-			var lookupFailures []string
+			var lookupFailures storeLookupFailures
+			resolveDBInputs(cmd)
 			kfClient, _ := initClient()
+			policyManifest := resolveROTManifest(cmd, kfClient)
+			resolveStoreTagInput(cmd, kfClient)
+			resolveStoreIDsInput(cmd, kfClient)
 			storesFile, _ := cmd.Flags().GetString("stores")
 			addRootsFile, _ := cmd.Flags().GetString("add-certs")
 			removeRootsFile, _ := cmd.Flags().GetString("remove-certs")
@@ -393,75 +597,135 @@ kfutil stores rot reconcile --import-csv <audit-file>
 			maxKeys, _ := cmd.Flags().GetInt("max-keys")
 			dryRun, _ := cmd.Flags().GetBool("dry-run")
 			outpath, _ := cmd.Flags().GetString("outpath")
+			reportFormat, _ := cmd.Flags().GetString("format")
+			switch {
+			case reportFormat == "xlsx" && outpath == stdioPath:
+				fmt.Println("[ERROR] xlsx reports cannot be written to stdout")
+				log.Fatalf("[ERROR] xlsx reports cannot be written to stdout")
+			case reportFormat == "xlsx" && outpath == "":
+				outpath = timestampedAuditReportPath(".xlsx", time.Now())
+			case reportFormat == "xlsx" && !isXlsxPath(outpath):
+				outpath = strings.TrimSuffix(outpath, filepath.Ext(outpath)) + ".xlsx"
+			case reportFormat != "" && reportFormat != "csv" && reportFormat != "xlsx":
+				fmt.Printf("[ERROR] invalid format '%s', must be one of csv or xlsx\n", reportFormat)
+				log.Fatalf("[ERROR] invalid format: %s", reportFormat)
+			}
+			metricsOut, _ := cmd.Flags().GetString("metrics-out")
+			historyDB, _ := cmd.Flags().GetString("history-db")
+			auditStart := time.Now()
+			checkChains, _ := cmd.Flags().GetBool("check-chains")
+			var allowedIssuers *issuerAllowList
+			if allowedIssuersFile, _ := cmd.Flags().GetString("allowed-issuers"); allowedIssuersFile != "" {
+				var aiErr error
+				if allowedIssuers, aiErr = readIssuerAllowList(allowedIssuersFile); aiErr != nil {
+					fmt.Printf("[ERROR] reading allowed issuers %s: %s\n", allowedIssuersFile, aiErr)
+					log.Fatalf("[ERROR] reading allowed issuers: %s", aiErr)
+				}
+			}
+			weakKeyPolicy := newKeyPolicyFromFlags(cmd)
+			detectDuplicates, removeSuperseded := duplicateRootsFromFlags(cmd)
+			addMissingIntermediates, _ := cmd.Flags().GetBool("add-missing-intermediates")
+			compareBundle, _ := cmd.Flags().GetString("compare-only")
+			storeCerts := make(map[string][]api.InventoriedCertificate)
 			// Read in the stores CSV
 			log.Printf("[DEBUG] storesFile: %s", storesFile)
 			log.Printf("[DEBUG] addRootsFile: %s", addRootsFile)
 			log.Printf("[DEBUG] removeRootsFile: %s", removeRootsFile)
 			log.Printf("[DEBUG] dryRun: %t", dryRun)
 			// Read in the stores CSV
-			csvFile, _ := os.Open(storesFile)
-			reader := csv.NewReader(bufio.NewReader(csvFile))
-			storeEntries, _ := reader.ReadAll()
+			storesTable, sfErr := readTabularFile(storesFile, StoreHeader, []string{"StoreID"})
+			if sfErr != nil {
+				fmt.Printf("[ERROR] reading stores file %s: %s\n", storesFile, sfErr)
+				log.Fatalf("[ERROR] reading stores file: %s", sfErr)
+			}
+			if !storesTable.HasHeader {
+				fmt.Printf("[ERROR] Invalid header in stores file. Expected: %s", strings.Join(StoreHeader, ","))
+				log.Fatalf("[ERROR] Stores CSV file is missing a valid header")
+			}
+			storesTable.reportErrors()
+			agePolicy := newInputAgePolicyFromFlags(cmd)
+			staleStores := agePolicy.check(storesTable, "LastQueriedDate", true)
+			invChecker := newStoreInventoryChecker(cmd, kfClient)
+			exclusions, eErr := newStoreExclusionsFromFlags(cmd, kfClient)
+			if eErr != nil {
+				fmt.Printf("[ERROR] %s\n", eErr)
+				log.Fatalf("[ERROR] %s", eErr)
+			}
+			excluded := 0
 			var stores = make(map[string]StoreCSVEntry)
-			validHeader := false
-			for _, entry := range storeEntries {
-				if strings.EqualFold(strings.Join(entry, ","), strings.Join(StoreHeader, ",")) {
-					validHeader = true
-					continue // Skip header
-				}
-				if !validHeader {
-					fmt.Printf("[ERROR] Invalid header in stores file. Expected: %s", strings.Join(StoreHeader, ","))
-					log.Fatalf("[ERROR] Stores CSV file is missing a valid header")
+			for _, row := range storesTable.Rows {
+				if commandContext(cmd).Err() != nil {
+					break
 				}
+				entry := row.Values(StoreHeader)
 				apiResp, err := kfClient.GetCertificateStoreByID(entry[0])
 				if err != nil {
-					log.Printf("[ERROR] getting cert store: %s", err)
-					_ = append(lookupFailures, strings.Join(entry, ","))
+					log.Printf("[ERROR] getting cert store %s: %s", entry[0], err)
+					lookupFailures = append(lookupFailures, storeLookupFailure{Entry: entry, Err: err})
 					continue
 				}
-
-				inventory, invErr := kfClient.GetCertStoreInventory(entry[0])
-				if invErr != nil {
-					log.Printf("[ERROR] getting cert store inventory for: %s\n%s", entry[0], invErr)
+				if reason, xErr := exclusions.excludes(apiResp); xErr != nil {
+					log.Printf("[ERROR] checking store exclusions of %s: %s", entry[0], xErr)
+					lookupFailures = append(lookupFailures, storeLookupFailure{Entry: entry, Err: xErr})
+					continue
+				} else if reason != "" {
+					log.Printf("[DEBUG] skipping store %s, %s", entry[0], reason)
+					excluded++
+					continue
 				}
+				entry = agePolicy.storeEntry(kfClient, entry, staleStores[row.Line], apiResp)
 
-				if !isRootStore(apiResp, inventory, minCerts, maxLeaves, maxKeys) {
-					fmt.Printf("Store %s is not a root store, skipping.\n", entry[0])
+				inventory, inventoried := invChecker.inventory(entry, apiResp)
+				if !inventoried {
+					if !invChecker.include {
+						continue
+					}
+				} else if !rot.IsRootStore(inventory, rootStoreCriteria(minCerts, maxKeys, maxLeaves)) {
+					printWarning("Store %s is not a root store, skipping.\n", entry[0])
 					log.Printf("[WARN] Store %s is not a root store", apiResp.Id)
 					continue
 				} else {
 					log.Printf("[INFO] Store %s is a root store", apiResp.Id)
 				}
 
-				stores[entry[0]] = StoreCSVEntry{
-					ID:          entry[0],
-					Type:        entry[1],
-					Machine:     entry[2],
-					Path:        entry[3],
-					Thumbprints: make(map[string]bool),
-					Serials:     make(map[string]bool),
-					Ids:         make(map[int]bool),
-				}
-				for _, cert := range *inventory {
-					thumb := cert.Thumbprints
-					for t, v := range thumb {
-						stores[entry[0]].Thumbprints[t] = v
-					}
-					for t, v := range cert.Serials {
-						stores[entry[0]].Serials[t] = v
-					}
-					for t, v := range cert.Ids {
-						stores[entry[0]].Ids[t] = v
+				stores[entry[0]] = rot.NewStore(rot.Store{
+					ID:      entry[0],
+					Type:    entry[1],
+					Machine: entry[2],
+					Path:    entry[3],
+				}, inventory)
+				if checkChains || allowedIssuers != nil || weakKeyPolicy != nil || detectDuplicates || compareBundle != "" {
+					for _, cert := range inventory {
+						storeCerts[entry[0]] = append(storeCerts[entry[0]], cert.Certificates...)
 					}
 				}
+			}
+			exitIfInterrupted(commandContext(cmd), "no audit report was written")
+			invChecker.report()
+			if excluded > 0 {
+				printInfo("Skipped %d store(s) excluded by --exclude-store-type or --exclude-container.\n", excluded)
+			}
 
+			if compareBundle != "" {
+				overwrite, _ := cmd.Flags().GetBool("overwrite")
+				reportPath, cErr := runBundleComparison(compareBundle, stores, storeCerts, outpath, overwrite)
+				if cErr != nil {
+					fmt.Printf("[ERROR] %s\n", cErr)
+					log.Fatalf("[ERROR] %s", cErr)
+				}
+				if lErr := lookupFailures.report(reportPath); lErr != nil {
+					fmt.Printf("[ERROR] writing lookup failures report: %s\n", lErr)
+					log.Fatalf("[ERROR] writing lookup failures report: %s", lErr)
+				}
+				exitOnLookupFailures(cmd, lookupFailures)
+				return
 			}
 
 			// Read in the add addCerts CSV
 			var certsToAdd = make(map[string]string)
 			if addRootsFile != "" {
 				var rcfErr error
-				certsToAdd, rcfErr = readCertsFile(addRootsFile, kfClient)
+				certsToAdd, rcfErr = readCertsFileWithAge(addRootsFile, kfClient, agePolicy)
 				if rcfErr != nil {
 					fmt.Printf("[ERROR] reading certs file %s: %s", addRootsFile, rcfErr)
 					log.Fatalf("[ERROR] reading addCerts file: %s", rcfErr)
@@ -478,7 +742,7 @@ kfutil stores rot reconcile --import-csv <audit-file>
 			var certsToRemove = make(map[string]string)
 			if removeRootsFile != "" {
 				var rcfErr error
-				certsToRemove, rcfErr = readCertsFile(removeRootsFile, kfClient)
+				certsToRemove, rcfErr = readCertsFileWithAge(removeRootsFile, kfClient, agePolicy)
 				if rcfErr != nil {
 					fmt.Printf("[ERROR] reading removeCerts file %s: %s", removeRootsFile, rcfErr)
 					log.Fatalf("[ERROR] reading removeCerts file: %s", rcfErr)
@@ -489,10 +753,110 @@ kfutil stores rot reconcile --import-csv <audit-file>
 				log.Printf("[DEBUG] No removeCerts file specified")
 				log.Printf("[DEBUG] No removeCerts = %s", certsToRemove)
 			}
-			_, _, gErr := generateAuditReport(certsToAdd, certsToRemove, stores, outpath, kfClient)
+			overwrite, _ := cmd.Flags().GetBool("overwrite")
+			groups := []rotAuditGroup{{AddCerts: certsToAdd, RemoveCerts: certsToRemove, Stores: stores}}
+			if policyManifest != nil {
+				groups, certsToAdd = policyManifest.auditGroups(stores, kfClient, agePolicy)
+			}
+			uploaded := uploadMissingCerts(cmd, kfClient, auditGroupAddCerts(groups), dryRun)
+			auditData, actions, reportPath, gErr := generateAuditReport(commandContext(cmd), groups, uploaded, outpath, overwrite, kfClient)
 			if gErr != nil {
+				fmt.Printf("[ERROR] generating audit report: %s\n", gErr)
 				log.Fatalf("[ERROR] generating audit report: %s", gErr)
 			}
+			if historyDB != "" {
+				recordAuditHistory(historyDB, auditData, outputName(reportPath), dryRun, auditStart)
+			}
+			if lErr := lookupFailures.report(reportPath); lErr != nil {
+				fmt.Printf("[ERROR] writing lookup failures report: %s\n", lErr)
+				log.Fatalf("[ERROR] writing lookup failures report: %s", lErr)
+			}
+
+			if checkChains {
+				rootDNs := make(map[string]bool)
+				for _, cert := range certsToAdd {
+					certLookup, found := lookupCertByThumbprint(kfClient, cert)
+					if !found {
+						continue
+					}
+					rootDNs[certLookup.IssuedDN] = true
+				}
+				issues := checkStoreChains(stores, storeCerts, rootDNs)
+				cErr := writeChainReport(issues, reportPath, addMissingIntermediates, initGenClient())
+				if cErr != nil {
+					fmt.Printf("[ERROR] writing chain validation report: %s\n", cErr)
+					log.Fatalf("[ERROR] writing chain validation report: %s", cErr)
+				}
+			}
+
+			if allowedIssuers != nil {
+				removeUnapproved, _ := cmd.Flags().GetBool("remove-unapproved")
+				violations := checkStoreIssuers(stores, storeCerts, allowedIssuers, certsToAdd, actions)
+				if iErr := writeIssuerReport(violations, reportPath, removeUnapproved && !dryRun); iErr != nil {
+					fmt.Printf("[ERROR] writing issuer report: %s\n", iErr)
+					log.Fatalf("[ERROR] writing issuer report: %s", iErr)
+				}
+			}
+
+			if weakKeyPolicy != nil {
+				removeWeak, _ := cmd.Flags().GetBool("remove-weak")
+				violations := checkStoreKeyPolicy(stores, storeCerts, weakKeyPolicy, kfClient, certsToAdd, actions)
+				if kErr := writeKeyPolicyReport(violations, reportPath, removeWeak && !dryRun); kErr != nil {
+					fmt.Printf("[ERROR] writing key policy report: %s\n", kErr)
+					log.Fatalf("[ERROR] writing key policy report: %s", kErr)
+				}
+			}
+
+			if detectDuplicates {
+				duplicates := findDuplicateRoots(stores, storeCerts)
+				dErr := writeDuplicateReport(duplicates, reportPath, removeSuperseded && !dryRun, stores, certsToAdd, actions)
+				if dErr != nil {
+					fmt.Printf("[ERROR] writing duplicate roots report: %s\n", dErr)
+					log.Fatalf("[ERROR] writing duplicate roots report: %s", dErr)
+				}
+			}
+
+			if metricsOut != "" {
+				certsMissing, certsToRemoveCount := 0, 0
+				for _, certActions := range actions {
+					for _, a := range certActions {
+						if a.AddCert {
+							certsMissing++
+						} else if a.RemoveCert {
+							certsToRemoveCount++
+						}
+					}
+				}
+				metrics := []promMetric{
+					{Name: "stores_scanned", Help: "Number of root of trust stores audited.", Type: "gauge", Value: float64(len(stores))},
+					{Name: "certs_missing", Help: "Number of certificate deployments missing from audited stores.", Type: "gauge", Value: float64(certsMissing)},
+					{Name: "certs_to_remove", Help: "Number of certificate deployments to remove from audited stores.", Type: "gauge", Value: float64(certsToRemoveCount)},
+					{Name: "lookup_failures", Help: "Number of stores that could not be looked up.", Type: "gauge", Value: float64(len(lookupFailures))},
+					{Name: "audit_duration_seconds", Help: "Duration of the audit run in seconds.", Type: "gauge", Value: time.Since(auditStart).Seconds()},
+					{Name: "last_run_timestamp_seconds", Help: "Unix timestamp of the last audit run.", Type: "gauge", Value: float64(auditStart.Unix())},
+				}
+				if mErr := writePrometheusMetrics(metricsOut, metrics); mErr != nil {
+					fmt.Printf("[ERROR] writing metrics file %s: %s\n", metricsOut, mErr)
+					log.Fatalf("[ERROR] writing metrics file: %s", mErr)
+				}
+			}
+
+			adds, removes, _ := countROTActions(actions)
+			summary := rotRunSummary{
+				Command:        "audit",
+				DryRun:         dryRun,
+				Stores:         len(stores),
+				AddActions:     adds,
+				RemoveActions:  removes,
+				LookupFailures: lookupFailures.storeIDs(),
+				Report:         outputName(reportPath),
+			}
+			notifyFromFlags(cmd, summary)
+			summary.ReportURL, _ = cmd.Flags().GetString("report-url")
+			reportCIRun(cmd, summary, actions, nil)
+			writeSummaryMarkdown(cmd, summary, actions, nil)
+			recordRunResult(summary, nil)
+			exitOnLookupFailures(cmd, lookupFailures)
 		},
 		RunE:                       nil,
 		PostRun:                    nil,
@@ -519,7 +883,11 @@ kfutil stores rot reconcile --import-csv <audit-file>
 		Long: `Root of Trust (rot): Will parse either a combination of CSV files that define certs to 
 add and/or certs to remove with a CSV of certificate stores or an audit CSV file. If an audit CSV file is provided, the 
 add and remove actions defined in the audit file will be immediately executed. If a combination of CSV files are provided,
-the utility will first generate an audit report and then execute the add/remove actions defined in the audit report.`,
+the utility will first generate an audit report and then execute the add/remove actions defined in the audit report.
+
+Use --ticket to record the change ticket that authorizes the run. Keyfactor Command add and remove jobs have no
+description field, so the ticket is recorded in the reconciled report, the notification and Markdown summary, and
+--result-json.`,
 		Example:                "",
 		ValidArgs:              nil,
 		ValidArgsFunction:      nil,
@@ -535,58 +903,142 @@ the utility will first generate an audit report and then execute the add/remove
 		PreRunE:                nil,
 		Run: func(cmd *cobra.Command, args []string) {
 			var lookupFailures []string
-			kfClient, _ := initClient()
+			resolveDBInputs(cmd)
 			storesFile, _ := cmd.Flags().GetString("stores")
 			addRootsFile, _ := cmd.Flags().GetString("add-certs")
 			isCSV, _ := cmd.Flags().GetBool("import-csv")
 			reportFile, _ := cmd.Flags().GetString("input-file")
+			if isCSV {
+				reportFile = latestAuditReportPath(reportFile)
+			}
+			if importFile, _ := cmd.Flags().GetString("import-file"); importFile != "" {
+				isCSV, reportFile = true, importFile
+			}
 			removeRootsFile, _ := cmd.Flags().GetString("remove-certs")
 			minCerts, _ := cmd.Flags().GetInt("min-certs")
 			maxLeaves, _ := cmd.Flags().GetInt("max-leaf-certs")
 			maxKeys, _ := cmd.Flags().GetInt("max-keys")
 			dryRun, _ := cmd.Flags().GetBool("dry-run")
 			outpath, _ := cmd.Flags().GetString("outpath")
+			entryParamFlags, _ := cmd.Flags().GetStringArray("entry-param")
 			log.Printf("[DEBUG] storesFile: %s", storesFile)
 			log.Printf("[DEBUG] addRootsFile: %s", addRootsFile)
 			log.Printf("[DEBUG] removeRootsFile: %s", removeRootsFile)
 			log.Printf("[DEBUG] dryRun: %t", dryRun)
 
+			entryParams, epErr := parseEntryParamFlags(entryParamFlags)
+			if epErr != nil {
+				fmt.Printf("[ERROR] %s\n", epErr)
+				log.Fatalf("[ERROR] %s", epErr)
+			}
+			if tErr := validateChangeTicket(); tErr != nil {
+				fmt.Printf("[ERROR] %s\n", tErr)
+				log.Fatalf("[ERROR] %s", tErr)
+			}
+			storeFilter, sfErr := newROTStoreFilterFromFlags(cmd)
+			if sfErr != nil {
+				fmt.Printf("[ERROR] %s\n", sfErr)
+				log.Fatalf("[ERROR] %s", sfErr)
+			}
+			filtered := 0
+			agePolicy := newInputAgePolicyFromFlags(cmd)
+
+			if requireApproval, _ := cmd.Flags().GetBool("require-approval"); requireApproval {
+				if !isCSV || reportFile == "" {
+					fmt.Println("[ERROR] --require-approval can only be used with --import-csv or --import-file and an approved audit report")
+					log.Fatalf("[ERROR] --require-approval used without an imported audit report")
+				}
+				manifestPath, _ := cmd.Flags().GetString("approval-manifest")
+				if manifestPath == "" {
+					manifestPath = approvalManifestPath(reportFile)
+				}
+				manifest, aErr := verifyApproval(reportFile, manifestPath)
+				if aErr != nil {
+					fmt.Printf("[ERROR] %s\n", aErr)
+					log.Fatalf("[ERROR] verifying approval: %s", aErr)
+				}
+				approval := fmt.Sprintf("Audit report approved by %s at %s", manifest.Approver, manifest.ApprovedAt.Format(time.RFC3339))
+				if manifest.Ticket != "" {
+					approval += fmt.Sprintf(" (ticket %s)", manifest.Ticket)
+				}
+				printInfo("%s\n", approval)
+			}
+
+			kfClient, _ := initClient()
+			exclusions, eErr := newStoreExclusionsFromFlags(cmd, kfClient)
+			if eErr != nil {
+				fmt.Printf("[ERROR] %s\n", eErr)
+				log.Fatalf("[ERROR] %s", eErr)
+			}
+			if retryFailed, _ := cmd.Flags().GetString("retry-failed"); retryFailed != "" {
+				actions, rfErr := readFailedActions(retryFailed)
+				if rfErr != nil {
+					fmt.Printf("[ERROR] reading failed actions: %s\n", rfErr)
+					log.Fatalf("[ERROR] reading failed actions: %s", rfErr)
+				}
+				if len(actions) == 0 {
+					printInfo("No failed actions to retry in %s. Exiting.\n", retryFailed)
+					return
+				}
+				actions = preflightActions(cmd, kfClient, actions)
+				if len(actions) == 0 {
+					printInfo("No reconciliation actions can be run. Exiting.\n")
+					return
+				}
+				runner := newBatchRunnerFromFlags(cmd)
+				failures, rErr := reconcileRoots(actions, kfClient, retryFailed, dryRun, runner, entryParams)
+				if rErr != nil {
+					fmt.Printf("[ERROR] reconciling roots: %s", rErr)
+					log.Fatalf("[ERROR] reconciling roots: %s", rErr)
+				}
+				printInfo("Retry completed. Check orchestrator jobs for details.\n")
+				summary := reconcileSummary(actions, dryRun, runner, nil, reconciledReportPath(retryFailed))
+				notifyFromFlags(cmd, summary)
+				summary.ReportURL, _ = cmd.Flags().GetString("report-url")
+				reportCIRun(cmd, summary, actions, failures)
+				writeSummaryMarkdown(cmd, summary, actions, failures)
+				recordRunResult(summary, failures)
+				writeFailedActions(cmd, failures, dryRun)
+				return
+			}
+			var policyManifest *rotManifest
+			if !isCSV {
+				policyManifest = resolveROTManifest(cmd, kfClient)
+				resolveStoreTagInput(cmd, kfClient)
+				resolveStoreIDsInput(cmd, kfClient)
+				storesFile, _ = cmd.Flags().GetString("stores")
+			}
+
 			// Parse existing audit report
 			if isCSV && reportFile != "" {
 				log.Printf("[DEBUG] isCSV: %t", isCSV)
 				log.Printf("[DEBUG] reportFile: %s", reportFile)
 				// Read in the CSV
-				csvFile, err := os.Open(reportFile)
-				if err != nil {
-					fmt.Printf("[ERROR] opening file: %s", err)
-					log.Fatalf("[ERROR] opening CSV file: %s", err)
-				}
-				validHeader := false
-
-				aCSV := csv.NewReader(csvFile)
-				aCSV.FieldsPerRecord = -1
-				inFile, cErr := aCSV.ReadAll()
+				auditTable, cErr := readAuditReport(reportFile)
 				if cErr != nil {
-					fmt.Printf("[ERROR] reading CSV file: %s", cErr)
-					log.Fatalf("[ERROR] reading CSV file: %s", cErr)
+					fmt.Printf("[ERROR] reading audit report: %s", cErr)
+					log.Fatalf("[ERROR] reading audit report: %s", cErr)
+				}
+				agePolicy.check(auditTable, "AuditDate", false)
+				if !auditTable.HasHeader {
+					fmt.Printf("[ERROR] Invalid header in stores file. Expected: %s", strings.Join(AuditHeader, ","))
+					log.Fatalf("[ERROR] Stores CSV file is missing a valid header")
 				}
+				auditTable.reportErrors()
 				actions := make(map[string][]ROTAction)
 				fieldMap := make(map[int]string)
 				for i, field := range AuditHeader {
 					fieldMap[i] = field
 				}
-				for ri, row := range inFile {
-					if strings.EqualFold(strings.Join(row, ","), strings.Join(AuditHeader, ",")) {
-						validHeader = true
-						continue // Skip header
-					}
-					if !validHeader {
-						fmt.Printf("[ERROR] Invalid header in stores file. Expected: %s", strings.Join(AuditHeader, ","))
-						log.Fatalf("[ERROR] Stores CSV file is missing a valid header")
-					}
+				for _, tRow := range auditTable.Rows {
+					ri := tRow.Line
+					row := tRow.Values(AuditHeader)
 					action := make(map[string]interface{})
 
 					for i, field := range row {
+						if field == "" {
+							continue
+						}
 						fieldInt, iErr := strconv.Atoi(field)
 						if iErr != nil {
 							log.Printf("[DEBUG] Field %s is not an int", field)
@@ -646,11 +1098,25 @@ the utility will first generate an audit report and then execute the add/remove
 						log.Printf("[ERROR] Invalid action: %v", action)
 						continue
 					}
+					if machine, _ := action["Machine"].(string); !storeFilter.allows(sId, machine) {
+						log.Printf("[DEBUG] skipping row %d, store %s on %s is excluded by the store filters", ri, sId, machine)
+						filtered++
+						continue
+					}
+					if reason, xErr := exclusions.excludesID(sId); xErr != nil {
+						fmt.Printf("[ERROR] checking store exclusions of row %d: %s\n", ri, xErr)
+						log.Printf("[ERROR] checking store exclusions: %s", xErr)
+						continue
+					} else if reason != "" {
+						log.Printf("[DEBUG] skipping row %d, store %s: %s", ri, sId, reason)
+						filtered++
+						continue
+					}
 					if cid == -1 && tp != "" {
 						certLookupReq := api.GetCertificateContextArgs{
 							IncludeMetadata:  boolToPointer(true),
 							IncludeLocations: boolToPointer(true),
-							CollectionId:     nil,
+							CollectionId:     rotCollectionArg(),
 							Thumbprint:       tp,
 							Id:               0,
 						}
@@ -664,37 +1130,68 @@ the utility will first generate an audit report and then execute the add/remove
 					}
 
 					a := ROTAction{
-						StoreID:    sId,
-						StoreType:  sType,
-						StorePath:  sPath,
-						Thumbprint: tp,
-						CertID:     cid,
-						AddCert:    addCert,
-						RemoveCert: removeCert,
+						StoreID:         sId,
+						StoreType:       sType,
+						StorePath:       sPath,
+						Thumbprint:      tp,
+						CertID:          cid,
+						AddCert:         addCert,
+						RemoveCert:      removeCert,
+						Alias:           tRow.Get("Alias"),
+						EntryParameters: entryParamsFromRow(tRow),
 					}
 
 					actions[a.Thumbprint] = append(actions[a.Thumbprint], a)
 				}
+				if filtered > 0 {
+					printInfo("Skipped %d row(s) of stores excluded by the store filters.\n", filtered)
+				}
 				if len(actions) == 0 {
-					fmt.Println("No reconciliation actions to take, root stores are up-to-date. Exiting.")
+					printInfo("No reconciliation actions to take, root stores are up-to-date. Exiting.\n")
 					return
 				}
-				rErr := reconcileRoots(actions, kfClient, reportFile, dryRun)
+				actions = preflightActions(cmd, kfClient, actions)
+				if len(actions) == 0 {
+					printInfo("No reconciliation actions can be run. Exiting.\n")
+					return
+				}
+				runner := newBatchRunnerFromFlags(cmd)
+				failures, rErr := reconcileRoots(actions, kfClient, reportFile, dryRun, runner, entryParams)
 				if rErr != nil {
 					fmt.Printf("[ERROR] reconciling roots: %s", rErr)
 					log.Fatalf("[ERROR] reconciling roots: %s", rErr)
 				}
-				defer csvFile.Close()
-				fmt.Println("Reconciliation completed. Check orchestrator jobs for details.")
+				if dryRun {
+					reportProjectedStates(cmd, actions, kfClient)
+				}
+				printInfo("Reconciliation completed. Check orchestrator jobs for details.\n")
+				summary := reconcileSummary(actions, dryRun, runner, nil, reconciledReportPath(reportFile))
+				notifyFromFlags(cmd, summary)
+				summary.ReportURL, _ = cmd.Flags().GetString("report-url")
+				reportCIRun(cmd, summary, actions, failures)
+				writeSummaryMarkdown(cmd, summary, actions, failures)
+				recordRunResult(summary, failures)
+				writeFailedActions(cmd, failures, dryRun)
 			} else {
 				// Read in the stores CSV
-				csvFile, _ := os.Open(storesFile)
-				reader := csv.NewReader(bufio.NewReader(csvFile))
-				storeEntries, _ := reader.ReadAll()
+				storesTable, sfErr := readTabularFile(storesFile, StoreHeader, []string{"StoreID"})
+				if sfErr != nil {
+					fmt.Printf("[ERROR] reading stores file %s: %s\n", storesFile, sfErr)
+					log.Fatalf("[ERROR] reading stores file: %s", sfErr)
+				}
+				storesTable.reportErrors()
+				staleStores := agePolicy.check(storesTable, "LastQueriedDate", true)
+				invChecker := newStoreInventoryChecker(cmd, kfClient)
 				var stores = make(map[string]StoreCSVEntry)
-				for i, entry := range storeEntries {
-					if entry[0] == "StoreID" || entry[0] == "StoreId" || i == 0 {
-						continue // Skip header
+				for _, row := range storesTable.Rows {
+					if commandContext(cmd).Err() != nil {
+						break
+					}
+					entry := row.Values(StoreHeader)
+					if !storeFilter.allows(entry[0], entry[2]) {
+						log.Printf("[DEBUG] skipping store %s on %s, excluded by the store filters", entry[0], entry[2])
+						filtered++
+						continue
 					}
 					apiResp, err := kfClient.GetCertificateStoreByID(entry[0])
 					if err != nil {
@@ -702,45 +1199,44 @@ the utility will first generate an audit report and then execute the add/remove
 						lookupFailures = append(lookupFailures, entry[0])
 						continue
 					}
-					inventory, invErr := kfClient.GetCertStoreInventory(entry[0])
-					if invErr != nil {
-						log.Fatalf("[ERROR] getting cert store inventory: %s", invErr)
+					if reason, xErr := exclusions.excludes(apiResp); xErr != nil {
+						log.Printf("[ERROR] checking store exclusions of %s: %s", entry[0], xErr)
+						lookupFailures = append(lookupFailures, entry[0])
+						continue
+					} else if reason != "" {
+						log.Printf("[DEBUG] skipping store %s, %s", entry[0], reason)
+						filtered++
+						continue
 					}
-
-					if !isRootStore(apiResp, inventory, minCerts, maxLeaves, maxKeys) {
+					entry = agePolicy.storeEntry(kfClient, entry, staleStores[row.Line], apiResp)
+					inventory, inventoried := invChecker.inventory(entry, apiResp)
+					if !inventoried {
+						if !invChecker.include {
+							continue
+						}
+					} else if !rot.IsRootStore(inventory, rootStoreCriteria(minCerts, maxKeys, maxLeaves)) {
 						log.Printf("[WARN] Store %s is not a root store", apiResp.Id)
 						continue
 					} else {
 						log.Printf("[INFO] Store %s is a root store", apiResp.Id)
 					}
 
-					stores[entry[0]] = StoreCSVEntry{
-						ID:          entry[0],
-						Type:        entry[1],
-						Machine:     entry[2],
-						Path:        entry[3],
-						Thumbprints: make(map[string]bool),
-						Serials:     make(map[string]bool),
-						Ids:         make(map[int]bool),
-					}
-					for _, cert := range *inventory {
-						thumb := cert.Thumbprints
-						for t, v := range thumb {
-							stores[entry[0]].Thumbprints[t] = v
-						}
-						for t, v := range cert.Serials {
-							stores[entry[0]].Serials[t] = v
-						}
-						for t, v := range cert.Ids {
-							stores[entry[0]].Ids[t] = v
-						}
-					}
-
+					stores[entry[0]] = rot.NewStore(rot.Store{
+						ID:      entry[0],
+						Type:    entry[1],
+						Machine: entry[2],
+						Path:    entry[3],
+					}, inventory)
 				}
+				exitIfInterrupted(commandContext(cmd), "no changes were made")
+				invChecker.report()
 				if len(lookupFailures) > 0 {
 					fmt.Printf("[ERROR] the following stores were not found: %s", strings.Join(lookupFailures, ","))
 					log.Fatalf("[ERROR] the following stores were not found: %s", strings.Join(lookupFailures, ","))
 				}
+				if filtered > 0 {
+					printInfo("Skipped %d store(s) excluded by the store filters.\n", filtered)
+				}
 				if len(stores) == 0 {
 					fmt.Println("[ERROR] no root stores found. Exiting.")
 					log.Fatalf("[ERROR] No root stores found. Exiting.")
@@ -748,7 +1244,7 @@ the utility will first generate an audit report and then execute the add/remove
 				// Read in the add addCerts CSV
 				var certsToAdd = make(map[string]string)
 				if addRootsFile != "" {
-					certsToAdd, _ = readCertsFile(addRootsFile, kfClient)
+					certsToAdd, _ = readCertsFileWithAge(addRootsFile, kfClient, agePolicy)
 					log.Printf("[DEBUG] ROT add certs called")
 				} else {
 					log.Printf("[INFO] No addCerts file specified")
@@ -757,28 +1253,53 @@ the utility will first generate an audit report and then execute the add/remove
 				// Read in the remove removeCerts CSV
 				var certsToRemove = make(map[string]string)
 				if removeRootsFile != "" {
-					certsToRemove, _ = readCertsFile(removeRootsFile, kfClient)
+					certsToRemove, _ = readCertsFileWithAge(removeRootsFile, kfClient, agePolicy)
 					log.Printf("[DEBUG] ROT remove certs called")
 				} else {
 					log.Printf("[DEBUG] No removeCerts file specified")
 				}
-				_, actions, err := generateAuditReport(certsToAdd, certsToRemove, stores, outpath, kfClient)
+				overwrite, _ := cmd.Flags().GetBool("overwrite")
+				groups := []rotAuditGroup{{AddCerts: certsToAdd, RemoveCerts: certsToRemove, Stores: stores}}
+				if policyManifest != nil {
+					groups, _ = policyManifest.auditGroups(stores, kfClient, agePolicy)
+				}
+				uploaded := uploadMissingCerts(cmd, kfClient, auditGroupAddCerts(groups), dryRun)
+				_, actions, auditPath, err := generateAuditReport(commandContext(cmd), groups, uploaded, outpath, overwrite, kfClient)
 				if err != nil {
+					fmt.Printf("[ERROR] generating audit report: %s\n", err)
 					log.Fatalf("[ERROR] generating audit report: %s", err)
 				}
+				// The reconciled report is written next to the audit report of this run.
+				reportFile = auditPath
+				if len(actions) == 0 {
+					printInfo("No reconciliation actions to take, root stores are up-to-date. Exiting.\n")
+					return
+				}
+				actions = preflightActions(cmd, kfClient, actions)
 				if len(actions) == 0 {
-					fmt.Println("No reconciliation actions to take, root stores are up-to-date. Exiting.")
+					printInfo("No reconciliation actions can be run. Exiting.\n")
 					return
 				}
-				rErr := reconcileRoots(actions, kfClient, reportFile, dryRun)
+				runner := newBatchRunnerFromFlags(cmd)
+				failures, rErr := reconcileRoots(actions, kfClient, reportFile, dryRun, runner, entryParams)
 				if rErr != nil {
 					fmt.Printf("[ERROR] reconciling roots: %s", rErr)
 					log.Fatalf("[ERROR] reconciling roots: %s", rErr)
 				}
+				if dryRun {
+					reportProjectedStates(cmd, actions, kfClient)
+				}
 				if lookupFailures != nil {
-					fmt.Printf("The following stores could not be found: %s", strings.Join(lookupFailures, ","))
+					printWarning("The following stores could not be found: %s\n", strings.Join(lookupFailures, ","))
 				}
-				fmt.Println("Reconciliation completed. Check orchestrator jobs for details.")
+				printInfo("Reconciliation completed. Check orchestrator jobs for details.\n")
+				summary := reconcileSummary(actions, dryRun, runner, lookupFailures, reconciledReportPath(reportFile))
+				notifyFromFlags(cmd, summary)
+				summary.ReportURL, _ = cmd.Flags().GetString("report-url")
+				reportCIRun(cmd, summary, actions, failures)
+				writeSummaryMarkdown(cmd, summary, actions, failures)
+				recordRunResult(summary, failures)
+				writeFailedActions(cmd, failures, dryRun)
 			}
 
 		},
@@ -805,7 +1326,7 @@ the utility will first generate an audit report and then execute the add/remove
 		SuggestFor:             nil,
 		Short:                  "For generating Root Of Trust template(s)",
 		Long:                   `Root Of Trust: Will parse a CSV and attempt to enroll a cert or set of certs into a list of cert stores.`,
-		Example:                "",
+		Example:                "kfutil stores rot generate-template --type stores --store-type K8SSecret --columns StoreID,StoreMachine,StorePath --sort-by StoreMachine",
 		ValidArgs:              nil,
 		ValidArgsFunction:      nil,
 		Args:                   nil,
@@ -823,185 +1344,104 @@ the utility will first generate an audit report and then execute the add/remove
 			templateType, _ := cmd.Flags().GetString("type")
 			format, _ := cmd.Flags().GetString("format")
 			outPath, _ := cmd.Flags().GetString("outpath")
-			storeType, _ := cmd.Flags().GetStringSlice("store-type")
-			containerType, _ := cmd.Flags().GetStringSlice("container-type")
-			collection, _ := cmd.Flags().GetStringSlice("collection")
-			subjectName, _ := cmd.Flags().GetStringSlice("cn")
-			stID := -1
-			var storeData []api.GetCertificateStoreResponse
-			var csvStoreData [][]string
-			var csvCertData [][]string
-			var rowLookup = make(map[string]bool)
-			if len(storeType) != 0 {
-				for _, s := range storeType {
-					kfClient, err := initClient()
-					if err != nil {
-						log.Fatalf("[ERROR] creating client: %s", err)
-					}
-					var sType *api.CertificateStoreType
-					var stErr error
-					if s == "all" {
-						sType = &api.CertificateStoreType{
-							Name:                "",
-							ShortName:           "",
-							Capability:          "",
-							StoreType:           0,
-							ImportType:          0,
-							LocalStore:          false,
-							SupportedOperations: nil,
-							Properties:          nil,
-							EntryParameters:     nil,
-							PasswordOptions:     nil,
-							StorePathType:       "",
-							StorePathValue:      "",
-							PrivateKeyAllowed:   "",
-							JobProperties:       nil,
-							ServerRequired:      false,
-							PowerShell:          false,
-							BlueprintAllowed:    false,
-							CustomAliasAllowed:  "",
-							ServerRegistration:  0,
-							InventoryEndpoint:   "",
-							InventoryJobType:    "",
-							ManagementJobType:   "",
-							DiscoveryJobType:    "",
-							EnrollmentJobType:   "",
-						}
-					} else {
-						sType, stErr = kfClient.GetCertificateStoreTypeByName(s)
-						stID = sType.StoreType // This is the template type ID
-					}
-
-					if stErr != nil {
-						fmt.Printf("[ERROR] getting store type: %s\n", stErr)
-						continue
-					}
-
-					if stID >= 0 || s == "all" {
-						log.Printf("[DEBUG] Store type ID: %d\n", stID)
-						params := make(map[string]interface{})
-						stores, sErr := kfClient.ListCertificateStores(&params)
-						if sErr != nil {
-							fmt.Printf("[ERROR] getting certificate stores of type '%s': %s\n", s, sErr)
-							log.Fatalf("[ERROR] getting certificate stores of type '%s': %s", s, sErr)
-						}
-						for _, store := range *stores {
-							if store.CertStoreType == stID || s == "all" {
-								storeData = append(storeData, store)
-								if !rowLookup[store.Id] {
-									lineData := []string{
-										//"StoreID", "StoreType", "StoreMachine", "StorePath", "ContainerId"
-										store.Id, fmt.Sprintf("%s", sType.ShortName), store.ClientMachine, store.StorePath, fmt.Sprintf("%d", store.ContainerId), store.ContainerName, GetCurrentTime(),
-									}
-									csvStoreData = append(csvStoreData, lineData)
-									rowLookup[store.Id] = true
-								}
-							}
-						}
-					}
-				}
-				fmt.Println("Done")
+			storeFilters, fErr := compileStoreRowFilters(cmd)
+			if fErr != nil {
+				fmt.Printf("[ERROR] invalid store filter: %s\n", fErr)
+				log.Fatalf("[ERROR] invalid store filter: %s", fErr)
 			}
-			if len(containerType) != 0 {
-				for _, c := range containerType {
-					kfClient, err := initClient()
-					if err != nil {
-						log.Fatalf("[ERROR] creating client: %s", err)
-					}
-					cStoresResp, scErr := kfClient.GetCertificateStoreByContainerID(c)
-					if scErr != nil {
-						fmt.Printf("[ERROR] getting store container: %s\n", scErr)
-					}
-					if cStoresResp != nil {
-						for _, store := range *cStoresResp {
-							sType, stErr := kfClient.GetCertificateStoreType(store.CertStoreType)
-							if stErr != nil {
-								fmt.Printf("[ERROR] getting store type: %s\n", stErr)
-								continue
-							}
-							storeData = append(storeData, store)
-							if !rowLookup[store.Id] {
-								lineData := []string{
-									// "StoreID", "StoreType", "StoreMachine", "StorePath", "ContainerId"
-									store.Id, sType.ShortName, store.ClientMachine, store.StorePath, fmt.Sprintf("%d", store.ContainerId), store.ContainerName, GetCurrentTime(),
-								}
-								csvStoreData = append(csvStoreData, lineData)
-								rowLookup[store.Id] = true
-							}
-						}
-
-					}
+			exclusions, eErr := newStoreExclusionsFromFlags(cmd, nil)
+			if eErr != nil {
+				fmt.Printf("[ERROR] %s\n", eErr)
+				log.Fatalf("[ERROR] %s", eErr)
+			}
+			appendRows, _ := cmd.Flags().GetBool("append")
+			var filePath string
+			if outPath != "" {
+				filePath = outPath
+			} else {
+				filePath = fmt.Sprintf("%s_template.%s", templateType, format)
+			}
+			var header []string
+			switch templateType {
+			case "stores":
+				header = StoreHeader
+			case "certs":
+				header = CertHeader
+			case "actions":
+				header = AuditHeader
+			}
+			columnFlags, _ := cmd.Flags().GetStringSlice("columns")
+			sortBy, _ := cmd.Flags().GetStringSlice("sort-by")
+			columns, cErr := templateColumns(header, columnFlags)
+			if cErr != nil {
+				fmt.Printf("[ERROR] %s\n", cErr)
+				log.Fatalf("[ERROR] %s", cErr)
+			}
+			if appendRows && (templateType == "actions" || format == "json" || filePath == stdioPath || isCloudURL(filePath)) {
+				fmt.Println("[ERROR] --append needs a local csv or xlsx stores or certs template")
+				log.Fatalf("[ERROR] invalid --append")
+			}
+			var existing [][]string
+			if appendRows {
+				var rErr error
+				if existing, rErr = readTemplateForAppend(filePath, header); rErr != nil {
+					fmt.Printf("[ERROR] reading template %s: %s\n", filePath, rErr)
+					log.Fatalf("[ERROR] reading template: %s", rErr)
 				}
 			}
-			if len(collection) != 0 {
-				for _, c := range collection {
-					kfClient, err := initClient()
-					if err != nil {
-						fmt.Println("[ERROR] connecting to Keyfactor. Please check your configuration and try again.")
-						log.Fatalf("[ERROR] creating client: %s", err)
-					}
-					q := make(map[string]string)
-					q["collection"] = c
-					certsResp, scErr := kfClient.ListCertificates(q)
-					if scErr != nil {
-						fmt.Printf("No certificates found in collection: %s\n", scErr)
-					}
-					if certsResp != nil {
-						for _, cert := range certsResp {
-							if !rowLookup[cert.Thumbprint] {
-								lineData := []string{
-									// "Thumbprint", "SubjectName", "Issuer", "CertID", "Locations", "LastQueriedDate"
-									cert.Thumbprint, cert.IssuedCN, cert.IssuerDN, fmt.Sprintf("%d", cert.Id), fmt.Sprintf("%v", cert.Locations), GetCurrentTime(),
-								}
-								csvCertData = append(csvCertData, lineData)
-								rowLookup[cert.Thumbprint] = true
-							}
-						}
 
-					}
+			var fetched [][]string
+			var failed map[templateSource]error
+			if sources := templateSourcesFromFlags(cmd, templateType); len(sources) > 0 {
+				kfClient, err := initClient()
+				if err != nil {
+					fmt.Println("[ERROR] connecting to Keyfactor. Please check your configuration and try again.")
+					log.Fatalf("[ERROR] creating client: %s", err)
+				}
+				fetched, failed = prepopulateTemplate(cmd, kfClient, sources)
+				for source, sErr := range failed {
+					fmt.Printf("[ERROR] pre-populating template from %s: %s\n", source, sErr)
+					log.Printf("[ERROR] pre-populating template from %s: %s", source, sErr)
 				}
 			}
-			if len(subjectName) != 0 {
-				for _, s := range subjectName {
-					kfClient, err := initClient()
-					if err != nil {
-						fmt.Println("[ERROR] connecting to Keyfactor. Please check your configuration and try again.")
-						log.Fatalf("[ERROR] creating client: %s", err)
-					}
-					q := make(map[string]string)
-					q["subject"] = s
-					certsResp, scErr := kfClient.ListCertificates(q)
-					if scErr != nil {
-						fmt.Printf("No certificates found with CN: %s\n", scErr)
+			if templateType == "stores" {
+				var kept [][]string
+				for _, row := range fetched {
+					// "StoreID", "StoreType", "StoreMachine", "StorePath", "ContainerId", "ContainerName", "LastQueriedDate"
+					if reason := exclusions.excludesRow(row[1], row[5], row[4]); reason != "" {
+						log.Printf("[DEBUG] excluding store %s from the template, %s", row[0], reason)
+						continue
 					}
-					if certsResp != nil {
-						for _, cert := range certsResp {
-							if !rowLookup[cert.Thumbprint] {
-								locationsFormatted := ""
-								for _, loc := range cert.Locations {
-									locationsFormatted += fmt.Sprintf("%s:%s\n", loc.StoreMachine, loc.StorePath)
-								}
-								lineData := []string{
-									// "Thumbprint", "SubjectName", "Issuer", "CertID", "Locations", "LastQueriedDate"
-									cert.Thumbprint, cert.IssuedCN, cert.IssuerDN, fmt.Sprintf("%d", cert.Id), locationsFormatted, GetCurrentTime(),
-								}
-								csvCertData = append(csvCertData, lineData)
-								rowLookup[cert.Thumbprint] = true
-							}
-						}
-
+					if storeFilters.matches(row[2], row[3]) {
+						kept = append(kept, row)
 					}
 				}
+				fetched = kept
 			}
-			// Create CSV template file
-
-			var filePath string
-			if outPath != "" {
-				filePath = outPath
-			} else {
-				filePath = fmt.Sprintf("%s_template.%s", templateType, format)
+			rows, added := mergeTemplateRows(existing, fetched)
+			recordResultCount("rows_added", added)
+			if appendRows {
+				printInfo("Adding %d new row(s) to the %d row(s) of %s\n", added, len(existing), filePath)
+			}
+			if sErr := sortTemplateRows(header, rows, sortBy); sErr != nil {
+				fmt.Printf("[ERROR] %s\n", sErr)
+				log.Fatalf("[ERROR] %s", sErr)
+			}
+			data := projectTemplateRows(append([][]string{header}, rows...), columns)
+			if format == "xlsx" {
+				if filePath == stdioPath {
+					fmt.Println("[ERROR] xlsx templates cannot be written to stdout")
+					log.Fatalf("[ERROR] xlsx templates cannot be written to stdout")
+				}
+				if xErr := writeXlsxFile(filePath, []xlsxSheet{{Name: templateType, Rows: data}}); xErr != nil {
+					fmt.Printf("[ERROR] creating file: %s", xErr)
+					log.Fatal("Cannot create file", xErr)
+				}
+				printInfo("Template file created at %s.\n", filePath)
+				exitOnTemplateFailures(failed)
+				return
 			}
-			file, err := os.Create(filePath)
+			file, err := createOutput(filePath)
 			if err != nil {
 				fmt.Printf("[ERROR] creating file: %s", err)
 				log.Fatal("Cannot create file", err)
@@ -1010,26 +1450,10 @@ the utility will first generate an audit report and then execute the add/remove
 			switch format {
 			case "csv":
 				writer := csv.NewWriter(file)
-				var data [][]string
-				switch templateType {
-				case "stores":
-					data = append(data, StoreHeader)
-					if len(csvStoreData) != 0 {
-						data = append(data, csvStoreData...)
-					}
-				case "certs":
-					data = append(data, CertHeader)
-					if len(csvCertData) != 0 {
-						data = append(data, csvCertData...)
-					}
-				case "actions":
-					data = append(data, AuditHeader)
-				}
 				csvErr := writer.WriteAll(data)
 				if csvErr != nil {
 					fmt.Println(csvErr)
 				}
-				defer file.Close()
 
 			case "json":
 				writer := bufio.NewWriter(file)
@@ -1037,8 +1461,14 @@ the utility will first generate an audit report and then execute the add/remove
 				if err != nil {
 					log.Fatal("Cannot write to file", err)
 				}
+				writer.Flush()
+			}
+			if cErr := file.Close(); cErr != nil {
+				fmt.Printf("[ERROR] writing file: %s\n", cErr)
+				log.Fatal("Cannot write file", cErr)
 			}
-			fmt.Printf("Template file created at %s.\n", filePath)
+			printInfo("Template file created at %s.\n", outputName(filePath))
+			exitOnTemplateFailures(failed)
 		},
 		RunE:                       nil,
 		PostRun:                    nil,
@@ -1061,7 +1491,7 @@ the utility will first generate an audit report and then execute the add/remove
 
 func init() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.SetOutput(os.Stdout)
+	log.SetOutput(redactingWriter{os.Stdout})
 	log.SetOutput(io.Discard)
 	var (
 		stores          string
@@ -1084,11 +1514,12 @@ func init() {
 
 	// Root of trust `audit` command
 	rotCmd.AddCommand(rotAuditCmd)
-	rotAuditCmd.Flags().StringVarP(&stores, "stores", "s", "", "CSV file containing cert stores to enroll into")
+	rotAuditCmd.Flags().StringVarP(&stores, "stores", "s", "", "CSV, JSON or .xlsx file containing cert stores to enroll into, or a file of store IDs. Use - for stdin.")
 	rotAuditCmd.Flags().StringVarP(&addCerts, "add-certs", "a", "",
-		"CSV file containing cert(s) to enroll into the defined cert stores")
+		"CSV file containing cert(s) to enroll into the defined cert stores, or collection:<name|id> to use a Keyfactor collection")
 	rotAuditCmd.Flags().StringVarP(&removeCerts, "remove-certs", "r", "",
-		"CSV file containing cert(s) to remove from the defined cert stores")
+		"CSV file containing cert(s) to remove from the defined cert stores, or collection:<name|id> to use a Keyfactor collection")
+	addStoreExclusionFlags(rotAuditCmd)
 	rotAuditCmd.Flags().IntVarP(&minCertsInStore, "min-certs", "m", -1,
 		"The minimum number of certs that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
 	rotAuditCmd.Flags().IntVarP(&maxPrivateKeys, "max-keys", "k", -1,
@@ -1097,15 +1528,45 @@ func init() {
 		"The max number of non-root-certs that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
 	rotAuditCmd.Flags().BoolP("dry-run", "d", false, "Dry run mode")
 	rotAuditCmd.Flags().StringVarP(&outPath, "outpath", "o", "",
-		"Path to write the audit report file to. If not specified, the file will be written to the current directory.")
+		"Path to write the audit report file to. If not specified, a timestamped report, e.g. rot_audit_20230102T150405Z.csv,"+
+			" is written to the current directory. Also accepts s3://, az:// and gs:// URLs to upload to.")
+	rotAuditCmd.Flags().Bool("overwrite", false, "Replace the --outpath file if it exists.")
+	addInputAgeFlags(rotAuditCmd)
+	addAllowedIssuersFlags(rotAuditCmd)
+	addKeyPolicyFlags(rotAuditCmd)
+	addDuplicateRootsFlags(rotAuditCmd)
+	addUninventoriedFlags(rotAuditCmd)
+	addDBInputFlags(rotAuditCmd)
+	addROTManifestFlag(rotAuditCmd)
+	addStoreIDsFlag(rotAuditCmd)
+	addUploadMissingFlags(rotAuditCmd)
+	addCollectionScopeFlag(rotAuditCmd)
+	addMatchOnFlag(rotAuditCmd)
+	addLookupFailureFlags(rotAuditCmd)
+	addCompareOnlyFlag(rotAuditCmd)
+	rotAuditCmd.Flags().String("format", "", "Format of the audit report, one of csv or xlsx. Defaults to the extension of --outpath, or csv.")
+	rotAuditCmd.Flags().String("metrics-out", "",
+		"Path to write Prometheus textfile format metrics about the audit run to, e.g. for the node_exporter textfile collector.")
+	rotAuditCmd.Flags().String("history-db", "",
+		"SQLite database to record the summary metrics of the audit run in, e.g. ~/.kfutil/history.db. Requires the sqlite3 client. See 'stores rot trends'.")
+	rotAuditCmd.Flags().Bool("check-chains", false,
+		"Verify that the issuing chain of every leaf and intermediate in a store is present up to a root in the add-certs set.")
+	rotAuditCmd.Flags().Bool("add-missing-intermediates", false,
+		"Used with --check-chains. Add actions to the audit report to deploy missing intermediates to stores with broken chains.")
+	addNotifyFlags(rotAuditCmd)
+	addCIFlag(rotAuditCmd)
+	addSummaryMarkdownFlag(rotAuditCmd)
+	rotAuditCmd.MarkFlagsMutuallyExclusive("compare-only", "add-certs")
+	rotAuditCmd.MarkFlagsMutuallyExclusive("compare-only", "remove-certs")
+	rotAuditCmd.MarkFlagsMutuallyExclusive("compare-only", "manifest")
 
 	// Root of trust `reconcile` command
 	rotCmd.AddCommand(rotReconcileCmd)
-	rotReconcileCmd.Flags().StringVarP(&stores, "stores", "s", "", "CSV file containing cert stores to enroll into")
+	rotReconcileCmd.Flags().StringVarP(&stores, "stores", "s", "", "CSV, JSON or .xlsx file containing cert stores to enroll into, or a file of store IDs. Use - for stdin.")
 	rotReconcileCmd.Flags().StringVarP(&addCerts, "add-certs", "a", "",
-		"CSV file containing cert(s) to enroll into the defined cert stores")
+		"CSV file containing cert(s) to enroll into the defined cert stores, or collection:<name|id> to use a Keyfactor collection")
 	rotReconcileCmd.Flags().StringVarP(&removeCerts, "remove-certs", "r", "",
-		"CSV file containing cert(s) to remove from the defined cert stores")
+		"CSV file containing cert(s) to remove from the defined cert stores, or collection:<name|id> to use a Keyfactor collection")
 	rotReconcileCmd.Flags().IntVarP(&minCertsInStore, "min-certs", "m", -1,
 		"The minimum number of certs that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
 	rotReconcileCmd.Flags().IntVarP(&maxPrivateKeys, "max-keys", "k", -1,
@@ -1114,29 +1575,124 @@ func init() {
 		"The max number of non-root-certs that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
 	rotReconcileCmd.Flags().BoolP("dry-run", "d", false, "Dry run mode")
 	rotReconcileCmd.Flags().BoolP("import-csv", "v", false, "Import an audit report file in CSV format.")
+	rotReconcileCmd.Flags().String("import-file", "",
+		"Import an audit report in CSV, .xlsx, JSON or YAML format. JSON and YAML reports must have a schema_version, reports of older schema versions are migrated.")
+	addBatchFlags(rotReconcileCmd)
+	addStoresPerRequestFlag(rotReconcileCmd)
 	rotReconcileCmd.Flags().StringVarP(&inputFile, "input-file", "i", reconcileDefaultFileName,
-		"Path to a file generated by 'stores rot audit' command.")
+		"Path to a file generated by 'stores rot audit' command. Defaults to the latest timestamped audit report if "+reconcileDefaultFileName+" does not exist.")
 	rotReconcileCmd.Flags().StringVarP(&outPath, "outpath", "o", "",
-		"Path to write the audit report file to. If not specified, the file will be written to the current directory.")
+		"Path to write the audit report file to. If not specified, a timestamped report is written to the current directory.")
+	rotReconcileCmd.Flags().Bool("overwrite", false, "Replace the --outpath file if it exists.")
+	addInputAgeFlags(rotReconcileCmd)
+	addUninventoriedFlags(rotReconcileCmd)
+	addDBInputFlags(rotReconcileCmd)
+	addROTManifestFlag(rotReconcileCmd)
+	addStoreIDsFlag(rotReconcileCmd)
+	addPreflightFlags(rotReconcileCmd)
+	addUploadMissingFlags(rotReconcileCmd)
+	addCollectionScopeFlag(rotReconcileCmd)
+	addMatchOnFlag(rotReconcileCmd)
 	//rotReconcileCmd.MarkFlagsRequiredTogether("add-certs", "stores")
 	//rotReconcileCmd.MarkFlagsRequiredTogether("remove-certs", "stores")
+	addNotifyFlags(rotReconcileCmd)
+	addCIFlag(rotReconcileCmd)
+	addSummaryMarkdownFlag(rotReconcileCmd)
+	addFailedActionsFlags(rotReconcileCmd)
+	addStoreFilterFlags(rotReconcileCmd)
+	addStoreExclusionFlags(rotReconcileCmd)
+	addChangeTicketFlag(rotReconcileCmd)
+	rotReconcileCmd.Flags().StringArray("entry-param", []string{},
+		"Entry parameter to pass when adding certificates, in the form [<store-type>:]<name>=<value>. May be repeated. "+
+			"Audit report columns named entry.<name> override it per action.")
+	rotReconcileCmd.Flags().Bool("require-approval", false,
+		"Only execute an audit report that was approved with 'stores rot approve' and not changed since. Requires --import-csv or --import-file.")
+	rotReconcileCmd.Flags().String("approval-manifest", "",
+		"Path to the approval manifest of the audit report. Defaults to <input-file>_approved.json.")
+	rotReconcileCmd.Flags().String("projected-state", "",
+		"With --dry-run, path to write the projected inventory of each store after the reconcile to as JSON. Use '-' for stdout.")
 	rotReconcileCmd.MarkFlagsMutuallyExclusive("add-certs", "import-csv")
 	rotReconcileCmd.MarkFlagsMutuallyExclusive("remove-certs", "import-csv")
 	rotReconcileCmd.MarkFlagsMutuallyExclusive("stores", "import-csv")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("retry-failed", "import-csv")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("import-file", "import-csv")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("add-certs", "import-file")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("remove-certs", "import-file")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("stores", "import-file")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("retry-failed", "import-file")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("retry-failed", "stores")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("retry-failed", "add-certs")
+	rotReconcileCmd.MarkFlagsMutuallyExclusive("retry-failed", "remove-certs")
 
 	// Root of trust `generate` command
 	rotCmd.AddCommand(rotGenStoreTemplateCmd)
 	rotGenStoreTemplateCmd.Flags().StringVarP(&outPath, "outpath", "o", "",
-		"Path to write the template file to. If not specified, the file will be written to the current directory.")
+		"Path to write the template file to. If not specified, the file will be written to the current directory."+
+			" Also accepts s3://, az:// and gs:// URLs to upload to.")
 	rotGenStoreTemplateCmd.Flags().StringVarP(&outputFormat, "format", "f", "csv",
-		"The type of template to generate. Only `csv` is supported at this time.")
+		"The format of the template to generate, one of csv or xlsx.")
 	rotGenStoreTemplateCmd.Flags().Var(&tType, "type",
 		`The type of template to generate. Only "certs|stores|actions" are supported at this time.`)
 	rotGenStoreTemplateCmd.Flags().StringSliceVar(&storeTypes, "store-type", []string{}, "Multi value flag. Attempt to pre-populate the stores template with the certificate stores matching specified store types. If not specified, the template will be empty.")
 	rotGenStoreTemplateCmd.Flags().StringSliceVar(&containerTypes, "container-type", []string{}, "Multi value flag. Attempt to pre-populate the stores template with the certificate stores matching specified container types. If not specified, the template will be empty.")
 	rotGenStoreTemplateCmd.Flags().StringSliceVar(&subjectNames, "cn", []string{}, "Subject name(s) to pre-populate the stores template with. If not specified, the template will be empty. Does not work with SANs.")
-	rotGenStoreTemplateCmd.Flags().StringSliceVar(&collections, "collection", []string{}, "Certificate collection name(s) to pre-populate the stores template with. If not specified, the template will be empty.")
+	rotGenStoreTemplateCmd.Flags().StringSliceVar(&collections, "collection", []string{}, "Certificate collection name(s) or ID(s) to pre-populate the certs template with. Large collections are listed a page at a time, see --page-size and --page-concurrency.")
+	addCollectionPagingFlags(rotGenStoreTemplateCmd)
+	addBatchFlags(rotGenStoreTemplateCmd)
+	rotGenStoreTemplateCmd.Flags().Bool("append", false, "Add the pre-populated rows to the existing template at --outpath instead of replacing it. Rows already in the template are skipped, so a large template can be built incrementally.")
+	rotGenStoreTemplateCmd.Flags().String("machine-pattern", "", "Regular expression a store's client machine must match to be included in the stores template.")
+	rotGenStoreTemplateCmd.Flags().String("path-pattern", "", "Regular expression a store's path must match to be included in the stores template.")
+	rotGenStoreTemplateCmd.Flags().String("exclude-machine-pattern", "", "Regular expression of client machines to exclude from the stores template.")
+	addStoreExclusionFlags(rotGenStoreTemplateCmd)
+	rotGenStoreTemplateCmd.Flags().String("exclude-path-pattern", "", "Regular expression of store paths to exclude from the stores template.")
+	rotGenStoreTemplateCmd.Flags().StringSlice("columns", []string{}, "Columns of the template, in order, e.g. StoreID,StoreMachine,StorePath. The first column of the default header, StoreID or Thumbprint, must be included. Defaults to all columns.")
+	rotGenStoreTemplateCmd.Flags().StringSlice("sort-by", []string{}, "Columns to sort the template rows by, e.g. StoreMachine,StorePath. Defaults to the order the rows were fetched in.")
 
 	rotGenStoreTemplateCmd.RegisterFlagCompletionFunc("type", templateTypeCompletion)
 	rotGenStoreTemplateCmd.MarkFlagRequired("type")
 }
+
+// storeRowFilters holds the optional regular expressions used to include or exclude stores by client machine and path.
+type storeRowFilters struct {
+	machine        *regexp.Regexp
+	path           *regexp.Regexp
+	excludeMachine *regexp.Regexp
+	excludePath    *regexp.Regexp
+}
+
+func compileStoreRowFilters(cmd *cobra.Command) (*storeRowFilters, error) {
+	filters := &storeRowFilters{}
+	for flag, re := range map[string]**regexp.Regexp{
+		"machine-pattern":         &filters.machine,
+		"path-pattern":            &filters.path,
+		"exclude-machine-pattern": &filters.excludeMachine,
+		"exclude-path-pattern":    &filters.excludePath,
+	} {
+		pattern, _ := cmd.Flags().GetString(flag)
+		if pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %s", flag, err)
+		}
+		*re = compiled
+	}
+	return filters, nil
+}
+
+func (f *storeRowFilters) matches(machine string, path string) bool {
+	if f.machine != nil && !f.machine.MatchString(machine) {
+		return false
+	}
+	if f.path != nil && !f.path.MatchString(path) {
+		return false
+	}
+	if f.excludeMachine != nil && f.excludeMachine.MatchString(machine) {
+		return false
+	}
+	if f.excludePath != nil && f.excludePath.MatchString(path) {
+		return false
+	}
+	return true
+}
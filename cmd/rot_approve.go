@@ -0,0 +1,188 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const approvalManifestVersion = 1
+
+// rotApprovalManifest records the approval of an audit report. The report is identified by its SHA-256 so that
+// reconcile can refuse to execute a report that was changed after it was approved.
+type rotApprovalManifest struct {
+	ManifestVersion int       `json:"manifest_version"`
+	AuditFile       string    `json:"audit_file"`
+	AuditSHA256     string    `json:"audit_sha256"`
+	Approver        string    `json:"approver"`
+	Ticket          string    `json:"ticket,omitempty"`
+	ApprovedAt      time.Time `json:"approved_at"`
+	AddActions      int       `json:"add_actions"`
+	RemoveActions   int       `json:"remove_actions"`
+	Stores          int       `json:"stores"`
+}
+
+// approvalManifestPath returns the default manifest path for an audit report, e.g. rot_audit_approved.json.
+func approvalManifestPath(auditPath string) string {
+	return strings.TrimSuffix(auditPath, filepath.Ext(auditPath)) + "_approved.json"
+}
+
+func fileSHA256(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// defaultApprover returns the OS user running kfutil.
+func defaultApprover() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// verifyApproval checks that manifestPath approves the current contents of auditPath.
+func verifyApproval(auditPath string, manifestPath string) (*rotApprovalManifest, error) {
+	if auditPath == stdioPath {
+		return nil, fmt.Errorf("approved audit reports cannot be read from stdin")
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading approval manifest: %s", err)
+	}
+	var manifest rotApprovalManifest
+	if jErr := json.Unmarshal(data, &manifest); jErr != nil {
+		return nil, fmt.Errorf("parsing approval manifest %s: %s", manifestPath, jErr)
+	}
+	if manifest.ManifestVersion != approvalManifestVersion {
+		return nil, fmt.Errorf("unsupported approval manifest version %d", manifest.ManifestVersion)
+	}
+	if manifest.Approver == "" {
+		return nil, fmt.Errorf("approval manifest %s has no approver", manifestPath)
+	}
+	sum, hErr := fileSHA256(auditPath)
+	if hErr != nil {
+		return nil, hErr
+	}
+	if sum != manifest.AuditSHA256 {
+		return nil, fmt.Errorf("audit report %s was modified after it was approved", auditPath)
+	}
+	return &manifest, nil
+}
+
+var rotApproveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Approve an audit report for reconciliation.",
+	Long: `Records the approval of an audit report generated by 'stores rot audit'. The approver, an optional change ticket
+and a SHA-256 checksum of the report are written to an approval manifest. Run 'stores rot reconcile --import-csv
+--require-approval' to only execute audit reports that have been approved and not changed since.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		auditFile, _ := cmd.Flags().GetString("input-file")
+		auditFile = latestAuditReportPath(auditFile)
+		approver, _ := cmd.Flags().GetString("approver")
+		ticket, _ := cmd.Flags().GetString("ticket")
+		outpath, _ := cmd.Flags().GetString("outpath")
+
+		if auditFile == stdioPath {
+			fmt.Println("[ERROR] audit reports cannot be approved from stdin")
+			log.Fatalf("[ERROR] audit reports cannot be approved from stdin")
+		}
+		if approver == "" {
+			approver = defaultApprover()
+		}
+		if approver == "" {
+			fmt.Println("[ERROR] unable to determine the approver, use --approver")
+			log.Fatalf("[ERROR] unable to determine the approver")
+		}
+		if outpath == "" {
+			outpath = approvalManifestPath(auditFile)
+		}
+
+		auditTable, aErr := readTabularFile(auditFile, AuditHeader, []string{"StoreID"})
+		if aErr != nil {
+			fmt.Printf("[ERROR] reading audit file %s: %s\n", auditFile, aErr)
+			log.Fatalf("[ERROR] reading audit file: %s", aErr)
+		}
+		if !auditTable.HasHeader {
+			fmt.Printf("[ERROR] Invalid header in audit file. Expected: %s\n", strings.Join(AuditHeader, ","))
+			log.Fatalf("[ERROR] audit file is missing a valid header")
+		}
+		if len(auditTable.Errors) > 0 {
+			auditTable.reportErrors()
+			fmt.Println("[ERROR] audit reports with invalid rows cannot be approved")
+			log.Fatalf("[ERROR] audit report has invalid rows")
+		}
+		sum, hErr := fileSHA256(auditFile)
+		if hErr != nil {
+			fmt.Printf("[ERROR] reading audit file %s: %s\n", auditFile, hErr)
+			log.Fatalf("[ERROR] reading audit file: %s", hErr)
+		}
+
+		manifest := rotApprovalManifest{
+			ManifestVersion: approvalManifestVersion,
+			AuditFile:       filepath.Base(auditFile),
+			AuditSHA256:     sum,
+			Approver:        approver,
+			Ticket:          ticket,
+			ApprovedAt:      time.Now().UTC(),
+		}
+		stores := make(map[string]bool)
+		for _, row := range auditTable.Rows {
+			add, _ := strconv.ParseBool(row.Get("AddCert"))
+			remove, _ := strconv.ParseBool(row.Get("RemoveCert"))
+			if add {
+				manifest.AddActions++
+			}
+			if remove {
+				manifest.RemoveActions++
+			}
+			if add || remove {
+				stores[row.Get("StoreID")] = true
+			}
+		}
+		manifest.Stores = len(stores)
+
+		out, _ := json.MarshalIndent(manifest, "", "  ")
+		if wErr := os.WriteFile(outpath, append(out, '\n'), 0644); wErr != nil {
+			fmt.Printf("[ERROR] writing approval manifest %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing approval manifest: %s", wErr)
+		}
+		printInfo("Approved %d add and %d remove action(s) across %d store(s) as %s.\n", manifest.AddActions, manifest.RemoveActions, manifest.Stores, approver)
+		printInfo("Approval manifest written to %s\n", outpath)
+	},
+}
+
+func init() {
+	var (
+		inputFile string
+		approver  string
+		ticket    string
+		outpath   string
+	)
+	rotCmd.AddCommand(rotApproveCmd)
+	rotApproveCmd.Flags().StringVarP(&inputFile, "input-file", "i", reconcileDefaultFileName, "Path to the audit report to approve.")
+	rotApproveCmd.Flags().StringVar(&approver, "approver", "", "Identity of the approver. Defaults to the current OS user.")
+	rotApproveCmd.Flags().StringVar(&ticket, "ticket", "", "Change management ticket number the approval belongs to.")
+	rotApproveCmd.Flags().StringVarP(&outpath, "outpath", "o", "", "Path to write the approval manifest to. Defaults to <input-file>_approved.json.")
+}
@@ -0,0 +1,212 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// mozillaBundleURL is the Mozilla CA certificate list as extracted and published in PEM format by the curl project.
+	mozillaBundleURL          = "https://curl.se/ca/cacert.pem"
+	importBundleDefaultPath   = "bundle_certs.csv"
+	importBundleSourceFile    = "file:"
+	importBundleSourceSystem  = "system"
+	importBundleSourceMozilla = "mozilla"
+)
+
+// systemBundlePaths are the well known locations of the OS trust bundle on Linux and macOS.
+var systemBundlePaths = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// readTrustBundle returns the PEM contents of the bundle referenced by source.
+func readTrustBundle(source string) ([]byte, error) {
+	switch {
+	case source == importBundleSourceMozilla:
+		resp, err := http.Get(mozillaBundleURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unable to download %s, status %d", mozillaBundleURL, resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	case source == importBundleSourceSystem:
+		for _, p := range systemBundlePaths {
+			if data, err := os.ReadFile(p); err == nil {
+				log.Printf("[INFO] Using system trust bundle %s", p)
+				return data, nil
+			}
+		}
+		return nil, fmt.Errorf("no system trust bundle found, checked %s", strings.Join(systemBundlePaths, ", "))
+	case strings.HasPrefix(source, importBundleSourceFile):
+		return os.ReadFile(strings.TrimPrefix(source, importBundleSourceFile))
+	default:
+		return nil, fmt.Errorf("invalid source '%s', must be one of mozilla, system or file:<path>", source)
+	}
+}
+
+// certThumbprint returns the SHA-1 thumbprint of a certificate in the upper case hex format used by Keyfactor.
+func certThumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func lookupCertByThumbprint(kfClient *api.Client, thumbprint string) (*api.GetCertificateResponse, bool) {
+	certLookup, err := kfClient.GetCertificateContext(&api.GetCertificateContextArgs{
+		IncludeLocations: boolToPointer(true),
+		CollectionId:     rotCollectionArg(),
+		Thumbprint:       thumbprint,
+	})
+	if err != nil || certLookup == nil || certLookup.Id == 0 {
+		return nil, false
+	}
+	return certLookup, true
+}
+
+var rotImportBundleCmd = &cobra.Command{
+	Use:   "import-bundle",
+	Short: "Import root certificates from a public or local trust bundle.",
+	Long: `Parses a CA bundle and uploads any certificates missing from Keyfactor, then writes a certs file that can be
+used as the --add-certs input of 'stores rot audit' and 'stores rot reconcile'. Supported sources are:
+  mozilla      the Mozilla CA certificate list (as published by the curl project)
+  system       the trust bundle of the operating system running kfutil
+  file:<path>  a custom bundle or PKI export, see --format
+
+Exports of other PKI products are read with --format:
+  pem       PEM encoded certificates (default)
+  venafi    a Venafi policy or certificate JSON export
+  capolicy  a Microsoft CAPolicy.inf style list or certutil dump of certificate hashes
+  keytool   the output of 'keytool -list -v' or 'keytool -list -rfc' of a JKS truststore
+Entries that only list a thumbprint must already exist in Keyfactor.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		source, _ := cmd.Flags().GetString("source")
+		outpath, _ := cmd.Flags().GetString("outpath")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		format, _ := cmd.Flags().GetString("format")
+
+		bundle, bErr := readTrustBundle(source)
+		if bErr != nil {
+			fmt.Printf("Error reading trust bundle: %s\n", bErr)
+			log.Fatalf("[ERROR] reading trust bundle: %s", bErr)
+		}
+		trust, pErr := parseTrustSource(format, bundle)
+		if pErr != nil {
+			fmt.Printf("Error parsing trust bundle: %s\n", pErr)
+			log.Fatalf("[ERROR] parsing trust bundle: %s", pErr)
+		}
+
+		kfClient, _ := initClient()
+		sdkClient := initGenClient()
+		data := [][]string{CertHeader}
+		imported, existing, failed, missing := 0, 0, 0, 0
+		for _, cert := range trust.Certs {
+			thumbprint := certThumbprint(cert)
+			certLookup, found := lookupCertByThumbprint(kfClient, thumbprint)
+			if found {
+				existing++
+			} else if dryRun {
+				printAdded("[DRY RUN] Would import %s (%s)\n", cert.Subject.String(), thumbprint)
+				imported++
+			} else {
+				if iErr := importCertificate(context.Background(), sdkClient, cert); iErr != nil {
+					failed++
+					continue
+				}
+				imported++
+				printAdded("[IMPORTED] %s (%s)\n", cert.Subject.String(), thumbprint)
+				certLookup, _ = lookupCertByThumbprint(kfClient, thumbprint)
+			}
+
+			certID := ""
+			locations := ""
+			if certLookup != nil {
+				certID = strconv.Itoa(certLookup.Id)
+				for _, loc := range certLookup.Locations {
+					locations += fmt.Sprintf("%s:%s\n", loc.StoreMachine, loc.StorePath)
+				}
+			}
+			data = append(data, []string{thumbprint, cert.Subject.String(), cert.Issuer.String(), certID, locations, GetCurrentTime()})
+		}
+		// Entries without a certificate, e.g. from hash lists, can only be used if Keyfactor already has the certificate.
+		for _, thumbprint := range trust.Thumbprints {
+			certLookup, found := lookupCertByThumbprint(kfClient, thumbprint)
+			if !found {
+				missing++
+				printWarning("[NOT FOUND] %s is not in Keyfactor and the source has no certificate to import\n", thumbprint)
+				continue
+			}
+			existing++
+			locations := ""
+			for _, loc := range certLookup.Locations {
+				locations += fmt.Sprintf("%s:%s\n", loc.StoreMachine, loc.StorePath)
+			}
+			data = append(data, []string{thumbprint, certLookup.IssuedDN, certLookup.IssuerDN, strconv.Itoa(certLookup.Id), locations, GetCurrentTime()})
+		}
+
+		if outpath == "" {
+			outpath = importBundleDefaultPath
+		}
+		out, oErr := createOutput(outpath)
+		if oErr != nil {
+			fmt.Printf("Error writing certs file %s: %s\n", outpath, oErr)
+			log.Fatalf("[ERROR] writing certs file: %s", oErr)
+		}
+		if wErr := csv.NewWriter(out).WriteAll(data); wErr != nil {
+			fmt.Printf("Error writing certs file %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing certs file: %s", wErr)
+		}
+		out.Close()
+
+		total := len(trust.Certs) + len(trust.Thumbprints)
+		if dryRun {
+			printInfo("\n%d certificate(s) in bundle, %d already in Keyfactor, %d would be imported, %d not found.\n", total, existing, imported, missing)
+		} else {
+			printInfo("\n%d certificate(s) in bundle, %d already in Keyfactor, %d imported, %d failed, %d not found.\n", total, existing, imported, failed, missing)
+		}
+		printInfo("Add certs file written to %s\n", outputName(outpath))
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	var (
+		source  string
+		outpath string
+		format  string
+		dryRun  bool
+	)
+	rotCmd.AddCommand(rotImportBundleCmd)
+	rotImportBundleCmd.Flags().StringVar(&source, "source", "", "Trust bundle to import, one of mozilla, system or file:<path>.")
+	rotImportBundleCmd.Flags().StringVarP(&outpath, "outpath", "o", "", fmt.Sprintf("Path to write the add certs file to. Defaults to %s.", importBundleDefaultPath))
+	rotImportBundleCmd.Flags().StringVarP(&format, "format", "f", bundleFormatPEM, "Format of the source, one of pem, venafi, capolicy or keytool.")
+	rotImportBundleCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "Report which certificates would be imported without importing them.")
+	rotImportBundleCmd.MarkFlagRequired("source")
+}
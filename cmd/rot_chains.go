@@ -0,0 +1,184 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+)
+
+const (
+	chainStatusComplete      = "complete"
+	chainStatusMissingIssuer = "missing_issuer"
+	chainStatusUntrustedRoot = "untrusted_root"
+)
+
+var ChainHeader = []string{"StoreID", "StoreType", "Machine", "Path", "Thumbprint", "SubjectName", "Issuer", "MissingIssuer", "Status", "AuditDate"}
+
+// chainIssue describes a certificate in a store whose issuing chain does not end at a root in the desired set.
+type chainIssue struct {
+	Store         StoreCSVEntry
+	Cert          api.InventoriedCertificate
+	MissingIssuer string
+	Status        string
+}
+
+// checkCertChain walks the issuers of cert through the certificates in the store until a desired root is reached. It
+// returns the DN of the first issuer that is not present in the store and the resulting chain status.
+func checkCertChain(cert api.InventoriedCertificate, bySubject map[string]api.InventoriedCertificate, rootDNs map[string]bool) (string, string) {
+	visited := make(map[string]bool)
+	current := cert
+	for {
+		if rootDNs[current.IssuedDN] {
+			return "", chainStatusComplete
+		}
+		if current.IssuedDN == current.IssuerDN {
+			return "", chainStatusUntrustedRoot
+		}
+		issuer := current.IssuerDN
+		if rootDNs[issuer] {
+			// Desired roots are present or will be added by the audit actions.
+			return "", chainStatusComplete
+		}
+		next, ok := bySubject[issuer]
+		if !ok {
+			return issuer, chainStatusMissingIssuer
+		}
+		if visited[issuer] {
+			return "", chainStatusUntrustedRoot
+		}
+		visited[issuer] = true
+		current = next
+	}
+}
+
+// checkStoreChains validates the issuing chain of every leaf and intermediate in the given store inventories against
+// the set of desired root DNs.
+func checkStoreChains(stores map[string]StoreCSVEntry, storeCerts map[string][]api.InventoriedCertificate, rootDNs map[string]bool) []chainIssue {
+	var issues []chainIssue
+	for storeId, certs := range storeCerts {
+		store, ok := stores[storeId]
+		if !ok {
+			continue
+		}
+		bySubject := make(map[string]api.InventoriedCertificate, len(certs))
+		for _, cert := range certs {
+			bySubject[cert.IssuedDN] = cert
+		}
+		for _, cert := range certs {
+			if cert.IssuedDN == cert.IssuerDN {
+				continue // Roots have no chain to validate
+			}
+			missing, status := checkCertChain(cert, bySubject, rootDNs)
+			if status != chainStatusComplete {
+				issues = append(issues, chainIssue{Store: store, Cert: cert, MissingIssuer: missing, Status: status})
+			}
+		}
+	}
+	return issues
+}
+
+// lookupCertByIssuedDN finds a certificate in Keyfactor by its subject DN.
+func lookupCertByIssuedDN(sdkClient *keyfactor.APIClient, dn string) (*keyfactor.ModelsCertificateRetrievalResponse, error) {
+	certs, _, err := sdkClient.CertificateApi.CertificateQueryCertificates(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		PqQueryString(fmt.Sprintf(`IssuedDN -eq "%s"`, strings.ReplaceAll(dn, `"`, `\"`))).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found with subject '%s'", dn)
+	}
+	return &certs[0], nil
+}
+
+// writeChainReport writes the chain validation results next to the audit report and, when addMissing is set, appends
+// add actions for missing intermediates to the audit report so they are picked up by reconcile.
+func writeChainReport(issues []chainIssue, auditPath string, addMissing bool, sdkClient *keyfactor.APIClient) error {
+	if auditPath == "" {
+		auditPath = reconcileDefaultFileName
+	}
+	chainBase := auditPath
+	if auditPath == stdioPath {
+		chainBase = reconcileDefaultFileName
+	}
+	chainPath := fmt.Sprintf("%s_chains.csv", strings.TrimSuffix(chainBase, filepath.Ext(chainBase)))
+	data := [][]string{ChainHeader}
+	brokenStores := make(map[string]bool)
+	for _, issue := range issues {
+		brokenStores[issue.Store.ID] = true
+		data = append(data, []string{
+			issue.Store.ID, issue.Store.Type, issue.Store.Machine, issue.Store.Path,
+			issue.Cert.Thumbprint, issue.Cert.IssuedDN, issue.Cert.IssuerDN, issue.MissingIssuer, issue.Status, GetCurrentTime(),
+		})
+	}
+	chainFile, fErr := os.Create(chainPath)
+	if fErr != nil {
+		return fErr
+	}
+	writer := csv.NewWriter(chainFile)
+	if wErr := writer.WriteAll(data); wErr != nil {
+		chainFile.Close()
+		return wErr
+	}
+	chainFile.Close()
+	printInfo("Chain validation report written to %s, %d store(s) with broken chains.\n", chainPath, len(brokenStores))
+
+	if !addMissing {
+		return nil
+	}
+	if isXlsxPath(auditPath) || auditPath == stdioPath {
+		printWarning("Adding missing intermediates is only supported for CSV audit report files, skipping.\n")
+		return nil
+	}
+	var actionRows [][]string
+	added := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.Status != chainStatusMissingIssuer {
+			continue
+		}
+		key := issue.Store.ID + issue.MissingIssuer
+		if added[key] {
+			continue
+		}
+		added[key] = true
+		cert, lErr := lookupCertByIssuedDN(sdkClient, issue.MissingIssuer)
+		if lErr != nil {
+			fmt.Printf("[ERROR] looking up missing intermediate %s: %s\n", issue.MissingIssuer, lErr)
+			log.Printf("[ERROR] looking up missing intermediate %s: %s", issue.MissingIssuer, lErr)
+			continue
+		}
+		actionRows = append(actionRows, []string{
+			cert.GetThumbprint(), strconv.Itoa(int(cert.GetId())), cert.GetIssuedDN(), cert.GetIssuerDN(),
+			issue.Store.ID, issue.Store.Type, issue.Store.Machine, issue.Store.Path, "true", "false", "false", GetCurrentTime(), "false",
+		})
+	}
+	if len(actionRows) == 0 {
+		return nil
+	}
+	auditFile, oErr := os.OpenFile(auditPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if oErr != nil {
+		return oErr
+	}
+	defer auditFile.Close()
+	writer = csv.NewWriter(auditFile)
+	if wErr := writer.WriteAll(actionRows); wErr != nil {
+		return wErr
+	}
+	printAdded("Added %d missing intermediate action(s) to %s\n", len(actionRows), auditPath)
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// certsCollectionPrefix marks an --add-certs or --remove-certs value that names a Keyfactor collection instead of
+	// a file, e.g. collection:TrustedRoots or collection:12.
+	certsCollectionPrefix = "collection:"
+	collectionPageSize    = 500
+)
+
+// rotCollectionID scopes the certificate lookups of rot commands to a collection, set with --collection-id. 0 looks up
+// certificates without a collection.
+var rotCollectionID int
+
+// addCollectionScopeFlag adds --collection-id, which sets rotCollectionID.
+func addCollectionScopeFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&rotCollectionID, "collection-id", 0,
+		"Look up certificates in this collection, for users whose certificate permissions are limited to a collection.")
+}
+
+// rotCollectionArg returns rotCollectionID as a certificate lookup argument.
+func rotCollectionArg() *int {
+	if rotCollectionID == 0 {
+		return nil
+	}
+	id := rotCollectionID
+	return &id
+}
+
+// isCertsCollection reports whether a certs source names a collection.
+func isCertsCollection(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), certsCollectionPrefix)
+}
+
+// resolveCollectionID returns the ID of a collection given by ID or name.
+func resolveCollectionID(ctx context.Context, sdkClient *keyfactor.APIClient, collection string) (int, error) {
+	if id, err := strconv.Atoi(collection); err == nil {
+		return id, nil
+	}
+	c, _, err := sdkClient.CertificateCollectionApi.CertificateCollectionGetCollection1(ctx, collection).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("looking up collection '%s': %s", collection, err)
+	}
+	if c == nil || c.Id == nil {
+		return 0, fmt.Errorf("collection '%s' not found", collection)
+	}
+	return int(*c.Id), nil
+}
+
+// collectionPaging controls how queryCollectionCertificates pages through a collection.
+type collectionPaging struct {
+	// PageSize is the number of certificates requested per page.
+	PageSize int
+	// Concurrency is the number of pages requested at the same time.
+	Concurrency int
+	// IncludeLocations also returns the stores each certificate is in.
+	IncludeLocations bool
+	// Progress, if set, is called with the number of certificates fetched so far after each round of pages.
+	Progress func(fetched int)
+}
+
+var defaultCollectionPaging = collectionPaging{PageSize: collectionPageSize, Concurrency: 1}
+
+// addCollectionPagingFlags adds the --page-size and --page-concurrency flags read by collectionPagingFromFlags.
+func addCollectionPagingFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("page-size", collectionPageSize, "Number of certificates requested per page when listing a collection.")
+	cmd.Flags().Int("page-concurrency", 4, "Number of collection pages requested at the same time.")
+}
+
+// collectionPagingFromFlags returns the paging of --page-size and --page-concurrency, reporting progress on a terminal
+// as the collection named collection is listed.
+func collectionPagingFromFlags(cmd *cobra.Command, collection string) collectionPaging {
+	pageSize, _ := cmd.Flags().GetInt("page-size")
+	concurrency, _ := cmd.Flags().GetInt("page-concurrency")
+	paging := collectionPaging{PageSize: pageSize, Concurrency: concurrency}
+	if isTerminal(os.Stdout) {
+		paging.Progress = func(fetched int) {
+			printInfo("\rListing collection %s: %d certificate(s)", collection, fetched)
+		}
+	}
+	return paging
+}
+
+// queryCollectionCertificates returns all certificates of a collection. Pages are requested paging.Concurrency at a
+// time, sorted by ID so that pages do not overlap, until a page is not full.
+func queryCollectionCertificates(ctx context.Context, sdkClient *keyfactor.APIClient, collectionID int, paging collectionPaging) ([]keyfactor.ModelsCertificateRetrievalResponse, error) {
+	if paging.PageSize < 1 {
+		paging.PageSize = collectionPageSize
+	}
+	if paging.Concurrency < 1 {
+		paging.Concurrency = 1
+	}
+	type pageResult struct {
+		certs []keyfactor.ModelsCertificateRetrievalResponse
+		err   error
+	}
+	var all []keyfactor.ModelsCertificateRetrievalResponse
+	for first := 1; ; first += paging.Concurrency {
+		results := make([]pageResult, paging.Concurrency)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				page := first + i
+				certs, _, err := sdkClient.CertificateApi.CertificateQueryCertificates(ctx).
+					XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+					CollectionId(int32(collectionID)).IncludeLocations(paging.IncludeLocations).
+					PqSortField("Id").PqSortAscending(0).PqPageReturned(int32(page)).PqReturnLimit(int32(paging.PageSize)).Execute()
+				if err != nil {
+					err = fmt.Errorf("listing certificates of collection %d, page %d: %s", collectionID, page, err)
+				}
+				results[i] = pageResult{certs: certs, err: err}
+			}(i)
+		}
+		wg.Wait()
+		for _, r := range results {
+			if r.err != nil {
+				return nil, r.err
+			}
+			all = append(all, r.certs...)
+			if len(r.certs) < paging.PageSize {
+				// The last page, the pages after it are empty.
+				if paging.Progress != nil {
+					paging.Progress(len(all))
+				}
+				return all, nil
+			}
+		}
+		if paging.Progress != nil {
+			paging.Progress(len(all))
+		}
+	}
+}
+
+// readCertsCollection returns the thumbprints of the certificates in the collection named by source, in the same
+// form as readCertsFile.
+func readCertsCollection(source string) (map[string]string, error) {
+	collection := strings.TrimSpace(source[len(certsCollectionPrefix):])
+	if collection == "" {
+		return nil, fmt.Errorf("missing collection name in '%s', expected %s<name|id>", source, certsCollectionPrefix)
+	}
+	ctx := context.Background()
+	sdkClient := initGenClient()
+	id, err := resolveCollectionID(ctx, sdkClient, collection)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := queryCollectionCertificates(ctx, sdkClient, id, defaultCollectionPaging)
+	if err != nil {
+		return nil, err
+	}
+	thumbprints := make(map[string]string, len(certs))
+	for _, c := range certs {
+		tp := strings.ToUpper(c.GetThumbprint())
+		if tp == "" {
+			continue
+		}
+		thumbprints[tp] = tp
+	}
+	log.Printf("[INFO] collection %s (%d) has %d certificate(s)", collection, id, len(thumbprints))
+	printInfo("Using %d certificate(s) of collection %s\n", len(thumbprints), collection)
+	return thumbprints, nil
+}
@@ -0,0 +1,165 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	bundleCompareMissing     = "missing"
+	bundleCompareNotInBundle = "not_in_bundle"
+)
+
+// BundleComparisonHeader is the header of the report written by `stores rot audit --compare-only`.
+var BundleComparisonHeader = []string{"StoreID", "StoreType", "StoreMachine", "StorePath", "Thumbprint", "Subject", "Status"}
+
+// bundleComparison is how the certificates of a store differ from the trust bundle.
+type bundleComparison struct {
+	Store StoreCSVEntry
+	// Missing are the thumbprints of bundle certificates the store does not have.
+	Missing []string
+	// NotInBundle are the thumbprints of store certificates that are not in the bundle.
+	NotInBundle []string
+}
+
+func addCompareOnlyFlag(cmd *cobra.Command) {
+	cmd.Flags().String("compare-only", "",
+		"Compare every store against a trust bundle instead of auditing add and remove certs: a PEM file, file:<path>, system or "+
+			"mozilla. The bundle is the ground truth, certificates are matched by thumbprint and need not exist in Keyfactor. "+
+			"Writes a comparison report instead of an audit report.")
+}
+
+// readComparisonBundle returns the certificates of a trust bundle by thumbprint, with their subjects. source is a PEM
+// file, or a trust bundle source of readTrustBundle.
+func readComparisonBundle(source string) (map[string]string, error) {
+	if source != importBundleSourceSystem && source != importBundleSourceMozilla && !strings.HasPrefix(source, importBundleSourceFile) {
+		source = importBundleSourceFile + source
+	}
+	data, err := readTrustBundle(source)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parsePEMCerts(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", strings.TrimPrefix(source, importBundleSourceFile))
+	}
+	bundle := make(map[string]string, len(certs))
+	for _, c := range certs {
+		bundle[certThumbprint(c)] = c.Subject.String()
+	}
+	return bundle, nil
+}
+
+// compareStoresToBundle compares the inventory of every store to the bundle, sorted by store ID. Stores that match
+// the bundle are included with no differences.
+func compareStoresToBundle(stores map[string]StoreCSVEntry, storeCerts map[string][]api.InventoriedCertificate, bundle map[string]string) []bundleComparison {
+	ids := make([]string, 0, len(stores))
+	for id := range stores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	comparisons := make([]bundleComparison, 0, len(ids))
+	for _, id := range ids {
+		c := bundleComparison{Store: stores[id]}
+		inStore := make(map[string]bool)
+		for _, cert := range storeCerts[id] {
+			tp := strings.ToUpper(cert.Thumbprint)
+			if inStore[tp] {
+				continue
+			}
+			inStore[tp] = true
+			if _, ok := bundle[tp]; !ok {
+				c.NotInBundle = append(c.NotInBundle, tp)
+			}
+		}
+		for tp := range bundle {
+			if !inStore[tp] {
+				c.Missing = append(c.Missing, tp)
+			}
+		}
+		sort.Strings(c.Missing)
+		sort.Strings(c.NotInBundle)
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+// bundleComparisonRows returns the comparison report, a row per difference.
+func bundleComparisonRows(comparisons []bundleComparison, storeCerts map[string][]api.InventoriedCertificate, bundle map[string]string) [][]string {
+	rows := [][]string{BundleComparisonHeader}
+	for _, c := range comparisons {
+		s := c.Store
+		for _, tp := range c.Missing {
+			rows = append(rows, []string{s.ID, s.Type, s.Machine, s.Path, tp, bundle[tp], bundleCompareMissing})
+		}
+		subjects := make(map[string]string)
+		for _, cert := range storeCerts[s.ID] {
+			subjects[strings.ToUpper(cert.Thumbprint)] = cert.IssuedDN
+		}
+		for _, tp := range c.NotInBundle {
+			rows = append(rows, []string{s.ID, s.Type, s.Machine, s.Path, tp, subjects[tp], bundleCompareNotInBundle})
+		}
+	}
+	return rows
+}
+
+// bundleComparisonPath returns the path to write the comparison report to, a timestamped file without outpath.
+func bundleComparisonPath(outpath string, overwrite bool) (string, error) {
+	if outpath == "" {
+		return fmt.Sprintf("rot_bundle_comparison_%s.csv", time.Now().UTC().Format("20060102T150405Z")), nil
+	}
+	return auditReportPath(outpath, overwrite)
+}
+
+// runBundleComparison writes the comparison report of the stores against the bundle source and prints a summary.
+func runBundleComparison(source string, stores map[string]StoreCSVEntry, storeCerts map[string][]api.InventoriedCertificate, outpath string, overwrite bool) (string, error) {
+	bundle, err := readComparisonBundle(source)
+	if err != nil {
+		return "", fmt.Errorf("reading trust bundle %s: %s", source, err)
+	}
+	reportPath, err := bundleComparisonPath(outpath, overwrite)
+	if err != nil {
+		return "", err
+	}
+	comparisons := compareStoresToBundle(stores, storeCerts, bundle)
+	data := csvBytes(bundleComparisonRows(comparisons, storeCerts, bundle))
+	if reportPath == stdioPath {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = writeOutputFile(reportPath, data, 0644)
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing comparison report %s: %s", reportPath, err)
+	}
+
+	matching := 0
+	for _, c := range comparisons {
+		if len(c.Missing) == 0 && len(c.NotInBundle) == 0 {
+			matching++
+			continue
+		}
+		printWarning("Store %s (%s): %d bundle certificate(s) missing, %d certificate(s) not in the bundle\n",
+			c.Store.ID, c.Store.Path, len(c.Missing), len(c.NotInBundle))
+	}
+	printInfo("%d of %d store(s) match the %d certificate(s) of the bundle\n", matching, len(comparisons), len(bundle))
+	if reportPath != stdioPath {
+		printInfo("Comparison report written to %s\n", outputName(reportPath))
+	}
+	return reportPath, nil
+}
@@ -0,0 +1,333 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Statuses of the OS trust store comparison.
+const (
+	osCompareNotInOS  = "not_in_os"
+	osCompareOnlyInOS = "only_in_os"
+)
+
+// osTrustStoreTimeout is how long reading the trust store of an OS image may take, including pulling the image.
+const osTrustStoreTimeout = 10 * time.Minute
+
+// OSComparisonHeader is the header of the report written by `stores rot compare-os`.
+var OSComparisonHeader = []string{"Thumbprint", "Subject", "Status"}
+
+// osTrustStore is how the trust store of an OS is read from its container image.
+type osTrustStore struct {
+	// image returns the container image of an OS version.
+	image func(version string) string
+	// command prints the trust store of the image as PEM.
+	command []string
+}
+
+// osTrustStores are the OS targets of `stores rot compare-os`. Images without the CA bundle installed, such as the
+// Debian base images, install it from the package repositories of their version.
+var osTrustStores = map[string]osTrustStore{
+	"debian": {
+		image: func(v string) string { return "debian:" + v },
+		command: []string{"sh", "-c", `f=/etc/ssl/certs/ca-certificates.crt; [ -f $f ] || { apt-get update -qq >/dev/null && ` +
+			`DEBIAN_FRONTEND=noninteractive apt-get install -qq -y ca-certificates >/dev/null; }; cat $f`},
+	},
+	"alpine": {
+		image:   func(v string) string { return "alpine:" + v },
+		command: []string{"sh", "-c", `f=/etc/ssl/certs/ca-certificates.crt; [ -f $f ] || apk add --no-cache -q ca-certificates >/dev/null; cat $f`},
+	},
+	"rhel": {
+		// UBI images are the freely distributable RHEL images, e.g. 9 is ubi9/ubi:latest and 9.3 is ubi9/ubi:9.3.
+		image: func(v string) string {
+			major, _, minor := strings.Cut(v, ".")
+			if !minor {
+				return fmt.Sprintf("registry.access.redhat.com/ubi%s/ubi:latest", major)
+			}
+			return fmt.Sprintf("registry.access.redhat.com/ubi%s/ubi:%s", major, v)
+		},
+		command: []string{"cat", "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"},
+	},
+	"windows": {
+		// Windows containers need a Windows host. The roots Windows downloads on demand are not in the image.
+		image: func(v string) string { return "mcr.microsoft.com/windows/servercore:" + v },
+		command: []string{"powershell", "-NoProfile", "-Command", `Get-ChildItem Cert:\LocalMachine\Root | ForEach-Object { ` +
+			`'-----BEGIN CERTIFICATE-----'; [Convert]::ToBase64String($_.RawData, 'InsertLineBreaks'); '-----END CERTIFICATE-----' }`},
+	},
+}
+
+func osTrustStoreTargets() []string {
+	targets := make([]string, 0, len(osTrustStores))
+	for t := range osTrustStores {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// containerRuntime returns runtime, or the first of docker and podman that is installed.
+func containerRuntime(runtime string) (string, error) {
+	candidates := []string{"docker", "podman"}
+	if runtime != "" {
+		candidates = []string{runtime}
+	}
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("container runtime %s not found, install one or pass the trust store with --bundle", strings.Join(candidates, " or "))
+}
+
+// readOSTrustStore runs the image of an OS version and returns its trust store by thumbprint, with subjects.
+func readOSTrustStore(ctx context.Context, runtime string, target string, version string) (map[string]string, error) {
+	store := osTrustStores[target]
+	image := store.image(version)
+	ctx, cancel := context.WithTimeout(ctx, osTrustStoreTimeout)
+	defer cancel()
+	args := append([]string{"run", "--rm", image}, store.command...)
+	c := exec.CommandContext(ctx, runtime, args...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	log.Printf("[DEBUG] reading trust store of %s with %s", image, runtime)
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading trust store of %s: %s: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+	certs, err := parsePEMCerts(out)
+	if err != nil {
+		return nil, fmt.Errorf("parsing trust store of %s: %s", image, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in the trust store of %s", image)
+	}
+	trusted := make(map[string]string, len(certs))
+	for _, cert := range certs {
+		trusted[certThumbprint(cert)] = cert.Subject.String()
+	}
+	return trusted, nil
+}
+
+// desiredRootSet returns the thumbprints of the certs file, with subjects where they are known. Certificate IDs are
+// looked up in Keyfactor.
+func desiredRootSet(kfClient *api.Client, certsFile string) (map[string]string, error) {
+	certs, err := readCertsFile(certsFile, kfClient)
+	if err != nil {
+		return nil, err
+	}
+	desired := make(map[string]string, len(certs))
+	for cert := range certs {
+		id, idErr := strconv.Atoi(cert)
+		if idErr != nil {
+			desired[strings.ToUpper(cert)] = ""
+			continue
+		}
+		lookup, lErr := kfClient.GetCertificateContext(&api.GetCertificateContextArgs{Id: id, CollectionId: rotCollectionArg()})
+		if lErr != nil {
+			return nil, fmt.Errorf("looking up certificate %d: %s", id, lErr)
+		}
+		desired[strings.ToUpper(lookup.Thumbprint)] = lookup.IssuedDN
+	}
+	return desired, nil
+}
+
+// storeRootSet returns the certificates in the inventory of a store by thumbprint, with subjects.
+func storeRootSet(kfClient *api.Client, storeID string) (map[string]string, error) {
+	inventory, err := kfClient.GetCertStoreInventory(storeID)
+	if err != nil {
+		return nil, fmt.Errorf("getting inventory of store %s: %s", storeID, err)
+	}
+	roots := make(map[string]string)
+	for _, inv := range *inventory {
+		for _, c := range inv.Certificates {
+			if c.Thumbprint != "" {
+				roots[strings.ToUpper(c.Thumbprint)] = c.IssuedDN
+			}
+		}
+	}
+	return roots, nil
+}
+
+// compareToOSTrustStore returns a row of OSComparisonHeader per certificate that is only in roots or only in the OS
+// trust store, sorted by status and subject, and the number of certificates in both.
+func compareToOSTrustStore(roots map[string]string, osRoots map[string]string) ([][]string, int) {
+	var rows [][]string
+	both := 0
+	for tp, subject := range roots {
+		if _, ok := osRoots[tp]; ok {
+			both++
+			continue
+		}
+		rows = append(rows, []string{tp, subject, osCompareNotInOS})
+	}
+	for tp, subject := range osRoots {
+		if _, ok := roots[tp]; !ok {
+			rows = append(rows, []string{tp, subject, osCompareOnlyInOS})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][2] != rows[j][2] {
+			return rows[i][2] < rows[j][2]
+		}
+		if rows[i][1] != rows[j][1] {
+			return rows[i][1] < rows[j][1]
+		}
+		return rows[i][0] < rows[j][0]
+	})
+	return rows, both
+}
+
+var rotCompareOSCmd = &cobra.Command{
+	Use:   "compare-os --target <os> --version <version> (--add-certs <file> | --store-id <id>)",
+	Short: "Compare a root set to the trust store of an OS image.",
+	Long: `Compares the desired root set of an --add-certs file, or the inventory of a store, to the trust store published
+with a version of an operating system, e.g. to standardize the roots of base images. Lists the roots you trust that
+the OS does not, and the roots the OS trusts that you do not. Certificates are matched by thumbprint.
+
+The trust store is read from the container image of the OS version with docker or podman, see --runtime:
+  debian   debian:<version>, with the ca-certificates package of that version
+  alpine   alpine:<version>
+  rhel     registry.access.redhat.com/ubi<major>/ubi:<version>
+  windows  mcr.microsoft.com/windows/servercore:<version>, e.g. ltsc2022. Needs a Windows host. Roots that Windows
+           downloads on demand are not in the image.
+Use --bundle to compare to a PEM trust store that was already extracted from an image instead.`,
+	Example: `kfutil stores rot compare-os --target debian --version 12 --add-certs roots.csv
+kfutil stores rot compare-os --target rhel --version 9.3 --store-id 5d3a... --outpath rhel9.csv
+kfutil stores rot compare-os --target alpine --version 3.19 --add-certs roots.csv --bundle alpine-3.19.pem`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		target, _ := cmd.Flags().GetString("target")
+		version, _ := cmd.Flags().GetString("version")
+		certsFile, _ := cmd.Flags().GetString("add-certs")
+		storeID, _ := cmd.Flags().GetString("store-id")
+		bundle, _ := cmd.Flags().GetString("bundle")
+		runtime, _ := cmd.Flags().GetString("runtime")
+		outpath, _ := cmd.Flags().GetString("outpath")
+
+		target = strings.ToLower(target)
+		if _, ok := osTrustStores[target]; !ok {
+			fmt.Printf("[ERROR] unknown target '%s', must be one of %s\n", target, strings.Join(osTrustStoreTargets(), ", "))
+			log.Fatalf("[ERROR] unknown target: %s", target)
+		}
+		if certsFile == "" && storeID == "" {
+			fmt.Println("[ERROR] one of --add-certs or --store-id is required")
+			log.Fatalf("[ERROR] no root set given")
+		}
+		if bundle == "" && version == "" {
+			fmt.Println("[ERROR] --version is required to read the trust store of an OS image")
+			log.Fatalf("[ERROR] no version given")
+		}
+
+		label := fmt.Sprintf("%s %s", target, version)
+		var osRoots map[string]string
+		var oErr error
+		if bundle != "" {
+			osRoots, oErr = readComparisonBundle(bundle)
+		} else {
+			rt, rErr := containerRuntime(runtime)
+			if rErr != nil {
+				fmt.Printf("[ERROR] %s\n", rErr)
+				log.Fatalf("[ERROR] %s", rErr)
+			}
+			osRoots, oErr = readOSTrustStore(commandContext(cmd), rt, target, version)
+		}
+		if oErr != nil {
+			exitIfInterrupted(commandContext(cmd), "nothing was compared")
+			fmt.Printf("[ERROR] reading the trust store of %s: %s\n", label, oErr)
+			log.Fatalf("[ERROR] reading OS trust store: %s", oErr)
+		}
+
+		kfClient, cErr := initClient()
+		if cErr != nil {
+			fmt.Println("[ERROR] unable to connect to Keyfactor.")
+			log.Fatalf("[ERROR] %s", cErr)
+		}
+		var roots map[string]string
+		var rsErr error
+		source := certsFile
+		if storeID != "" {
+			roots, rsErr = storeRootSet(kfClient, storeID)
+			source = "store " + storeID
+		} else {
+			roots, rsErr = desiredRootSet(kfClient, certsFile)
+		}
+		if rsErr != nil {
+			fmt.Printf("[ERROR] %s\n", rsErr)
+			log.Fatalf("[ERROR] %s", rsErr)
+		}
+
+		rows, both := compareToOSTrustStore(roots, osRoots)
+		notInOS := 0
+		for _, row := range rows {
+			// Subjects of thumbprints from a certs file are only looked up for the differences.
+			if row[1] == "" {
+				if cert, found := lookupCertByThumbprint(kfClient, row[0]); found {
+					row[1] = cert.IssuedDN
+				}
+			}
+			if row[2] == osCompareNotInOS {
+				notInOS++
+			}
+		}
+		recordResultCount(osCompareNotInOS, notInOS)
+		recordResultCount(osCompareOnlyInOS, len(rows)-notInOS)
+
+		if outpath != "" {
+			out, wErr := createOutput(outpath)
+			if wErr == nil {
+				_, wErr = out.Write(csvBytes(append([][]string{OSComparisonHeader}, rows...)))
+				if cErr := out.Close(); wErr == nil {
+					wErr = cErr
+				}
+			}
+			if wErr != nil {
+				fmt.Printf("[ERROR] writing comparison report %s: %s\n", outpath, wErr)
+				log.Fatalf("[ERROR] writing comparison report: %s", wErr)
+			}
+		}
+		// With --outpath -, stdout is reserved for the report and the table goes to stderr.
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STATUS\tTHUMBPRINT\tSUBJECT")
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", row[2], row[0], row[1])
+		}
+		w.Flush()
+		printInfo("%d root(s) of %s are trusted by %s, %d are not. %s trusts %d root(s) that %s does not.\n",
+			both, source, label, notInOS, label, len(rows)-notInOS, source)
+		if outpath != "" && outpath != stdioPath {
+			printInfo("Comparison report written to %s\n", outputName(outpath))
+		}
+	},
+}
+
+func init() {
+	rotCmd.AddCommand(rotCompareOSCmd)
+	rotCompareOSCmd.Flags().String("target", "", fmt.Sprintf("Operating system to compare to, one of %s.", strings.Join(osTrustStoreTargets(), ", ")))
+	rotCompareOSCmd.Flags().String("version", "", "Version of the operating system, the tag of its container image, e.g. 12 for debian or ltsc2022 for windows.")
+	rotCompareOSCmd.Flags().StringP("add-certs", "a", "", "Certs file of the desired root set.")
+	rotCompareOSCmd.Flags().String("store-id", "", "ID of a store whose inventory is compared instead of a desired root set.")
+	rotCompareOSCmd.Flags().String("bundle", "", "PEM trust store extracted from the OS image, read instead of running the image.")
+	rotCompareOSCmd.Flags().String("runtime", "", "Container runtime to run the OS image with. Defaults to docker, or podman if docker is not installed.")
+	rotCompareOSCmd.Flags().StringP("outpath", "o", "", "Path to write the comparison report CSV to. Use - for stdout.")
+	rotCompareOSCmd.MarkFlagRequired("target")
+	rotCompareOSCmd.MarkFlagsMutuallyExclusive("add-certs", "store-id")
+}
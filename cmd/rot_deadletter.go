@@ -0,0 +1,100 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+const rotFailedActionsDefaultFileName = "failed_actions.json"
+
+// rotFailedAction is an entry of the failed actions file: the action, in the JSON form of plan actions, and why it
+// failed. The error is ignored when the file is retried.
+type rotFailedAction struct {
+	ROTAction
+	Error  string `json:"error,omitempty"`
+	Failed string `json:"failed_at,omitempty"`
+}
+
+func addFailedActionsFlags(cmd *cobra.Command) {
+	cmd.Flags().String("failed-actions", rotFailedActionsDefaultFileName,
+		"Path to write the actions that failed to, to retry them with --retry-failed once the cause is fixed.")
+	cmd.Flags().String("retry-failed", "",
+		"Retry only the actions of a failed actions file written by a previous reconcile, e.g. "+rotFailedActionsDefaultFileName+".")
+}
+
+// readFailedActions reads the actions of a failed actions file, by thumbprint.
+func readFailedActions(path string) (map[string][]ROTAction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []rotFailedAction
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid failed actions file %s: %s", path, err)
+	}
+	actions := make(map[string][]ROTAction)
+	for i, e := range entries {
+		a := e.ROTAction
+		if a.StoreID == "" || (a.Thumbprint == "" && a.CertID <= 0) || a.AddCert == a.RemoveCert {
+			return nil, fmt.Errorf("invalid failed actions file %s: action %d needs a store_id, a thumbprint or cert_id, and one of add or remove", path, i+1)
+		}
+		actions[a.Thumbprint] = append(actions[a.Thumbprint], a)
+	}
+	return actions, nil
+}
+
+// writeFailedActions writes the failures of a reconcile to --failed-actions. When a retry of that same file has no
+// failures left the file is removed, so it is not retried again. Dry runs do not write the file.
+func writeFailedActions(cmd *cobra.Command, failures []rotActionFailure, dryRun bool) {
+	if dryRun {
+		return
+	}
+	path, _ := cmd.Flags().GetString("failed-actions")
+	if path == "" {
+		return
+	}
+	if len(failures) == 0 {
+		retried, _ := cmd.Flags().GetString("retry-failed")
+		if retried != "" && sameFile(retried, path) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("[ERROR] removing %s: %s", path, err)
+			} else {
+				printInfo("All failed actions succeeded, removed %s\n", path)
+			}
+		}
+		return
+	}
+	entries := make([]rotFailedAction, 0, len(failures))
+	for _, f := range failures {
+		entries = append(entries, rotFailedAction{ROTAction: f.Action, Error: f.Err.Error(), Failed: GetCurrentTime()})
+	}
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Printf("[ERROR] writing failed actions to %s: %s\n", path, err)
+		log.Printf("[ERROR] writing failed actions: %s", err)
+		return
+	}
+	printWarning("%d action(s) failed and were written to %s. Retry them with: kfutil stores rot reconcile --retry-failed %s\n",
+		len(failures), path, path)
+}
+
+// sameFile reports whether two paths name the same file.
+func sameFile(a string, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	aInfo, aErr := os.Stat(a)
+	bInfo, bErr := os.Stat(b)
+	return aErr == nil && bErr == nil && os.SameFile(aInfo, bInfo)
+}
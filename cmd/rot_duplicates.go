@@ -0,0 +1,192 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+var DuplicateHeader = []string{"SubjectName", "Thumbprint", "CertID", "NotBefore", "NotAfter", "Generation", "StoreCount", "StoreIDs", "AuditDate"}
+
+const (
+	generationNewest     = "newest"
+	generationSuperseded = "superseded"
+)
+
+func addDuplicateRootsFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("detect-duplicates", false,
+		"Report root certificates with the same subject but different thumbprints across the audited stores to <report>_duplicates.csv.")
+	cmd.Flags().String("prefer", "",
+		"Used with --detect-duplicates. Set to 'newest' to add remove actions for superseded generations of a root to the audit report.")
+}
+
+// duplicateRootsFromFlags returns whether duplicate detection is enabled and whether superseded generations are to be
+// removed. --prefer newest implies --detect-duplicates.
+func duplicateRootsFromFlags(cmd *cobra.Command) (bool, bool) {
+	detect, _ := cmd.Flags().GetBool("detect-duplicates")
+	prefer, _ := cmd.Flags().GetString("prefer")
+	switch strings.ToLower(strings.TrimSpace(prefer)) {
+	case "":
+		return detect, false
+	case generationNewest:
+		return true, true
+	default:
+		fmt.Printf("[ERROR] invalid --prefer '%s', must be %s\n", prefer, generationNewest)
+		log.Fatalf("[ERROR] invalid --prefer: %s", prefer)
+	}
+	return false, false
+}
+
+// rootGeneration is one certificate of a subject, with the stores it is in.
+type rootGeneration struct {
+	Cert      api.InventoriedCertificate
+	NotBefore time.Time
+	StoreIDs  []string
+}
+
+// duplicateRoot is a subject with more than one certificate across the audited stores, newest generation first.
+type duplicateRoot struct {
+	Subject     string
+	Generations []*rootGeneration
+}
+
+// findDuplicateRoots groups the certificates of the store inventories by subject DN and returns the subjects with
+// more than one thumbprint.
+func findDuplicateRoots(stores map[string]StoreCSVEntry, storeCerts map[string][]api.InventoriedCertificate) []duplicateRoot {
+	bySubject := make(map[string]map[string]*rootGeneration)
+	for storeID, certs := range storeCerts {
+		if _, ok := stores[storeID]; !ok {
+			continue
+		}
+		for _, cert := range certs {
+			key := normalizeDN(cert.IssuedDN)
+			if key == "" {
+				continue
+			}
+			if bySubject[key] == nil {
+				bySubject[key] = make(map[string]*rootGeneration)
+			}
+			thumbprint := strings.ToUpper(cert.Thumbprint)
+			gen, ok := bySubject[key][thumbprint]
+			if !ok {
+				notBefore, _ := parseInputDate(cert.NotBefore)
+				gen = &rootGeneration{Cert: cert, NotBefore: notBefore}
+				bySubject[key][thumbprint] = gen
+			}
+			gen.StoreIDs = append(gen.StoreIDs, storeID)
+		}
+	}
+	var duplicates []duplicateRoot
+	for _, gens := range bySubject {
+		if len(gens) < 2 {
+			continue
+		}
+		var d duplicateRoot
+		for _, gen := range gens {
+			sort.Strings(gen.StoreIDs)
+			d.Generations = append(d.Generations, gen)
+		}
+		sort.Slice(d.Generations, func(i, j int) bool {
+			a, b := d.Generations[i], d.Generations[j]
+			if !a.NotBefore.Equal(b.NotBefore) {
+				return a.NotBefore.After(b.NotBefore)
+			}
+			return a.Cert.Thumbprint < b.Cert.Thumbprint
+		})
+		d.Subject = d.Generations[0].Cert.IssuedDN
+		duplicates = append(duplicates, d)
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Subject < duplicates[j].Subject })
+	return duplicates
+}
+
+// supersededRemovals returns remove action rows for the older generations of the duplicates, in the stores that
+// also have the newest generation or are getting it added. Certificates to add and deployments that already have a
+// remove action are left alone.
+func supersededRemovals(duplicates []duplicateRoot, stores map[string]StoreCSVEntry, addCerts map[string]string, actions map[string][]ROTAction) [][]string {
+	removing := make(map[string]bool)
+	gettingCert := make(map[string]bool)
+	for thumbprint, certActions := range actions {
+		for _, a := range certActions {
+			key := strings.ToUpper(thumbprint) + a.StoreID
+			if a.RemoveCert {
+				removing[key] = true
+			} else if a.AddCert {
+				gettingCert[key] = true
+			}
+		}
+	}
+	adding := make(map[string]bool, len(addCerts))
+	for _, cert := range addCerts {
+		adding[strings.ToUpper(cert)] = true
+	}
+	var rows [][]string
+	for _, d := range duplicates {
+		newest := d.Generations[0]
+		newestThumbprint := strings.ToUpper(newest.Cert.Thumbprint)
+		hasNewest := make(map[string]bool)
+		for _, storeID := range newest.StoreIDs {
+			hasNewest[storeID] = true
+		}
+		for _, gen := range d.Generations[1:] {
+			thumbprint := strings.ToUpper(gen.Cert.Thumbprint)
+			if adding[thumbprint] {
+				continue
+			}
+			for _, storeID := range gen.StoreIDs {
+				if removing[thumbprint+storeID] || (!hasNewest[storeID] && !gettingCert[newestThumbprint+storeID]) {
+					continue
+				}
+				store := stores[storeID]
+				rows = append(rows, []string{gen.Cert.Thumbprint, strconv.Itoa(gen.Cert.Id), gen.Cert.IssuedDN, gen.Cert.IssuerDN,
+					store.ID, store.Type, store.Machine, store.Path, "false", "true", "true", GetCurrentTime(), "false"})
+			}
+		}
+	}
+	return rows
+}
+
+// writeDuplicateReport writes the duplicate roots next to the audit report and, when removeSuperseded is set,
+// appends remove actions for their superseded generations to the audit report.
+func writeDuplicateReport(duplicates []duplicateRoot, auditPath string, removeSuperseded bool, stores map[string]StoreCSVEntry, addCerts map[string]string, actions map[string][]ROTAction) error {
+	duplicatesPath := auditSideReportPath(auditPath, "duplicates")
+	data := [][]string{DuplicateHeader}
+	for _, d := range duplicates {
+		for i, gen := range d.Generations {
+			generation := generationSuperseded
+			if i == 0 {
+				generation = generationNewest
+			}
+			data = append(data, []string{d.Subject, gen.Cert.Thumbprint, strconv.Itoa(gen.Cert.Id), gen.Cert.NotBefore,
+				gen.Cert.NotAfter, generation, strconv.Itoa(len(gen.StoreIDs)), strings.Join(gen.StoreIDs, ";"), GetCurrentTime()})
+		}
+	}
+	if err := writeOutputFile(duplicatesPath, csvBytes(data), 0644); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		printWarning("%d root(s) have more than one generation across the audited stores, see %s\n", len(duplicates), duplicatesPath)
+	} else {
+		printInfo("No duplicate roots found across the audited stores.\n")
+	}
+	if !removeSuperseded {
+		return nil
+	}
+	rows := supersededRemovals(duplicates, stores, addCerts, actions)
+	if len(rows) == 0 {
+		return nil
+	}
+	return appendAuditActions(auditPath, rows, "superseded root generations")
+}
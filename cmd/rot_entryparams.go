@@ -0,0 +1,127 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+)
+
+// entryParamColumnPrefix marks the audit report columns holding entry parameters, e.g. `entry.CertificateName`.
+const entryParamColumnPrefix = "entry."
+
+// entryParamsFromRow returns the entry parameters in the extra columns of an audit report row.
+func entryParamsFromRow(row tabularRow) map[string]string {
+	var params map[string]string
+	for column, value := range row.Extra {
+		if len(column) <= len(entryParamColumnPrefix) || !strings.EqualFold(column[:len(entryParamColumnPrefix)], entryParamColumnPrefix) {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[column[len(entryParamColumnPrefix):]] = value
+	}
+	return params
+}
+
+// parseEntryParamFlags parses --entry-param values in the form `[<store-type>:]<name>=<value>`. The result is keyed by
+// lower case store type short name, with parameters for all store types under "".
+func parseEntryParamFlags(values []string) (map[string]map[string]string, error) {
+	params := make(map[string]map[string]string)
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --entry-param '%s', expected [<store-type>:]<name>=<value>", v)
+		}
+		storeType, name, scoped := strings.Cut(key, ":")
+		if !scoped {
+			storeType, name = "", key
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid --entry-param '%s', missing parameter name", v)
+		}
+		storeType = strings.ToLower(storeType)
+		if params[storeType] == nil {
+			params[storeType] = make(map[string]string)
+		}
+		params[storeType][name] = value
+	}
+	return params, nil
+}
+
+// resolveEntryParams returns the entry parameters of an add action. Parameters of the action take precedence over
+// --entry-param values for its store type, which take precedence over unscoped values. Parameters the store type
+// requires on add are filled in from their default value, and an error is returned if one is still missing.
+func resolveEntryParams(a ROTAction, storeType *api.CertificateStoreType, flagParams map[string]map[string]string) (map[string]string, error) {
+	params := make(map[string]string)
+	for name, value := range flagParams[""] {
+		params[name] = value
+	}
+	if storeType != nil {
+		for name, value := range flagParams[strings.ToLower(storeType.ShortName)] {
+			params[name] = value
+		}
+	}
+	for name, value := range a.EntryParameters {
+		params[name] = value
+	}
+	if storeType == nil || storeType.EntryParameters == nil {
+		return params, nil
+	}
+
+	known := make(map[string]bool)
+	var missing []string
+	for _, p := range *storeType.EntryParameters {
+		known[p.Name] = true
+		if params[p.Name] != "" {
+			continue
+		}
+		if p.DefaultValue != "" {
+			params[p.Name] = p.DefaultValue
+		} else if p.RequiredWhen.OnAdd {
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("store type %s requires entry parameter(s) %s", storeType.ShortName, strings.Join(missing, ", "))
+	}
+	for name := range params {
+		if !known[name] {
+			// Unscoped flags apply to every store type, only parameters the store type defines are sent.
+			delete(params, name)
+		}
+	}
+	return params, nil
+}
+
+// addCertificateWithEntryParams adds a certificate to a store through the SDK client, which unlike the legacy client
+// supports the job fields used to pass entry parameters.
+func addCertificateWithEntryParams(sdkClient *keyfactor.APIClient, certID int, entry api.CertificateStore, params map[string]string) error {
+	storeEntry := keyfactor.NewModelsCertificateStoreEntry(entry.CertificateStoreId)
+	if entry.Alias != "" {
+		storeEntry.Alias = stringToPointer(entry.Alias)
+	}
+	storeEntry.Overwrite = boolToPointer(entry.Overwrite)
+	storeEntry.JobFields = make(map[string]map[string]interface{}, len(params))
+	for name, value := range params {
+		storeEntry.JobFields[name] = map[string]interface{}{"Value": value}
+	}
+	schedule := keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{Immediate: boolToPointer(true)}
+	req := keyfactor.NewKeyfactorApiModelsCertificateStoresAddCertificateRequest(int32(certID), []keyfactor.ModelsCertificateStoreEntry{*storeEntry}, schedule)
+	_, _, err := sdkClient.CertificateStoreApi.CertificateStoreAddCertificate(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		AddRequest(*req).
+		Execute()
+	return err
+}
@@ -0,0 +1,182 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// rotStoreFilter restricts a reconcile to a subset of stores, selected by store ID or machine. Patterns are shell
+// globs matched case-insensitively, e.g. `web*`.
+type rotStoreFilter struct {
+	onlyStores     []string
+	ignoreStores   []string
+	onlyMachines   []string
+	ignoreMachines []string
+}
+
+// addStoreFilterFlags adds the flags read by newROTStoreFilterFromFlags.
+func addStoreFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("only-stores", []string{}, "Only reconcile the stores with these IDs. Accepts glob patterns.")
+	cmd.Flags().StringSlice("ignore-stores", []string{}, "Do not reconcile the stores with these IDs. Accepts glob patterns.")
+	cmd.Flags().StringSlice("only-machines", []string{}, "Only reconcile stores on these client machines, e.g. 'web*'. Accepts glob patterns.")
+	cmd.Flags().StringSlice("ignore-machines", []string{}, "Do not reconcile stores on these client machines. Accepts glob patterns.")
+}
+
+func newROTStoreFilterFromFlags(cmd *cobra.Command) (*rotStoreFilter, error) {
+	f := &rotStoreFilter{}
+	f.onlyStores, _ = cmd.Flags().GetStringSlice("only-stores")
+	f.ignoreStores, _ = cmd.Flags().GetStringSlice("ignore-stores")
+	f.onlyMachines, _ = cmd.Flags().GetStringSlice("only-machines")
+	f.ignoreMachines, _ = cmd.Flags().GetStringSlice("ignore-machines")
+	for _, patterns := range [][]string{f.onlyStores, f.ignoreStores, f.onlyMachines, f.ignoreMachines} {
+		for _, p := range patterns {
+			if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+				return nil, fmt.Errorf("invalid store filter pattern '%s': %s", p, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// matchAny returns true if value matches one of the patterns.
+func matchAny(patterns []string, value string) bool {
+	value = strings.ToLower(value)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns true if any filter is set.
+func (f *rotStoreFilter) active() bool {
+	return len(f.onlyStores)+len(f.ignoreStores)+len(f.onlyMachines)+len(f.ignoreMachines) > 0
+}
+
+// allows returns true if the store with the given ID on the given machine passes the filter.
+func (f *rotStoreFilter) allows(storeID string, machine string) bool {
+	if len(f.onlyStores) > 0 && !matchAny(f.onlyStores, storeID) {
+		return false
+	}
+	if len(f.onlyMachines) > 0 && !matchAny(f.onlyMachines, machine) {
+		return false
+	}
+	return !matchAny(f.ignoreStores, storeID) && !matchAny(f.ignoreMachines, machine)
+}
+
+// storeExclusions excludes stores by store type and container, e.g. all stores except IIS Personal and device stores.
+// Patterns are shell globs matched case-insensitively against the short name or ID of the store type and the name or
+// ID of the container.
+type storeExclusions struct {
+	storeTypes []string
+	containers []string
+
+	kfClient       *api.Client
+	storeTypeNames map[int]string
+	excluded       map[string]string
+}
+
+// addStoreExclusionFlags adds the flags read by newStoreExclusionsFromFlags.
+func addStoreExclusionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("exclude-store-type", []string{}, "Exclude stores of these store types, by short name or ID, e.g. IISU. Accepts glob patterns.")
+	cmd.Flags().StringSlice("exclude-container", []string{}, "Exclude stores in these containers, by name or ID. Accepts glob patterns.")
+}
+
+func newStoreExclusionsFromFlags(cmd *cobra.Command, kfClient *api.Client) (*storeExclusions, error) {
+	e := &storeExclusions{kfClient: kfClient, storeTypeNames: make(map[int]string), excluded: make(map[string]string)}
+	e.storeTypes, _ = cmd.Flags().GetStringSlice("exclude-store-type")
+	e.containers, _ = cmd.Flags().GetStringSlice("exclude-container")
+	for _, patterns := range [][]string{e.storeTypes, e.containers} {
+		for _, p := range patterns {
+			if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+				return nil, fmt.Errorf("invalid store exclusion pattern '%s': %s", p, err)
+			}
+		}
+	}
+	return e, nil
+}
+
+// active returns true if any exclusion is set.
+func (e *storeExclusions) active() bool {
+	return len(e.storeTypes)+len(e.containers) > 0
+}
+
+// excludesRow returns the reason a stores template row of storeType and container is excluded, or "" if it is not.
+func (e *storeExclusions) excludesRow(storeType string, container string, containerID string) string {
+	if storeType != "" && matchAny(e.storeTypes, storeType) {
+		return fmt.Sprintf("store type %s is excluded", storeType)
+	}
+	if (container != "" && matchAny(e.containers, container)) || (containerID != "" && matchAny(e.containers, containerID)) {
+		return fmt.Sprintf("container %s is excluded", container)
+	}
+	return ""
+}
+
+// storeTypeName returns the short name of a store type, looked up once.
+func (e *storeExclusions) storeTypeName(id int) (string, error) {
+	if name, ok := e.storeTypeNames[id]; ok {
+		return name, nil
+	}
+	st, err := e.kfClient.GetCertificateStoreType(id)
+	if err != nil {
+		return "", err
+	}
+	e.storeTypeNames[id] = st.ShortName
+	return st.ShortName, nil
+}
+
+// excludes returns the reason a store is excluded, or "" if it is not.
+func (e *storeExclusions) excludes(store *api.GetCertificateStoreResponse) (string, error) {
+	if !e.active() {
+		return "", nil
+	}
+	if len(e.storeTypes) > 0 {
+		if matchAny(e.storeTypes, fmt.Sprintf("%d", store.CertStoreType)) {
+			return fmt.Sprintf("store type %d is excluded", store.CertStoreType), nil
+		}
+		name, err := e.storeTypeName(store.CertStoreType)
+		if err != nil {
+			return "", fmt.Errorf("getting store type %d: %s", store.CertStoreType, err)
+		}
+		if reason := e.excludesRow(name, "", ""); reason != "" {
+			return reason, nil
+		}
+	}
+	containerID := ""
+	if store.ContainerId > 0 {
+		containerID = fmt.Sprintf("%d", store.ContainerId)
+	}
+	return e.excludesRow("", store.ContainerName, containerID), nil
+}
+
+// excludesID returns the reason the store with storeID is excluded, or "" if it is not. Stores are looked up once,
+// and only if an exclusion is set.
+func (e *storeExclusions) excludesID(storeID string) (string, error) {
+	if !e.active() {
+		return "", nil
+	}
+	if reason, ok := e.excluded[storeID]; ok {
+		return reason, nil
+	}
+	store, err := e.kfClient.GetCertificateStoreByID(storeID)
+	if err != nil {
+		return "", fmt.Errorf("getting store %s: %s", storeID, err)
+	}
+	reason, err := e.excludes(store)
+	if err != nil {
+		return "", err
+	}
+	e.excluded[storeID] = reason
+	return reason, nil
+}
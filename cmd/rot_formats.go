@@ -0,0 +1,173 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const (
+	bundleFormatPEM      = "pem"
+	bundleFormatVenafi   = "venafi"
+	bundleFormatCAPolicy = "capolicy"
+	bundleFormatKeytool  = "keytool"
+)
+
+var (
+	// sha1HexPattern matches a SHA-1 thumbprint written as hex, optionally separated by spaces or colons.
+	sha1HexPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[ :]?[0-9a-f]{2}){19}\b`)
+	// keytoolSHA1Pattern matches the SHA-1 fingerprint line of `keytool -list -v`.
+	keytoolSHA1Pattern = regexp.MustCompile(`(?im)^\s*SHA-?1:\s*([0-9a-f:]+)\s*$`)
+	// capolicyHashPattern matches the thumbprint lines of Microsoft CAPolicy.inf style lists and certutil dumps, e.g.
+	// `CertHash = 1a2b...` or `Cert Hash(sha1): 1a 2b ...`.
+	capolicyHashPattern = regexp.MustCompile(`(?im)^\s*(?:cert\s*hash(?:\s*\(sha1\))?|thumbprint|sha1)\s*[:=]\s*"?([0-9a-f: ]+?)"?\s*$`)
+)
+
+// trustSource is the desired trust state read from a bundle or PKI export. Certificates can be imported into Keyfactor,
+// entries that only have a thumbprint must already exist in Keyfactor.
+type trustSource struct {
+	Certs       []*x509.Certificate
+	Thumbprints []string
+	seen        map[string]bool
+}
+
+func newTrustSource() *trustSource {
+	return &trustSource{seen: make(map[string]bool)}
+}
+
+// addCert adds a CA certificate, skipping non CA certificates and duplicates.
+func (t *trustSource) addCert(cert *x509.Certificate) {
+	thumbprint := certThumbprint(cert)
+	if t.seen[thumbprint] {
+		return
+	}
+	t.seen[thumbprint] = true
+	if !cert.IsCA {
+		log.Printf("[WARN] skipping non CA certificate %s", cert.Subject.String())
+		return
+	}
+	t.Certs = append(t.Certs, cert)
+}
+
+// addThumbprint adds a thumbprint in any hex notation unless a certificate with the same thumbprint was already added.
+func (t *trustSource) addThumbprint(value string) {
+	thumbprint := strings.ToUpper(strings.NewReplacer(" ", "", ":", "").Replace(value))
+	if len(thumbprint) != 40 || t.seen[thumbprint] {
+		return
+	}
+	t.seen[thumbprint] = true
+	t.Thumbprints = append(t.Thumbprints, thumbprint)
+}
+
+// addPEM adds all certificates of the PEM blocks in data.
+func (t *trustSource) addPEM(data []byte) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			log.Printf("[WARN] skipping unparsable certificate in bundle: %s", err)
+			continue
+		}
+		t.addCert(cert)
+	}
+}
+
+// addVenafiValue walks a decoded Venafi JSON export. Certificates are taken from PEM or base64 DER string values, and
+// thumbprints from values of keys named like `Thumbprint`. Thumbprints are returned so that they can be added after
+// all certificates.
+func (t *trustSource) addVenafiValue(key string, value interface{}) []string {
+	var thumbprints []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			thumbprints = append(thumbprints, t.addVenafiValue(k, child)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			thumbprints = append(thumbprints, t.addVenafiValue(key, child)...)
+		}
+	case string:
+		if strings.Contains(v, "-----BEGIN CERTIFICATE-----") {
+			t.addPEM([]byte(strings.ReplaceAll(v, `\n`, "\n")))
+			break
+		}
+		if strings.Contains(strings.ToLower(key), "thumbprint") {
+			thumbprints = append(thumbprints, v)
+			break
+		}
+		if len(v) > 200 {
+			if der, err := base64.StdEncoding.DecodeString(v); err == nil {
+				if cert, cErr := x509.ParseCertificate(der); cErr == nil {
+					t.addCert(cert)
+				}
+			}
+		}
+	}
+	return thumbprints
+}
+
+// parseTrustSource parses the desired trust state from data in the given format:
+//
+//	pem       a PEM encoded CA bundle
+//	venafi    a Venafi policy or certificate JSON export, falling back to the PEM certificates in the file
+//	capolicy  a Microsoft CAPolicy.inf style list or certutil dump of certificate hashes
+//	keytool   the output of `keytool -list -v` or `keytool -list -rfc`
+func parseTrustSource(format string, data []byte) (*trustSource, error) {
+	t := newTrustSource()
+	switch strings.ToLower(format) {
+	case bundleFormatPEM, "":
+		t.addPEM(data)
+	case bundleFormatVenafi:
+		var doc interface{}
+		if err := json.Unmarshal(bytes.TrimPrefix(data, utf8BOM), &doc); err == nil {
+			for _, thumbprint := range t.addVenafiValue("", doc) {
+				t.addThumbprint(thumbprint)
+			}
+		} else {
+			log.Printf("[WARN] Venafi export is not JSON, reading PEM certificates only: %s", err)
+			t.addPEM(data)
+		}
+	case bundleFormatCAPolicy:
+		t.addPEM(data)
+		for _, m := range capolicyHashPattern.FindAllSubmatch(data, -1) {
+			t.addThumbprint(string(m[1]))
+		}
+		if len(t.Certs) == 0 && len(t.Thumbprints) == 0 {
+			// Plain lists with one thumbprint per line.
+			for _, m := range sha1HexPattern.FindAll(data, -1) {
+				t.addThumbprint(string(m))
+			}
+		}
+	case bundleFormatKeytool:
+		// -rfc output contains the certificates, -v output only their fingerprints.
+		t.addPEM(data)
+		for _, m := range keytoolSHA1Pattern.FindAllSubmatch(data, -1) {
+			t.addThumbprint(string(m[1]))
+		}
+	default:
+		return nil, fmt.Errorf("invalid format '%s', must be one of %s, %s, %s or %s", format, bundleFormatPEM, bundleFormatVenafi, bundleFormatCAPolicy, bundleFormatKeytool)
+	}
+	if len(t.Certs) == 0 && len(t.Thumbprints) == 0 {
+		return nil, fmt.Errorf("no CA certificates found in bundle")
+	}
+	return t, nil
+}
@@ -0,0 +1,252 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"kfutil/pkg/rot"
+)
+
+// rotStoreHandler builds the store entries used to add and remove root certificates for a family of store types.
+// Handlers are registered per store type short name with registerROTStoreHandler.
+type rotStoreHandler interface {
+	addEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error)
+	removeEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error)
+}
+
+var rotStoreHandlers = make(map[string]rotStoreHandler)
+
+// registerROTStoreHandler registers handler for the given store type short names.
+func registerROTStoreHandler(handler rotStoreHandler, storeTypes ...string) {
+	for _, st := range storeTypes {
+		rotStoreHandlers[strings.ToLower(st)] = handler
+	}
+}
+
+// rotStoreHandlerFor returns the handler of a store type short name, or the default handler.
+func rotStoreHandlerFor(storeType string) rotStoreHandler {
+	if h, ok := rotStoreHandlers[strings.ToLower(storeType)]; ok {
+		return h
+	}
+	return defaultROTHandler{}
+}
+
+func init() {
+	registerROTStoreHandler(windowsROTHandler{}, "WinCert", "IISU", "IISBin", "IISBinding", "IIS", "IISPersonal", "IISRoots", "WinSql")
+	registerROTStoreHandler(javaROTHandler{}, "JKS", "RFJKS", "K8SJKS", "AKV_JKS", "JavaKeystore")
+}
+
+// rotStoreContext caches the lookups handlers need while reconciling. It is safe for concurrent use.
+type rotStoreContext struct {
+	kfClient    *api.Client
+	mu          sync.Mutex
+	storeTypes  map[string]*api.CertificateStoreType
+	inventories map[string][]api.CertStoreInventory
+	aliases     map[string]map[string]string
+}
+
+func newROTStoreContext(kfClient *api.Client) *rotStoreContext {
+	return &rotStoreContext{
+		kfClient:    kfClient,
+		storeTypes:  make(map[string]*api.CertificateStoreType),
+		inventories: make(map[string][]api.CertStoreInventory),
+		aliases:     make(map[string]map[string]string),
+	}
+}
+
+// storeType returns the store type of the store of a, or nil if it cannot be looked up. Actions from audit files may
+// reference the store type by short name, by ID or not at all.
+func (c *rotStoreContext) storeType(a ROTAction) *api.CertificateStoreType {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := a.StoreType
+	if key == "" {
+		key = "store:" + a.StoreID
+	}
+	if st, ok := c.storeTypes[key]; ok {
+		return st
+	}
+	var id interface{} = a.StoreType
+	if n, err := strconv.Atoi(a.StoreType); err == nil {
+		id = n
+	} else if a.StoreType == "" {
+		store, sErr := c.kfClient.GetCertificateStoreByID(a.StoreID)
+		if sErr != nil {
+			log.Printf("[WARN] unable to look up store %s: %s", a.StoreID, sErr)
+			c.storeTypes[key] = nil
+			return nil
+		}
+		id = store.CertStoreType
+	}
+	st, err := c.kfClient.GetCertificateStoreType(id)
+	if err != nil {
+		log.Printf("[WARN] unable to look up store type of store %s: %s", a.StoreID, err)
+		st = nil
+	}
+	c.storeTypes[key] = st
+	return st
+}
+
+// handlerFor returns the handler of the store type of a.
+func (c *rotStoreContext) handlerFor(a ROTAction) rotStoreHandler {
+	if st := c.storeType(a); st != nil {
+		return rotStoreHandlerFor(st.ShortName)
+	}
+	return rotStoreHandlerFor(a.StoreType)
+}
+
+// inventory returns the inventory of a store, fetching it once.
+func (c *rotStoreContext) inventory(storeID string) ([]api.CertStoreInventory, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if inv, ok := c.inventories[storeID]; ok {
+		return inv, nil
+	}
+	inv, err := c.kfClient.GetCertStoreInventory(storeID)
+	if err != nil {
+		return nil, err
+	}
+	c.inventories[storeID] = *inv
+	return *inv, nil
+}
+
+// defaultROTHandler adds certificates without an alias and removes them by thumbprint.
+type defaultROTHandler struct{}
+
+func (defaultROTHandler) addEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error) {
+	return api.CertificateStore{CertificateStoreId: a.StoreID, Overwrite: true}, nil
+}
+
+func (defaultROTHandler) removeEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error) {
+	return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: rot.RemovalAlias(a)}, nil
+}
+
+// windowsStoreNames maps the display names of the Windows certificate stores to their system store names.
+var windowsStoreNames = map[string]string{
+	"personal":                               "My",
+	"my":                                     "My",
+	"trusted root certification authorities": "Root",
+	"root":                                   "Root",
+	"third-party root certification authorities": "AuthRoot",
+	"authroot":                               "AuthRoot",
+	"intermediate certification authorities": "CA",
+	"ca":                                     "CA",
+	"trusted people":                         "TrustedPeople",
+	"trustedpeople":                          "TrustedPeople",
+	"trusted publishers":                     "TrustedPublisher",
+	"trustedpublisher":                       "TrustedPublisher",
+	"web hosting":                            "WebHosting",
+	"webhosting":                             "WebHosting",
+}
+
+// windowsStoreName returns the system store name of a Windows store path such as `Trusted Root Certification
+// Authorities` or `LocalMachine\Root`.
+func windowsStoreName(path string) (string, bool) {
+	name := path
+	if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+		name = name[i+1:]
+	}
+	system, ok := windowsStoreNames[strings.ToLower(strings.TrimSpace(name))]
+	return system, ok
+}
+
+// windowsROTHandler handles Windows and IIS stores, where certificates are addressed by thumbprint.
+type windowsROTHandler struct{}
+
+func (windowsROTHandler) addEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error) {
+	if name, ok := windowsStoreName(a.StorePath); ok && name != "Root" && name != "AuthRoot" && name != "CA" {
+		log.Printf("[WARN] adding root certificate %s to Windows store '%s' of store %s", a.Thumbprint, name, a.StoreID)
+	}
+	return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: a.Thumbprint, Overwrite: true}, nil
+}
+
+func (windowsROTHandler) removeEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error) {
+	return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: rot.RemovalAlias(a)}, nil
+}
+
+var javaAliasInvalidChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// javaAliasFromCN returns the default keystore alias of a certificate, its lower case CN with spaces replaced.
+func javaAliasFromCN(cn string, thumbprint string) string {
+	alias := strings.Trim(javaAliasInvalidChars.ReplaceAllString(strings.ToLower(cn), "_"), "_")
+	if alias == "" {
+		alias = strings.ToLower(thumbprint)
+	}
+	return alias
+}
+
+// javaROTHandler handles Java keystores, where every entry needs a unique alias.
+type javaROTHandler struct{}
+
+func (javaROTHandler) addEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error) {
+	inv, err := ctx.inventory(a.StoreID)
+	if err != nil {
+		return api.CertificateStore{}, fmt.Errorf("reading inventory of store %s: %s", a.StoreID, err)
+	}
+	if a.CertID <= 0 {
+		return api.CertificateStore{}, fmt.Errorf("certificate %s has no Keyfactor certificate ID", a.Thumbprint)
+	}
+	collectionID := rotCollectionID
+	cert, err := ctx.kfClient.GetCertificateContext(&api.GetCertificateContextArgs{
+		Id:               a.CertID,
+		IncludeMetadata:  boolToPointer(false),
+		IncludeLocations: boolToPointer(false),
+		CollectionId:     &collectionID,
+	})
+	if err != nil {
+		return api.CertificateStore{}, fmt.Errorf("looking up certificate %s: %s", a.Thumbprint, err)
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	// Aliases in use in the store, mapped to the thumbprint of their certificate.
+	used, ok := ctx.aliases[a.StoreID]
+	if !ok {
+		used = make(map[string]string)
+		for _, entry := range inv {
+			for _, c := range entry.Certificates {
+				used[strings.ToLower(entry.Name)] = strings.ToUpper(c.Thumbprint)
+			}
+		}
+		ctx.aliases[a.StoreID] = used
+	}
+	thumbprint := strings.ToUpper(a.Thumbprint)
+	alias := javaAliasFromCN(cert.IssuedCN, thumbprint)
+	if existing, taken := used[alias]; taken && existing != thumbprint {
+		alias = fmt.Sprintf("%s-%s", alias, strings.ToLower(thumbprint[:8]))
+		if existing, taken = used[alias]; taken && existing != thumbprint {
+			return api.CertificateStore{}, fmt.Errorf("alias '%s' is already used by another certificate in store %s", alias, a.StoreID)
+		}
+	}
+	used[alias] = thumbprint
+	return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: alias, Overwrite: false}, nil
+}
+
+func (javaROTHandler) removeEntry(ctx *rotStoreContext, a ROTAction) (api.CertificateStore, error) {
+	if a.Alias != "" {
+		return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: a.Alias}, nil
+	}
+	inv, err := ctx.inventory(a.StoreID)
+	if err != nil {
+		return api.CertificateStore{}, fmt.Errorf("reading inventory of store %s: %s", a.StoreID, err)
+	}
+	for _, entry := range inv {
+		for _, c := range entry.Certificates {
+			if strings.EqualFold(c.Thumbprint, a.Thumbprint) {
+				return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: entry.Name}, nil
+			}
+		}
+	}
+	return api.CertificateStore{}, fmt.Errorf("certificate %s not found in the inventory of store %s", a.Thumbprint, a.StoreID)
+}
@@ -0,0 +1,420 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	trendsFormatASCII = "ascii"
+	trendsFormatCSV   = "csv"
+)
+
+// TrendsHeader is the header of the CSV written by `stores rot trends --format csv`.
+var TrendsHeader = []string{"Time", "Group", "Stores", "Compliant", "StoresMissingRoots", "StoresUnexpected", "Drift"}
+
+// auditHistoryGroup is the summary of a group of stores of one audit run. Drift is the number of stores not in the
+// desired state.
+type auditHistoryGroup struct {
+	Group              string
+	Stores             int
+	Compliant          int
+	StoresMissingRoots int
+	StoresUnexpected   int
+	Drift              int
+}
+
+// auditHistoryRecord is the summary of one audit run, stored as a row of audit_runs and a row of audit_groups for the
+// total and each group.
+type auditHistoryRecord struct {
+	Time   time.Time
+	Report string
+	DryRun bool
+	Total  auditHistoryGroup
+	Groups []auditHistoryGroup
+}
+
+// historyDBClient is the SQLite command line client used to read and write the history database. As for --input-db,
+// using the client avoids linking a database driver into kfutil.
+const historyDBClient = "sqlite3"
+
+// auditHistorySchema creates the tables of the history database. audit_groups has a row for the total of each run,
+// with total set, and a row for each store type.
+const auditHistorySchema = `CREATE TABLE IF NOT EXISTS audit_runs (
+  id INTEGER PRIMARY KEY,
+  time TEXT NOT NULL,
+  report TEXT NOT NULL,
+  dry_run INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_groups (
+  run_id INTEGER NOT NULL REFERENCES audit_runs(id),
+  total INTEGER NOT NULL,
+  store_group TEXT NOT NULL,
+  stores INTEGER NOT NULL,
+  compliant INTEGER NOT NULL,
+  stores_missing_roots INTEGER NOT NULL,
+  stores_unexpected INTEGER NOT NULL,
+  drift INTEGER NOT NULL
+);
+`
+
+// auditHistoryQuery returns the runs of the history database with their groups, a row per group, oldest run first.
+const auditHistoryQuery = `SELECT r.id, r.time, r.report, r.dry_run, g.total, g.store_group, g.stores, g.compliant,
+  g.stores_missing_roots, g.stores_unexpected, g.drift
+FROM audit_runs r JOIN audit_groups g ON g.run_id = r.id
+ORDER BY r.id, g.total DESC, g.store_group;`
+
+// defaultHistoryDBPath returns the default history database, $HOME/.kfutil/history.db.
+func defaultHistoryDBPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".kfutil", "history.db")
+	}
+	return filepath.Join(home, ".kfutil", "history.db")
+}
+
+// expandHistoryPath expands a leading ~/ of path, which the shell does not do for --history-db=~/...
+func expandHistoryPath(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// historyGroup converts the status of a group to its history summary.
+func historyGroup(g rotStatusGroup) auditHistoryGroup {
+	return auditHistoryGroup{
+		Group:              g.Group,
+		Stores:             g.RootStores,
+		Compliant:          g.Compliant,
+		StoresMissingRoots: g.StoresMissingRoots,
+		StoresUnexpected:   len(g.UnexpectedStores),
+		Drift:              g.RootStores - g.Compliant,
+	}
+}
+
+// newAuditHistoryRecord summarises the rows of an audit report, including its header, by store type.
+func newAuditHistoryRecord(data [][]string, report string, dryRun bool, t time.Time) auditHistoryRecord {
+	total := newROTStatusAccumulator()
+	groups := make(map[string]*rotStatusAccumulator)
+	for i, row := range data {
+		if i == 0 || len(row) < len(AuditHeader) || row[4] == "" {
+			continue
+		}
+		name := row[5]
+		if name == "" {
+			name = "(unknown)"
+		}
+		if _, ok := groups[name]; !ok {
+			groups[name] = newROTStatusAccumulator()
+		}
+		add, _ := strconv.ParseBool(row[8])
+		remove, _ := strconv.ParseBool(row[9])
+		total.add(row[4], row[0], row[2], add, remove)
+		groups[name].add(row[4], row[0], row[2], add, remove)
+	}
+	rec := auditHistoryRecord{Time: t.UTC(), Report: report, DryRun: dryRun, Total: historyGroup(total.group("all", 0))}
+	for name, acc := range groups {
+		rec.Groups = append(rec.Groups, historyGroup(acc.group(name, 0)))
+	}
+	sort.Slice(rec.Groups, func(i, j int) bool { return rec.Groups[i].Group < rec.Groups[j].Group })
+	return rec
+}
+
+// sqlQuote returns s as an SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// runSQLite runs the SQL script on the SQLite database at path with the sqlite3 client and returns its output. args
+// are passed to the client before the database path, e.g. -csv.
+func runSQLite(path string, script string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(historyDBClient); err != nil {
+		return nil, fmt.Errorf("the SQLite client %s is required for the history database, install it: %s", historyDBClient, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbQueryTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, historyDBClient, append(append([]string{"-bail"}, args...), path)...)
+	c.Stdin = strings.NewReader(script)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// appendAuditHistory adds rec to the history database at path, creating it and its directory if needed.
+func appendAuditHistory(path string, rec auditHistoryRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	var script strings.Builder
+	script.WriteString(auditHistorySchema)
+	script.WriteString("BEGIN;\n")
+	dryRun := 0
+	if rec.DryRun {
+		dryRun = 1
+	}
+	fmt.Fprintf(&script, "INSERT INTO audit_runs (time, report, dry_run) VALUES (%s, %s, %d);\n",
+		sqlQuote(rec.Time.UTC().Format(time.RFC3339Nano)), sqlQuote(rec.Report), dryRun)
+	for i, g := range append([]auditHistoryGroup{rec.Total}, rec.Groups...) {
+		total := 0
+		if i == 0 {
+			total = 1
+		}
+		fmt.Fprintf(&script, "INSERT INTO audit_groups VALUES ((SELECT max(id) FROM audit_runs), %d, %s, %d, %d, %d, %d, %d);\n",
+			total, sqlQuote(g.Group), g.Stores, g.Compliant, g.StoresMissingRoots, g.StoresUnexpected, g.Drift)
+	}
+	script.WriteString("COMMIT;\n")
+	if _, err := runSQLite(path, script.String()); err != nil {
+		return err
+	}
+	// The database holds the history of the audited stores, so it is readable by its owner only, like the directory.
+	return os.Chmod(path, 0600)
+}
+
+// readAuditHistory returns the records of the history database at path in the order they were recorded.
+func readAuditHistory(path string) ([]auditHistoryRecord, error) {
+	// The client would create a missing database.
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	out, err := runSQLite(path, auditHistoryQuery, "-readonly", "-csv")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var records []auditHistoryRecord
+	lastID := ""
+	for n, row := range rows {
+		if len(row) != 11 {
+			return nil, fmt.Errorf("row %d: expected 11 columns, got %d", n+1, len(row))
+		}
+		var ints [7]int
+		for i, v := range append([]string{row[3], row[4]}, row[6:]...) {
+			if ints[i], err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("row %d: invalid number '%s'", n+1, v)
+			}
+		}
+		if row[0] != lastID {
+			t, tErr := time.Parse(time.RFC3339Nano, row[1])
+			if tErr != nil {
+				return nil, fmt.Errorf("row %d: invalid time '%s'", n+1, row[1])
+			}
+			records = append(records, auditHistoryRecord{Time: t, Report: row[2], DryRun: ints[0] != 0})
+			lastID = row[0]
+		}
+		g := auditHistoryGroup{Group: row[5], Stores: ints[2], Compliant: ints[3], StoresMissingRoots: ints[4],
+			StoresUnexpected: ints[5], Drift: ints[6]}
+		rec := &records[len(records)-1]
+		if ints[1] != 0 {
+			rec.Total = g
+		} else {
+			rec.Groups = append(rec.Groups, g)
+		}
+	}
+	return records, nil
+}
+
+// recordAuditHistory adds the summary of an audit run to the history database at path. A failure is reported but does
+// not fail the audit, the report has been written already.
+func recordAuditHistory(path string, data [][]string, report string, dryRun bool, t time.Time) {
+	path = expandHistoryPath(path)
+	if err := appendAuditHistory(path, newAuditHistoryRecord(data, report, dryRun, t)); err != nil {
+		printWarning("Recording the audit in history database %s failed: %s\n", path, err)
+		log.Printf("[ERROR] recording audit history: %s", err)
+		return
+	}
+	log.Printf("[INFO] audit recorded in history database %s", path)
+}
+
+// trendPoint is the summary of a group at the time of an audit run.
+type trendPoint struct {
+	Time  time.Time
+	Group auditHistoryGroup
+}
+
+// auditTrends returns the summaries of each group over time, the total as group "all". Only runs since since and the
+// groups in only, if any, are included.
+func auditTrends(records []auditHistoryRecord, since time.Time, only []string) (map[string][]trendPoint, []string) {
+	wanted := make(map[string]bool)
+	for _, g := range only {
+		wanted[g] = true
+	}
+	trends := make(map[string][]trendPoint)
+	for _, rec := range records {
+		if rec.Time.Before(since) {
+			continue
+		}
+		for _, g := range append([]auditHistoryGroup{rec.Total}, rec.Groups...) {
+			if len(wanted) > 0 && !wanted[g.Group] {
+				continue
+			}
+			trends[g.Group] = append(trends[g.Group], trendPoint{Time: rec.Time, Group: g})
+		}
+	}
+	var names []string
+	for name, points := range trends {
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// The total comes first.
+		if names[i] == "all" || names[j] == "all" {
+			return names[i] == "all"
+		}
+		return names[i] < names[j]
+	})
+	return trends, names
+}
+
+// printTrendsChart prints the drift of each group over time as horizontal bars of up to width characters.
+func printTrendsChart(w io.Writer, trends map[string][]trendPoint, names []string, width int) {
+	maxDrift := 0
+	for _, points := range trends {
+		for _, p := range points {
+			if p.Group.Drift > maxDrift {
+				maxDrift = p.Group.Drift
+			}
+		}
+	}
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n", name)
+		for _, p := range trends[name] {
+			bar := 0
+			if maxDrift > 0 {
+				bar = (p.Group.Drift*width + maxDrift - 1) / maxDrift
+			}
+			fmt.Fprintf(w, "  %s  %-*s %d/%d store(s) drifted\n", p.Time.Local().Format("2006-01-02 15:04"), width,
+				strings.Repeat("#", bar), p.Group.Drift, p.Group.Stores)
+		}
+	}
+}
+
+// trendsRows returns the trends as CSV rows, including the header.
+func trendsRows(trends map[string][]trendPoint, names []string) [][]string {
+	rows := [][]string{TrendsHeader}
+	for _, name := range names {
+		for _, p := range trends[name] {
+			g := p.Group
+			rows = append(rows, []string{p.Time.Format(time.RFC3339), name, strconv.Itoa(g.Stores), strconv.Itoa(g.Compliant),
+				strconv.Itoa(g.StoresMissingRoots), strconv.Itoa(g.StoresUnexpected), strconv.Itoa(g.Drift)})
+		}
+	}
+	return rows
+}
+
+var rotTrendsCmd = &cobra.Command{
+	Use:   "trends",
+	Short: "Chart the drift recorded by past audits over time.",
+	Long: `Charts the summary metrics that 'stores rot audit --history-db' recorded for each audit run, to show remediation
+progress over time. For each store type, and for all stores as 'all', the number of stores not in the desired state is
+shown per run. Use --format csv for the full metrics. No API calls are needed.
+
+The history database is a SQLite database with a row per audit run in audit_runs and a row per store type, and for the
+total, in audit_groups. It is read and written with the sqlite3 command line client, which must be installed.`,
+	Example: `kfutil stores rot trends
+kfutil stores rot trends --since 2160h --group all --group RFJKS
+kfutil stores rot trends --format csv --outpath trends.csv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		historyDB, _ := cmd.Flags().GetString("history-db")
+		groups, _ := cmd.Flags().GetStringSlice("group")
+		since, _ := cmd.Flags().GetDuration("since")
+		format, _ := cmd.Flags().GetString("format")
+		outpath, _ := cmd.Flags().GetString("outpath")
+		width, _ := cmd.Flags().GetInt("width")
+
+		if format != trendsFormatASCII && format != trendsFormatCSV {
+			fmt.Printf("[ERROR] invalid --format '%s', must be one of %s or %s\n", format, trendsFormatASCII, trendsFormatCSV)
+			log.Fatalf("[ERROR] invalid --format: %s", format)
+		}
+		if width < 1 {
+			width = 40
+		}
+		historyDB = expandHistoryPath(historyDB)
+		records, err := readAuditHistory(historyDB)
+		if err != nil {
+			fmt.Printf("[ERROR] reading history database %s: %s\n", historyDB, err)
+			log.Fatalf("[ERROR] reading history database: %s", err)
+		}
+		var from time.Time
+		if since > 0 {
+			from = time.Now().Add(-since)
+		}
+		trends, names := auditTrends(records, from, groups)
+		if len(names) == 0 {
+			printWarning("No audit runs recorded in %s match.\n", historyDB)
+			return
+		}
+
+		if format == trendsFormatASCII && outpath == "" {
+			printTrendsChart(os.Stdout, trends, names, width)
+			return
+		}
+		if outpath == "" {
+			outpath = "-"
+		}
+		out, oErr := createOutput(outpath)
+		if oErr != nil {
+			fmt.Printf("[ERROR] creating %s: %s\n", outpath, oErr)
+			log.Fatalf("[ERROR] creating %s: %s", outpath, oErr)
+		}
+		if format == trendsFormatCSV {
+			_, err = out.Write(csvBytes(trendsRows(trends, names)))
+		} else {
+			printTrendsChart(out, trends, names, width)
+		}
+		if cErr := out.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, err)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, err)
+		}
+		if outpath != "-" {
+			printInfo("Trends written to %s\n", outputName(outpath))
+		}
+	},
+}
+
+func init() {
+	rotCmd.AddCommand(rotTrendsCmd)
+	rotTrendsCmd.Flags().String("history-db", defaultHistoryDBPath(), "SQLite history database recorded by 'stores rot audit --history-db'.")
+	rotTrendsCmd.Flags().StringSlice("group", nil, "Only show these store types, or 'all' for the total. Repeatable.")
+	rotTrendsCmd.Flags().Duration("since", 0, "Only show audit runs within this duration, e.g. 720h.")
+	rotTrendsCmd.Flags().String("format", trendsFormatASCII, "Output format, one of ascii or csv.")
+	rotTrendsCmd.Flags().StringP("outpath", "o", "", "Path to write the trends to, '-' for stdout. Defaults to stdout.")
+	rotTrendsCmd.Flags().Int("width", 40, "Width of the longest bar of the ASCII chart.")
+}
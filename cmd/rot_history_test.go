@@ -0,0 +1,81 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLQuote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"", "''"},
+		{"rot_audit.csv", "'rot_audit.csv'"},
+		{"O'Brien's store", "'O''Brien''s store'"},
+		{"'); DROP TABLE audit_runs; --", "'''); DROP TABLE audit_runs; --'"},
+	}
+	for _, tt := range tests {
+		if got := sqlQuote(tt.s); got != tt.want {
+			t.Errorf("sqlQuote(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestAuditHistoryDatabase(t *testing.T) {
+	if _, err := exec.LookPath(historyDBClient); err != nil {
+		t.Skipf("%s is not installed", historyDBClient)
+	}
+	path := filepath.Join(t.TempDir(), ".kfutil", "history.db")
+	if _, err := readAuditHistory(path); !os.IsNotExist(err) {
+		t.Fatalf("readAuditHistory() of a missing database error = %v, want not exist", err)
+	}
+
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	records := []auditHistoryRecord{
+		{
+			Time:   start,
+			Report: "rot_audit_20230102T100000Z.csv",
+			Total:  auditHistoryGroup{Group: "all", Stores: 10, Compliant: 4, StoresMissingRoots: 5, StoresUnexpected: 1, Drift: 6},
+			Groups: []auditHistoryGroup{
+				{Group: "K8SCluster", Stores: 4, Compliant: 1, StoresMissingRoots: 3, Drift: 3},
+				{Group: "RFJKS", Stores: 6, Compliant: 3, StoresMissingRoots: 2, StoresUnexpected: 1, Drift: 3},
+			},
+		},
+		{
+			Time:   start.Add(24 * time.Hour),
+			Report: "s3://audits/it's a report.xlsx",
+			DryRun: true,
+			Total:  auditHistoryGroup{Group: "all", Stores: 10, Compliant: 10},
+		},
+	}
+	for _, rec := range records {
+		if err := appendAuditHistory(path, rec); err != nil {
+			t.Fatalf("appendAuditHistory() error = %v", err)
+		}
+	}
+	got, err := readAuditHistory(path)
+	if err != nil {
+		t.Fatalf("readAuditHistory() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("readAuditHistory() = %+v, want %+v", got, records)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("history database mode = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,194 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+var IssuerHeader = []string{"StoreID", "StoreType", "Machine", "Path", "Thumbprint", "CertID", "SubjectName", "Issuer", "AuditDate"}
+
+// dnSeparatorPattern matches the separators of a DN with the white space around them.
+var dnSeparatorPattern = regexp.MustCompile(`\s*([,=+])\s*`)
+
+// normalizeDN returns a DN in a form that compares equal for the same DN written with different case or spacing.
+func normalizeDN(dn string) string {
+	return strings.ToLower(dnSeparatorPattern.ReplaceAllString(strings.TrimSpace(dn), "$1"))
+}
+
+// issuerAllowList is the set of approved issuer DNs of --allowed-issuers. Entries may contain * wildcards.
+type issuerAllowList struct {
+	patterns []string
+}
+
+func addAllowedIssuersFlags(cmd *cobra.Command) {
+	cmd.Flags().String("allowed-issuers", "",
+		"File of approved issuer DNs, one per line, '*' wildcards allowed. Certificates in root stores issued by other CAs are "+
+			"written to <report>_issuers.csv.")
+	cmd.Flags().Bool("remove-unapproved", false, "Used with --allowed-issuers. Add remove actions for certificates of unapproved issuers to the audit report.")
+}
+
+// readIssuerAllowList reads an allowed issuers file. Blank lines and lines starting with # are ignored.
+func readIssuerAllowList(listPath string) (*issuerAllowList, error) {
+	data, err := readInput(listPath)
+	if err != nil {
+		return nil, err
+	}
+	l := &issuerAllowList{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := normalizeDN(line)
+		if _, mErr := path.Match(pattern, ""); mErr != nil {
+			return nil, fmt.Errorf("invalid issuer pattern '%s': %s", line, mErr)
+		}
+		l.patterns = append(l.patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.patterns) == 0 {
+		return nil, fmt.Errorf("%s lists no issuers", listPath)
+	}
+	return l, nil
+}
+
+// allows reports whether issuerDN is approved.
+func (l *issuerAllowList) allows(issuerDN string) bool {
+	dn := normalizeDN(issuerDN)
+	for _, p := range l.patterns {
+		if p == dn {
+			return true
+		}
+		if ok, _ := path.Match(p, dn); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerViolation is a certificate in a store issued by an unapproved CA.
+type issuerViolation struct {
+	Store StoreCSVEntry
+	Cert  api.InventoriedCertificate
+}
+
+// checkStoreIssuers returns the certificates of the store inventories issued by CAs that are not in allowed. The
+// certificates to add are approved, as are certificates that already have a remove action for the store.
+func checkStoreIssuers(stores map[string]StoreCSVEntry, storeCerts map[string][]api.InventoriedCertificate, allowed *issuerAllowList, addCerts map[string]string, actions map[string][]ROTAction) []issuerViolation {
+	removing := make(map[string]bool)
+	for thumbprint, certActions := range actions {
+		for _, a := range certActions {
+			if a.RemoveCert {
+				removing[strings.ToUpper(thumbprint)+a.StoreID] = true
+			}
+		}
+	}
+	approved := make(map[string]bool, len(addCerts))
+	for _, cert := range addCerts {
+		approved[strings.ToUpper(cert)] = true
+	}
+	var violations []issuerViolation
+	for storeID, certs := range storeCerts {
+		store, ok := stores[storeID]
+		if !ok {
+			continue
+		}
+		for _, cert := range certs {
+			thumbprint := strings.ToUpper(cert.Thumbprint)
+			if approved[thumbprint] || removing[thumbprint+storeID] || allowed.allows(cert.IssuerDN) {
+				continue
+			}
+			violations = append(violations, issuerViolation{Store: store, Cert: cert})
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Store.ID != violations[j].Store.ID {
+			return violations[i].Store.ID < violations[j].Store.ID
+		}
+		return violations[i].Cert.Thumbprint < violations[j].Cert.Thumbprint
+	})
+	return violations
+}
+
+// writeIssuerReport writes the issuer violations next to the audit report and, when removeUnapproved is set, appends
+// remove actions for them to the audit report so they are picked up by reconcile.
+func writeIssuerReport(violations []issuerViolation, auditPath string, removeUnapproved bool) error {
+	issuerPath := auditSideReportPath(auditPath, "issuers")
+	data := [][]string{IssuerHeader}
+	var actionRows [][]string
+	for _, v := range violations {
+		data = append(data, []string{v.Store.ID, v.Store.Type, v.Store.Machine, v.Store.Path,
+			v.Cert.Thumbprint, strconv.Itoa(v.Cert.Id), v.Cert.IssuedDN, v.Cert.IssuerDN, GetCurrentTime()})
+		actionRows = append(actionRows, []string{v.Cert.Thumbprint, strconv.Itoa(v.Cert.Id), v.Cert.IssuedDN, v.Cert.IssuerDN,
+			v.Store.ID, v.Store.Type, v.Store.Machine, v.Store.Path, "false", "true", "true", GetCurrentTime(), "false"})
+	}
+	if err := writeOutputFile(issuerPath, csvBytes(data), 0644); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		printWarning("%d certificate(s) from unapproved issuers, see %s\n", len(violations), issuerPath)
+	} else {
+		printInfo("All certificates in root stores are from approved issuers.\n")
+	}
+
+	if !removeUnapproved || len(actionRows) == 0 {
+		return nil
+	}
+	return appendAuditActions(auditPath, actionRows, "certificates of unapproved issuers")
+}
+
+// auditSideReportPath returns the path of a report written next to the audit report, <audit>_<name>.csv.
+func auditSideReportPath(auditPath string, name string) string {
+	base := auditPath
+	if auditPath == "" || auditPath == stdioPath {
+		base = reconcileDefaultFileName
+	}
+	return fmt.Sprintf("%s_%s.csv", strings.TrimSuffix(base, filepath.Ext(base)), name)
+}
+
+// appendAuditActions appends action rows to a local CSV audit report, so they are picked up by reconcile.
+func appendAuditActions(auditPath string, rows [][]string, what string) error {
+	if isXlsxPath(auditPath) || auditPath == stdioPath || isCloudURL(auditPath) {
+		printWarning("Adding remove actions for %s is only supported for local CSV audit report files, skipping.\n", what)
+		return nil
+	}
+	auditFile, err := os.OpenFile(auditPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer auditFile.Close()
+	if err := csv.NewWriter(auditFile).WriteAll(rows); err != nil {
+		return err
+	}
+	printRemoved("Added %d remove action(s) for %s to %s\n", len(rows), what, auditPath)
+	return nil
+}
+
+// csvBytes returns rows as CSV.
+func csvBytes(rows [][]string) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(rows)
+	return buf.Bytes()
+}
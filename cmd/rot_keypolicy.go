@@ -0,0 +1,274 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+var KeyPolicyHeader = []string{"StoreID", "StoreType", "Machine", "Path", "Thumbprint", "CertID", "SubjectName", "KeyAlgorithm",
+	"KeySize", "Curve", "SignatureAlgorithm", "ValidityYears", "Violations", "AuditDate"}
+
+// ecCurveAliases maps the OpenSSL and SSH names of the NIST curves to the names used by --allowed-ec-curves.
+var ecCurveAliases = map[string]string{
+	"secp256r1": "P-256", "prime256v1": "P-256", "nistp256": "P-256", "p256": "P-256",
+	"secp384r1": "P-384", "nistp384": "P-384", "p384": "P-384",
+	"secp521r1": "P-521", "nistp521": "P-521", "p521": "P-521",
+	"secp224r1": "P-224", "nistp224": "P-224", "p224": "P-224",
+}
+
+// ecCurveBySize is the NIST curve of an EC key size, for certificates whose content could not be parsed.
+var ecCurveBySize = map[int]string{224: "P-224", 256: "P-256", 384: "P-384", 521: "P-521"}
+
+// weakSignatureHashes are the hashes of signature algorithms that are always a violation of the key policy.
+var weakSignatureHashes = []string{"md2", "md5", "sha1"}
+
+// normalizeCurve returns the --allowed-ec-curves name of an EC curve name.
+func normalizeCurve(name string) string {
+	name = strings.TrimSpace(name)
+	if alias, ok := ecCurveAliases[strings.ToLower(strings.ReplaceAll(name, "-", ""))]; ok {
+		return alias
+	}
+	return strings.ToUpper(name)
+}
+
+// keyPolicy is the key algorithm, key strength and validity policy of --min-rsa-bits, --allowed-ec-curves and
+// --max-validity-years. Certificates signed with MD5 or SHA-1 violate any policy.
+type keyPolicy struct {
+	minRSABits       int
+	ecCurves         map[string]bool
+	maxValidityYears int
+}
+
+func addKeyPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("min-rsa-bits", 0, "Minimum RSA key size of certificates in root stores, e.g. 2048.")
+	cmd.Flags().StringSlice("allowed-ec-curves", []string{}, "EC curves allowed for certificates in root stores, e.g. P-256,P-384.")
+	cmd.Flags().Int("max-validity-years", 0, "Maximum validity period of certificates in root stores, in years.")
+	cmd.Flags().Bool("remove-weak", false,
+		"Used with the key policy flags. Add remove actions for certificates that violate the policy to the audit report.")
+}
+
+// newKeyPolicyFromFlags returns the key policy of cmd's flags, or nil if no policy flag is set.
+func newKeyPolicyFromFlags(cmd *cobra.Command) *keyPolicy {
+	minRSABits, _ := cmd.Flags().GetInt("min-rsa-bits")
+	curves, _ := cmd.Flags().GetStringSlice("allowed-ec-curves")
+	maxValidityYears, _ := cmd.Flags().GetInt("max-validity-years")
+	if minRSABits < 0 || maxValidityYears < 0 {
+		fmt.Println("[ERROR] --min-rsa-bits and --max-validity-years must not be negative")
+		log.Fatalf("[ERROR] negative key policy value")
+	}
+	if minRSABits == 0 && len(curves) == 0 && maxValidityYears == 0 {
+		return nil
+	}
+	p := &keyPolicy{minRSABits: minRSABits, maxValidityYears: maxValidityYears}
+	for _, curve := range curves {
+		if curve = normalizeCurve(curve); curve != "" {
+			if p.ecCurves == nil {
+				p.ecCurves = make(map[string]bool)
+			}
+			p.ecCurves[curve] = true
+		}
+	}
+	return p
+}
+
+// certKeyInfo is the key and signature of a certificate.
+type certKeyInfo struct {
+	Algorithm          string
+	Bits               int
+	Curve              string
+	SignatureAlgorithm string
+}
+
+// keyInfoFromCertificate returns the key of a parsed certificate.
+func keyInfoFromCertificate(cert *x509.Certificate) certKeyInfo {
+	info := certKeyInfo{SignatureAlgorithm: cert.SignatureAlgorithm.String()}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.Algorithm, info.Bits = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Algorithm, info.Bits, info.Curve = "ECC", key.Curve.Params().BitSize, key.Curve.Params().Name
+	case ed25519.PublicKey:
+		info.Algorithm, info.Bits, info.Curve = "Ed25519", 256, "Ed25519"
+	default:
+		info.Algorithm = cert.PublicKeyAlgorithm.String()
+	}
+	return info
+}
+
+// keyInfoFromLookup returns the key of a Keyfactor certificate, parsed from its content if Keyfactor returned it.
+func keyInfoFromLookup(certLookup *api.GetCertificateResponse) certKeyInfo {
+	if der, err := base64.StdEncoding.DecodeString(certLookup.ContentBytes); err == nil && len(der) > 0 {
+		if cert, pErr := x509.ParseCertificate(der); pErr == nil {
+			return keyInfoFromCertificate(cert)
+		}
+	}
+	info := certKeyInfo{
+		Algorithm:          strings.ToUpper(certLookup.KeyTypeString),
+		Bits:               certLookup.KeySizeInBits,
+		SignatureAlgorithm: certLookup.SigningAlgorithm,
+	}
+	if strings.HasPrefix(info.Algorithm, "EC") {
+		info.Algorithm, info.Curve = "ECC", ecCurveBySize[info.Bits]
+	}
+	return info
+}
+
+// validityYears returns the validity period of an inventoried certificate in years, or 0 if its dates are unknown.
+func validityYears(cert api.InventoriedCertificate) float64 {
+	notBefore, okBefore := parseInputDate(cert.NotBefore)
+	notAfter, okAfter := parseInputDate(cert.NotAfter)
+	if !okBefore || !okAfter {
+		return 0
+	}
+	return notAfter.Sub(notBefore).Hours() / 24 / 365.25
+}
+
+// violations returns the reasons a certificate violates the policy.
+func (p *keyPolicy) violations(info certKeyInfo, years float64) []string {
+	var reasons []string
+	sigAlg := strings.ToLower(info.SignatureAlgorithm)
+	for _, hash := range weakSignatureHashes {
+		if strings.Contains(sigAlg, hash) {
+			reasons = append(reasons, fmt.Sprintf("weak signature %s", info.SignatureAlgorithm))
+			break
+		}
+	}
+	switch info.Algorithm {
+	case "RSA":
+		if p.minRSABits > 0 && info.Bits > 0 && info.Bits < p.minRSABits {
+			reasons = append(reasons, fmt.Sprintf("RSA key %d < %d bits", info.Bits, p.minRSABits))
+		}
+	case "ECC":
+		if len(p.ecCurves) > 0 && !p.ecCurves[normalizeCurve(info.Curve)] {
+			curve := info.Curve
+			if curve == "" {
+				curve = fmt.Sprintf("unknown %d bit", info.Bits)
+			}
+			reasons = append(reasons, fmt.Sprintf("EC curve %s not allowed", curve))
+		}
+	}
+	if p.maxValidityYears > 0 && years > float64(p.maxValidityYears) {
+		reasons = append(reasons, fmt.Sprintf("validity %.1f > %d years", years, p.maxValidityYears))
+	}
+	return reasons
+}
+
+// keyPolicyViolation is a certificate in a store that violates the key policy.
+type keyPolicyViolation struct {
+	Store   StoreCSVEntry
+	Cert    api.InventoriedCertificate
+	Key     certKeyInfo
+	Years   float64
+	Reasons []string
+	// Removable is false for certificates that are to be added to or already removed from the store.
+	Removable bool
+}
+
+// checkStoreKeyPolicy returns the certificates of the store inventories that violate the policy. Keys are looked up
+// once per certificate in Keyfactor. Certificates that already have a remove action for the store are skipped.
+func checkStoreKeyPolicy(stores map[string]StoreCSVEntry, storeCerts map[string][]api.InventoriedCertificate, policy *keyPolicy, kfClient *api.Client, addCerts map[string]string, actions map[string][]ROTAction) []keyPolicyViolation {
+	removing := make(map[string]bool)
+	for thumbprint, certActions := range actions {
+		for _, a := range certActions {
+			if a.RemoveCert {
+				removing[strings.ToUpper(thumbprint)+a.StoreID] = true
+			}
+		}
+	}
+	adding := make(map[string]bool, len(addCerts))
+	for _, cert := range addCerts {
+		adding[strings.ToUpper(cert)] = true
+	}
+	keys := make(map[string]certKeyInfo)
+	var violations []keyPolicyViolation
+	for storeID, certs := range storeCerts {
+		store, ok := stores[storeID]
+		if !ok {
+			continue
+		}
+		for _, cert := range certs {
+			thumbprint := strings.ToUpper(cert.Thumbprint)
+			if removing[thumbprint+storeID] {
+				continue
+			}
+			info, cached := keys[thumbprint]
+			if !cached {
+				info = certKeyInfo{SignatureAlgorithm: cert.SigningAlgorithm}
+				if certLookup, found := lookupCertByThumbprint(kfClient, thumbprint); found {
+					info = keyInfoFromLookup(certLookup)
+				} else {
+					log.Printf("[WARN] certificate %s not found, only its signature and validity are checked", thumbprint)
+				}
+				if info.SignatureAlgorithm == "" {
+					info.SignatureAlgorithm = cert.SigningAlgorithm
+				}
+				keys[thumbprint] = info
+			}
+			years := validityYears(cert)
+			if reasons := policy.violations(info, years); len(reasons) > 0 {
+				violations = append(violations, keyPolicyViolation{Store: store, Cert: cert, Key: info, Years: years,
+					Reasons: reasons, Removable: !adding[thumbprint]})
+			}
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Store.ID != violations[j].Store.ID {
+			return violations[i].Store.ID < violations[j].Store.ID
+		}
+		return violations[i].Cert.Thumbprint < violations[j].Cert.Thumbprint
+	})
+	return violations
+}
+
+// writeKeyPolicyReport writes the key policy violations next to the audit report and, when removeWeak is set,
+// appends remove actions for them to the audit report so they are picked up by reconcile.
+func writeKeyPolicyReport(violations []keyPolicyViolation, auditPath string, removeWeak bool) error {
+	policyPath := auditSideReportPath(auditPath, "keypolicy")
+	data := [][]string{KeyPolicyHeader}
+	var actionRows [][]string
+	for _, v := range violations {
+		keySize, years := "", ""
+		if v.Key.Bits > 0 {
+			keySize = strconv.Itoa(v.Key.Bits)
+		}
+		if v.Years > 0 {
+			years = strconv.FormatFloat(v.Years, 'f', 1, 64)
+		}
+		data = append(data, []string{v.Store.ID, v.Store.Type, v.Store.Machine, v.Store.Path, v.Cert.Thumbprint,
+			strconv.Itoa(v.Cert.Id), v.Cert.IssuedDN, v.Key.Algorithm, keySize, v.Key.Curve, v.Key.SignatureAlgorithm,
+			years, strings.Join(v.Reasons, "; "), GetCurrentTime()})
+		if v.Removable {
+			actionRows = append(actionRows, []string{v.Cert.Thumbprint, strconv.Itoa(v.Cert.Id), v.Cert.IssuedDN, v.Cert.IssuerDN,
+				v.Store.ID, v.Store.Type, v.Store.Machine, v.Store.Path, "false", "true", "true", GetCurrentTime(), "false"})
+		}
+	}
+	if err := writeOutputFile(policyPath, csvBytes(data), 0644); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		printWarning("%d certificate(s) violate the key policy, see %s\n", len(violations), policyPath)
+	} else {
+		printInfo("All certificates in root stores meet the key policy.\n")
+	}
+	if !removeWeak || len(actionRows) == 0 {
+		return nil
+	}
+	return appendAuditActions(auditPath, actionRows, "certificates that violate the key policy")
+}
@@ -0,0 +1,76 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// exitCodeLookupFailures is the exit code of an audit run with --fail-on-lookup-errors when stores could not be
+// looked up. The audit report is still written for the stores that were found.
+const exitCodeLookupFailures = 3
+
+// LookupFailureHeader is the header of the lookup failures report written next to the audit report.
+var LookupFailureHeader = []string{"StoreID", "StoreType", "ClientMachine", "StorePath", "Error", "Timestamp"}
+
+// storeLookupFailure is a row of the stores file that could not be looked up in Keyfactor.
+type storeLookupFailure struct {
+	Entry []string
+	Err   error
+}
+
+type storeLookupFailures []storeLookupFailure
+
+func addLookupFailureFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("fail-on-lookup-errors", false,
+		fmt.Sprintf("Exit with code %d after writing the audit report if any stores could not be looked up.", exitCodeLookupFailures))
+}
+
+// storeIDs returns the IDs of the stores that could not be looked up.
+func (f storeLookupFailures) storeIDs() []string {
+	var ids []string
+	for _, failure := range f {
+		ids = append(ids, failure.Entry[0])
+	}
+	return ids
+}
+
+// report prints the Lookup Failures section of the audit and writes the failures next to the audit report.
+func (f storeLookupFailures) report(auditPath string) error {
+	if len(f) == 0 {
+		return nil
+	}
+	failuresPath := auditSideReportPath(auditPath, "lookup_failures")
+	data := [][]string{LookupFailureHeader}
+	printWarning("\nLookup Failures:\n")
+	for _, failure := range f {
+		entry := failure.Entry
+		data = append(data, []string{entry[0], entry[1], entry[2], entry[3], failure.Err.Error(), GetCurrentTime()})
+		printWarning("  %s (%s on %s): %s\n", entry[0], entry[3], entry[2], failure.Err)
+	}
+	if err := writeOutputFile(failuresPath, csvBytes(data), 0644); err != nil {
+		return err
+	}
+	printWarning("%d store(s) could not be looked up and were not audited, see %s\n", len(f), failuresPath)
+	return nil
+}
+
+// exitOnLookupFailures exits with exitCodeLookupFailures if stores could not be looked up and --fail-on-lookup-errors
+// is set.
+func exitOnLookupFailures(cmd *cobra.Command, failures storeLookupFailures) {
+	if failOnErrors, _ := cmd.Flags().GetBool("fail-on-lookup-errors"); !failOnErrors || len(failures) == 0 {
+		return
+	}
+	fmt.Printf("[ERROR] %d store(s) could not be looked up\n", len(failures))
+	log.Printf("[ERROR] %d store(s) could not be looked up, exiting with code %d", len(failures), exitCodeLookupFailures)
+	finishResult(exitCodeLookupFailures)
+	os.Exit(exitCodeLookupFailures)
+}
@@ -0,0 +1,316 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// rotCertSources are the certs files and collections of a policy. In YAML it is a single source or a list.
+type rotCertSources []string
+
+func (c *rotCertSources) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = rotCertSources{value.Value}
+		return nil
+	}
+	var sources []string
+	if err := value.Decode(&sources); err != nil {
+		return err
+	}
+	*c = sources
+	return nil
+}
+
+func (c rotCertSources) MarshalYAML() (interface{}, error) {
+	if len(c) == 1 {
+		return c[0], nil
+	}
+	return []string(c), nil
+}
+
+// rotManifestPolicy is the root set of a group of stores.
+type rotManifestPolicy struct {
+	Name string `yaml:"name,omitempty"`
+	// Stores is a stores file or tag:<tag>[,<tag>...].
+	Stores      string         `yaml:"stores"`
+	AddCerts    rotCertSources `yaml:"add-certs,omitempty"`
+	RemoveCerts rotCertSources `yaml:"remove-certs,omitempty"`
+	storeIDs    map[string]bool
+}
+
+// rotManifest assigns different root sets to different stores in one audit or reconcile run, e.g.
+//
+//	policies:
+//	  - name: web
+//	    stores: tag:web-tier
+//	    add-certs: web_roots.csv
+//	  - name: db
+//	    stores: db_stores.csv
+//	    add-certs: [collection:DBRoots, extra_roots.csv]
+//	    remove-certs: retired_roots.csv
+//
+// An environment overlay, e.g. prod.yaml next to the manifest for --env prod, has the same layout. Its policies are
+// merged into the policies of the manifest with the same name: stores replaces the store selector and add-certs and
+// remove-certs add to the roots to add and remove. Policies with new names are added.
+type rotManifest struct {
+	Policies []*rotManifestPolicy `yaml:"policies"`
+}
+
+func addROTManifestFlag(cmd *cobra.Command) {
+	cmd.Flags().String("manifest", "",
+		"YAML manifest of policies, each with stores (a stores file or tag:<tag>) and the add-certs and remove-certs to audit them "+
+			"against. Replaces --stores, --add-certs and --remove-certs.")
+	cmd.Flags().String("env", "", "Used with --manifest. Environment overlay to merge into the manifest, read from <env>.yaml next to the manifest.")
+}
+
+// manifestRelativePath resolves a file named in the manifest at manifestPath relative to the manifest.
+func manifestRelativePath(manifestPath string, source string) string {
+	if source == "" || source == stdioPath || filepath.IsAbs(source) || isCertsCollection(source) || isStoreTagSource(source) || isCloudURL(source) {
+		return source
+	}
+	return filepath.Join(filepath.Dir(manifestPath), source)
+}
+
+// manifestOverlayPath returns the path of the overlay of env for the manifest at manifestPath.
+func manifestOverlayPath(manifestPath string, env string) string {
+	ext := filepath.Ext(manifestPath)
+	if ext == "" {
+		ext = ".yaml"
+	}
+	return filepath.Join(filepath.Dir(manifestPath), env+ext)
+}
+
+// parseROTManifest reads a manifest or overlay and resolves the files it names relative to it.
+func parseROTManifest(path string) (*rotManifest, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	var m rotManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %s", path, err)
+	}
+	for _, p := range m.Policies {
+		p.Stores = manifestRelativePath(path, p.Stores)
+		for i := range p.AddCerts {
+			p.AddCerts[i] = manifestRelativePath(path, p.AddCerts[i])
+		}
+		for i := range p.RemoveCerts {
+			p.RemoveCerts[i] = manifestRelativePath(path, p.RemoveCerts[i])
+		}
+	}
+	return &m, nil
+}
+
+// merge merges the policies of an environment overlay into m.
+func (m *rotManifest) merge(overlay *rotManifest, overlayPath string) error {
+	byName := make(map[string]*rotManifestPolicy)
+	for _, p := range m.Policies {
+		if p.Name != "" {
+			byName[p.Name] = p
+		}
+	}
+	for _, o := range overlay.Policies {
+		if o.Name == "" {
+			return fmt.Errorf("policies of overlay %s must have a name", overlayPath)
+		}
+		p, ok := byName[o.Name]
+		if !ok {
+			m.Policies = append(m.Policies, o)
+			byName[o.Name] = o
+			continue
+		}
+		if o.Stores != "" {
+			p.Stores = o.Stores
+		}
+		p.AddCerts = append(p.AddCerts, o.AddCerts...)
+		p.RemoveCerts = append(p.RemoveCerts, o.RemoveCerts...)
+	}
+	return nil
+}
+
+// readROTManifest reads the manifest at path and merges the overlay of env into it if env is given.
+func readROTManifest(path string, env string) (*rotManifest, error) {
+	m, err := parseROTManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	if env != "" {
+		overlayPath := manifestOverlayPath(path, env)
+		overlay, oErr := parseROTManifest(overlayPath)
+		if oErr != nil {
+			return nil, fmt.Errorf("reading overlay of environment %s: %s", env, oErr)
+		}
+		if mErr := m.merge(overlay, overlayPath); mErr != nil {
+			return nil, mErr
+		}
+	}
+	if len(m.Policies) == 0 {
+		return nil, fmt.Errorf("manifest %s has no policies", path)
+	}
+	for i, p := range m.Policies {
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("policy %d", i+1)
+		}
+		if p.Stores == "" {
+			return nil, fmt.Errorf("%s of manifest %s has no stores", p.Name, path)
+		}
+		if len(p.AddCerts) == 0 && len(p.RemoveCerts) == 0 {
+			return nil, fmt.Errorf("%s of manifest %s has neither add-certs nor remove-certs", p.Name, path)
+		}
+	}
+	return m, nil
+}
+
+// resolveROTManifest reads the --manifest of cmd, if given, and points --stores at the union of the stores of its
+// policies. It must be called before the --stores flag is read.
+func resolveROTManifest(cmd *cobra.Command, kfClient *api.Client) *rotManifest {
+	path, _ := cmd.Flags().GetString("manifest")
+	if path == "" {
+		return nil
+	}
+	for _, flag := range []string{"stores", "add-certs", "remove-certs"} {
+		if cmd.Flags().Changed(flag) {
+			fmt.Printf("[ERROR] --%s can't be used with --manifest\n", flag)
+			log.Fatalf("[ERROR] --%s used with --manifest", flag)
+		}
+	}
+	env, _ := cmd.Flags().GetString("env")
+	m, err := readROTManifest(path, env)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	seen := make(map[string]bool)
+	var rows [][]string
+	for _, p := range m.Policies {
+		var policyRows [][]string
+		if isStoreTagSource(p.Stores) {
+			tags, tErr := parseStoreTagSource(p.Stores)
+			if tErr == nil {
+				policyRows, tErr = storeTagRows(kfClient, tags)
+			}
+			if tErr != nil {
+				fmt.Printf("[ERROR] stores of %s: %s\n", p.Name, tErr)
+				log.Fatalf("[ERROR] stores of %s: %s", p.Name, tErr)
+			}
+		} else {
+			table, sErr := readTabularFile(p.Stores, StoreHeader, []string{"StoreID"})
+			if sErr != nil {
+				fmt.Printf("[ERROR] reading stores file %s of %s: %s\n", p.Stores, p.Name, sErr)
+				log.Fatalf("[ERROR] reading stores file: %s", sErr)
+			}
+			table.reportErrors()
+			for _, row := range table.Rows {
+				policyRows = append(policyRows, row.Values(StoreHeader))
+			}
+		}
+		p.storeIDs = make(map[string]bool, len(policyRows))
+		for _, row := range policyRows {
+			p.storeIDs[row[0]] = true
+			if !seen[row[0]] {
+				seen[row[0]] = true
+				rows = append(rows, row)
+			}
+		}
+		log.Printf("[INFO] %s of manifest %s selects %d store(s)", p.Name, path, len(p.storeIDs))
+	}
+	name := "manifest:" + path
+	memoryInputs[name] = storesTableData(rows)
+	cmd.Flags().Set("stores", name)
+	return m
+}
+
+// auditGroups returns the stores of each policy with the certificates the policy audits them against, and the union
+// of the certificates to add. Stores that are in several policies are audited against each of them.
+func (m *rotManifest) auditGroups(stores map[string]StoreCSVEntry, kfClient *api.Client, agePolicy *inputAgePolicy) ([]rotAuditGroup, map[string]string) {
+	var groups []rotAuditGroup
+	allAdds := make(map[string]string)
+	for _, p := range m.Policies {
+		group := rotAuditGroup{AddCerts: map[string]string{}, RemoveCerts: map[string]string{}, Stores: make(map[string]StoreCSVEntry)}
+		for id, store := range stores {
+			if p.storeIDs[id] {
+				group.Stores[id] = store
+			}
+		}
+		group.AddCerts = readManifestCerts(p.Name, "add-certs", p.AddCerts, kfClient, agePolicy)
+		group.RemoveCerts = readManifestCerts(p.Name, "remove-certs", p.RemoveCerts, kfClient, agePolicy)
+		for cert := range group.RemoveCerts {
+			// an overlay removing a root of the base manifest wins
+			delete(group.AddCerts, cert)
+		}
+		for k, v := range group.AddCerts {
+			allAdds[k] = v
+		}
+		printInfo("Policy %s: %d root store(s), %d cert(s) to add, %d cert(s) to remove\n",
+			p.Name, len(group.Stores), len(group.AddCerts), len(group.RemoveCerts))
+		groups = append(groups, group)
+	}
+	return groups, allAdds
+}
+
+// readManifestCerts returns the union of the certificates of the sources of a policy.
+func readManifestCerts(policy string, kind string, sources rotCertSources, kfClient *api.Client, agePolicy *inputAgePolicy) map[string]string {
+	certs := make(map[string]string)
+	for _, source := range sources {
+		sourceCerts, err := readCertsFileWithAge(source, kfClient, agePolicy)
+		if err != nil {
+			fmt.Printf("[ERROR] reading %s %s of %s: %s\n", kind, source, policy, err)
+			log.Fatalf("[ERROR] reading %s of %s: %s", kind, policy, err)
+		}
+		for k, v := range sourceCerts {
+			certs[k] = v
+		}
+	}
+	return certs
+}
+
+var rotManifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Root of trust manifest utilities.",
+	Long:  `Utilities for the --manifest policies of 'stores rot audit' and 'stores rot reconcile'.`,
+}
+
+var rotManifestRenderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Print the effective policies of a manifest and environment overlay.",
+	Long: `Merges the overlay of --env into --manifest the way 'stores rot audit --manifest --env' does and prints the
+effective policies as YAML, with the files they name resolved relative to the manifest. No API calls are made.`,
+	Example: `kfutil stores rot manifest render --manifest base.yaml --env prod`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		path, _ := cmd.Flags().GetString("manifest")
+		env, _ := cmd.Flags().GetString("env")
+		m, err := readROTManifest(path, env)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err)
+			log.Fatalf("[ERROR] %s", err)
+		}
+		enc := yaml.NewEncoder(dataStdout)
+		enc.SetIndent(2)
+		if yErr := enc.Encode(m); yErr != nil {
+			fmt.Printf("[ERROR] %s\n", yErr)
+			log.Fatalf("[ERROR] %s", yErr)
+		}
+		enc.Close()
+	},
+}
+
+func init() {
+	rotCmd.AddCommand(rotManifestCmd)
+	rotManifestCmd.AddCommand(rotManifestRenderCmd)
+	addROTManifestFlag(rotManifestRenderCmd)
+	rotManifestRenderCmd.MarkFlagRequired("manifest")
+}
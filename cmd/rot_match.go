@@ -0,0 +1,69 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+	"kfutil/pkg/rot"
+)
+
+// certInputColumns are the columns read from certs files. Rows are identified by Thumbprint, CertID or SerialNumber.
+var certInputColumns = append(append([]string{}, CertHeader...), "SerialNumber")
+
+// rotMatchOn is the --match-on flag of the rot audit and reconcile commands.
+var rotMatchOn string
+
+func addMatchOnFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&rotMatchOn, "match-on", string(rot.MatchThumbprint),
+		"How certificates are found in store inventories: thumbprint, serial, id or any. Use serial or id for inputs exported by tools that don't record thumbprints.")
+}
+
+// rotMatchMode returns the parsed --match-on flag.
+func rotMatchMode() rot.MatchOn {
+	matchOn, err := rot.ParseMatchOn(rotMatchOn)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	return matchOn
+}
+
+// serialResolver looks up certificates by serial number, for certs file rows without a thumbprint or certificate ID.
+type serialResolver struct {
+	sdkClient *keyfactor.APIClient
+}
+
+// thumbprint returns the thumbprint of the certificate with serial, which must be unique in Keyfactor.
+func (r *serialResolver) thumbprint(serial string) (string, error) {
+	if r.sdkClient == nil {
+		r.sdkClient = initGenClient()
+	}
+	req := r.sdkClient.CertificateApi.CertificateQueryCertificates(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		PqQueryString(fmt.Sprintf(`SerialNumber -eq "%s"`, rot.NormalizeSerial(serial)))
+	if collectionID := rotCollectionArg(); collectionID != nil {
+		req = req.CollectionId(int32(*collectionID))
+	}
+	certs, _, err := req.Execute()
+	if err != nil {
+		return "", err
+	}
+	switch len(certs) {
+	case 0:
+		return "", fmt.Errorf("no certificate found with serial number %s", serial)
+	case 1:
+		return strings.ToUpper(certs[0].GetThumbprint()), nil
+	default:
+		return "", fmt.Errorf("%d certificates have serial number %s, add the Thumbprint or CertID column", len(certs), serial)
+	}
+}
@@ -0,0 +1,363 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kfutil/pkg/rot"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	rotPlanVersion         = 1
+	rotPlanDefaultFileName = "rot_plan.json"
+)
+
+// rotPlanStore is the inventory of a store observed when a plan was made.
+type rotPlanStore struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Machine     string   `json:"machine"`
+	Path        string   `json:"path"`
+	Thumbprints []string `json:"thumbprints"`
+}
+
+// rotPlan is a set of reconcile actions bound to the store inventories they were planned against. SHA256 covers the
+// rest of the plan so that apply can detect edits.
+type rotPlan struct {
+	PlanVersion int            `json:"plan_version"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CreatedBy   string         `json:"created_by,omitempty"`
+	Hostname    string         `json:"hostname"`
+	Stores      []rotPlanStore `json:"stores"`
+	Actions     []ROTAction    `json:"actions"`
+	SHA256      string         `json:"sha256"`
+}
+
+// digest returns the SHA-256 of the plan without its SHA256 field.
+func (p rotPlan) digest() string {
+	p.SHA256 = ""
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// inventoryThumbprints returns the sorted, upper case thumbprints of the certificates in an inventory.
+func inventoryThumbprints(inventory []api.CertStoreInventory) []string {
+	seen := make(map[string]bool)
+	var thumbprints []string
+	for _, inv := range inventory {
+		for _, c := range inv.Certificates {
+			tp := strings.ToUpper(c.Thumbprint)
+			if tp != "" && !seen[tp] {
+				seen[tp] = true
+				thumbprints = append(thumbprints, tp)
+			}
+		}
+	}
+	sort.Strings(thumbprints)
+	return thumbprints
+}
+
+// thumbprintDrift returns the number of thumbprints in only one of a and b.
+func thumbprintDrift(a []string, b []string) int {
+	in := make(map[string]int)
+	for _, tp := range a {
+		in[tp]++
+	}
+	for _, tp := range b {
+		in[tp]--
+	}
+	drift := 0
+	for _, n := range in {
+		if n != 0 {
+			drift++
+		}
+	}
+	return drift
+}
+
+func readROTPlan(path string) (*rotPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan rotPlan
+	if jErr := json.Unmarshal(data, &plan); jErr != nil {
+		return nil, fmt.Errorf("parsing plan %s: %s", path, jErr)
+	}
+	if plan.PlanVersion != rotPlanVersion {
+		return nil, fmt.Errorf("unsupported plan version %d", plan.PlanVersion)
+	}
+	if plan.SHA256 == "" || plan.digest() != plan.SHA256 {
+		return nil, fmt.Errorf("plan %s was modified after it was created", path)
+	}
+	return &plan, nil
+}
+
+var rotPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Plan a reconcile and save it for 'stores rot apply'.",
+	Long: `Audits the stores like 'stores rot reconcile' and writes the actions to a plan file together with the inventory
+of every store at plan time. The plan is protected by a SHA-256 checksum. 'stores rot apply' executes it and refuses
+to run if it was edited or the stores changed since.`,
+	Example: `kfutil stores rot plan --stores stores.csv --add-certs roots.csv --out plan.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		resolveDBInputs(cmd)
+		kfClient, _ := initClient()
+		resolveStoreIDsInput(cmd, kfClient)
+		storesFile, _ := cmd.Flags().GetString("stores")
+		addRootsFile, _ := cmd.Flags().GetString("add-certs")
+		removeRootsFile, _ := cmd.Flags().GetString("remove-certs")
+		minCerts, _ := cmd.Flags().GetInt("min-certs")
+		maxLeaves, _ := cmd.Flags().GetInt("max-leaf-certs")
+		maxKeys, _ := cmd.Flags().GetInt("max-keys")
+		outpath, _ := cmd.Flags().GetString("out")
+		ctx := commandContext(cmd)
+
+		if storesFile == "" {
+			fmt.Println("[ERROR] one of --stores, --store-ids or --stores-query is required")
+			log.Fatalf("[ERROR] no stores input")
+		}
+		if addRootsFile == "" && removeRootsFile == "" {
+			fmt.Println("[ERROR] one of --add-certs or --remove-certs is required")
+			log.Fatalf("[ERROR] no certs files given")
+		}
+		storeFilter, sfErr := newROTStoreFilterFromFlags(cmd)
+		if sfErr != nil {
+			fmt.Printf("[ERROR] %s\n", sfErr)
+			log.Fatalf("[ERROR] %s", sfErr)
+		}
+		exclusions, eErr := newStoreExclusionsFromFlags(cmd, kfClient)
+		if eErr != nil {
+			fmt.Printf("[ERROR] %s\n", eErr)
+			log.Fatalf("[ERROR] %s", eErr)
+		}
+		storesTable, tErr := readTabularFile(storesFile, StoreHeader, []string{"StoreID"})
+		if tErr != nil {
+			fmt.Printf("[ERROR] reading stores file %s: %s\n", storesFile, tErr)
+			log.Fatalf("[ERROR] reading stores file: %s", tErr)
+		}
+		storesTable.reportErrors()
+
+		plan := rotPlan{
+			PlanVersion: rotPlanVersion,
+			CreatedAt:   time.Now().UTC(),
+			CreatedBy:   defaultApprover(),
+			Hostname:    os.Getenv("KEYFACTOR_HOSTNAME"),
+		}
+		stores := make(map[string]StoreCSVEntry)
+		for _, row := range storesTable.Rows {
+			entry := row.Values(StoreHeader)
+			if !storeFilter.allows(entry[0], entry[2]) {
+				continue
+			}
+			if reason, xErr := exclusions.excludesID(entry[0]); xErr != nil {
+				exitIfInterrupted(ctx, "no plan was written")
+				fmt.Printf("[ERROR] %s\n", xErr)
+				log.Fatalf("[ERROR] %s", xErr)
+			} else if reason != "" {
+				log.Printf("[DEBUG] skipping store %s, %s", entry[0], reason)
+				continue
+			}
+			store, inventory, err := rot.LoadStore(ctx, kfClient, rot.Store{ID: entry[0], Type: entry[1], Machine: entry[2], Path: entry[3]})
+			if err != nil {
+				exitIfInterrupted(ctx, "no plan was written")
+				fmt.Printf("[ERROR] %s\n", err)
+				log.Fatalf("[ERROR] %s", err)
+			}
+			if !rot.IsRootStore(inventory, rootStoreCriteria(minCerts, maxKeys, maxLeaves)) {
+				printWarning("Store %s is not a root store, skipping.\n", entry[0])
+				continue
+			}
+			stores[store.ID] = *store
+			plan.Stores = append(plan.Stores, rotPlanStore{
+				ID:          store.ID,
+				Type:        store.Type,
+				Machine:     store.Machine,
+				Path:        store.Path,
+				Thumbprints: inventoryThumbprints(inventory),
+			})
+		}
+		if len(stores) == 0 {
+			fmt.Println("[ERROR] no root stores found")
+			log.Fatalf("[ERROR] no root stores found")
+		}
+
+		req := rot.AuditRequest{Stores: stores}
+		for _, f := range []string{addRootsFile, removeRootsFile} {
+			if f == "" {
+				continue
+			}
+			certs, err := readCertsFile(f, kfClient)
+			if err != nil {
+				fmt.Printf("[ERROR] reading certs file %s: %s\n", f, err)
+				log.Fatalf("[ERROR] reading certs file: %s", err)
+			}
+			for _, tp := range certs {
+				if f == addRootsFile {
+					req.AddCerts = append(req.AddCerts, tp)
+				} else {
+					req.RemoveCerts = append(req.RemoveCerts, tp)
+				}
+			}
+		}
+		sort.Strings(req.AddCerts)
+		sort.Strings(req.RemoveCerts)
+		result, aErr := rot.Audit(ctx, kfClient, req)
+		exitIfInterrupted(ctx, "no plan was written")
+		if aErr != nil {
+			fmt.Printf("[ERROR] auditing stores: %s\n", aErr)
+			log.Fatalf("[ERROR] auditing stores: %s", aErr)
+		}
+		for tp, lErr := range result.LookupErrors {
+			fmt.Printf("[ERROR] looking up certificate %s: %s\n", tp, lErr)
+		}
+		if len(result.LookupErrors) > 0 {
+			log.Fatalf("[ERROR] %d certificate(s) could not be looked up", len(result.LookupErrors))
+		}
+		plan.Actions = result.ActionList()
+		plan.SHA256 = plan.digest()
+
+		data, _ := json.MarshalIndent(plan, "", "  ")
+		if wErr := writeOutputFile(outpath, append(data, '\n'), 0644); wErr != nil {
+			fmt.Printf("[ERROR] writing plan %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing plan: %s", wErr)
+		}
+		adds, removes := 0, 0
+		for _, a := range plan.Actions {
+			if a.AddCert {
+				adds++
+			} else if a.RemoveCert {
+				removes++
+			}
+		}
+		printInfo("Plan: %d to add, %d to remove across %d store(s).\n", adds, removes, len(plan.Stores))
+		printInfo("Plan written to %s. Run 'kfutil stores rot apply %s' to execute it.\n", outpath, outpath)
+	},
+}
+
+var rotApplyCmd = &cobra.Command{
+	Use:   "apply <plan-file>",
+	Short: "Execute a plan made with 'stores rot plan'.",
+	Long: `Executes the actions of a plan file. The plan is refused if it was edited, was made against a different
+Keyfactor instance, or if more than --max-drift certificates were added to or removed from any of its stores since it
+was made. Actions that are already done, e.g. by a previous apply, are skipped.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		planPath := args[0]
+		maxDrift, _ := cmd.Flags().GetInt("max-drift")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		entryParamFlags, _ := cmd.Flags().GetStringArray("entry-param")
+		ctx := commandContext(cmd)
+
+		plan, pErr := readROTPlan(planPath)
+		if pErr != nil {
+			fmt.Printf("[ERROR] %s\n", pErr)
+			log.Fatalf("[ERROR] %s", pErr)
+		}
+		entryParams, epErr := parseEntryParamFlags(entryParamFlags)
+		if epErr != nil {
+			fmt.Printf("[ERROR] %s\n", epErr)
+			log.Fatalf("[ERROR] %s", epErr)
+		}
+		if host := os.Getenv("KEYFACTOR_HOSTNAME"); plan.Hostname != "" && host != "" && !strings.EqualFold(host, plan.Hostname) {
+			fmt.Printf("[ERROR] plan was made against %s, not %s\n", plan.Hostname, host)
+			log.Fatalf("[ERROR] plan hostname mismatch")
+		}
+		printInfo("Plan made by %s at %s with %d action(s).\n", plan.CreatedBy, plan.CreatedAt.Format(time.RFC3339), len(plan.Actions))
+
+		kfClient, _ := initClient()
+		current := make(map[string]map[string]bool)
+		diverged := 0
+		for _, ps := range plan.Stores {
+			_, inventory, err := rot.LoadStore(ctx, kfClient, rot.Store{ID: ps.ID, Type: ps.Type, Machine: ps.Machine, Path: ps.Path})
+			if err != nil {
+				exitIfInterrupted(ctx, "no changes were made")
+				fmt.Printf("[ERROR] %s\n", err)
+				log.Fatalf("[ERROR] %s", err)
+			}
+			thumbprints := inventoryThumbprints(inventory)
+			current[ps.ID] = make(map[string]bool)
+			for _, tp := range thumbprints {
+				current[ps.ID][tp] = true
+			}
+			if drift := thumbprintDrift(ps.Thumbprints, thumbprints); drift > maxDrift {
+				printWarning("Store %s (%s %s) changed by %d certificate(s) since the plan was made.\n", ps.ID, ps.Machine, ps.Path, drift)
+				diverged++
+			}
+		}
+		if diverged > 0 {
+			fmt.Printf("[ERROR] %d store(s) changed by more than %d certificate(s) since the plan was made. Make a new plan.\n", diverged, maxDrift)
+			log.Fatalf("[ERROR] stale plan")
+		}
+
+		actions := make(map[string][]ROTAction)
+		skipped := 0
+		for _, a := range plan.Actions {
+			present := current[a.StoreID][strings.ToUpper(a.Thumbprint)]
+			if (a.AddCert && present) || (a.RemoveCert && !present) {
+				log.Printf("[INFO] skipping action on %s for %s, already done", a.StoreID, a.Thumbprint)
+				skipped++
+				continue
+			}
+			actions[a.Thumbprint] = append(actions[a.Thumbprint], a)
+		}
+		if skipped > 0 {
+			printInfo("Skipping %d action(s) that are already done.\n", skipped)
+		}
+		if len(actions) == 0 {
+			printInfo("Nothing to do, the stores are in the planned state.\n")
+			return
+		}
+		runner := newBatchRunnerFromFlags(cmd)
+		if _, rErr := reconcileRoots(actions, kfClient, planPath, dryRun, runner, entryParams); rErr != nil {
+			fmt.Printf("[ERROR] applying plan: %s\n", rErr)
+			log.Fatalf("[ERROR] applying plan: %s", rErr)
+		}
+		printInfo("Plan applied. Check orchestrator jobs for details.\n")
+	},
+}
+
+func init() {
+	rotCmd.AddCommand(rotPlanCmd)
+	rotPlanCmd.Flags().StringP("stores", "s", "", "CSV file containing cert stores to enroll into")
+	rotPlanCmd.Flags().StringP("add-certs", "a", "", "CSV file containing cert(s) to enroll into the defined cert stores, or collection:<name|id> to use a Keyfactor collection")
+	rotPlanCmd.Flags().StringP("remove-certs", "r", "", "CSV file containing cert(s) to remove from the defined cert stores, or collection:<name|id> to use a Keyfactor collection")
+	rotPlanCmd.Flags().IntP("min-certs", "m", -1,
+		"The minimum number of certs that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
+	rotPlanCmd.Flags().IntP("max-keys", "k", -1,
+		"The max number of private keys that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
+	rotPlanCmd.Flags().IntP("max-leaf-certs", "l", -1,
+		"The max number of non-root-certs that should be in a store to be considered a 'root' store. If set to `-1` then all stores will be considered.")
+	rotPlanCmd.Flags().String("out", rotPlanDefaultFileName, "Path to write the plan to. Also accepts s3://, az:// and gs:// URLs to upload to.")
+	addStoreFilterFlags(rotPlanCmd)
+	addStoreExclusionFlags(rotPlanCmd)
+	addDBInputFlags(rotPlanCmd)
+	addStoreIDsFlag(rotPlanCmd)
+
+	rotCmd.AddCommand(rotApplyCmd)
+	rotApplyCmd.Flags().Int("max-drift", 0, "Maximum number of certificates added to or removed from a store since the plan was made before the plan is refused.")
+	rotApplyCmd.Flags().BoolP("dry-run", "d", false, "Dry run mode")
+	rotApplyCmd.Flags().StringArray("entry-param", []string{},
+		"Entry parameter to pass when adding certificates, in the form [<store-type>:]<name>=<value>. May be repeated.")
+	addBatchFlags(rotApplyCmd)
+	addStoresPerRequestFlag(rotApplyCmd)
+}
@@ -0,0 +1,184 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// managementCapability is the job capability an orchestrator needs to add certificates to and remove them from a
+// store.
+const managementCapability = "Management"
+
+func addPreflightFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("skip-preflight", false,
+		"Submit actions without checking that the orchestrator of each store is approved, online and able to manage its store type.")
+	cmd.Flags().Duration("agent-offline-after", time.Hour,
+		"Consider an orchestrator offline if it has not been seen for this long. 0 disables the check.")
+}
+
+// agentCanManage reports whether an orchestrator can run management jobs for a store type capability. Orchestrators
+// report capabilities such as `CertStores.RFPEM.Inventory` and `CertStores.RFPEM.Management`, a capability without a
+// job type is taken to support all of them.
+func agentCanManage(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		segments := strings.Split(c, ".")
+		for i, segment := range segments {
+			if !strings.EqualFold(segment, capability) {
+				continue
+			}
+			if i == len(segments)-1 || strings.EqualFold(segments[i+1], managementCapability) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// storePreflight checks that the orchestrators of stores can run the jobs of reconcile actions.
+type storePreflight struct {
+	kfClient     *api.Client
+	sdkClient    *keyfactor.APIClient
+	offlineAfter time.Duration
+	now          time.Time
+	agents       map[string]*keyfactor.KeyfactorApiModelsOrchestratorsAgentResponse
+	storeTypes   map[int]*api.CertificateStoreType
+}
+
+// agent returns the orchestrator with id, looked up once.
+func (p *storePreflight) agent(id string) (*keyfactor.KeyfactorApiModelsOrchestratorsAgentResponse, error) {
+	key := strings.ToLower(id)
+	if agent, ok := p.agents[key]; ok {
+		return agent, nil
+	}
+	agent, _, err := p.sdkClient.AgentApi.AgentGetAgentDetail(context.Background(), id).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	p.agents[key] = agent
+	return agent, nil
+}
+
+// storeType returns the store type with id, looked up once.
+func (p *storePreflight) storeType(id int) (*api.CertificateStoreType, error) {
+	if st, ok := p.storeTypes[id]; ok {
+		return st, nil
+	}
+	st, err := p.kfClient.GetCertificateStoreType(id)
+	if err != nil {
+		return nil, err
+	}
+	p.storeTypes[id] = st
+	return st, nil
+}
+
+// check returns the reasons the orchestrator of a store can't add or remove certificates, or nothing if it can.
+func (p *storePreflight) check(storeID string, adds bool, removes bool) []string {
+	store, err := p.kfClient.GetCertificateStoreByID(storeID)
+	if err != nil {
+		return []string{fmt.Sprintf("store lookup failed: %s", err)}
+	}
+	if store.AgentId == "" {
+		return []string{"no orchestrator is assigned"}
+	}
+	agent, aErr := p.agent(store.AgentId)
+	if aErr != nil {
+		return []string{fmt.Sprintf("orchestrator %s lookup failed: %s", store.AgentId, aErr)}
+	}
+	var reasons []string
+	if agent.GetStatus() != agentStatusApproved {
+		reasons = append(reasons, fmt.Sprintf("orchestrator %s is %s", agent.GetClientMachine(), agentStatusName(int(agent.GetStatus()))))
+	}
+	if lastSeen, ok := agent.GetLastSeenOk(); p.offlineAfter > 0 && (!ok || p.now.Sub(*lastSeen) > p.offlineAfter) {
+		seen := "never"
+		if ok {
+			seen = lastSeen.UTC().Format(time.RFC3339)
+		}
+		reasons = append(reasons, fmt.Sprintf("orchestrator %s is offline, last seen %s", agent.GetClientMachine(), seen))
+	}
+	st, stErr := p.storeType(store.CertStoreType)
+	if stErr != nil {
+		return append(reasons, fmt.Sprintf("store type %d lookup failed: %s", store.CertStoreType, stErr))
+	}
+	if !agentCanManage(agent.GetCapabilities(), st.Capability) {
+		reasons = append(reasons, fmt.Sprintf("orchestrator %s lacks the %s %s capability", agent.GetClientMachine(), st.Capability, managementCapability))
+	}
+	if ops := st.SupportedOperations; ops != nil {
+		if adds && !ops.Add {
+			reasons = append(reasons, fmt.Sprintf("store type %s does not support adding certificates", st.ShortName))
+		}
+		if removes && !ops.Remove {
+			reasons = append(reasons, fmt.Sprintf("store type %s does not support removing certificates", st.ShortName))
+		}
+	}
+	return reasons
+}
+
+// preflightActions drops the actions of stores whose orchestrators can't run them, unless --skip-preflight is set,
+// and reports the skipped stores.
+func preflightActions(cmd *cobra.Command, kfClient *api.Client, actions map[string][]ROTAction) map[string][]ROTAction {
+	if skip, _ := cmd.Flags().GetBool("skip-preflight"); skip || len(actions) == 0 {
+		return actions
+	}
+	offlineAfter, _ := cmd.Flags().GetDuration("agent-offline-after")
+	p := &storePreflight{
+		kfClient:     kfClient,
+		sdkClient:    initGenClient(),
+		offlineAfter: offlineAfter,
+		now:          time.Now(),
+		agents:       make(map[string]*keyfactor.KeyfactorApiModelsOrchestratorsAgentResponse),
+		storeTypes:   make(map[int]*api.CertificateStoreType),
+	}
+	adds := make(map[string]bool)
+	removes := make(map[string]bool)
+	for _, certActions := range actions {
+		for _, a := range certActions {
+			adds[a.StoreID] = adds[a.StoreID] || a.AddCert
+			removes[a.StoreID] = removes[a.StoreID] || a.RemoveCert
+		}
+	}
+	storeIDs := make([]string, 0, len(adds))
+	for id := range adds {
+		storeIDs = append(storeIDs, id)
+	}
+	sort.Strings(storeIDs)
+	blocked := make(map[string]bool)
+	for _, id := range storeIDs {
+		if reasons := p.check(id, adds[id], removes[id]); len(reasons) > 0 {
+			blocked[id] = true
+			printWarning("Skipping store %s: %s\n", id, strings.Join(reasons, "; "))
+			log.Printf("[WARN] preflight failed for store %s: %s", id, strings.Join(reasons, "; "))
+		}
+	}
+	if len(blocked) == 0 {
+		return actions
+	}
+	kept := make(map[string][]ROTAction)
+	skipped := 0
+	for thumbprint, certActions := range actions {
+		for _, a := range certActions {
+			if blocked[a.StoreID] {
+				skipped++
+				continue
+			}
+			kept[thumbprint] = append(kept[thumbprint], a)
+		}
+	}
+	printWarning("Skipped %d action(s) on %d store(s) whose orchestrators can't run them. Use --skip-preflight to submit them anyway.\n", skipped, len(blocked))
+	return kept
+}
@@ -0,0 +1,159 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	projectedPresent   = "present"
+	projectedAdded     = "added"
+	projectedRemoved   = "removed"
+	projectedNoop      = "already present"
+	projectedNotInside = "not present"
+)
+
+// projectedCert is a certificate of a store in the projected state after a reconcile.
+type projectedCert struct {
+	Thumbprint string `json:"thumbprint"`
+	SubjectDN  string `json:"subject_dn,omitempty"`
+	State      string `json:"state"`
+}
+
+// projectedStore is the projected inventory of a store after a reconcile.
+type projectedStore struct {
+	StoreID        string          `json:"store_id"`
+	StoreType      string          `json:"store_type,omitempty"`
+	StorePath      string          `json:"store_path,omitempty"`
+	InventoryError string          `json:"inventory_error,omitempty"`
+	Final          int             `json:"final_count"`
+	Added          int             `json:"added"`
+	Removed        int             `json:"removed"`
+	Certificates   []projectedCert `json:"certificates"`
+}
+
+// projectStoreStates applies the actions to the current inventory of each store they touch. Stores whose inventory
+// cannot be read are projected from their actions only.
+func projectStoreStates(actions map[string][]ROTAction, storeCtx *rotStoreContext) []projectedStore {
+	byStore := make(map[string][]ROTAction)
+	for _, certActions := range actions {
+		for _, a := range certActions {
+			if a.AddCert || a.RemoveCert {
+				byStore[a.StoreID] = append(byStore[a.StoreID], a)
+			}
+		}
+	}
+
+	var projections []projectedStore
+	for storeID, storeActions := range byStore {
+		p := projectedStore{StoreID: storeID, StoreType: storeActions[0].StoreType, StorePath: storeActions[0].StorePath}
+		certs := make(map[string]*projectedCert)
+		inv, err := storeCtx.inventory(storeID)
+		if err != nil {
+			log.Printf("[WARN] unable to read inventory of store %s: %s", storeID, err)
+			p.InventoryError = err.Error()
+		}
+		for _, entry := range inv {
+			for _, c := range entry.Certificates {
+				thumbprint := strings.ToUpper(c.Thumbprint)
+				certs[thumbprint] = &projectedCert{Thumbprint: thumbprint, SubjectDN: c.IssuedDN, State: projectedPresent}
+			}
+		}
+		for _, a := range storeActions {
+			thumbprint := strings.ToUpper(a.Thumbprint)
+			existing, ok := certs[thumbprint]
+			switch {
+			case a.AddCert && ok && existing.State == projectedPresent:
+				existing.State = projectedNoop
+			case a.AddCert && !ok:
+				certs[thumbprint] = &projectedCert{Thumbprint: thumbprint, State: projectedAdded}
+				p.Added++
+			case a.RemoveCert && ok && existing.State != projectedAdded && existing.State != projectedRemoved:
+				existing.State = projectedRemoved
+				p.Removed++
+			case a.RemoveCert && !ok && p.InventoryError != "":
+				// Without an inventory the certificate is assumed to be in the store, as the audit found it there.
+				certs[thumbprint] = &projectedCert{Thumbprint: thumbprint, State: projectedRemoved}
+				p.Removed++
+			case a.RemoveCert && !ok:
+				certs[thumbprint] = &projectedCert{Thumbprint: thumbprint, State: projectedNotInside}
+			}
+		}
+		for _, c := range certs {
+			if c.State != projectedRemoved && c.State != projectedNotInside {
+				p.Final++
+			}
+			p.Certificates = append(p.Certificates, *c)
+		}
+		sort.Slice(p.Certificates, func(i, j int) bool {
+			return p.Certificates[i].Thumbprint < p.Certificates[j].Thumbprint
+		})
+		projections = append(projections, p)
+	}
+	sort.Slice(projections, func(i, j int) bool {
+		return projections[i].StoreID < projections[j].StoreID
+	})
+	return projections
+}
+
+// printProjectedStates prints the projected state of every store.
+func printProjectedStates(projections []projectedStore) {
+	for _, p := range projections {
+		printInfo("DRY RUN: Projected state of store %s (%s %s): %d certificate(s), %d added, %d removed\n",
+			p.StoreID, p.StoreType, p.StorePath, p.Final, p.Added, p.Removed)
+		if p.InventoryError != "" {
+			printWarning("  Unable to read the current inventory, only changes are shown: %s\n", p.InventoryError)
+		}
+		for _, c := range p.Certificates {
+			line := strings.TrimSpace(fmt.Sprintf("%s %s", c.Thumbprint, c.SubjectDN))
+			switch c.State {
+			case projectedAdded:
+				printAdded("  + %s\n", line)
+			case projectedRemoved:
+				printRemoved("  - %s\n", line)
+			case projectedPresent:
+				printInfo("    %s\n", line)
+			default:
+				printInfo("    %s (%s)\n", line, c.State)
+			}
+		}
+	}
+}
+
+// reportProjectedStates prints the projected store states of a dry run, and writes them as JSON to --projected-state
+// if set.
+func reportProjectedStates(cmd *cobra.Command, actions map[string][]ROTAction, kfClient *api.Client) {
+	projections := projectStoreStates(actions, newROTStoreContext(kfClient))
+	printProjectedStates(projections)
+
+	path, _ := cmd.Flags().GetString("projected-state")
+	if path == "" {
+		return
+	}
+	data, _ := json.MarshalIndent(projections, "", "  ")
+	out, err := createOutput(path)
+	if err != nil {
+		fmt.Printf("[ERROR] writing projected state to %s: %s\n", path, err)
+		log.Printf("[ERROR] writing projected state: %s", err)
+		return
+	}
+	defer out.Close()
+	if _, err := fmt.Fprintf(out, "%s\n", data); err != nil {
+		fmt.Printf("[ERROR] writing projected state to %s: %s\n", path, err)
+		log.Printf("[ERROR] writing projected state: %s", err)
+		return
+	}
+	printInfo("Projected store states written to %s\n", outputName(path))
+}
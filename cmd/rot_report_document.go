@@ -0,0 +1,152 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// auditReportSchemaVersion is the schema version of the JSON and YAML audit reports this version of kfutil reads.
+const auditReportSchemaVersion = 1
+
+// auditReportDocument is an audit report in JSON or YAML, e.g.
+//
+//	schema_version: 1
+//	entries:
+//	  - thumbprint: 3B1EFD3A66EA28B16697394703A72CA340A05BD5
+//	    store_id: 5d3a...
+//	    store_type: RFPEM
+//	    add_cert: true
+type auditReportDocument struct {
+	SchemaVersion int                `yaml:"schema_version"`
+	Generated     string             `yaml:"generated,omitempty"`
+	Entries       []auditReportEntry `yaml:"entries"`
+}
+
+// auditReportEntry is an action of an audit report document, the JSON and YAML shape of a row of AuditHeader.
+type auditReportEntry struct {
+	Thumbprint      string            `yaml:"thumbprint"`
+	CertID          int               `yaml:"cert_id,omitempty"`
+	SubjectName     string            `yaml:"subject_name,omitempty"`
+	Issuer          string            `yaml:"issuer,omitempty"`
+	StoreID         string            `yaml:"store_id"`
+	StoreType       string            `yaml:"store_type,omitempty"`
+	Machine         string            `yaml:"machine,omitempty"`
+	Path            string            `yaml:"path,omitempty"`
+	AddCert         bool              `yaml:"add_cert"`
+	RemoveCert      bool              `yaml:"remove_cert"`
+	Deployed        bool              `yaml:"deployed"`
+	AuditDate       string            `yaml:"audit_date,omitempty"`
+	Uploaded        bool              `yaml:"uploaded,omitempty"`
+	Alias           string            `yaml:"alias,omitempty"`
+	EntryParameters map[string]string `yaml:"entry_parameters,omitempty"`
+}
+
+// auditReportMigrations upgrade a report document of a schema version to the next one. A new schema version adds the
+// migration from the previous version, so that reports written by older kfutil versions can still be executed.
+var auditReportMigrations = map[int]func(doc map[string]interface{}) error{}
+
+// isAuditReportDocument reports whether the audit report at path is a JSON or YAML document rather than a table.
+// JSON arrays of rows are read as tables.
+func isAuditReportDocument(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM))
+	return isJSONData(data) && trimmed[0] == '{' && bytes.Contains(trimmed, []byte(`"schema_version"`))
+}
+
+// parseAuditReportDocument parses a JSON or YAML audit report, migrating it from older schema versions.
+func parseAuditReportDocument(data []byte) (*auditReportDocument, error) {
+	// YAML is a superset of JSON, both are decoded by the YAML decoder.
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(bytes.TrimPrefix(data, utf8BOM), &raw); err != nil {
+		return nil, err
+	}
+	version, ok := raw["schema_version"].(int)
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid schema_version")
+	}
+	if version > auditReportSchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than the supported version %d, upgrade kfutil to execute it", version, auditReportSchemaVersion)
+	}
+	for ; version < auditReportSchemaVersion; version++ {
+		migrate, ok := auditReportMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("schema version %d is not supported", version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, fmt.Errorf("migrating from schema version %d: %s", version, err)
+		}
+		raw["schema_version"] = version + 1
+	}
+	migrated, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var doc auditReportDocument
+	dec := yaml.NewDecoder(bytes.NewReader(migrated))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// auditReportRows returns the entries of a report document as rows of AuditHeader, as if read from a CSV report.
+func auditReportRows(path string, doc *auditReportDocument) *tabularFile {
+	table := &tabularFile{Path: path, HasHeader: true}
+	for i, e := range doc.Entries {
+		line := i + 1
+		if strings.TrimSpace(e.StoreID) == "" {
+			table.Errors = append(table.Errors, tabularRowError{Line: line, Err: fmt.Errorf("missing value for store_id")})
+			continue
+		}
+		certID := ""
+		if e.CertID > 0 {
+			certID = strconv.Itoa(e.CertID)
+		}
+		values := []string{e.Thumbprint, certID, e.SubjectName, e.Issuer, e.StoreID, e.StoreType, e.Machine, e.Path,
+			strconv.FormatBool(e.AddCert), strconv.FormatBool(e.RemoveCert), strconv.FormatBool(e.Deployed), e.AuditDate,
+			strconv.FormatBool(e.Uploaded), e.Alias}
+		row := tabularRow{Line: line, values: make(map[string]string, len(AuditHeader))}
+		for c, column := range AuditHeader {
+			row.values[column] = strings.TrimSpace(values[c])
+		}
+		for name, value := range e.EntryParameters {
+			if row.Extra == nil {
+				row.Extra = make(map[string]string)
+			}
+			row.Extra[entryParamColumnPrefix+name] = value
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// readAuditReport reads an audit report in CSV, .xlsx, JSON or YAML format.
+func readAuditReport(path string) (*tabularFile, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isAuditReportDocument(path, data) {
+		return readTabularData(path, data, AuditHeader, []string{"StoreID"})
+	}
+	doc, err := parseAuditReportDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return auditReportRows(path, doc), nil
+}
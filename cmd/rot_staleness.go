@@ -0,0 +1,172 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// inputDateLayouts are the layouts accepted in LastQueriedDate and AuditDate columns. kfutil writes RFC 3339, the
+// API client formats inventory dates with time.Time.String.
+var inputDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05.999999999 -0700 MST", "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseMaxAge parses a --max-age value, a Go duration such as 36h or a number of days such as 7d.
+func parseMaxAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid max age '%s', expected e.g. 7d or 36h", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid max age '%s', expected e.g. 7d or 36h", s)
+	}
+	return d, nil
+}
+
+func parseInputDate(value string) (time.Time, bool) {
+	for _, layout := range inputDateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// inputAgePolicy enforces --max-age on the rows of input files.
+type inputAgePolicy struct {
+	maxAge     time.Duration
+	allowStale bool
+	refresh    bool
+	now        time.Time
+	typeNames  map[int]string
+}
+
+func addInputAgeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("max-age", "",
+		"Refuse input rows whose LastQueriedDate (or AuditDate) is older than this, e.g. 7d or 36h. Rows without a date are stale.")
+	cmd.Flags().Bool("allow-stale", false, "Used with --max-age. Warn about stale input rows instead of refusing them.")
+	cmd.Flags().Bool("refresh-stale", false,
+		"Used with --max-age. Replace the type, machine and path of stale stores file rows with the current values from the API.")
+}
+
+func newInputAgePolicyFromFlags(cmd *cobra.Command) *inputAgePolicy {
+	maxAgeFlag, _ := cmd.Flags().GetString("max-age")
+	allowStale, _ := cmd.Flags().GetBool("allow-stale")
+	refresh, _ := cmd.Flags().GetBool("refresh-stale")
+	maxAge, err := parseMaxAge(maxAgeFlag)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err)
+		log.Fatalf("[ERROR] %s", err)
+	}
+	return &inputAgePolicy{maxAge: maxAge, allowStale: allowStale, refresh: refresh, now: time.Now(), typeNames: make(map[int]string)}
+}
+
+// staleRows returns the lines of the rows of table whose dateColumn is missing or older than the max age.
+func (p *inputAgePolicy) staleRows(table *tabularFile, dateColumn string) map[int]string {
+	stale := make(map[int]string)
+	if p == nil || p.maxAge == 0 || strings.HasPrefix(table.Path, dbInputPrefix) {
+		// database query results are current
+		return stale
+	}
+	for _, row := range table.Rows {
+		value := row.Get(dateColumn)
+		t, ok := parseInputDate(value)
+		switch {
+		case value == "":
+			stale[row.Line] = fmt.Sprintf("no %s", dateColumn)
+		case !ok:
+			stale[row.Line] = fmt.Sprintf("invalid %s '%s'", dateColumn, value)
+		case p.now.Sub(t) > p.maxAge:
+			stale[row.Line] = fmt.Sprintf("%s %s is %s old", dateColumn, value, p.now.Sub(t).Round(time.Minute))
+		}
+	}
+	return stale
+}
+
+// check reports the stale rows of table and exits unless --allow-stale is set, or the rows are refreshable and
+// --refresh-stale is set. It returns the lines of the stale rows.
+func (p *inputAgePolicy) check(table *tabularFile, dateColumn string, refreshable bool) map[int]bool {
+	stale := p.staleRows(table, dateColumn)
+	lines := make(map[int]bool, len(stale))
+	if len(stale) == 0 {
+		return lines
+	}
+	for _, row := range table.Rows {
+		if reason, ok := stale[row.Line]; ok {
+			lines[row.Line] = true
+			printWarning("%s line %d is stale: %s\n", table.Path, row.Line, reason)
+			log.Printf("[WARN] %s line %d is stale: %s", table.Path, row.Line, reason)
+		}
+	}
+	switch {
+	case refreshable && p.refresh:
+		printInfo("Refreshing %d stale row(s) of %s from the API.\n", len(stale), table.Path)
+	case p.allowStale:
+		printWarning("Using %d stale row(s) of %s because of --allow-stale.\n", len(stale), table.Path)
+	default:
+		hint := "--allow-stale"
+		if refreshable {
+			hint = "--refresh-stale or --allow-stale"
+		}
+		fmt.Printf("[ERROR] %d row(s) of %s are older than --max-age %s. Regenerate the file or use %s.\n", len(stale), table.Path, p.maxAge, hint)
+		log.Fatalf("[ERROR] stale input file %s", table.Path)
+	}
+	return lines
+}
+
+// storeEntry returns the stores file entry of a row, with the type, machine and path replaced by the values of store
+// if the row is stale and --refresh-stale is set.
+func (p *inputAgePolicy) storeEntry(kfClient *api.Client, entry []string, stale bool, store *api.GetCertificateStoreResponse) []string {
+	if p == nil || !p.refresh || !stale || store == nil {
+		return entry
+	}
+	typeName, ok := p.typeNames[store.CertStoreType]
+	if !ok {
+		st, err := kfClient.GetCertificateStoreTypeById(store.CertStoreType)
+		if err != nil {
+			printWarning("Unable to refresh store %s, getting store type %d: %s\n", entry[0], store.CertStoreType, err)
+			return entry
+		}
+		typeName = st.ShortName
+		p.typeNames[store.CertStoreType] = typeName
+	}
+	refreshed := append([]string(nil), entry...)
+	refreshed[1], refreshed[2], refreshed[3] = typeName, store.ClientMachine, store.StorePath
+	if refreshed[1] != entry[1] || refreshed[2] != entry[2] || refreshed[3] != entry[3] {
+		printInfo("Refreshed store %s: %s %s %s\n", entry[0], typeName, store.ClientMachine, store.StorePath)
+	}
+	refreshed[6] = GetCurrentTime()
+	return refreshed
+}
+
+// readCertsFileWithAge reads a certs file like readCertsFile and checks the age of its rows. Collections are always
+// current and are not checked.
+func readCertsFileWithAge(path string, kfClient *api.Client, policy *inputAgePolicy) (map[string]string, error) {
+	if isCertsCollection(path) || policy == nil || policy.maxAge == 0 {
+		return readCertsFile(path, kfClient)
+	}
+	table, err := readTabularFile(path, certInputColumns, nil)
+	if err != nil {
+		return nil, err
+	}
+	policy.check(table, "LastQueriedDate", false)
+	return certsFromTable(table), nil
+}
@@ -0,0 +1,243 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// rotStatusCert is a root missing from stores.
+type rotStatusCert struct {
+	Thumbprint string `json:"thumbprint"`
+	Subject    string `json:"subject,omitempty"`
+	Stores     int    `json:"stores"`
+}
+
+// rotStatusGroup is the trust posture of a group of root stores.
+type rotStatusGroup struct {
+	Group              string          `json:"group"`
+	RootStores         int             `json:"root_stores"`
+	Compliant          int             `json:"compliant"`
+	CompliantPercent   float64         `json:"compliant_percent"`
+	StoresMissingRoots int             `json:"stores_missing_roots"`
+	UnexpectedStores   []string        `json:"stores_with_unexpected_certs"`
+	TopMissing         []rotStatusCert `json:"top_missing_roots"`
+}
+
+// rotStatus is the trust posture recorded in an audit report.
+type rotStatus struct {
+	Report    string           `json:"report"`
+	AuditedAt string           `json:"audited_at,omitempty"`
+	Total     rotStatusGroup   `json:"total"`
+	Groups    []rotStatusGroup `json:"groups"`
+}
+
+// rotStatusAccumulator collects the rows of one group.
+type rotStatusAccumulator struct {
+	stores     map[string]bool
+	missing    map[string]bool
+	unexpected map[string]bool
+	missingBy  map[string]*rotStatusCert
+}
+
+func newROTStatusAccumulator() *rotStatusAccumulator {
+	return &rotStatusAccumulator{
+		stores:     make(map[string]bool),
+		missing:    make(map[string]bool),
+		unexpected: make(map[string]bool),
+		missingBy:  make(map[string]*rotStatusCert),
+	}
+}
+
+func (acc *rotStatusAccumulator) add(storeID string, thumbprint string, subject string, add bool, remove bool) {
+	acc.stores[storeID] = true
+	if add {
+		acc.missing[storeID] = true
+		c, ok := acc.missingBy[thumbprint]
+		if !ok {
+			c = &rotStatusCert{Thumbprint: thumbprint, Subject: subject}
+			acc.missingBy[thumbprint] = c
+		}
+		c.Stores++
+	}
+	if remove {
+		acc.unexpected[storeID] = true
+	}
+}
+
+func (acc *rotStatusAccumulator) group(name string, top int) rotStatusGroup {
+	g := rotStatusGroup{Group: name, RootStores: len(acc.stores), StoresMissingRoots: len(acc.missing), UnexpectedStores: []string{}}
+	for id := range acc.stores {
+		if !acc.missing[id] && !acc.unexpected[id] {
+			g.Compliant++
+		}
+	}
+	if g.RootStores > 0 {
+		g.CompliantPercent = float64(g.Compliant) * 100 / float64(g.RootStores)
+	}
+	for id := range acc.unexpected {
+		g.UnexpectedStores = append(g.UnexpectedStores, id)
+	}
+	sort.Strings(g.UnexpectedStores)
+	g.TopMissing = []rotStatusCert{}
+	for _, c := range acc.missingBy {
+		g.TopMissing = append(g.TopMissing, *c)
+	}
+	sort.Slice(g.TopMissing, func(i, j int) bool {
+		if g.TopMissing[i].Stores != g.TopMissing[j].Stores {
+			return g.TopMissing[i].Stores > g.TopMissing[j].Stores
+		}
+		return g.TopMissing[i].Thumbprint < g.TopMissing[j].Thumbprint
+	})
+	if top >= 0 && len(g.TopMissing) > top {
+		g.TopMissing = g.TopMissing[:top]
+	}
+	return g
+}
+
+// readROTStatus summarises an audit report by store type, or by machine if groupBy is "machine".
+func readROTStatus(reportPath string, groupBy string, top int) (*rotStatus, error) {
+	table, err := readTabularFile(reportPath, AuditHeader, []string{"StoreID"})
+	if err != nil {
+		return nil, err
+	}
+	status := &rotStatus{Report: reportPath}
+	total := newROTStatusAccumulator()
+	groups := make(map[string]*rotStatusAccumulator)
+	var auditedAt time.Time
+	for _, row := range table.Rows {
+		storeID := row.Get("StoreID")
+		if storeID == "" {
+			continue
+		}
+		name := row.Get("StoreType")
+		if groupBy == "machine" {
+			name = row.Get("Machine")
+		}
+		if name == "" {
+			name = "(unknown)"
+		}
+		if _, ok := groups[name]; !ok {
+			groups[name] = newROTStatusAccumulator()
+		}
+		add, _ := strconv.ParseBool(row.Get("AddCert"))
+		remove, _ := strconv.ParseBool(row.Get("RemoveCert"))
+		thumbprint := row.Get("Thumbprint")
+		if thumbprint == "" {
+			thumbprint = row.Get("CertID")
+		}
+		subject := row.Get("SubjectName")
+		total.add(storeID, thumbprint, subject, add, remove)
+		groups[name].add(storeID, thumbprint, subject, add, remove)
+		if t, tErr := time.Parse(time.RFC3339, row.Get("AuditDate")); tErr == nil && t.After(auditedAt) {
+			auditedAt = t
+		}
+	}
+	if auditedAt.IsZero() {
+		if info, sErr := os.Stat(reportPath); sErr == nil {
+			auditedAt = info.ModTime()
+		}
+	}
+	if !auditedAt.IsZero() {
+		status.AuditedAt = auditedAt.Format(time.RFC3339)
+	}
+	status.Total = total.group("all", top)
+	for name, acc := range groups {
+		status.Groups = append(status.Groups, acc.group(name, top))
+	}
+	sort.Slice(status.Groups, func(i, j int) bool { return status.Groups[i].Group < status.Groups[j].Group })
+	return status, nil
+}
+
+func printROTStatusGroup(g rotStatusGroup) {
+	fmt.Printf("%s\n", g.Group)
+	fmt.Printf("  Root stores:       %d\n", g.RootStores)
+	fmt.Printf("  Desired state:     %d (%.1f%%)\n", g.Compliant, g.CompliantPercent)
+	fmt.Printf("  Missing roots:     %d store(s)\n", g.StoresMissingRoots)
+	fmt.Printf("  Unexpected certs:  %d store(s)", len(g.UnexpectedStores))
+	if len(g.UnexpectedStores) > 0 {
+		fmt.Printf(" %s", strings.Join(g.UnexpectedStores, ", "))
+	}
+	fmt.Println()
+	for _, c := range g.TopMissing {
+		name := c.Thumbprint
+		if c.Subject != "" {
+			name = fmt.Sprintf("%s (%s)", c.Subject, c.Thumbprint)
+		}
+		fmt.Printf("    missing from %d store(s): %s\n", c.Stores, name)
+	}
+}
+
+func printROTStatus(status *rotStatus) {
+	audited := status.AuditedAt
+	if audited == "" {
+		audited = "unknown"
+	}
+	fmt.Printf("Root of trust status from %s, audited %s\n\n", status.Report, audited)
+	printROTStatusGroup(status.Total)
+	for _, g := range status.Groups {
+		fmt.Println()
+		printROTStatusGroup(g)
+	}
+}
+
+var rotStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Summarize the trust posture recorded by the latest audit.",
+	Long: `Summarizes an audit report generated by 'stores rot audit' per store type, or per machine with --group-by machine:
+the number of root stores, how many are in the desired state, the roots missing from the most stores and the stores
+holding certificates that should be removed. Reads the latest timestamped audit report unless --input-file is given.
+No changes are made and no API calls are needed.`,
+	Example: `kfutil stores rot status --group-by type --top 3`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		reportPath, _ := cmd.Flags().GetString("input-file")
+		groupBy, _ := cmd.Flags().GetString("group-by")
+		top, _ := cmd.Flags().GetInt("top")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+
+		if groupBy != "type" && groupBy != "machine" {
+			fmt.Printf("[ERROR] invalid --group-by '%s', must be one of type or machine\n", groupBy)
+			log.Fatalf("[ERROR] invalid --group-by: %s", groupBy)
+		}
+		reportPath = latestAuditReportPath(reportPath)
+		status, err := readROTStatus(reportPath, groupBy, top)
+		if err != nil {
+			fmt.Printf("[ERROR] reading audit report %s: %s\n", reportPath, err)
+			log.Fatalf("[ERROR] reading audit report: %s", err)
+		}
+		if jsonOut {
+			output, jErr := json.MarshalIndent(status, "", "  ")
+			if jErr != nil {
+				fmt.Printf("[ERROR] %s\n", jErr)
+				log.Fatalf("[ERROR] %s", jErr)
+			}
+			fmt.Printf("%s\n", output)
+			return
+		}
+		printROTStatus(status)
+	},
+}
+
+func init() {
+	rotCmd.AddCommand(rotStatusCmd)
+	rotStatusCmd.Flags().StringP("input-file", "i", reconcileDefaultFileName,
+		"Audit report to summarize. Defaults to the latest timestamped audit report if "+reconcileDefaultFileName+" does not exist.")
+	rotStatusCmd.Flags().String("group-by", "type", "Group stores by type or machine.")
+	rotStatusCmd.Flags().Int("top", 5, "Number of missing roots to list per group.")
+	rotStatusCmd.Flags().Bool("json", false, "Print the status as JSON.")
+}
@@ -0,0 +1,154 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// summaryMaxThumbprints bounds the thumbprints listed per store in a Markdown summary, so summaries stay short enough
+// for change tickets and PR comments. The full list is in the report.
+const summaryMaxThumbprints = 5
+
+// rotActionFailure is an action reconcile could not apply.
+type rotActionFailure struct {
+	Action ROTAction
+	Err    error
+}
+
+func (f rotActionFailure) String() string {
+	verb := "add certificate %s to"
+	if f.Action.RemoveCert {
+		verb = "remove certificate %s from"
+	}
+	return fmt.Sprintf("Unable to "+verb+" store %s (%s): %s", f.Action.Thumbprint, f.Action.StoreID, f.Action.StorePath, f.Err)
+}
+
+func addSummaryMarkdownFlag(cmd *cobra.Command) {
+	cmd.Flags().String("summary-md", "",
+		"Also write a Markdown summary of the run, with the adds and removes per store and the failures, to this file, e.g. for a change ticket or PR comment.")
+}
+
+// rotStoreChanges are the actions of a run on one store.
+type rotStoreChanges struct {
+	StoreID, StoreType, StorePath string
+	Adds, Removes                 []string
+}
+
+// rotChangesByStore groups actions, sorted by store, per store.
+func rotChangesByStore(actions []ROTAction) []*rotStoreChanges {
+	var stores []*rotStoreChanges
+	byID := make(map[string]*rotStoreChanges)
+	for _, a := range actions {
+		sc, ok := byID[a.StoreID]
+		if !ok {
+			sc = &rotStoreChanges{StoreID: a.StoreID, StoreType: a.StoreType, StorePath: a.StorePath}
+			byID[a.StoreID] = sc
+			stores = append(stores, sc)
+		}
+		if a.AddCert {
+			sc.Adds = append(sc.Adds, a.Thumbprint)
+		} else if a.RemoveCert {
+			sc.Removes = append(sc.Removes, a.Thumbprint)
+		}
+	}
+	return stores
+}
+
+// markdownThumbprints lists thumbprints in a Markdown table cell, up to summaryMaxThumbprints of them.
+func markdownThumbprints(thumbprints []string) string {
+	if len(thumbprints) == 0 {
+		return ""
+	}
+	sorted := append([]string{}, thumbprints...)
+	sort.Strings(sorted)
+	var cells []string
+	for i, tp := range sorted {
+		if i == summaryMaxThumbprints {
+			cells = append(cells, fmt.Sprintf("and %d more", len(sorted)-summaryMaxThumbprints))
+			break
+		}
+		cells = append(cells, "`"+tp+"`")
+	}
+	return fmt.Sprintf("%d: %s", len(thumbprints), strings.Join(cells, ", "))
+}
+
+// markdownCell escapes a value for a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ", "\r", "").Replace(s)
+}
+
+// rotMarkdownSummary returns the Markdown summary of a rot audit or reconcile run: its totals, the adds and removes
+// per store and the failures. actions are sorted by store, see sortedROTActions.
+func rotMarkdownSummary(s rotRunSummary, actions []ROTAction, failures []rotActionFailure) string {
+	var b strings.Builder
+	title := "kfutil stores rot " + s.Command
+	if s.DryRun {
+		title += " (dry run)"
+	}
+	fmt.Fprintf(&b, "## %s\n\n", title)
+	if s.Ticket != "" {
+		fmt.Fprintf(&b, "Change ticket: `%s`\n\n", s.Ticket)
+	}
+	fmt.Fprintln(&b, "| Stores | Certificates to add | Certificates to remove | Succeeded | Failed | Lookup failures |")
+	fmt.Fprintln(&b, "| ---: | ---: | ---: | ---: | ---: | ---: |")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %d |\n\n", s.Stores, s.AddActions, s.RemoveActions, s.Succeeded, s.Failed, len(s.LookupFailures))
+
+	if stores := rotChangesByStore(actions); len(stores) > 0 {
+		fmt.Fprintln(&b, "### Changes per store")
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "| Store | Type | Path | Add | Remove |")
+		fmt.Fprintln(&b, "| --- | --- | --- | --- | --- |")
+		for _, sc := range stores {
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", sc.StoreID, markdownCell(sc.StoreType), markdownCell(sc.StorePath),
+				markdownThumbprints(sc.Adds), markdownThumbprints(sc.Removes))
+		}
+		fmt.Fprintln(&b)
+	} else {
+		fmt.Fprint(&b, "No changes, the stores are up to date.\n\n")
+	}
+
+	if len(failures) > 0 || len(s.LookupFailures) > 0 {
+		fmt.Fprintln(&b, "### Failures")
+		fmt.Fprintln(&b)
+		for _, storeID := range s.LookupFailures {
+			fmt.Fprintf(&b, "- Store `%s` could not be looked up\n", storeID)
+		}
+		for _, f := range failures {
+			fmt.Fprintf(&b, "- %s\n", markdownCell(f.String()))
+		}
+		fmt.Fprintln(&b)
+	}
+
+	switch {
+	case s.ReportURL != "":
+		fmt.Fprintf(&b, "Full report: [%s](%s)\n", s.Report, s.ReportURL)
+	case s.Report != "":
+		fmt.Fprintf(&b, "Full report: `%s`\n", s.Report)
+	}
+	return b.String()
+}
+
+// writeSummaryMarkdown writes the Markdown summary of a run to --summary-md, if it is set.
+func writeSummaryMarkdown(cmd *cobra.Command, s rotRunSummary, actions map[string][]ROTAction, failures []rotActionFailure) {
+	path, _ := cmd.Flags().GetString("summary-md")
+	if path == "" {
+		return
+	}
+	summary := rotMarkdownSummary(s, sortedROTActions(actions), failures)
+	if err := writeOutputFile(path, []byte(summary), 0644); err != nil {
+		fmt.Printf("[ERROR] writing summary %s: %s\n", path, err)
+		log.Printf("[ERROR] writing summary: %s", err)
+		return
+	}
+	printInfo("Summary written to %s\n", outputName(path))
+}
@@ -0,0 +1,363 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Kinds of template sources.
+const (
+	templateSourceStoreType  = "store type"
+	templateSourceContainer  = "container"
+	templateSourceCollection = "collection"
+	templateSourceCN         = "cn"
+)
+
+// templateSource is a --store-type, --container-type, --collection or --cn value to pre-populate a template with.
+type templateSource struct {
+	Kind  string
+	Value string
+}
+
+func (s templateSource) String() string {
+	return fmt.Sprintf("%s %s", s.Kind, s.Value)
+}
+
+// templateSourcesFromFlags returns the sources of the template type that were given. Stores templates are
+// pre-populated by store type and container, certs templates by collection and CN.
+func templateSourcesFromFlags(cmd *cobra.Command, templateType string) []templateSource {
+	kinds := map[string][]string{
+		"stores": {"store-type", templateSourceStoreType, "container-type", templateSourceContainer},
+		"certs":  {"collection", templateSourceCollection, "cn", templateSourceCN},
+	}[templateType]
+	var sources []templateSource
+	for i := 0; i < len(kinds); i += 2 {
+		values, _ := cmd.Flags().GetStringSlice(kinds[i])
+		for _, v := range values {
+			sources = append(sources, templateSource{Kind: kinds[i+1], Value: v})
+		}
+	}
+	return sources
+}
+
+// templatePrepopulator fetches the rows of template sources. It is safe for concurrent use.
+type templatePrepopulator struct {
+	cmd      *cobra.Command
+	kfClient *api.Client
+
+	storesOnce sync.Once
+	stores     []api.GetCertificateStoreResponse
+	storesErr  error
+
+	typesOnce sync.Once
+	typeNames map[int]string
+	typesErr  error
+}
+
+// storeTypeNames returns the short names of the store types by ID, listed once for --store-type all.
+func (p *templatePrepopulator) storeTypeNames() (map[int]string, error) {
+	p.typesOnce.Do(func() {
+		types, err := p.kfClient.ListCertificateStoreTypes()
+		if err != nil {
+			p.typesErr = fmt.Errorf("listing certificate store types: %s", err)
+			return
+		}
+		p.typeNames = make(map[int]string, len(*types))
+		for _, st := range *types {
+			p.typeNames[st.StoreType] = st.ShortName
+		}
+	})
+	return p.typeNames, p.typesErr
+}
+
+// allStores lists the certificate stores once for all store type sources.
+func (p *templatePrepopulator) allStores() ([]api.GetCertificateStoreResponse, error) {
+	p.storesOnce.Do(func() {
+		params := make(map[string]interface{})
+		stores, err := p.kfClient.ListCertificateStores(&params)
+		if err != nil {
+			p.storesErr = fmt.Errorf("listing certificate stores: %s", err)
+			return
+		}
+		p.stores = *stores
+	})
+	return p.stores, p.storesErr
+}
+
+func storeTemplateRow(store api.GetCertificateStoreResponse, storeType string) []string {
+	// "StoreID", "StoreType", "StoreMachine", "StorePath", "ContainerId", "ContainerName", "LastQueriedDate"
+	return []string{store.Id, storeType, store.ClientMachine, store.StorePath, fmt.Sprintf("%d", store.ContainerId), store.ContainerName, GetCurrentTime()}
+}
+
+// rows returns the template rows of a source.
+func (p *templatePrepopulator) rows(source templateSource) ([][]string, error) {
+	var rows [][]string
+	switch source.Kind {
+	case templateSourceStoreType:
+		stID := -1
+		shortName := ""
+		if source.Value != "all" {
+			sType, err := p.kfClient.GetCertificateStoreTypeByName(source.Value)
+			if err != nil {
+				return nil, fmt.Errorf("getting store type: %s", err)
+			}
+			stID, shortName = sType.StoreType, sType.ShortName
+		}
+		stores, err := p.allStores()
+		if err != nil {
+			return nil, err
+		}
+		for _, store := range stores {
+			if store.CertStoreType == stID || source.Value == "all" {
+				rows = append(rows, storeTemplateRow(store, shortName))
+			}
+		}
+	case templateSourceContainer:
+		stores, err := p.kfClient.GetCertificateStoreByContainerID(source.Value)
+		if err != nil {
+			return nil, fmt.Errorf("getting store container: %s", err)
+		}
+		if stores == nil {
+			return nil, nil
+		}
+		for _, store := range *stores {
+			sType, stErr := p.kfClient.GetCertificateStoreType(store.CertStoreType)
+			if stErr != nil {
+				return nil, fmt.Errorf("getting store type of store %s: %s", store.Id, stErr)
+			}
+			rows = append(rows, storeTemplateRow(store, sType.ShortName))
+		}
+	case templateSourceCollection:
+		ctx := commandContext(p.cmd)
+		sdkClient := initGenClient()
+		id, err := resolveCollectionID(ctx, sdkClient, source.Value)
+		if err != nil {
+			return nil, err
+		}
+		// The progress bar reports progress per source, pages are not reported.
+		paging := collectionPagingFromFlags(p.cmd, source.Value)
+		paging.IncludeLocations = true
+		paging.Progress = nil
+		certs, err := queryCollectionCertificates(ctx, sdkClient, id, paging)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[INFO] collection %s (%d) has %d certificate(s)", source.Value, id, len(certs))
+		for _, cert := range certs {
+			locationsFormatted := ""
+			for _, loc := range cert.GetLocations() {
+				locationsFormatted += fmt.Sprintf("%s:%s\n", loc.GetStoreMachine(), loc.GetStorePath())
+			}
+			// "Thumbprint", "SubjectName", "Issuer", "CertID", "Locations", "LastQueriedDate"
+			rows = append(rows, []string{cert.GetThumbprint(), cert.GetIssuedCN(), cert.GetIssuerDN(), fmt.Sprintf("%d", cert.GetId()), locationsFormatted, GetCurrentTime()})
+		}
+	case templateSourceCN:
+		certs, err := p.kfClient.ListCertificates(map[string]string{"subject": source.Value})
+		if err != nil {
+			return nil, fmt.Errorf("no certificates found with CN: %s", err)
+		}
+		for _, cert := range certs {
+			locationsFormatted := ""
+			for _, loc := range cert.Locations {
+				locationsFormatted += fmt.Sprintf("%s:%s\n", loc.StoreMachine, loc.StorePath)
+			}
+			rows = append(rows, []string{cert.Thumbprint, cert.IssuedCN, cert.IssuerDN, fmt.Sprintf("%d", cert.Id), locationsFormatted, GetCurrentTime()})
+		}
+	}
+	return rows, nil
+}
+
+// prepopulateTemplate fetches the rows of the sources concurrently, see --concurrency. Rows are returned in the order
+// of the sources. The sources that failed are returned with their errors, the rows of the others are still returned.
+func prepopulateTemplate(cmd *cobra.Command, kfClient *api.Client, sources []templateSource) ([][]string, map[templateSource]error) {
+	p := &templatePrepopulator{cmd: cmd, kfClient: kfClient}
+	results := make([][][]string, len(sources))
+	bar := newProgressBar("Pre-populating template", len(sources))
+	errs := newBatchRunnerFromFlags(cmd).run(len(sources), func(i int) error {
+		rows, err := p.rows(sources[i])
+		results[i] = rows
+		// Throttled sources are retried by the runner.
+		if !isRateLimitError(err) {
+			bar.increment()
+		}
+		return err
+	})
+	bar.finish()
+	var rows [][]string
+	failed := make(map[templateSource]error)
+	for i, err := range errs {
+		if err != nil {
+			failed[sources[i]] = err
+			continue
+		}
+		rows = append(rows, results[i]...)
+	}
+	return rows, failed
+}
+
+// templateRowKey returns the key template rows are de-duplicated by: the store ID or the certificate thumbprint.
+func templateRowKey(row []string) string {
+	if len(row) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(row[0]))
+}
+
+// readTemplateForAppend returns the rows of an existing template for --append, or nil if it does not exist yet.
+func readTemplateForAppend(path string, header []string) ([][]string, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	table, err := readTabularFile(path, header, header[:1])
+	if err != nil {
+		return nil, err
+	}
+	table.reportErrors()
+	rows := make([][]string, 0, len(table.Rows))
+	for _, r := range table.Rows {
+		rows = append(rows, r.Values(header))
+	}
+	return rows, nil
+}
+
+// mergeTemplateRows returns existing followed by the rows of added that are not in it yet.
+func mergeTemplateRows(existing [][]string, added [][]string) ([][]string, int) {
+	seen := make(map[string]bool, len(existing))
+	for _, row := range existing {
+		seen[templateRowKey(row)] = true
+	}
+	merged := existing
+	count := 0
+	for _, row := range added {
+		key := templateRowKey(row)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, row)
+		count++
+	}
+	return merged, count
+}
+
+// templateColumns returns the indexes in header of the --columns of a template, in the order given, or of all columns
+// if columns is empty. Names are matched like input headers, e.g. machine for StoreMachine. The first column of header
+// identifies the rows, see templateRowKey, and must be included.
+func templateColumns(header []string, columns []string) ([]int, error) {
+	if len(columns) == 0 {
+		indexes := make([]int, len(header))
+		for i := range header {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+	var indexes []int
+	seen := make(map[int]bool)
+	for _, name := range columns {
+		i, err := templateColumnIndex(header, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --columns: %s", err)
+		}
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	if !seen[0] {
+		return nil, fmt.Errorf("invalid --columns: %s identifies the rows of the template and must be included", header[0])
+	}
+	return indexes, nil
+}
+
+// templateColumnIndex returns the index of the column name in header.
+func templateColumnIndex(header []string, name string) (int, error) {
+	if column, ok := matchColumn(name, header); ok {
+		for i, h := range header {
+			if h == column {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown column '%s', expected one of %s", strings.TrimSpace(name), strings.Join(header, ", "))
+}
+
+// sortTemplateRows sorts rows in the layout of header by the sortBy columns, case-insensitively. Values that are both
+// integers, such as certificate IDs, are compared numerically. Rows that compare equal keep their order.
+func sortTemplateRows(header []string, rows [][]string, sortBy []string) error {
+	var keys []int
+	for _, name := range sortBy {
+		i, err := templateColumnIndex(header, name)
+		if err != nil {
+			return fmt.Errorf("invalid --sort-by: %s", err)
+		}
+		keys = append(keys, i)
+	}
+	cell := func(row []string, i int) string {
+		if i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		for _, k := range keys {
+			x, y := cell(rows[a], k), cell(rows[b], k)
+			if xn, xErr := strconv.Atoi(x); xErr == nil {
+				if yn, yErr := strconv.Atoi(y); yErr == nil {
+					if xn != yn {
+						return xn < yn
+					}
+					continue
+				}
+			}
+			if x, y = strings.ToLower(x), strings.ToLower(y); x != y {
+				return x < y
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// projectTemplateRows returns rows with only the columns at indexes, in that order.
+func projectTemplateRows(rows [][]string, indexes []int) [][]string {
+	projected := make([][]string, len(rows))
+	for r, row := range rows {
+		out := make([]string, len(indexes))
+		for j, i := range indexes {
+			if i < len(row) {
+				out[j] = row[i]
+			}
+		}
+		projected[r] = out
+	}
+	return projected
+}
+
+// exitOnTemplateFailures exits with an error if sources failed, after the rows of the other sources were written.
+func exitOnTemplateFailures(failed map[templateSource]error) {
+	if len(failed) == 0 {
+		return
+	}
+	var names []string
+	for source := range failed {
+		names = append(names, source.String())
+	}
+	sort.Strings(names)
+	fmt.Printf("[ERROR] the template is missing the rows of %s, rerun with --append to add them\n", strings.Join(names, ", "))
+	log.Fatalf("[ERROR] %d template source(s) failed", len(failed))
+}
@@ -0,0 +1,35 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/cobra"
+)
+
+// changeTicketPattern is the accepted form of a change ticket ID, e.g. CHG012345 or OPS-1234.
+var changeTicketPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/#-]{0,63}$`)
+
+// rotChangeTicket is the ID of the change record that authorizes a reconcile, set with --ticket. It is recorded in the
+// reconciled report, the run summary and the --result-json of the run.
+var rotChangeTicket string
+
+// addChangeTicketFlag adds --ticket, which sets rotChangeTicket.
+func addChangeTicketFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&rotChangeTicket, "ticket", "",
+		"ID of the change ticket that authorizes the run, e.g. CHG012345. Recorded in the reconciled report, the run summary and --result-json.")
+}
+
+// validateChangeTicket returns an error if --ticket is set to something that does not look like a ticket ID.
+func validateChangeTicket() error {
+	if rotChangeTicket == "" || changeTicketPattern.MatchString(rotChangeTicket) {
+		return nil
+	}
+	return fmt.Errorf("invalid --ticket '%s', expected a ticket ID of up to 64 letters, digits and ._:/#-", rotChangeTicket)
+}
@@ -0,0 +1,109 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// emptyJobType is the job type GUID of a store type without the job.
+const emptyJobType = "00000000-0000-0000-0000-000000000000"
+
+// uninventoriedStore is a store whose inventory could not be read.
+type uninventoriedStore struct {
+	ID      string
+	Type    string
+	Machine string
+	Path    string
+	Reason  string
+}
+
+// storeInventoryChecker detects stores whose type does not support inventory and collects the stores that could not
+// be inventoried.
+type storeInventoryChecker struct {
+	kfClient *api.Client
+	include  bool
+	types    map[int]*api.CertificateStoreType
+	skipped  []uninventoriedStore
+}
+
+func addUninventoriedFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("include-uninventoried", false,
+		"Audit stores whose inventory can't be read as if they were empty, so add actions are still emitted for them. "+
+			"No remove actions can be determined for these stores.")
+}
+
+func newStoreInventoryChecker(cmd *cobra.Command, kfClient *api.Client) *storeInventoryChecker {
+	include, _ := cmd.Flags().GetBool("include-uninventoried")
+	return &storeInventoryChecker{kfClient: kfClient, include: include, types: make(map[int]*api.CertificateStoreType)}
+}
+
+// storeTypeSupportsInventory reports whether a store type definition has an inventory job.
+func storeTypeSupportsInventory(st *api.CertificateStoreType) bool {
+	job := strings.TrimSpace(st.InventoryJobType)
+	return job != "" && job != emptyJobType
+}
+
+// inventory returns the inventory of a store. ok is false if the store type does not support inventory or the
+// inventory can't be read, in which case the store is recorded and, with --include-uninventoried, an empty inventory
+// is returned.
+func (c *storeInventoryChecker) inventory(entry []string, store *api.GetCertificateStoreResponse) (inventory []api.CertStoreInventory, ok bool) {
+	if store != nil {
+		st, cached := c.types[store.CertStoreType]
+		if !cached {
+			var err error
+			st, err = c.kfClient.GetCertificateStoreTypeById(store.CertStoreType)
+			if err != nil {
+				log.Printf("[WARN] getting store type %d of store %s: %s", store.CertStoreType, entry[0], err)
+				st = nil
+			}
+			c.types[store.CertStoreType] = st
+		}
+		if st != nil && !storeTypeSupportsInventory(st) {
+			return c.skip(entry, fmt.Sprintf("store type %s does not support inventory", st.ShortName))
+		}
+	}
+	inv, err := c.kfClient.GetCertStoreInventory(entry[0])
+	if err != nil {
+		log.Printf("[ERROR] getting cert store inventory for: %s\n%s", entry[0], err)
+		return c.skip(entry, fmt.Sprintf("inventory failed: %s", err))
+	}
+	if inv == nil {
+		return []api.CertStoreInventory{}, true
+	}
+	return *inv, true
+}
+
+func (c *storeInventoryChecker) skip(entry []string, reason string) ([]api.CertStoreInventory, bool) {
+	c.skipped = append(c.skipped, uninventoriedStore{ID: entry[0], Type: entry[1], Machine: entry[2], Path: entry[3], Reason: reason})
+	log.Printf("[WARN] store %s was not inventoried: %s", entry[0], reason)
+	if c.include {
+		return []api.CertStoreInventory{}, false
+	}
+	return nil, false
+}
+
+// report prints the stores that could not be inventoried.
+func (c *storeInventoryChecker) report() {
+	if len(c.skipped) == 0 {
+		return
+	}
+	if c.include {
+		printWarning("\n%d store(s) could not be inventoried and were audited as empty, only add actions were emitted for them:\n", len(c.skipped))
+	} else {
+		printWarning("\n%d store(s) could not be inventoried and were skipped, use --include-uninventoried to emit add actions for them:\n", len(c.skipped))
+	}
+	for _, s := range c.skipped {
+		printWarning("  %s (%s) %s %s: %s\n", s.ID, s.Type, s.Machine, s.Path, s.Reason)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,139 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// certSourceExtensions are the file extensions read from a --cert-source directory.
+var certSourceExtensions = map[string]bool{".pem": true, ".crt": true, ".cer": true, ".der": true, ".cert": true}
+
+func addUploadMissingFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("upload-missing", false,
+		"Upload add-certs that are not in Keyfactor from --cert-source before auditing. Uploaded certs are marked in the Uploaded column of the report.")
+	cmd.Flags().String("cert-source", "", "Used with --upload-missing. A PEM bundle, a DER certificate or a directory of them to find missing certificates in.")
+}
+
+// parseCertificates returns the certificates of PEM data, or of DER data if data has no PEM blocks.
+func parseCertificates(data []byte) []*x509.Certificate {
+	trust := newTrustSource()
+	trust.addPEM(data)
+	certs := trust.Certs
+	if len(certs) == 0 {
+		if cert, err := x509.ParseCertificate(data); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// readCertSource returns the certificates of a PEM bundle, a DER certificate or a directory of them, by thumbprint.
+func readCertSource(source string) (map[string]*x509.Certificate, error) {
+	certs := make(map[string]*x509.Certificate)
+	add := func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, cert := range parseCertificates(data) {
+			certs[certThumbprint(cert)] = cert
+		}
+		return nil
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return certs, add(source)
+	}
+	err = filepath.Walk(source, func(path string, fi os.FileInfo, wErr error) error {
+		if wErr != nil || fi.IsDir() || !certSourceExtensions[strings.ToLower(filepath.Ext(path))] {
+			return wErr
+		}
+		if aErr := add(path); aErr != nil {
+			log.Printf("[WARN] reading %s: %s", path, aErr)
+		}
+		return nil
+	})
+	return certs, err
+}
+
+// importCertificate uploads a certificate to Keyfactor without a private key.
+func importCertificate(ctx context.Context, sdkClient *keyfactor.APIClient, cert *x509.Certificate) error {
+	importReq := keyfactor.NewModelsCertificateImportRequestModel(base64.StdEncoding.EncodeToString(cert.Raw))
+	_, httpResponse, err := sdkClient.CertificateApi.CertificatePostImportCertificate(ctx).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Req(*importReq).
+		Execute()
+	if err != nil {
+		WriteApiError(fmt.Sprintf("Import %s", cert.Subject.String()), httpResponse, err)
+		fmt.Println()
+		return err
+	}
+	return nil
+}
+
+// uploadMissingCerts uploads the certificates of addCerts that are not in Keyfactor from --cert-source, if
+// --upload-missing is set, and returns the thumbprints of the uploaded certificates.
+func uploadMissingCerts(cmd *cobra.Command, kfClient *api.Client, addCerts map[string]string, dryRun bool) map[string]bool {
+	uploaded := make(map[string]bool)
+	if enabled, _ := cmd.Flags().GetBool("upload-missing"); !enabled {
+		return uploaded
+	}
+	source, _ := cmd.Flags().GetString("cert-source")
+	if source == "" {
+		fmt.Println("[ERROR] --upload-missing requires --cert-source")
+		log.Fatalf("[ERROR] --upload-missing used without --cert-source")
+	}
+	var missing []string
+	for _, cert := range addCerts {
+		if _, found := lookupCertByThumbprint(kfClient, cert); !found {
+			missing = append(missing, strings.ToUpper(cert))
+		}
+	}
+	if len(missing) == 0 {
+		return uploaded
+	}
+	sort.Strings(missing)
+	available, err := readCertSource(source)
+	if err != nil {
+		fmt.Printf("[ERROR] reading --cert-source %s: %s\n", source, err)
+		log.Fatalf("[ERROR] reading cert source: %s", err)
+	}
+	ctx := commandContext(cmd)
+	sdkClient := initGenClient()
+	for _, thumbprint := range missing {
+		cert, ok := available[thumbprint]
+		switch {
+		case !ok:
+			printWarning("Certificate %s is not in Keyfactor or %s, it can't be audited.\n", thumbprint, source)
+		case dryRun:
+			printAdded("[DRY RUN] Would upload %s (%s)\n", cert.Subject.String(), thumbprint)
+		default:
+			if importCertificate(ctx, sdkClient, cert) != nil {
+				continue
+			}
+			uploaded[thumbprint] = true
+			printAdded("[UPLOADED] %s (%s)\n", cert.Subject.String(), thumbprint)
+		}
+	}
+	return uploaded
+}
@@ -0,0 +1,111 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"every minute", "* * * * *", false},
+		{"macro", "@daily", false},
+		{"macro case", "@Hourly", false},
+		{"ranges steps and lists", "*/15 8-18 1,15 * 1-5", false},
+		{"sunday as 7", "0 0 * * 7", false},
+		{"empty", "", true},
+		{"too few fields", "* * * *", true},
+		{"too many fields", "* * * * * *", true},
+		{"minute out of range", "60 * * * *", true},
+		{"hour out of range", "0 24 * * *", true},
+		{"day of month zero", "0 0 0 * *", true},
+		{"month out of range", "0 0 1 13 *", true},
+		{"day of week out of range", "0 0 * * 8", true},
+		{"zero step", "*/0 * * * *", true},
+		{"reversed range", "5-1 * * * *", true},
+		{"not a number", "a * * * *", true},
+		{"unknown macro", "@fortnightly", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCronSchedule(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCronSchedule(%q) error = %v, wantErr %t", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	// 2023-01-02 is a Monday.
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", date(2023, 1, 2, 10, 0).Add(30 * time.Second), date(2023, 1, 2, 10, 1)},
+		{"hourly", "@hourly", date(2023, 1, 2, 10, 0), date(2023, 1, 2, 11, 0)},
+		{"daily", "@daily", date(2023, 1, 2, 10, 0), date(2023, 1, 3, 0, 0)},
+		{"minute step", "*/15 * * * *", date(2023, 1, 2, 10, 1), date(2023, 1, 2, 10, 15)},
+		{"step from a value", "5/15 * * * *", date(2023, 1, 2, 10, 21), date(2023, 1, 2, 10, 35)},
+		{"weekdays", "0 9 * * 1-5", date(2023, 1, 6, 10, 0), date(2023, 1, 9, 9, 0)},
+		{"sunday as 7", "0 0 * * 7", date(2023, 1, 2, 0, 0), date(2023, 1, 8, 0, 0)},
+		{"month rollover", "0 0 1 * *", date(2023, 1, 15, 0, 0), date(2023, 2, 1, 0, 0)},
+		{"year rollover", "@yearly", date(2023, 6, 1, 0, 0), date(2024, 1, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", date(2023, 1, 1, 0, 0), date(2024, 2, 29, 0, 0)},
+		{"day of month or week by week", "0 0 13 * 5", date(2023, 3, 6, 0, 0), date(2023, 3, 10, 0, 0)},
+		{"day of month or week by month", "0 0 13 * 5", date(2023, 3, 11, 0, 0), date(2023, 3, 13, 0, 0)},
+		{"stepped day of month is unrestricted", "0 0 */2 * 1", date(2023, 1, 2, 0, 0), date(2023, 1, 9, 0, 0)},
+		{"stepped day of week is unrestricted", "0 0 13 * */2", date(2023, 1, 2, 0, 0), date(2023, 1, 13, 0, 0)},
+		{"never", "0 0 30 2 *", date(2023, 1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCronSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q) error = %v", tt.expr, err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissedRuns(t *testing.T) {
+	s, err := parseCronSchedule("*/15 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &kfutilDaemon{schedule: s}
+	start := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{"finished before the next run", start.Add(10 * time.Minute), 0},
+		{"finished at the next run", start.Add(15 * time.Minute), 0},
+		{"overran three runs", start.Add(50 * time.Minute), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.missedRuns(start, tt.now); got != tt.want {
+				t.Errorf("missedRuns() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
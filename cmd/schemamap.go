@@ -0,0 +1,106 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaMap maps the normalized header names of foreign input files to kfutil columns, loaded from --schema-map. It
+// takes precedence over the built-in columnAliases.
+var schemaMap map[string]string
+
+// schemaMapFile is the --schema-map file, e.g.
+//
+//	columns:
+//	  Fingerprint: Thumbprint
+//	  Host: StoreMachine
+type schemaMapFile struct {
+	Columns map[string]string `yaml:"columns"`
+}
+
+// knownInputColumns returns the columns of the input files kfutil reads.
+func knownInputColumns() []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, header := range [][]string{StoreHeader, CertHeader, AuditHeader, certInputColumns, normalizeHeader} {
+		for _, c := range header {
+			if !seen[c] {
+				seen[c] = true
+				columns = append(columns, c)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// parseSchemaMap parses a schema map file. Every target must be a kfutil column, matched like a header name.
+func parseSchemaMap(data []byte) (map[string]string, error) {
+	var f schemaMapFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	known := knownInputColumns()
+	mapping := make(map[string]string, len(f.Columns))
+	for header, target := range f.Columns {
+		column, ok := matchColumn(target, known)
+		if !ok {
+			return nil, fmt.Errorf("'%s' maps '%s' to an unknown column, must be one of %s", target, header, strings.Join(known, ", "))
+		}
+		mapping[normalizeColumnName(header)] = column
+	}
+	return mapping, nil
+}
+
+// loadSchemaMap loads the --schema-map file of cmd into schemaMap.
+func loadSchemaMap(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("schema-map")
+	if path == "" {
+		return nil
+	}
+	data, err := readInput(path)
+	if err != nil {
+		return fmt.Errorf("reading schema map: %s", err)
+	}
+	mapping, err := parseSchemaMap(data)
+	if err != nil {
+		return fmt.Errorf("invalid schema map %s: %s", path, err)
+	}
+	schemaMap = mapping
+	log.Printf("[INFO] using %d column mapping(s) of %s", len(mapping), path)
+	return nil
+}
+
+// schemaMapColumn returns the column of columns a header cell is mapped to by the schema map.
+func schemaMapColumn(header string, columns []string) (string, bool) {
+	target, ok := schemaMap[normalizeColumnName(header)]
+	if !ok {
+		return "", false
+	}
+	// The target can be a column of another kfutil file, e.g. StoreMachine for the Machine column of audit reports.
+	for _, c := range columns {
+		if c == target || normalizeColumnName(target) == normalizeColumnName(c) {
+			return c, true
+		}
+		for _, alias := range columnAliases[c] {
+			if alias == normalizeColumnName(target) {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
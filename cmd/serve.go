@@ -0,0 +1,379 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kfutil/pkg/rot"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultServeAddr = "127.0.0.1:8080"
+	// serveMaxBody is the largest request body accepted by kfutil serve.
+	serveMaxBody = 1 << 20
+	// serveShutdownTimeout is how long kfutil serve waits for requests in progress when it is stopped.
+	serveShutdownTimeout = 30 * time.Second
+)
+
+// serveAuditRequest is the body of POST /v1/audit and POST /v1/reconcile.
+type serveAuditRequest struct {
+	StoreIDs    []string `json:"store_ids"`
+	AddCerts    []string `json:"add_certs"`
+	RemoveCerts []string `json:"remove_certs"`
+	MinCerts    *int     `json:"min_certs,omitempty"`
+	MaxKeys     *int     `json:"max_keys,omitempty"`
+	MaxLeaves   *int     `json:"max_leaf_certs,omitempty"`
+	DryRun      bool     `json:"dry_run,omitempty"`
+}
+
+// serveAuditEntry is an audit report row in a response.
+type serveAuditEntry struct {
+	Thumbprint string `json:"thumbprint"`
+	CertID     int    `json:"cert_id"`
+	SubjectDN  string `json:"subject_dn"`
+	IssuerDN   string `json:"issuer_dn"`
+	StoreID    string `json:"store_id"`
+	StoreType  string `json:"store_type"`
+	Machine    string `json:"machine"`
+	Path       string `json:"path"`
+	Add        bool   `json:"add"`
+	Remove     bool   `json:"remove"`
+	Deployed   bool   `json:"deployed"`
+	Alias      string `json:"alias,omitempty"`
+}
+
+// serveActionResult is the outcome of a reconcile action in a response.
+type serveActionResult struct {
+	ROTAction
+	Error string `json:"error,omitempty"`
+}
+
+type serveAuditResponse struct {
+	Entries        []serveAuditEntry   `json:"entries"`
+	Actions        []ROTAction         `json:"actions"`
+	SkippedStores  map[string]string   `json:"skipped_stores,omitempty"`
+	LookupErrors   map[string]string   `json:"lookup_errors,omitempty"`
+	DryRun         bool                `json:"dry_run,omitempty"`
+	Results        []serveActionResult `json:"results,omitempty"`
+	Succeeded      int                 `json:"succeeded,omitempty"`
+	Failed         int                 `json:"failed,omitempty"`
+	ReconciledTime string              `json:"reconciled_at,omitempty"`
+}
+
+type serveInventoryResponse struct {
+	Store        StoreCSVEntry `json:"store"`
+	Certificates []serveCert   `json:"certificates"`
+}
+
+type serveCert struct {
+	Thumbprint string `json:"thumbprint"`
+	SubjectDN  string `json:"subject_dn"`
+	IssuerDN   string `json:"issuer_dn"`
+	Alias      string `json:"alias,omitempty"`
+}
+
+type serveError struct {
+	Error string `json:"error"`
+}
+
+// rotServer serves the root of trust operations over HTTP. Reconciles are run one at a time.
+type rotServer struct {
+	client   rot.API
+	apiKey   string
+	readOnly bool
+	reconcMu sync.Mutex
+}
+
+func (s *rotServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/health", s.handleHealth)
+	mux.HandleFunc("/v1/stores/", s.authenticated(s.handleInventory))
+	mux.HandleFunc("/v1/audit", s.authenticated(s.handleAudit))
+	mux.HandleFunc("/v1/reconcile", s.authenticated(s.handleReconcile))
+	return mux
+}
+
+// authenticated requires the API key in an `Authorization: Bearer` or `X-API-Key` header.
+func (s *rotServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) != 1 {
+			writeServeJSON(w, http.StatusUnauthorized, serveError{Error: "missing or invalid API key"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("[ERROR] writing response: %s", err)
+	}
+}
+
+func (s *rotServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeServeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleInventory serves GET /v1/stores/{id}/inventory.
+func (s *rotServer) handleInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeServeJSON(w, http.StatusMethodNotAllowed, serveError{Error: "method not allowed"})
+		return
+	}
+	storeID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/stores/"), "/inventory")
+	if storeID == "" || strings.Contains(storeID, "/") || !strings.HasSuffix(r.URL.Path, "/inventory") {
+		writeServeJSON(w, http.StatusNotFound, serveError{Error: "not found"})
+		return
+	}
+	store, inventory, err := rot.LoadStore(r.Context(), s.client, rot.Store{ID: storeID})
+	if err != nil {
+		writeServeJSON(w, http.StatusBadGateway, serveError{Error: err.Error()})
+		return
+	}
+	resp := serveInventoryResponse{Store: *store, Certificates: []serveCert{}}
+	for _, inv := range inventory {
+		for _, c := range inv.Certificates {
+			resp.Certificates = append(resp.Certificates, serveCert{
+				Thumbprint: c.Thumbprint,
+				SubjectDN:  c.IssuedDN,
+				IssuerDN:   c.IssuerDN,
+				Alias:      inv.Name,
+			})
+		}
+	}
+	writeServeJSON(w, http.StatusOK, resp)
+}
+
+// readAuditRequest decodes and validates the body of an audit or reconcile request.
+func readAuditRequest(w http.ResponseWriter, r *http.Request) (*serveAuditRequest, bool) {
+	if r.Method != http.MethodPost {
+		writeServeJSON(w, http.StatusMethodNotAllowed, serveError{Error: "method not allowed"})
+		return nil, false
+	}
+	var req serveAuditRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, serveMaxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeServeJSON(w, http.StatusBadRequest, serveError{Error: fmt.Sprintf("invalid request body: %s", err)})
+		return nil, false
+	}
+	if len(req.StoreIDs) == 0 {
+		writeServeJSON(w, http.StatusBadRequest, serveError{Error: "store_ids is required"})
+		return nil, false
+	}
+	if len(req.AddCerts)+len(req.RemoveCerts) == 0 {
+		writeServeJSON(w, http.StatusBadRequest, serveError{Error: "add_certs or remove_certs is required"})
+		return nil, false
+	}
+	return &req, true
+}
+
+// audit loads the requested stores and audits them. Stores that cannot be loaded or are not root stores are skipped.
+func (s *rotServer) audit(ctx context.Context, req *serveAuditRequest) (*rot.AuditResult, *serveAuditResponse, error) {
+	criteria := rot.NoRootStoreCriteria
+	if req.MinCerts != nil {
+		criteria.MinCerts = *req.MinCerts
+	}
+	if req.MaxKeys != nil {
+		criteria.MaxKeys = *req.MaxKeys
+	}
+	if req.MaxLeaves != nil {
+		criteria.MaxLeaves = *req.MaxLeaves
+	}
+	resp := &serveAuditResponse{
+		Entries:       []serveAuditEntry{},
+		Actions:       []ROTAction{},
+		SkippedStores: make(map[string]string),
+		LookupErrors:  make(map[string]string),
+	}
+	stores := make(map[string]StoreCSVEntry)
+	for _, id := range req.StoreIDs {
+		store, inventory, err := rot.LoadStore(ctx, s.client, rot.Store{ID: id})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			resp.SkippedStores[id] = err.Error()
+			continue
+		}
+		if !rot.IsRootStore(inventory, criteria) {
+			resp.SkippedStores[id] = "not a root store"
+			continue
+		}
+		stores[id] = *store
+	}
+	result, err := rot.Audit(ctx, s.client, rot.AuditRequest{AddCerts: req.AddCerts, RemoveCerts: req.RemoveCerts, Stores: stores})
+	if err != nil {
+		return nil, nil, err
+	}
+	for thumbprint, lErr := range result.LookupErrors {
+		resp.LookupErrors[thumbprint] = lErr.Error()
+	}
+	for _, e := range result.Entries {
+		resp.Entries = append(resp.Entries, serveAuditEntry{
+			Thumbprint: e.Thumbprint,
+			CertID:     e.CertID,
+			SubjectDN:  e.SubjectDN,
+			IssuerDN:   e.IssuerDN,
+			StoreID:    e.Store.ID,
+			StoreType:  e.Store.Type,
+			Machine:    e.Store.Machine,
+			Path:       e.Store.Path,
+			Add:        e.Add,
+			Remove:     e.Remove,
+			Deployed:   e.Deployed,
+			Alias:      e.Alias,
+		})
+	}
+	resp.Actions = append(resp.Actions, result.ActionList()...)
+	return result, resp, nil
+}
+
+// handleAudit serves POST /v1/audit.
+func (s *rotServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	req, ok := readAuditRequest(w, r)
+	if !ok {
+		return
+	}
+	_, resp, err := s.audit(r.Context(), req)
+	if err != nil {
+		writeServeJSON(w, http.StatusBadGateway, serveError{Error: err.Error()})
+		return
+	}
+	writeServeJSON(w, http.StatusOK, resp)
+}
+
+// handleReconcile serves POST /v1/reconcile, an audit followed by applying its actions.
+func (s *rotServer) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	req, ok := readAuditRequest(w, r)
+	if !ok {
+		return
+	}
+	if s.readOnly {
+		req.DryRun = true
+	}
+	// Reconciles of overlapping stores would race each other's audits.
+	s.reconcMu.Lock()
+	defer s.reconcMu.Unlock()
+	result, resp, err := s.audit(r.Context(), req)
+	if err != nil {
+		writeServeJSON(w, http.StatusBadGateway, serveError{Error: err.Error()})
+		return
+	}
+	outcome := rot.Reconcile(r.Context(), s.client, result.ActionList(), rot.ReconcileOptions{DryRun: req.DryRun})
+	resp.DryRun = req.DryRun
+	resp.Succeeded = outcome.Succeeded
+	resp.Failed = outcome.Failed
+	resp.ReconciledTime = GetCurrentTime()
+	for _, ar := range outcome.Results {
+		res := serveActionResult{ROTAction: ar.Action}
+		if ar.Err != nil {
+			res.Error = ar.Err.Error()
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	log.Printf("[INFO] reconcile of %d store(s): %d action(s) succeeded, %d failed, dry run %t",
+		len(req.StoreIDs), outcome.Succeeded, outcome.Failed, req.DryRun)
+	writeServeJSON(w, http.StatusOK, resp)
+}
+
+// serveAPIKeyEnv is the environment variable of the API key of serve when --api-key-file is not given.
+const serveAPIKeyEnv = "KFUTIL_API_KEY"
+
+// serveAPIKey returns the API key from the file of --api-key-file, or else from serveAPIKeyEnv.
+func serveAPIKey(cmd *cobra.Command) (string, error) {
+	path, _ := cmd.Flags().GetString("api-key-file")
+	if path == "" {
+		return strings.TrimSpace(os.Getenv(serveAPIKeyEnv)), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading --api-key-file: %s", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve root of trust audits, reconciles and store inventories over a local REST API.",
+	Long: `Runs kfutil as a small REST service so portals and other tools can automate root of trust management
+without embedding kfutil. Requests are authenticated with the API key read from the file given by --api-key-file or
+from the KFUTIL_API_KEY environment variable, sent as 'Authorization: Bearer <key>' or 'X-API-Key: <key>'. The key is
+not accepted on the command line, where other users could read it from the process list.
+
+Endpoints:
+  GET  /v1/health                    Liveness check, not authenticated.
+  GET  /v1/stores/{id}/inventory     Store details and the certificates in its inventory.
+  POST /v1/audit                     Audit stores, e.g. {"store_ids": ["..."], "add_certs": ["<thumbprint>"]}.
+  POST /v1/reconcile                 Audit stores and apply the actions. Set "dry_run": true to only audit.
+
+Audit and reconcile requests accept "remove_certs", "min_certs", "max_keys" and "max_leaf_certs" like the
+'stores rot' commands. In read-only mode reconcile requests are always dry runs. gRPC is not supported.`,
+	Example: `KFUTIL_API_KEY=$(openssl rand -hex 32) kfutil serve --addr 127.0.0.1:8080
+kfutil serve --api-key-file /etc/kfutil/api-key`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		addr, _ := cmd.Flags().GetString("addr")
+		apiKey, kErr := serveAPIKey(cmd)
+		if kErr != nil {
+			fmt.Printf("[ERROR] %s\n", kErr)
+			log.Fatalf("[ERROR] reading the API key: %s", kErr)
+		}
+		if apiKey == "" {
+			fmt.Printf("[ERROR] --api-key-file or %s is required\n", serveAPIKeyEnv)
+			log.Fatalf("[ERROR] serve started without an API key")
+		}
+		registerSecret(apiKey)
+		kfClient, _ := initClient()
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           (&rotServer{client: kfClient, apiKey: apiKey, readOnly: readOnly}).handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			BaseContext:       func(_ net.Listener) context.Context { return commandContext(cmd) },
+		}
+		go func() {
+			<-commandContext(cmd).Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+		printInfo("Serving on http://%s\n", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("[ERROR] serving on %s: %s\n", addr, err)
+			log.Fatalf("[ERROR] serving: %s", err)
+		}
+		printInfo("Server stopped.\n")
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("addr", defaultServeAddr, "Address to listen on. Listens on localhost only by default.")
+	serveCmd.Flags().String("api-key-file", "", "File holding the API key clients must send. Defaults to the "+serveAPIKeyEnv+" environment variable.")
+	RootCmd.AddCommand(serveCmd)
+}
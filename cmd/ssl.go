@@ -0,0 +1,357 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+var SslResultHeader = []string{"EndpointId", "NetworkName", "IpAddress", "Port", "SNIName", "ReverseDNS", "CertificateFound", "CertificateCN", "Thumbprint", "NotAfter", "DaysUntilExpiration", "Reviewed"}
+
+type sslScanResult struct {
+	EndpointId          string `json:"endpoint_id"`
+	NetworkName         string `json:"network_name"`
+	IpAddress           string `json:"ip_address"`
+	Port                int32  `json:"port"`
+	SNIName             string `json:"sni_name,omitempty"`
+	ReverseDNS          string `json:"reverse_dns,omitempty"`
+	CertificateFound    bool   `json:"certificate_found"`
+	CertificateCN       string `json:"certificate_cn,omitempty"`
+	Thumbprint          string `json:"thumbprint,omitempty"`
+	NotAfter            string `json:"not_after,omitempty"`
+	DaysUntilExpiration *int   `json:"days_until_expiration,omitempty"`
+	Reviewed            bool   `json:"reviewed"`
+}
+
+func (r sslScanResult) toCSV() []string {
+	days := ""
+	if r.DaysUntilExpiration != nil {
+		days = strconv.Itoa(*r.DaysUntilExpiration)
+	}
+	return []string{
+		r.EndpointId, r.NetworkName, r.IpAddress, strconv.Itoa(int(r.Port)), r.SNIName, r.ReverseDNS,
+		strconv.FormatBool(r.CertificateFound), r.CertificateCN, r.Thumbprint, r.NotAfter, days, strconv.FormatBool(r.Reviewed),
+	}
+}
+
+var sslCmd = &cobra.Command{
+	Use:   "ssl",
+	Short: "Keyfactor SSL discovery APIs and utilities.",
+	Long:  `A collections of APIs and utilities for managing Keyfactor SSL discovery networks and retrieving scan results.`,
+}
+
+var sslNetworksCmd = &cobra.Command{
+	Use:   "networks",
+	Short: "Keyfactor SSL discovery network APIs.",
+	Long:  `A collections of APIs for managing Keyfactor SSL discovery networks.`,
+}
+
+var sslNetworksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List SSL discovery networks.",
+	Long:  `List SSL discovery networks.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		sdkClient := initGenClient()
+		networks, httpResponse, errors := sdkClient.SslApi.SslGetNetworks(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Execute()
+		if errors != nil {
+			WriteApiError("List SSL networks", httpResponse, errors)
+			return
+		}
+		jsonString, marshallError := json.Marshal(networks)
+		if marshallError != nil {
+			log.Printf("%sError: %s", colorRed, marshallError)
+		}
+		fmt.Printf("%s", jsonString)
+	},
+}
+
+var sslNetworksCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an SSL discovery network.",
+	Long: `Create an SSL discovery network either from a JSON file or from flags. If --ranges is specified the network
+ranges (IPs, CIDRs or hostnames) are added to the network after it is created.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		configFile, _ := cmd.Flags().GetString("from-file")
+		name, _ := cmd.Flags().GetString("name")
+		agentPool, _ := cmd.Flags().GetString("agent-pool")
+		description, _ := cmd.Flags().GetString("description")
+		ranges, _ := cmd.Flags().GetStringSlice("ranges")
+		sdkClient := initGenClient()
+
+		var networkReq keyfactor.KeyfactorApiModelsSslCreateNetworkRequest
+		if configFile != "" {
+			fileBytes, fErr := os.ReadFile(configFile)
+			if fErr != nil {
+				fmt.Printf("Error reading from file %s: %s\n", configFile, fErr)
+				log.Fatalf("[ERROR]: %s", fErr)
+			}
+			jErr := json.Unmarshal(fileBytes, &networkReq)
+			if jErr != nil {
+				fmt.Printf("Error reading from file %s: %s\n", configFile, jErr)
+				log.Fatalf("[ERROR]: %s", jErr)
+			}
+		}
+		if name != "" {
+			networkReq.Name = name
+		}
+		if agentPool != "" {
+			networkReq.AgentPoolName = agentPool
+		}
+		if description != "" {
+			networkReq.Description = description
+		}
+		if networkReq.Name == "" || networkReq.AgentPoolName == "" {
+			fmt.Println("Error: a network name and agent pool name are required.")
+			log.Fatalf("[ERROR] missing network name or agent pool name")
+		}
+		if networkReq.Description == "" {
+			networkReq.Description = networkReq.Name
+		}
+
+		network, httpResponse, errors := sdkClient.SslApi.SslCreateNetwork(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Network(networkReq).
+			Execute()
+		if errors != nil {
+			WriteApiError("Create SSL network", httpResponse, errors)
+			return
+		}
+
+		if len(ranges) > 0 {
+			rangesReq := keyfactor.ModelsSSLNetworkRangesRequest{
+				NetworkId: network.GetNetworkId(),
+				Ranges:    ranges,
+			}
+			httpResponse, errors = sdkClient.SslApi.SslAddNetworkRanges(context.Background()).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				NetworkRanges(rangesReq).
+				Execute()
+			if errors != nil {
+				WriteApiError("Add SSL network ranges", httpResponse, errors)
+			}
+		}
+
+		jsonString, marshallError := json.Marshal(network)
+		if marshallError != nil {
+			log.Printf("%sError: %s", colorRed, marshallError)
+		}
+		fmt.Printf("%s", jsonString)
+	},
+}
+
+var sslScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Schedule an SSL discovery and/or monitoring scan of a network.",
+	Long:  `Schedule an SSL discovery and/or monitoring scan of a network. Use --now to start the scan immediately.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		networkID, _ := cmd.Flags().GetString("network")
+		now, _ := cmd.Flags().GetBool("now")
+		discovery, _ := cmd.Flags().GetBool("discovery")
+		monitoring, _ := cmd.Flags().GetBool("monitoring")
+
+		if !now {
+			fmt.Println("Scans are scheduled by the network's discovery and monitor schedules. Use --now to start a scan immediately.")
+			return
+		}
+		if !discovery && !monitoring {
+			fmt.Println("Error: at least one of --discovery or --monitoring must be enabled.")
+			return
+		}
+		sdkClient := initGenClient()
+		scanReq := keyfactor.ModelsSSLImmediateSslScanRequest{
+			Discovery:  discovery,
+			Monitoring: monitoring,
+		}
+		httpResponse, errors := sdkClient.SslApi.SslImmediateSslScan(context.Background(), networkID).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			SslScanRequest(scanReq).
+			Execute()
+		if errors != nil {
+			WriteApiError("Start SSL scan", httpResponse, errors)
+			return
+		}
+		fmt.Printf("SSL scan started for network %s.\n", networkID)
+	},
+}
+
+var sslResultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "Get SSL scan results for a network.",
+	Long: `Get the SSL scan results for a network including the endpoints scanned, certificates found and their
+expiration dates. Results are written as JSON or CSV to stdout or to --outpath.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		networkID, _ := cmd.Flags().GetString("network")
+		format, _ := cmd.Flags().GetString("format")
+		outpath, _ := cmd.Flags().GetString("outpath")
+		sdkClient := initGenClient()
+
+		network, httpResponse, errors := sdkClient.SslApi.SslGetNetwork(context.Background(), networkID).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Execute()
+		if errors != nil {
+			WriteApiError("Get SSL network", httpResponse, errors)
+			return
+		}
+
+		results, rErr := getSslResults(sdkClient, network.GetName())
+		if rErr != nil {
+			fmt.Printf("Error, unable to get SSL scan results for network %s. %s\n", networkID, rErr)
+			log.Fatalf("[ERROR]: %s", rErr)
+		}
+
+		var out io.WriteCloser = nopWriteCloser{os.Stdout}
+		if outpath != "" {
+			f, fErr := createOutput(outpath)
+			if fErr != nil {
+				fmt.Printf("Error creating file %s: %s\n", outpath, fErr)
+				log.Fatalf("[ERROR]: %s", fErr)
+			}
+			out = f
+		}
+
+		switch format {
+		case "csv":
+			writer := csv.NewWriter(out)
+			data := [][]string{SslResultHeader}
+			for _, r := range results {
+				data = append(data, r.toCSV())
+			}
+			csvErr := writer.WriteAll(data)
+			if csvErr != nil {
+				fmt.Println(csvErr)
+			}
+		default:
+			jsonString, marshallError := json.Marshal(results)
+			if marshallError != nil {
+				log.Printf("%sError: %s", colorRed, marshallError)
+			}
+			fmt.Fprintf(out, "%s", jsonString)
+		}
+		if cErr := out.Close(); cErr != nil {
+			fmt.Printf("Error writing file %s: %s\n", outpath, cErr)
+			log.Fatalf("[ERROR]: %s", cErr)
+		}
+		if outpath != "" {
+			fmt.Printf("SSL scan results written to %s\n", outpath)
+		}
+	},
+}
+
+// getSslResults returns the scan results for the named network along with the most recently observed certificate
+// for each endpoint where a certificate was found.
+func getSslResults(sdkClient *keyfactor.APIClient, networkName string) ([]sslScanResult, error) {
+	var rawResults []keyfactor.ModelsSSLSslScanResult
+	_, _, _, err := fetchPages(listPaging{All: true}, func(page int32, size int32) (int, error) {
+		pageResults, _, pErr := sdkClient.SslApi.SslResults(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqQueryString(fmt.Sprintf("NetworkName -eq \"%s\"", networkName)).
+			PqPageReturned(page).PqReturnLimit(size).
+			Execute()
+		rawResults = append(rawResults, pageResults...)
+		return len(pageResults), pErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []sslScanResult
+	for _, r := range rawResults {
+		if !strings.EqualFold(r.GetNetworkName(), networkName) {
+			continue
+		}
+		result := sslScanResult{
+			EndpointId:       r.GetEndpointId(),
+			NetworkName:      r.GetNetworkName(),
+			IpAddress:        r.GetIpAddress(),
+			Port:             r.GetPort(),
+			SNIName:          r.GetSNIName(),
+			ReverseDNS:       r.GetReverseDNS(),
+			CertificateFound: r.GetCertificateFound(),
+			CertificateCN:    r.GetCertificateCN(),
+			Reviewed:         r.GetReviewed(),
+		}
+		if result.CertificateFound {
+			history, _, hErr := sdkClient.SslApi.SslEndpointHistory(context.Background(), result.EndpointId).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				PqSortField("Timestamp").PqSortAscending(1).PqReturnLimit(1).
+				Execute()
+			if hErr != nil {
+				log.Printf("[ERROR] getting history for endpoint %s: %s", result.EndpointId, hErr)
+			} else if len(history) > 0 && len(history[0].HistoryCertificates) > 0 {
+				cert := history[0].HistoryCertificates[0]
+				result.Thumbprint = cert.GetThumbprint()
+				if cert.NotAfter != nil {
+					result.NotAfter = cert.NotAfter.Format(time.RFC3339)
+					days := int(time.Until(*cert.NotAfter).Hours() / 24)
+					result.DaysUntilExpiration = &days
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func init() {
+	var (
+		filePath    string
+		name        string
+		agentPool   string
+		description string
+		ranges      []string
+		networkID   string
+		now         bool
+		discovery   bool
+		monitoring  bool
+		format      string
+		outpath     string
+	)
+	RootCmd.AddCommand(sslCmd)
+
+	// SSL networks commands
+	sslCmd.AddCommand(sslNetworksCmd)
+	sslNetworksCmd.AddCommand(sslNetworksListCmd)
+	sslNetworksCmd.AddCommand(sslNetworksCreateCmd)
+	sslNetworksCreateCmd.Flags().StringVarP(&filePath, "from-file", "f", "", "Path to a JSON file containing the SSL network definition.")
+	sslNetworksCreateCmd.Flags().StringVarP(&name, "name", "n", "", "Name of the SSL network.")
+	sslNetworksCreateCmd.Flags().StringVarP(&agentPool, "agent-pool", "p", "", "Name of the agent pool that will scan the network.")
+	sslNetworksCreateCmd.Flags().StringVarP(&description, "description", "d", "", "Description of the SSL network.")
+	sslNetworksCreateCmd.Flags().StringSliceVarP(&ranges, "ranges", "r", []string{}, "Network ranges (IPs, CIDRs or hostnames) to add to the network.")
+
+	// SSL scan command
+	sslCmd.AddCommand(sslScanCmd)
+	sslScanCmd.Flags().StringVarP(&networkID, "network", "n", "", "ID of the SSL network to scan.")
+	sslScanCmd.MarkFlagRequired("network")
+	sslScanCmd.Flags().BoolVar(&now, "now", false, "Start the scan immediately.")
+	sslScanCmd.Flags().BoolVar(&discovery, "discovery", true, "Run a discovery scan.")
+	sslScanCmd.Flags().BoolVar(&monitoring, "monitoring", false, "Run a monitoring scan.")
+
+	// SSL results command
+	sslCmd.AddCommand(sslResultsCmd)
+	sslResultsCmd.Flags().StringVarP(&networkID, "network", "n", "", "ID of the SSL network to get results for.")
+	sslResultsCmd.MarkFlagRequired("network")
+	sslResultsCmd.Flags().StringVarP(&format, "format", "f", "json", "Output format, either `json` or `csv`.")
+	sslResultsCmd.Flags().StringVarP(&outpath, "outpath", "o", "", "Path to write the results to. If not specified, results are written to stdout."+
+		" Also accepts s3://, az:// and gs:// URLs to upload to.")
+}
@@ -7,42 +7,227 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
 	"github.com/spf13/cobra"
 )
 
+// Orchestrator (agent) status codes as returned by the Keyfactor API.
+const (
+	agentStatusNew         = 1
+	agentStatusApproved    = 2
+	agentStatusDisapproved = 3
+)
+
+type instanceStatus struct {
+	Hostname          string         `json:"hostname"`
+	Reachable         bool           `json:"reachable"`
+	EndpointCount     int            `json:"endpoint_count"`
+	Identity          string         `json:"identity,omitempty"`
+	Roles             []string       `json:"roles,omitempty"`
+	Version           string         `json:"version,omitempty"`
+	LicenseID         string         `json:"license_id,omitempty"`
+	LicenseExpiration string         `json:"license_expiration,omitempty"`
+	LicenseExpired    bool           `json:"license_expired"`
+	Orchestrators     map[string]int `json:"orchestrators"`
+	ScheduledJobs     int            `json:"scheduled_jobs"`
+	PendingJobs       int            `json:"pending_jobs"`
+	Errors            []string       `json:"errors,omitempty"`
+	CheckedAt         string         `json:"checked_at"`
+}
+
+func agentStatusName(status int) string {
+	switch status {
+	case agentStatusNew:
+		return "new"
+	case agentStatusApproved:
+		return "approved"
+	case agentStatusDisapproved:
+		return "disapproved"
+	default:
+		return "unknown"
+	}
+}
+
+func getInstanceStatus() instanceStatus {
+	sdkClient := initGenClient()
+	status := instanceStatus{
+		Hostname:      os.Getenv("KEYFACTOR_HOSTNAME"),
+		Orchestrators: make(map[string]int),
+		CheckedAt:     GetCurrentTime(),
+	}
+
+	endpoints, _, eErr := sdkClient.StatusApi.StatusGetEndpoints(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if eErr != nil {
+		log.Printf("[ERROR] getting status endpoints: %s", eErr)
+		status.Errors = append(status.Errors, fmt.Sprintf("api: %s", eErr))
+		return status
+	}
+	status.Reachable = true
+	status.EndpointCount = len(endpoints)
+
+	license, _, lErr := sdkClient.LicenseApi.LicenseGetCurrentLicense(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if lErr != nil {
+		log.Printf("[ERROR] getting license: %s", lErr)
+		status.Errors = append(status.Errors, fmt.Sprintf("license: %s", lErr))
+	} else {
+		if license.KeyfactorVersion != nil {
+			status.Version = *license.KeyfactorVersion
+		}
+		if license.LicenseData != nil {
+			if license.LicenseData.LicenseId != nil {
+				status.LicenseID = *license.LicenseData.LicenseId
+			}
+			if license.LicenseData.ExpirationDate != nil {
+				status.LicenseExpiration = license.LicenseData.ExpirationDate.Format(time.RFC3339)
+				status.LicenseExpired = license.LicenseData.ExpirationDate.Before(time.Now())
+			}
+		}
+	}
+
+	kfClient, _ := initClient()
+	username := os.Getenv("KEYFACTOR_USERNAME")
+	identity, iErr := findSecurityIdentity(kfClient, username)
+	if iErr != nil {
+		log.Printf("[ERROR] getting security identities: %s", iErr)
+		status.Errors = append(status.Errors, fmt.Sprintf("identity: %s", iErr))
+	} else if identity != nil {
+		status.Identity = identity.AccountName
+		for _, role := range identity.Roles {
+			status.Roles = append(status.Roles, role.Name)
+		}
+	} else {
+		status.Identity = username
+	}
+
+	agents, aErr := kfClient.GetAgentList()
+	if aErr != nil {
+		log.Printf("[ERROR] getting orchestrators: %s", aErr)
+		status.Errors = append(status.Errors, fmt.Sprintf("orchestrators: %s", aErr))
+	} else {
+		for _, agent := range agents {
+			status.Orchestrators[agentStatusName(agent.Status)]++
+		}
+	}
+
+	// The API has no job count or job state filter, so the scheduled jobs are counted page by page.
+	now := time.Now()
+	_, jobCount, _, jErr := fetchPages(listPaging{All: true}, func(page int32, size int32) (int, error) {
+		jobs, _, err := sdkClient.OrchestratorJobApi.OrchestratorJobGetScheduledJobs(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			PqPageReturned(page).PqReturnLimit(size).Execute()
+		for _, job := range jobs {
+			if isPendingJob(job, now) {
+				status.PendingJobs++
+			}
+		}
+		return len(jobs), err
+	})
+	if jErr != nil {
+		log.Printf("[ERROR] getting scheduled jobs: %s", jErr)
+		status.Errors = append(status.Errors, fmt.Sprintf("jobs: %s", jErr))
+		status.PendingJobs = 0
+	} else {
+		status.ScheduledJobs = jobCount
+	}
+	return status
+}
+
+// isPendingJob reports whether job is part of the backlog at now: a one-off job, immediate or scheduled exactly once,
+// that is due but still waiting in the job queue. Recurring jobs, such as inventory jobs, stay scheduled between runs
+// and are not counted.
+func isPendingJob(job keyfactor.ModelsOrchestratorJobsJob, now time.Time) bool {
+	if job.Schedule == nil {
+		return false
+	}
+	if job.Schedule.GetImmediate() {
+		return true
+	}
+	once, ok := job.Schedule.GetExactlyOnceOk()
+	return ok && once.Time != nil && !once.Time.After(now)
+}
+
+func printInstanceStatus(status instanceStatus) {
+	reachable := "unreachable"
+	if status.Reachable {
+		reachable = fmt.Sprintf("reachable (%d endpoints)", status.EndpointCount)
+	}
+	fmt.Printf("Keyfactor Command: %s\n", status.Hostname)
+	fmt.Printf("  API:            %s\n", reachable)
+	if !status.Reachable {
+		for _, e := range status.Errors {
+			fmt.Printf("  Error:          %s\n", e)
+		}
+		return
+	}
+	fmt.Printf("  Version:        %s\n", status.Version)
+	fmt.Printf("  Identity:       %s\n", status.Identity)
+	fmt.Printf("  Roles:          %s\n", strings.Join(status.Roles, ", "))
+	license := status.LicenseID
+	if status.LicenseExpiration != "" {
+		license = fmt.Sprintf("%s (expires %s)", license, status.LicenseExpiration)
+	}
+	if status.LicenseExpired {
+		license = fmt.Sprintf("%s%s EXPIRED%s", license, colorRed, colorWhite)
+	}
+	fmt.Printf("  License:        %s\n", license)
+	fmt.Printf("  Orchestrators:  %d approved, %d new, %d disapproved\n",
+		status.Orchestrators["approved"], status.Orchestrators["new"], status.Orchestrators["disapproved"])
+	fmt.Printf("  Scheduled jobs: %d\n", status.ScheduledJobs)
+	fmt.Printf("  Pending jobs:   %d\n", status.PendingJobs)
+	for _, e := range status.Errors {
+		fmt.Printf("  Error:          %s\n", e)
+	}
+}
+
 // statusCmd represents the status command
 var statusCmd = &cobra.Command{
 	Use:   "status",
-	Short: "List the status of Keyfactor services.",
-	Long:  `Returns a list of all API endpoints.`,
+	Short: "Show the health and status of the Keyfactor Command instance.",
+	Long: `Checks API reachability, the authenticated identity and its roles, product version, license status,
+orchestrator counts by state and the orchestrator job backlog. Use --json for output suitable for monitoring probes.
+Exits with a non-zero status code if the API is unreachable.
+
+The job backlog is reported as two numbers:
+  Scheduled jobs (scheduled_jobs)  every job waiting in the orchestrator job queue, including recurring jobs such as
+                                   inventory jobs between their runs.
+  Pending jobs (pending_jobs)      the one-off jobs, immediate or scheduled exactly once, that are due but still waiting
+                                   in the queue. A growing number usually means an orchestrator is offline or can't
+                                   keep up.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		//log.SetOutput(io.Discard)
-		//kfClient, _ := initClient()
-		//status, err := kfClient.GetStatus()
-		//if err != nil {
-		//	log.Printf("Error: %s", err)
-		//}
-		//output, jErr := json.Marshal(status)
-		//if jErr != nil {
-		//	log.Printf("Error: %s", jErr)
-		//}
-		//fmt.Printf("%s", output)
-		//
-		fmt.Println("status called")
+		log.SetOutput(io.Discard)
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		status := getInstanceStatus()
+		if jsonOut {
+			output, jErr := json.Marshal(status)
+			if jErr != nil {
+				fmt.Printf("Error invalid API response from Keyfactor. %s\n", jErr)
+				log.Fatalf("[ERROR]: %s", jErr)
+			}
+			fmt.Printf("%s\n", output)
+		} else {
+			printInstanceStatus(status)
+		}
+		if !status.Reachable {
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
+	var jsonOut bool
 	RootCmd.AddCommand(statusCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// statusCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// statusCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	statusCmd.Flags().BoolVar(&jsonOut, "json", false, "Output status as JSON.")
 }
@@ -0,0 +1,44 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+)
+
+func TestIsPendingJob(t *testing.T) {
+	now := time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)
+	immediate, notImmediate := true, false
+	at := func(t time.Time) *keyfactor.KeyfactorCommonSchedulingModelsTimeModel {
+		return &keyfactor.KeyfactorCommonSchedulingModelsTimeModel{Time: &t}
+	}
+	tests := []struct {
+		name     string
+		schedule *keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule
+		want     bool
+	}{
+		{"no schedule", nil, false},
+		{"immediate", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{Immediate: &immediate}, true},
+		{"exactly once due", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{ExactlyOnce: at(now.Add(-time.Hour))}, true},
+		{"exactly once now", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{ExactlyOnce: at(now)}, true},
+		{"exactly once later", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{ExactlyOnce: at(now.Add(time.Hour))}, false},
+		{"exactly once without time", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{ExactlyOnce: &keyfactor.KeyfactorCommonSchedulingModelsTimeModel{}}, false},
+		{"daily", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{Immediate: &notImmediate, Daily: at(now.Add(-time.Hour))}, false},
+		{"interval", &keyfactor.KeyfactorCommonSchedulingKeyfactorSchedule{Interval: &keyfactor.KeyfactorCommonSchedulingModelsIntervalModel{}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := keyfactor.ModelsOrchestratorJobsJob{Schedule: tt.schedule}
+			if got := isPendingJob(job, now); got != tt.want {
+				t.Errorf("isPendingJob() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// stdioPath is the file name that refers to stdin for inputs and stdout for outputs.
+const stdioPath = "-"
+
+// stdioOutputFlags are the flags that write a file and accept stdioPath.
+var stdioOutputFlags = []string{"outpath", "out", "projected-state", "result-json"}
+
+var (
+	// dataStdout is the real stdout. When an output is written to stdout, os.Stdout is pointed at stderr so that
+	// progress and status messages do not end up in the output.
+	dataStdout = os.Stdout
+	stdinUsed  bool
+	// memoryInputs are inputs that were not read from a file, such as database query results, by input name.
+	memoryInputs = make(map[string][]byte)
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// reserveStdoutForOutput redirects messages to stderr if any output of the command is written to stdout.
+func reserveStdoutForOutput(cmd *cobra.Command) {
+	for _, name := range stdioOutputFlags {
+		if f := cmd.Flags().Lookup(name); f != nil && f.Value.String() == stdioPath {
+			os.Stdout = os.Stderr
+			return
+		}
+	}
+}
+
+// createOutput creates the output file at path, or returns stdout if path is stdioPath.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == stdioPath {
+		return nopWriteCloser{dataStdout}, nil
+	}
+	recordResultArtifact(path)
+	if isCloudURL(path) {
+		return &cloudWriter{url: path}, nil
+	}
+	return os.Create(path)
+}
+
+// readInput reads the input file at path, an input registered in memoryInputs, or stdin if path is stdioPath. Stdin
+// can only be read by one input.
+func readInput(path string) ([]byte, error) {
+	if data, ok := memoryInputs[path]; ok {
+		return data, nil
+	}
+	if path != stdioPath {
+		return os.ReadFile(path)
+	}
+	if stdinUsed {
+		return nil, fmt.Errorf("stdin ('-') can only be used for one input")
+	}
+	stdinUsed = true
+	return io.ReadAll(os.Stdin)
+}
+
+// outputName returns a description of path for messages.
+func outputName(path string) string {
+	if path == stdioPath {
+		return "stdout"
+	}
+	return path
+}
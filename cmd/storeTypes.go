@@ -7,6 +7,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/AlecAivazis/survey/v2"
@@ -14,6 +15,7 @@ import (
 	"github.com/spf13/cobra"
 	"io"
 	"io/ioutil"
+	"kfutil/pkg/storetypes"
 	"log"
 	"net/http"
 	"os"
@@ -26,24 +28,6 @@ import (
 // End enums
 
 // Helpers
-func buildStoreTypePropertiesInterface(properties []interface{}) ([]api.StoreTypePropertyDefinition, error) {
-	var output []api.StoreTypePropertyDefinition
-
-	for _, prop := range properties {
-		log.Printf("Prop: %v", prop)
-		p := prop.(map[string]interface{})
-		output = append(output, api.StoreTypePropertyDefinition{
-			Name:         p["Name"].(string),
-			DisplayName:  p["DisplayName"].(string),
-			Type:         p["Type"].(string),
-			DependsOn:    p["DependsOn"].(string),
-			DefaultValue: p["DefaultValue"],
-			Required:     p["Required"].(bool),
-		})
-	}
-
-	return output, nil
-}
 
 // End helpers
 
@@ -129,6 +113,12 @@ var storesTypeCreateCmd = &cobra.Command{
 		storeType, _ := cmd.Flags().GetString("name")
 		listTypes, _ := cmd.Flags().GetBool("list")
 		configFile, _ := cmd.Flags().GetString("from-file")
+		updateIfExists, _ := cmd.Flags().GetBool("update-if-exists")
+		dryRun, dErr := getDryRunMode(cmd)
+		if dErr != nil {
+			fmt.Printf("Error: %s\n", dErr)
+			log.Fatalf("[ERROR] %s", dErr)
+		}
 
 		storeTypeIsValid := false
 
@@ -141,14 +131,22 @@ var storesTypeCreateCmd = &cobra.Command{
 			return
 		}
 
+		if configFile != "" && dryRun != dryRunNone {
+			storeTypeReq, err := readStoreTypeFile(configFile)
+			if err != nil {
+				fmt.Printf("Failed to read store type from file \"%s\"", err)
+				return
+			}
+			dryRunStoreTypeCreate(dryRun, storeTypeReq, updateIfExists)
+			return
+		}
+
 		if configFile != "" {
-			createdStore, err := createStoreFromFile(configFile)
+			err := createStoreFromFile(commandContext(cmd), configFile, updateIfExists)
 			if err != nil {
 				fmt.Printf("Failed to create store type from file \"%s\"", err)
 				return
 			}
-
-			fmt.Printf("Created store type called \"%s\"\n", createdStore.Name)
 			return
 		}
 
@@ -185,63 +183,37 @@ var storesTypeCreateCmd = &cobra.Command{
 				log.Fatalf("Error: %s", stErr)
 			}
 			log.Printf("[DEBUG] Store type config: %v", storeTypeConfig[storeType])
-			sConfig := storeTypeConfig[storeType].(map[string]interface{})
-			props, pErr := buildStoreTypePropertiesInterface(sConfig["Properties"].([]interface{}))
-			if pErr != nil {
-				fmt.Printf("Error: %s", pErr)
-				log.Printf("Error: %s", pErr)
-			}
-			createReq := api.CertificateStoreType{
-				Name:       storeTypeConfig[storeType].(map[string]interface{})["Name"].(string),
-				ShortName:  storeTypeConfig[storeType].(map[string]interface{})["ShortName"].(string),
-				Capability: storeTypeConfig[storeType].(map[string]interface{})["Capability"].(string),
-				SupportedOperations: &api.StoreTypeSupportedOperations{
-					Add:        storeTypeConfig[storeType].(map[string]interface{})["SupportedOperations"].(map[string]interface{})["Add"].(bool),
-					Create:     storeTypeConfig[storeType].(map[string]interface{})["SupportedOperations"].(map[string]interface{})["Create"].(bool),
-					Discovery:  storeTypeConfig[storeType].(map[string]interface{})["SupportedOperations"].(map[string]interface{})["Discovery"].(bool),
-					Enrollment: storeTypeConfig[storeType].(map[string]interface{})["SupportedOperations"].(map[string]interface{})["Enrollment"].(bool),
-					Remove:     storeTypeConfig[storeType].(map[string]interface{})["SupportedOperations"].(map[string]interface{})["Remove"].(bool),
-				},
-				Properties:      &props,
-				EntryParameters: &[]api.EntryParameter{},
-				PasswordOptions: &api.StoreTypePasswordOptions{
-					EntrySupported: storeTypeConfig[storeType].(map[string]interface{})["PasswordOptions"].(map[string]interface{})["EntrySupported"].(bool),
-					StoreRequired:  storeTypeConfig[storeType].(map[string]interface{})["PasswordOptions"].(map[string]interface{})["StoreRequired"].(bool),
-					Style:          storeTypeConfig[storeType].(map[string]interface{})["PasswordOptions"].(map[string]interface{})["Style"].(string),
-				},
-				//StorePathType:      "",
-				//StorePathValue:     "",
-				PrivateKeyAllowed:  storeTypeConfig[storeType].(map[string]interface{})["PrivateKeyAllowed"].(string),
-				JobProperties:      nil,
-				ServerRequired:     storeTypeConfig[storeType].(map[string]interface{})["ServerRequired"].(bool),
-				PowerShell:         storeTypeConfig[storeType].(map[string]interface{})["PowerShell"].(bool),
-				BlueprintAllowed:   storeTypeConfig[storeType].(map[string]interface{})["BlueprintAllowed"].(bool),
-				CustomAliasAllowed: storeTypeConfig[storeType].(map[string]interface{})["CustomAliasAllowed"].(string),
-				//ServerRegistration: 0,
-				//InventoryEndpoint:  "",
-				//InventoryJobType:   "",
-				//ManagementJobType:  "",
-				//DiscoveryJobType:   "",
-				//EnrollmentJobType:  "",
+			sConfig, _ := storeTypeConfig[storeType].(map[string]interface{})
+			createReq, dErr := storetypes.FromDefinition(sConfig)
+			if dErr != nil {
+				fmt.Printf("Error: %s\n", dErr)
+				log.Fatalf("[ERROR] %s", dErr)
 			}
 			log.Printf("[DEBUG] Create request: %v", createReq)
-			createResp, err := kfClient.CreateStoreType(&createReq)
-			if err != nil {
+			if dryRun != dryRunNone {
+				dryRunStoreTypeCreate(dryRun, createReq, updateIfExists)
+				return
+			}
+			if cErr := requireStoreTypeCapabilities(createReq); cErr != nil {
+				fmt.Printf("Error creating store type: %s\n", cErr)
+				log.Fatalf("[ERROR] creating store type: %s", cErr)
+			}
+			if err := ensureStoreType(commandContext(cmd), kfClient, createReq, updateIfExists); err != nil {
 				fmt.Printf("Error creating store type: %s", err)
 				log.Printf("[ERROR] creating store type : %s", err)
 			}
-			log.Printf("[DEBUG] Create response: %v", createResp)
 		}
 	},
 }
 
-func createStoreFromFile(filename string) (*api.CertificateStoreType, error) {
-	kfClient, _ := initClient()
+// readStoreTypeFile reads a certificate store type definition from a JSON file.
+func readStoreTypeFile(filename string) (*api.CertificateStoreType, error) {
 	// Read the file
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
 	// Compile JSON contents to a api.CertificateStoreType struct
 	var storeType api.CertificateStoreType
@@ -250,13 +222,73 @@ func createStoreFromFile(filename string) (*api.CertificateStoreType, error) {
 	if err != nil {
 		return nil, err
 	}
+	return &storeType, nil
+}
+
+// dryRunStoreTypeCreate validates a create store type request and prints the plan, exiting with a non-zero status if
+// the request is invalid. Server dry runs plan the same no-op or update as a create would for an existing store type.
+func dryRunStoreTypeCreate(mode string, storeType *api.CertificateStoreType, updateIfExists bool) {
+	kfClient, _ := initClient()
+	item := dryRunPlanItem{
+		Action:   "create",
+		Target:   fmt.Sprintf("store type %s", storeType.ShortName),
+		Problems: validateStoreTypeCreate(kfClient, mode, storeType),
+	}
+	if mode == dryRunServer && storeType.ShortName != "" {
+		existing, err := storetypes.Find(context.Background(), kfClient, storeType.ShortName)
+		switch {
+		case err != nil:
+			item.Problems = append(item.Problems, err.Error())
+		case existing == nil:
+		case len(storetypes.Diff(existing, storeType)) == 0:
+			item.Action = "keep"
+			item.Target = fmt.Sprintf("store type %s (ID %d, unchanged)", storeType.ShortName, existing.StoreType)
+		case updateIfExists:
+			item.Action = "update"
+			item.Target = fmt.Sprintf("store type %s (ID %d: %s)", storeType.ShortName, existing.StoreType,
+				strings.Join(storetypes.Diff(existing, storeType), ", "))
+		default:
+			item.Problems = append(item.Problems, fmt.Sprintf("store type '%s' already exists with ID %d and a different definition (%s), use --update-if-exists to update it",
+				storeType.ShortName, existing.StoreType, strings.Join(storetypes.Diff(existing, storeType), ", ")))
+		}
+	}
+	if printDryRunPlan(mode, []dryRunPlanItem{item}) > 0 {
+		os.Exit(1)
+	}
+}
 
-	// Use the Keyfactor client to create the store type
-	createResp, err := kfClient.CreateStoreType(&storeType)
+func createStoreFromFile(ctx context.Context, filename string, updateIfExists bool) error {
+	kfClient, _ := initClient()
+	storeType, err := readStoreTypeFile(filename)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := requireStoreTypeCapabilities(storeType); err != nil {
+		return err
+	}
+	return ensureStoreType(ctx, kfClient, storeType, updateIfExists)
+}
+
+// ensureStoreType creates storeType unless a store type with its short name exists. An existing store type with a
+// different definition is updated if updateIfExists is set, and reported otherwise, so bootstraps can be re-run.
+func ensureStoreType(ctx context.Context, kfClient *api.Client, storeType *api.CertificateStoreType, updateIfExists bool) error {
+	resp, outcome, diffs, err := storetypes.Ensure(ctx, kfClient, storeType, updateIfExists)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Store type %s %s: %v", storeType.ShortName, outcome, resp)
+	switch outcome {
+	case storetypes.Created:
+		fmt.Printf("Created store type called \"%s\"\n", resp.Name)
+	case storetypes.Unchanged:
+		printInfo("Store type %s already exists with ID %d and is up to date.\n", storeType.ShortName, resp.StoreType)
+	case storetypes.Differs:
+		printWarning("Store type %s already exists with ID %d and a different definition (%s). Use --update-if-exists to update it.\n",
+			storeType.ShortName, resp.StoreType, strings.Join(diffs, ", "))
+	case storetypes.Updated:
+		printInfo("Updated store type %s with ID %d (%s).\n", storeType.ShortName, resp.StoreType, strings.Join(diffs, ", "))
 	}
-	return createResp, nil
+	return nil
 }
 
 var storesTypeUpdateCmd = &cobra.Command{
@@ -431,6 +463,9 @@ func init() {
 	storesTypeCreateCmd.Flags().StringVarP(&storeTypeName, "name", "n", "", "Short name of the certificate store type to get. Valid choices are: "+validTypesString)
 	storesTypeCreateCmd.Flags().BoolVarP(&listValidStoreTypes, "list", "l", false, "List valid store types.")
 	storesTypeCreateCmd.Flags().StringVarP(&filePath, "from-file", "f", "", "Path to a JSON file containing certificate store type data for a single store.")
+	addDryRunFlag(storesTypeCreateCmd, "", "Do not create the store type, validate it and print a plan.")
+	storesTypeCreateCmd.Flags().Bool("update-if-exists", false,
+		"Update the store type in place if one with the same short name exists with a different definition. By default it is left as is and a warning printed.")
 	//storesTypeCreateCmd.MarkFlagRequired("name")
 
 	// UPDATE command
@@ -0,0 +1,286 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// storeTagPrefix marks a --stores value that selects the stores with a tag instead of naming a file, e.g.
+	// tag:web-tier or tag:web-tier,api-tier.
+	storeTagPrefix       = "tag:"
+	storeTagsFileName    = "store_tags.json"
+	storeTagsFileEnvName = "KFUTIL_STORE_TAGS"
+)
+
+// storeTags are the tags of stores, by store ID.
+type storeTags map[string][]string
+
+// storeTagsPath returns the path of the local tags file, $HOME/.keyfactor/store_tags.json unless KFUTIL_STORE_TAGS
+// is set.
+func storeTagsPath() string {
+	if path := os.Getenv(storeTagsFileEnvName); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return storeTagsFileName
+	}
+	return filepath.Join(home, ".keyfactor", storeTagsFileName)
+}
+
+func readStoreTags(path string) (storeTags, error) {
+	tags := make(storeTags)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("invalid tags file %s: %s", path, err)
+	}
+	return tags, nil
+}
+
+func (t storeTags) write(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// add tags a store and reports whether the store did not have the tag.
+func (t storeTags) add(storeID string, tag string) bool {
+	for _, existing := range t[storeID] {
+		if existing == tag {
+			return false
+		}
+	}
+	t[storeID] = append(t[storeID], tag)
+	sort.Strings(t[storeID])
+	return true
+}
+
+// remove removes a tag from a store and reports whether the store had the tag.
+func (t storeTags) remove(storeID string, tag string) bool {
+	for i, existing := range t[storeID] {
+		if existing == tag {
+			t[storeID] = append(t[storeID][:i], t[storeID][i+1:]...)
+			if len(t[storeID]) == 0 {
+				delete(t, storeID)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// storesWithTags returns the sorted IDs of the stores with any of tags.
+func (t storeTags) storesWithTags(tags []string) []string {
+	var ids []string
+	for id, storeTags := range t {
+		for _, tag := range storeTags {
+			if matchAny(tags, tag) {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// isStoreTagSource reports whether a stores source selects stores by tag.
+func isStoreTagSource(source string) bool {
+	return strings.HasPrefix(strings.ToLower(source), storeTagPrefix)
+}
+
+// parseStoreTagSource returns the tags of a tag:<tag>[,<tag>...] stores source.
+func parseStoreTagSource(source string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(source[len(storeTagPrefix):], ",") {
+		if tag = normalizeTag(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("missing tag in '%s', expected %s<tag>[,<tag>...]", source, storeTagPrefix)
+	}
+	return tags, nil
+}
+
+// storeTagRows returns the stores file rows of the stores with any of tags, looked up in Keyfactor.
+func storeTagRows(kfClient *api.Client, tags []string) ([][]string, error) {
+	all, err := readStoreTags(storeTagsPath())
+	if err != nil {
+		return nil, err
+	}
+	ids := all.storesWithTags(tags)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no stores are tagged %s", strings.Join(tags, " or "))
+	}
+	return storeRowsByID(kfClient, ids, "tagged "), nil
+}
+
+// storeRowsByID returns the stores file rows of the stores with ids, looked up in Keyfactor. Stores that can't be
+// looked up are skipped with a warning, kind describes the stores in it, e.g. "tagged ".
+func storeRowsByID(kfClient *api.Client, ids []string, kind string) [][]string {
+	typeNames := make(map[int]string)
+	if storeTypes, stErr := kfClient.ListCertificateStoreTypes(); stErr == nil && storeTypes != nil {
+		for _, st := range *storeTypes {
+			typeNames[st.StoreType] = st.ShortName
+		}
+	}
+	var rows [][]string
+	for _, id := range ids {
+		store, sErr := kfClient.GetCertificateStoreByID(id)
+		if sErr != nil {
+			printWarning("Skipping %sstore %s: %s\n", kind, id, sErr)
+			log.Printf("[WARN] getting %sstore %s: %s", kind, id, sErr)
+			continue
+		}
+		rows = append(rows, []string{id, typeNames[store.CertStoreType], store.ClientMachine, store.StorePath,
+			fmt.Sprintf("%d", store.ContainerId), store.ContainerName, GetCurrentTime()})
+	}
+	return rows
+}
+
+// storesTableData returns rows as a stores file.
+func storesTableData(rows [][]string) []byte {
+	return csvBytes(append([][]string{StoreHeader}, rows...))
+}
+
+// resolveStoreTagInput points a --stores tag:<tag> source of cmd at a stores table of the tagged stores. It must be
+// called before the --stores flag is read.
+func resolveStoreTagInput(cmd *cobra.Command, kfClient *api.Client) {
+	source, _ := cmd.Flags().GetString("stores")
+	if !isStoreTagSource(source) {
+		return
+	}
+	tags, err := parseStoreTagSource(source)
+	if err == nil {
+		var rows [][]string
+		if rows, err = storeTagRows(kfClient, tags); err == nil {
+			memoryInputs[source] = storesTableData(rows)
+			printInfo("Using %d store(s) tagged %s\n", len(rows), strings.Join(tags, " or "))
+			return
+		}
+	}
+	fmt.Printf("[ERROR] %s\n", err)
+	log.Fatalf("[ERROR] %s", err)
+}
+
+var storesTagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Tag certificate stores to target them in root of trust runs.",
+	Long: `Adds tags to certificate stores, or removes them with --remove, so that 'stores rot' commands can target the stores
+with a tag using --stores tag:<tag>, or a --manifest policy with 'stores: tag:<tag>'. Tags are kept locally in
+$HOME/.keyfactor/` + storeTagsFileName + `, or the file named by ` + storeTagsFileEnvName + `. Share the file to share tags.
+With --list the tagged stores are printed, optionally only those with --tag.`,
+	Example: `kfutil stores tag --id 6b2a1c0e-... --tag web-tier
+kfutil stores tag --id 6b2a1c0e-... --tag web-tier --remove
+kfutil stores tag --list --tag web-tier`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		ids, _ := cmd.Flags().GetStringSlice("id")
+		tagFlags, _ := cmd.Flags().GetStringSlice("tag")
+		remove, _ := cmd.Flags().GetBool("remove")
+		list, _ := cmd.Flags().GetBool("list")
+		path := storeTagsPath()
+
+		var tags []string
+		for _, tag := range tagFlags {
+			if tag = normalizeTag(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		all, err := readStoreTags(path)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err)
+			log.Fatalf("[ERROR] %s", err)
+		}
+		if list {
+			storeIDs := make([]string, 0, len(all))
+			for id := range all {
+				storeIDs = append(storeIDs, id)
+			}
+			if len(tags) > 0 {
+				storeIDs = all.storesWithTags(tags)
+			}
+			sort.Strings(storeIDs)
+			for _, id := range storeIDs {
+				fmt.Printf("%s\t%s\n", id, strings.Join(all[id], ","))
+			}
+			return
+		}
+		if len(ids) == 0 || len(tags) == 0 {
+			fmt.Println("[ERROR] --id and --tag are required unless --list is given")
+			log.Fatalf("[ERROR] missing --id or --tag")
+		}
+		if !remove {
+			// Only tag stores that exist, a typo would otherwise silently never match.
+			kfClient, _ := initClient()
+			for _, id := range ids {
+				if _, sErr := kfClient.GetCertificateStoreByID(id); sErr != nil {
+					fmt.Printf("[ERROR] store %s not found: %s\n", id, sErr)
+					log.Fatalf("[ERROR] store %s not found: %s", id, sErr)
+				}
+			}
+		}
+		changed := 0
+		for _, id := range ids {
+			for _, tag := range tags {
+				switch {
+				case remove && all.remove(id, tag):
+					printRemoved("Removed tag %s from store %s\n", tag, id)
+					changed++
+				case !remove && all.add(id, tag):
+					printAdded("Tagged store %s %s\n", id, tag)
+					changed++
+				}
+			}
+		}
+		if changed == 0 {
+			printInfo("No changes to %s\n", path)
+			return
+		}
+		if wErr := all.write(path); wErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", path, wErr)
+			log.Fatalf("[ERROR] writing %s: %s", path, wErr)
+		}
+	},
+}
+
+func init() {
+	storesCmd.AddCommand(storesTagCmd)
+	storesTagCmd.Flags().StringSlice("id", []string{}, "IDs of the stores to tag. May be repeated or comma separated.")
+	storesTagCmd.Flags().StringSlice("tag", []string{}, "Tags to add or remove. May be repeated or comma separated.")
+	storesTagCmd.Flags().Bool("remove", false, "Remove the tags instead of adding them.")
+	storesTagCmd.Flags().Bool("list", false, "List the tagged stores, only those with --tag if given.")
+}
@@ -0,0 +1,154 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Output formats of `store-types capabilities`.
+const (
+	capabilitiesFormatTable    = "table"
+	capabilitiesFormatCSV      = "csv"
+	capabilitiesFormatMarkdown = "markdown"
+)
+
+// CapabilitiesHeader is the header of the store type capability matrix.
+var CapabilitiesHeader = []string{"ShortName", "Name", "Add", "Create", "Discovery", "Enrollment", "Remove", "PrivateKey", "EntryParameters"}
+
+// capabilityRows returns the capability matrix of the store types, sorted by short name, including the header. The
+// private key column is the PrivateKeyAllowed setting, e.g. Optional, and the entry parameters column lists their
+// names.
+func capabilityRows(types []api.CertificateStoreType) [][]string {
+	sorted := append([]api.CertificateStoreType(nil), types...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].ShortName) < strings.ToLower(sorted[j].ShortName)
+	})
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	rows := [][]string{CapabilitiesHeader}
+	for _, st := range sorted {
+		ops := api.StoreTypeSupportedOperations{}
+		if st.SupportedOperations != nil {
+			ops = *st.SupportedOperations
+		}
+		var params []string
+		if st.EntryParameters != nil {
+			for _, p := range *st.EntryParameters {
+				params = append(params, p.Name)
+			}
+		}
+		privateKey := st.PrivateKeyAllowed
+		if privateKey == "" {
+			privateKey = "unknown"
+		}
+		rows = append(rows, []string{st.ShortName, st.Name, yesNo(ops.Add), yesNo(ops.Create), yesNo(ops.Discovery),
+			yesNo(ops.Enrollment), yesNo(ops.Remove), privateKey, strings.Join(params, ", ")})
+	}
+	return rows
+}
+
+// writeCapabilities writes the capability matrix rows to w in format.
+func writeCapabilities(w io.Writer, rows [][]string, format string) error {
+	switch format {
+	case capabilitiesFormatCSV:
+		_, err := w.Write(csvBytes(rows))
+		return err
+	case capabilitiesFormatMarkdown:
+		var b strings.Builder
+		for i, row := range rows {
+			cells := make([]string, len(row))
+			for j, c := range row {
+				cells[j] = markdownCell(c)
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+			if i == 0 {
+				fmt.Fprintf(&b, "|%s\n", strings.Repeat(" --- |", len(row)))
+			}
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, row := range rows {
+		if i == 0 {
+			row = []string{"SHORT NAME", "NAME", "ADD", "CREATE", "DISCOVERY", "ENROLLMENT", "REMOVE", "PRIVATE KEY", "ENTRY PARAMETERS"}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+var storeTypesCapabilitiesCmd = &cobra.Command{
+	Use:   "capabilities",
+	Short: "Show a matrix of the operations each store type supports.",
+	Long: `Prints a matrix of the certificate store types defined in Keyfactor Command: one row per store type with the
+operations it supports (add, create, discovery, enrollment and remove), whether certificates are deployed with a
+private key, and the names of its entry parameters. Use --format csv or markdown to share it.`,
+	Example: `kfutil store-types capabilities
+kfutil store-types capabilities --format markdown --outpath capabilities.md`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		format, _ := cmd.Flags().GetString("format")
+		outpath, _ := cmd.Flags().GetString("outpath")
+
+		switch format {
+		case capabilitiesFormatTable, capabilitiesFormatCSV, capabilitiesFormatMarkdown:
+		default:
+			fmt.Printf("[ERROR] invalid --format '%s', must be one of table, csv or markdown\n", format)
+			log.Fatalf("[ERROR] invalid --format: %s", format)
+		}
+		kfClient, _ := initClient()
+		types, err := kfClient.ListCertificateStoreTypes()
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			log.Fatalf("[ERROR] listing store types: %s", err)
+		}
+		rows := capabilityRows(*types)
+		if outpath == "" {
+			if wErr := writeCapabilities(os.Stdout, rows, format); wErr != nil {
+				log.Fatalf("[ERROR] writing capabilities: %s", wErr)
+			}
+			return
+		}
+		out, oErr := createOutput(outpath)
+		if oErr != nil {
+			fmt.Printf("[ERROR] creating %s: %s\n", outpath, oErr)
+			log.Fatalf("[ERROR] creating %s: %s", outpath, oErr)
+		}
+		wErr := writeCapabilities(out, rows, format)
+		if cErr := out.Close(); wErr == nil {
+			wErr = cErr
+		}
+		if wErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", outpath, wErr)
+			log.Fatalf("[ERROR] writing %s: %s", outpath, wErr)
+		}
+		if outpath != stdioPath {
+			printInfo("Capabilities of %d store type(s) written to %s\n", len(rows)-1, outputName(outpath))
+		}
+	},
+}
+
+func init() {
+	storeTypesCmd.AddCommand(storeTypesCapabilitiesCmd)
+	storeTypesCapabilitiesCmd.Flags().String("format", capabilitiesFormatTable, "Output format, one of table, csv or markdown.")
+	storeTypesCapabilitiesCmd.Flags().StringP("outpath", "o", "", "Path to write the matrix to, '-' for stdout. Defaults to stdout.")
+}
@@ -0,0 +1,215 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// Kinds of store type schema fields.
+const (
+	fieldKindProperty       = "Property"
+	fieldKindEntryParameter = "EntryParameter"
+	fieldKindPassword       = "StorePassword"
+)
+
+// storeTypeField is a property, entry parameter or the store password of a store type.
+type storeTypeField struct {
+	Kind        string   `json:"kind"`
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	RequiredOn  string   `json:"required_on,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	DependsOn   string   `json:"depends_on,omitempty"`
+}
+
+// splitOptions splits a comma separated list of choices.
+func splitOptions(s string) []string {
+	var options []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			options = append(options, o)
+		}
+	}
+	return options
+}
+
+// storeTypeSchema returns the fields of a store type: its properties, the store password if one is required, and its
+// entry parameters. The choices of MultipleChoice properties are their comma separated default value.
+func storeTypeSchema(st *api.CertificateStoreType) []storeTypeField {
+	var fields []storeTypeField
+	if st.Properties != nil {
+		for _, p := range *st.Properties {
+			f := storeTypeField{Kind: fieldKindProperty, Name: p.Name, DisplayName: p.DisplayName, Type: p.Type,
+				Required: p.Required, DependsOn: p.DependsOn}
+			if p.DefaultValue != nil {
+				f.Default = fmt.Sprintf("%v", p.DefaultValue)
+			}
+			if strings.EqualFold(p.Type, "MultipleChoice") {
+				f.Options = splitOptions(f.Default)
+				f.Default = ""
+			}
+			fields = append(fields, f)
+		}
+	}
+	if st.PasswordOptions != nil && st.PasswordOptions.StoreRequired {
+		fields = append(fields, storeTypeField{Kind: fieldKindPassword, Name: "Password", Type: "Secret", Required: true})
+	}
+	if st.EntryParameters != nil {
+		for _, p := range *st.EntryParameters {
+			f := storeTypeField{Kind: fieldKindEntryParameter, Name: p.Name, DisplayName: p.DisplayName, Type: p.Type,
+				Default: p.DefaultValue, Options: splitOptions(p.Options), DependsOn: p.DependsOn}
+			var on []string
+			for _, req := range []struct {
+				when bool
+				name string
+			}{{p.RequiredWhen.OnAdd, "add"}, {p.RequiredWhen.OnRemove, "remove"}, {p.RequiredWhen.OnReenrollment, "reenrollment"}, {p.RequiredWhen.HasPrivateKey, "private key"}} {
+				if req.when {
+					on = append(on, req.name)
+				}
+			}
+			f.Required = len(on) > 0
+			f.RequiredOn = strings.Join(on, ",")
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// validateValue returns the problem with a value of the field, or an empty string if it is valid.
+func (f storeTypeField) validateValue(value string) string {
+	if value == "" {
+		if f.Required && f.Kind != fieldKindEntryParameter {
+			return fmt.Sprintf("required %s '%s' is empty", strings.ToLower(f.Kind), f.Name)
+		}
+		return ""
+	}
+	switch {
+	case strings.EqualFold(f.Type, "Bool"):
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Sprintf("%s '%s' must be true or false, got '%s'", strings.ToLower(f.Kind), f.Name, value)
+		}
+	case len(f.Options) > 0:
+		for _, o := range f.Options {
+			if strings.EqualFold(o, value) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s '%s' must be one of %s, got '%s'", strings.ToLower(f.Kind), f.Name, strings.Join(f.Options, ", "), value)
+	}
+	return ""
+}
+
+// storeTypeFlagValue returns a placeholder value of a field for generated flags and templates.
+func storeTypeFlagValue(f storeTypeField) string {
+	switch {
+	case len(f.Options) > 0:
+		return strings.Join(f.Options, "|")
+	case f.Default != "":
+		return f.Default
+	default:
+		return "<" + strings.ToLower(f.Type) + ">"
+	}
+}
+
+// printStoreTypeFlags prints the CSV columns of 'stores import create' for the store type and the --entry-param flags
+// of its entry parameters.
+func printStoreTypeFlags(w io.Writer, st *api.CertificateStoreType, fields []storeTypeField, kfClient *api.Client) {
+	_, headers := getHeadersForStoreType(st.StoreType, *kfClient)
+	columns := make([]string, len(headers))
+	for i := range columns {
+		columns[i] = headers[i]
+	}
+	fmt.Fprintf(w, "# CSV columns for 'kfutil stores import create --store-type-name %s'\n%s\n", st.ShortName, strings.Join(columns, ","))
+	var entryFlags []string
+	for _, f := range fields {
+		if f.Kind == fieldKindEntryParameter {
+			entryFlags = append(entryFlags, fmt.Sprintf("--entry-param %s:%s=%s", st.ShortName, f.Name, storeTypeFlagValue(f)))
+		}
+	}
+	if len(entryFlags) > 0 {
+		fmt.Fprintf(w, "\n# Entry parameters for 'kfutil stores rot reconcile'\n%s\n", strings.Join(entryFlags, " \\\n  "))
+	}
+}
+
+var storeTypesPropertiesCmd = &cobra.Command{
+	Use:   "properties",
+	Short: "Show the properties and entry parameters of a store type.",
+	Long: `Prints the property and entry parameter schema of a certificate store type: names, types, whether they are
+required, defaults and allowed values. With --generate-flags the CSV columns needed to create stores of the type with
+'stores import create' and the --entry-param flags of its entry parameters are printed instead.`,
+	Example: `kfutil store-types properties --name AKV
+kfutil store-types properties --name AKV --generate-flags`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		id, _ := cmd.Flags().GetInt("id")
+		name, _ := cmd.Flags().GetString("name")
+		generateFlags, _ := cmd.Flags().GetBool("generate-flags")
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		var st interface{}
+		switch {
+		case id >= 0:
+			st = id
+		case name != "":
+			st = name
+		default:
+			fmt.Println("Error: one of --id or --name is required.")
+			log.Fatalf("[ERROR] missing --id or --name")
+		}
+		kfClient, _ := initClient()
+		storeType, err := kfClient.GetCertificateStoreType(st)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			log.Fatalf("[ERROR] getting store type %v: %s", st, err)
+		}
+		fields := storeTypeSchema(storeType)
+		switch {
+		case generateFlags:
+			printStoreTypeFlags(os.Stdout, storeType, fields, kfClient)
+		case jsonOut:
+			output, _ := json.MarshalIndent(fields, "", "  ")
+			fmt.Printf("%s\n", output)
+		default:
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KIND\tNAME\tTYPE\tREQUIRED\tDEFAULT/OPTIONS\tDEPENDS ON")
+			for _, f := range fields {
+				required := strconv.FormatBool(f.Required)
+				if f.RequiredOn != "" {
+					required = "on " + f.RequiredOn
+				}
+				values := f.Default
+				if len(f.Options) > 0 {
+					values = strings.Join(f.Options, "|")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Kind, f.Name, f.Type, required, values, f.DependsOn)
+			}
+			w.Flush()
+		}
+	},
+}
+
+func init() {
+	storeTypesCmd.AddCommand(storeTypesPropertiesCmd)
+	storeTypesPropertiesCmd.Flags().IntP("id", "i", -1, "ID of the certificate store type.")
+	storeTypesPropertiesCmd.Flags().StringP("name", "n", "", "Short name of the certificate store type.")
+	storeTypesPropertiesCmd.Flags().Bool("generate-flags", false, "Print the CSV columns and flags needed to create stores of the type.")
+	storeTypesPropertiesCmd.Flags().Bool("json", false, "Output the schema as JSON.")
+	storeTypesPropertiesCmd.MarkFlagsMutuallyExclusive("id", "name")
+}
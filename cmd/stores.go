@@ -9,6 +9,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/Keyfactor/keyfactor-go-client/api"
 	"github.com/spf13/cobra"
 	"io"
 	"log"
@@ -27,21 +28,41 @@ var storesCmd = &cobra.Command{
 var storesListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List certificate stores.",
-	Long:  `List certificate stores.`,
+	Long: `List certificate stores, --limit at a time. Use --offset to list the following stores or --all to list every
+store page by page. The number of stores listed is printed to stderr.`,
+	Example: `kfutil stores list --limit 50 --offset 100
+kfutil stores list --all --query 'ClientMachine -contains "prod"'`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.SetOutput(io.Discard)
-		kfClient, _ := initClient()
-		params := make(map[string]interface{})
-		stores, err := kfClient.ListCertificateStores(&params)
-
+		query, _ := cmd.Flags().GetString("query")
+		paging, pErr := listPagingFromFlags(cmd)
+		if pErr != nil {
+			fmt.Printf("[ERROR] %s\n", pErr)
+			log.Fatalf("[ERROR] %s", pErr)
+		}
+		ctx := commandContext(cmd)
+		sdkClient := initGenClient()
+		var stores []api.GetCertificateStoreResponse
+		from, to, more, err := fetchPages(paging, func(page int32, size int32) (int, error) {
+			storesPage, sErr := listCertificateStoresPage(ctx, sdkClient, query, page, size)
+			stores = append(stores, storesPage...)
+			return len(storesPage), sErr
+		})
 		if err != nil {
-			log.Printf("Error: %s", err)
+			exitIfInterrupted(ctx, "no stores were listed")
+			fmt.Printf("Error, unable to list certificate stores. %s\n", err)
+			log.Fatalf("[ERROR] listing certificate stores: %s", err)
+		}
+		stores = stores[from:to]
+		if stores == nil {
+			stores = []api.GetCertificateStoreResponse{}
 		}
 		output, jErr := json.Marshal(stores)
 		if jErr != nil {
 			log.Printf("Error: %s", jErr)
 		}
 		fmt.Printf("%s", output)
+		printListCount("store(s)", paging, len(stores), more)
 	},
 }
 
@@ -71,6 +92,8 @@ func init() {
 	storesCmd.AddCommand(storesListCmd)
 	storesCmd.AddCommand(storesGetCmd)
 	storesGetCmd.Flags().StringVarP(&storeId, "id", "i", "", "ID of the certificate store to get.")
+	storesListCmd.Flags().String("query", "", "Keyfactor query to filter the stores with, e.g. 'ClientMachine -contains \"prod\"'.")
+	addListPagingFlags(storesListCmd, "stores")
 
 	// Here you will define your flags and configuration settings.
 
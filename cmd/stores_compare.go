@@ -0,0 +1,205 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+type storeCompareEntry struct {
+	Thumbprint    string `json:"thumbprint"`
+	CertID        int    `json:"cert_id"`
+	Alias         string `json:"alias"`
+	SubjectName   string `json:"subject_name"`
+	Issuer        string `json:"issuer"`
+	HasPrivateKey bool   `json:"has_private_key"`
+}
+
+type storeCompareResult struct {
+	StoreA         string              `json:"store_a"`
+	StoreB         string              `json:"store_b"`
+	OnlyInA        []storeCompareEntry `json:"only_in_a"`
+	OnlyInB        []storeCompareEntry `json:"only_in_b"`
+	KeyMismatch    []storeCompareEntry `json:"key_mismatch"`
+	InBoth         int                 `json:"in_both"`
+	StoreBMachine  string              `json:"-"`
+	StoreBPath     string              `json:"-"`
+	StoreBTypeName string              `json:"-"`
+}
+
+// getStoreCompareEntries returns the inventory of a certificate store keyed by thumbprint.
+func getStoreCompareEntries(kfClient *api.Client, storeId string) (map[string]storeCompareEntry, error) {
+	inventory, err := kfClient.GetCertStoreInventory(storeId)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]storeCompareEntry)
+	for _, inv := range *inventory {
+		for _, cert := range inv.Certificates {
+			entries[cert.Thumbprint] = storeCompareEntry{
+				Thumbprint:    cert.Thumbprint,
+				CertID:        cert.Id,
+				Alias:         inv.Name,
+				SubjectName:   cert.IssuedDN,
+				Issuer:        cert.IssuerDN,
+				HasPrivateKey: inv.Parameters["PrivateKeyEntry"] == "Yes",
+			}
+		}
+	}
+	return entries, nil
+}
+
+func compareStores(a map[string]storeCompareEntry, b map[string]storeCompareEntry) storeCompareResult {
+	var result storeCompareResult
+	for thumbprint, entry := range a {
+		other, ok := b[thumbprint]
+		switch {
+		case !ok:
+			result.OnlyInA = append(result.OnlyInA, entry)
+		case entry.HasPrivateKey != other.HasPrivateKey:
+			result.KeyMismatch = append(result.KeyMismatch, entry)
+		default:
+			result.InBoth++
+		}
+	}
+	for thumbprint, entry := range b {
+		if _, ok := a[thumbprint]; !ok {
+			result.OnlyInB = append(result.OnlyInB, entry)
+		}
+	}
+	for _, list := range [][]storeCompareEntry{result.OnlyInA, result.OnlyInB, result.KeyMismatch} {
+		sort.Slice(list, func(i, j int) bool { return list[i].SubjectName < list[j].SubjectName })
+	}
+	return result
+}
+
+func printStoreCompareTable(result storeCompareResult) {
+	fmt.Printf("Comparing store A (%s) with store B (%s)\n\n", result.StoreA, result.StoreB)
+	sections := []struct {
+		title   string
+		entries []storeCompareEntry
+	}{
+		{"Only in A", result.OnlyInA},
+		{"Only in B", result.OnlyInB},
+		{"In both, private key presence differs", result.KeyMismatch},
+	}
+	for _, section := range sections {
+		fmt.Printf("%s (%d):\n", section.title, len(section.entries))
+		for _, e := range section.entries {
+			fmt.Printf("  %s  key=%t  %s\n", e.Thumbprint, e.HasPrivateKey, e.SubjectName)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d certificate(s) identical in both stores.\n", result.InBoth)
+}
+
+// writeStoreCompareActions writes an audit report with the actions required to make store B match store A. The file
+// can be passed to `stores rot reconcile --import-csv`.
+func writeStoreCompareActions(result storeCompareResult, outpath string) error {
+	data := [][]string{AuditHeader}
+	for _, e := range result.OnlyInA {
+		data = append(data, []string{e.Thumbprint, strconv.Itoa(e.CertID), e.SubjectName, e.Issuer, result.StoreB, result.StoreBTypeName, result.StoreBMachine, result.StoreBPath, "true", "false", "false", GetCurrentTime(), "false"})
+	}
+	for _, e := range result.OnlyInB {
+		data = append(data, []string{e.Thumbprint, strconv.Itoa(e.CertID), e.SubjectName, e.Issuer, result.StoreB, result.StoreBTypeName, result.StoreBMachine, result.StoreBPath, "false", "true", "true", GetCurrentTime(), "false"})
+	}
+	f, err := createOutput(outpath)
+	if err != nil {
+		return err
+	}
+	if err := csv.NewWriter(f).WriteAll(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var storesCompareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the inventories of two certificate stores.",
+	Long: `Compares the inventories of two certificate stores and reports certificates only in store A, only in store B,
+and certificates in both stores where the presence of a private key differs. Use --actions-out to write an audit report
+of the add/remove actions that would make store B match store A, which can be applied with
+'kfutil stores rot reconcile --import-csv --input-file <file>'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		storeA, _ := cmd.Flags().GetString("a")
+		storeB, _ := cmd.Flags().GetString("b")
+		format, _ := cmd.Flags().GetString("format")
+		actionsOut, _ := cmd.Flags().GetString("actions-out")
+
+		kfClient, _ := initClient()
+		entriesA, aErr := getStoreCompareEntries(kfClient, storeA)
+		if aErr != nil {
+			fmt.Printf("Error getting inventory of store %s: %s\n", storeA, aErr)
+			log.Fatalf("[ERROR] getting inventory of store %s: %s", storeA, aErr)
+		}
+		entriesB, bErr := getStoreCompareEntries(kfClient, storeB)
+		if bErr != nil {
+			fmt.Printf("Error getting inventory of store %s: %s\n", storeB, bErr)
+			log.Fatalf("[ERROR] getting inventory of store %s: %s", storeB, bErr)
+		}
+		result := compareStores(entriesA, entriesB)
+		result.StoreA = storeA
+		result.StoreB = storeB
+
+		switch format {
+		case "json":
+			output, jErr := json.Marshal(result)
+			if jErr != nil {
+				fmt.Printf("Error invalid API response from Keyfactor. %s\n", jErr)
+				log.Fatalf("[ERROR]: %s", jErr)
+			}
+			fmt.Printf("%s\n", output)
+		default:
+			printStoreCompareTable(result)
+		}
+
+		if actionsOut != "" {
+			store, sErr := kfClient.GetCertificateStoreByID(storeB)
+			if sErr != nil {
+				fmt.Printf("Error getting certificate store %s: %s\n", storeB, sErr)
+				log.Fatalf("[ERROR] getting certificate store %s: %s", storeB, sErr)
+			}
+			result.StoreBMachine = store.ClientMachine
+			result.StoreBPath = store.StorePath
+			if storeType, stErr := kfClient.GetCertificateStoreType(store.CertStoreType); stErr == nil {
+				result.StoreBTypeName = storeType.ShortName
+			}
+			if wErr := writeStoreCompareActions(result, actionsOut); wErr != nil {
+				fmt.Printf("Error writing actions file %s: %s\n", actionsOut, wErr)
+				log.Fatalf("[ERROR] writing actions file: %s", wErr)
+			}
+			fmt.Printf("Actions to make store B match store A written to %s\n", actionsOut)
+		}
+	},
+}
+
+func init() {
+	var (
+		storeA     string
+		storeB     string
+		format     string
+		actionsOut string
+	)
+	storesCmd.AddCommand(storesCompareCmd)
+	storesCompareCmd.Flags().StringVar(&storeA, "a", "", "ID of the reference certificate store.")
+	storesCompareCmd.Flags().StringVar(&storeB, "b", "", "ID of the certificate store to compare against the reference store.")
+	storesCompareCmd.Flags().StringVarP(&format, "format", "f", "table", "Output format, one of table or json.")
+	storesCompareCmd.Flags().StringVar(&actionsOut, "actions-out", "", "Path to write the add/remove actions that would make store B match store A.")
+	storesCompareCmd.MarkFlagRequired("a")
+	storesCompareCmd.MarkFlagRequired("b")
+}
@@ -59,19 +59,26 @@ var importStoresCmd = &cobra.Command{
 //storesCreateCmd is the action for importing a csv file for bulk creating stores
 
 var storesCreateCmd = &cobra.Command{
-	Use:   "create --file <file name to import> --store-type-id <store type id> --store-type-name <store type name> --results-path <filepath for results> --dry-run <check fields only>",
+	Use:   "create --file <file name to import> --store-type-id <store type id> --store-type-name <store type name> --results-path <filepath for results> --dry-run[=client|server]",
 	Short: "Create certificate stores",
 	Long: `Certificate stores: Will parse a CSV and attempt to create a certificate store for each row with the provided parameters.
 store-type-name OR store-type-id is required.
 file is the path to the file to be imported.
-resultspath is where the import results will be written to.`,
+resultspath is where the import results will be written to.
+dry-run validates the file and prints a plan without creating any stores. A client dry run checks that required
+fields are set, a server dry run also checks that referenced orchestrators and containers exist and that the stores
+do not exist yet.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		kfClient, _ := initClient()
 		storeTypeName, _ := cmd.Flags().GetString("store-type-name")
 		storeTypeId, _ := cmd.Flags().GetInt("store-type-id")
 		filePath, _ := cmd.Flags().GetString("file")
 		outPath, _ := cmd.Flags().GetString("results-path")
-		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		dryRun, dErr := getDryRunMode(cmd)
+		if dErr != nil {
+			fmt.Printf("Error: %s\n", dErr)
+			log.Fatalf("[ERROR] %s", dErr)
+		}
 
 		var st interface{}
 
@@ -100,7 +107,7 @@ resultspath is where the import results will be written to.`,
 
 		log.Printf("[DEBUG] storesFile: %s", filePath)
 		log.Printf("[DEBUG] output path: %s", outPath)
-		log.Printf("[DEBUG] dryRun: %t", dryRun)
+		log.Printf("[DEBUG] dryRun: %s", dryRun)
 		log.Printf("[DEBUG] storeTypeId: %d", storeTypeId)
 
 		// get file headers
@@ -144,6 +151,17 @@ resultspath is where the import results will be written to.`,
 			return
 		}
 
+		var validator *storeCreateValidator
+		var plan []dryRunPlanItem
+		if dryRun != dryRunNone {
+			var vErr error
+			validator, vErr = newStoreCreateValidator(kfClient, dryRun, int(intId))
+			if vErr != nil {
+				fmt.Printf("Error preparing dry run: %s\n", vErr)
+				log.Fatalf("[ERROR] preparing dry run: %s", vErr)
+			}
+		}
+
 		//foreach row attempt to create the store
 
 		//track errors
@@ -179,6 +197,15 @@ resultspath is where the import results will be written to.`,
 
 			createStoreReqParameters.Properties = props
 
+			if validator != nil {
+				plan = append(plan, dryRunPlanItem{
+					Action:   "create",
+					Target:   fmt.Sprintf("row %d: %s", idx, storeTarget(&createStoreReqParameters)),
+					Problems: validator.validate(&createStoreReqParameters),
+				})
+				continue
+			}
+
 			//make request.
 			res, err := kfClient.CreateStore(&createStoreReqParameters)
 
@@ -190,6 +217,13 @@ resultspath is where the import results will be written to.`,
 			}
 		}
 
+		if validator != nil {
+			if printDryRunPlan(dryRun, plan) > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+
 		for oIdx, oRow := range originalMap {
 			extendedRow := append(oRow, resultsMap[oIdx])
 			originalMap[oIdx] = extendedRow
@@ -238,7 +272,7 @@ func getJsonForRequest(headerRow []string, row []string) *gabs.Container {
 
 func writeCsvFile(outpath string, rows map[int][]string) {
 
-	csvFile, err := os.Create(outpath)
+	csvFile, err := createOutput(outpath)
 	if err != nil {
 		log.Fatal("Cannot create file", err)
 	}
@@ -573,6 +607,7 @@ func ParseSecretField(secretField interface{}) interface{} {
 		panic("error unmarshalling secret field as StorePasswordConfig")
 	}
 
+	registerSecret(secret.Value)
 	if secret.IsManaged {
 		params := make(map[string]string)
 		for _, p := range *secret.ProviderTypeParameterValues {
@@ -614,20 +649,22 @@ func init() {
 	storesCreateTemplateCmd.Flags().StringVarP(&storeTypeName, "store-type-name", "n", "", "The name of the cert store type for the template.  Use if store-type-id is unknown.")
 	storesCreateTemplateCmd.Flags().IntVarP(&storeTypeId, "store-type-id", "i", -1, "The ID of the cert store type for the template.")
 	storesCreateTemplateCmd.Flags().StringVarP(&outPath, "outpath", "o", "",
-		"Path and name of the template file to generate.. If not specified, the file will be written to the current directory.")
+		"Path and name of the template file to generate.. If not specified, the file will be written to the current directory."+
+			" Also accepts s3://, az:// and gs:// URLs to upload to.")
 	storesCreateTemplateCmd.MarkFlagsMutuallyExclusive("store-type-name", "store-type-id")
 
 	storesCreateCmd.Flags().StringVarP(&storeTypeName, "store-type-name", "n", "", "The name of the cert store type.  Use if store-type-id is unknown.")
 	storesCreateCmd.Flags().IntVarP(&storeTypeId, "store-type-id", "i", -1, "The ID of the cert store type for the stores.")
 	storesCreateCmd.Flags().StringVarP(&file, "file", "f", "", "CSV file containing cert stores to create.")
 	storesCreateCmd.MarkFlagRequired("file")
-	storesCreateCmd.Flags().BoolP("dry-run", "d", false, "Do not import, just check for necessary fields.")
+	addDryRunFlag(storesCreateCmd, "d", "Do not import, validate the stores in the file and print a plan.")
 	storesCreateCmd.Flags().StringVarP(&resultsPath, "results-path", "o", "", "CSV file containing cert stores to create. defaults to <imported file name>_results.csv")
 
 	storesExportCmd.Flags().StringVarP(&storeTypeName, "store-type-name", "n", "", "The name of the cert store type for the template.  Use if store-type-id is unknown.")
 	storesExportCmd.Flags().IntVarP(&storeTypeId, "store-type-id", "i", -1, "The ID of the cert store type for the template.")
 	storesExportCmd.Flags().StringVarP(&outPath, "outpath", "o", "",
-		"Path and name of the template file to generate.. If not specified, the file will be written to the current directory.")
+		"Path and name of the template file to generate.. If not specified, the file will be written to the current directory."+
+			" Also accepts s3://, az:// and gs:// URLs to upload to.")
 	storesExportCmd.MarkFlagsMutuallyExclusive("store-type-name", "store-type-id")
 
 }
@@ -0,0 +1,96 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// storeIDsInputName is the name the stores table of --store-ids is registered under in memoryInputs.
+const storeIDsInputName = "store-ids:"
+
+// storeGUIDPattern matches a certificate store ID.
+var storeGUIDPattern = regexp.MustCompile(`^\{?[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\}?$`)
+
+func addStoreIDsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("store-ids", []string{},
+		"IDs of the stores to use instead of a --stores file. May be repeated or comma separated.")
+}
+
+// parseStoreIDList returns the store IDs of data if it is a plain list of store IDs, one per line or comma separated,
+// e.g. piped from another command. Blank lines and lines starting with # are ignored.
+func parseStoreIDList(data []byte) ([]string, bool) {
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, id := range strings.Split(line, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			if !storeGUIDPattern.MatchString(id) {
+				return nil, false
+			}
+			ids = append(ids, strings.Trim(id, "{}"))
+		}
+	}
+	return ids, len(ids) > 0
+}
+
+// resolveStoreIDsInput points --stores of cmd at a stores table of the stores of --store-ids, or of a --stores
+// source that is a plain list of store IDs such as GUIDs on stdin. It must be called before the --stores flag is
+// read.
+func resolveStoreIDsInput(cmd *cobra.Command, kfClient *api.Client) {
+	ids, _ := cmd.Flags().GetStringSlice("store-ids")
+	source, _ := cmd.Flags().GetString("stores")
+	if len(ids) > 0 {
+		if cmd.Flags().Changed("stores") {
+			fmt.Println("[ERROR] use only one of --stores or --store-ids")
+			log.Fatalf("[ERROR] both --stores and --store-ids were given")
+		}
+		for i, id := range ids {
+			ids[i] = strings.Trim(strings.TrimSpace(id), "{}")
+		}
+		source = storeIDsInputName + strings.Join(ids, ",")
+	} else {
+		if source == "" || isStoreTagSource(source) {
+			return
+		}
+		data, err := readInput(source)
+		if err != nil {
+			// Reported by the caller when the file is read.
+			return
+		}
+		if source == stdioPath {
+			memoryInputs[source] = data
+		}
+		var isList bool
+		if ids, isList = parseStoreIDList(data); !isList {
+			return
+		}
+	}
+	rows := storeRowsByID(kfClient, ids, "")
+	if len(rows) == 0 {
+		fmt.Println("[ERROR] none of the given store IDs were found")
+		log.Fatalf("[ERROR] no stores found for the given store IDs")
+	}
+	memoryInputs[source] = storesTableData(rows)
+	cmd.Flags().Set("stores", source)
+	printInfo("Using %d of %d given store(s)\n", len(rows), len(ids))
+}
@@ -0,0 +1,182 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// agentHasCapability reports whether an orchestrator advertises the given store type capability. Orchestrators report
+// capabilities such as `CertStores.RFPEM.Inventory`, so both exact and segment matches are accepted.
+func agentHasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if strings.EqualFold(c, capability) {
+			return true
+		}
+		for _, segment := range strings.Split(c, ".") {
+			if strings.EqualFold(segment, capability) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getAgentDetail(sdkClient *keyfactor.APIClient, agentId string) *keyfactor.KeyfactorApiModelsOrchestratorsAgentResponse {
+	agent, httpResponse, errors := sdkClient.AgentApi.AgentGetAgentDetail(context.Background(), agentId).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if errors != nil {
+		WriteApiError(fmt.Sprintf("Get orchestrator %s", agentId), httpResponse, errors)
+		fmt.Println()
+		log.Fatalf("[ERROR] getting orchestrator %s: %s", agentId, errors)
+	}
+	return agent
+}
+
+var storesReassignCmd = &cobra.Command{
+	Use:   "reassign",
+	Short: "Move certificate stores from one orchestrator to another.",
+	Long: `Move all certificate stores managed by one orchestrator to another, for example when decommissioning an
+orchestrator host. Use --store-type to only move stores of a single type. The target orchestrator must be approved and
+must advertise the capability of every store type being moved, otherwise no stores are reassigned.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		fromAgent, _ := cmd.Flags().GetString("from-agent")
+		toAgent, _ := cmd.Flags().GetString("to-agent")
+		storeTypeFlag, _ := cmd.Flags().GetString("store-type")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if strings.EqualFold(fromAgent, toAgent) {
+			fmt.Println("Error: --from-agent and --to-agent must be different orchestrators.")
+			log.Fatalf("[ERROR] --from-agent and --to-agent are the same")
+		}
+
+		sdkClient := initGenClient()
+		source := getAgentDetail(sdkClient, fromAgent)
+		target := getAgentDetail(sdkClient, toAgent)
+		if target.GetStatus() != agentStatusApproved {
+			fmt.Printf("Error: target orchestrator %s (%s) is %s, it must be approved.\n", target.GetAgentId(), target.GetClientMachine(), agentStatusName(int(target.GetStatus())))
+			log.Fatalf("[ERROR] target orchestrator %s is not approved", target.GetAgentId())
+		}
+
+		kfClient, _ := initClient()
+		storeTypeFilter := -1
+		if storeTypeFlag != "" {
+			var st interface{} = storeTypeFlag
+			if id, convErr := strconv.Atoi(storeTypeFlag); convErr == nil {
+				st = id
+			}
+			storeType, stErr := kfClient.GetCertificateStoreType(st)
+			if stErr != nil {
+				fmt.Printf("Error retrieving store type '%s': %s\n", storeTypeFlag, stErr)
+				log.Fatalf("[ERROR] retrieving store type '%s': %s", storeTypeFlag, stErr)
+			}
+			storeTypeFilter = storeType.StoreType
+		}
+
+		params := make(map[string]interface{})
+		storeList, lErr := kfClient.ListCertificateStores(&params)
+		if lErr != nil {
+			fmt.Printf("Error listing certificate stores: %s\n", lErr)
+			log.Fatalf("[ERROR] listing certificate stores: %s", lErr)
+		}
+		var stores []api.GetCertificateStoreResponse
+		for _, store := range *storeList {
+			if !strings.EqualFold(store.AgentId, source.GetAgentId()) {
+				continue
+			}
+			if storeTypeFilter >= 0 && store.CertStoreType != storeTypeFilter {
+				continue
+			}
+			stores = append(stores, store)
+		}
+		if len(stores) == 0 {
+			fmt.Printf("No certificate stores found on orchestrator %s (%s).\n", source.GetAgentId(), source.GetClientMachine())
+			return
+		}
+
+		// Validate every store type being moved before making any changes.
+		storeTypes := make(map[int]*api.CertificateStoreType)
+		var missing []string
+		for _, store := range stores {
+			if _, ok := storeTypes[store.CertStoreType]; ok {
+				continue
+			}
+			storeType, stErr := kfClient.GetCertificateStoreType(store.CertStoreType)
+			if stErr != nil {
+				fmt.Printf("Error retrieving store type %d: %s\n", store.CertStoreType, stErr)
+				log.Fatalf("[ERROR] retrieving store type %d: %s", store.CertStoreType, stErr)
+			}
+			storeTypes[store.CertStoreType] = storeType
+			if !agentHasCapability(target.GetCapabilities(), storeType.Capability) {
+				missing = append(missing, storeType.Capability)
+			}
+		}
+		if len(missing) > 0 {
+			fmt.Printf("Error: target orchestrator %s (%s) is missing required capabilities: %s\n", target.GetAgentId(), target.GetClientMachine(), strings.Join(missing, ", "))
+			log.Fatalf("[ERROR] target orchestrator missing capabilities: %s", strings.Join(missing, ", "))
+		}
+
+		failed := 0
+		for _, s := range stores {
+			storeType := storeTypes[s.CertStoreType]
+			if dryRun {
+				fmt.Printf("[DRY RUN] %s %s (%s:%s) %s -> %s\n", s.Id, storeType.ShortName, s.ClientMachine, s.StorePath, source.GetClientMachine(), target.GetClientMachine())
+				continue
+			}
+			store, gErr := kfClient.GetCertificateStoreByID(s.Id)
+			if gErr != nil {
+				failed++
+				fmt.Printf("%s[FAILED]%s %s (%s:%s): %s\n", colorRed, colorWhite, s.Id, s.ClientMachine, s.StorePath, gErr)
+				continue
+			}
+			updateArgs := buildStoreUpdateArgs(store, nil)
+			updateArgs.AgentId = target.GetAgentId()
+			if _, uErr := kfClient.UpdateStore(updateArgs); uErr != nil {
+				failed++
+				fmt.Printf("%s[FAILED]%s %s (%s:%s): %s\n", colorRed, colorWhite, s.Id, s.ClientMachine, s.StorePath, uErr)
+				continue
+			}
+			fmt.Printf("[MOVED] %s %s (%s:%s) %s -> %s\n", s.Id, storeType.ShortName, s.ClientMachine, s.StorePath, source.GetClientMachine(), target.GetClientMachine())
+		}
+		if dryRun {
+			fmt.Printf("\n%d store(s) would be reassigned.\n", len(stores))
+		} else {
+			fmt.Printf("\n%d store(s) reassigned, %d failed.\n", len(stores)-failed, failed)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	var (
+		fromAgent string
+		toAgent   string
+		storeType string
+		dryRun    bool
+	)
+	storesCmd.AddCommand(storesReassignCmd)
+	storesReassignCmd.Flags().StringVar(&fromAgent, "from-agent", "", "ID of the orchestrator to move certificate stores from.")
+	storesReassignCmd.Flags().StringVar(&toAgent, "to-agent", "", "ID of the orchestrator to move certificate stores to.")
+	storesReassignCmd.Flags().StringVarP(&storeType, "store-type", "t", "", "Short name or ID of the certificate store type to move. Defaults to all types.")
+	storesReassignCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the stores that would be moved without reassigning them.")
+	storesReassignCmd.MarkFlagRequired("from-agent")
+	storesReassignCmd.MarkFlagRequired("to-agent")
+}
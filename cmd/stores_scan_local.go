@@ -0,0 +1,383 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// Keystore types of `stores scan-local`.
+const (
+	localKeystoreJKS  = "jks"
+	localKeystoreP12  = "p12"
+	localKeystorePEM  = "pem"
+	localScanMaxBytes = 10 << 20
+)
+
+// localKeystoreExtensions are the file extensions of each keystore type. Java's cacerts has no extension.
+var localKeystoreExtensions = map[string][]string{
+	localKeystoreJKS: {".jks", ".jceks", ".keystore", ".truststore"},
+	localKeystoreP12: {".p12", ".pfx"},
+	localKeystorePEM: {".pem", ".crt", ".cer"},
+}
+
+// localKeystoreStoreTypes are the Keyfactor store types the keystore types are usually onboarded as, remote file
+// stores managed by the Remote File orchestrator extension.
+var localKeystoreStoreTypes = map[string]string{
+	localKeystoreJKS: "RFJKS",
+	localKeystoreP12: "RFPkcs12",
+	localKeystorePEM: "RFPEM",
+}
+
+// LocalInventoryHeader is the header of the inventory written by `stores scan-local`.
+var LocalInventoryHeader = []string{"StoreID", "StoreMachine", "StorePath", "Alias", "Thumbprint", "SubjectName", "Issuer", "NotAfter"}
+
+// localKeystore is a keystore file found by `stores scan-local`.
+type localKeystore struct {
+	Path  string
+	Type  string
+	Certs []jksTrustedCert
+	Err   error
+}
+
+// localKeystoreType returns the type of keystore a file name is, or "" if it is none of types.
+func localKeystoreType(name string, types map[string]bool) string {
+	base := strings.ToLower(path.Base(filepath.ToSlash(name)))
+	if base == "cacerts" && types[localKeystoreJKS] {
+		return localKeystoreJKS
+	}
+	ext := path.Ext(base)
+	for t, exts := range localKeystoreExtensions {
+		if !types[t] {
+			continue
+		}
+		for _, e := range exts {
+			if ext == e {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// parseLocalKeystore returns the certificates of a keystore file. PKCS#12 files are opened with the first of passwords
+// that works, JKS files need no password. Java also writes PKCS#12 keystores with a .jks extension, the type is
+// detected from the content.
+func parseLocalKeystore(kind string, data []byte, passwords []string) ([]jksTrustedCert, error) {
+	switch {
+	case isJKSData(data):
+		return decodeJKS(data)
+	case kind == localKeystorePEM:
+		certs, err := parsePEMCerts(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(certs) == 0 {
+			// .cer and .crt files are often DER encoded.
+			cert, dErr := x509.ParseCertificate(data)
+			if dErr != nil {
+				return nil, nil
+			}
+			certs = append(certs, cert)
+		}
+		entries := make([]jksTrustedCert, 0, len(certs))
+		for _, c := range certs {
+			entries = append(entries, jksTrustedCert{Cert: c})
+		}
+		return entries, nil
+	default:
+		var lastErr error
+		for _, password := range passwords {
+			blocks, err := pkcs12.ToPEM(data, password)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			var entries []jksTrustedCert
+			for _, b := range blocks {
+				if b.Type != "CERTIFICATE" {
+					continue
+				}
+				cert, cErr := x509.ParseCertificate(b.Bytes)
+				if cErr != nil {
+					return nil, cErr
+				}
+				entries = append(entries, jksTrustedCert{Alias: b.Headers["friendlyName"], Cert: cert})
+			}
+			return entries, nil
+		}
+		if errors.Is(lastErr, pkcs12.ErrIncorrectPassword) {
+			return nil, fmt.Errorf("none of the %d password(s) opens the keystore, see --password", len(passwords))
+		}
+		return nil, lastErr
+	}
+}
+
+// scanLocalFiles calls found with every keystore file under roots on this machine.
+func scanLocalFiles(roots []string, types map[string]bool, found func(path string, kind string, data []byte)) {
+	for _, root := range roots {
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Printf("[WARN] scanning %s: %s", p, err)
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			kind := localKeystoreType(p, types)
+			if kind == "" || !d.Type().IsRegular() {
+				return nil
+			}
+			if info, iErr := d.Info(); iErr != nil || info.Size() > localScanMaxBytes {
+				log.Printf("[WARN] skipping %s, too large or unreadable", p)
+				return nil
+			}
+			data, rErr := os.ReadFile(p)
+			if rErr != nil {
+				log.Printf("[WARN] reading %s: %s", p, rErr)
+				return nil
+			}
+			found(p, kind, data)
+			return nil
+		})
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// scanRemoteFiles calls found with every keystore file under roots on host, copied over ssh as a tar stream.
+func scanRemoteFiles(ctx context.Context, host string, roots []string, types map[string]bool, found func(path string, kind string, data []byte)) error {
+	var names []string
+	if types[localKeystoreJKS] {
+		names = append(names, "-name cacerts")
+	}
+	var kinds []string
+	for t := range types {
+		kinds = append(kinds, t)
+	}
+	sort.Strings(kinds)
+	for _, t := range kinds {
+		for _, ext := range localKeystoreExtensions[t] {
+			names = append(names, "-iname "+shellQuote("*"+ext))
+		}
+	}
+	quoted := make([]string, 0, len(roots))
+	for _, r := range roots {
+		quoted = append(quoted, shellQuote(r))
+	}
+	remote := fmt.Sprintf(`find %s -type f \( %s \) -size -%dk -print0 2>/dev/null | xargs -0 -r tar cf - 2>/dev/null`,
+		strings.Join(quoted, " "), strings.Join(names, " -o "), localScanMaxBytes>>10)
+
+	c := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", host, remote)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] scanning %s over ssh: %s", host, remote)
+	if err := c.Start(); err != nil {
+		return fmt.Errorf("running ssh: %s", err)
+	}
+	tr := tar.NewReader(out)
+	for {
+		hdr, tErr := tr.Next()
+		if tErr == io.EOF {
+			break
+		}
+		if tErr != nil {
+			c.Wait()
+			return fmt.Errorf("reading files of %s: %s: %s", host, tErr, strings.TrimSpace(stderr.String()))
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, rErr := io.ReadAll(tr)
+		if rErr != nil {
+			c.Wait()
+			return fmt.Errorf("reading %s of %s: %s", hdr.Name, host, rErr)
+		}
+		// tar strips the leading / of the absolute roots.
+		p := "/" + strings.TrimPrefix(hdr.Name, "/")
+		found(p, localKeystoreType(p, types), data)
+	}
+	if wErr := c.Wait(); wErr != nil && stderr.Len() > 0 {
+		return fmt.Errorf("scanning %s: %s: %s", host, wErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// localScanRows returns the stores, certs and inventory rows of the keystores found on machine.
+func localScanRows(machine string, keystores []localKeystore) ([][]string, [][]string, [][]string) {
+	stores := [][]string{StoreHeader}
+	inventory := [][]string{LocalInventoryHeader}
+	certs := [][]string{CertHeader}
+	certRows := make(map[string][]string)
+	var thumbprints []string
+	now := GetCurrentTime()
+	for _, ks := range keystores {
+		if ks.Err != nil || len(ks.Certs) == 0 {
+			continue
+		}
+		storeID := fmt.Sprintf("local:%s:%s", machine, ks.Path)
+		// "StoreID", "StoreType", "StoreMachine", "StorePath", "ContainerId", "ContainerName", "LastQueriedDate"
+		stores = append(stores, []string{storeID, localKeystoreStoreTypes[ks.Type], machine, ks.Path, "", "", now})
+		for _, e := range ks.Certs {
+			tp := certThumbprint(e.Cert)
+			inventory = append(inventory, []string{storeID, machine, ks.Path, e.Alias, tp, e.Cert.Subject.String(),
+				e.Cert.Issuer.String(), e.Cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z")})
+			location := fmt.Sprintf("%s:%s\n", machine, ks.Path)
+			row, seen := certRows[tp]
+			if !seen {
+				// "Thumbprint", "SubjectName", "Issuer", "CertID", "Locations", "LastQueriedDate"
+				row = []string{tp, e.Cert.Subject.String(), e.Cert.Issuer.String(), "", "", now}
+				thumbprints = append(thumbprints, tp)
+			}
+			if !strings.Contains(row[4], location) {
+				row[4] += location
+			}
+			certRows[tp] = row
+		}
+	}
+	sort.Strings(thumbprints)
+	for _, tp := range thumbprints {
+		certs = append(certs, certRows[tp])
+	}
+	return stores, certs, inventory
+}
+
+var storesScanLocalCmd = &cobra.Command{
+	Use:   "scan-local --path <dir>",
+	Short: "Inventory the keystore files of a machine that is not a Keyfactor store yet.",
+	Long: `Scans the file system of this machine, or of another machine over ssh with --ssh, for JKS, PKCS#12 and PEM
+keystore files and inventories their certificates, e.g. to audit machines before they are onboarded as Keyfactor
+certificate stores. Writes three files:
+  <prefix>_stores.csv     a stores file of the keystores, with the store types they would be onboarded as
+  <prefix>_certs.csv      a certs file of the certificates found, with the keystores they are in
+  <prefix>_inventory.csv  the certificates of every keystore, with their aliases
+The stores and certs files have the columns of the 'stores rot' templates. Store IDs are local:<machine>:<path>, as
+the keystores are not Keyfactor stores.
+
+JKS keystores are read without a password. PKCS#12 files are opened with the first of --password that works. --ssh
+runs find and tar on the remote machine, which needs absolute --path values and ssh access without a password
+prompt.`,
+	Example: `kfutil stores scan-local --path /etc/pki --path /opt/app/conf --types jks,p12,pem
+kfutil stores scan-local --ssh admin@app01.example.com --path /opt --password changeit --password s3cret --prefix app01`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		roots, _ := cmd.Flags().GetStringSlice("path")
+		typeNames, _ := cmd.Flags().GetStringSlice("types")
+		host, _ := cmd.Flags().GetString("ssh")
+		passwords, _ := cmd.Flags().GetStringArray("password")
+		for _, p := range passwords {
+			if p != jksDefaultPassword {
+				registerSecret(p)
+			}
+		}
+		prefix, _ := cmd.Flags().GetString("prefix")
+
+		types := make(map[string]bool)
+		for _, t := range typeNames {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if t == "pkcs12" || t == "pfx" {
+				t = localKeystoreP12
+			}
+			if _, ok := localKeystoreExtensions[t]; !ok {
+				fmt.Printf("[ERROR] unknown keystore type '%s', must be one of jks, p12 or pem\n", t)
+				log.Fatalf("[ERROR] unknown keystore type: %s", t)
+			}
+			types[t] = true
+		}
+
+		var keystores []localKeystore
+		found := func(p string, kind string, data []byte) {
+			certs, err := parseLocalKeystore(kind, data, passwords)
+			keystores = append(keystores, localKeystore{Path: p, Type: kind, Certs: certs, Err: err})
+		}
+		machine := host
+		if host != "" {
+			if at := strings.LastIndex(machine, "@"); at >= 0 {
+				machine = machine[at+1:]
+			}
+			for _, r := range roots {
+				if !path.IsAbs(r) {
+					fmt.Printf("[ERROR] --path %s must be absolute with --ssh\n", r)
+					log.Fatalf("[ERROR] relative path with --ssh: %s", r)
+				}
+			}
+			if err := scanRemoteFiles(commandContext(cmd), host, roots, types, found); err != nil {
+				exitIfInterrupted(commandContext(cmd), "no files were written")
+				fmt.Printf("[ERROR] %s\n", err)
+				log.Fatalf("[ERROR] %s", err)
+			}
+		} else {
+			machine, _ = os.Hostname()
+			scanLocalFiles(roots, types, found)
+		}
+		exitIfInterrupted(commandContext(cmd), "no files were written")
+		sort.Slice(keystores, func(i, j int) bool { return keystores[i].Path < keystores[j].Path })
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tTYPE\tCERTS\tERROR")
+		failed := 0
+		for _, ks := range keystores {
+			errMsg := ""
+			if ks.Err != nil {
+				errMsg = ks.Err.Error()
+				failed++
+				recordResultFailure("%s: %s", ks.Path, ks.Err)
+			} else if len(ks.Certs) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", ks.Path, ks.Type, len(ks.Certs), errMsg)
+		}
+		w.Flush()
+
+		stores, certs, inventory := localScanRows(machine, keystores)
+		for i, rows := range [][][]string{stores, certs, inventory} {
+			p := fmt.Sprintf("%s_%s.csv", prefix, []string{"stores", "certs", "inventory"}[i])
+			if err := writeOutputFile(p, csvBytes(rows), 0644); err != nil {
+				fmt.Printf("[ERROR] writing %s: %s\n", p, err)
+				log.Fatalf("[ERROR] writing %s: %s", p, err)
+			}
+		}
+		recordResultCount("keystores", len(stores)-1)
+		recordResultCount("certificates", len(certs)-1)
+		printInfo("Found %d keystore(s) with %d distinct certificate(s) on %s, %d could not be read.\n", len(stores)-1, len(certs)-1, machine, failed)
+		printInfo("Wrote %s_stores.csv, %s_certs.csv and %s_inventory.csv\n", prefix, prefix, prefix)
+	},
+}
+
+func init() {
+	storesCmd.AddCommand(storesScanLocalCmd)
+	storesScanLocalCmd.Flags().StringSlice("path", []string{}, "Directory or file to scan. May be repeated.")
+	storesScanLocalCmd.Flags().StringSlice("types", []string{localKeystoreJKS, localKeystoreP12, localKeystorePEM}, "Keystore types to scan for, of jks, p12 and pem.")
+	storesScanLocalCmd.Flags().String("ssh", "", "Scan this machine over ssh instead of the local machine, e.g. admin@app01.example.com.")
+	storesScanLocalCmd.Flags().StringArray("password", []string{"", jksDefaultPassword}, "Password to try to open PKCS#12 files with. May be repeated.")
+	storesScanLocalCmd.Flags().String("prefix", "local_scan", "Path prefix of the files to write.")
+	storesScanLocalCmd.MarkFlagRequired("path")
+}
@@ -0,0 +1,430 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// snapshotFileName is the name of the snapshot file in a snapshot directory.
+const snapshotFileName = "snapshot.json"
+
+type snapshotCert struct {
+	Thumbprint    string `json:"thumbprint"`
+	CertID        int    `json:"cert_id,omitempty"`
+	Alias         string `json:"alias,omitempty"`
+	SubjectName   string `json:"subject_name,omitempty"`
+	Issuer        string `json:"issuer,omitempty"`
+	HasPrivateKey bool   `json:"has_private_key"`
+}
+
+type snapshotStore struct {
+	StoreID      string         `json:"store_id"`
+	StoreType    string         `json:"store_type,omitempty"`
+	Machine      string         `json:"machine,omitempty"`
+	Path         string         `json:"path,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Certificates []snapshotCert `json:"certificates"`
+}
+
+// inventorySnapshot is the inventory of a set of certificate stores at a point in time.
+type inventorySnapshot struct {
+	TakenAt  time.Time       `json:"taken_at"`
+	Hostname string          `json:"hostname"`
+	Stores   []snapshotStore `json:"stores"`
+}
+
+// takeInventorySnapshot reads the inventory of the given stores, or of all stores if storeIDs is empty.
+func takeInventorySnapshot(kfClient *api.Client, storeIDs []string, runner *batchRunner) (*inventorySnapshot, error) {
+	var stores []api.GetCertificateStoreResponse
+	if len(storeIDs) == 0 {
+		params := make(map[string]interface{})
+		all, err := kfClient.ListCertificateStores(&params)
+		if err != nil {
+			return nil, err
+		}
+		stores = *all
+	} else {
+		for _, id := range storeIDs {
+			stores = append(stores, api.GetCertificateStoreResponse{Id: id})
+		}
+	}
+
+	snapshot := &inventorySnapshot{
+		TakenAt:  time.Now().UTC(),
+		Hostname: os.Getenv("KEYFACTOR_HOSTNAME"),
+		Stores:   make([]snapshotStore, len(stores)),
+	}
+	storeTypes := make(map[int]string)
+	runner.run(len(stores), func(i int) error {
+		store := stores[i]
+		s := snapshotStore{StoreID: store.Id, Machine: store.ClientMachine, Path: store.StorePath, Certificates: []snapshotCert{}}
+		if store.ClientMachine == "" {
+			full, err := kfClient.GetCertificateStoreByID(store.Id)
+			if err != nil {
+				s.Error = err.Error()
+				snapshot.Stores[i] = s
+				return err
+			}
+			store = *full
+			s.Machine, s.Path = store.ClientMachine, store.StorePath
+		}
+		s.StoreType = fmt.Sprintf("%d", store.CertStoreType)
+		entries, err := getStoreCompareEntries(kfClient, store.Id)
+		if err != nil {
+			s.Error = err.Error()
+			snapshot.Stores[i] = s
+			return err
+		}
+		for _, e := range entries {
+			s.Certificates = append(s.Certificates, snapshotCert{
+				Thumbprint:    strings.ToUpper(e.Thumbprint),
+				CertID:        e.CertID,
+				Alias:         e.Alias,
+				SubjectName:   e.SubjectName,
+				Issuer:        e.Issuer,
+				HasPrivateKey: e.HasPrivateKey,
+			})
+		}
+		sort.Slice(s.Certificates, func(a, b int) bool {
+			return s.Certificates[a].Thumbprint < s.Certificates[b].Thumbprint
+		})
+		snapshot.Stores[i] = s
+		return nil
+	})
+
+	// Store type names are looked up once per store type.
+	for i, s := range snapshot.Stores {
+		var id int
+		if _, err := fmt.Sscanf(s.StoreType, "%d", &id); err != nil || id == 0 {
+			continue
+		}
+		name, ok := storeTypes[id]
+		if !ok {
+			if st, err := kfClient.GetCertificateStoreType(id); err == nil {
+				name = st.ShortName
+			}
+			storeTypes[id] = name
+		}
+		if name != "" {
+			snapshot.Stores[i].StoreType = name
+		}
+	}
+	sort.Slice(snapshot.Stores, func(a, b int) bool {
+		return snapshot.Stores[a].StoreID < snapshot.Stores[b].StoreID
+	})
+	return snapshot, nil
+}
+
+// readInventorySnapshot reads a snapshot from a snapshot directory or file.
+func readInventorySnapshot(path string) (*inventorySnapshot, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, snapshotFileName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot inventorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %s", path, err)
+	}
+	return &snapshot, nil
+}
+
+// findSnapshots returns the snapshots below dir, oldest first.
+func findSnapshots(dir string) ([]*inventorySnapshot, error) {
+	var snapshots []*inventorySnapshot
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != snapshotFileName {
+			return nil
+		}
+		snapshot, rErr := readInventorySnapshot(path)
+		if rErr != nil {
+			log.Printf("[WARN] skipping %s: %s", path, rErr)
+			return nil
+		}
+		snapshots = append(snapshots, snapshot)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].TakenAt.Before(snapshots[j].TakenAt)
+	})
+	return snapshots, nil
+}
+
+type snapshotStoreDiff struct {
+	StoreID string         `json:"store_id"`
+	Machine string         `json:"machine,omitempty"`
+	Path    string         `json:"path,omitempty"`
+	Status  string         `json:"status"`
+	Added   []snapshotCert `json:"added,omitempty"`
+	Removed []snapshotCert `json:"removed,omitempty"`
+}
+
+type snapshotDiff struct {
+	From   time.Time           `json:"from"`
+	To     time.Time           `json:"to"`
+	Stores []snapshotStoreDiff `json:"stores"`
+}
+
+func snapshotCertsByThumbprint(s snapshotStore) map[string]snapshotCert {
+	certs := make(map[string]snapshotCert, len(s.Certificates))
+	for _, c := range s.Certificates {
+		certs[c.Thumbprint] = c
+	}
+	return certs
+}
+
+// diffInventorySnapshots returns the stores that appeared, disappeared or changed between two snapshots.
+func diffInventorySnapshots(from *inventorySnapshot, to *inventorySnapshot) snapshotDiff {
+	diff := snapshotDiff{From: from.TakenAt, To: to.TakenAt, Stores: []snapshotStoreDiff{}}
+	fromStores := make(map[string]snapshotStore)
+	for _, s := range from.Stores {
+		fromStores[s.StoreID] = s
+	}
+	toStores := make(map[string]bool)
+	for _, s := range to.Stores {
+		toStores[s.StoreID] = true
+		d := snapshotStoreDiff{StoreID: s.StoreID, Machine: s.Machine, Path: s.Path}
+		old, ok := fromStores[s.StoreID]
+		if !ok {
+			d.Status = "new"
+			d.Added = s.Certificates
+			diff.Stores = append(diff.Stores, d)
+			continue
+		}
+		if old.Error != "" || s.Error != "" {
+			// An inventory that could not be read would show up as all certificates changing.
+			continue
+		}
+		oldCerts := snapshotCertsByThumbprint(old)
+		newCerts := snapshotCertsByThumbprint(s)
+		for _, c := range s.Certificates {
+			if _, found := oldCerts[c.Thumbprint]; !found {
+				d.Added = append(d.Added, c)
+			}
+		}
+		for _, c := range old.Certificates {
+			if _, found := newCerts[c.Thumbprint]; !found {
+				d.Removed = append(d.Removed, c)
+			}
+		}
+		if len(d.Added)+len(d.Removed) > 0 {
+			d.Status = "changed"
+			diff.Stores = append(diff.Stores, d)
+		}
+	}
+	for _, s := range from.Stores {
+		if !toStores[s.StoreID] {
+			diff.Stores = append(diff.Stores, snapshotStoreDiff{StoreID: s.StoreID, Machine: s.Machine, Path: s.Path, Status: "deleted", Removed: s.Certificates})
+		}
+	}
+	sort.Slice(diff.Stores, func(i, j int) bool {
+		return diff.Stores[i].StoreID < diff.Stores[j].StoreID
+	})
+	return diff
+}
+
+var storesSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save a timestamped snapshot of certificate store inventories.",
+	Long: `Saves the inventory of certificate stores to <out>/snapshot.json. Snapshots can be compared with
+'stores history diff' and searched with 'stores history cert' to find when a certificate appeared in or disappeared
+from a store.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		all, _ := cmd.Flags().GetBool("all")
+		storeIDs, _ := cmd.Flags().GetStringSlice("store-id")
+		out, _ := cmd.Flags().GetString("out")
+		if !all && len(storeIDs) == 0 {
+			fmt.Println("[ERROR] --all or --store-id is required")
+			log.Fatalf("[ERROR] no stores selected")
+		}
+		if out == "" {
+			out = filepath.Join("snapshots", time.Now().UTC().Format("2006-01-02T150405Z"))
+		}
+
+		kfClient, _ := initClient()
+		runner := newBatchRunnerFromFlags(cmd)
+		snapshot, err := takeInventorySnapshot(kfClient, storeIDs, runner)
+		if err != nil {
+			fmt.Printf("[ERROR] listing certificate stores: %s\n", err)
+			log.Fatalf("[ERROR] listing certificate stores: %s", err)
+		}
+		// A snapshot missing stores would show them as emptied in history diffs.
+		exitIfInterrupted(commandContext(cmd), "no snapshot was written")
+		if !isCloudURL(out) {
+			if mErr := os.MkdirAll(out, 0755); mErr != nil {
+				fmt.Printf("[ERROR] creating %s: %s\n", out, mErr)
+				log.Fatalf("[ERROR] creating snapshot directory: %s", mErr)
+			}
+		}
+		data, _ := json.MarshalIndent(snapshot, "", "  ")
+		path := joinOutputPath(out, snapshotFileName)
+		if wErr := writeOutputFile(path, data, 0644); wErr != nil {
+			fmt.Printf("[ERROR] writing %s: %s\n", path, wErr)
+			log.Fatalf("[ERROR] writing snapshot: %s", wErr)
+		}
+		failed := 0
+		for _, s := range snapshot.Stores {
+			if s.Error != "" {
+				printWarning("Unable to read inventory of store %s: %s\n", s.StoreID, s.Error)
+				failed++
+			}
+		}
+		printInfo("Saved inventory of %d store(s) to %s\n", len(snapshot.Stores)-failed, path)
+	},
+}
+
+var storesHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Compare and search certificate store inventory snapshots.",
+	Long:  `Compare and search certificate store inventory snapshots saved with 'stores snapshot'.`,
+}
+
+var storesHistoryDiffCmd = &cobra.Command{
+	Use:   "diff <from snapshot> <to snapshot>",
+	Short: "Show the certificates added to and removed from stores between two snapshots.",
+	Long: `Show the certificates added to and removed from stores between two snapshots. Snapshots are given as
+snapshot directories or snapshot.json files.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		jsonOut, _ := cmd.Flags().GetBool("json")
+		from, fErr := readInventorySnapshot(args[0])
+		if fErr != nil {
+			fmt.Printf("[ERROR] %s\n", fErr)
+			log.Fatalf("[ERROR] reading snapshot: %s", fErr)
+		}
+		to, tErr := readInventorySnapshot(args[1])
+		if tErr != nil {
+			fmt.Printf("[ERROR] %s\n", tErr)
+			log.Fatalf("[ERROR] reading snapshot: %s", tErr)
+		}
+		diff := diffInventorySnapshots(from, to)
+		if jsonOut {
+			output, _ := json.Marshal(diff)
+			fmt.Printf("%s\n", output)
+			return
+		}
+		fmt.Printf("Changes from %s to %s:\n", diff.From.Format(time.RFC3339), diff.To.Format(time.RFC3339))
+		if len(diff.Stores) == 0 {
+			fmt.Println("  No changes.")
+		}
+		for _, d := range diff.Stores {
+			fmt.Printf("Store %s (%s %s): %s\n", d.StoreID, d.Machine, d.Path, d.Status)
+			for _, c := range d.Added {
+				printAdded("  + %s %s\n", c.Thumbprint, c.SubjectName)
+			}
+			for _, c := range d.Removed {
+				printRemoved("  - %s %s\n", c.Thumbprint, c.SubjectName)
+			}
+		}
+	},
+}
+
+var storesHistoryCertCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Show when a certificate appeared in and disappeared from stores.",
+	Long: `Searches all snapshots below --dir, oldest first, and prints for every store when the certificate was first
+and last seen in it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		dir, _ := cmd.Flags().GetString("dir")
+		thumbprint, _ := cmd.Flags().GetString("thumbprint")
+		thumbprint = strings.ToUpper(thumbprint)
+		snapshots, err := findSnapshots(dir)
+		if err != nil {
+			fmt.Printf("[ERROR] reading snapshots in %s: %s\n", dir, err)
+			log.Fatalf("[ERROR] reading snapshots: %s", err)
+		}
+		if len(snapshots) == 0 {
+			fmt.Printf("[ERROR] no snapshots found in %s\n", dir)
+			log.Fatalf("[ERROR] no snapshots found")
+		}
+
+		type sighting struct {
+			store     snapshotStore
+			firstSeen time.Time
+			lastSeen  time.Time
+			goneAt    time.Time
+		}
+		sightings := make(map[string]*sighting)
+		var order []string
+		for _, snapshot := range snapshots {
+			present := make(map[string]bool)
+			for _, s := range snapshot.Stores {
+				if _, found := snapshotCertsByThumbprint(s)[thumbprint]; !found {
+					continue
+				}
+				present[s.StoreID] = true
+				si, ok := sightings[s.StoreID]
+				if !ok {
+					si = &sighting{store: s, firstSeen: snapshot.TakenAt}
+					sightings[s.StoreID] = si
+					order = append(order, s.StoreID)
+				}
+				si.lastSeen = snapshot.TakenAt
+				si.goneAt = time.Time{}
+			}
+			for id, si := range sightings {
+				if !present[id] && si.goneAt.IsZero() {
+					si.goneAt = snapshot.TakenAt
+				}
+			}
+		}
+		if len(order) == 0 {
+			fmt.Printf("Certificate %s was not found in %d snapshot(s).\n", thumbprint, len(snapshots))
+			return
+		}
+		for _, id := range order {
+			si := sightings[id]
+			fmt.Printf("Store %s (%s %s): first seen %s, last seen %s", id, si.store.Machine, si.store.Path,
+				si.firstSeen.Format(time.RFC3339), si.lastSeen.Format(time.RFC3339))
+			if !si.goneAt.IsZero() {
+				fmt.Printf(", gone at %s", si.goneAt.Format(time.RFC3339))
+			}
+			fmt.Println()
+		}
+	},
+}
+
+func init() {
+	storesCmd.AddCommand(storesSnapshotCmd)
+	storesSnapshotCmd.Flags().Bool("all", false, "Snapshot all certificate stores.")
+	storesSnapshotCmd.Flags().StringSlice("store-id", []string{}, "IDs of the certificate stores to snapshot.")
+	storesSnapshotCmd.Flags().String("out", "",
+		"Directory to save the snapshot to, or an s3://, az:// or gs:// URL prefix to upload it to. Defaults to snapshots/<timestamp>.")
+	addBatchFlags(storesSnapshotCmd)
+	storesSnapshotCmd.MarkFlagsMutuallyExclusive("all", "store-id")
+
+	storesCmd.AddCommand(storesHistoryCmd)
+	storesHistoryCmd.AddCommand(storesHistoryDiffCmd)
+	storesHistoryDiffCmd.Flags().Bool("json", false, "Output as JSON.")
+	storesHistoryCmd.AddCommand(storesHistoryCertCmd)
+	storesHistoryCertCmd.Flags().String("dir", "snapshots", "Directory containing the snapshots.")
+	storesHistoryCertCmd.Flags().String("thumbprint", "", "Thumbprint of the certificate.")
+	storesHistoryCertCmd.MarkFlagRequired("thumbprint")
+}
@@ -0,0 +1,293 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+)
+
+// storeFilter is a single client side filter expression in the form `<field>=<value>` (exact match) or
+// `<field>~<pattern>` (glob match) applied against certificate store fields.
+type storeFilter struct {
+	Field   string
+	Pattern string
+	Glob    bool
+}
+
+type storePropertyUpdate struct {
+	StoreId       string
+	ClientMachine string
+	StorePath     string
+	Before        map[string]interface{}
+	Error         error
+	// Skipped is set when the update never ran because the command was interrupted.
+	Skipped bool
+}
+
+// parseStoreFilter parses a `--query` expression such as `machine~"web*"` or `path=/etc/ssl/certs`.
+func parseStoreFilter(expr string) (storeFilter, error) {
+	idx := strings.IndexAny(expr, "=~")
+	if idx <= 0 {
+		return storeFilter{}, fmt.Errorf("invalid query '%s', expected <field>=<value> or <field>~<pattern>", expr)
+	}
+	field := strings.ToLower(strings.TrimSpace(expr[:idx]))
+	switch field {
+	case "machine", "path", "container", "agent":
+	default:
+		return storeFilter{}, fmt.Errorf("invalid query field '%s', must be one of machine, path, container or agent", field)
+	}
+	return storeFilter{
+		Field:   field,
+		Pattern: strings.Trim(strings.TrimSpace(expr[idx+1:]), `"'`),
+		Glob:    expr[idx] == '~',
+	}, nil
+}
+
+func (f storeFilter) matches(store api.GetCertificateStoreResponse) bool {
+	var value string
+	switch f.Field {
+	case "machine":
+		value = store.ClientMachine
+	case "path":
+		value = store.StorePath
+	case "container":
+		value = store.ContainerName
+	case "agent":
+		value = store.AgentId
+	}
+	if !f.Glob {
+		return strings.EqualFold(value, f.Pattern)
+	}
+	matched, err := path.Match(strings.ToLower(f.Pattern), strings.ToLower(value))
+	return err == nil && matched
+}
+
+// buildStoreUpdateArgs converts a certificate store into update arguments with the given property values applied.
+func buildStoreUpdateArgs(store *api.GetCertificateStoreResponse, set map[string]string) *api.UpdateStoreFctArgs {
+	properties := make(map[string]interface{}, len(store.Properties)+len(set))
+	for name, value := range store.Properties {
+		if _, isSecret := value.(map[string]interface{}); isSecret {
+			properties[name] = ParseSecretField(value)
+			continue
+		}
+		properties[name] = value
+	}
+	for name, value := range set {
+		properties[name] = value
+	}
+	return &api.UpdateStoreFctArgs{
+		Id: store.Id,
+		CreateStoreFctArgs: api.CreateStoreFctArgs{
+			ContainerId:           intToPointer(store.ContainerId),
+			ClientMachine:         store.ClientMachine,
+			StorePath:             store.StorePath,
+			CertStoreType:         store.CertStoreType,
+			Approved:              boolToPointer(store.Approved),
+			CreateIfMissing:       boolToPointer(store.CreateIfMissing),
+			Properties:            properties,
+			AgentId:               store.AgentId,
+			AgentAssigned:         boolToPointer(store.AgentAssigned),
+			InventorySchedule:     &store.InventorySchedule,
+			SetNewPasswordAllowed: boolToPointer(store.SetNewPasswordAllowed),
+		},
+	}
+}
+
+var storesUpdatePropertiesCmd = &cobra.Command{
+	Use:   "update-properties",
+	Short: "Update a property across many certificate stores.",
+	Long: `Update one or more properties on every certificate store of a given type that matches the provided filters.
+Filters are given with --query as <field>=<value> for an exact match or <field>~<pattern> for a glob match, where
+field is one of machine, path, container or agent. Multiple --query flags must all match.
+
+Example: kfutil stores update-properties --store-type RFPEM --set LinuxFilePermissions=600 --query machine~"web*"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		storeTypeFlag, _ := cmd.Flags().GetString("store-type")
+		setFlags, _ := cmd.Flags().GetStringArray("set")
+		queryFlags, _ := cmd.Flags().GetStringArray("query")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if cmd.Flags().Changed("workers") && !cmd.Flags().Changed("concurrency") {
+			workers, _ := cmd.Flags().GetInt("workers")
+			cmd.Flags().Set("concurrency", strconv.Itoa(workers))
+		}
+
+		set := make(map[string]string, len(setFlags))
+		for _, s := range setFlags {
+			name, value, ok := strings.Cut(s, "=")
+			if !ok || name == "" {
+				fmt.Printf("Error: invalid --set value '%s', expected <property>=<value>\n", s)
+				log.Fatalf("[ERROR] invalid --set value '%s'", s)
+			}
+			set[name] = value
+		}
+		var filters []storeFilter
+		for _, q := range queryFlags {
+			f, fErr := parseStoreFilter(q)
+			if fErr != nil {
+				fmt.Printf("Error: %s\n", fErr)
+				log.Fatalf("[ERROR] %s", fErr)
+			}
+			filters = append(filters, f)
+		}
+
+		kfClient, _ := initClient()
+		var st interface{} = storeTypeFlag
+		if id, convErr := strconv.Atoi(storeTypeFlag); convErr == nil {
+			st = id
+		}
+		storeType, stErr := kfClient.GetCertificateStoreType(st)
+		if stErr != nil {
+			fmt.Printf("Error retrieving store type '%s': %s\n", storeTypeFlag, stErr)
+			log.Fatalf("[ERROR] retrieving store type '%s': %s", storeTypeFlag, stErr)
+		}
+		validProps := map[string]bool{"ServerUsername": storeType.ServerRequired, "ServerPassword": storeType.ServerRequired}
+		if storeType.Properties != nil {
+			for _, prop := range *storeType.Properties {
+				validProps[prop.Name] = true
+			}
+		}
+		for name := range set {
+			if !validProps[name] {
+				fmt.Printf("Error: '%s' is not a property of store type '%s'\n", name, storeType.ShortName)
+				log.Fatalf("[ERROR] '%s' is not a property of store type '%s'", name, storeType.ShortName)
+			}
+		}
+
+		query := map[string]interface{}{"Category": storeType.StoreType}
+		storeList, lErr := kfClient.ListCertificateStores(&query)
+		if lErr != nil {
+			fmt.Printf("Error listing certificate stores: %s\n", lErr)
+			log.Fatalf("[ERROR] listing certificate stores: %s", lErr)
+		}
+		var matched []api.GetCertificateStoreResponse
+		for _, store := range *storeList {
+			if store.CertStoreType != storeType.StoreType {
+				continue
+			}
+			include := true
+			for _, f := range filters {
+				if !f.matches(store) {
+					include = false
+					break
+				}
+			}
+			if include {
+				matched = append(matched, store)
+			}
+		}
+		if len(matched) == 0 {
+			printInfo("No certificate stores matched the given filters.\n")
+			return
+		}
+
+		runner := newBatchRunnerFromFlags(cmd)
+		results := make([]storePropertyUpdate, len(matched))
+		errs := runner.run(len(matched), func(i int) error {
+			storeId := matched[i].Id
+			result := storePropertyUpdate{StoreId: storeId, Before: make(map[string]interface{})}
+			store, gErr := kfClient.GetCertificateStoreByID(storeId)
+			if gErr != nil {
+				result.Error = gErr
+			} else {
+				result.ClientMachine = store.ClientMachine
+				result.StorePath = store.StorePath
+				for name := range set {
+					result.Before[name] = store.Properties[name]
+				}
+				if !dryRun {
+					_, result.Error = kfClient.UpdateStore(buildStoreUpdateArgs(store, set))
+				}
+			}
+			results[i] = result
+			return result.Error
+		})
+		for i, rErr := range errs {
+			if isCancelled(rErr) || results[i].StoreId == "" {
+				results[i] = storePropertyUpdate{StoreId: matched[i].Id, ClientMachine: matched[i].ClientMachine, StorePath: matched[i].StorePath, Skipped: true}
+			}
+		}
+
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].ClientMachine+results[i].StorePath < results[j].ClientMachine+results[j].StorePath
+		})
+		names := make([]string, 0, len(set))
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		failed, skipped := 0, 0
+		for _, r := range results {
+			if r.Skipped {
+				skipped++
+				printWarning("[SKIPPED] %s (%s:%s)\n", r.StoreId, r.ClientMachine, r.StorePath)
+				continue
+			}
+			if r.Error != nil {
+				failed++
+				fmt.Printf("%s[FAILED]%s %s (%s:%s): %s\n", colorRed, colorWhite, r.StoreId, r.ClientMachine, r.StorePath, r.Error)
+				continue
+			}
+			status := "[UPDATED]"
+			if dryRun {
+				status = "[DRY RUN]"
+			}
+			printAdded("%s %s (%s:%s)\n", status, r.StoreId, r.ClientMachine, r.StorePath)
+			for _, name := range names {
+				before := r.Before[name]
+				if before == nil {
+					before = ""
+				}
+				printInfo("    %s: '%v' -> '%s'\n", name, before, set[name])
+			}
+		}
+		if dryRun {
+			fmt.Printf("\n%d store(s) would be updated.\n", len(results)-failed-skipped)
+		} else {
+			fmt.Printf("\n%d store(s) updated, %d failed.\n", len(results)-failed-skipped, failed)
+		}
+		if skipped > 0 {
+			printWarning("%d store(s) skipped because the command was interrupted.\n", skipped)
+		}
+		runner.printStats()
+		exitIfInterrupted(commandContext(cmd), "stores not yet updated were left unchanged")
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	var (
+		storeType string
+		set       []string
+		query     []string
+		dryRun    bool
+		workers   int
+	)
+	storesCmd.AddCommand(storesUpdatePropertiesCmd)
+	storesUpdatePropertiesCmd.Flags().StringVarP(&storeType, "store-type", "t", "", "Short name or ID of the certificate store type to update.")
+	storesUpdatePropertiesCmd.Flags().StringArrayVarP(&set, "set", "s", []string{}, "Property to set in the form <property>=<value>. May be repeated.")
+	storesUpdatePropertiesCmd.Flags().StringArrayVarP(&query, "query", "q", []string{}, "Store filter in the form <field>=<value> or <field>~<pattern>. May be repeated.")
+	storesUpdatePropertiesCmd.Flags().BoolVar(&dryRun, "dry-run", false, "List matching stores with before and after values without updating them.")
+	addBatchFlags(storesUpdatePropertiesCmd)
+	storesUpdatePropertiesCmd.Flags().IntVar(&workers, "workers", defaultBatchConcurrency, "Number of stores to update concurrently.")
+	storesUpdatePropertiesCmd.Flags().MarkDeprecated("workers", "use --concurrency instead")
+	storesUpdatePropertiesCmd.MarkFlagRequired("store-type")
+	storesUpdatePropertiesCmd.MarkFlagRequired("set")
+}
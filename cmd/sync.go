@@ -0,0 +1,350 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+const (
+	syncActionCreate = "create"
+	syncActionUpdate = "update"
+	syncActionNone   = "unchanged"
+)
+
+// syncIgnoredFields are instance specific identifiers which are expected to differ between Keyfactor instances and are
+// ignored when comparing definitions.
+var syncIgnoredFields = map[string]bool{
+	"Id":          true,
+	"StoreType":   true,
+	"StoreTypeId": true,
+	"StoreCount":  true,
+}
+
+type syncPlanItem struct {
+	Name    string
+	Action  string
+	Fields  []string
+	Source  map[string]interface{}
+	DestId  interface{}
+	Comment string
+}
+
+// profileConfigPath resolves a profile name to a config file. The `default` profile is the config written by
+// `kfutil login`, a path to an existing file is used as is, anything else is looked up as
+// `$HOME/.keyfactor/<profile>.json`.
+func profileConfigPath(profile string) string {
+	userHomeDir, hErr := os.UserHomeDir()
+	if hErr != nil {
+		fmt.Println("Error getting user home directory: ", hErr)
+	}
+	if profile == "" || profile == "default" {
+		return fmt.Sprintf("%s/.keyfactor/%s", userHomeDir, DefaultConfigFileName)
+	}
+	if _, err := os.Stat(profile); err == nil {
+		return profile
+	}
+	return fmt.Sprintf("%s/.keyfactor/%s.json", userHomeDir, profile)
+}
+
+func initProfileGenClient(profile string) (*keyfactor.APIClient, string) {
+	path := profileConfigPath(profile)
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("Error reading profile '%s' from %s: %s\n", profile, path, err)
+		log.Fatalf("[ERROR] reading profile '%s': %s", profile, err)
+	}
+	config := loadConfigFile(path, nil)
+	if config["host"] == "" {
+		fmt.Printf("Error: profile '%s' (%s) does not define a host.\n", profile, path)
+		log.Fatalf("[ERROR] profile '%s' does not define a host", profile)
+	}
+	return keyfactor.NewAPIClient(keyfactor.NewConfiguration(config)), config["host"]
+}
+
+// normalizeSyncObject converts an API model to a generic map with instance specific identifiers removed.
+func normalizeSyncObject(obj interface{}) map[string]interface{} {
+	jsonData, _ := json.Marshal(obj)
+	var m map[string]interface{}
+	json.Unmarshal(jsonData, &m)
+	return stripSyncFields(m).(map[string]interface{})
+}
+
+func stripSyncFields(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if syncIgnoredFields[k] {
+				continue
+			}
+			out[k] = stripSyncFields(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = stripSyncFields(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// diffSyncObjects returns the sorted top level fields that differ between the source and destination definitions.
+func diffSyncObjects(source map[string]interface{}, dest map[string]interface{}) []string {
+	var fields []string
+	for k, v := range source {
+		if !reflect.DeepEqual(v, dest[k]) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func printSyncPlan(kind string, srcHost string, destHost string, plan []syncPlanItem) (int, int) {
+	creates, updates := 0, 0
+	fmt.Printf("Sync plan for %s from %s to %s:\n", kind, srcHost, destHost)
+	for _, item := range plan {
+		switch item.Action {
+		case syncActionCreate:
+			creates++
+			fmt.Printf("  + %s (create)\n", item.Name)
+		case syncActionUpdate:
+			updates++
+			fmt.Printf("  ~ %s (update: %s)\n", item.Name, strings.Join(item.Fields, ", "))
+		default:
+			fmt.Printf("  = %s\n", item.Name)
+		}
+		if item.Comment != "" {
+			fmt.Printf("      %s\n", item.Comment)
+		}
+	}
+	fmt.Printf("%d to create, %d to update, %d unchanged.\n\n", creates, updates, len(plan)-creates-updates)
+	return creates, updates
+}
+
+func getSyncStoreTypes(sdkClient *keyfactor.APIClient, host string) map[string]keyfactor.KeyfactorApiModelsCertificateStoresTypesCertificateStoreTypeResponse {
+	types, httpResponse, errors := sdkClient.CertificateStoreTypeApi.CertificateStoreTypeGetTypes(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if errors != nil {
+		WriteApiError(fmt.Sprintf("List store types on %s", host), httpResponse, errors)
+		fmt.Println()
+		log.Fatalf("[ERROR] listing store types on %s: %s", host, errors)
+	}
+	typeMap := make(map[string]keyfactor.KeyfactorApiModelsCertificateStoresTypesCertificateStoreTypeResponse, len(types))
+	for _, t := range types {
+		typeMap[t.GetShortName()] = t
+	}
+	return typeMap
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Synchronize definitions between Keyfactor instances.",
+	Long: `Synchronize definitions such as certificate store types and containers from one Keyfactor instance to another.
+Instances are referenced by profile: 'default' is the config written by 'kfutil login', a path to an existing config
+file is used as is, and any other name is read from $HOME/.keyfactor/<profile>.json.`,
+}
+
+var syncStoreTypesCmd = &cobra.Command{
+	Use:   "store-types",
+	Short: "Synchronize certificate store types from one Keyfactor instance to another.",
+	Long: `Reads certificate store type definitions from the source instance, compares them by short name with the
+destination instance and creates missing or updates changed store types on the destination. The plan is always
+printed before changes are applied. Use --dry-run to only print the plan.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		srcProfile, _ := cmd.Flags().GetString("source-profile")
+		destProfile, _ := cmd.Flags().GetString("dest-profile")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		srcClient, srcHost := initProfileGenClient(srcProfile)
+		destClient, destHost := initProfileGenClient(destProfile)
+		srcTypes := getSyncStoreTypes(srcClient, srcHost)
+		destTypes := getSyncStoreTypes(destClient, destHost)
+
+		names := make([]string, 0, len(srcTypes))
+		for name := range srcTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var plan []syncPlanItem
+		for _, name := range names {
+			src := normalizeSyncObject(srcTypes[name])
+			dest, exists := destTypes[name]
+			if !exists {
+				plan = append(plan, syncPlanItem{Name: name, Action: syncActionCreate, Source: src})
+				continue
+			}
+			fields := diffSyncObjects(src, normalizeSyncObject(dest))
+			if len(fields) == 0 {
+				plan = append(plan, syncPlanItem{Name: name, Action: syncActionNone})
+				continue
+			}
+			plan = append(plan, syncPlanItem{Name: name, Action: syncActionUpdate, Fields: fields, Source: src, DestId: dest.GetStoreType()})
+		}
+
+		creates, updates := printSyncPlan("store types", srcHost, destHost, plan)
+		if dryRun || creates+updates == 0 {
+			return
+		}
+
+		failed := 0
+		for _, item := range plan {
+			var aErr error
+			jsonData, _ := json.Marshal(item.Source)
+			switch item.Action {
+			case syncActionCreate:
+				var createReq keyfactor.KeyfactorApiModelsCertificateStoresTypesCertificateStoreTypeCreationRequest
+				if aErr = json.Unmarshal(jsonData, &createReq); aErr == nil {
+					_, _, aErr = destClient.CertificateStoreTypeApi.CertificateStoreTypeCreateCertificateStoreType(context.Background()).
+						XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+						CertStoreType(createReq).
+						Execute()
+				}
+			case syncActionUpdate:
+				item.Source["StoreType"] = item.DestId
+				jsonData, _ = json.Marshal(item.Source)
+				var updateReq keyfactor.KeyfactorApiModelsCertificateStoresTypesCertificateStoreTypeUpdateRequest
+				if aErr = json.Unmarshal(jsonData, &updateReq); aErr == nil {
+					_, _, aErr = destClient.CertificateStoreTypeApi.CertificateStoreTypeUpdateCertificateStoreType(context.Background()).
+						XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+						CertStoreType(updateReq).
+						Execute()
+				}
+			default:
+				continue
+			}
+			if aErr != nil {
+				failed++
+				fmt.Printf("%s[FAILED]%s %s %s: %s\n", colorRed, colorWhite, item.Action, item.Name, aErr)
+				continue
+			}
+			fmt.Printf("[%s] %s\n", strings.ToUpper(item.Action), item.Name)
+		}
+		fmt.Printf("\n%d store type(s) synchronized, %d failed.\n", creates+updates-failed, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+var syncContainersCmd = &cobra.Command{
+	Use:   "containers",
+	Short: "Compare certificate store containers between Keyfactor instances.",
+	Long: `Reads certificate store containers from the source instance and compares them by name with the destination
+instance. Container store types are matched by short name. The Keyfactor API clients used by kfutil do not support
+creating or updating containers, so the plan must be applied manually.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		srcProfile, _ := cmd.Flags().GetString("source-profile")
+		destProfile, _ := cmd.Flags().GetString("dest-profile")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		srcClient, srcHost := initProfileGenClient(srcProfile)
+		destClient, destHost := initProfileGenClient(destProfile)
+
+		// Container store types are instance specific IDs, map them to short names for comparison.
+		typeNames := func(types map[string]keyfactor.KeyfactorApiModelsCertificateStoresTypesCertificateStoreTypeResponse) map[int32]string {
+			byId := make(map[int32]string, len(types))
+			for name, t := range types {
+				byId[t.GetStoreType()] = name
+			}
+			return byId
+		}
+		srcTypeNames := typeNames(getSyncStoreTypes(srcClient, srcHost))
+		destTypeNames := typeNames(getSyncStoreTypes(destClient, destHost))
+		destTypeSet := make(map[string]bool, len(destTypeNames))
+		for _, name := range destTypeNames {
+			destTypeSet[name] = true
+		}
+
+		listContainers := func(sdkClient *keyfactor.APIClient, host string, names map[int32]string) map[string]map[string]interface{} {
+			containers, httpResponse, errors := sdkClient.CertificateStoreContainerApi.CertificateStoreContainerGetAllCertificateStoreContainers(context.Background()).
+				XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+				Execute()
+			if errors != nil {
+				WriteApiError(fmt.Sprintf("List containers on %s", host), httpResponse, errors)
+				fmt.Println()
+				log.Fatalf("[ERROR] listing containers on %s: %s", host, errors)
+			}
+			containerMap := make(map[string]map[string]interface{}, len(containers))
+			for _, c := range containers {
+				normalized := normalizeSyncObject(c)
+				normalized["CertStoreType"] = names[c.GetCertStoreType()]
+				containerMap[c.GetName()] = normalized
+			}
+			return containerMap
+		}
+		srcContainers := listContainers(srcClient, srcHost, srcTypeNames)
+		destContainers := listContainers(destClient, destHost, destTypeNames)
+
+		names := make([]string, 0, len(srcContainers))
+		for name := range srcContainers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var plan []syncPlanItem
+		for _, name := range names {
+			src := srcContainers[name]
+			dest, exists := destContainers[name]
+			if !exists {
+				item := syncPlanItem{Name: name, Action: syncActionCreate}
+				if !destTypeSet[fmt.Sprintf("%v", src["CertStoreType"])] {
+					item.Comment = fmt.Sprintf("store type '%v' does not exist on destination, run 'kfutil sync store-types' first", src["CertStoreType"])
+				}
+				plan = append(plan, item)
+				continue
+			}
+			fields := diffSyncObjects(src, dest)
+			if len(fields) == 0 {
+				plan = append(plan, syncPlanItem{Name: name, Action: syncActionNone})
+				continue
+			}
+			plan = append(plan, syncPlanItem{Name: name, Action: syncActionUpdate, Fields: fields})
+		}
+
+		creates, updates := printSyncPlan("containers", srcHost, destHost, plan)
+		if !dryRun && creates+updates > 0 {
+			fmt.Println("Creating and updating certificate store containers is not supported by the Keyfactor API client, apply the plan above manually.")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	var (
+		srcProfile  string
+		destProfile string
+		dryRun      bool
+	)
+	RootCmd.AddCommand(syncCmd)
+	for _, c := range []*cobra.Command{syncStoreTypesCmd, syncContainersCmd} {
+		syncCmd.AddCommand(c)
+		c.Flags().StringVar(&srcProfile, "source-profile", "", "Profile of the Keyfactor instance to read definitions from.")
+		c.Flags().StringVar(&destProfile, "dest-profile", "", "Profile of the Keyfactor instance to write definitions to.")
+		c.Flags().BoolVar(&dryRun, "dry-run", false, "Print the sync plan without applying it.")
+		c.MarkFlagRequired("source-profile")
+		c.MarkFlagRequired("dest-profile")
+	}
+}
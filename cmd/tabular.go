@@ -0,0 +1,346 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// columnAliases maps alternative header names to the canonical column names used in the CSV headers written by kfutil.
+// Header names are compared after normalizeColumnName.
+var columnAliases = map[string][]string{
+	"StoreID":      {"id", "store", "storeid", "certificatestoreid"},
+	"StoreType":    {"type", "storetypename", "certstoretype"},
+	"StoreMachine": {"machine", "clientmachine"},
+	"Machine":      {"storemachine", "clientmachine"},
+	"StorePath":    {"path"},
+	"Path":         {"storepath"},
+	"Thumbprint":   {"tp", "sha1", "fingerprint"},
+	"CertID":       {"id", "certificateid"},
+	"SubjectName":  {"subject", "cn", "issueddn"},
+	"Issuer":       {"issuerdn"},
+	"SerialNumber": {"serial", "serialno"},
+}
+
+// tabularRow is a data row of a tabular input file, keyed by canonical column name.
+type tabularRow struct {
+	Line int
+	// Extra holds the values of header columns that are not one of the requested columns, keyed by header name.
+	Extra  map[string]string
+	values map[string]string
+}
+
+// Get returns the value of column, or an empty string if the file does not have the column.
+func (r tabularRow) Get(column string) string {
+	return r.values[column]
+}
+
+// Values returns the values of columns in order, e.g. to rebuild a row in the layout of a kfutil CSV header.
+func (r tabularRow) Values(columns []string) []string {
+	out := make([]string, len(columns))
+	for i, c := range columns {
+		out[i] = r.values[c]
+	}
+	return out
+}
+
+// tabularRowError is a problem with a single row of a tabular input file.
+type tabularRowError struct {
+	Line int
+	Err  error
+}
+
+func (e tabularRowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// tabularFile is a parsed tabular input file.
+type tabularFile struct {
+	Path      string
+	Delimiter rune
+	HasHeader bool
+	Rows      []tabularRow
+	Errors    []tabularRowError
+}
+
+// reportErrors prints the row errors of the file.
+func (t *tabularFile) reportErrors() {
+	for _, e := range t.Errors {
+		fmt.Printf("[ERROR] %s %s\n", t.Path, e)
+		log.Printf("[ERROR] %s %s", t.Path, e)
+	}
+}
+
+func normalizeColumnName(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "", ".", "").Replace(strings.TrimSpace(name)))
+}
+
+// detectDelimiter returns the most frequent of comma, semicolon and tab outside of quotes in the first line of data.
+func detectDelimiter(data []byte) rune {
+	counts := map[rune]int{',': 0, ';': 0, '\t': 0}
+	inQuotes := false
+	for _, c := range string(data) {
+		if c == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if c == '\n' && !inQuotes {
+			break
+		}
+		if _, ok := counts[c]; ok && !inQuotes {
+			counts[c]++
+		}
+	}
+	delimiter := ','
+	for _, d := range []rune{';', '\t'} {
+		if counts[d] > counts[delimiter] {
+			delimiter = d
+		}
+	}
+	return delimiter
+}
+
+// matchColumn returns the canonical column a header cell refers to. Mappings of the --schema-map file come first.
+func matchColumn(header string, columns []string) (string, bool) {
+	if c, ok := schemaMapColumn(header, columns); ok {
+		return c, true
+	}
+	normalized := normalizeColumnName(header)
+	for _, c := range columns {
+		if normalizeColumnName(c) == normalized {
+			return c, true
+		}
+	}
+	for _, c := range columns {
+		for _, alias := range columnAliases[c] {
+			if alias == normalized {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+// readTabularFile reads a delimited, JSON or .xlsx file, or stdin if path is '-', with columns in any order. The delimiter of delimited files is
+// detected and a UTF-8 BOM is ignored. Header names are matched case-insensitively against columns and their aliases,
+// and unknown columns are ignored. If the first row matches none of the columns the file is treated as headerless,
+// with columns in the given order. Rows that cannot be parsed or lack a value for a required column are reported in
+// Errors and skipped.
+func readTabularFile(path string, columns []string, required []string) (*tabularFile, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	return readTabularData(path, data, columns, required)
+}
+
+// readTabularData parses the data of a tabular input file read from path, see readTabularFile.
+func readTabularData(path string, data []byte, columns []string, required []string) (*tabularFile, error) {
+	result := &tabularFile{Path: path}
+	var next func() ([]string, int, error)
+	if isXlsxPath(path) || isXlsxData(data) || isJSONData(data) {
+		var rows [][]string
+		var rErr error
+		if isJSONData(data) {
+			rows, rErr = readJSONRows(data)
+		} else {
+			rows, rErr = readXlsxData(data)
+		}
+		if rErr != nil {
+			return nil, fmt.Errorf("%s: %s", path, rErr)
+		}
+		i := 0
+		next = func() ([]string, int, error) {
+			for ; i < len(rows); i++ {
+				if strings.Join(rows[i], "") != "" {
+					i++
+					return rows[i-1], i, nil
+				}
+			}
+			return nil, 0, io.EOF
+		}
+	} else {
+		data = bytes.TrimPrefix(data, utf8BOM)
+		result.Delimiter = detectDelimiter(data)
+
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.Comma = result.Delimiter
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		next = func() ([]string, int, error) {
+			record, rErr := reader.Read()
+			if rErr != nil {
+				return nil, 0, rErr
+			}
+			line, _ := reader.FieldPos(0)
+			return record, line, nil
+		}
+	}
+
+	var mapping, extraColumns []string
+	for {
+		record, line, rErr := next()
+		if rErr == io.EOF {
+			break
+		}
+		if rErr != nil {
+			var parseErr *csv.ParseError
+			if errors.As(rErr, &parseErr) {
+				result.Errors = append(result.Errors, tabularRowError{Line: parseErr.StartLine, Err: parseErr.Err})
+				continue
+			}
+			return nil, rErr
+		}
+
+		if mapping == nil {
+			mapping = make([]string, len(record))
+			extraColumns = make([]string, len(record))
+			matched := 0
+			for i, cell := range record {
+				if c, ok := matchColumn(cell, columns); ok {
+					mapping[i] = c
+					matched++
+				} else {
+					extraColumns[i] = strings.TrimSpace(cell)
+				}
+			}
+			if matched > 0 {
+				result.HasHeader = true
+				var missing []string
+				for _, req := range required {
+					found := false
+					for _, c := range mapping {
+						found = found || c == req
+					}
+					if !found {
+						missing = append(missing, req)
+					}
+				}
+				if len(missing) > 0 {
+					return nil, fmt.Errorf("%s is missing required column(s) %s", path, strings.Join(missing, ", "))
+				}
+				continue
+			}
+			// Headerless file, columns are positional.
+			mapping = columns
+			extraColumns = nil
+		}
+
+		row := tabularRow{Line: line, values: make(map[string]string, len(mapping))}
+		for i, value := range record {
+			if i < len(mapping) && mapping[i] != "" {
+				row.values[mapping[i]] = strings.TrimSpace(value)
+			} else if i < len(extraColumns) && extraColumns[i] != "" && strings.TrimSpace(value) != "" {
+				if row.Extra == nil {
+					row.Extra = make(map[string]string)
+				}
+				row.Extra[extraColumns[i]] = strings.TrimSpace(value)
+			}
+		}
+		var missing []string
+		for _, req := range required {
+			if row.values[req] == "" {
+				missing = append(missing, req)
+			}
+		}
+		if len(missing) > 0 {
+			result.Errors = append(result.Errors, tabularRowError{Line: line, Err: fmt.Errorf("missing value for %s", strings.Join(missing, ", "))})
+			continue
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
+
+// isJSONData reports whether data is a JSON array or object rather than delimited text.
+func isJSONData(data []byte) bool {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM))
+	return len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') && json.Valid(trimmed)
+}
+
+// readJSONRows returns the rows of a JSON array, or of the only array of a JSON object such as {"stores": [...]}. An
+// array of objects becomes a header row of the sorted keys followed by a row per object, an array of strings a
+// headerless single column.
+func readJSONRows(data []byte) ([][]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if obj, ok := doc.(map[string]interface{}); ok {
+		var arrays []interface{}
+		for _, v := range obj {
+			if a, isArray := v.([]interface{}); isArray {
+				arrays = append(arrays, a)
+			}
+		}
+		if len(arrays) != 1 {
+			return nil, fmt.Errorf("expected a JSON array or an object with one array")
+		}
+		doc = arrays[0]
+	}
+	items, _ := doc.([]interface{})
+	keys := make(map[string]bool)
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok {
+			for k := range obj {
+				keys[k] = true
+			}
+		}
+	}
+	if len(keys) == 0 {
+		rows := make([][]string, 0, len(items))
+		for _, item := range items {
+			rows = append(rows, []string{jsonCellValue(item)})
+		}
+		return rows, nil
+	}
+	header := make([]string, 0, len(keys))
+	for k := range keys {
+		header = append(header, k)
+	}
+	sort.Strings(header)
+	rows := [][]string{header}
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array of objects, found %v", item)
+		}
+		row := make([]string, len(header))
+		for i, k := range header {
+			row[i] = jsonCellValue(obj[k])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// jsonCellValue returns a JSON value as a cell value.
+func jsonCellValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,140 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want rune
+	}{
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"semicolon", "a;b;c\n1;2;3\n", ';'},
+		{"tab", "a\tb\tc\n1\t2\t3\n", '\t'},
+		{"single column", "a\n1\n", ','},
+		{"quoted delimiters ignored", "\"a;b;c\",d,e\n", ','},
+		{"first line only", "a;b\n1,2,3,4\n", ';'},
+		{"quoted line break", "\"a\n,,,\";b;c\n", ';'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDelimiter([]byte(tt.data)); got != tt.want {
+				t.Errorf("detectDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTabularTestFile writes data to a file in a temporary directory and returns its path.
+func writeTabularTestFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTabularFile(t *testing.T) {
+	columns := []string{"Thumbprint", "CertID", "SubjectName"}
+	tests := []struct {
+		name          string
+		data          string
+		required      []string
+		wantDelimiter rune
+		wantHeader    bool
+		wantRows      [][]string
+		wantErrLines  []int
+	}{
+		{
+			name:          "header in any order",
+			data:          "CertID,Thumbprint\n1,AAA\n",
+			wantDelimiter: ',',
+			wantHeader:    true,
+			wantRows:      [][]string{{"AAA", "1", ""}},
+		},
+		{
+			name:          "BOM ignored",
+			data:          "\xEF\xBB\xBFThumbprint;CertID\nAAA;1\n",
+			wantDelimiter: ';',
+			wantHeader:    true,
+			wantRows:      [][]string{{"AAA", "1", ""}},
+		},
+		{
+			name:          "aliases and case",
+			data:          "SHA1\tcertificate_id\tCN\nAAA\t1\texample.com\n",
+			wantDelimiter: '\t',
+			wantHeader:    true,
+			wantRows:      [][]string{{"AAA", "1", "example.com"}},
+		},
+		{
+			name:          "headerless is positional",
+			data:          "AAA,1,example.com\nBBB,2\n",
+			wantDelimiter: ',',
+			wantHeader:    false,
+			wantRows:      [][]string{{"AAA", "1", "example.com"}, {"BBB", "2", ""}},
+		},
+		{
+			name:          "unknown columns ignored",
+			data:          "Thumbprint,Owner\nAAA,team-a\n",
+			wantDelimiter: ',',
+			wantHeader:    true,
+			wantRows:      [][]string{{"AAA", "", ""}},
+		},
+		{
+			name:          "rows missing required values",
+			data:          "Thumbprint,CertID\nAAA,1\n,2\nCCC,3\n",
+			required:      []string{"Thumbprint"},
+			wantDelimiter: ',',
+			wantHeader:    true,
+			wantRows:      [][]string{{"AAA", "1", ""}, {"CCC", "3", ""}},
+			wantErrLines:  []int{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := readTabularFile(writeTabularTestFile(t, tt.data), columns, tt.required)
+			if err != nil {
+				t.Fatalf("readTabularFile() error = %v", err)
+			}
+			if file.Delimiter != tt.wantDelimiter {
+				t.Errorf("Delimiter = %q, want %q", file.Delimiter, tt.wantDelimiter)
+			}
+			if file.HasHeader != tt.wantHeader {
+				t.Errorf("HasHeader = %t, want %t", file.HasHeader, tt.wantHeader)
+			}
+			var rows [][]string
+			for _, row := range file.Rows {
+				rows = append(rows, row.Values(columns))
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("rows = %q, want %q", rows, tt.wantRows)
+			}
+			var errLines []int
+			for _, e := range file.Errors {
+				errLines = append(errLines, e.Line)
+			}
+			if !reflect.DeepEqual(errLines, tt.wantErrLines) {
+				t.Errorf("error lines = %v, want %v", errLines, tt.wantErrLines)
+			}
+		})
+	}
+}
+
+func TestReadTabularFileMissingRequiredColumn(t *testing.T) {
+	_, err := readTabularFile(writeTabularTestFile(t, "Thumbprint\nAAA\n"), []string{"Thumbprint", "CertID"}, []string{"CertID"})
+	if err == nil {
+		t.Fatal("readTabularFile() succeeded, want an error for the missing CertID column")
+	}
+}
@@ -0,0 +1,301 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Keyfactor certificate template APIs and utilities.",
+	Long:  `A collections of APIs and utilities for viewing and configuring Keyfactor certificate templates.`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List certificate templates.",
+	Long:  `List certificate templates.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		sdkClient := initGenClient()
+		templates, httpResponse, errors := sdkClient.TemplateApi.TemplateGetTemplates(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Execute()
+		if errors != nil {
+			WriteApiError("List templates", httpResponse, errors)
+			return
+		}
+		jsonString, marshallError := json.Marshal(templates)
+		if marshallError != nil {
+			log.Printf("%sError: %s", colorRed, marshallError)
+		}
+		fmt.Printf("%s", jsonString)
+	},
+}
+
+var templatesGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get a certificate template by ID or name.",
+	Long:  `Get a certificate template by ID or by template/common name.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		id, _ := cmd.Flags().GetInt32("id")
+		name, _ := cmd.Flags().GetString("name")
+		sdkClient := initGenClient()
+		template, err := getTemplate(sdkClient, id, name)
+		if err != nil {
+			fmt.Printf("Error, unable to get template. %s\n", err)
+			log.Fatalf("[ERROR]: %s", err)
+		}
+		jsonString, marshallError := json.Marshal(template)
+		if marshallError != nil {
+			log.Printf("%sError: %s", colorRed, marshallError)
+		}
+		fmt.Printf("%s", jsonString)
+	},
+}
+
+var templatesUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update certificate template settings.",
+	Long: `Update the settings of a certificate template by ID or name. Settings can be provided in a JSON file
+containing a template update request, or individually with flags. Flags are applied on top of the current template
+settings (and on top of the file when both are provided).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		id, _ := cmd.Flags().GetInt32("id")
+		name, _ := cmd.Flags().GetString("name")
+		configFile, _ := cmd.Flags().GetString("from-file")
+		rsaKeySizes, _ := cmd.Flags().GetInt32Slice("rsa-key-sizes")
+		eccCurves, _ := cmd.Flags().GetStringSlice("ecc-curves")
+		enrollmentFields, _ := cmd.Flags().GetStringArray("enrollment-field")
+		metadataDefaults, _ := cmd.Flags().GetStringArray("metadata-default")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		sdkClient := initGenClient()
+		template, err := getTemplate(sdkClient, id, name)
+		if err != nil {
+			fmt.Printf("Error, unable to get template. %s\n", err)
+			log.Fatalf("[ERROR]: %s", err)
+		}
+
+		// Start from the current template so unspecified settings are preserved
+		var updateReq keyfactor.ModelsTemplateUpdateRequest
+		tJson, _ := json.Marshal(template)
+		jErr := json.Unmarshal(tJson, &updateReq)
+		if jErr != nil {
+			fmt.Printf("Error: %s\n", jErr)
+			log.Fatalf("Error: %s", jErr)
+		}
+		if configFile != "" {
+			fileBytes, fErr := os.ReadFile(configFile)
+			if fErr != nil {
+				fmt.Printf("Error reading from file %s: %s\n", configFile, fErr)
+				log.Fatalf("[ERROR]: %s", fErr)
+			}
+			jErr = json.Unmarshal(fileBytes, &updateReq)
+			if jErr != nil {
+				fmt.Printf("Error reading from file %s: %s\n", configFile, jErr)
+				log.Fatalf("[ERROR]: %s", jErr)
+			}
+		}
+		updateReq.Id = template.Id
+
+		if cmd.Flags().Changed("rsa-key-sizes") || cmd.Flags().Changed("ecc-curves") ||
+			cmd.Flags().Changed("allow-wildcards") || cmd.Flags().Changed("allow-key-reuse") {
+			if updateReq.TemplatePolicy == nil {
+				updateReq.TemplatePolicy = &keyfactor.ModelsTemplateUpdateRequestTemplatePolicyModel{}
+			}
+			if cmd.Flags().Changed("rsa-key-sizes") {
+				updateReq.TemplatePolicy.RSAValidKeySizes = rsaKeySizes
+			}
+			if cmd.Flags().Changed("ecc-curves") {
+				updateReq.TemplatePolicy.ECCValidCurves = eccCurves
+			}
+			if cmd.Flags().Changed("allow-wildcards") {
+				allowWildcards, _ := cmd.Flags().GetBool("allow-wildcards")
+				updateReq.TemplatePolicy.AllowWildcards = &allowWildcards
+			}
+			if cmd.Flags().Changed("allow-key-reuse") {
+				allowKeyReuse, _ := cmd.Flags().GetBool("allow-key-reuse")
+				updateReq.TemplatePolicy.AllowKeyReuse = &allowKeyReuse
+			}
+		}
+		if cmd.Flags().Changed("requires-approval") {
+			requiresApproval, _ := cmd.Flags().GetBool("requires-approval")
+			updateReq.RequiresApproval = &requiresApproval
+		}
+
+		for _, ef := range enrollmentFields {
+			efName, efOptions, found := strings.Cut(ef, "=")
+			if !found || efName == "" {
+				fmt.Printf("Error: invalid enrollment field '%s', expected format 'Name=Option1|Option2'\n", ef)
+				log.Fatalf("[ERROR] invalid enrollment field: %s", ef)
+			}
+			options := strings.Split(efOptions, "|")
+			updated := false
+			for i, existing := range updateReq.EnrollmentFields {
+				if existing.Name != nil && strings.EqualFold(*existing.Name, efName) {
+					updateReq.EnrollmentFields[i].Options = options
+					updated = true
+				}
+			}
+			if !updated {
+				fieldName := efName
+				updateReq.EnrollmentFields = append(updateReq.EnrollmentFields, keyfactor.ModelsTemplateUpdateRequestTemplateEnrollmentFieldModel{
+					Name:    &fieldName,
+					Options: options,
+				})
+			}
+		}
+
+		if len(metadataDefaults) > 0 {
+			kfClient, _ := initClient()
+			metadataFields, mErr := kfClient.GetAllMetadataFields()
+			if mErr != nil {
+				fmt.Printf("Error, unable to get metadata fields. %s\n", mErr)
+				log.Fatalf("[ERROR]: %s", mErr)
+			}
+			for _, md := range metadataDefaults {
+				mdName, mdValue, found := strings.Cut(md, "=")
+				if !found || mdName == "" {
+					fmt.Printf("Error: invalid metadata default '%s', expected format 'Name=Value'\n", md)
+					log.Fatalf("[ERROR] invalid metadata default: %s", md)
+				}
+				metadataId := int32(-1)
+				for _, field := range metadataFields {
+					if strings.EqualFold(field.Name, mdName) {
+						metadataId = int32(field.Id)
+						break
+					}
+				}
+				if metadataId < 0 {
+					fmt.Printf("Error: metadata field '%s' does not exist\n", mdName)
+					log.Fatalf("[ERROR] metadata field not found: %s", mdName)
+				}
+				value := mdValue
+				updated := false
+				for i, existing := range updateReq.MetadataFields {
+					if existing.MetadataId != nil && *existing.MetadataId == metadataId {
+						updateReq.MetadataFields[i].DefaultValue = &value
+						updated = true
+					}
+				}
+				if !updated {
+					mId := metadataId
+					updateReq.MetadataFields = append(updateReq.MetadataFields, keyfactor.ModelsTemplateUpdateRequestTemplateMetadataFieldModel{
+						MetadataId:   &mId,
+						DefaultValue: &value,
+					})
+				}
+			}
+		}
+
+		if dryRun {
+			jsonString, _ := json.MarshalIndent(updateReq, "", "  ")
+			fmt.Printf("Dry run: would have sent the following template update:\n%s\n", jsonString)
+			return
+		}
+
+		updated, httpResponse, errors := sdkClient.TemplateApi.TemplateUpdateTemplate(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Template(updateReq).
+			Execute()
+		if errors != nil {
+			WriteApiError("Update template", httpResponse, errors)
+			return
+		}
+		jsonString, marshallError := json.Marshal(updated)
+		if marshallError != nil {
+			log.Printf("%sError: %s", colorRed, marshallError)
+		}
+		fmt.Printf("%s", jsonString)
+	},
+}
+
+// getTemplate looks up a certificate template by ID, or by template name or common name when no ID is given.
+func getTemplate(sdkClient *keyfactor.APIClient, id int32, name string) (*keyfactor.ModelsTemplateRetrievalResponse, error) {
+	if id <= 0 && name == "" {
+		return nil, fmt.Errorf("either a template ID or name must be specified")
+	}
+	if id <= 0 {
+		templates, _, tErr := sdkClient.TemplateApi.TemplateGetTemplates(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Execute()
+		if tErr != nil {
+			return nil, tErr
+		}
+		for _, t := range templates {
+			if (t.TemplateName != nil && strings.EqualFold(*t.TemplateName, name)) ||
+				(t.CommonName != nil && strings.EqualFold(*t.CommonName, name)) {
+				id = t.GetId()
+				break
+			}
+		}
+		if id <= 0 {
+			return nil, fmt.Errorf("template '%s' not found", name)
+		}
+	}
+	template, _, err := sdkClient.TemplateApi.TemplateGetTemplate(context.Background(), id).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func init() {
+	var (
+		id               int32
+		name             string
+		filePath         string
+		rsaKeySizes      []int32
+		eccCurves        []string
+		enrollmentFields []string
+		metadataDefaults []string
+		allowWildcards   bool
+		allowKeyReuse    bool
+		requiresApproval bool
+		dryRun           bool
+	)
+	RootCmd.AddCommand(templatesCmd)
+
+	// LIST templates command
+	templatesCmd.AddCommand(templatesListCmd)
+
+	// GET template command
+	templatesCmd.AddCommand(templatesGetCmd)
+	templatesGetCmd.Flags().Int32VarP(&id, "id", "i", 0, "ID of the certificate template.")
+	templatesGetCmd.Flags().StringVarP(&name, "name", "n", "", "Template name or common name of the certificate template.")
+	templatesGetCmd.MarkFlagsMutuallyExclusive("id", "name")
+
+	// UPDATE template command
+	templatesCmd.AddCommand(templatesUpdateCmd)
+	templatesUpdateCmd.Flags().Int32VarP(&id, "id", "i", 0, "ID of the certificate template.")
+	templatesUpdateCmd.Flags().StringVarP(&name, "name", "n", "", "Template name or common name of the certificate template.")
+	templatesUpdateCmd.MarkFlagsMutuallyExclusive("id", "name")
+	templatesUpdateCmd.Flags().StringVarP(&filePath, "from-file", "f", "", "Path to a JSON file containing the template update request.")
+	templatesUpdateCmd.Flags().Int32SliceVar(&rsaKeySizes, "rsa-key-sizes", []int32{}, "Allowed RSA key sizes, e.g. 2048,4096.")
+	templatesUpdateCmd.Flags().StringSliceVar(&eccCurves, "ecc-curves", []string{}, "Allowed ECC curve OIDs.")
+	templatesUpdateCmd.Flags().BoolVar(&allowWildcards, "allow-wildcards", false, "Allow wildcard certificates to be enrolled with this template.")
+	templatesUpdateCmd.Flags().BoolVar(&allowKeyReuse, "allow-key-reuse", false, "Allow private keys to be reused on renewal.")
+	templatesUpdateCmd.Flags().BoolVar(&requiresApproval, "requires-approval", false, "Require approval for enrollments using this template.")
+	templatesUpdateCmd.Flags().StringArrayVar(&enrollmentFields, "enrollment-field", []string{}, "Enrollment field to set in the format 'Name=Option1|Option2'. May be specified multiple times.")
+	templatesUpdateCmd.Flags().StringArrayVar(&metadataDefaults, "metadata-default", []string{}, "Default metadata value in the format 'FieldName=Value'. May be specified multiple times.")
+	templatesUpdateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the update request without sending it.")
+}
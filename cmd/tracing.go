@@ -0,0 +1,266 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// OTLP span kinds and status codes, see https://opentelemetry.io/docs/specs/otlp/
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusError      = 2
+	otelEndpointEnv      = "OTEL_EXPORTER_OTLP_ENDPOINT"
+)
+
+// tracePathIdPattern matches path segments that are resource identifiers so spans for the same operation share a name.
+var tracePathIdPattern = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F-]{32,36}|[0-9a-fA-F]{40})$`)
+
+// traceIdFlags are the flags that identify what a command operates on, recorded as attributes of the root span, e.g.
+// --store-id as kfutil.store_id. Other flags and the arguments are not recorded, as they may hold secrets.
+var traceIdFlags = []string{"id", "store-id", "store-ids", "cert-id", "thumbprint", "collection-id", "serial"}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            map[string]int  `json:"status,omitempty"`
+}
+
+// apiTracer records a root span for the command being run and a child span for every HTTP request made to the
+// Keyfactor API, and exports them to an OTLP/HTTP collector in the JSON encoding.
+type apiTracer struct {
+	endpoint string
+	traceId  string
+	root     otlpSpan
+	start    time.Time
+	mu       sync.Mutex
+	spans    []otlpSpan
+	requests int
+	failed   int
+	counts   map[string]int
+	base     http.RoundTripper
+}
+
+var tracer *apiTracer
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stringAttribute returns a string attribute, with secrets redacted from value.
+func stringAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": redactSecrets(value)}}
+}
+
+func intAttribute(key string, value int) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(value)}}
+}
+
+// traceOperationName returns a low cardinality span name for a request, e.g. `GET /CertificateStores/{id}`, and the
+// attributes of the resources in its path, e.g. keyfactor.certificatestores.id.
+func traceOperationName(req *http.Request) (string, []otlpAttribute) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	var resources []otlpAttribute
+	for i, segment := range segments {
+		if tracePathIdPattern.MatchString(segment) {
+			if i > 0 {
+				resources = append(resources, stringAttribute("keyfactor."+strings.ToLower(segments[i-1])+".id", segment))
+			}
+			segments[i] = "{id}"
+		}
+	}
+	return fmt.Sprintf("%s /%s", req.Method, strings.Join(segments, "/")), resources
+}
+
+// RoundTrip implements http.RoundTripper, recording a client span for each request.
+func (t *apiTracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	name, resources := traceOperationName(req)
+	span := otlpSpan{
+		TraceId:           t.traceId,
+		SpanId:            randomHex(8),
+		ParentSpanId:      t.root.SpanId,
+		Name:              name,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			stringAttribute("http.method", req.Method),
+			stringAttribute("http.url", req.URL.Redacted()),
+			stringAttribute("net.peer.name", req.URL.Hostname()),
+		},
+	}
+	span.Attributes = append(span.Attributes, resources...)
+	if err != nil {
+		span.Attributes = append(span.Attributes, stringAttribute("error.message", err.Error()))
+		span.Status = map[string]int{"code": otlpStatusError}
+	} else {
+		span.Attributes = append(span.Attributes, intAttribute("http.status_code", resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.Status = map[string]int{"code": otlpStatusError}
+		}
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.requests++
+	if span.Status != nil {
+		t.failed++
+	}
+	t.mu.Unlock()
+	return resp, err
+}
+
+// traceCount adds n to a count recorded on the root span, e.g. the number of certificates deleted. It is called by
+// recordResultCount.
+func traceCount(name string, n int) {
+	t := tracer
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.counts[name] += n
+	t.mu.Unlock()
+}
+
+// startTracing instruments the default HTTP transport, used by both Keyfactor API clients, when an OTLP endpoint is
+// configured via --otel-endpoint or the OTEL_EXPORTER_OTLP_ENDPOINT environment variable.
+func startTracing(cmd *cobra.Command, args []string) {
+	endpoint, _ := cmd.Flags().GetString("otel-endpoint")
+	if endpoint == "" {
+		endpoint = os.Getenv(otelEndpointEnv)
+	}
+	if endpoint == "" || tracer != nil {
+		return
+	}
+	tracer = &apiTracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		traceId:  randomHex(16),
+		start:    time.Now(),
+		counts:   map[string]int{},
+		base:     http.DefaultTransport,
+	}
+	tracer.root = otlpSpan{
+		TraceId: tracer.traceId,
+		SpanId:  randomHex(8),
+		Name:    cmd.CommandPath(),
+		Kind:    otlpSpanKindInternal,
+		Attributes: []otlpAttribute{
+			stringAttribute("kfutil.command", cmd.CommandPath()),
+			intAttribute("kfutil.arg_count", len(args)),
+		},
+	}
+	for _, name := range traceIdFlags {
+		if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+			key := "kfutil." + strings.ReplaceAll(name, "-", "_")
+			tracer.root.Attributes = append(tracer.root.Attributes, stringAttribute(key, strings.Trim(f.Value.String(), "[]")))
+		}
+	}
+	http.DefaultTransport = tracer
+}
+
+// stopTracing ends the root span and exports all recorded spans after the command ran.
+func stopTracing(cmd *cobra.Command, args []string) {
+	endTracing(0)
+}
+
+// endTracing ends the root span with the exit code of the command and exports all recorded spans. It is called by
+// finishResult, so the spans of commands that exit early, e.g. when interrupted, are exported too. Spans are exported
+// once, later calls do nothing.
+func endTracing(exitCode int) {
+	t := tracer
+	if t == nil {
+		return
+	}
+	tracer = nil
+	http.DefaultTransport = t.base
+	t.root.StartTimeUnixNano = strconv.FormatInt(t.start.UnixNano(), 10)
+	t.root.EndTimeUnixNano = strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	t.mu.Lock()
+	t.root.Attributes = append(t.root.Attributes,
+		intAttribute("kfutil.exit_code", exitCode),
+		intAttribute("kfutil.requests", t.requests),
+		intAttribute("kfutil.failed_requests", t.failed))
+	names := make([]string, 0, len(t.counts))
+	for name := range t.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.root.Attributes = append(t.root.Attributes, intAttribute("kfutil.count."+name, t.counts[name]))
+	}
+	if exitCode != 0 {
+		t.root.Status = map[string]int{"code": otlpStatusError}
+	}
+	spans := append([]otlpSpan{t.root}, t.spans...)
+	t.mu.Unlock()
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{
+						stringAttribute("service.name", "kfutil"),
+						stringAttribute("keyfactor.hostname", os.Getenv("KEYFACTOR_HOSTNAME")),
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "kfutil"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+	body, jErr := json.Marshal(payload)
+	if jErr != nil {
+		log.Printf("[ERROR] encoding traces: %s", jErr)
+		return
+	}
+	client := &http.Client{Transport: t.base, Timeout: 10 * time.Second}
+	resp, pErr := client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if pErr != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting traces to %s: %s\n", t.endpoint, pErr)
+		log.Printf("[ERROR] exporting traces: %s", pErr)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "Error exporting traces to %s: status %d\n", t.endpoint, resp.StatusCode)
+		log.Printf("[ERROR] exporting traces: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,580 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/Keyfactor/keyfactor-go-client/api"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	tuiStores    = "Stores"
+	tuiTypes     = "Store types"
+	tuiJobs      = "Jobs"
+	tuiJobsLimit = 100
+	// tuiHeaderLines and tuiFooterLines are the lines around the list and detail panes.
+	tuiHeaderLines = 4
+	tuiFooterLines = 1
+	tuiHelp        = "↑↓ move  / search  enter open  esc back  tab switch  r refresh  q quit"
+)
+
+// tuiItem is an entry of a list and the content of its detail pane.
+type tuiItem struct {
+	label  string
+	title  string
+	fields [][2]string
+	// open returns the list shown when the item is opened with enter, nil if the item has none.
+	open func() *tuiList
+}
+
+// tuiList is a searchable list of the browser. Its items are loaded when it is first shown and kept until refreshed.
+type tuiList struct {
+	title   string
+	load    func(refresh bool) ([]tuiItem, error)
+	loaded  bool
+	items   []tuiItem
+	search  string
+	matches []int
+	cursor  int
+	top     int
+}
+
+// filter selects the items whose label contains every word of the search, ignoring case.
+func (l *tuiList) filter() {
+	words := strings.Fields(strings.ToLower(l.search))
+	l.matches = l.matches[:0]
+	for i, item := range l.items {
+		label := strings.ToLower(item.label)
+		match := true
+		for _, w := range words {
+			match = match && strings.Contains(label, w)
+		}
+		if match {
+			l.matches = append(l.matches, i)
+		}
+	}
+	l.move(0)
+}
+
+// move moves the cursor by delta matches, keeping it within the list.
+func (l *tuiList) move(delta int) {
+	l.cursor += delta
+	if l.cursor >= len(l.matches) {
+		l.cursor = len(l.matches) - 1
+	}
+	if l.cursor < 0 {
+		l.cursor = 0
+	}
+}
+
+// selected returns the item under the cursor, nil if no item matches the search.
+func (l *tuiList) selected() *tuiItem {
+	if l.cursor >= len(l.matches) {
+		return nil
+	}
+	return &l.items[l.matches[l.cursor]]
+}
+
+// tuiBrowser is an interactive, full screen browser of stores, inventories, store types and jobs. Each tab holds a
+// stack of lists, the list of the tab and the lists opened from it. The detail pane shows the item under the cursor.
+type tuiBrowser struct {
+	kfClient  *api.Client
+	sdkClient *keyfactor.APIClient
+	types     []api.CertificateStoreType
+	typeNames map[int]string
+
+	tabNames  []string
+	tabs      [][]*tuiList
+	tab       int
+	searching bool
+	status    string
+	width     int
+	height    int
+}
+
+func newTUIBrowser(kfClient *api.Client, sdkClient *keyfactor.APIClient) *tuiBrowser {
+	b := &tuiBrowser{kfClient: kfClient, sdkClient: sdkClient, tabNames: []string{tuiStores, tuiTypes, tuiJobs}}
+	b.tabs = [][]*tuiList{
+		{{title: tuiStores, load: b.storeItems}},
+		{{title: tuiTypes, load: b.storeTypeItems}},
+		{{title: "Recent jobs", load: b.jobItems}},
+	}
+	return b
+}
+
+// list returns the list shown, the top of the stack of the current tab.
+func (b *tuiBrowser) list() *tuiList {
+	stack := b.tabs[b.tab]
+	return stack[len(stack)-1]
+}
+
+// reload loads the items of l, fetching them again if refresh is set. Errors are shown in the status line.
+func (b *tuiBrowser) reload(l *tuiList, refresh bool) {
+	items, err := l.load(refresh)
+	l.loaded = true
+	if err != nil {
+		b.status = err.Error()
+		items = nil
+	}
+	l.items = items
+	l.filter()
+}
+
+// run shows the browser until the user quits. in must be a terminal in raw mode.
+func (b *tuiBrowser) run(in io.Reader, out io.Writer, size func() (int, int, error)) error {
+	keys := bufio.NewReader(in)
+	for {
+		if w, h, err := size(); err == nil {
+			b.width, b.height = w, h
+		}
+		l := b.list()
+		if !l.loaded {
+			b.status = "Loading " + strings.ToLower(l.title) + "..."
+			b.draw(out)
+			b.status = ""
+			b.reload(l, false)
+		}
+		b.draw(out)
+		key, err := readTUIKey(keys)
+		if err != nil {
+			return err
+		}
+		if !b.handle(key) {
+			return nil
+		}
+	}
+}
+
+// handle applies a key and returns false when the browser should exit.
+func (b *tuiBrowser) handle(key tuiKey) bool {
+	l := b.list()
+	page := b.height - tuiHeaderLines - tuiFooterLines
+	if key.name == tuiKeyInterrupt {
+		return false
+	}
+	if b.searching {
+		switch key.name {
+		case tuiKeyEscape:
+			b.searching = false
+			l.search = ""
+			l.filter()
+		case tuiKeyEnter, tuiKeyTab:
+			b.searching = false
+		case tuiKeyBackspace:
+			if r := []rune(l.search); len(r) > 0 {
+				l.search = string(r[:len(r)-1])
+				l.filter()
+			}
+		case tuiKeyUp:
+			l.move(-1)
+		case tuiKeyDown:
+			l.move(1)
+		case "":
+			if key.r != 0 {
+				l.search += string(key.r)
+				l.filter()
+			}
+		}
+		return true
+	}
+	b.status = ""
+	switch {
+	case key.r == 'q':
+		return false
+	case key.name == tuiKeyUp || key.r == 'k':
+		l.move(-1)
+	case key.name == tuiKeyDown || key.r == 'j':
+		l.move(1)
+	case key.name == tuiKeyPageUp:
+		l.move(-page)
+	case key.name == tuiKeyPageDown:
+		l.move(page)
+	case key.name == tuiKeyHome || key.r == 'g':
+		l.move(-len(l.matches))
+	case key.name == tuiKeyEnd || key.r == 'G':
+		l.move(len(l.matches))
+	case key.r == '/':
+		b.searching = true
+	case key.r == 'r':
+		b.reload(l, true)
+	case key.name == tuiKeyTab:
+		b.tab = (b.tab + 1) % len(b.tabs)
+	case key.name == tuiKeyBackTab:
+		b.tab = (b.tab + len(b.tabs) - 1) % len(b.tabs)
+	case key.r >= '1' && int(key.r-'1') < len(b.tabs):
+		b.tab = int(key.r - '1')
+	case key.name == tuiKeyEnter || key.name == tuiKeyRight:
+		if item := l.selected(); item != nil && item.open != nil {
+			b.tabs[b.tab] = append(b.tabs[b.tab], item.open())
+		}
+	case key.name == tuiKeyEscape || key.name == tuiKeyLeft || key.name == tuiKeyBackspace:
+		if stack := b.tabs[b.tab]; len(stack) > 1 {
+			b.tabs[b.tab] = stack[:len(stack)-1]
+		} else if l.search != "" {
+			l.search = ""
+			l.filter()
+		}
+	}
+	return true
+}
+
+// draw renders the whole screen: the tabs, the path of the open lists, the search line, the list and detail panes
+// side by side and the status line.
+func (b *tuiBrowser) draw(out io.Writer) {
+	width, height := b.width, b.height
+	var lines []string
+	if width < 40 || height < tuiHeaderLines+tuiFooterLines+3 {
+		lines = append(lines, tuiFit("Terminal too small for kfutil tui", width))
+		_, _ = io.WriteString(out, tuiHome+strings.Join(lines, tuiClearLine+"\r\n")+"\x1b[J")
+		return
+	}
+	l := b.list()
+
+	var tabs strings.Builder
+	tabs.WriteString(" kfutil ")
+	for i, name := range b.tabNames {
+		label := fmt.Sprintf(" %d %s ", i+1, name)
+		if i == b.tab {
+			label = tuiReverse + label + tuiReset
+		}
+		tabs.WriteString(" " + label)
+	}
+	lines = append(lines, tabs.String())
+
+	var path []string
+	for _, stacked := range b.tabs[b.tab] {
+		path = append(path, stacked.title)
+	}
+	lines = append(lines, colorGreen+tuiFit(fmt.Sprintf(" %s (%d of %d)", strings.Join(path, " > "), len(l.matches), len(l.items)), width)+colorWhite)
+	search := " Press / to search"
+	if b.searching || l.search != "" {
+		search = " Search: " + l.search
+		if b.searching {
+			search += "_"
+		}
+	}
+	lines = append(lines, tuiFit(search, width))
+	lines = append(lines, strings.Repeat("─", width))
+
+	bodyHeight := height - tuiHeaderLines - tuiFooterLines
+	listWidth := width * 2 / 5
+	detailWidth := width - listWidth - 3
+	if l.cursor < l.top {
+		l.top = l.cursor
+	}
+	if l.cursor >= l.top+bodyHeight {
+		l.top = l.cursor - bodyHeight + 1
+	}
+	detail := b.detailLines(l.selected(), detailWidth)
+	for row := 0; row < bodyHeight; row++ {
+		entry := tuiFit("", listWidth)
+		if i := l.top + row; i < len(l.matches) {
+			entry = tuiFit("  "+l.items[l.matches[i]].label, listWidth)
+			if i == l.cursor {
+				entry = tuiReverse + tuiFit("> "+l.items[l.matches[i]].label, listWidth) + tuiReset
+			}
+		}
+		pane := ""
+		if row < len(detail) {
+			pane = detail[row]
+		}
+		lines = append(lines, entry+" │ "+pane)
+	}
+
+	status := tuiFit(" "+tuiHelp, width)
+	if b.status != "" {
+		status = colorYellow + tuiFit(" "+b.status, width) + colorWhite
+	}
+	lines = append(lines, status)
+	_, _ = io.WriteString(out, tuiHome+strings.Join(lines, tuiClearLine+"\r\n")+tuiClearLine)
+}
+
+// detailLines returns the detail pane of item, its title followed by its fields, wrapped to width.
+func (b *tuiBrowser) detailLines(item *tuiItem, width int) []string {
+	if item == nil {
+		return []string{"No match"}
+	}
+	lines := []string{colorGreen + tuiFit(item.title, width) + colorWhite, ""}
+	labelWidth := 0
+	for _, f := range item.fields {
+		if n := utf8.RuneCountInString(f[0]); n > labelWidth {
+			labelWidth = n
+		}
+	}
+	for _, f := range item.fields {
+		label := tuiFit(f[0]+":", labelWidth+2)
+		for i, line := range tuiWrap(f[1], width-labelWidth-2) {
+			if i > 0 {
+				label = strings.Repeat(" ", labelWidth+2)
+			}
+			lines = append(lines, label+line)
+		}
+	}
+	if item.open != nil {
+		lines = append(lines, "", "Press enter to open")
+	}
+	return lines
+}
+
+func (b *tuiBrowser) loadStoreTypes(refresh bool) error {
+	if b.types != nil && !refresh {
+		return nil
+	}
+	types, err := b.kfClient.ListCertificateStoreTypes()
+	if err != nil {
+		return fmt.Errorf("listing store types: %s", err)
+	}
+	b.types = *types
+	sort.Slice(b.types, func(i, j int) bool { return b.types[i].ShortName < b.types[j].ShortName })
+	b.typeNames = make(map[int]string, len(b.types))
+	for _, st := range b.types {
+		b.typeNames[st.StoreType] = st.ShortName
+	}
+	return nil
+}
+
+// storeItems returns the certificate stores, sorted by client machine and path. Opening a store lists its inventory.
+func (b *tuiBrowser) storeItems(refresh bool) ([]tuiItem, error) {
+	if err := b.loadStoreTypes(refresh); err != nil {
+		return nil, err
+	}
+	params := make(map[string]interface{})
+	stores, err := b.kfClient.ListCertificateStores(&params)
+	if err != nil {
+		return nil, fmt.Errorf("listing certificate stores: %s", err)
+	}
+	list := *stores
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ClientMachine != list[j].ClientMachine {
+			return list[i].ClientMachine < list[j].ClientMachine
+		}
+		return list[i].StorePath < list[j].StorePath
+	})
+	items := make([]tuiItem, 0, len(list))
+	for _, s := range list {
+		s := s
+		fields := [][2]string{
+			{"ID", s.Id},
+			{"Type", b.typeNames[s.CertStoreType]},
+			{"Client machine", s.ClientMachine},
+			{"Path", s.StorePath},
+			{"Container", s.ContainerName},
+			{"Orchestrator", s.AgentId},
+			{"Approved", fmt.Sprintf("%t", s.Approved)},
+		}
+		var propNames []string
+		for name := range s.Properties {
+			propNames = append(propNames, name)
+		}
+		sort.Strings(propNames)
+		for _, name := range propNames {
+			fields = append(fields, [2]string{name, redactStoreProperty(name, s.Properties[name])})
+		}
+		items = append(items, tuiItem{
+			label:  fmt.Sprintf("%s  %s  [%s]", s.ClientMachine, s.StorePath, b.typeNames[s.CertStoreType]),
+			title:  "Store " + s.Id,
+			fields: fields,
+			open: func() *tuiList {
+				return &tuiList{title: s.ClientMachine + " " + s.StorePath, load: func(bool) ([]tuiItem, error) {
+					return b.inventoryItems(s.Id)
+				}}
+			},
+		})
+	}
+	return items, nil
+}
+
+// inventoryItems returns the certificates in the inventory of a store.
+func (b *tuiBrowser) inventoryItems(storeID string) ([]tuiItem, error) {
+	inventory, err := b.kfClient.GetCertStoreInventory(storeID)
+	if err != nil {
+		return nil, fmt.Errorf("getting inventory of store %s: %s", storeID, err)
+	}
+	var items []tuiItem
+	if inventory == nil {
+		return items, nil
+	}
+	for _, inv := range *inventory {
+		for _, c := range inv.Certificates {
+			items = append(items, tuiItem{
+				label: fmt.Sprintf("%s  %s", inv.Name, c.IssuedDN),
+				title: "Certificate " + c.Thumbprint,
+				fields: [][2]string{
+					{"Alias", inv.Name},
+					{"Subject", c.IssuedDN},
+					{"Issuer", c.IssuerDN},
+					{"Serial", c.SerialNumber},
+					{"Not before", c.NotBefore},
+					{"Not after", c.NotAfter},
+					{"Algorithm", c.SigningAlgorithm},
+					{"Thumbprint", c.Thumbprint},
+					{"Certificate ID", fmt.Sprintf("%d", c.Id)},
+				},
+			})
+		}
+	}
+	return items, nil
+}
+
+// redactStoreProperty hides the values of secret store properties in the detail pane.
+func redactStoreProperty(name string, value interface{}) string {
+	lower := strings.ToLower(name)
+	if strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") {
+		return "********"
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		if v, ok := m["value"]; ok {
+			if _, secret := v.(map[string]interface{}); secret {
+				return "********"
+			}
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// storeTypeItems returns the store types, sorted by short name.
+func (b *tuiBrowser) storeTypeItems(refresh bool) ([]tuiItem, error) {
+	if err := b.loadStoreTypes(refresh); err != nil {
+		return nil, err
+	}
+	items := make([]tuiItem, 0, len(b.types))
+	for _, st := range b.types {
+		var ops []string
+		if st.SupportedOperations != nil {
+			for _, op := range []struct {
+				name string
+				ok   bool
+			}{{"add", st.SupportedOperations.Add}, {"remove", st.SupportedOperations.Remove},
+				{"create", st.SupportedOperations.Create}, {"discovery", st.SupportedOperations.Discovery},
+				{"enrollment", st.SupportedOperations.Enrollment}} {
+				if op.ok {
+					ops = append(ops, op.name)
+				}
+			}
+		}
+		var props []string
+		if st.Properties != nil {
+			for _, p := range *st.Properties {
+				props = append(props, p.Name)
+			}
+		}
+		var entryParams []string
+		if st.EntryParameters != nil {
+			for _, p := range *st.EntryParameters {
+				entryParams = append(entryParams, p.Name)
+			}
+		}
+		items = append(items, tuiItem{
+			label: fmt.Sprintf("%s  %s", st.ShortName, st.Name),
+			title: "Store type " + st.ShortName,
+			fields: [][2]string{
+				{"ID", fmt.Sprintf("%d", st.StoreType)},
+				{"Name", st.Name},
+				{"Capability", st.Capability},
+				{"Operations", strings.Join(ops, ", ")},
+				{"Private keys", st.PrivateKeyAllowed},
+				{"Custom alias", st.CustomAliasAllowed},
+				{"Properties", strings.Join(props, ", ")},
+				{"Entry parameters", strings.Join(entryParams, ", ")},
+			},
+		})
+	}
+	return items, nil
+}
+
+// jobItems returns the most recent orchestrator jobs, newest first.
+func (b *tuiBrowser) jobItems(bool) ([]tuiItem, error) {
+	jobs, _, err := b.sdkClient.OrchestratorJobApi.OrchestratorJobGetJobHistory(context.Background()).
+		XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+		PqSortField("OperationStart").PqSortAscending(1).PqReturnLimit(tuiJobsLimit).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("getting job history: %s", err)
+	}
+	items := make([]tuiItem, 0, len(jobs))
+	for _, j := range jobs {
+		items = append(items, tuiItem{
+			label: fmt.Sprintf("%s  %s  %s  %s", tuiTime(j.OperationStart), j.GetJobType(), j.GetClientMachine(), j.GetStorePath()),
+			title: "Job " + j.GetJobId(),
+			fields: [][2]string{
+				{"Type", j.GetJobType()},
+				{"Orchestrator", j.GetAgentMachine()},
+				{"Client machine", j.GetClientMachine()},
+				{"Store path", j.GetStorePath()},
+				{"Started", tuiTime(j.OperationStart)},
+				{"Ended", tuiTime(j.OperationEnd)},
+				{"Result", fmt.Sprintf("%d", j.GetResult())},
+				{"Message", j.GetMessage()},
+			},
+		})
+	}
+	return items, nil
+}
+
+func tuiTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse stores, inventories, store types and jobs interactively.",
+	Long: `Opens a full screen terminal browser for certificate stores and their inventories, store types and recent
+orchestrator jobs. Each list is shown next to a detail pane of the selected entry.
+
+Keys: up/down (or j/k), page up/down, home/end to move; / to search the list, enter to end the search and esc to clear
+it; enter to open a store's inventory and esc to go back; tab or 1-3 to switch between stores, store types and jobs;
+r to refresh the list; q or Ctrl-C to exit. Lists are cached for the session until refreshed. Nothing is changed in
+Keyfactor.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		fd := int(os.Stdin.Fd())
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+			fmt.Println("[ERROR] kfutil tui needs an interactive terminal")
+			log.Fatalf("[ERROR] stdin or stdout is not a terminal")
+		}
+		kfClient, cErr := initClient()
+		if cErr != nil {
+			fmt.Printf("[ERROR] %s\n", cErr)
+			log.Fatalf("[ERROR] %s", cErr)
+		}
+		b := newTUIBrowser(kfClient, initGenClient())
+
+		state, tErr := terminal.MakeRaw(fd)
+		if tErr != nil {
+			fmt.Printf("[ERROR] unable to set up the terminal: %s\n", tErr)
+			log.Fatalf("[ERROR] making the terminal raw: %s", tErr)
+		}
+		fmt.Print(tuiEnterScreen)
+		err := b.run(os.Stdin, os.Stdout, func() (int, int, error) { return terminal.GetSize(int(os.Stdout.Fd())) })
+		fmt.Print(tuiLeaveScreen)
+		_ = terminal.Restore(fd, state)
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err)
+			log.Fatalf("[ERROR] %s", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(tuiCmd)
+}
@@ -0,0 +1,177 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Escape sequences of the full screen browser.
+const (
+	tuiEnterScreen = "\x1b[?1049h\x1b[?25l"
+	tuiLeaveScreen = "\x1b[?25h\x1b[?1049l"
+	tuiHome        = "\x1b[H"
+	tuiClearLine   = "\x1b[K"
+	tuiReverse     = "\x1b[7m"
+	tuiReset       = "\x1b[0m"
+)
+
+// Names of the special keys read by readTUIKey.
+const (
+	tuiKeyUp        = "up"
+	tuiKeyDown      = "down"
+	tuiKeyLeft      = "left"
+	tuiKeyRight     = "right"
+	tuiKeyPageUp    = "pgup"
+	tuiKeyPageDown  = "pgdn"
+	tuiKeyHome      = "home"
+	tuiKeyEnd       = "end"
+	tuiKeyEnter     = "enter"
+	tuiKeyEscape    = "esc"
+	tuiKeyBackspace = "backspace"
+	tuiKeyTab       = "tab"
+	tuiKeyBackTab   = "backtab"
+	tuiKeyInterrupt = "ctrl-c"
+)
+
+// tuiKey is a key pressed in the browser, either a printable rune or a named special key.
+type tuiKey struct {
+	r    rune
+	name string
+}
+
+// readTUIKey reads a key from a terminal in raw mode. Escape sequences arrive in a single read, so an escape followed
+// by nothing buffered is the escape key itself.
+func readTUIKey(in *bufio.Reader) (tuiKey, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return tuiKey{}, err
+	}
+	switch b {
+	case 3:
+		return tuiKey{name: tuiKeyInterrupt}, nil
+	case '\r', '\n':
+		return tuiKey{name: tuiKeyEnter}, nil
+	case '\t':
+		return tuiKey{name: tuiKeyTab}, nil
+	case 8, 127:
+		return tuiKey{name: tuiKeyBackspace}, nil
+	case 0x1b:
+		if in.Buffered() == 0 {
+			return tuiKey{name: tuiKeyEscape}, nil
+		}
+		return readTUIEscape(in), nil
+	}
+	if b >= utf8.RuneSelf {
+		_ = in.UnreadByte()
+		r, _, rErr := in.ReadRune()
+		return tuiKey{r: r}, rErr
+	}
+	if b < ' ' {
+		return tuiKey{}, nil
+	}
+	return tuiKey{r: rune(b)}, nil
+}
+
+// readTUIEscape reads the rest of a CSI or SS3 escape sequence, e.g. ESC [ A for the up arrow. Unknown sequences are
+// read in full and returned as no key.
+func readTUIEscape(in *bufio.Reader) tuiKey {
+	intro, _ := in.ReadByte()
+	if intro != '[' && intro != 'O' {
+		return tuiKey{name: tuiKeyEscape}
+	}
+	var params []byte
+	for in.Buffered() > 0 {
+		b, _ := in.ReadByte()
+		if b < 0x40 || b > 0x7e {
+			params = append(params, b)
+			continue
+		}
+		switch b {
+		case 'A':
+			return tuiKey{name: tuiKeyUp}
+		case 'B':
+			return tuiKey{name: tuiKeyDown}
+		case 'C':
+			return tuiKey{name: tuiKeyRight}
+		case 'D':
+			return tuiKey{name: tuiKeyLeft}
+		case 'H':
+			return tuiKey{name: tuiKeyHome}
+		case 'F':
+			return tuiKey{name: tuiKeyEnd}
+		case 'Z':
+			return tuiKey{name: tuiKeyBackTab}
+		case '~':
+			switch string(params) {
+			case "1", "7":
+				return tuiKey{name: tuiKeyHome}
+			case "4", "8":
+				return tuiKey{name: tuiKeyEnd}
+			case "5":
+				return tuiKey{name: tuiKeyPageUp}
+			case "6":
+				return tuiKey{name: tuiKeyPageDown}
+			}
+		}
+		return tuiKey{}
+	}
+	return tuiKey{}
+}
+
+// tuiFit returns s on a single line, cut or padded with spaces to width columns. Control characters such as line
+// breaks in values are shown as spaces.
+func tuiFit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if n == width {
+			break
+		}
+		if unicode.IsControl(r) {
+			r = ' '
+		}
+		b.WriteRune(r)
+		n++
+	}
+	if n == width && utf8.RuneCountInString(s) > width && width > 1 {
+		// mark cut values with an ellipsis
+		runes := []rune(b.String())
+		return string(runes[:width-1]) + "…"
+	}
+	return b.String() + strings.Repeat(" ", width-n)
+}
+
+// tuiWrap splits s into lines of at most width columns, breaking at spaces where possible.
+func tuiWrap(s string, width int) []string {
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		runes := []rune(paragraph)
+		for len(runes) > width {
+			cut := width
+			for i := width; i > width/2; i-- {
+				if runes[i] == ' ' {
+					cut = i
+					break
+				}
+			}
+			lines = append(lines, string(runes[:cut]))
+			runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
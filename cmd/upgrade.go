@@ -0,0 +1,334 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"kfutil/pkg/version"
+)
+
+const (
+	releasesURL              = "https://api.github.com/repos/Keyfactor/kfutil/releases"
+	releaseChannelStable     = "stable"
+	releaseChannelPrerelease = "prerelease"
+)
+
+// releaseSigningKey is the armored public key of the key the release workflow signs the checksums file with. Text
+// outside the key block is ignored, so a build from a tree without the key has no release signing key.
+//
+//go:embed release-signing-key.asc
+var releaseSigningKey []byte
+
+type githubReleaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+type githubRelease struct {
+	TagName    string               `json:"tag_name"`
+	Draft      bool                 `json:"draft"`
+	Prerelease bool                 `json:"prerelease"`
+	Assets     []githubReleaseAsset `json:"assets"`
+}
+
+func (r githubRelease) asset(name string) (githubReleaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return githubReleaseAsset{}, false
+}
+
+// parseVersion splits a version like `v1.2.3-rc.1` into its numeric parts and pre-release suffix.
+func parseVersion(v string) ([3]int, string) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	pre := ""
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	for i, p := range strings.SplitN(v, ".", 3) {
+		parts[i], _ = strconv.Atoi(p)
+	}
+	return parts, pre
+}
+
+// compareVersions returns -1, 0 or 1 if a is older than, equal to or newer than b. A pre-release is older than the
+// release with the same version number.
+func compareVersions(a string, b string) int {
+	aParts, aPre := parseVersion(a)
+	bParts, bPre := parseVersion(b)
+	for i := range aParts {
+		if aParts[i] != bParts[i] {
+			if aParts[i] < bParts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func httpGet(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease returns the newest published release in the given channel. The prerelease channel includes stable
+// releases.
+func latestRelease(channel string) (*githubRelease, error) {
+	body, err := httpGet(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var releases []githubRelease
+	if jErr := json.Unmarshal(body, &releases); jErr != nil {
+		return nil, jErr
+	}
+	var latest *githubRelease
+	for i, r := range releases {
+		if r.Draft || (r.Prerelease && channel != releaseChannelPrerelease) {
+			continue
+		}
+		if latest == nil || compareVersions(r.TagName, latest.TagName) > 0 {
+			latest = &releases[i]
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no %s releases found", channel)
+	}
+	return latest, nil
+}
+
+// verifyReleaseChecksum checks the sha256 of data against the entry for name in a goreleaser checksums file.
+func verifyReleaseChecksum(checksums []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			if !strings.EqualFold(fields[0], actual) {
+				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, fields[0], actual)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no checksum found for %s", name)
+}
+
+// releaseSigningKeys returns the public key to verify the checksums signature with, read from keyFile if given or
+// else the embedded release signing key.
+func releaseSigningKeys(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		return os.ReadFile(keyFile)
+	}
+	if !bytes.Contains(releaseSigningKey, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		return nil, fmt.Errorf("this build of kfutil has no embedded release signing key, pass the release public key with --signing-key")
+	}
+	return releaseSigningKey, nil
+}
+
+// verifyReleaseSignature checks the detached GPG signature of the checksums file against the public key.
+func verifyReleaseSignature(signingKey []byte, checksums []byte, signature []byte) error {
+	if err := verifyOpenPGPSignature(signingKey, checksums, signature); err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+	return nil
+}
+
+// extractBinary returns the kfutil binary from a release archive.
+func extractBinary(archive []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		name := filepath.Base(f.Name)
+		if name != "kfutil" && name != "kfutil.exe" {
+			continue
+		}
+		rc, oErr := f.Open()
+		if oErr != nil {
+			return nil, oErr
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("kfutil binary not found in release archive")
+}
+
+// replaceExecutable atomically replaces the running binary. The old binary is moved aside first as Windows does not
+// allow overwriting a running executable.
+func replaceExecutable(binary []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	newPath := exe + ".new"
+	oldPath := exe + ".old"
+	if wErr := os.WriteFile(newPath, binary, 0755); wErr != nil {
+		return "", wErr
+	}
+	if rErr := os.Rename(exe, oldPath); rErr != nil {
+		os.Remove(newPath)
+		return "", rErr
+	}
+	if rErr := os.Rename(newPath, exe); rErr != nil {
+		_ = os.Rename(oldPath, exe)
+		return "", rErr
+	}
+	_ = os.Remove(oldPath)
+	return exe, nil
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade kfutil to the latest release.",
+	Long: `Checks the kfutil GitHub releases for a newer version and replaces the current binary with it. The release
+archive is verified against the release checksums file, and the checksums file against its GPG signature by the release
+signing key embedded in kfutil, or the public key given with --signing-key. kfutil is not replaced unless both are
+verified. Use --check-only to only report whether an upgrade is available.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		channel, _ := cmd.Flags().GetString("channel")
+		checkOnly, _ := cmd.Flags().GetBool("check-only")
+		signingKey, _ := cmd.Flags().GetString("signing-key")
+		if channel != releaseChannelStable && channel != releaseChannelPrerelease {
+			fmt.Printf("Invalid channel '%s', must be one of %s or %s\n", channel, releaseChannelStable, releaseChannelPrerelease)
+			log.Fatalf("[ERROR] invalid channel: %s", channel)
+		}
+
+		release, rErr := latestRelease(channel)
+		if rErr != nil {
+			fmt.Printf("Error checking for kfutil releases: %s\n", rErr)
+			log.Fatalf("[ERROR] checking for releases: %s", rErr)
+		}
+		if compareVersions(release.TagName, version.VERSION) <= 0 {
+			fmt.Printf("kfutil %s is up to date (latest %s release is %s).\n", version.VERSION, channel, release.TagName)
+			return
+		}
+		fmt.Printf("kfutil %s is available (current version %s).\n", release.TagName, version.VERSION)
+		if checkOnly {
+			return
+		}
+
+		signingKeys, kErr := releaseSigningKeys(signingKey)
+		if kErr != nil {
+			fmt.Printf("Error reading the release signing key, refusing to upgrade: %s\n", kErr)
+			log.Fatalf("[ERROR] reading signing key: %s", kErr)
+		}
+
+		releaseVersion := strings.TrimPrefix(release.TagName, "v")
+		archiveName := fmt.Sprintf("kfutil_%s_%s_%s.zip", releaseVersion, runtime.GOOS, runtime.GOARCH)
+		checksumsName := fmt.Sprintf("kfutil_%s_SHA256SUMS", releaseVersion)
+		archiveAsset, ok := release.asset(archiveName)
+		if !ok {
+			fmt.Printf("Release %s has no archive for %s/%s\n", release.TagName, runtime.GOOS, runtime.GOARCH)
+			log.Fatalf("[ERROR] release asset %s not found", archiveName)
+		}
+		checksumsAsset, ok := release.asset(checksumsName)
+		if !ok {
+			fmt.Printf("Release %s has no checksums file, refusing to upgrade.\n", release.TagName)
+			log.Fatalf("[ERROR] release asset %s not found", checksumsName)
+		}
+		checksums, cErr := httpGet(checksumsAsset.BrowserDownloadURL)
+		if cErr != nil {
+			fmt.Printf("Error downloading %s: %s\n", checksumsName, cErr)
+			log.Fatalf("[ERROR] downloading checksums: %s", cErr)
+		}
+		sigAsset, sigOk := release.asset(checksumsName + ".sig")
+		if !sigOk {
+			fmt.Printf("Release %s has no checksums signature, refusing to upgrade.\n", release.TagName)
+			log.Fatalf("[ERROR] release asset %s.sig not found", checksumsName)
+		}
+		signature, sErr := httpGet(sigAsset.BrowserDownloadURL)
+		if sErr != nil {
+			fmt.Printf("Error downloading %s: %s\n", sigAsset.Name, sErr)
+			log.Fatalf("[ERROR] downloading signature: %s", sErr)
+		}
+		if vErr := verifyReleaseSignature(signingKeys, checksums, signature); vErr != nil {
+			fmt.Printf("Error verifying %s, refusing to upgrade: %s\n", checksumsName, vErr)
+			log.Fatalf("[ERROR] verifying signature: %s", vErr)
+		}
+		fmt.Println("Verified checksums signature.")
+		archive, aErr := httpGet(archiveAsset.BrowserDownloadURL)
+		if aErr != nil {
+			fmt.Printf("Error downloading %s: %s\n", archiveName, aErr)
+			log.Fatalf("[ERROR] downloading release: %s", aErr)
+		}
+		if vErr := verifyReleaseChecksum(checksums, archiveName, archive); vErr != nil {
+			fmt.Printf("Error verifying %s: %s\n", archiveName, vErr)
+			log.Fatalf("[ERROR] verifying checksum: %s", vErr)
+		}
+		binary, eErr := extractBinary(archive)
+		if eErr != nil {
+			fmt.Printf("Error extracting %s: %s\n", archiveName, eErr)
+			log.Fatalf("[ERROR] extracting release: %s", eErr)
+		}
+		exe, uErr := replaceExecutable(binary)
+		if uErr != nil {
+			fmt.Printf("Error replacing kfutil binary: %s\n", uErr)
+			log.Fatalf("[ERROR] replacing binary: %s", uErr)
+		}
+		fmt.Printf("Upgraded %s to kfutil %s.\n", exe, release.TagName)
+	},
+}
+
+func init() {
+	var (
+		channel    string
+		checkOnly  bool
+		signingKey string
+	)
+	RootCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().StringVar(&channel, "channel", releaseChannelStable, "Release channel to upgrade from, one of stable or prerelease.")
+	upgradeCmd.Flags().BoolVar(&checkOnly, "check-only", false, "Only check whether a newer version is available.")
+	upgradeCmd.Flags().StringVar(&signingKey, "signing-key", "", "Path to the GPG public key to verify the release checksums signature with, instead of the embedded release signing key.")
+}
@@ -0,0 +1,134 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Keyfactor/keyfactor-go-client-sdk/api/keyfactor"
+	"github.com/spf13/cobra"
+)
+
+var workflowsCmd = &cobra.Command{
+	Use:   "workflows",
+	Short: "Keyfactor workflow APIs and utilities.",
+	Long:  `A collections of APIs and utilities for handling Keyfactor certificate request workflows and approvals.`,
+}
+
+var workflowsPendingCmd = &cobra.Command{
+	Use:   "pending",
+	Short: "List certificate requests pending approval.",
+	Long:  `List certificate requests pending approval. Use --query to filter using Keyfactor query syntax.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		query, _ := cmd.Flags().GetString("query")
+		sdkClient := initGenClient()
+		req := sdkClient.WorkflowApi.WorkflowGet(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion)
+		if query != "" {
+			req = req.PagedQueryQueryString(query)
+		}
+		pending, httpResponse, errors := req.Execute()
+		if errors != nil {
+			WriteApiError("Get pending requests", httpResponse, errors)
+			return
+		}
+		jsonString, marshallError := json.Marshal(pending)
+		if marshallError != nil {
+			log.Printf("%sError: %s", colorRed, marshallError)
+		}
+		fmt.Printf("%s", jsonString)
+	},
+}
+
+var workflowsApproveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Approve one or more pending certificate requests.",
+	Long:  `Approve one or more pending certificate requests by request ID.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		ids, _ := cmd.Flags().GetInt32Slice("id")
+		sdkClient := initGenClient()
+		result, httpResponse, errors := sdkClient.WorkflowApi.WorkflowApprovePendingRequests(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			RequestIds(ids).
+			Execute()
+		if errors != nil {
+			WriteApiError("Approve pending requests", httpResponse, errors)
+			return
+		}
+		printApproveDenyResult(result)
+	},
+}
+
+var workflowsDenyCmd = &cobra.Command{
+	Use:   "deny",
+	Short: "Deny one or more pending certificate requests.",
+	Long:  `Deny one or more pending certificate requests by request ID with a comment explaining the denial.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetOutput(io.Discard)
+		ids, _ := cmd.Flags().GetInt32Slice("id")
+		comment, _ := cmd.Flags().GetString("comment")
+		sdkClient := initGenClient()
+		denyReq := keyfactor.ModelsWorkflowDenialRequest{
+			Comment:               &comment,
+			CertificateRequestIds: ids,
+		}
+		result, httpResponse, errors := sdkClient.WorkflowApi.WorkflowDenyPendingRequests(context.Background()).
+			XKeyfactorRequestedWith(xKeyfactorRequestedWith).XKeyfactorApiVersion(xKeyfactorApiVersion).
+			Request(denyReq).
+			Execute()
+		if errors != nil {
+			WriteApiError("Deny pending requests", httpResponse, errors)
+			return
+		}
+		printApproveDenyResult(result)
+	},
+}
+
+// printApproveDenyResult writes the approve/deny result as JSON and exits non-zero if any request failed so scripts can
+// detect partial failures.
+func printApproveDenyResult(result *keyfactor.ModelsWorkflowApproveDenyResult) {
+	jsonString, marshallError := json.Marshal(result)
+	if marshallError != nil {
+		log.Printf("%sError: %s", colorRed, marshallError)
+	}
+	fmt.Printf("%s", jsonString)
+	if result != nil && len(result.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	var (
+		ids     []int32
+		comment string
+		query   string
+	)
+	RootCmd.AddCommand(workflowsCmd)
+
+	// PENDING requests command
+	workflowsCmd.AddCommand(workflowsPendingCmd)
+	workflowsPendingCmd.Flags().StringVarP(&query, "query", "q", "", "Keyfactor query string used to filter pending requests.")
+
+	// APPROVE requests command
+	workflowsCmd.AddCommand(workflowsApproveCmd)
+	workflowsApproveCmd.Flags().Int32SliceVarP(&ids, "id", "i", []int32{}, "ID(s) of the certificate request(s) to approve.")
+	workflowsApproveCmd.MarkFlagRequired("id")
+
+	// DENY requests command
+	workflowsCmd.AddCommand(workflowsDenyCmd)
+	workflowsDenyCmd.Flags().Int32SliceVarP(&ids, "id", "i", []int32{}, "ID(s) of the certificate request(s) to deny.")
+	workflowsDenyCmd.Flags().StringVarP(&comment, "comment", "c", "", "Reason for denying the request(s).")
+	workflowsDenyCmd.MarkFlagRequired("id")
+	workflowsDenyCmd.MarkFlagRequired("comment")
+}
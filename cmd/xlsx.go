@@ -0,0 +1,310 @@
+// Package cmd Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Minimal Office Open XML spreadsheet (.xlsx) support: a single styled header row per sheet on write, and cell values
+// of the first sheet on read.
+
+const (
+	xlsxMainNS      = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxRelNS       = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxPackageNS   = "http://schemas.openxmlformats.org/package/2006/relationships"
+	xlsxXMLHeader   = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	xlsxMaxColWidth = 80
+)
+
+// xlsxSheet is a worksheet to write. The first row is formatted as a header and frozen.
+type xlsxSheet struct {
+	Name string
+	Rows [][]string
+}
+
+func isXlsxPath(p string) bool {
+	return strings.EqualFold(filepath.Ext(p), ".xlsx")
+}
+
+// xlsxColumnName returns the column letters of the zero based column index, e.g. 0 is A and 27 is AB.
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxColumnIndex returns the zero based column index of a cell reference such as AB12.
+func xlsxColumnIndex(ref string) int {
+	idx := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		idx = idx*26 + int(c-'A'+1)
+	}
+	return idx - 1
+}
+
+func xlsxEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func xlsxWorksheet(rows [][]string) string {
+	var b strings.Builder
+	b.WriteString(xlsxXMLHeader)
+	fmt.Fprintf(&b, `<worksheet xmlns="%s" xmlns:r="%s">`, xlsxMainNS, xlsxRelNS)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+
+	var widths []int
+	for _, row := range rows {
+		for i, v := range row {
+			for len(widths) <= i {
+				widths = append(widths, 8)
+			}
+			if w := len(v) + 2; w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	if len(widths) > 0 {
+		b.WriteString("<cols>")
+		for i, w := range widths {
+			if w > xlsxMaxColWidth {
+				w = xlsxMaxColWidth
+			}
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, w)
+		}
+		b.WriteString("</cols>")
+	}
+
+	b.WriteString("<sheetData>")
+	for r, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, v := range row {
+			style := ""
+			if r == 0 {
+				style = ` s="1"`
+			}
+			fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, xlsxColumnName(c), r+1, style, xlsxEscape(v))
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+	return b.String()
+}
+
+// writeXlsxFile writes the sheets to a new workbook at path.
+func writeXlsxFile(outpath string, sheets []xlsxSheet) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := make(map[string]string)
+	var order []string
+	add := func(name string, content string) {
+		files[name] = content
+		order = append(order, name)
+	}
+
+	var overrides, sheetEntries, sheetRels strings.Builder
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&sheetEntries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheet.Name), n, n)
+		fmt.Fprintf(&sheetRels, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, n, xlsxRelNS, n)
+	}
+	add("[Content_Types].xml", xlsxXMLHeader+`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`+
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`+
+		`<Default Extension="xml" ContentType="application/xml"/>`+
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`+
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`+
+		overrides.String()+`</Types>`)
+	add("_rels/.rels", xlsxXMLHeader+fmt.Sprintf(`<Relationships xmlns="%s"><Relationship Id="rId1" Type="%s/officeDocument" Target="xl/workbook.xml"/></Relationships>`, xlsxPackageNS, xlsxRelNS))
+	add("xl/workbook.xml", xlsxXMLHeader+fmt.Sprintf(`<workbook xmlns="%s" xmlns:r="%s"><sheets>%s</sheets></workbook>`, xlsxMainNS, xlsxRelNS, sheetEntries.String()))
+	add("xl/_rels/workbook.xml.rels", xlsxXMLHeader+fmt.Sprintf(`<Relationships xmlns="%s">%s<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/></Relationships>`, xlsxPackageNS, sheetRels.String(), len(sheets)+1, xlsxRelNS))
+	// Style 1 is a bold header on a grey background.
+	add("xl/styles.xml", xlsxXMLHeader+fmt.Sprintf(`<styleSheet xmlns="%s">`, xlsxMainNS)+
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`+
+		`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>`+
+		`<fill><patternFill patternType="solid"><fgColor rgb="FFD9D9D9"/><bgColor indexed="64"/></patternFill></fill></fills>`+
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`+
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`+
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`+
+		`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/></cellXfs>`+
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`)
+	for i, sheet := range sheets {
+		add(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxWorksheet(sheet.Rows))
+	}
+
+	for _, name := range order {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return writeOutputFile(outpath, buf.Bytes(), 0644)
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// firstSheetPath returns the path in the archive of the first worksheet of the workbook.
+func firstSheetPath(zr *zip.Reader) string {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	wb, wErr := readZipFile(zr, "xl/workbook.xml")
+	rl, rErr := readZipFile(zr, "xl/_rels/workbook.xml.rels")
+	if wErr == nil && rErr == nil && xml.Unmarshal(wb, &workbook) == nil && xml.Unmarshal(rl, &rels) == nil && len(workbook.Sheets) > 0 {
+		for _, r := range rels.Relationships {
+			if r.ID == workbook.Sheets[0].ID {
+				if strings.HasPrefix(r.Target, "/") {
+					return strings.TrimPrefix(r.Target, "/")
+				}
+				return path.Join("xl", r.Target)
+			}
+		}
+	}
+	return "xl/worksheets/sheet1.xml"
+}
+
+// isXlsxData reports whether data is a zip archive, i.e. possibly an .xlsx workbook.
+func isXlsxData(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// readXlsxData returns the cell values of the first worksheet of the workbook. Row i of the result is row i+1 of the
+// sheet, rows without values are empty.
+func readXlsxData(data []byte) ([][]string, error) {
+	zr, zErr := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if zErr != nil {
+		return nil, fmt.Errorf("not a valid xlsx file: %s", zErr)
+	}
+
+	var shared []string
+	if ss, sErr := readZipFile(zr, "xl/sharedStrings.xml"); sErr == nil {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if xErr := xml.Unmarshal(ss, &sst); xErr != nil {
+			return nil, fmt.Errorf("reading shared strings: %s", xErr)
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	sheetData, shErr := readZipFile(zr, firstSheetPath(zr))
+	if shErr != nil {
+		return nil, fmt.Errorf("reading first worksheet: %s", shErr)
+	}
+	var sheet struct {
+		Rows []struct {
+			Num   int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if xErr := xml.Unmarshal(sheetData, &sheet); xErr != nil {
+		return nil, fmt.Errorf("reading worksheet: %s", xErr)
+	}
+
+	var rows [][]string
+	for i, row := range sheet.Rows {
+		num := row.Num
+		if num == 0 {
+			num = i + 1
+		}
+		for len(rows) < num {
+			rows = append(rows, nil)
+		}
+		var values []string
+		for j, c := range row.Cells {
+			col := j
+			if c.Ref != "" {
+				col = xlsxColumnIndex(c.Ref)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+			switch c.Type {
+			case "s":
+				idx, _ := strconv.Atoi(c.Value)
+				if idx >= 0 && idx < len(shared) {
+					values[col] = shared[idx]
+				}
+			case "inlineStr":
+				values[col] = c.Inline.String()
+			case "b":
+				values[col] = strconv.FormatBool(c.Value == "1")
+			default:
+				values[col] = c.Value
+			}
+		}
+		rows[num-1] = values
+	}
+	return rows, nil
+}
@@ -8,7 +8,11 @@ require (
 	github.com/Keyfactor/keyfactor-go-client v1.4.1
 	github.com/Keyfactor/keyfactor-go-client-sdk v1.0.1
 	github.com/spf13/cobra v1.6.1
+	github.com/spf13/pflag v1.0.5
+	go.mozilla.org/pkcs7 v0.0.0-20210826202110-33d05740a352
 	golang.org/x/crypto v0.7.0
+	golang.org/x/sys v0.6.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -20,10 +24,9 @@ require (
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/spbsoluble/go-pkcs12 v0.3.1 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-	go.mozilla.org/pkcs7 v0.0.0-20210826202110-33d05740a352 // indirect
-	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/term v0.6.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// The fork adds AuthConfig.HTTPClient, so the client's calls use the API timeouts of kfutil instead of a fixed 10s.
+replace github.com/Keyfactor/keyfactor-go-client => ./third_party/keyfactor-go-client
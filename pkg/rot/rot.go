@@ -0,0 +1,585 @@
+// Package rot Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// Package rot audits and reconciles the trusted root certificates of Keyfactor certificate stores. It is the library
+// behind `kfutil stores rot` and can be embedded in other Go tools:
+//
+//	client, _ := api.NewKeyfactorClient(&api.AuthConfig{...})
+//	store, _, _ := rot.LoadStore(ctx, client, rot.Store{ID: storeID})
+//	result, _ := rot.Audit(ctx, client, rot.AuditRequest{
+//		AddCerts: []string{thumbprint},
+//		Stores:   map[string]rot.Store{store.ID: *store},
+//	})
+//	outcome := rot.Reconcile(ctx, client, result.ActionList(), rot.ReconcileOptions{})
+//
+// The Keyfactor API client does not accept a context. ctx is checked between API calls, so cancelling it stops an
+// audit or reconcile after the call in progress.
+package rot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+)
+
+// API is the subset of the Keyfactor API client used by this package. It is implemented by *api.Client.
+type API interface {
+	GetCertificateStoreByID(storeId string) (*api.GetCertificateStoreResponse, error)
+	GetCertStoreInventory(storeId string) (*[]api.CertStoreInventory, error)
+	GetCertificateContext(gca *api.GetCertificateContextArgs) (*api.GetCertificateResponse, error)
+	AddCertificateToStores(config *api.AddCertificateToStore) ([]string, error)
+	RemoveCertificateFromStores(config *api.RemoveCertificateFromStore) ([]string, error)
+}
+
+// Store is a certificate store and the certificates in its inventory.
+type Store struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Machine     string          `json:"address"`
+	Path        string          `json:"path"`
+	Thumbprints map[string]bool `json:"thumbprints,omitempty"`
+	Serials     map[string]bool `json:"serials,omitempty"`
+	Ids         map[int]bool    `json:"ids,omitempty"`
+	// Aliases are the inventory entry names of the certificates, keyed like the thumbprint, serial and ID indexes
+	// with the prefixes "serial:" and "id:" for serials and IDs.
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// Action adds a certificate to or removes it from a store.
+type Action struct {
+	StoreID    string `json:"store_id,omitempty"`
+	StoreType  string `json:"store_type,omitempty"`
+	StorePath  string `json:"store_path,omitempty"`
+	Thumbprint string `json:"thumbprint,omitempty"`
+	CertID     int    `json:"cert_id,omitempty" mapstructure:"CertID,omitempty"`
+	AddCert    bool   `json:"add,omitempty" mapstructure:"AddCert,omitempty"`
+	RemoveCert bool   `json:"remove,omitempty"  mapstructure:"RemoveCert,omitempty"`
+	// Alias is the alias of the certificate in the store, from the store inventory. Certificates are removed by
+	// alias, by thumbprint if it is empty.
+	Alias string `json:"alias,omitempty" mapstructure:"Alias,omitempty"`
+	// EntryParameters are the entry parameters passed when adding the certificate, for store types that need them.
+	EntryParameters map[string]string `json:"entry_parameters,omitempty"`
+}
+
+// RootStoreCriteria decides whether a store holds trusted roots. Negative values disable a check.
+type RootStoreCriteria struct {
+	// MinCerts is the minimum number of certificates in the store.
+	MinCerts int
+	// MaxKeys is the maximum number of entries with a private key.
+	MaxKeys int
+	// MaxLeaves is the maximum number of certificates that are not self signed.
+	MaxLeaves int
+}
+
+// NoRootStoreCriteria accepts every store as a root store.
+var NoRootStoreCriteria = RootStoreCriteria{MinCerts: -1, MaxKeys: -1, MaxLeaves: -1}
+
+// IsRootStore returns true if the inventory of a store meets the criteria.
+func IsRootStore(inventory []api.CertStoreInventory, criteria RootStoreCriteria) bool {
+	leafCount := 0
+	keyCount := 0
+	certCount := 0
+	for _, inv := range inventory {
+		certCount += len(inv.Certificates)
+		for _, cert := range inv.Certificates {
+			if cert.IssuedDN != cert.IssuerDN {
+				leafCount++
+			}
+			if inv.Parameters["PrivateKeyEntry"] == "Yes" {
+				keyCount++
+			}
+		}
+	}
+	if criteria.MinCerts >= 0 && certCount < criteria.MinCerts {
+		return false
+	}
+	if criteria.MaxLeaves >= 0 && leafCount > criteria.MaxLeaves {
+		return false
+	}
+	if criteria.MaxKeys >= 0 && keyCount > criteria.MaxKeys {
+		return false
+	}
+	return true
+}
+
+// MatchOn selects how a certificate is found in the inventory of a store.
+type MatchOn string
+
+const (
+	// MatchThumbprint finds certificates by thumbprint, the default.
+	MatchThumbprint MatchOn = "thumbprint"
+	// MatchSerial finds certificates by serial number, e.g. for inputs exported by tools that only record serials.
+	MatchSerial MatchOn = "serial"
+	// MatchID finds certificates by Keyfactor certificate ID.
+	MatchID MatchOn = "id"
+	// MatchAny finds certificates by thumbprint, serial number or certificate ID.
+	MatchAny MatchOn = "any"
+)
+
+// ParseMatchOn parses a MatchOn value, case-insensitively. An empty value is MatchThumbprint.
+func ParseMatchOn(s string) (MatchOn, error) {
+	switch m := MatchOn(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return MatchThumbprint, nil
+	case MatchThumbprint, MatchSerial, MatchID, MatchAny:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid match '%s', must be one of %s, %s, %s or %s", s, MatchThumbprint, MatchSerial, MatchID, MatchAny)
+}
+
+// NormalizeSerial returns a serial number in the form it is indexed by in Store.Serials: upper case hex without
+// separators or leading zeros.
+func NormalizeSerial(serial string) string {
+	serial = strings.ToUpper(strings.NewReplacer(":", "", " ", "", "-", "").Replace(strings.TrimSpace(serial)))
+	if trimmed := strings.TrimLeft(serial, "0"); trimmed != "" {
+		return trimmed
+	}
+	return serial
+}
+
+// Alias returns the alias of cert in the store, found according to matchOn, or "" if the store does not hold it or its
+// inventory has no alias for it.
+func (s Store) Alias(cert *api.GetCertificateResponse, matchOn MatchOn) string {
+	var keys []string
+	if matchOn != MatchSerial && matchOn != MatchID && cert.Thumbprint != "" {
+		keys = append(keys, strings.ToUpper(cert.Thumbprint))
+	}
+	if (matchOn == MatchSerial || matchOn == MatchAny) && cert.SerialNumber != "" {
+		keys = append(keys, "serial:"+NormalizeSerial(cert.SerialNumber))
+	}
+	if (matchOn == MatchID || matchOn == MatchAny) && cert.Id != 0 {
+		keys = append(keys, fmt.Sprintf("id:%d", cert.Id))
+	}
+	for _, k := range keys {
+		if alias := s.Aliases[k]; alias != "" {
+			return alias
+		}
+	}
+	return ""
+}
+
+// Contains reports whether the store holds cert, matched according to matchOn.
+func (s Store) Contains(cert *api.GetCertificateResponse, matchOn MatchOn) bool {
+	byThumbprint := cert.Thumbprint != "" && s.Thumbprints[strings.ToUpper(cert.Thumbprint)]
+	bySerial := cert.SerialNumber != "" && s.Serials[NormalizeSerial(cert.SerialNumber)]
+	byID := cert.Id != 0 && s.Ids[cert.Id]
+	switch matchOn {
+	case MatchSerial:
+		return bySerial
+	case MatchID:
+		return byID
+	case MatchAny:
+		return byThumbprint || bySerial || byID
+	default:
+		return byThumbprint
+	}
+}
+
+// NewStore returns store with the certificates of its inventory, indexed by upper case thumbprint, normalized serial
+// number and certificate ID, and with the aliases of the certificates.
+func NewStore(store Store, inventory []api.CertStoreInventory) Store {
+	store.Thumbprints = make(map[string]bool)
+	store.Serials = make(map[string]bool)
+	store.Ids = make(map[int]bool)
+	store.Aliases = make(map[string]string)
+	for _, inv := range inventory {
+		for t, v := range inv.Thumbprints {
+			store.Thumbprints[strings.ToUpper(t)] = v
+		}
+		for s, v := range inv.Serials {
+			store.Serials[NormalizeSerial(s)] = v
+		}
+		for id, v := range inv.Ids {
+			store.Ids[id] = v
+		}
+		for _, cert := range inv.Certificates {
+			if cert.Thumbprint != "" {
+				store.Thumbprints[strings.ToUpper(cert.Thumbprint)] = true
+			}
+			if cert.SerialNumber != "" {
+				store.Serials[NormalizeSerial(cert.SerialNumber)] = true
+			}
+			if cert.Id != 0 {
+				store.Ids[cert.Id] = true
+			}
+			if inv.Name == "" {
+				continue
+			}
+			if cert.Thumbprint != "" {
+				store.Aliases[strings.ToUpper(cert.Thumbprint)] = inv.Name
+			}
+			if cert.SerialNumber != "" {
+				store.Aliases["serial:"+NormalizeSerial(cert.SerialNumber)] = inv.Name
+			}
+			if cert.Id != 0 {
+				store.Aliases[fmt.Sprintf("id:%d", cert.Id)] = inv.Name
+			}
+		}
+	}
+	return store
+}
+
+// LoadStore looks up a store by ID and reads its inventory. Type, Machine and Path are taken from the store if
+// they are empty.
+func LoadStore(ctx context.Context, client API, store Store) (*Store, []api.CertStoreInventory, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.GetCertificateStoreByID(store.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting certificate store %s: %w", store.ID, err)
+	}
+	if store.Type == "" {
+		store.Type = fmt.Sprintf("%d", resp.CertStoreType)
+	}
+	if store.Machine == "" {
+		store.Machine = resp.ClientMachine
+	}
+	if store.Path == "" {
+		store.Path = resp.StorePath
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	inventory, err := client.GetCertStoreInventory(store.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting inventory of certificate store %s: %w", store.ID, err)
+	}
+	if inventory == nil {
+		inventory = &[]api.CertStoreInventory{}
+	}
+	loaded := NewStore(store, *inventory)
+	return &loaded, *inventory, nil
+}
+
+// AuditRequest is the desired trust state to audit stores against.
+type AuditRequest struct {
+	// AddCerts are the thumbprints, or Keyfactor certificate IDs, of the certificates every store must contain.
+	AddCerts []string
+	// RemoveCerts are the thumbprints, or Keyfactor certificate IDs, of the certificates no store may contain.
+	RemoveCerts []string
+	// Stores are the stores to audit, keyed by ID.
+	Stores map[string]Store
+	// CollectionID scopes certificate lookups to a collection, for users whose permissions are limited to it. 0 looks
+	// up certificates without a collection.
+	CollectionID int
+	// MatchOn selects how certificates are found in the store inventories, MatchThumbprint if empty.
+	MatchOn MatchOn
+}
+
+// AuditEntry is the state of one certificate in one store.
+type AuditEntry struct {
+	Thumbprint string
+	CertID     int
+	SubjectDN  string
+	IssuerDN   string
+	Store      Store
+	// Add and Remove are set if the certificate must be added to or removed from the store.
+	Add    bool
+	Remove bool
+	// Deployed is set if the certificate is in the store.
+	Deployed bool
+	// Alias is the alias of the certificate in the store if it is deployed.
+	Alias string
+}
+
+// AuditResult is the outcome of an audit.
+type AuditResult struct {
+	Entries []AuditEntry
+	// Actions are the actions needed to reach the desired state, keyed by thumbprint.
+	Actions map[string][]Action
+	// LookupErrors are the certificates that could not be looked up in Keyfactor, keyed by thumbprint.
+	LookupErrors map[string]error
+}
+
+// ActionList returns the actions of the audit ordered by thumbprint and store.
+func (r *AuditResult) ActionList() []Action {
+	var actions []Action
+	for _, certActions := range r.Actions {
+		actions = append(actions, certActions...)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Thumbprint != actions[j].Thumbprint {
+			return actions[i].Thumbprint < actions[j].Thumbprint
+		}
+		return actions[i].StoreID < actions[j].StoreID
+	})
+	return actions
+}
+
+// lookupCert returns a certificate by thumbprint or certificate ID, in the collection with collectionID if it is not 0.
+func lookupCert(client API, cert string, collectionID int) (*api.GetCertificateResponse, error) {
+	includeMetadata, includeLocations := true, true
+	args := &api.GetCertificateContextArgs{
+		IncludeMetadata:  &includeMetadata,
+		IncludeLocations: &includeLocations,
+		Thumbprint:       cert,
+	}
+	if id, err := strconv.Atoi(cert); err == nil && id > 0 {
+		args.Thumbprint, args.Id = "", id
+	}
+	if collectionID != 0 {
+		args.CollectionId = &collectionID
+	}
+	return client.GetCertificateContext(args)
+}
+
+// Audit compares the stores to the desired state and returns the actions needed to reach it. Certificates that
+// cannot be looked up are reported in LookupErrors and skipped.
+func Audit(ctx context.Context, client API, req AuditRequest) (*AuditResult, error) {
+	result := &AuditResult{
+		Actions:      make(map[string][]Action),
+		LookupErrors: make(map[string]error),
+	}
+	storeIDs := make([]string, 0, len(req.Stores))
+	for id := range req.Stores {
+		storeIDs = append(storeIDs, id)
+	}
+	sort.Strings(storeIDs)
+
+	audit := func(ref string, add bool) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cert, err := lookupCert(client, ref, req.CollectionID)
+		if err != nil {
+			result.LookupErrors[ref] = err
+			return nil
+		}
+		if cert.Thumbprint == "" {
+			cert.Thumbprint = ref
+		}
+		thumbprint := cert.Thumbprint
+		for _, id := range storeIDs {
+			store := req.Stores[id]
+			deployed := store.Contains(cert, req.MatchOn)
+			alias := ""
+			if deployed {
+				alias = store.Alias(cert, req.MatchOn)
+			}
+			entry := AuditEntry{
+				Thumbprint: thumbprint,
+				CertID:     cert.Id,
+				SubjectDN:  cert.IssuedDN,
+				IssuerDN:   cert.IssuerDN,
+				Store:      store,
+				Add:        add && !deployed,
+				Remove:     !add && deployed,
+				Deployed:   deployed,
+				Alias:      alias,
+			}
+			result.Entries = append(result.Entries, entry)
+			if entry.Add || entry.Remove {
+				result.Actions[thumbprint] = append(result.Actions[thumbprint], Action{
+					Thumbprint: thumbprint,
+					CertID:     cert.Id,
+					StoreID:    store.ID,
+					StoreType:  store.Type,
+					StorePath:  store.Path,
+					AddCert:    entry.Add,
+					RemoveCert: entry.Remove,
+					Alias:      entry.Alias,
+				})
+			}
+		}
+		return nil
+	}
+	for _, ref := range req.AddCerts {
+		if err := audit(ref, true); err != nil {
+			return result, err
+		}
+	}
+	for _, ref := range req.RemoveCerts {
+		if err := audit(ref, false); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// DefaultMaxStoresPerRequest is the default number of stores a certificate is added to or removed from in one
+// request by Reconcile.
+const DefaultMaxStoresPerRequest = 50
+
+// AddToStore schedules adding a certificate to a store entry. The entry password is set to an empty password if
+// none is given, as the API client requires one.
+func AddToStore(ctx context.Context, client API, certID int, entry api.CertificateStore) error {
+	return AddToStores(ctx, client, certID, []api.CertificateStore{entry})
+}
+
+// AddToStores schedules adding a certificate to several store entries with a single request.
+func AddToStores(ctx context.Context, client API, certID int, entries []api.CertificateStore) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stores := make([]api.CertificateStore, len(entries))
+	for i, entry := range entries {
+		if entry.EntryPassword == nil {
+			entry.EntryPassword = &api.EntryPassword{}
+		}
+		stores[i] = entry
+	}
+	immediate := true
+	_, err := client.AddCertificateToStores(&api.AddCertificateToStore{
+		CertificateId:     certID,
+		CertificateStores: &stores,
+		InventorySchedule: &api.InventorySchedule{Immediate: &immediate},
+	})
+	return err
+}
+
+// RemoveFromStore schedules removing a certificate from a store entry.
+func RemoveFromStore(ctx context.Context, client API, certID int, entry api.CertificateStore) error {
+	return RemoveFromStores(ctx, client, certID, []api.CertificateStore{entry})
+}
+
+// RemoveFromStores schedules removing a certificate from several store entries with a single request.
+func RemoveFromStores(ctx context.Context, client API, certID int, entries []api.CertificateStore) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stores := append([]api.CertificateStore(nil), entries...)
+	immediate := true
+	_, err := client.RemoveCertificateFromStores(&api.RemoveCertificateFromStore{
+		CertificateId:     certID,
+		CertificateStores: &stores,
+		InventorySchedule: &api.InventorySchedule{Immediate: &immediate},
+	})
+	return err
+}
+
+// BatchActions groups the indices of actions that add or remove the same certificate, so each group can be applied
+// with one AddToStores or RemoveFromStores request. Groups hold at most maxStores actions and are ordered by their
+// first action. A maxStores below 1 puts every action in its own group.
+func BatchActions(actions []Action, maxStores int) [][]int {
+	type batchKey struct {
+		certID     int
+		thumbprint string
+		add        bool
+	}
+	var batches [][]int
+	open := make(map[batchKey]int)
+	for i, a := range actions {
+		key := batchKey{certID: a.CertID, thumbprint: a.Thumbprint, add: a.AddCert}
+		if b, ok := open[key]; ok && maxStores > 1 && len(batches[b]) < maxStores {
+			batches[b] = append(batches[b], i)
+			continue
+		}
+		open[key] = len(batches)
+		batches = append(batches, []int{i})
+	}
+	return batches
+}
+
+// EntryFunc returns the store entry an action is applied to, e.g. to set an alias.
+type EntryFunc func(a Action) (api.CertificateStore, error)
+
+// DefaultEntry adds certificates without an alias and removes them by their alias in the store, or by thumbprint if
+// the alias is not known.
+func DefaultEntry(a Action) (api.CertificateStore, error) {
+	if a.RemoveCert {
+		return api.CertificateStore{CertificateStoreId: a.StoreID, Alias: RemovalAlias(a)}, nil
+	}
+	return api.CertificateStore{CertificateStoreId: a.StoreID, Overwrite: true}, nil
+}
+
+// RemovalAlias returns the alias a certificate is removed from a store by: its alias in the store, or its thumbprint if
+// the alias is not known.
+func RemovalAlias(a Action) string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	return a.Thumbprint
+}
+
+// ReconcileOptions configures Reconcile.
+type ReconcileOptions struct {
+	// DryRun returns the actions without applying them.
+	DryRun bool
+	// Entry builds the store entry of an action, DefaultEntry if nil.
+	Entry EntryFunc
+	// MaxStoresPerRequest is the number of stores a certificate is added to or removed from per request,
+	// DefaultMaxStoresPerRequest if 0. 1 sends a request per action.
+	MaxStoresPerRequest int
+}
+
+// ActionResult is the outcome of an action. Err is nil if the job was scheduled.
+type ActionResult struct {
+	Action Action
+	Err    error
+}
+
+// ReconcileResult is the outcome of a reconcile.
+type ReconcileResult struct {
+	Results   []ActionResult
+	Succeeded int
+	Failed    int
+}
+
+// Reconcile applies the actions, sending one request per certificate for up to MaxStoresPerRequest stores. If a
+// request fails, all its actions fail. It stops when ctx is cancelled, the remaining actions are reported with the
+// context error. Results are in the order of actions.
+func Reconcile(ctx context.Context, client API, actions []Action, opts ReconcileOptions) ReconcileResult {
+	entryFunc := opts.Entry
+	if entryFunc == nil {
+		entryFunc = DefaultEntry
+	}
+	maxStores := opts.MaxStoresPerRequest
+	if maxStores == 0 {
+		maxStores = DefaultMaxStoresPerRequest
+	}
+	errs := make([]error, len(actions))
+	for _, batch := range BatchActions(actions, maxStores) {
+		if err := ctx.Err(); err != nil || opts.DryRun {
+			for _, i := range batch {
+				errs[i] = err
+			}
+			continue
+		}
+		var (
+			entries []api.CertificateStore
+			pending []int
+		)
+		for _, i := range batch {
+			entry, err := entryFunc(actions[i])
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			entries = append(entries, entry)
+			pending = append(pending, i)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		first := actions[pending[0]]
+		var err error
+		if first.AddCert {
+			err = AddToStores(ctx, client, first.CertID, entries)
+		} else if first.RemoveCert {
+			err = RemoveFromStores(ctx, client, first.CertID, entries)
+		}
+		for _, i := range pending {
+			errs[i] = err
+		}
+	}
+
+	var result ReconcileResult
+	for i, a := range actions {
+		if errs[i] != nil {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		result.Results = append(result.Results, ActionResult{Action: a, Err: errs[i]})
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+// Package rot Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package rot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+)
+
+func TestParseMatchOn(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    MatchOn
+		wantErr bool
+	}{
+		{"", MatchThumbprint, false},
+		{"thumbprint", MatchThumbprint, false},
+		{" Serial ", MatchSerial, false},
+		{"ID", MatchID, false},
+		{"any", MatchAny, false},
+		{"subject", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMatchOn(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMatchOn(%q) error = %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMatchOn(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSerial(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0a1b2c", "A1B2C"},
+		{"0A:1B:2C", "A1B2C"},
+		{" 0a 1b 2c ", "A1B2C"},
+		{"0a-1b-2c", "A1B2C"},
+		{"00", "00"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSerial(tt.in); got != tt.want {
+			t.Errorf("NormalizeSerial(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStoreMatching(t *testing.T) {
+	store := NewStore(Store{ID: "store-1"}, []api.CertStoreInventory{{
+		Name:         "root-ca",
+		Certificates: []api.InventoriedCertificate{{Id: 42, Thumbprint: "abcdef", SerialNumber: "0a:1b"}},
+	}})
+	tests := []struct {
+		name      string
+		cert      api.GetCertificateResponse
+		matchOn   MatchOn
+		wantFound bool
+		wantAlias string
+	}{
+		{"thumbprint, any case", api.GetCertificateResponse{Thumbprint: "ABCDEF"}, MatchThumbprint, true, "root-ca"},
+		{"thumbprint ignores serial", api.GetCertificateResponse{SerialNumber: "A1B"}, MatchThumbprint, false, ""},
+		{"serial, normalized", api.GetCertificateResponse{SerialNumber: "0A1B"}, MatchSerial, true, "root-ca"},
+		{"serial ignores thumbprint", api.GetCertificateResponse{Thumbprint: "abcdef"}, MatchSerial, false, ""},
+		{"id", api.GetCertificateResponse{Id: 42}, MatchID, true, "root-ca"},
+		{"id ignores serial", api.GetCertificateResponse{SerialNumber: "0a1b"}, MatchID, false, ""},
+		{"any by serial", api.GetCertificateResponse{Thumbprint: "other", SerialNumber: "a1b"}, MatchAny, true, "root-ca"},
+		{"any by id", api.GetCertificateResponse{Id: 42}, MatchAny, true, "root-ca"},
+		{"any without match", api.GetCertificateResponse{Thumbprint: "other", Id: 7}, MatchAny, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.Contains(&tt.cert, tt.matchOn); got != tt.wantFound {
+				t.Errorf("Contains() = %t, want %t", got, tt.wantFound)
+			}
+			if got := store.Alias(&tt.cert, tt.matchOn); got != tt.wantAlias {
+				t.Errorf("Alias() = %q, want %q", got, tt.wantAlias)
+			}
+		})
+	}
+}
+
+func TestBatchActions(t *testing.T) {
+	add := func(certID int, store string) Action {
+		return Action{StoreID: store, CertID: certID, AddCert: true}
+	}
+	remove := func(certID int, store string) Action {
+		return Action{StoreID: store, CertID: certID, RemoveCert: true}
+	}
+	tests := []struct {
+		name      string
+		actions   []Action
+		maxStores int
+		want      [][]int
+	}{
+		{"empty", nil, 10, nil},
+		{"same cert grouped", []Action{add(1, "a"), add(1, "b"), add(1, "c")}, 10, [][]int{{0, 1, 2}}},
+		{"add and remove apart", []Action{add(1, "a"), remove(1, "b"), add(1, "c")}, 10, [][]int{{0, 2}, {1}}},
+		{"ordered by first action", []Action{add(2, "a"), add(1, "a"), add(2, "b")}, 10, [][]int{{0, 2}, {1}}},
+		{"split at max stores", []Action{add(1, "a"), add(1, "b"), add(1, "c")}, 2, [][]int{{0, 1}, {2}}},
+		{"no batching below 2", []Action{add(1, "a"), add(1, "b")}, 1, [][]int{{0}, {1}}},
+		{"no batching at 0", []Action{add(1, "a"), add(1, "b")}, 0, [][]int{{0}, {1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BatchActions(tt.actions, tt.maxStores); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BatchActions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// Package storetypes Copyright 2023 Keyfactor
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// Package storetypes provisions Keyfactor certificate store types from the definitions in store_types.json. It is the
+// library behind `kfutil store-types create` and can be embedded in other Go tools:
+//
+//	defs, _ := storetypes.ParseDefinitions(data)
+//	st, _ := storetypes.FromDefinition(defs["PEM"])
+//	resp, _ := storetypes.Create(ctx, client, st)
+//
+// Ensure makes provisioning re-runnable: it only creates a store type if none has its short name, and updates an
+// existing one whose definition differs when asked to.
+package storetypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Keyfactor/keyfactor-go-client/api"
+)
+
+// API is the subset of the Keyfactor API client used by this package. It is implemented by *api.Client.
+type API interface {
+	CreateStoreType(ca *api.CertificateStoreType) (*api.CertificateStoreType, error)
+	UpdateStoreType(ca *api.CertificateStoreType) (*api.CertificateStoreType, error)
+	ListCertificateStoreTypes() (*[]api.CertificateStoreType, error)
+	GetCertificateStoreType(id interface{}) (*api.CertificateStoreType, error)
+}
+
+// Definitions are store type definitions keyed by short name, in the format of store_types.json.
+type Definitions map[string]map[string]interface{}
+
+// ParseDefinitions parses store_types.json, a JSON array of store type definitions.
+func ParseDefinitions(data []byte) (Definitions, error) {
+	var list []map[string]interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing store type definitions: %w", err)
+	}
+	defs := make(Definitions, len(list))
+	for _, def := range list {
+		shortName, ok := def["ShortName"].(string)
+		if !ok || shortName == "" {
+			return nil, fmt.Errorf("parsing store type definitions: definition without a ShortName")
+		}
+		defs[strings.ToUpper(shortName)] = def
+	}
+	return defs, nil
+}
+
+// definition reads typed fields of a store type definition and records the first missing or mistyped field.
+type definition struct {
+	fields map[string]interface{}
+	name   string
+	err    error
+}
+
+func (d *definition) fail(key string, want string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("store type definition %s: field %s must be a %s", d.name, key, want)
+	}
+}
+
+func (d *definition) string(m map[string]interface{}, key string) string {
+	v, ok := m[key].(string)
+	if !ok {
+		d.fail(key, "string")
+	}
+	return v
+}
+
+func (d *definition) bool(m map[string]interface{}, key string) bool {
+	v, ok := m[key].(bool)
+	if !ok {
+		d.fail(key, "boolean")
+	}
+	return v
+}
+
+func (d *definition) object(key string) map[string]interface{} {
+	v, ok := d.fields[key].(map[string]interface{})
+	if !ok {
+		d.fail(key, "object")
+	}
+	return v
+}
+
+// properties converts the custom field definitions of a store type.
+func (d *definition) properties() []api.StoreTypePropertyDefinition {
+	var output []api.StoreTypePropertyDefinition
+	props, ok := d.fields["Properties"].([]interface{})
+	if !ok {
+		if d.fields["Properties"] != nil {
+			d.fail("Properties", "list")
+		}
+		return output
+	}
+	for _, prop := range props {
+		p, ok := prop.(map[string]interface{})
+		if !ok {
+			d.fail("Properties", "list of objects")
+			return output
+		}
+		dependsOn, _ := p["DependsOn"].(string)
+		output = append(output, api.StoreTypePropertyDefinition{
+			Name:         d.string(p, "Name"),
+			DisplayName:  d.string(p, "DisplayName"),
+			Type:         d.string(p, "Type"),
+			DependsOn:    dependsOn,
+			DefaultValue: p["DefaultValue"],
+			Required:     d.bool(p, "Required"),
+		})
+	}
+	return output
+}
+
+// FromDefinition builds the create request of a store type from its definition. Entry parameters are not created.
+func FromDefinition(def map[string]interface{}) (*api.CertificateStoreType, error) {
+	d := &definition{fields: def}
+	d.name, _ = def["ShortName"].(string)
+	props := d.properties()
+	ops := d.object("SupportedOperations")
+	pwOpts := d.object("PasswordOptions")
+	st := &api.CertificateStoreType{
+		Name:       d.string(def, "Name"),
+		ShortName:  d.string(def, "ShortName"),
+		Capability: d.string(def, "Capability"),
+		SupportedOperations: &api.StoreTypeSupportedOperations{
+			Add:        d.bool(ops, "Add"),
+			Create:     d.bool(ops, "Create"),
+			Discovery:  d.bool(ops, "Discovery"),
+			Enrollment: d.bool(ops, "Enrollment"),
+			Remove:     d.bool(ops, "Remove"),
+		},
+		Properties:      &props,
+		EntryParameters: &[]api.EntryParameter{},
+		PasswordOptions: &api.StoreTypePasswordOptions{
+			EntrySupported: d.bool(pwOpts, "EntrySupported"),
+			StoreRequired:  d.bool(pwOpts, "StoreRequired"),
+			Style:          d.string(pwOpts, "Style"),
+		},
+		PrivateKeyAllowed:  d.string(def, "PrivateKeyAllowed"),
+		ServerRequired:     d.bool(def, "ServerRequired"),
+		PowerShell:         d.bool(def, "PowerShell"),
+		BlueprintAllowed:   d.bool(def, "BlueprintAllowed"),
+		CustomAliasAllowed: d.string(def, "CustomAliasAllowed"),
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return st, nil
+}
+
+// Create creates a store type.
+func Create(ctx context.Context, client API, st *api.CertificateStoreType) (*api.CertificateStoreType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp, err := client.CreateStoreType(st)
+	if err != nil {
+		return nil, fmt.Errorf("creating store type %s: %w", st.ShortName, err)
+	}
+	return resp, nil
+}
+
+// Outcome is what Ensure did with a store type.
+type Outcome string
+
+const (
+	// Created means no store type had the short name and it was created.
+	Created Outcome = "created"
+	// Unchanged means the store type exists with the same definition.
+	Unchanged Outcome = "unchanged"
+	// Differs means the store type exists with a different definition and was left as is.
+	Differs Outcome = "differs"
+	// Updated means the store type existed with a different definition and was updated.
+	Updated Outcome = "updated"
+)
+
+// Find returns the store type with shortName, compared case-insensitively, or nil if there is none.
+func Find(ctx context.Context, client API, shortName string) (*api.CertificateStoreType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	list, err := client.ListCertificateStoreTypes()
+	if err != nil {
+		return nil, fmt.Errorf("listing store types: %w", err)
+	}
+	if list == nil {
+		return nil, nil
+	}
+	for _, st := range *list {
+		if !strings.EqualFold(st.ShortName, shortName) {
+			continue
+		}
+		// The list may not include the properties of each store type.
+		existing, err := client.GetCertificateStoreType(st.StoreType)
+		if err != nil {
+			return nil, fmt.Errorf("getting store type %s: %w", shortName, err)
+		}
+		return existing, nil
+	}
+	return nil, nil
+}
+
+// Diff returns the names of the fields set by FromDefinition whose values differ between existing and desired, sorted.
+// Properties are compared by name, entry parameters are not compared.
+func Diff(existing *api.CertificateStoreType, desired *api.CertificateStoreType) []string {
+	var diffs []string
+	differs := func(field string, a, b interface{}) {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			diffs = append(diffs, field)
+		}
+	}
+	differs("Name", existing.Name, desired.Name)
+	differs("Capability", existing.Capability, desired.Capability)
+	differs("PrivateKeyAllowed", existing.PrivateKeyAllowed, desired.PrivateKeyAllowed)
+	differs("ServerRequired", existing.ServerRequired, desired.ServerRequired)
+	differs("PowerShell", existing.PowerShell, desired.PowerShell)
+	differs("BlueprintAllowed", existing.BlueprintAllowed, desired.BlueprintAllowed)
+	differs("CustomAliasAllowed", existing.CustomAliasAllowed, desired.CustomAliasAllowed)
+	var existingOps, desiredOps api.StoreTypeSupportedOperations
+	if existing.SupportedOperations != nil {
+		existingOps = *existing.SupportedOperations
+	}
+	if desired.SupportedOperations != nil {
+		desiredOps = *desired.SupportedOperations
+	}
+	differs("SupportedOperations", existingOps, desiredOps)
+	var existingPw, desiredPw api.StoreTypePasswordOptions
+	if existing.PasswordOptions != nil {
+		existingPw = *existing.PasswordOptions
+	}
+	if desired.PasswordOptions != nil {
+		desiredPw = *desired.PasswordOptions
+	}
+	differs("PasswordOptions", existingPw, desiredPw)
+
+	existingProps, desiredProps := propertiesByName(existing), propertiesByName(desired)
+	for name, want := range desiredProps {
+		got, ok := existingProps[name]
+		if !ok {
+			diffs = append(diffs, "Properties."+name)
+			continue
+		}
+		if got.DisplayName != want.DisplayName || got.Type != want.Type || got.DependsOn != want.DependsOn ||
+			got.Required != want.Required || defaultValue(got.DefaultValue) != defaultValue(want.DefaultValue) {
+			diffs = append(diffs, "Properties."+name)
+		}
+	}
+	for name := range existingProps {
+		if _, ok := desiredProps[name]; !ok {
+			diffs = append(diffs, "Properties."+name)
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+func propertiesByName(st *api.CertificateStoreType) map[string]api.StoreTypePropertyDefinition {
+	props := make(map[string]api.StoreTypePropertyDefinition)
+	if st.Properties != nil {
+		for _, p := range *st.Properties {
+			props[p.Name] = p
+		}
+	}
+	return props
+}
+
+// defaultValue returns a property default for comparison. The API returns defaults as strings, definitions may use
+// JSON booleans and numbers.
+func defaultValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// Ensure creates st if no store type has its short name. If one exists with a different definition it is updated in
+// place when update is set, and left as is otherwise. The differing fields are returned with the outcome.
+func Ensure(ctx context.Context, client API, st *api.CertificateStoreType, update bool) (*api.CertificateStoreType, Outcome, []string, error) {
+	existing, err := Find(ctx, client, st.ShortName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if existing == nil {
+		resp, err := Create(ctx, client, st)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return resp, Created, nil, nil
+	}
+	diffs := Diff(existing, st)
+	if len(diffs) == 0 {
+		return existing, Unchanged, nil, nil
+	}
+	if !update {
+		return existing, Differs, diffs, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", diffs, err
+	}
+	req := *st
+	req.StoreType = existing.StoreType
+	if req.EntryParameters == nil || len(*req.EntryParameters) == 0 {
+		// Definitions don't carry entry parameters, keep the ones configured in Keyfactor.
+		req.EntryParameters = existing.EntryParameters
+	}
+	resp, err := client.UpdateStoreType(&req)
+	if err != nil {
+		return nil, "", diffs, fmt.Errorf("updating store type %s: %w", st.ShortName, err)
+	}
+	return resp, Updated, diffs, nil
+}